@@ -137,50 +137,8 @@ func runModeTest(mode models.Mode, testRequest *models.Request) *models.Dispatch
 	disp := dispatcher.NewWithConfig(config)
 
 	// Register vendors based on available API keys
-	openaiAPIKey := os.Getenv("OPENAI_API_KEY")
-	anthropicAPIKey := os.Getenv("ANTHROPIC_API_KEY")
-	googleAPIKey := os.Getenv("GOOGLE_API_KEY")
-
-	if openaiAPIKey != "" {
-		openaiConfig := &models.VendorConfig{
-			APIKey:  openaiAPIKey,
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-		openaiVendor := vendors.NewOpenAI(openaiConfig)
-		if err := disp.RegisterVendor(openaiVendor); err != nil {
-			log.Printf("⚠️  Failed to register OpenAI vendor: %v", err)
-		}
-	}
-
-	if anthropicAPIKey != "" {
-		anthropicConfig := &models.VendorConfig{
-			APIKey:  anthropicAPIKey,
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-		anthropicVendor := vendors.NewAnthropic(anthropicConfig)
-		if err := disp.RegisterVendor(anthropicVendor); err != nil {
-			log.Printf("⚠️  Failed to register Anthropic vendor: %v", err)
-		}
-	}
-
-	if googleAPIKey != "" {
-		googleConfig := &models.VendorConfig{
-			APIKey:  googleAPIKey,
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-		googleVendor := vendors.NewGoogle(googleConfig)
-		if err := disp.RegisterVendor(googleVendor); err != nil {
-			log.Printf("⚠️  Failed to register Google vendor: %v", err)
-		}
+	if _, err := vendors.RegisterAllFromEnv(disp); err != nil {
+		log.Printf("⚠️  Failed to register vendors: %v", err)
 	}
 
 	// Send the test request
@@ -268,12 +226,6 @@ func main() {
 		return
 	}
 
-	// Get API keys from environment variables
-	openaiAPIKey := os.Getenv("OPENAI_API_KEY")
-	anthropicAPIKey := os.Getenv("ANTHROPIC_API_KEY")
-	googleAPIKey := os.Getenv("GOOGLE_API_KEY")
-	azureOpenAIAPIKey := os.Getenv("AZURE_OPENAI_API_KEY")
-
 	// Create dispatcher with configuration
 	config := &models.Config{
 		Mode:          models.AutoMode,
@@ -297,85 +249,9 @@ func main() {
 
 	disp := dispatcher.NewWithConfig(config)
 
-	// Register OpenAI vendor (if API key is available)
-	if openaiAPIKey != "" {
-		openaiConfig := &models.VendorConfig{
-			APIKey:  openaiAPIKey,
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-
-		openaiVendor := vendors.NewOpenAI(openaiConfig)
-		if err := disp.RegisterVendor(openaiVendor); err != nil {
-			log.Printf("Failed to register OpenAI vendor: %v", err)
-		} else {
-			log.Println("✅ Registered OpenAI vendor")
-		}
-	} else {
-		log.Println("⚠️  OPENAI_API_KEY not set, skipping OpenAI vendor")
-	}
-
-	// Register Anthropic vendor (when implemented)
-	if anthropicAPIKey != "" {
-		anthropicConfig := &models.VendorConfig{
-			APIKey:  anthropicAPIKey,
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-
-		anthropicVendor := vendors.NewAnthropic(anthropicConfig)
-		if err := disp.RegisterVendor(anthropicVendor); err != nil {
-			log.Printf("Failed to register Anthropic vendor: %v", err)
-		} else {
-			log.Println("✅ Registered Anthropic vendor")
-		}
-	} else {
-		log.Println("⚠️  ANTHROPIC_API_KEY not set")
-	}
-
-	// Register Google vendor (when implemented)
-	if googleAPIKey != "" {
-		googleConfig := &models.VendorConfig{
-			APIKey:  googleAPIKey,
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-
-		googleVendor := vendors.NewGoogle(googleConfig)
-		if err := disp.RegisterVendor(googleVendor); err != nil {
-			log.Printf("Failed to register Google vendor: %v", err)
-		} else {
-			log.Println("✅ Registered Google vendor")
-		}
-	} else {
-		log.Println("⚠️  GOOGLE_API_KEY not set")
-	}
-
-	// Register Azure OpenAI vendor (when implemented)
-	if azureOpenAIAPIKey != "" {
-		azureConfig := &models.VendorConfig{
-			APIKey:  azureOpenAIAPIKey,
-			BaseURL: os.Getenv("AZURE_OPENAI_ENDPOINT"),
-			Timeout: 30 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-
-		azureVendor := vendors.NewAzureOpenAI(azureConfig)
-		if err := disp.RegisterVendor(azureVendor); err != nil {
-			log.Printf("Failed to register Azure OpenAI vendor: %v", err)
-		} else {
-			log.Println("✅ Registered Azure OpenAI vendor")
-		}
-	} else {
-		log.Println("⚠️  AZURE_OPENAI_API_KEY not set")
+	// Register every vendor configured in the environment
+	if _, err := vendors.RegisterAllFromEnv(disp); err != nil {
+		log.Printf("Failed to register vendors: %v", err)
 	}
 
 	// Check if we have any vendors registered
@@ -36,6 +36,7 @@ type RequestPayload struct {
 	User        string           `json:"user,omitempty"`
 	Vendor      string           `json:"vendor,omitempty"` // Optional vendor override
 	Mode        string           `json:"mode,omitempty"`   // Optional mode override
+	Tier        string           `json:"tier,omitempty"`   // Optional service tier, see Config.TierRouting
 }
 
 // ResponsePayload represents the response payload
@@ -46,6 +47,22 @@ type ResponsePayload struct {
 	Stats   *models.DispatcherStats `json:"stats,omitempty"`
 }
 
+// EmbeddingPayload represents an incoming embeddings request. Input is a
+// single string or a list of strings.
+type EmbeddingPayload struct {
+	Model string          `json:"model,omitempty"`
+	Input json.RawMessage `json:"input"`
+	Mode  string          `json:"mode,omitempty"`
+	User  string          `json:"user,omitempty"`
+}
+
+// EmbeddingResponsePayload represents the embeddings response payload
+type EmbeddingResponsePayload struct {
+	Success bool                      `json:"success"`
+	Data    *models.EmbeddingResponse `json:"data,omitempty"`
+	Error   string                    `json:"error,omitempty"`
+}
+
 // StreamingResponsePayload represents the streaming response payload
 type StreamingResponsePayload struct {
 	Success bool   `json:"success"`
@@ -80,6 +97,8 @@ func NewWebService() *WebService {
 			BackoffStrategy: models.ExponentialBackoff,
 			RetryableErrors: []string{"rate limit exceeded", "timeout"},
 		},
+		// /stats reads a snapshot refreshed at this interval
+		StatsSnapshotInterval: statsSnapshotInterval(),
 		// No ModeOverrides - let the real ModeStrategy work
 	}
 
@@ -95,6 +114,19 @@ func NewWebService() *WebService {
 	}
 }
 
+// statsSnapshotInterval returns the /stats refresh interval from
+// STATS_SNAPSHOT_INTERVAL (e.g. "500ms"), defaulting to one second
+func statsSnapshotInterval() time.Duration {
+	if value := os.Getenv("STATS_SNAPSHOT_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err == nil && interval > 0 {
+			return interval
+		}
+		log.Printf("⚠️  Invalid STATS_SNAPSHOT_INTERVAL %q, using default", value)
+	}
+	return time.Second
+}
+
 // loadEnv loads environment variables from .env file
 func loadEnv(filename string) error {
 	file, err := os.Open(filename)
@@ -124,105 +156,31 @@ func loadEnv(filename string) error {
 
 // registerVendors registers all available vendors
 func registerVendors(disp *dispatcher.Dispatcher) {
-	// Register OpenAI vendor
-	if openaiAPIKey := os.Getenv("OPENAI_API_KEY"); openaiAPIKey != "" {
-		openaiConfig := &models.VendorConfig{
-			APIKey:  openaiAPIKey,
-			BaseURL: "https://api.openai.com/v1",
-			Timeout: 120 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-
-		openaiVendor := vendors.NewOpenAI(openaiConfig)
-		if err := disp.RegisterVendor(openaiVendor); err != nil {
-			log.Printf("Failed to register OpenAI vendor: %v", err)
-		} else {
-			log.Println("✅ Registered OpenAI vendor")
-		}
-	} else {
-		log.Println("⚠️  OPENAI_API_KEY not set, skipping OpenAI vendor")
+	registered, err := vendors.RegisterAllFromEnv(disp)
+	if err != nil {
+		log.Printf("Failed to register vendors: %v", err)
 	}
-
-	// Register Anthropic vendor
-	if anthropicAPIKey := os.Getenv("ANTHROPIC_API_KEY"); anthropicAPIKey != "" {
-		anthropicConfig := &models.VendorConfig{
-			APIKey:  anthropicAPIKey,
-			BaseURL: "https://api.anthropic.com",
-			Timeout: 120 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
-		}
-
-		anthropicVendor := vendors.NewAnthropic(anthropicConfig)
-		if err := disp.RegisterVendor(anthropicVendor); err != nil {
-			log.Printf("Failed to register Anthropic vendor: %v", err)
-		} else {
-			log.Println("✅ Registered Anthropic vendor")
-		}
-	} else {
-		log.Println("⚠️  ANTHROPIC_API_KEY not set, skipping Anthropic vendor")
+	for _, name := range registered {
+		log.Printf("✅ Registered %s vendor", name)
 	}
 
-	// Register Google vendor
-	if googleAPIKey := os.Getenv("GOOGLE_API_KEY"); googleAPIKey != "" {
-		googleConfig := &models.VendorConfig{
-			APIKey:  googleAPIKey,
-			BaseURL: "https://generativelanguage.googleapis.com",
-			Timeout: 120 * time.Second,
+	// Fall back to a default local vendor (Ollama) when none is configured
+	if _, exists := disp.GetVendor("local"); !exists {
+		localConfig := &models.VendorConfig{
+			APIKey: "dummy", // Not used for local models
 			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
+				"server_url": "http://localhost:11434",
+				"model_path": "llama2:7b",
 			},
-		}
-
-		googleVendor := vendors.NewGoogle(googleConfig)
-		if err := disp.RegisterVendor(googleVendor); err != nil {
-			log.Printf("Failed to register Google vendor: %v", err)
-		} else {
-			log.Println("✅ Registered Google vendor")
-		}
-	} else {
-		log.Println("⚠️  GOOGLE_API_KEY not set, skipping Google vendor")
-	}
-
-	// Register Azure OpenAI vendor
-	if azureOpenAIAPIKey := os.Getenv("AZURE_OPENAI_API_KEY"); azureOpenAIAPIKey != "" {
-		azureConfig := &models.VendorConfig{
-			APIKey:  azureOpenAIAPIKey,
-			BaseURL: os.Getenv("AZURE_OPENAI_ENDPOINT"),
 			Timeout: 120 * time.Second,
-			Headers: map[string]string{
-				"User-Agent": "llmdispatcher/1.0",
-			},
 		}
 
-		azureVendor := vendors.NewAzureOpenAI(azureConfig)
-		if err := disp.RegisterVendor(azureVendor); err != nil {
-			log.Printf("Failed to register Azure OpenAI vendor: %v", err)
+		localVendor := vendors.NewLocal(localConfig)
+		if err := disp.RegisterVendor(localVendor); err != nil {
+			log.Printf("Failed to register Local vendor: %v", err)
 		} else {
-			log.Println("✅ Registered Azure OpenAI vendor")
+			log.Println("✅ Registered Local vendor")
 		}
-	} else {
-		log.Println("⚠️  AZURE_OPENAI_API_KEY not set, skipping Azure OpenAI vendor")
-	}
-
-	// Register Local vendor (Ollama)
-	localConfig := &models.VendorConfig{
-		APIKey: "dummy", // Not used for local models
-		Headers: map[string]string{
-			"server_url": "http://localhost:11434",
-			"model_path": "llama2:7b",
-		},
-		Timeout: 120 * time.Second,
-	}
-
-	localVendor := vendors.NewLocal(localConfig)
-	if err := disp.RegisterVendor(localVendor); err != nil {
-		log.Printf("Failed to register Local vendor: %v", err)
-	} else {
-		log.Println("✅ Registered Local vendor")
 	}
 }
 
@@ -242,6 +200,9 @@ func (ws *WebService) setupRoutes() *mux.Router {
 	// Streaming chat completion
 	api.HandleFunc("/chat/completions/stream", ws.streamingChatCompletionsHandler).Methods("POST")
 
+	// Embeddings
+	api.HandleFunc("/embeddings", ws.embeddingsHandler).Methods("POST")
+
 	// Vendor test endpoint
 	api.HandleFunc("/test/vendor", ws.testVendorHandler).Methods("POST")
 
@@ -254,9 +215,16 @@ func (ws *WebService) setupRoutes() *mux.Router {
 	// Vendors endpoint
 	api.HandleFunc("/vendors", ws.vendorsHandler).Methods("GET")
 
+	// Vendor admin endpoints
+	api.HandleFunc("/vendors/{name}/disable", ws.vendorEnabledHandler(false)).Methods("POST")
+	api.HandleFunc("/vendors/{name}/enable", ws.vendorEnabledHandler(true)).Methods("POST")
+
 	// Models endpoint
 	api.HandleFunc("/models", ws.modelsHandler).Methods("GET")
 
+	// Prometheus metrics
+	router.Handle("/metrics", ws.dispatcher.MetricsHandler()).Methods("GET")
+
 	// Serve static files
 	fs := http.FileServer(http.Dir("apps/server/static"))
 	router.PathPrefix("/").Handler(fs)
@@ -288,7 +256,7 @@ func (ws *WebService) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get available vendors with enabled status (same logic as vendorsHandler)
-	availableVendors := ws.dispatcher.GetVendors()
+	vendorStatuses := ws.dispatcher.GetVendorStatuses(r.Context())
 
 	// Create vendor info with enabled status
 	vendorInfo := make([]map[string]interface{}, 0)
@@ -306,9 +274,9 @@ func (ws *WebService) healthHandler(w http.ResponseWriter, r *http.Request) {
 	azureEnabled := azureKey != "" && !strings.Contains(azureKey, "your-") && !strings.Contains(azureKey, "here")
 	localEnabled := true // Local is always available
 
-	for _, vendor := range availableVendors {
+	for _, status := range vendorStatuses {
 		enabled := false
-		switch vendor {
+		switch status.Name {
 		case "openai":
 			enabled = openaiEnabled
 		case "anthropic":
@@ -322,8 +290,9 @@ func (ws *WebService) healthHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		vendorInfo = append(vendorInfo, map[string]interface{}{
-			"name":    vendor,
-			"enabled": enabled,
+			"name":      status.Name,
+			"enabled":   enabled && status.Enabled,
+			"available": status.Available,
 		})
 	}
 
@@ -359,6 +328,7 @@ func (ws *WebService) chatCompletionsHandler(w http.ResponseWriter, r *http.Requ
 		Stream:      false, // Force non-streaming for this endpoint
 		Stop:        payload.Stop,
 		User:        payload.User,
+		Tier:        payload.Tier,
 		Mode:        payload.Mode,
 	}
 
@@ -435,6 +405,53 @@ func (ws *WebService) chatCompletionsHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// embeddingsHandler handles embedding requests
+func (ws *WebService) embeddingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var payload EmbeddingPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var input []string
+	var single string
+	if err := json.Unmarshal(payload.Input, &single); err == nil {
+		input = []string{single}
+	} else if err := json.Unmarshal(payload.Input, &input); err != nil {
+		http.Error(w, "Invalid request: input must be a string or a list of strings", http.StatusBadRequest)
+		return
+	}
+
+	req := &models.EmbeddingRequest{
+		Model: payload.Model,
+		Input: input,
+		Mode:  payload.Mode,
+		User:  payload.User,
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ws.config.Timeout)
+	defer cancel()
+
+	response, err := ws.dispatcher.Embed(ctx, req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(EmbeddingResponsePayload{Success: false, Error: err.Error()}); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(EmbeddingResponsePayload{Success: true, Data: response}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
 // streamingChatCompletionsHandler handles streaming chat completion requests
 func (ws *WebService) streamingChatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
 	// Set proper headers for Server-Sent Events
@@ -462,6 +479,7 @@ func (ws *WebService) streamingChatCompletionsHandler(w http.ResponseWriter, r *
 		Stream:      true, // Force streaming for this endpoint
 		Stop:        payload.Stop,
 		User:        payload.User,
+		Tier:        payload.Tier,
 		Mode:        payload.Mode,
 	}
 
@@ -593,45 +611,29 @@ func (ws *WebService) testVendorHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		// For testing, we'll collect the streamed content
-		var content strings.Builder
-		done := false
-		for !done {
-			select {
-			case chunk, ok := <-streamResp.ContentChan:
-				if !ok {
-					done = true
-				} else {
-					content.WriteString(chunk)
-				}
-			case err := <-streamResp.ErrorChan:
-				if err != nil {
-					responsePayload := ResponsePayload{
-						Success: false,
-						Error:   err.Error(),
-					}
-					w.WriteHeader(http.StatusInternalServerError)
-					if err := json.NewEncoder(w).Encode(responsePayload); err != nil {
-						http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-					}
-					return
-				}
-				done = true
-			case <-streamResp.DoneChan:
-				done = true
-			case <-ctx.Done():
-				done = true
+		// For testing, we'll collect the streamed content; an error after
+		// partial content follows Config.StreamPartialContentPolicy
+		collected, err := ws.dispatcher.CollectStream(ctx, streamResp)
+		if err != nil {
+			responsePayload := ResponsePayload{
+				Success: false,
+				Error:   err.Error(),
 			}
+			w.WriteHeader(http.StatusInternalServerError)
+			if err := json.NewEncoder(w).Encode(responsePayload); err != nil {
+				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			}
+			return
 		}
 
-		streamResp.Close()
-
 		// Create response from streamed content
 		response = &models.Response{
-			Content:   content.String(),
-			Model:     req.Model,
-			Vendor:    payload.Vendor,
-			CreatedAt: time.Now(),
+			Content:      collected.Content,
+			Usage:        collected.Usage,
+			Model:        req.Model,
+			Vendor:       payload.Vendor,
+			FinishReason: collected.FinishReason,
+			CreatedAt:    time.Now(),
 		}
 	} else {
 		// Test direct request
@@ -668,7 +670,9 @@ func (ws *WebService) statsHandler(w http.ResponseWriter, r *http.Request) {
 	// Get mode filter from query parameter
 	mode := r.URL.Query().Get("mode")
 
-	stats := ws.dispatcher.GetStats()
+	// Read the periodically refreshed snapshot, which doesn't contend with
+	// in-flight requests for the stats lock
+	stats := ws.dispatcher.StatsSnapshot()
 
 	// If mode is specified, we need to create a temporary dispatcher to get mode-specific stats
 	if mode != "" {
@@ -792,8 +796,8 @@ func (ws *WebService) modeComparisonHandler(w http.ResponseWriter, r *http.Reque
 func (ws *WebService) vendorsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get available vendors
-	availableVendors := ws.dispatcher.GetVendors()
+	// Get registered vendors and their runtime state
+	vendorStatuses := ws.dispatcher.GetVendorStatuses(r.Context())
 
 	// Create vendor info with enabled status
 	vendorInfo := make([]map[string]interface{}, 0)
@@ -811,9 +815,9 @@ func (ws *WebService) vendorsHandler(w http.ResponseWriter, r *http.Request) {
 	azureEnabled := azureKey != "" && !strings.Contains(azureKey, "your-") && !strings.Contains(azureKey, "here")
 	localEnabled := true // Local is always available
 
-	for _, vendor := range availableVendors {
+	for _, status := range vendorStatuses {
 		enabled := false
-		switch vendor {
+		switch status.Name {
 		case "openai":
 			enabled = openaiEnabled
 		case "anthropic":
@@ -827,8 +831,9 @@ func (ws *WebService) vendorsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		vendorInfo = append(vendorInfo, map[string]interface{}{
-			"name":    vendor,
-			"enabled": enabled,
+			"name":      status.Name,
+			"enabled":   enabled && status.Enabled,
+			"available": status.Available,
 		})
 	}
 
@@ -839,6 +844,27 @@ func (ws *WebService) vendorsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// vendorEnabledHandler returns a handler that takes the named vendor out of
+// rotation or puts it back
+func (ws *WebService) vendorEnabledHandler(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		name := mux.Vars(r)["name"]
+		if err := ws.dispatcher.SetVendorEnabled(name, enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":    name,
+			"enabled": enabled,
+		}); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
 // modelsHandler handles model listing requests
 func (ws *WebService) modelsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -858,9 +884,14 @@ func (ws *WebService) modelsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return all vendor models
+	// Return the models of all registered vendors, or one deduplicated
+	// list with ?flat=true
+	var allModels interface{} = ws.dispatcher.AllModels()
+	if r.URL.Query().Get("flat") == "true" {
+		allModels = ws.dispatcher.AllModelNames()
+	}
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"models": models.VendorModels,
+		"models": allModels,
 	}); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
@@ -0,0 +1,43 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// recordAudit hands a vendor's response to the configured Recorder before
+// it is returned. A failed record only fails the request when
+// Config.FailClosedOnRecordError is set; otherwise it is logged.
+func (d *Dispatcher) recordAudit(ctx context.Context, req *models.Request, response *models.Response) error {
+	if d.config.Recorder == nil {
+		return nil
+	}
+
+	err := d.config.Recorder.Record(ctx, req, response)
+	if err == nil {
+		return nil
+	}
+	if d.config.FailClosedOnRecordError {
+		return fmt.Errorf("%w: %v", models.ErrAuditFailed, err)
+	}
+	d.logger.Error("Failed to record request", "model", req.Model, "error", err)
+	return nil
+}
+
+// failCachedResponse counts a request whose cached response could not be
+// audited as failed
+func (d *Dispatcher) failCachedResponse(req *models.Request, cached *models.Response, start time.Time, err error) {
+	d.statsMutex.Lock()
+	d.stats.FailedRequests++
+	d.statsMutex.Unlock()
+	d.emitEvent(cached.Vendor, responseModel(req, cached), time.Since(start), 0.0, 0, err)
+}
+
+// holdStreamsForAudit reports whether streamed content must be held back
+// until the stream has been recorded, since a failed record fails it
+func (d *Dispatcher) holdStreamsForAudit() bool {
+	return d.config.Recorder != nil && d.config.FailClosedOnRecordError
+}
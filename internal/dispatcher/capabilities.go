@@ -0,0 +1,208 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// defaultCapabilityTTL is how long fetched capabilities are reused when no
+// TTL is given
+const defaultCapabilityTTL = 10 * time.Minute
+
+// liveCapabilities caches the capabilities a CapabilityProvider fetched for
+// a vendor
+type liveCapabilities struct {
+	mu           sync.Mutex
+	provider     models.CapabilityProvider
+	ttl          time.Duration
+	capabilities models.Capabilities
+	fetched      time.Time
+}
+
+// SetCapabilityProvider makes the dispatcher take a vendor's capabilities
+// from provider instead of the vendor's hardcoded ones. Fetched capabilities
+// are reused for ttl, or defaultCapabilityTTL when ttl is zero. A nil
+// provider restores the vendor's own capabilities.
+func (d *Dispatcher) SetCapabilityProvider(vendorName string, provider models.CapabilityProvider, ttl time.Duration) error {
+	if _, exists := d.lookupVendor(vendorName); !exists {
+		return fmt.Errorf("vendor %s not found", vendorName)
+	}
+	if ttl <= 0 {
+		ttl = defaultCapabilityTTL
+	}
+
+	d.capabilitiesMutex.Lock()
+	defer d.capabilitiesMutex.Unlock()
+
+	if provider == nil {
+		delete(d.liveCapabilities, vendorName)
+		return nil
+	}
+	if d.liveCapabilities == nil {
+		d.liveCapabilities = make(map[string]*liveCapabilities)
+	}
+	d.liveCapabilities[vendorName] = &liveCapabilities{provider: provider, ttl: ttl}
+	return nil
+}
+
+// GetCapabilities returns a registered vendor's capabilities, refreshed
+// from its capability provider when one is set
+func (d *Dispatcher) GetCapabilities(ctx context.Context, vendorName string) (models.Capabilities, error) {
+	vendor, exists := d.lookupVendor(vendorName)
+	if !exists {
+		return models.Capabilities{}, fmt.Errorf("vendor %s not found", vendorName)
+	}
+	return d.capabilities(ctx, vendor), nil
+}
+
+// AllModels returns the models of each registered vendor, keyed by vendor
+// name, from the vendors' live capabilities
+func (d *Dispatcher) AllModels() map[string][]string {
+	ctx := context.Background()
+	vendors := d.registeredVendors()
+	all := make(map[string][]string, len(vendors))
+	for name, vendor := range vendors {
+		capabilities := d.capabilities(ctx, vendor)
+		all[name] = append([]string(nil), capabilities.Models...)
+	}
+	return all
+}
+
+// AllModelNames returns the models of all registered vendors as one sorted
+// list, with models offered by several vendors listed once
+func (d *Dispatcher) AllModelNames() []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, vendorModels := range d.AllModels() {
+		for _, model := range vendorModels {
+			if !seen[model] {
+				seen[model] = true
+				names = append(names, model)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// capabilities returns the vendor's capabilities, fetching them from its
+// capability provider once the cached ones are older than the TTL. When a
+// fetch fails the last fetched capabilities are kept, or the vendor's own
+// are used if there are none.
+func (d *Dispatcher) capabilities(ctx context.Context, vendor models.LLMVendor) models.Capabilities {
+	d.capabilitiesMutex.Lock()
+	live, ok := d.liveCapabilities[vendor.Name()]
+	d.capabilitiesMutex.Unlock()
+	if !ok {
+		return vendor.GetCapabilities()
+	}
+
+	// Fetches hold only this vendor's lock, so a slow provider doesn't
+	// stall lookups for other vendors
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	if !live.fetched.IsZero() && time.Since(live.fetched) < live.ttl {
+		return live.capabilities
+	}
+
+	capabilities, err := live.provider.FetchCapabilities(ctx)
+	if err != nil {
+		d.logger.Warn("Failed to refresh capabilities", "vendor", vendor.Name(), "error", err)
+		if live.fetched.IsZero() {
+			return vendor.GetCapabilities()
+		}
+		return live.capabilities
+	}
+	live.capabilities = capabilities
+	live.fetched = time.Now()
+	return capabilities
+}
+
+// vendorOfferingModel applies Config.UnknownVendorModelPolicy to the
+// selected vendor when its capabilities don't list model, returning the
+// vendor to send the request to. Under UnknownModelFallback that is the
+// first of the other candidates, by name, that is available and lists the
+// model.
+func (d *Dispatcher) vendorOfferingModel(ctx context.Context, vendor models.LLMVendor, model string, candidates map[string]models.LLMVendor) (models.LLMVendor, error) {
+	policy := d.config.UnknownVendorModelPolicy
+	if policy == "" || policy == models.UnknownModelForward || d.offersModel(ctx, vendor, model) {
+		return vendor, nil
+	}
+
+	err := fmt.Errorf("%w: %s does not list %s", models.ErrModelNotOffered, vendor.Name(), model)
+	if policy != models.UnknownModelFallback {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		if name != vendor.Name() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		candidate := candidates[name]
+		if d.offersModel(ctx, candidate, model) && d.vendorAvailable(ctx, candidate) {
+			d.logger.Info("Vendor does not list model, falling back", "vendor", vendor.Name(), "model", model, "fallback", name)
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w, nor does any other vendor", err)
+}
+
+// offersModel reports whether a vendor's capabilities list model. A vendor
+// that lists no models is taken to offer any.
+func (d *Dispatcher) offersModel(ctx context.Context, vendor models.LLMVendor, model string) bool {
+	offered := d.capabilities(ctx, vendor).Models
+	return len(offered) == 0 || slices.Contains(offered, model)
+}
+
+// checkFeatures rejects a request for model on vendor when the vendor's
+// feature matrix lists the model without a feature the request needs
+func (d *Dispatcher) checkFeatures(ctx context.Context, vendor models.LLMVendor, model string, required models.ModelFeatures) error {
+	features, ok := d.capabilities(ctx, vendor).Features[model]
+	if !ok {
+		return nil
+	}
+	if missing := features.Missing(required); len(missing) > 0 {
+		return fmt.Errorf("%w: %s on %s lacks %s", models.ErrFeatureNotSupported, model, vendor.Name(), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// vendorsSupportingFeatures leaves out the candidates whose model for the
+// request lacks a feature it needs. Without a requested model, each
+// vendor's model for the mode is checked. It fails when no candidate is
+// left.
+func (d *Dispatcher) vendorsSupportingFeatures(ctx context.Context, candidates map[string]models.LLMVendor, req *models.Request, mode models.Mode) (map[string]models.LLMVendor, error) {
+	required := req.RequiredFeatures()
+	if required == (models.ModelFeatures{}) {
+		return candidates, nil
+	}
+
+	supported := make(map[string]models.LLMVendor, len(candidates))
+	var lastErr error
+	for name, vendor := range candidates {
+		model := req.Model
+		if model == "" {
+			model = modelForVendorAndMode(vendor, mode)
+		}
+		if err := d.checkFeatures(ctx, vendor, model, required); err != nil {
+			lastErr = err
+			continue
+		}
+		supported[name] = vendor
+	}
+	if len(supported) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return supported, nil
+}
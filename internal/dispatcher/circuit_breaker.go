@@ -0,0 +1,247 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitCooldown         = 30 * time.Second
+)
+
+// circuitBreakers tracks a circuit breaker for each vendor called. A nil
+// *circuitBreakers lets every vendor through.
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	circuits  map[string]*circuit
+	now       func() time.Time
+}
+
+// circuit is the breaker state of one vendor
+type circuit struct {
+	state        models.CircuitState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	// probing is set while a half-open circuit's single probe is in flight
+	probing bool
+}
+
+// newCircuitBreakers returns nil unless the config is set
+func newCircuitBreakers(config *models.CircuitBreakerConfig) *circuitBreakers {
+	if config == nil {
+		return nil
+	}
+
+	breakers := &circuitBreakers{
+		threshold: config.FailureThreshold,
+		window:    config.Window,
+		cooldown:  config.Cooldown,
+		circuits:  make(map[string]*circuit),
+		now:       time.Now,
+	}
+	if breakers.threshold <= 0 {
+		breakers.threshold = defaultCircuitFailureThreshold
+	}
+	if breakers.cooldown <= 0 {
+		breakers.cooldown = defaultCircuitCooldown
+	}
+	return breakers
+}
+
+// allows reports whether a vendor may be selected, half-opening its
+// circuit once the cooldown has passed. A half-open circuit allows no one
+// while its probe is in flight.
+func (b *circuitBreakers) allows(name string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, exists := b.circuits[name]
+	if !exists {
+		return true
+	}
+	if c.state == models.CircuitOpen && b.now().Sub(c.openedAt) >= b.cooldown {
+		c.state = models.CircuitHalfOpen
+	}
+	return c.state == models.CircuitClosed || (c.state == models.CircuitHalfOpen && !c.probing)
+}
+
+// acquire is called right before a vendor is called and must be followed
+// by record. It claims a half-open circuit's probe, and returns
+// ErrVendorUnavailable when the circuit is open or its probe is taken.
+func (b *circuitBreakers) acquire(name string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, exists := b.circuits[name]
+	if !exists {
+		return nil
+	}
+	if c.state == models.CircuitOpen && b.now().Sub(c.openedAt) >= b.cooldown {
+		c.state = models.CircuitHalfOpen
+	}
+	switch {
+	case c.state == models.CircuitOpen:
+		return fmt.Errorf("%w: circuit open for %s", models.ErrVendorUnavailable, name)
+	case c.state == models.CircuitHalfOpen && c.probing:
+		return fmt.Errorf("%w: circuit half-open for %s, probe in flight", models.ErrVendorUnavailable, name)
+	case c.state == models.CircuitHalfOpen:
+		c.probing = true
+	}
+	return nil
+}
+
+// record updates a vendor's circuit with the outcome of a call made under
+// ctx, and releases the probe acquire claimed. Only errors that
+// isVendorFailure blames on the vendor count as failures.
+func (b *circuitBreakers) record(ctx context.Context, name string, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, exists := b.circuits[name]
+	if !exists {
+		c = &circuit{state: models.CircuitClosed}
+		b.circuits[name] = c
+	}
+	c.probing = false
+
+	if err == nil {
+		c.state = models.CircuitClosed
+		c.failures = 0
+		return
+	}
+	if !isVendorFailure(ctx, err) {
+		return
+	}
+
+	now := b.now()
+	if b.window > 0 && c.failures > 0 && now.Sub(c.firstFailure) > b.window {
+		c.failures = 0
+	}
+	if c.failures == 0 {
+		c.firstFailure = now
+	}
+	c.failures++
+
+	// A failed probe reopens the circuit at once
+	if c.state == models.CircuitHalfOpen || (c.state == models.CircuitClosed && c.failures >= b.threshold) {
+		c.state = models.CircuitOpen
+		c.openedAt = now
+	}
+}
+
+// isVendorFailure reports whether an error from a call made under ctx says
+// the vendor is unhealthy: a 5xx, 408 or 429 response, a network error, or
+// a timeout of the vendor's own. Rejected requests, such as other 4xx
+// responses and oversized payloads, say nothing about the vendor, and
+// neither do calls ended by ctx, whether cancelled or past its deadline.
+func isVendorFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var vendorErr *models.VendorError
+	if errors.As(err, &vendorErr) {
+		return vendorErr.StatusCode >= http.StatusInternalServerError ||
+			vendorErr.StatusCode == http.StatusTooManyRequests ||
+			vendorErr.StatusCode == http.StatusRequestTimeout
+	}
+	if errors.Is(err, models.ErrInvalidRequest) || errors.Is(err, models.ErrPayloadTooLarge) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, models.ErrTimeout) ||
+		errors.Is(err, models.ErrRateLimitExceeded) ||
+		errors.Is(err, models.ErrStreamInterrupted) ||
+		errors.Is(err, models.ErrVendorUnavailable)
+}
+
+// forget drops a vendor's circuit
+func (b *circuitBreakers) forget(name string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	delete(b.circuits, name)
+	b.mu.Unlock()
+}
+
+// stats returns the state of each vendor's circuit
+func (b *circuitBreakers) stats() map[string]models.CircuitBreakerStats {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make(map[string]models.CircuitBreakerStats, len(b.circuits))
+	for name, c := range b.circuits {
+		state := c.state
+		if state == models.CircuitOpen && b.now().Sub(c.openedAt) >= b.cooldown {
+			state = models.CircuitHalfOpen
+		}
+		stats[name] = models.CircuitBreakerStats{
+			State:               state,
+			ConsecutiveFailures: c.failures,
+			OpenedAt:            c.openedAt,
+		}
+	}
+	return stats
+}
+
+// startStream opens a stream from a vendor under its circuit breaker
+func (d *Dispatcher) startStream(ctx context.Context, vendor models.LLMVendor, req *models.Request) (*models.StreamingResponse, error) {
+	if err := d.circuitBreakers.acquire(vendor.Name()); err != nil {
+		return nil, err
+	}
+	stream, err := vendor.SendStreamingRequest(ctx, req)
+	d.circuitBreakers.record(ctx, vendor.Name(), err)
+	return stream, err
+}
+
+// vendorsWithClosedCircuit drops the vendors whose circuit is open. It
+// returns ErrVendorUnavailable when every vendor's circuit is open.
+func (d *Dispatcher) vendorsWithClosedCircuit(vendors map[string]models.LLMVendor) (map[string]models.LLMVendor, error) {
+	if d.circuitBreakers == nil || len(vendors) == 0 {
+		return vendors, nil
+	}
+
+	allowed := make(map[string]models.LLMVendor, len(vendors))
+	for name, vendor := range vendors {
+		if d.circuitBreakers.allows(name) {
+			allowed[name] = vendor
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("%w: circuit open for every vendor", models.ErrVendorUnavailable)
+	}
+	return allowed, nil
+}
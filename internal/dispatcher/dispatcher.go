@@ -2,22 +2,82 @@ package dispatcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/llmefficiency/llmdispatcher/internal/metrics"
 	"github.com/llmefficiency/llmdispatcher/internal/models"
 )
 
 // Dispatcher manages routing of LLM requests to different vendors
 type Dispatcher struct {
-	vendors      map[string]models.LLMVendor
-	config       *models.Config
-	stats        *models.DispatcherStats
-	statsMutex   sync.RWMutex
-	logger       *log.Logger
-	modeRegistry *models.ModeRegistry
+	// Registered vendors, guarded by vendorsMutex since vendors may be
+	// registered while requests are being routed
+	vendorsMutex  sync.RWMutex
+	vendors       map[string]models.LLMVendor
+	config        *models.Config
+	stats         *models.DispatcherStats
+	statsMutex    sync.RWMutex
+	logger        models.Logger
+	modeRegistry  *models.ModeRegistry
+	responseCache *responseCache
+	semanticCache *semanticCache
+	// Config.TokenCounter; nil counts with models.DefaultTokenCounter
+	tokenCounter models.TokenCounter
+
+	// Vendors taken out of rotation at runtime
+	disabledMutex   sync.RWMutex
+	disabledVendors map[string]bool
+
+	// Cancel funcs of in-flight requests, for CancelAll
+	inflightMutex  sync.Mutex
+	inflight       map[uint64]context.CancelFunc
+	nextInflightID uint64
+
+	// Runtime capability providers and their cached results
+	capabilitiesMutex sync.Mutex
+	liveCapabilities  map[string]*liveCapabilities
+
+	// Limiters enforcing each vendor's RateLimit, created on first use
+	rateLimitersMutex sync.Mutex
+	rateLimiters      map[string]*rateLimiter
+
+	// Random source for routing, seeded from Config.RoutingSeed
+	routingRand *rand.Rand
+
+	// Spend-rate alerting, nil unless configured
+	spendMonitor *spendMonitor
+
+	// Per-vendor circuit breakers, nil unless configured
+	circuitBreakers *circuitBreakers
+
+	// Prometheus metrics, nil unless Config.EnableMetrics is set
+	metrics *metrics.Metrics
+
+	// Periodic flush to Config.StatsStore, stopped by Close
+	statsFlushStop chan struct{}
+	statsFlushDone chan struct{}
+	closeOnce      sync.Once
+
+	// Stats copy refreshed every Config.StatsSnapshotInterval, read by
+	// StatsSnapshot without taking statsMutex; stopped by Close
+	statsSnapshot     atomic.Pointer[models.DispatcherStats]
+	statsSnapshotStop chan struct{}
+	statsSnapshotDone chan struct{}
+
+	// Completed request events, created by the first call to Events and
+	// closed by Close
+	eventsMutex  sync.RWMutex
+	events       chan models.RequestEvent
+	eventsClosed bool
 }
 
 // New creates a new dispatcher with default configuration
@@ -43,13 +103,73 @@ func NewWithConfig(config *models.Config) *Dispatcher {
 			VendorStats: make(map[string]models.VendorStats),
 			ModeStats:   make(map[models.Mode]*models.ModeStats),
 		},
-		logger:       log.New(log.Writer(), "[LLMDispatcher] ", log.LstdFlags),
-		modeRegistry: models.NewModeRegistry(),
+		logger:          newLogger(config),
+		modeRegistry:    models.NewModeRegistry(),
+		responseCache:   newResponseCache(config.Cache),
+		semanticCache:   newSemanticCache(config.SemanticCache),
+		tokenCounter:    config.TokenCounter,
+		routingRand:     newRoutingRand(config.RoutingSeed),
+		spendMonitor:    newSpendMonitor(config.SpendRateAlert),
+		circuitBreakers: newCircuitBreakers(config.CircuitBreaker),
+		metrics:         newMetrics(config.EnableMetrics),
+	}
+
+	if config.StatsStore != nil {
+		dispatcher.loadStats()
+
+		interval := config.StatsFlushInterval
+		if interval <= 0 {
+			interval = defaultStatsFlushInterval
+		}
+		dispatcher.statsFlushStop = make(chan struct{})
+		dispatcher.statsFlushDone = make(chan struct{})
+		go dispatcher.flushStatsLoop(interval)
+	}
+
+	if config.StatsSnapshotInterval > 0 {
+		dispatcher.statsSnapshot.Store(dispatcher.GetStats())
+		dispatcher.statsSnapshotStop = make(chan struct{})
+		dispatcher.statsSnapshotDone = make(chan struct{})
+		go dispatcher.refreshStatsSnapshotLoop(config.StatsSnapshotInterval)
 	}
 
 	return dispatcher
 }
 
+// newRoutingRand returns a random source for routing that is safe for
+// concurrent use. A zero seed is replaced by the current time.
+func newRoutingRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+}
+
+// lockedSource serializes access to a rand.Source, which is not safe for
+// concurrent use on its own
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
 // RegisterVendor registers a new vendor with the dispatcher
 func (d *Dispatcher) RegisterVendor(vendor models.LLMVendor) error {
 	if vendor == nil {
@@ -61,8 +181,40 @@ func (d *Dispatcher) RegisterVendor(vendor models.LLMVendor) error {
 		return fmt.Errorf("%w: vendor name cannot be empty", models.ErrInvalidConfig)
 	}
 
+	d.vendorsMutex.Lock()
 	d.vendors[name] = vendor
-	d.logger.Printf("Registered vendor: %s", name)
+	d.vendorsMutex.Unlock()
+	d.forgetRateLimiter(name)
+	d.circuitBreakers.forget(name)
+	d.logger.Info("Registered vendor", "vendor", name)
+	return nil
+}
+
+// DeregisterVendor removes a registered vendor, e.g. once its API key has
+// been revoked, so it is no longer selected. Requests already sent to it
+// are unaffected. Its stats are kept, while its enabled state and
+// capability provider are forgotten.
+func (d *Dispatcher) DeregisterVendor(name string) error {
+	d.vendorsMutex.Lock()
+	if _, exists := d.vendors[name]; !exists {
+		d.vendorsMutex.Unlock()
+		return fmt.Errorf("%w: %s", models.ErrVendorNotFound, name)
+	}
+	delete(d.vendors, name)
+	d.vendorsMutex.Unlock()
+
+	d.disabledMutex.Lock()
+	delete(d.disabledVendors, name)
+	d.disabledMutex.Unlock()
+
+	d.capabilitiesMutex.Lock()
+	delete(d.liveCapabilities, name)
+	d.capabilitiesMutex.Unlock()
+
+	d.forgetRateLimiter(name)
+	d.circuitBreakers.forget(name)
+
+	d.logger.Info("Deregistered vendor", "vendor", name)
 	return nil
 }
 
@@ -72,111 +224,422 @@ func (d *Dispatcher) Send(ctx context.Context, req *models.Request) (*models.Res
 		return nil, models.ErrInvalidRequest
 	}
 
+	// A context that is already done can't reach a vendor; fail before
+	// the request is counted or routed
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if req == nil {
 		return nil, models.ErrInvalidRequest
 	}
 
-	// Validate request
-	fmt.Printf("DEBUG: Dispatcher validating request with Model='%s', Mode='%s'\n", req.Model, req.Mode)
-	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %v", models.ErrInvalidRequest, err)
+	requestedModel := req.Model
+	req, err := d.prepareRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
+	ctx, release := d.trackRequest(ctx)
+	defer release()
+
 	start := time.Now()
 
-	// Update stats
-	d.statsMutex.Lock()
-	d.stats.TotalRequests++
-	d.stats.LastRequestTime = time.Now()
-	d.statsMutex.Unlock()
+	d.countRequest(req.Model)
+
+	// Resolve the mode once, before routing rewrites the model, so a
+	// ModelModeRules pattern matching the chosen model can't change it
+	mode := d.resolveMode(req)
 
 	// Apply timeout if configured
-	if d.config.Timeout > 0 {
+	if timeout := d.requestTimeout(req); timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
+	// Serve identical requests from the response cache
+	var cacheKey string
+	if d.responseCache.cacheable(req) {
+		key := responseCacheKey(req, mode)
+		if cached, ok := d.responseCache.lookup(key); ok {
+			if err := d.recordAudit(ctx, req, cached); err != nil {
+				d.failCachedResponse(req, cached, start, err)
+				return nil, err
+			}
+			d.statsMutex.Lock()
+			d.stats.SuccessfulRequests++
+			d.stats.CacheHits++
+			d.statsMutex.Unlock()
+			d.emitEvent(cached.Vendor, responseModel(req, cached), time.Since(start), 0.0, responseTokens(cached), nil)
+			return cached, nil
+		}
+		cacheKey = key
+		d.statsMutex.Lock()
+		d.stats.CacheMisses++
+		d.statsMutex.Unlock()
+	}
+
+	// Serve semantically similar prompts from the cache, unless the request
+	// must reach the vendor or carries images the embedding can't see
+	var promptEmbedding []float64
+	var semanticScope string
+	if d.semanticCache != nil && !req.NoCache && semanticCacheable(req) {
+		semanticScope = semanticCacheScope(req, mode)
+		embedding, err := d.semanticCache.embedder.Embed(ctx, promptText(req))
+		if err != nil {
+			d.logger.Warn("Semantic cache embedding failed", "error", err)
+		} else if cached, ok := d.semanticCache.lookup(semanticScope, embedding); ok {
+			if err := d.recordAudit(ctx, req, cached); err != nil {
+				d.failCachedResponse(req, cached, start, err)
+				return nil, err
+			}
+			d.statsMutex.Lock()
+			d.stats.SuccessfulRequests++
+			d.stats.SemanticCacheHits++
+			d.statsMutex.Unlock()
+			d.emitEvent(cached.Vendor, responseModel(req, cached), time.Since(start), 0.0, responseTokens(cached), nil)
+			return cached, nil
+		} else {
+			promptEmbedding = embedding
+			d.statsMutex.Lock()
+			d.stats.SemanticCacheMisses++
+			d.statsMutex.Unlock()
+		}
+	}
+
 	// Use mode-based vendor selection with context preprocessing
-	vendor, err := d.selectVendorWithMode(ctx, req)
+	cacheModel := req.Model
+	vendor, fallbacks, trace, err := d.selectVendorWithMode(ctx, req, mode)
 	if err != nil {
+		err = fmt.Errorf("failed to select vendor: %w", err)
 		d.updateStats(false, "", time.Since(start), 0.0)
-		return nil, fmt.Errorf("failed to select vendor: %w", err)
+		d.emitEvent("", req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+	d.applyModeStopSequences(ctx, req, vendor, mode)
+
+	if err := d.checkFeatures(ctx, vendor, req.Model, req.RequiredFeatures()); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	// switchTo makes a fallback the vendor the request goes to, choosing a
+	// model for it when the caller didn't pick one
+	switchTo := func(fallback models.LLMVendor) {
+		vendor = fallback
+		if cacheModel == "" {
+			if model := modelForVendorAndMode(vendor, mode); model != "" {
+				req.Model = model
+			}
+		}
+		if trace != nil {
+			trace.Vendor = vendor.Name()
+			trace.Reason = models.RoutingReasonFallback
+		}
 	}
 
+	// start times the whole request and attemptStart the current vendor's
+	// part of it
+	attemptStart := time.Now()
 	response, err := d.sendWithRetry(ctx, vendor, req)
+	if err != nil && d.config.AutoTrimOnPayloadTooLarge && errors.Is(err, models.ErrPayloadTooLarge) {
+		if trimmed, ok := trimHistory(req.Messages); ok {
+			d.logger.Warn("Vendor rejected payload as too large, retrying with fewer messages",
+				"vendor", vendor.Name(), "messages", len(trimmed), "original_messages", len(req.Messages))
+			req.Messages = trimmed
+			response, err = d.sendWithRetry(ctx, vendor, req)
+		}
+	}
+
+	// Work through the strategy's fallbacks, in order, while sends fail,
+	// and then Config.FallbackVendor once
+	tried := map[string]bool{vendor.Name(): true}
+	for _, fallback := range fallbacks {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if cacheModel == "" && !d.modeModelAllowed(fallback, mode) {
+			continue
+		}
+		d.updateVendorStats(false, vendor.Name(), time.Since(attemptStart))
+		d.logger.Warn("Vendor failed, falling back", "vendor", vendor.Name(), "error", err, "fallback", fallback.Name())
+
+		switchTo(fallback)
+		tried[vendor.Name()] = true
+		attemptStart = time.Now()
+		response, err = d.sendWithRetry(ctx, vendor, req)
+	}
+	if err != nil && ctx.Err() == nil {
+		if fallback := d.configuredFallback(ctx, tried); fallback != nil && (cacheModel != "" || d.modeModelAllowed(fallback, mode)) {
+			d.updateVendorStats(false, vendor.Name(), time.Since(attemptStart))
+			d.logger.Warn("Vendor failed, falling back", "vendor", vendor.Name(), "error", err, "fallback", fallback.Name())
+
+			switchTo(fallback)
+			attemptStart = time.Now()
+			response, err = d.sendWithRetry(ctx, vendor, req)
+		}
+	}
 	if err != nil {
-		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.updateStatsWithVendorLatency(false, vendor.Name(), time.Since(start), time.Since(attemptStart), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
 		return nil, err
 	}
 
+	separateReasoning(req, response)
+	d.repairJSONOutput(vendor.Name(), req, response)
+	d.recordRateLimits(vendor.Name(), response)
+	d.recordResponseSizes(vendor.Name(), response)
+	reportRewrittenModel(response, requestedModel, req.Model)
+	if trace != nil && response != nil {
+		response.RoutingTrace = trace
+	}
+
 	// Calculate estimated cost
-	var estimatedCost float64
-	if response != nil && response.Usage.TotalTokens > 0 {
-		totalTokens := response.Usage.PromptTokens + response.Usage.CompletionTokens
-		estimatedCost = estimateCost(totalTokens, vendor.Name())
-		response.EstimatedCost = estimatedCost
+	estimatedCost := d.responseCost(vendor.Name(), req, response)
+
+	if err := d.recordAudit(ctx, req, response); err != nil {
+		d.updateStatsWithVendorLatency(false, vendor.Name(), time.Since(start), time.Since(attemptStart), estimatedCost)
+		d.emitEvent(vendor.Name(), responseModel(req, response), time.Since(start), estimatedCost, responseTokens(response), err)
+		return nil, err
 	}
 
-	d.updateStats(true, vendor.Name(), time.Since(start), estimatedCost)
+	if promptEmbedding != nil && response != nil {
+		d.semanticCache.store(semanticScope, promptEmbedding, response, req.CacheTTL)
+	}
+	if cacheKey != "" && response != nil {
+		d.responseCache.store(cacheKey, response, req.CacheTTL)
+	}
+
+	d.updateStatsWithVendorLatency(true, vendor.Name(), time.Since(start), time.Since(attemptStart), estimatedCost)
+	d.emitEvent(vendor.Name(), responseModel(req, response), time.Since(start), estimatedCost, responseTokens(response), nil)
 	return response, nil
 }
 
+// prepareRequest validates a request and returns the normalized copy of it
+// that is routed, so mode optimizations never mutate the caller's request
+func (d *Dispatcher) prepareRequest(req *models.Request) (*models.Request, error) {
+	d.logger.Debug("Validating request", "model", req.Model, "mode", req.Mode)
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidRequest, err)
+	}
+
+	req = req.Clone()
+	if err := d.normalizeRequest(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// requestTimeout returns the timeout for a request: the base timeout plus
+// the per-token allowance for its MaxTokens, capped at MaxTimeout. Zero
+// means no timeout.
+func (d *Dispatcher) requestTimeout(req *models.Request) time.Duration {
+	timeout := d.config.Timeout
+	if d.config.TimeoutPerToken > 0 && req.MaxTokens > 0 {
+		timeout += d.config.TimeoutPerToken * time.Duration(req.MaxTokens)
+	}
+	if d.config.MaxTimeout > 0 && timeout > d.config.MaxTimeout {
+		timeout = d.config.MaxTimeout
+	}
+	return timeout
+}
+
+// trimHistory windows a conversation that a vendor rejected as too large.
+// System messages are always kept and the older half of the remaining
+// history is dropped, preserving message order and the latest turn. It
+// cuts on turn boundaries only: an assistant message's tool calls are
+// dropped or kept along with the tool results answering them. It reports
+// false when there is nothing left to remove.
+func trimHistory(messages []models.Message) ([]models.Message, bool) {
+	// turns holds the index of each turn's first message. Tool results
+	// belong to the turn that called them.
+	var turns []int
+	history := 0
+	for i, msg := range messages {
+		if msg.Role == "system" {
+			continue
+		}
+		history++
+		if msg.Role != "tool" || len(turns) == 0 {
+			turns = append(turns, i)
+		}
+	}
+	if len(turns) <= 1 {
+		return messages, false
+	}
+
+	// Drop whole turns until half the history is gone, keeping the last
+	drop := history - history/2
+	cut, dropped := 0, 0
+	for turn := 0; turn < len(turns)-1 && dropped < drop; turn++ {
+		cut = turns[turn+1]
+		for _, msg := range messages[turns[turn]:cut] {
+			if msg.Role != "system" {
+				dropped++
+			}
+		}
+	}
+
+	trimmed := make([]models.Message, 0, len(messages)-dropped)
+	for i, msg := range messages {
+		if i < cut && msg.Role != "system" {
+			continue
+		}
+		trimmed = append(trimmed, msg)
+	}
+	return trimmed, true
+}
+
 // SendStreaming sends a streaming request to the appropriate vendor
 func (d *Dispatcher) SendStreaming(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("%w: context cannot be nil", models.ErrInvalidRequest)
 	}
 
+	// Fail fast on a context that is already done, as Send does
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if req == nil {
 		return nil, fmt.Errorf("%w: request cannot be nil", models.ErrInvalidRequest)
 	}
 
-	// Validate request
-	fmt.Printf("DEBUG: Dispatcher validating streaming request with Model='%s', Mode='%s'\n", req.Model, req.Mode)
-	if err := req.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %v", models.ErrInvalidRequest, err)
+	req, err := d.prepareRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set streaming flag
 	req.Stream = true
 
+	// The request stays in flight until its relayed stream ends, which
+	// then releases it
+	ctx, release := d.trackRequest(ctx)
+	relayed := false
+	defer func() {
+		if !relayed {
+			release()
+		}
+	}()
+
 	start := time.Now()
 
-	// Update stats
-	d.statsMutex.Lock()
-	d.stats.TotalRequests++
-	d.stats.LastRequestTime = time.Now()
-	d.statsMutex.Unlock()
+	d.countRequest(req.Model)
+
+	// Resolve the mode once, before routing rewrites the model, as Send
+	// does
+	mode := d.resolveMode(req)
+
+	// Streams outlive this call, so vendor streams and a mid-stream
+	// fallback use the caller's context rather than the timeout context
+	// below, which is cancelled when this call returns
+	streamCtx := ctx
 
 	// Apply timeout if configured
-	if d.config.Timeout > 0 {
+	if timeout := d.requestTimeout(req); timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
 	// Use mode-based vendor selection with context preprocessing
-	vendor, err := d.selectVendorWithMode(ctx, req)
+	requestedModel := req.Model
+	vendor, _, _, err := d.selectVendorWithMode(ctx, req, mode)
 	if err != nil {
+		err = fmt.Errorf("failed to select vendor: %w", err)
 		d.updateStats(false, "", time.Since(start), 0.0)
-		return nil, fmt.Errorf("failed to select vendor: %w", err)
+		d.emitEvent("", req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
+	d.applyModeStopSequences(ctx, req, vendor, mode)
 
 	// Check if vendor supports streaming
-	if !vendor.GetCapabilities().SupportsStreaming {
-		return nil, fmt.Errorf("vendor %s does not support streaming", vendor.Name())
+	if !d.capabilities(ctx, vendor).SupportsStreaming {
+		if d.config.FallbackToUnaryStreaming {
+			return d.unaryStream(ctx, vendor, req, start)
+		}
+		err := fmt.Errorf("vendor %s does not support streaming", vendor.Name())
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
 
-	// Send streaming request
-	streamingResp, err := vendor.SendStreamingRequest(ctx, req)
-	if err != nil {
+	resolveVendorDefaultMaxTokens(req)
+	if err := d.checkHardMaxMessages(req); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+	if err := d.checkFeatures(ctx, vendor, req.Model, req.RequiredFeatures()); err != nil {
 		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
 		return nil, err
 	}
+	if err := d.checkMaxCost(req, vendor.Name()); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+	if err := d.waitForRateLimit(ctx, vendor, func() int { return d.requestTokens(req) }); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	// Send streaming request
+	streamStart := time.Now()
+	streamingResp, err := d.startStream(streamCtx, vendor, req)
+	if err != nil {
+		fallback, fallbackReq := d.streamingFallback(ctx, vendor.Name(), req, requestedModel, mode)
+		if fallback == nil {
+			d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+			d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+			return nil, err
+		}
+		d.updateVendorStats(false, vendor.Name(), time.Since(streamStart))
+		d.logger.Warn("Streaming vendor failed, falling back", "vendor", vendor.Name(), "error", err, "fallback", fallback.Name())
+
+		vendor = fallback
+		streamStart = time.Now()
+		streamingResp, err = d.startStream(streamCtx, vendor, fallbackReq)
+		if err != nil {
+			d.updateStatsWithVendorLatency(false, vendor.Name(), time.Since(start), time.Since(streamStart), 0.0)
+			d.emitEvent(vendor.Name(), fallbackReq.Model, time.Since(start), 0.0, 0, err)
+			return nil, err
+		}
+
+		d.updateStatsWithVendorLatency(true, vendor.Name(), time.Since(start), time.Since(streamStart), 0.0)
+		relayed = true
+		return d.relayStream(streamCtx, release, vendor.Name(), fallbackReq, streamStart, streamingResp, nil, d.streamReconnector(streamCtx, vendor, fallbackReq)), nil
+	}
 
 	d.updateStats(true, vendor.Name(), time.Since(start), 0.0) // Cost not available for streaming
-	return streamingResp, nil
+
+	// If the stream fails before its first chunk, continue it on the
+	// fallback. The request is counted already, so only the fallback's own
+	// stats change.
+	primary := vendor.Name()
+	resume := func() (string, *models.StreamingResponse, time.Time, bool) {
+		fallback, fallbackReq := d.streamingFallback(streamCtx, primary, req, requestedModel, mode)
+		if fallback == nil {
+			return "", nil, time.Time{}, false
+		}
+		d.logger.Warn("Streaming vendor failed before sending content, falling back", "vendor", primary, "fallback", fallback.Name())
+
+		fallbackStart := time.Now()
+		fallbackResp, err := d.startStream(streamCtx, fallback, fallbackReq)
+		d.updateVendorStats(err == nil, fallback.Name(), time.Since(fallbackStart))
+		if err != nil {
+			return "", nil, time.Time{}, false
+		}
+		return fallback.Name(), fallbackResp, fallbackStart, true
+	}
+
+	relayed = true
+	return d.relayStream(streamCtx, release, primary, req, streamStart, streamingResp, resume, d.streamReconnector(streamCtx, vendor, req)), nil
 }
 
 // SendToVendor sends a request to a specific vendor
@@ -185,6 +648,11 @@ func (d *Dispatcher) SendToVendor(ctx context.Context, vendorName string, req *m
 		return nil, fmt.Errorf("%w: context cannot be nil", models.ErrInvalidRequest)
 	}
 
+	// Fail fast on a context that is already done, as Send does
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if req == nil {
 		return nil, fmt.Errorf("%w: request cannot be nil", models.ErrInvalidRequest)
 	}
@@ -194,41 +662,73 @@ func (d *Dispatcher) SendToVendor(ctx context.Context, vendorName string, req *m
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
+	// Work on a copy so mode optimizations never mutate the caller's request
+	requestedModel := req.Model
+	req = req.Clone()
+	if err := d.normalizeRequest(req); err != nil {
+		return nil, err
+	}
+
+	ctx, release := d.trackRequest(ctx)
+	defer release()
+
 	start := time.Now()
 
-	// Update stats
-	d.statsMutex.Lock()
-	d.stats.TotalRequests++
-	d.stats.LastRequestTime = time.Now()
-	d.statsMutex.Unlock()
+	d.countRequest(req.Model)
 
 	// Get the specified vendor
-	vendor, exists := d.vendors[vendorName]
+	vendor, exists := d.lookupVendor(vendorName)
 	if !exists {
-		return nil, fmt.Errorf("vendor %s not found", vendorName)
+		err := fmt.Errorf("vendor %s not found", vendorName)
+		d.updateStats(false, "", time.Since(start), 0.0)
+		d.emitEvent("", req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
 
 	// Check if vendor is available
-	if !vendor.IsAvailable(ctx) {
-		return nil, fmt.Errorf("vendor %s is not available", vendorName)
+	if !d.isVendorEnabled(vendorName) || !d.vendorAvailable(ctx, vendor) {
+		err := fmt.Errorf("vendor %s is not available", vendorName)
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	if err := d.checkFeatures(ctx, vendor, req.Model, req.RequiredFeatures()); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
 
 	// Send request
 	response, err := d.sendWithRetry(ctx, vendor, req)
 	if err != nil {
+		// A SendToAll call cancelled after other vendors succeeded didn't fail
+		if errors.Is(context.Cause(ctx), models.ErrFanOutCancelled) {
+			d.recordCancellation(vendor.Name())
+			return nil, err
+		}
 		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
 		return nil, err
 	}
 
+	separateReasoning(req, response)
+	d.repairJSONOutput(vendor.Name(), req, response)
+	d.recordRateLimits(vendor.Name(), response)
+	d.recordResponseSizes(vendor.Name(), response)
+	reportRewrittenModel(response, requestedModel, req.Model)
+
 	// Calculate estimated cost
-	var estimatedCost float64
-	if response != nil && response.Usage.TotalTokens > 0 {
-		totalTokens := response.Usage.PromptTokens + response.Usage.CompletionTokens
-		estimatedCost = estimateCost(totalTokens, vendor.Name())
-		response.EstimatedCost = estimatedCost
+	estimatedCost := d.responseCost(vendor.Name(), req, response)
+
+	if err := d.recordAudit(ctx, req, response); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), estimatedCost)
+		d.emitEvent(vendor.Name(), responseModel(req, response), time.Since(start), estimatedCost, responseTokens(response), err)
+		return nil, err
 	}
 
 	d.updateStats(true, vendor.Name(), time.Since(start), estimatedCost)
+	d.emitEvent(vendor.Name(), responseModel(req, response), time.Since(start), estimatedCost, responseTokens(response), nil)
 	return response, nil
 }
 
@@ -238,6 +738,11 @@ func (d *Dispatcher) SendStreamingToVendor(ctx context.Context, vendorName strin
 		return nil, fmt.Errorf("%w: context cannot be nil", models.ErrInvalidRequest)
 	}
 
+	// Fail fast on a context that is already done, as Send does
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if req == nil {
 		return nil, fmt.Errorf("%w: request cannot be nil", models.ErrInvalidRequest)
 	}
@@ -247,123 +752,403 @@ func (d *Dispatcher) SendStreamingToVendor(ctx context.Context, vendorName strin
 		return nil, fmt.Errorf("request validation failed: %w", err)
 	}
 
+	// Work on a copy so mode optimizations never mutate the caller's request
+	req = req.Clone()
+	if err := d.normalizeRequest(req); err != nil {
+		return nil, err
+	}
+
 	// Set streaming flag
 	req.Stream = true
 
+	// The request stays in flight until its relayed stream ends, which
+	// then releases it
+	ctx, release := d.trackRequest(ctx)
+	relayed := false
+	defer func() {
+		if !relayed {
+			release()
+		}
+	}()
+
 	start := time.Now()
 
-	// Update stats
-	d.statsMutex.Lock()
-	d.stats.TotalRequests++
-	d.stats.LastRequestTime = time.Now()
-	d.statsMutex.Unlock()
+	d.countRequest(req.Model)
 
 	// Get the specified vendor
-	vendor, exists := d.vendors[vendorName]
+	vendor, exists := d.lookupVendor(vendorName)
 	if !exists {
-		return nil, fmt.Errorf("vendor %s not found", vendorName)
+		err := fmt.Errorf("vendor %s not found", vendorName)
+		d.updateStats(false, "", time.Since(start), 0.0)
+		d.emitEvent("", req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
 
 	// Check if vendor is available
-	if !vendor.IsAvailable(ctx) {
-		return nil, fmt.Errorf("vendor %s is not available", vendorName)
+	if !d.isVendorEnabled(vendorName) || !d.vendorAvailable(ctx, vendor) {
+		err := fmt.Errorf("vendor %s is not available", vendorName)
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
 
 	// Check if vendor supports streaming
-	if !vendor.GetCapabilities().SupportsStreaming {
-		return nil, fmt.Errorf("vendor %s does not support streaming", vendorName)
+	if !d.capabilities(ctx, vendor).SupportsStreaming {
+		if d.config.FallbackToUnaryStreaming {
+			return d.unaryStream(ctx, vendor, req, start)
+		}
+		err := fmt.Errorf("vendor %s does not support streaming", vendorName)
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	resolveVendorDefaultMaxTokens(req)
+	if err := d.checkHardMaxMessages(req); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+	if err := d.checkFeatures(ctx, vendor, req.Model, req.RequiredFeatures()); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+	if err := d.checkMaxCost(req, vendor.Name()); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+	if err := d.waitForRateLimit(ctx, vendor, func() int { return d.requestTokens(req) }); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
 	}
 
 	// Send streaming request
-	streamingResp, err := vendor.SendStreamingRequest(ctx, req)
+	streamStart := time.Now()
+	streamingResp, err := d.startStream(ctx, vendor, req)
 	if err != nil {
 		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
 		return nil, err
 	}
 
 	d.updateStats(true, vendor.Name(), time.Since(start), 0.0) // Cost not available for streaming
-	return streamingResp, nil
+	relayed = true
+	return d.relayStream(ctx, release, vendor.Name(), req, streamStart, streamingResp, nil, d.streamReconnector(ctx, vendor, req)), nil
 }
 
-// selectVendorWithMode uses the new mode system to select vendors with context preprocessing
-func (d *Dispatcher) selectVendorWithMode(ctx context.Context, req *models.Request) (models.LLMVendor, error) {
-	// Determine the mode to use
-	mode := d.config.Mode
-	if req.Mode != "" {
-		// TODO: Validate that the request mode is valid
-		// For now, we'll use the request mode if specified
-		mode = models.Mode(req.Mode)
+// selectVendorWithMode uses the new mode system to select vendors with context
+// preprocessing. It also returns the fallback vendors the strategy ranked
+// behind the selected one, if any. The returned trace is nil unless
+// Config.RecordRoutingTrace is set. mode is the request's, as resolveMode
+// returned it before any model was chosen.
+func (d *Dispatcher) selectVendorWithMode(ctx context.Context, req *models.Request, mode models.Mode) (models.LLMVendor, []models.LLMVendor, *models.RoutingTrace, error) {
+	requestedModel := req.Model
+	omittedMaxTokens := requestedModel == "" && req.MaxTokens == 0
+
+	// Leave out vendors too slow to answer before the deadline
+	candidates, err := d.vendorsWithinDeadline(ctx, d.enabledVendors())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Leave out vendors whose availability check hangs
+	candidates, err = d.vendorsAnsweringAvailability(ctx, candidates)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Leave out vendors whose circuit breaker is open
+	candidates, err = d.vendorsWithClosedCircuit(candidates)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Leave out vendors whose model lacks a feature the request needs
+	candidates, err = d.vendorsSupportingFeatures(ctx, candidates, req, mode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Leave out vendors whose model for the mode is not allowed, when the
+	// model is left to the mode; requested models were checked already
+	if requestedModel == "" {
+		candidates, err = d.vendorsWithAllowedModel(candidates, mode)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	// Get the mode strategy
 	strategy, err := d.modeRegistry.GetStrategy(mode)
 	if err != nil {
-		d.logger.Printf("Failed to get mode strategy for %s: %v", mode, err)
-		// Fallback to any available vendor
-		for name, vendor := range d.vendors {
-			if vendor.IsAvailable(ctx) {
-				d.logger.Printf("Using fallback vendor: %s", name)
-				return vendor, nil
-			}
-		}
-		return nil, fmt.Errorf("no available vendors")
+		d.logger.Warn("Failed to get mode strategy", "mode", mode, "error", err)
+		vendor, trace, err := d.fallbackVendor(ctx, mode, candidates)
+		return vendor, nil, trace, err
 	}
 
 	// Create mode context
 	modeContext := &models.ModeContext{
 		Mode:             mode,
 		Request:          req,
-		AvailableVendors: d.vendors,
+		AvailableVendors: candidates,
 		Config:           d.config,
 		Stats:            d.getModeStats(mode),
 		Context:          ctx,
+		VendorStats:      d.vendorStatsSnapshot(),
+		Rand:             d.routingRand,
 	}
 
 	// Validate context
 	if err := strategy.ValidateContext(modeContext); err != nil {
-		d.logger.Printf("Mode context validation failed: %v", err)
-		return nil, fmt.Errorf("mode context validation failed: %w", err)
+		d.logger.Warn("Mode context validation failed", "mode", mode, "error", err)
+		return nil, nil, nil, fmt.Errorf("mode context validation failed: %w", err)
 	}
 
 	// Preprocess context based on mode
 	if err := strategy.PreprocessContext(modeContext); err != nil {
-		d.logger.Printf("Context preprocessing failed: %v", err)
+		d.logger.Warn("Context preprocessing failed", "mode", mode, "error", err)
 		// Continue without preprocessing rather than failing
 	}
 
 	// Optimize request for the mode
 	if err := strategy.OptimizeRequest(modeContext); err != nil {
-		d.logger.Printf("Request optimization failed: %v", err)
+		d.logger.Warn("Request optimization failed", "mode", mode, "error", err)
 		// Continue without optimization rather than failing
 	}
 
 	// Select vendor using the mode strategy
 	vendor, err := strategy.SelectVendor(modeContext)
 	if err != nil {
-		d.logger.Printf("Mode-based vendor selection failed: %v", err)
-		// Fallback to any available vendor
-		for name, vendor := range d.vendors {
-			if vendor.IsAvailable(ctx) {
-				d.logger.Printf("Using fallback vendor: %s", name)
-				return vendor, nil
-			}
-		}
-		return nil, fmt.Errorf("no available vendors")
+		d.logger.Warn("Mode-based vendor selection failed", "mode", mode, "error", err)
+		vendor, trace, err := d.fallbackVendor(ctx, mode, candidates)
+		return vendor, nil, trace, err
 	}
 
 	// If no model is specified but we have a mode, select an appropriate model
 	if req.Model == "" && req.Mode != "" {
-		selectedModel := selectModelForVendorAndMode(vendor.Name(), mode)
+		selectedModel := modelForVendorAndMode(vendor, mode)
 		if selectedModel != "" {
 			req.Model = selectedModel
-			d.logger.Printf("Auto-selected model '%s' for vendor '%s' in mode '%s'", selectedModel, vendor.Name(), mode)
+			d.logger.Info("Auto-selected model", "model", selectedModel, "vendor", vendor.Name(), "mode", mode)
 		} else {
-			d.logger.Printf("Warning: Could not auto-select model for vendor '%s' in mode '%s'", vendor.Name(), mode)
+			d.logger.Warn("Could not auto-select model", "vendor", vendor.Name(), "mode", mode)
+		}
+	}
+
+	// A request leaving both the model and MaxTokens unset gets the default
+	// of the model chosen for it, over the mode's own
+	if omittedMaxTokens {
+		if tokens := d.defaultMaxTokens(req.Model); tokens > 0 {
+			req.MaxTokens = tokens
+		}
+	}
+
+	reason := modeContext.SelectionReason
+	if reason == "" {
+		reason = models.RoutingReasonHeuristic
+	}
+
+	// Models the mode chose are the vendor's own; only a requested model
+	// may be missing from its list
+	if requestedModel != "" {
+		selected := vendor
+		vendor, err = d.vendorOfferingModel(ctx, vendor, requestedModel, candidates)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if vendor != selected {
+			reason = models.RoutingReasonFallback
+		}
+	}
+
+	// Keep to the request's cost cap, moving to a cheaper vendor if the
+	// policy allows
+	if req.MaxCost > 0 {
+		selected := vendor
+		vendor, err = d.vendorWithinMaxCost(ctx, vendor, req, requestedModel, mode, candidates)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if vendor != selected {
+			reason = models.RoutingReasonFallback
+			// A model picked for the over-cap vendor is not the new one's
+			if requestedModel == "" {
+				req.Model = modelForVendorAndMode(vendor, mode)
+			}
+		}
+	}
+
+	// The strategy may set a model of its own
+	if requestedModel == "" && req.Model != "" {
+		if err := d.checkModelAllowed(req.Model); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	d.logger.Info("Selected vendor", "vendor", vendor.Name(), "mode", mode)
+	return vendor, modeContext.FallbackVendors, d.routingTrace(ctx, mode, candidates, vendor, reason), nil
+}
+
+// configuredFallback returns Config.FallbackVendor when it is registered,
+// enabled, available and not among the vendors already tried
+func (d *Dispatcher) configuredFallback(ctx context.Context, tried map[string]bool) models.LLMVendor {
+	name := d.config.FallbackVendor
+	if name == "" || tried[name] || !d.isVendorEnabled(name) {
+		return nil
+	}
+	vendor, exists := d.lookupVendor(name)
+	if !exists || !d.vendorAvailable(ctx, vendor) {
+		return nil
+	}
+	return vendor
+}
+
+// fallbackVendor returns any available candidate when the mode strategy
+// can't select a vendor, rechecking the candidates' health when none is
+// available and Config.HealthRecheckTimeout is set
+func (d *Dispatcher) fallbackVendor(ctx context.Context, mode models.Mode, candidates map[string]models.LLMVendor) (models.LLMVendor, *models.RoutingTrace, error) {
+	for name, vendor := range candidates {
+		if d.vendorAvailable(ctx, vendor) {
+			d.logger.Info("Using fallback vendor", "vendor", name)
+			return vendor, d.routingTrace(ctx, mode, candidates, vendor, models.RoutingReasonFallback), nil
+		}
+	}
+	if vendor := d.recheckHealth(ctx, candidates); vendor != nil {
+		d.logger.Info("Using recovered vendor", "vendor", vendor.Name())
+		return vendor, d.routingTrace(ctx, mode, candidates, vendor, models.RoutingReasonFallback), nil
+	}
+	return nil, nil, models.ErrNoEligibleVendor
+}
+
+// recheckHealth probes every candidate concurrently, giving them
+// Config.HealthRecheckTimeout to answer, and returns the first recovered
+// one by name, or nil when none recovered or rechecks are disabled
+func (d *Dispatcher) recheckHealth(ctx context.Context, candidates map[string]models.LLMVendor) models.LLMVendor {
+	if d.config.HealthRecheckTimeout <= 0 || len(candidates) == 0 {
+		return nil
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, d.config.HealthRecheckTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	recovered := make([]bool, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, vendor models.LLMVendor) {
+			defer wg.Done()
+			if prober, ok := vendor.(models.HealthProber); ok {
+				recovered[i] = prober.ProbeHealth(probeCtx)
+			} else {
+				recovered[i] = vendor.IsAvailable(probeCtx)
+			}
+		}(i, candidates[name])
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if recovered[i] {
+			return candidates[name]
+		}
+	}
+	return nil
+}
+
+// routingTrace records the selection of vendor among the candidates, sorted
+// by name. It returns nil when routing traces are disabled.
+func (d *Dispatcher) routingTrace(ctx context.Context, mode models.Mode, candidates map[string]models.LLMVendor, vendor models.LLMVendor, reason models.RoutingReason) *models.RoutingTrace {
+	if !d.config.RecordRoutingTrace {
+		return nil
+	}
+
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	trace := &models.RoutingTrace{
+		Mode:       mode,
+		Candidates: make([]models.RoutingCandidate, 0, len(names)),
+		Vendor:     vendor.Name(),
+		Reason:     reason,
+	}
+	for _, name := range names {
+		trace.Candidates = append(trace.Candidates, models.RoutingCandidate{
+			Vendor:    name,
+			Available: d.vendorAvailable(ctx, candidates[name]),
+		})
+	}
+	return trace
+}
+
+// streamingFallback returns the configured streaming fallback vendor and
+// the request to send it, or nil when the fallback can't take over from the
+// primary vendor. When the caller didn't pick a model, one is chosen for the
+// fallback vendor in the request's mode rather than reusing the primary's.
+func (d *Dispatcher) streamingFallback(ctx context.Context, primary string, req *models.Request, requestedModel string, mode models.Mode) (models.LLMVendor, *models.Request) {
+	name := d.config.StreamingFallbackVendor
+	if name == "" || name == primary {
+		return nil, nil
+	}
+
+	vendor, exists := d.lookupVendor(name)
+	if !exists || !d.isVendorEnabled(name) || !d.capabilities(ctx, vendor).SupportsStreaming || !d.vendorAvailable(ctx, vendor) {
+		return nil, nil
+	}
+	if requestedModel == "" && !d.modeModelAllowed(vendor, mode) {
+		return nil, nil
+	}
+
+	fallbackReq := req.Clone()
+	if requestedModel == "" {
+		if model := modelForVendorAndMode(vendor, mode); model != "" {
+			fallbackReq.Model = model
+		}
+	}
+	return vendor, fallbackReq
+}
+
+// resolveMode determines the mode for a request. An explicit request mode
+// wins, then the first model rule matching the requested model, then the
+// configured default mode.
+func (d *Dispatcher) resolveMode(req *models.Request) models.Mode {
+	// normalizeRequest has checked that the mode is registered
+	if req.Mode != "" {
+		return models.Mode(req.Mode)
+	}
+
+	if mode, ok := d.config.TierRouting[req.Tier]; ok && req.Tier != "" {
+		return mode
+	}
+
+	for _, rule := range d.config.ModelModeRules {
+		if rule.Matches(req.Model) {
+			return rule.Mode
 		}
 	}
 
-	d.logger.Printf("Selected vendor %s using mode %s", vendor.Name(), mode)
-	return vendor, nil
+	return d.config.Mode
+}
+
+// modelForVendorAndMode picks the model for a vendor in a mode, preferring
+// the vendor's configured tier model over the built-in defaults
+func modelForVendorAndMode(vendor models.LLMVendor, mode models.Mode) string {
+	if provider, ok := vendor.(models.TierModelProvider); ok {
+		if model := provider.TierModel(mode.Tier()); model != "" {
+			return model
+		}
+	}
+	return selectModelForVendorAndMode(vendor.Name(), mode)
 }
 
 // selectModelForVendorAndMode selects an appropriate model for a given vendor and mode
@@ -380,6 +1165,7 @@ func selectModelForVendorAndMode(vendor string, mode models.Mode) string {
 			"openai":    {"gpt-3.5-turbo", "gpt-4o-mini"},
 			"anthropic": {"claude-3-5-haiku-20241022", "claude-3-haiku-20240307"},
 			"google":    {"gemini-1.5-flash", "gemini-pro"},
+			"together":  {"meta-llama/Llama-3.1-8B-Instruct-Turbo"},
 			"local":     {"llama2:7b", "mistral:7b"},
 		}
 		if fastModelsForVendor, exists := fastModels[vendor]; exists {
@@ -398,6 +1184,7 @@ func selectModelForVendorAndMode(vendor string, mode models.Mode) string {
 			"openai":    {"gpt-4o", "gpt-4-turbo", "gpt-4"},
 			"anthropic": {"claude-3-5-sonnet-20241022", "claude-3-opus-20240229"},
 			"google":    {"gemini-1.5-pro", "gemini-pro"},
+			"together":  {"meta-llama/Llama-3.1-405B-Instruct-Turbo", "meta-llama/Llama-3.1-70B-Instruct-Turbo"},
 			"local":     {"llama2:70b", "llama3:70b"},
 		}
 		if sophisticatedModelsForVendor, exists := sophisticatedModels[vendor]; exists {
@@ -416,6 +1203,7 @@ func selectModelForVendorAndMode(vendor string, mode models.Mode) string {
 			"openai":    {"gpt-3.5-turbo", "gpt-4o-mini"},
 			"anthropic": {"claude-3-5-haiku-20241022", "claude-3-haiku-20240307"},
 			"google":    {"gemini-1.5-flash", "gemini-pro"},
+			"together":  {"meta-llama/Llama-3.1-8B-Instruct-Turbo"},
 			"local":     {"llama2:7b", "mistral:7b"},
 		}
 		if costSavingModelsForVendor, exists := costSavingModels[vendor]; exists {
@@ -454,6 +1242,15 @@ func (d *Dispatcher) getModeStats(mode models.Mode) *models.ModeStats {
 
 // sendWithRetry sends a request with retry logic
 func (d *Dispatcher) sendWithRetry(ctx context.Context, vendor models.LLMVendor, req *models.Request) (*models.Response, error) {
+	resolveVendorDefaultMaxTokens(req)
+	if err := d.checkHardMaxMessages(req); err != nil {
+		return nil, err
+	}
+	// Fallback vendors are held to the cost cap too
+	if err := d.checkMaxCost(req, vendor.Name()); err != nil {
+		return nil, err
+	}
+
 	var lastErr error
 	maxAttempts := 1
 
@@ -461,19 +1258,51 @@ func (d *Dispatcher) sendWithRetry(ctx context.Context, vendor models.LLMVendor,
 		maxAttempts = d.config.RetryPolicy.MaxRetries + 1
 	}
 
+	// The request sent, which carries the retry prompt after a short response
+	attemptReq := req
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		response, err := vendor.SendRequest(ctx, req)
+		if err := d.waitForRateLimit(ctx, vendor, func() int { return d.requestTokens(attemptReq) }); err != nil {
+			return nil, err
+		}
+		if err := d.circuitBreakers.acquire(vendor.Name()); err != nil {
+			return nil, err
+		}
+		response, err := vendor.SendRequest(ctx, attemptReq)
+		d.circuitBreakers.record(ctx, vendor.Name(), err)
+		if err == nil && d.config.RetryOnEmptyResponse && attempt < maxAttempts && isEmptyResponse(response) {
+			backoff := d.calculateBackoff(attempt)
+			d.logger.Warn("Empty response, retrying", "vendor", vendor.Name(), "attempt", attempt, "backoff", backoff)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+				continue
+			}
+		}
+		if err == nil && attempt < maxAttempts && d.isShortResponse(req, response) {
+			backoff := d.calculateBackoff(attempt)
+			d.logger.Warn("Response shorter than MinResponseTokens, retrying", "vendor", vendor.Name(), "attempt", attempt, "min_tokens", req.MinResponseTokens, "backoff", backoff)
+			attemptReq = withRetryPrompt(req, response)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+				continue
+			}
+		}
 		if err == nil {
 			return response, nil
 		}
 
 		lastErr = err
-		d.logger.Printf("Attempt %d failed for vendor %s: %v", attempt, vendor.Name(), err)
+		d.logger.Warn("Attempt failed", "vendor", vendor.Name(), "attempt", attempt, "error", err)
 
 		// Check if we should retry
-		if attempt < maxAttempts && d.shouldRetry(err) {
-			backoff := d.calculateBackoff(attempt)
-			d.logger.Printf("Retrying in %v", backoff)
+		if attempt < maxAttempts && d.shouldRetry(err, req, vendor) {
+			backoff := d.retryBackoff(attempt, err)
+			d.logger.Info("Retrying", "vendor", vendor.Name(), "backoff", backoff)
 
 			select {
 			case <-ctx.Done():
@@ -489,8 +1318,92 @@ func (d *Dispatcher) sendWithRetry(ctx context.Context, vendor models.LLMVendor,
 	return nil, fmt.Errorf("all attempts failed: %w", lastErr)
 }
 
-// shouldRetry determines if an error should trigger a retry
-func (d *Dispatcher) shouldRetry(err error) bool {
+// isShortResponse reports whether a response answers with fewer completion
+// tokens than the request's MinResponseTokens, counting them in its content
+// when the vendor reported none
+func (d *Dispatcher) isShortResponse(req *models.Request, response *models.Response) bool {
+	if req.MinResponseTokens <= 0 || response == nil || len(response.ToolCalls) > 0 {
+		return false
+	}
+	tokens := response.Usage.CompletionTokens
+	if tokens == 0 {
+		tokens = d.countTokens(req.Model, response.Content)
+	}
+	return tokens < req.MinResponseTokens
+}
+
+// withRetryPrompt returns the request to retry after a short response: the
+// request itself, or with the short response and MinResponseRetryPrompt
+// appended when the prompt is set
+func withRetryPrompt(req *models.Request, response *models.Response) *models.Request {
+	if req.MinResponseRetryPrompt == "" {
+		return req
+	}
+	retry := req.Clone()
+	retry.Messages = append(retry.Messages,
+		models.Message{Role: "assistant", Content: response.Content},
+		models.Message{Role: "user", Content: req.MinResponseRetryPrompt},
+	)
+	return retry
+}
+
+// isEmptyResponse reports whether a response has blank content for no
+// reason the vendor gave, i.e. without being blocked by a content filter
+// or answering with tool calls
+func isEmptyResponse(response *models.Response) bool {
+	if response == nil {
+		return true
+	}
+	if strings.TrimSpace(response.Content) != "" || len(response.ToolCalls) > 0 {
+		return false
+	}
+	switch response.FinishReason {
+	case "content_filter", "SAFETY":
+		return false
+	}
+	for _, rating := range response.SafetyRatings {
+		if rating.Blocked {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveVendorDefaultMaxTokens clears a MaxTokens of
+// models.MaxTokensVendorDefault, which has kept mode strategies from
+// setting their own limit, so the vendor receives no limit and applies its
+// default. It runs on a request about to be handed to a vendor.
+func resolveVendorDefaultMaxTokens(req *models.Request) {
+	if req.MaxTokens == models.MaxTokensVendorDefault {
+		req.MaxTokens = 0
+	}
+}
+
+// checkHardMaxMessages enforces Config.HardMaxMessages on a request about to
+// be handed to a vendor, after all preprocessing has run
+func (d *Dispatcher) checkHardMaxMessages(req *models.Request) error {
+	if d.config.HardMaxMessages > 0 && len(req.Messages) > d.config.HardMaxMessages {
+		return fmt.Errorf("%w: %d messages, limit %d", models.ErrTooManyMessagesAfterPreprocessing, len(req.Messages), d.config.HardMaxMessages)
+	}
+	return nil
+}
+
+// defaultRetryableErrors are retried under any retry policy
+var defaultRetryableErrors = []string{
+	"rate limit exceeded",
+	"timeout",
+	"connection refused",
+	"network error",
+}
+
+// shouldRetry determines if an error from vendor should trigger a retry of
+// req, whose RetryableErrors add to the policy's for that request. req and
+// vendor may be nil. An error is retryable when its message contains one of
+// the retryable errors, ignoring case, since vendors decorate the messages
+// with details such as "rate limit exceeded: retry after 20s". Otherwise an
+// error response from the vendor's API is retryable when its HTTP status is
+// among the vendor's retryable statuses.
+func (d *Dispatcher) shouldRetry(err error, req *models.Request, vendor models.LLMVendor) bool {
 	if d.config.RetryPolicy == nil {
 		return false
 	}
@@ -500,28 +1413,39 @@ func (d *Dispatcher) shouldRetry(err error) bool {
 		return false
 	}
 
-	// Check if error is in retryable errors list
-	errStr := err.Error()
-	for _, retryableErr := range d.config.RetryPolicy.RetryableErrors {
-		if errStr == retryableErr {
-			return true
-		}
+	errStr := strings.ToLower(err.Error())
+	if containsRetryableError(errStr, d.config.RetryPolicy.RetryableErrors) {
+		return true
+	}
+	if req != nil && containsRetryableError(errStr, req.RetryableErrors) {
+		return true
+	}
+
+	var vendorErr *models.VendorError
+	if errors.As(err, &vendorErr) {
+		return slices.Contains(retryableStatusCodes(vendor), vendorErr.StatusCode)
 	}
+	return containsRetryableError(errStr, defaultRetryableErrors)
+}
 
-	// Default retryable errors
-	defaultRetryableErrors := []string{
-		"rate limit exceeded",
-		"timeout",
-		"connection refused",
-		"network error",
+// retryableStatusCodes returns the HTTP statuses retried for vendor
+func retryableStatusCodes(vendor models.LLMVendor) []int {
+	if provider, ok := vendor.(models.RetryableStatusProvider); ok {
+		if codes := provider.RetryableStatusCodes(); codes != nil {
+			return codes
+		}
 	}
+	return models.DefaultRetryableStatusCodes
+}
 
-	for _, retryableErr := range defaultRetryableErrors {
-		if errStr == retryableErr {
+// containsRetryableError reports whether the lower-cased error message
+// contains any of the non-empty retryable errors
+func containsRetryableError(errStr string, retryableErrors []string) bool {
+	for _, retryableErr := range retryableErrors {
+		if retryableErr != "" && strings.Contains(errStr, strings.ToLower(retryableErr)) {
 			return true
 		}
 	}
-
 	return false
 }
 
@@ -532,6 +1456,7 @@ func (d *Dispatcher) calculateBackoff(attempt int) time.Duration {
 	}
 
 	baseDelay := time.Second
+	var delay time.Duration
 	switch d.config.RetryPolicy.BackoffStrategy {
 	case models.ExponentialBackoff:
 		// Use int64 to avoid integer overflow, cap at reasonable maximum
@@ -539,18 +1464,57 @@ func (d *Dispatcher) calculateBackoff(attempt int) time.Duration {
 		if backoff > 60 { // Cap at 60 seconds
 			backoff = 60
 		}
-		return baseDelay * time.Duration(backoff)
+		delay = baseDelay * time.Duration(backoff)
 	case models.LinearBackoff:
-		return baseDelay * time.Duration(attempt)
+		delay = baseDelay * time.Duration(attempt)
 	case models.FixedBackoff:
-		return baseDelay
+		delay = baseDelay
+	default:
+		delay = baseDelay
+	}
+	return d.jitter(delay)
+}
+
+// jitter randomizes a backoff according to RetryPolicy.Jitter
+func (d *Dispatcher) jitter(delay time.Duration) time.Duration {
+	int63n := rand.Int63n
+	if d.routingRand != nil {
+		int63n = d.routingRand.Int63n
+	}
+
+	switch d.config.RetryPolicy.Jitter {
+	case models.FullJitter:
+		return time.Duration(int63n(int64(delay) + 1))
+	case models.EqualJitter:
+		half := delay / 2
+		return half + time.Duration(int63n(int64(delay-half)+1))
 	default:
-		return baseDelay
+		return delay
+	}
+}
+
+// retryBackoff returns how long to wait before retrying after err: the
+// delay the vendor asked for in a Retry-After header, or else the policy's
+// backoff for the attempt
+func (d *Dispatcher) retryBackoff(attempt int, err error) time.Duration {
+	var vendorErr *models.VendorError
+	if errors.As(err, &vendorErr) && vendorErr.RetryAfter > 0 {
+		return vendorErr.RetryAfter
 	}
+	return d.calculateBackoff(attempt)
 }
 
 // updateStats updates the dispatcher statistics
 func (d *Dispatcher) updateStats(success bool, vendorName string, latency time.Duration, cost float64) {
+	d.updateStatsWithVendorLatency(success, vendorName, latency, latency, cost)
+}
+
+// updateStatsWithVendorLatency updates the dispatcher statistics for a
+// request that took latency overall, of which its last vendor call took
+// vendorLatency, as when the request fell back from other vendors first
+func (d *Dispatcher) updateStatsWithVendorLatency(success bool, vendorName string, latency, vendorLatency time.Duration, cost float64) {
+	d.spendMonitor.record(cost)
+
 	d.statsMutex.Lock()
 	defer d.statsMutex.Unlock()
 
@@ -560,44 +1524,72 @@ func (d *Dispatcher) updateStats(success bool, vendorName string, latency time.D
 		d.stats.FailedRequests++
 	}
 
-	// Update cost statistics
+	// Update cost statistics. Only successful vendor responses incur a
+	// cost; a stream's is added by recordStreamCost once it completes.
 	d.stats.TotalCost += cost
-	if d.stats.TotalRequests > 0 {
-		d.stats.AverageCost = d.stats.TotalCost / float64(d.stats.TotalRequests)
+	if success && vendorName != "" {
+		d.stats.CostSamples++
+	}
+	if d.stats.CostSamples > 0 {
+		d.stats.AverageCost = d.stats.TotalCost / float64(d.stats.CostSamples)
 	}
 
 	// Update vendor-specific stats
 	if vendorName != "" {
-		stats := d.stats.VendorStats[vendorName]
-		stats.Requests++
-		if success {
-			stats.Successes++
-		} else {
-			stats.Failures++
-		}
-		stats.LastUsed = time.Now()
+		d.updateVendorStatsLocked(success, vendorName, vendorLatency, cost)
+	}
 
-		// Update average latency
-		if stats.AverageLatency == 0 {
-			stats.AverageLatency = latency
-		} else {
-			stats.AverageLatency = (stats.AverageLatency + latency) / 2
-		}
+	// Update the mean latency of all requests
+	d.stats.LatencySamples++
+	d.stats.AverageLatency += (latency - d.stats.AverageLatency) / time.Duration(d.stats.LatencySamples)
+}
 
-		// Update cost statistics for vendor
-		stats.TotalCost += cost
-		if stats.Requests > 0 {
-			stats.AverageCost = stats.TotalCost / float64(stats.Requests)
-		}
+// updateVendorStats counts a call to a vendor that didn't end the request,
+// such as one the request then fell back from. Only the vendor's stats
+// change; updateStats counts the request once, when it ends.
+func (d *Dispatcher) updateVendorStats(success bool, vendorName string, latency time.Duration) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
 
-		d.stats.VendorStats[vendorName] = stats
-	}
+	d.updateVendorStatsLocked(success, vendorName, latency, 0.0)
+}
 
-	// Update global average latency
-	if d.stats.AverageLatency == 0 {
-		d.stats.AverageLatency = latency
+// updateVendorStatsLocked counts a call in a vendor's stats. The caller
+// must hold statsMutex.
+func (d *Dispatcher) updateVendorStatsLocked(success bool, vendorName string, latency time.Duration, cost float64) {
+	stats := d.stats.VendorStats[vendorName]
+	stats.Requests++
+	if success {
+		stats.Successes++
 	} else {
-		d.stats.AverageLatency = (d.stats.AverageLatency + latency) / 2
+		stats.Failures++
+	}
+	stats.LastUsed = time.Now()
+
+	// Update the mean latency of the vendor's requests
+	stats.AverageLatency += (latency - stats.AverageLatency) / time.Duration(stats.Requests)
+
+	// Update cost statistics for vendor
+	stats.TotalCost += cost
+	if stats.Successes > 0 {
+		stats.AverageCost = stats.TotalCost / float64(stats.Successes)
+	}
+
+	d.stats.VendorStats[vendorName] = stats
+}
+
+// countRequest records the start of a request for model
+func (d *Dispatcher) countRequest(model string) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	d.stats.TotalRequests++
+	d.stats.LastRequestTime = time.Now()
+	if model != "" {
+		if d.stats.RequestsByModel == nil {
+			d.stats.RequestsByModel = make(map[string]int64)
+		}
+		d.stats.RequestsByModel[model]++
 	}
 }
 
@@ -613,37 +1605,202 @@ func (d *Dispatcher) GetStats() *models.DispatcherStats {
 		stats.VendorStats[k] = v
 	}
 
-	// Copy mode stats
+	if d.stats.RequestsByModel != nil {
+		stats.RequestsByModel = make(map[string]int64, len(d.stats.RequestsByModel))
+		for k, v := range d.stats.RequestsByModel {
+			stats.RequestsByModel[k] = v
+		}
+	}
+
+	// Copy mode stats; they are updated in place, so share no pointers
 	stats.ModeStats = make(map[models.Mode]*models.ModeStats)
 	for k, v := range d.stats.ModeStats {
-		stats.ModeStats[k] = v
+		copied := *v
+		stats.ModeStats[k] = &copied
 	}
 
+	stats.CircuitBreakers = d.circuitBreakers.stats()
+
 	return &stats
 }
 
-// estimateCost estimates the cost of a request based on token usage and vendor
-func estimateCost(totalTokens int, vendor string) float64 {
-	// Cost per 1K tokens for different vendors (approximate rates)
-	costPer1KTokens := map[string]float64{
-		"openai":    0.03, // GPT-3.5-turbo rate
-		"anthropic": 0.15, // Claude-3-Sonnet rate
-		"google":    0.05, // Gemini-Pro rate
-		"azure":     0.03, // Azure OpenAI rate
-		"local":     0.0,  // Local models are free
+// StatsSnapshot returns the stats as of the last refresh, without taking
+// the stats lock, so frequent readers such as a /stats endpoint don't
+// contend with requests. The snapshot is refreshed every
+// Config.StatsSnapshotInterval and shared between callers, who must not
+// modify it. Without an interval it returns GetStats.
+func (d *Dispatcher) StatsSnapshot() *models.DispatcherStats {
+	if stats := d.statsSnapshot.Load(); stats != nil {
+		return stats
+	}
+	return d.GetStats()
+}
+
+// refreshStatsSnapshotLoop replaces the stats snapshot every interval until
+// Close is called
+func (d *Dispatcher) refreshStatsSnapshotLoop(interval time.Duration) {
+	defer close(d.statsSnapshotDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.statsSnapshot.Store(d.GetStats())
+		case <-d.statsSnapshotStop:
+			return
+		}
+	}
+}
+
+// responseCost prices a response from its token usage and records the cost
+// on it. A response without usage is priced from a token estimate of the
+// request and its content instead; it is flagged with CostEstimated and
+// counted in the vendor's MissingUsageCount.
+func (d *Dispatcher) responseCost(vendorName string, req *models.Request, response *models.Response) float64 {
+	if response == nil {
+		return 0.0
 	}
 
-	cost, exists := costPer1KTokens[vendor]
-	if !exists {
-		cost = 0.05 // Default cost
+	model := response.Model
+	if model == "" {
+		model = req.Model
+	}
+	if response.Usage.TotalTokens > 0 {
+		response.EstimatedCost = d.usageCost(response.Usage, vendorName, model)
+		return response.EstimatedCost
+	}
+
+	usage := d.estimateUsage(req, response.Content)
+	response.EstimatedCost = d.estimateCost(vendorName, model, usage.PromptTokens, usage.CompletionTokens)
+	response.CostEstimated = true
+
+	d.statsMutex.Lock()
+	stats := d.stats.VendorStats[vendorName]
+	stats.MissingUsageCount++
+	d.stats.VendorStats[vendorName] = stats
+	d.stats.EstimatedCostCount++
+	d.statsMutex.Unlock()
+
+	return response.EstimatedCost
+}
+
+// countTokens counts the tokens of text for model with the dispatcher's
+// TokenCounter
+func (d *Dispatcher) countTokens(model, text string) int {
+	counter := d.tokenCounter
+	if counter == nil {
+		counter = models.DefaultTokenCounter()
+	}
+	return counter.CountTokens(model, text)
+}
+
+// estimateUsage counts the token usage of req's messages and a completion
+// with the dispatcher's TokenCounter
+func (d *Dispatcher) estimateUsage(req *models.Request, completion string) models.Usage {
+	usage := models.Usage{CompletionTokens: d.countTokens(req.Model, completion)}
+	for _, msg := range req.Messages {
+		usage.PromptTokens += d.countTokens(req.Model, msg.Text())
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// recordRateLimits stores the remaining request and token limits a
+// response reported through its rate-limit headers in the vendor's stats
+func (d *Dispatcher) recordRateLimits(vendorName string, response *models.Response) {
+	if response == nil || len(response.VendorHeaders) == 0 {
+		return
+	}
+
+	requests, hasRequests := headerInt(response.VendorHeaders,
+		"x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining")
+	tokens, hasTokens := headerInt(response.VendorHeaders,
+		"x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining")
+	if !hasRequests && !hasTokens {
+		return
 	}
 
-	// Calculate cost for total tokens
-	return (float64(totalTokens) / 1000.0) * cost
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+	stats := d.stats.VendorStats[vendorName]
+	if hasRequests {
+		stats.RateLimitRemainingRequests = requests
+	}
+	if hasTokens {
+		stats.RateLimitRemainingTokens = tokens
+	}
+	stats.RateLimitObservedAt = time.Now()
+	d.stats.VendorStats[vendorName] = stats
+}
+
+// recordResponseSizes folds the sizes of a response's HTTP exchange into
+// the vendor's stats
+func (d *Dispatcher) recordResponseSizes(vendorName string, response *models.Response) {
+	if response == nil {
+		return
+	}
+	d.recordPayloadSizes(vendorName, response.RequestBytes, response.ResponseBytes)
+}
+
+// recordPayloadSizes folds the sizes of a request body sent to a vendor
+// and of its response into the vendor's average payload sizes, when
+// Config.TrackPayloadSizes is enabled. Exchanges the vendor didn't measure
+// are left out.
+func (d *Dispatcher) recordPayloadSizes(vendorName string, requestBytes, responseBytes int64) {
+	if !d.config.TrackPayloadSizes || (requestBytes == 0 && responseBytes == 0) {
+		return
+	}
+
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+	stats := d.stats.VendorStats[vendorName]
+	stats.PayloadSamples++
+	stats.TotalRequestBytes += requestBytes
+	stats.TotalResponseBytes += responseBytes
+	stats.AvgRequestBytes = float64(stats.TotalRequestBytes) / float64(stats.PayloadSamples)
+	stats.AvgResponseBytes = float64(stats.TotalResponseBytes) / float64(stats.PayloadSamples)
+	d.stats.VendorStats[vendorName] = stats
+}
+
+// headerInt parses the first of the named headers that holds an integer
+func headerInt(headers map[string]string, names ...string) (int64, bool) {
+	for _, name := range names {
+		if value, err := strconv.ParseInt(strings.TrimSpace(headers[name]), 10, 64); err == nil {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// estimateCost estimates the cost of a request's prompt and completion
+// tokens on a vendor's model, at the price in Config.Pricing or the
+// default pricing table
+func (d *Dispatcher) estimateCost(vendor, model string, promptTokens, completionTokens int) float64 {
+	return d.config.Pricing.Price(vendor, model).Cost(promptTokens, completionTokens)
+}
+
+// Prices of prompt cache writes and reads relative to uncached prompt
+// tokens, following Anthropic's prompt caching rates
+const (
+	cacheCreationPriceRatio = 1.25
+	cacheReadPriceRatio     = 0.1
+)
+
+// usageCost prices reported usage, charging the prompt tokens written to
+// or read from the vendor's prompt cache at their own rates
+func (d *Dispatcher) usageCost(usage models.Usage, vendor, model string) float64 {
+	uncached := usage.PromptTokens - usage.CacheCreationTokens - usage.CacheReadTokens
+	return d.estimateCost(vendor, model, uncached, usage.CompletionTokens) +
+		cacheCreationPriceRatio*d.estimateCost(vendor, model, usage.CacheCreationTokens, 0) +
+		cacheReadPriceRatio*d.estimateCost(vendor, model, usage.CacheReadTokens, 0)
 }
 
 // GetVendors returns a list of registered vendor names
 func (d *Dispatcher) GetVendors() []string {
+	d.vendorsMutex.RLock()
+	defer d.vendorsMutex.RUnlock()
+
 	vendors := make([]string, 0, len(d.vendors))
 	for name := range d.vendors {
 		vendors = append(vendors, name)
@@ -653,10 +1810,252 @@ func (d *Dispatcher) GetVendors() []string {
 
 // GetVendor returns a specific vendor by name
 func (d *Dispatcher) GetVendor(name string) (models.LLMVendor, bool) {
+	return d.lookupVendor(name)
+}
+
+// lookupVendor returns a registered vendor by name
+func (d *Dispatcher) lookupVendor(name string) (models.LLMVendor, bool) {
+	d.vendorsMutex.RLock()
+	defer d.vendorsMutex.RUnlock()
 	vendor, exists := d.vendors[name]
 	return vendor, exists
 }
 
+// registeredVendors returns a copy of the registered vendors, safe to range
+// over while vendors are registered
+func (d *Dispatcher) registeredVendors() map[string]models.LLMVendor {
+	d.vendorsMutex.RLock()
+	defer d.vendorsMutex.RUnlock()
+
+	vendors := make(map[string]models.LLMVendor, len(d.vendors))
+	for name, vendor := range d.vendors {
+		vendors[name] = vendor
+	}
+	return vendors
+}
+
+// SetVendorEnabled takes a registered vendor out of rotation or puts it
+// back. Disabled vendors stay registered but are treated as unavailable.
+func (d *Dispatcher) SetVendorEnabled(name string, enabled bool) error {
+	if _, exists := d.lookupVendor(name); !exists {
+		return fmt.Errorf("vendor %s not found", name)
+	}
+
+	d.disabledMutex.Lock()
+	defer d.disabledMutex.Unlock()
+
+	if enabled {
+		delete(d.disabledVendors, name)
+	} else {
+		if d.disabledVendors == nil {
+			d.disabledVendors = make(map[string]bool)
+		}
+		d.disabledVendors[name] = true
+	}
+	d.logger.Info("Set vendor enabled", "vendor", name, "enabled", enabled)
+	return nil
+}
+
+// isVendorEnabled reports whether a vendor is in rotation
+func (d *Dispatcher) isVendorEnabled(name string) bool {
+	d.disabledMutex.RLock()
+	defer d.disabledMutex.RUnlock()
+	return !d.disabledVendors[name]
+}
+
+// enabledVendors returns a copy of the registered vendors that are in
+// rotation
+func (d *Dispatcher) enabledVendors() map[string]models.LLMVendor {
+	vendors := d.registeredVendors()
+
+	d.disabledMutex.RLock()
+	defer d.disabledMutex.RUnlock()
+	for name := range d.disabledVendors {
+		delete(vendors, name)
+	}
+	return vendors
+}
+
+// deadlineLatencyMargin is the factor applied to a vendor's average latency
+// when judging whether it can respond before a context deadline
+const deadlineLatencyMargin = 1.25
+
+// vendorsWithinDeadline drops the vendors whose observed average latency,
+// with margin, exceeds the time left before the context deadline, so
+// selection prefers vendors that can answer in time. Vendors without
+// recorded latency are kept. It returns ErrInsufficientTimeBudget when every
+// vendor is too slow.
+func (d *Dispatcher) vendorsWithinDeadline(ctx context.Context, vendors map[string]models.LLMVendor) (map[string]models.LLMVendor, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok || len(vendors) == 0 {
+		return vendors, nil
+	}
+	remaining := time.Until(deadline)
+	stats := d.vendorStatsSnapshot()
+
+	candidates := make(map[string]models.LLMVendor, len(vendors))
+	for name, vendor := range vendors {
+		latency := stats[name].AverageLatency
+		if latency > 0 && time.Duration(float64(latency)*deadlineLatencyMargin) > remaining {
+			d.logger.Info("Skipping vendor: average latency exceeds remaining time", "vendor", name, "latency", latency, "remaining", remaining)
+			continue
+		}
+		candidates[name] = vendor
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no vendor responds within %v", models.ErrInsufficientTimeBudget, remaining)
+	}
+	return candidates, nil
+}
+
+// vendorsAnsweringAvailability drops the vendors whose IsAvailable doesn't
+// answer within Config.AvailabilityCheckTimeout. The checks run
+// concurrently, so a vendor that blocks without honoring its context can't
+// hold up selection past the bound. Vendors that answer are kept whatever
+// they report, leaving that to the strategy and the health recheck. It
+// returns ErrVendorUnavailable when no vendor answers in time.
+func (d *Dispatcher) vendorsAnsweringAvailability(ctx context.Context, vendors map[string]models.LLMVendor) (map[string]models.LLMVendor, error) {
+	timeout := d.availabilityCheckTimeout()
+	if timeout < 0 || len(vendors) == 0 {
+		return vendors, nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Buffered so that checks answering after the bound don't leak
+	answered := make(chan string, len(vendors))
+	for name, vendor := range vendors {
+		go func(name string, vendor models.LLMVendor) {
+			vendor.IsAvailable(checkCtx)
+			answered <- name
+		}(name, vendor)
+	}
+
+	candidates := make(map[string]models.LLMVendor, len(vendors))
+collect:
+	for len(candidates) < len(vendors) {
+		select {
+		case name := <-answered:
+			candidates[name] = vendors[name]
+		case <-checkCtx.Done():
+			break collect
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for name := range vendors {
+		if _, ok := candidates[name]; !ok {
+			d.logger.Warn("Skipping vendor: availability check timed out", "vendor", name, "timeout", timeout)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no vendor answered its availability check within %v", models.ErrVendorUnavailable, timeout)
+	}
+	return candidates, nil
+}
+
+// vendorAvailable reports whether vendor is available, bounding its check by
+// Config.AvailabilityCheckTimeout as vendorsAnsweringAvailability does. A
+// vendor that doesn't answer in time is taken to be unavailable.
+func (d *Dispatcher) vendorAvailable(ctx context.Context, vendor models.LLMVendor) bool {
+	timeout := d.availabilityCheckTimeout()
+	if timeout < 0 {
+		return vendor.IsAvailable(ctx)
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Buffered so that a check answering after the bound doesn't leak
+	answered := make(chan bool, 1)
+	go func() {
+		answered <- vendor.IsAvailable(checkCtx)
+	}()
+
+	select {
+	case available := <-answered:
+		return available
+	case <-checkCtx.Done():
+		d.logger.Warn("Treating vendor as unavailable: availability check timed out", "vendor", vendor.Name(), "timeout", timeout)
+		return false
+	}
+}
+
+// availabilityCheckTimeout returns Config.AvailabilityCheckTimeout, or the
+// default when it is unset. A negative timeout disables the bound.
+func (d *Dispatcher) availabilityCheckTimeout() time.Duration {
+	if d.config.AvailabilityCheckTimeout == 0 {
+		return models.DefaultAvailabilityCheckTimeout
+	}
+	return d.config.AvailabilityCheckTimeout
+}
+
+// trackRequest derives a context for an in-flight request that CancelAll can
+// cancel. The returned release func cancels it and stops tracking it; it
+// must be called once the request, or its stream, is finished.
+func (d *Dispatcher) trackRequest(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	d.inflightMutex.Lock()
+	if d.inflight == nil {
+		d.inflight = make(map[uint64]context.CancelFunc)
+	}
+	id := d.nextInflightID
+	d.nextInflightID++
+	d.inflight[id] = cancel
+	d.inflightMutex.Unlock()
+
+	return ctx, func() {
+		cancel()
+		d.inflightMutex.Lock()
+		delete(d.inflight, id)
+		d.inflightMutex.Unlock()
+	}
+}
+
+// CancelAll cancels the context of every in-flight request, including open
+// streams, which then fail with context.Canceled; their vendor streams are
+// closed and the vendors' HTTP requests end. Requests started afterwards
+// proceed normally. It is safe to call repeatedly.
+func (d *Dispatcher) CancelAll() {
+	d.inflightMutex.Lock()
+	cancels := make([]context.CancelFunc, 0, len(d.inflight))
+	for id, cancel := range d.inflight {
+		cancels = append(cancels, cancel)
+		delete(d.inflight, id)
+	}
+	d.inflightMutex.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	if len(cancels) > 0 {
+		d.logger.Info("Cancelled in-flight requests", "count", len(cancels))
+	}
+}
+
+// GetVendorStatuses reports the state of every registered vendor, sorted
+// by name
+func (d *Dispatcher) GetVendorStatuses(ctx context.Context) []models.VendorStatus {
+	vendors := d.registeredVendors()
+	statuses := make([]models.VendorStatus, 0, len(vendors))
+	for name, vendor := range vendors {
+		statuses = append(statuses, models.VendorStatus{
+			Name:      name,
+			Enabled:   d.isVendorEnabled(name),
+			Available: vendor.IsAvailable(ctx),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
 // GetModeRegistry returns the mode registry for external access
 func (d *Dispatcher) GetModeRegistry() *models.ModeRegistry {
 	return d.modeRegistry
@@ -2,13 +2,26 @@ package dispatcher
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/llmefficiency/llmdispatcher/internal/models"
+	"github.com/llmefficiency/llmdispatcher/internal/vendors"
 )
 
 // MockVendor is a mock implementation of LLMVendor for testing
@@ -480,11 +493,36 @@ func TestShouldRetry(t *testing.T) {
 			err:       nil,
 			wantRetry: false,
 		},
+		{
+			name:      "decorated retryable error",
+			err:       errors.New("rate limit exceeded: retry after 20s"),
+			wantRetry: true,
+		},
+		{
+			name:      "wrapped retryable error",
+			err:       fmt.Errorf("failed to send request: %w", errors.New("Post \"https://api.openai.com/v1/chat/completions\": net/http: request canceled (Client.Timeout exceeded while awaiting headers)")),
+			wantRetry: true,
+		},
+		{
+			name: "vendor error",
+			err: &models.VendorError{
+				Vendor:     "anthropic",
+				StatusCode: 429,
+				Message:    "Rate limit exceeded for requests per minute",
+				Code:       "rate_limit_error",
+			},
+			wantRetry: true,
+		},
+		{
+			name:      "default retryable error",
+			err:       errors.New("dial tcp 127.0.0.1:11434: connect: connection refused"),
+			wantRetry: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			shouldRetry := dispatcher.shouldRetry(tt.err)
+			shouldRetry := dispatcher.shouldRetry(tt.err, nil, nil)
 			if shouldRetry != tt.wantRetry {
 				t.Errorf("shouldRetry() = %v, want %v", shouldRetry, tt.wantRetry)
 			}
@@ -660,7 +698,7 @@ func TestDispatcher_SelectVendor_NoVendors(t *testing.T) {
 		},
 	}
 
-	vendor, err := dispatcher.selectVendorWithMode(context.Background(), req)
+	vendor, _, _, err := dispatcher.selectVendorWithMode(context.Background(), req, dispatcher.resolveMode(req))
 	if err == nil {
 		t.Error("Expected error when no vendors are registered")
 	}
@@ -686,7 +724,7 @@ func TestDispatcher_SelectVendor_Unavailable(t *testing.T) {
 		},
 	}
 
-	vendor, err := dispatcher.selectVendorWithMode(context.Background(), req)
+	vendor, _, _, err := dispatcher.selectVendorWithMode(context.Background(), req, dispatcher.resolveMode(req))
 	if err == nil {
 		t.Error("Expected error when no vendors are available")
 	}
@@ -714,7 +752,7 @@ func TestDispatcher_SelectVendor_ModeBased(t *testing.T) {
 		},
 	}
 
-	vendor, err := dispatcher.selectVendorWithMode(context.Background(), req)
+	vendor, _, _, err := dispatcher.selectVendorWithMode(context.Background(), req, dispatcher.resolveMode(req))
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -745,7 +783,7 @@ func TestDispatcher_SelectVendor_AvailableVendor(t *testing.T) {
 		},
 	}
 
-	vendor, err := dispatcher.selectVendorWithMode(context.Background(), req)
+	vendor, _, _, err := dispatcher.selectVendorWithMode(context.Background(), req, dispatcher.resolveMode(req))
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -1048,6 +1086,67 @@ func TestDispatcher_SendToVendor_VendorNotAvailable(t *testing.T) {
 	}
 }
 
+func TestDispatcher_EarlyFailuresCounted(t *testing.T) {
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+	}
+
+	tests := []struct {
+		name string
+		send func(d *Dispatcher) error
+	}{
+		{"vendor not found", func(d *Dispatcher) error {
+			_, err := d.SendToVendor(context.Background(), "nonexistent-vendor", newRequest())
+			return err
+		}},
+		{"vendor not available", func(d *Dispatcher) error {
+			_, err := d.SendToVendor(context.Background(), "unavailable", newRequest())
+			return err
+		}},
+		{"streaming vendor not available", func(d *Dispatcher) error {
+			_, err := d.SendStreamingToVendor(context.Background(), "unavailable", newRequest())
+			return err
+		}},
+		{"streaming to a vendor without streaming", func(d *Dispatcher) error {
+			_, err := d.SendStreamingToVendor(context.Background(), "unary", newRequest())
+			return err
+		}},
+		{"selected vendor without streaming", func(d *Dispatcher) error {
+			_, err := d.SendStreaming(context.Background(), newRequest())
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			dispatcher.RegisterVendor(&MockVendor{name: "unavailable", available: false})
+			dispatcher.RegisterVendor(&MockVendor{name: "unary", available: true})
+			events := dispatcher.Events()
+
+			if err := tt.send(dispatcher); err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+
+			stats := dispatcher.GetStats()
+			if stats.TotalRequests != 1 || stats.FailedRequests != 1 {
+				t.Errorf("Expected 1 failed request of 1, got %d of %d", stats.FailedRequests, stats.TotalRequests)
+			}
+			select {
+			case event := <-events:
+				if event.Success || event.Error == nil {
+					t.Errorf("Expected a failure event, got %+v", event)
+				}
+			default:
+				t.Error("Expected a failure event, got none")
+			}
+		})
+	}
+}
+
 func TestDispatcher_SendStreamingToVendor_Success(t *testing.T) {
 	dispatcher := New()
 
@@ -1231,7 +1330,7 @@ func TestDispatcher_ShouldRetry(t *testing.T) {
 	}
 
 	for _, err := range retryableErrors {
-		if !dispatcher.shouldRetry(err) {
+		if !dispatcher.shouldRetry(err, nil, nil) {
 			t.Errorf("Expected %v to be retryable", err)
 		}
 	}
@@ -1244,12 +1343,225 @@ func TestDispatcher_ShouldRetry(t *testing.T) {
 	}
 
 	for _, err := range nonRetryableErrors {
-		if dispatcher.shouldRetry(err) {
+		if dispatcher.shouldRetry(err, nil, nil) {
 			t.Errorf("Expected %v to not be retryable", err)
 		}
 	}
 }
 
+// flakyVendor fails its first failures requests with err
+type flakyVendor struct {
+	MockVendor
+	err      error
+	failures int
+	calls    int
+}
+
+func (v *flakyVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	v.calls++
+	if v.calls <= v.failures {
+		return nil, v.err
+	}
+	return v.MockVendor.SendRequest(ctx, req)
+}
+
+func TestDispatcher_RequestRetryableErrors(t *testing.T) {
+	dispatcher := &Dispatcher{
+		config: &models.Config{
+			RetryPolicy: &models.RetryPolicy{
+				MaxRetries:      1,
+				BackoffStrategy: models.FixedBackoff,
+				RetryableErrors: []string{"rate limit exceeded"},
+			},
+		},
+		logger: &stdLogger{logger: log.New(io.Discard, "", 0)},
+	}
+	err := errors.New("upstream busy")
+	req := &models.Request{
+		Model:           "test-model",
+		Messages:        []models.Message{{Role: "user", Content: "Hello"}},
+		RetryableErrors: []string{"upstream busy"},
+	}
+
+	if dispatcher.shouldRetry(err, nil, nil) {
+		t.Error("Expected the policy alone not to retry a custom error")
+	}
+	if !dispatcher.shouldRetry(err, req, nil) {
+		t.Error("Expected the request's retryable errors to retry a custom error")
+	}
+	if !dispatcher.shouldRetry(errors.New("rate limit exceeded"), req, nil) {
+		t.Error("Expected the policy's retryable errors to still apply")
+	}
+
+	vendor := &flakyVendor{MockVendor: MockVendor{name: "custom", available: true, response: &models.Response{Content: "ok"}}, err: err, failures: 1}
+	response, sendErr := dispatcher.sendWithRetry(context.Background(), vendor, req)
+	if sendErr != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", sendErr)
+	}
+	if response.Content != "ok" || vendor.calls != 2 {
+		t.Errorf("Expected a successful second attempt, got %q after %d calls", response.Content, vendor.calls)
+	}
+}
+
+func TestDispatcher_RetryDecoratedVendorErrors(t *testing.T) {
+	dispatcher := &Dispatcher{
+		config: &models.Config{
+			RetryPolicy: &models.RetryPolicy{
+				MaxRetries:      1,
+				BackoffStrategy: models.FixedBackoff,
+				RetryableErrors: []string{"Rate Limit Exceeded"},
+			},
+		},
+		logger: &stdLogger{logger: log.New(io.Discard, "", 0)},
+	}
+	// As the OpenAI vendor reports a 429
+	err := fmt.Errorf("failed to send request: %w", &models.VendorError{
+		Vendor:     "openai",
+		StatusCode: 429,
+		Message:    "Rate limit exceeded: retry after 20s",
+		Code:       "rate_limit_exceeded",
+	})
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	vendor := &flakyVendor{MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}}, err: err, failures: 1}
+	response, sendErr := dispatcher.sendWithRetry(context.Background(), vendor, req)
+	if sendErr != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", sendErr)
+	}
+	if response.Content != "ok" || vendor.calls != 2 {
+		t.Errorf("Expected a successful second attempt, got %q after %d calls", response.Content, vendor.calls)
+	}
+}
+
+// sequenceVendor returns its responses in turn, repeating the last
+type sequenceVendor struct {
+	MockVendor
+	responses []*models.Response
+	calls     int
+}
+
+func (v *sequenceVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	response := v.responses[min(v.calls, len(v.responses)-1)]
+	v.calls++
+	copied := *response
+	return &copied, nil
+}
+
+func TestDispatcher_RetryOnEmptyResponse(t *testing.T) {
+	empty := &models.Response{Content: "  "}
+	filtered := &models.Response{FinishReason: "content_filter"}
+	content := &models.Response{Content: "Hello!"}
+
+	tests := []struct {
+		name          string
+		retryOnEmpty  bool
+		responses     []*models.Response
+		expected      string
+		expectedCalls int
+	}{
+		{"empty then content", true, []*models.Response{empty, content}, "Hello!", 2},
+		{"disabled", false, []*models.Response{empty, content}, "  ", 1},
+		{"always empty stops at max retries", true, []*models.Response{empty}, "  ", 2},
+		{"filtered is not retried", true, []*models.Response{filtered, content}, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &Dispatcher{
+				config: &models.Config{
+					RetryPolicy:          &models.RetryPolicy{MaxRetries: 1, BackoffStrategy: models.FixedBackoff},
+					RetryOnEmptyResponse: tt.retryOnEmpty,
+				},
+				logger: &stdLogger{logger: log.New(io.Discard, "", 0)},
+			}
+			vendor := &sequenceVendor{MockVendor: MockVendor{name: "openai", available: true}, responses: tt.responses}
+
+			response, err := dispatcher.sendWithRetry(context.Background(), vendor, &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if response.Content != tt.expected {
+				t.Errorf("Expected content %q, got %q", tt.expected, response.Content)
+			}
+			if vendor.calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, vendor.calls)
+			}
+		})
+	}
+}
+
+func TestDispatcher_MinResponseTokens(t *testing.T) {
+	short := &models.Response{Content: "No.", Usage: models.Usage{CompletionTokens: 1}}
+	adequate := &models.Response{Content: "Paris is the capital and largest city of France.", Usage: models.Usage{CompletionTokens: 10}}
+	toolCall := &models.Response{ToolCalls: []models.ToolCall{{ID: "call_1", Name: "lookup"}}}
+
+	tests := []struct {
+		name          string
+		minTokens     int
+		retryPrompt   string
+		responses     []*models.Response
+		expected      string
+		expectedCalls int
+	}{
+		{"short then adequate", 5, "", []*models.Response{short, adequate}, adequate.Content, 2},
+		{"retry prompt", 5, "Please answer in full.", []*models.Response{short, adequate}, adequate.Content, 2},
+		{"short until retries run out", 5, "", []*models.Response{short}, short.Content, 2},
+		{"estimated from content", 5, "", []*models.Response{{Content: "No."}, adequate}, adequate.Content, 2},
+		{"tool calls exempt", 5, "", []*models.Response{toolCall, adequate}, "", 1},
+		{"no minimum", 0, "", []*models.Response{short, adequate}, short.Content, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &Dispatcher{
+				config: &models.Config{
+					RetryPolicy: &models.RetryPolicy{MaxRetries: 1, BackoffStrategy: models.FixedBackoff},
+				},
+				logger: &stdLogger{logger: log.New(io.Discard, "", 0)},
+			}
+			vendor := &scriptedVendor{MockVendor: MockVendor{name: "openai", available: true}, responses: tt.responses}
+
+			response, err := dispatcher.sendWithRetry(context.Background(), vendor, &models.Request{
+				Model:                  "test-model",
+				Messages:               []models.Message{{Role: "user", Content: "What is the capital of France?"}},
+				MinResponseTokens:      tt.minTokens,
+				MinResponseRetryPrompt: tt.retryPrompt,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if response.Content != tt.expected {
+				t.Errorf("Expected content %q, got %q", tt.expected, response.Content)
+			}
+			if len(vendor.requests) != tt.expectedCalls {
+				t.Fatalf("Expected %d calls, got %d", tt.expectedCalls, len(vendor.requests))
+			}
+
+			retried := vendor.requests[len(vendor.requests)-1].Messages
+			if tt.retryPrompt == "" {
+				if len(retried) != 1 {
+					t.Errorf("Expected the request to be retried as it was, got %+v", retried)
+				}
+				return
+			}
+			expected := []models.Message{
+				{Role: "user", Content: "What is the capital of France?"},
+				{Role: "assistant", Content: "No."},
+				{Role: "user", Content: tt.retryPrompt},
+			}
+			if !reflect.DeepEqual(retried, expected) {
+				t.Errorf("Expected the retry prompt after the short response, got %+v", retried)
+			}
+		})
+	}
+}
+
 func TestDispatcher_UpdateStats(t *testing.T) {
 	dispatcher := &Dispatcher{
 		stats: &models.DispatcherStats{
@@ -1312,3 +1624,5874 @@ func TestDispatcher_UpdateStats_NoVendor(t *testing.T) {
 		t.Errorf("Expected no vendor stats, got: %d", len(dispatcher.stats.VendorStats))
 	}
 }
+
+// capturingVendor records the last request it received
+type capturingVendor struct {
+	MockVendor
+	mu          sync.Mutex
+	lastRequest *models.Request
+	calls       int
+}
+
+func (c *capturingVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	c.mu.Lock()
+	c.lastRequest = req
+	c.calls++
+	c.mu.Unlock()
+	return c.MockVendor.SendRequest(ctx, req)
+}
+
+func (c *capturingVendor) LastRequest() *models.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRequest
+}
+
+func (c *capturingVendor) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func TestDispatcher_ModelModeRules(t *testing.T) {
+	config := &models.Config{
+		Mode: models.AutoMode,
+		ModelModeRules: []models.ModelModeRule{
+			{Pattern: "gpt-4*", Mode: models.SophisticatedMode},
+			{Pattern: "gpt-3.5", Mode: models.FastMode},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		model         string
+		mode          string
+		wantMode      models.Mode
+		wantMaxTokens int
+	}{
+		{
+			name:          "glob rule selects sophisticated mode",
+			model:         "gpt-4o",
+			wantMode:      models.SophisticatedMode,
+			wantMaxTokens: 1000,
+		},
+		{
+			name:          "prefix rule selects fast mode",
+			model:         "gpt-3.5-turbo",
+			wantMode:      models.FastMode,
+			wantMaxTokens: 150,
+		},
+		{
+			name:          "unmatched model falls back to config mode",
+			model:         "claude-3-opus-20240229",
+			wantMode:      models.AutoMode,
+			wantMaxTokens: 500,
+		},
+		{
+			name:          "explicit request mode wins over rules",
+			model:         "gpt-4o",
+			mode:          "cost_saving",
+			wantMode:      models.CostSavingMode,
+			wantMaxTokens: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(config)
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "openai",
+				available: true,
+				response:  &models.Response{Content: "ok", Vendor: "openai"},
+			}}
+			if err := dispatcher.RegisterVendor(vendor); err != nil {
+				t.Fatalf("Failed to register vendor: %v", err)
+			}
+
+			req := &models.Request{
+				Model:    tt.model,
+				Mode:     tt.mode,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			}
+
+			if got := dispatcher.resolveMode(req); got != tt.wantMode {
+				t.Errorf("resolveMode() = %s, want %s", got, tt.wantMode)
+			}
+
+			if _, err := dispatcher.Send(context.Background(), req); err != nil {
+				t.Fatalf("Send() failed: %v", err)
+			}
+
+			if _, exists := dispatcher.GetStats().ModeStats[tt.wantMode]; !exists {
+				t.Errorf("Expected request to be routed via %s mode", tt.wantMode)
+			}
+
+			sent := vendor.LastRequest()
+			if sent == nil {
+				t.Fatal("Expected vendor to receive the request")
+			}
+			if sent.MaxTokens != tt.wantMaxTokens {
+				t.Errorf("Expected %s mode max tokens %d, got %d", tt.wantMode, tt.wantMaxTokens, sent.MaxTokens)
+			}
+		})
+	}
+}
+
+func TestDispatcher_TierRouting(t *testing.T) {
+	config := &models.Config{
+		Mode: models.AutoMode,
+		ModelModeRules: []models.ModelModeRule{
+			{Pattern: "gpt-4*", Mode: models.FastMode},
+		},
+		TierRouting: map[string]models.Mode{
+			"free":    models.CostSavingMode,
+			"premium": models.SophisticatedMode,
+		},
+	}
+
+	tests := []struct {
+		name          string
+		tier          string
+		mode          string
+		wantMode      models.Mode
+		wantMaxTokens int
+	}{
+		{name: "free tier routes via cost saving", tier: "free", wantMode: models.CostSavingMode, wantMaxTokens: 100},
+		{name: "premium tier routes via sophisticated", tier: "premium", wantMode: models.SophisticatedMode, wantMaxTokens: 1000},
+		{name: "no tier falls back to model rules", wantMode: models.FastMode, wantMaxTokens: 150},
+		{name: "explicit request mode wins over tier", tier: "free", mode: "sophisticated", wantMode: models.SophisticatedMode, wantMaxTokens: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(config)
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "openai",
+				available: true,
+				response:  &models.Response{Content: "ok", Vendor: "openai"},
+			}}
+			dispatcher.RegisterVendor(vendor)
+
+			req := &models.Request{
+				Model:    "gpt-4o",
+				Mode:     tt.mode,
+				Tier:     tt.tier,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			}
+			if _, err := dispatcher.Send(context.Background(), req); err != nil {
+				t.Fatalf("Send() failed: %v", err)
+			}
+
+			if _, exists := dispatcher.GetStats().ModeStats[tt.wantMode]; !exists {
+				t.Errorf("Expected request to be routed via %s mode", tt.wantMode)
+			}
+			if sent := vendor.LastRequest(); sent.MaxTokens != tt.wantMaxTokens {
+				t.Errorf("Expected %s mode max tokens %d, got %d", tt.wantMode, tt.wantMaxTokens, sent.MaxTokens)
+			}
+		})
+	}
+
+	t.Run("unknown tier is rejected", func(t *testing.T) {
+		dispatcher := NewWithConfig(config)
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}})
+
+		_, err := dispatcher.Send(context.Background(), &models.Request{
+			Model:    "gpt-4o",
+			Tier:     "enterprise",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		})
+		if !errors.Is(err, models.ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_RequestMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		wantMode models.Mode
+		wantErr  error
+	}{
+		{name: "valid mode", mode: "fast", wantMode: models.FastMode},
+		{name: "empty mode uses config mode", mode: "", wantMode: models.CostSavingMode},
+		{name: "garbage mode", mode: "warp_speed", wantErr: models.ErrInvalidMode},
+		{name: "custom registered mode", mode: "score", wantMode: models.Mode("score")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{Mode: models.CostSavingMode})
+			dispatcher.RegisterModeStrategy("score", models.NewScoreBasedStrategy("score", models.ScoreWeights{}))
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "openai",
+				available: true,
+				response:  &models.Response{Content: "ok", Vendor: "openai"},
+			}}
+			dispatcher.RegisterVendor(vendor)
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Mode:     tt.mode,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+				if vendor.LastRequest() != nil {
+					t.Error("Expected the request not to reach the vendor")
+				}
+				if stats := dispatcher.GetStats(); stats.TotalRequests != 0 {
+					t.Errorf("Expected the request not to be counted, got %d", stats.TotalRequests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send() failed: %v", err)
+			}
+			if _, exists := dispatcher.GetStats().ModeStats[tt.wantMode]; !exists {
+				t.Errorf("Expected request to be routed via %s mode", tt.wantMode)
+			}
+		})
+	}
+
+	t.Run("streaming rejects garbage mode", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+
+		_, err := dispatcher.SendStreaming(context.Background(), &models.Request{
+			Mode:     "warp_speed",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		})
+		if !errors.Is(err, models.ErrInvalidMode) {
+			t.Errorf("Expected ErrInvalidMode, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_ModelFeatures(t *testing.T) {
+	features := map[string]models.ModelFeatures{
+		"text-model":   {Tools: true, Streaming: true},
+		"vision-model": {Vision: true, Tools: true, Streaming: true},
+	}
+	imageRequest := func(model string) *models.Request {
+		return &models.Request{
+			Model: model,
+			Messages: []models.Message{{Role: "user", Parts: []models.ContentPart{
+				{Type: models.ContentPartText, Text: "What is in this picture?"},
+				{Type: models.ContentPartImage, ImageURL: "https://example.com/cat.png"},
+			}}},
+		}
+	}
+	newVendor := func(name string, features map[string]models.ModelFeatures) *MockVendor {
+		return &MockVendor{
+			name:         name,
+			available:    true,
+			response:     &models.Response{Content: "A cat", Vendor: name},
+			capabilities: models.Capabilities{Features: features},
+		}
+	}
+
+	t.Run("vision request to a text-only model is rejected", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(newVendor("openai", features))
+
+		_, err := dispatcher.Send(context.Background(), imageRequest("text-model"))
+		if !errors.Is(err, models.ErrFeatureNotSupported) {
+			t.Fatalf("Expected ErrFeatureNotSupported, got %v", err)
+		}
+		_, err = dispatcher.SendToVendor(context.Background(), "openai", imageRequest("text-model"))
+		if !errors.Is(err, models.ErrFeatureNotSupported) || !strings.Contains(err.Error(), "vision") {
+			t.Errorf("Expected ErrFeatureNotSupported naming vision, got %v", err)
+		}
+	})
+
+	t.Run("vision request to a vision model is accepted", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(newVendor("openai", features))
+
+		if _, err := dispatcher.Send(context.Background(), imageRequest("vision-model")); err != nil {
+			t.Fatalf("Expected vision model to accept the request, got %v", err)
+		}
+		if _, err := dispatcher.SendToVendor(context.Background(), "openai", imageRequest("vision-model")); err != nil {
+			t.Fatalf("Expected vision model to accept the request, got %v", err)
+		}
+	})
+
+	t.Run("models without an entry are not restricted", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(newVendor("openai", features))
+
+		if _, err := dispatcher.Send(context.Background(), imageRequest("unlisted-model")); err != nil {
+			t.Fatalf("Expected unlisted model to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("selection skips vendors whose model lacks the feature", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(newVendor("text-only", map[string]models.ModelFeatures{
+			"shared-model": {Tools: true, Streaming: true},
+		}))
+		dispatcher.RegisterVendor(newVendor("vision", map[string]models.ModelFeatures{
+			"shared-model": {Vision: true, Streaming: true},
+		}))
+
+		for i := 0; i < 10; i++ {
+			response, err := dispatcher.Send(context.Background(), imageRequest("shared-model"))
+			if err != nil {
+				t.Fatalf("Send() failed: %v", err)
+			}
+			if response.Vendor != "vision" {
+				t.Fatalf("Expected the vision vendor to be selected, got %s", response.Vendor)
+			}
+		}
+	})
+}
+
+func TestDispatcher_ScoreBasedStrategy(t *testing.T) {
+	const scoreMode models.Mode = "score"
+	dispatcher := NewWithConfig(&models.Config{Mode: scoreMode, RecordRoutingTrace: true})
+	dispatcher.RegisterModeStrategy(scoreMode, models.NewScoreBasedStrategy(scoreMode, models.ScoreWeights{Latency: 1, Availability: 2}))
+
+	fastest := &capturingVendor{MockVendor: MockVendor{name: "fastest", available: true, shouldFail: true}}
+	steady := &capturingVendor{MockVendor: MockVendor{name: "steady", available: true, response: &models.Response{Content: "ok", Vendor: "steady"}}}
+	slowest := &capturingVendor{MockVendor: MockVendor{name: "slowest", available: true, response: &models.Response{Content: "ok", Vendor: "slowest"}}}
+	for _, vendor := range []models.LLMVendor{fastest, steady, slowest} {
+		dispatcher.RegisterVendor(vendor)
+	}
+
+	// Scores: fastest 1 + 2*1 = 3, steady 0.5 + 2*0.9 = 2.3, slowest 0.25 + 2*0.5 = 1.25
+	dispatcher.stats.VendorStats["fastest"] = models.VendorStats{Requests: 10, Successes: 10, AverageLatency: 100 * time.Millisecond}
+	dispatcher.stats.VendorStats["steady"] = models.VendorStats{Requests: 10, Successes: 9, AverageLatency: 200 * time.Millisecond}
+	dispatcher.stats.VendorStats["slowest"] = models.VendorStats{Requests: 10, Successes: 5, AverageLatency: 400 * time.Millisecond}
+
+	response, err := dispatcher.Send(context.Background(), &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	if fastest.calls != 1 {
+		t.Errorf("Expected the best-scoring vendor to be tried first, got %d calls", fastest.calls)
+	}
+	if response.Vendor != "steady" || steady.calls != 1 {
+		t.Errorf("Expected the next-best vendor to answer, got %s", response.Vendor)
+	}
+	if slowest.calls != 0 {
+		t.Errorf("Expected the lowest-scoring vendor not to be tried, got %d calls", slowest.calls)
+	}
+	if trace := response.RoutingTrace; trace == nil || trace.Vendor != "steady" || trace.Reason != models.RoutingReasonFallback {
+		t.Errorf("Expected the trace to record the fallback to steady, got %+v", trace)
+	}
+}
+func TestDispatcher_Send_PayloadTooLarge(t *testing.T) {
+	newServer := func(calls *[]int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Messages []models.Message `json:"messages"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			*calls = append(*calls, len(body.Messages))
+
+			if len(body.Messages) > 3 {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				w.Write([]byte("request entity too large"))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"model":"gpt-4","choices":[{"message":{"role":"assistant","content":"trimmed ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`))
+		}))
+	}
+
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model: "gpt-4",
+			Messages: []models.Message{
+				{Role: "system", Content: "You are helpful"},
+				{Role: "user", Content: "First question"},
+				{Role: "assistant", Content: "First answer"},
+				{Role: "user", Content: "Second question"},
+				{Role: "assistant", Content: "Second answer"},
+				{Role: "user", Content: "Latest question"},
+			},
+		}
+	}
+
+	t.Run("typed error without auto-trim", func(t *testing.T) {
+		var calls []int
+		server := newServer(&calls)
+		defer server.Close()
+
+		dispatcher := NewWithConfig(&models.Config{Mode: models.AutoMode})
+		dispatcher.RegisterVendor(vendors.NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL}))
+
+		_, err := dispatcher.Send(context.Background(), newRequest())
+		var payloadErr *models.PayloadTooLargeError
+		if !errors.As(err, &payloadErr) {
+			t.Fatalf("Expected PayloadTooLargeError, got: %v", err)
+		}
+		if len(calls) != 1 {
+			t.Errorf("Expected 1 vendor call, got %d", len(calls))
+		}
+	})
+
+	t.Run("auto-trim retries once with shorter history", func(t *testing.T) {
+		var calls []int
+		server := newServer(&calls)
+		defer server.Close()
+
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                      models.AutoMode,
+			AutoTrimOnPayloadTooLarge: true,
+		})
+		dispatcher.RegisterVendor(vendors.NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL}))
+
+		response, err := dispatcher.Send(context.Background(), newRequest())
+		if err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+		if response.Content != "trimmed ok" {
+			t.Errorf("Expected content 'trimmed ok', got '%s'", response.Content)
+		}
+		if len(calls) != 2 || calls[0] != 6 || calls[1] != 3 {
+			t.Errorf("Expected calls with 6 then 3 messages, got %v", calls)
+		}
+	})
+}
+
+func TestTrimHistory(t *testing.T) {
+	messages := []models.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "u1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "u2"},
+	}
+
+	trimmed, ok := trimHistory(messages)
+	if !ok {
+		t.Fatal("Expected history to be trimmed")
+	}
+	if len(trimmed) != 2 || trimmed[0].Role != "system" || trimmed[1].Content != "u2" {
+		t.Errorf("Unexpected trimmed history: %+v", trimmed)
+	}
+
+	if _, ok := trimHistory(trimmed); ok {
+		t.Error("Expected no trimming when only one non-system message remains")
+	}
+}
+
+func TestTrimHistory_ToolCalls(t *testing.T) {
+	call := func(ids ...string) []models.ToolCall {
+		calls := make([]models.ToolCall, len(ids))
+		for i, id := range ids {
+			calls[i] = models.ToolCall{ID: id, Name: "get_weather", Arguments: `{}`}
+		}
+		return calls
+	}
+
+	t.Run("tool exchange at the cut point", func(t *testing.T) {
+		// Halving six messages would cut between the two tool results
+		messages := []models.Message{
+			{Role: "user", Content: "u1"},
+			{Role: "assistant", ToolCalls: call("call_1", "call_2")},
+			{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+			{Role: "tool", ToolCallID: "call_2", Content: "rainy"},
+			{Role: "assistant", Content: "a1"},
+			{Role: "user", Content: "u2"},
+		}
+
+		trimmed, ok := trimHistory(messages)
+		if !ok {
+			t.Fatal("Expected history to be trimmed")
+		}
+		if len(trimmed) != 2 || trimmed[0].Content != "a1" || trimmed[1].Content != "u2" {
+			t.Errorf("Expected the tool calls dropped with their results, got %+v", trimmed)
+		}
+	})
+
+	t.Run("tool exchange kept whole", func(t *testing.T) {
+		messages := []models.Message{
+			{Role: "system", Content: "sys"},
+			{Role: "user", Content: "u1"},
+			{Role: "assistant", ToolCalls: call("call_1")},
+			{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+		}
+
+		trimmed, ok := trimHistory(messages)
+		if !ok {
+			t.Fatal("Expected history to be trimmed")
+		}
+		if len(trimmed) != 3 || trimmed[0].Role != "system" || len(trimmed[1].ToolCalls) != 1 || trimmed[2].ToolCallID != "call_1" {
+			t.Errorf("Expected the tool calls kept with their result, got %+v", trimmed)
+		}
+		if _, ok := trimHistory(trimmed); ok {
+			t.Error("Expected no trimming when only the latest turn remains")
+		}
+	})
+}
+
+// delayedStreamVendor delays its first streaming chunk
+type delayedStreamVendor struct {
+	MockVendor
+	firstChunkDelay time.Duration
+}
+
+func (v *delayedStreamVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	streamingResp := models.NewStreamingResponse(req.Model, v.name)
+
+	go func() {
+		defer streamingResp.Close()
+		time.Sleep(v.firstChunkDelay)
+		streamingResp.ContentChan <- "first"
+		streamingResp.ContentChan <- "second"
+		streamingResp.DoneChan <- true
+	}()
+
+	return streamingResp, nil
+}
+
+func drainStream(t *testing.T, resp *models.StreamingResponse) []string {
+	t.Helper()
+	var chunks []string
+	for {
+		select {
+		case content, ok := <-resp.ContentChan:
+			if !ok {
+				return chunks
+			}
+			chunks = append(chunks, content)
+		case err := <-resp.ErrorChan:
+			if err != nil {
+				t.Fatalf("Expected no stream error, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for stream")
+		}
+	}
+}
+
+func TestDispatcher_StreamingTTFT(t *testing.T) {
+	// The static fast-mode priority prefers anthropic over openai, so
+	// picking openai shows the observed TTFT is what drives selection
+	slow := &delayedStreamVendor{
+		MockVendor:      MockVendor{name: "anthropic", available: true, supportsStreaming: true, response: &models.Response{Content: "ok", Vendor: "anthropic"}},
+		firstChunkDelay: 60 * time.Millisecond,
+	}
+	quick := &delayedStreamVendor{
+		MockVendor:      MockVendor{name: "openai", available: true, supportsStreaming: true, response: &models.Response{Content: "ok", Vendor: "openai"}},
+		firstChunkDelay: 5 * time.Millisecond,
+	}
+
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode})
+	dispatcher.RegisterVendor(slow)
+	dispatcher.RegisterVendor(quick)
+
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+	}
+
+	// Before any samples exist fast mode uses its static priority
+	resp, err := dispatcher.SendStreaming(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Vendor != "anthropic" {
+		t.Errorf("Expected vendor anthropic without TTFT data, got %s", resp.Vendor)
+	}
+	drainStream(t, resp)
+
+	resp, err = dispatcher.SendStreamingToVendor(context.Background(), "openai", newRequest())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if chunks := drainStream(t, resp); len(chunks) != 2 {
+		t.Errorf("Expected 2 chunks relayed, got %v", chunks)
+	}
+
+	stats := dispatcher.GetStats()
+	slowStats := stats.VendorStats["anthropic"]
+	quickStats := stats.VendorStats["openai"]
+	if slowStats.TTFTSamples != 1 || quickStats.TTFTSamples != 1 {
+		t.Fatalf("Expected 1 TTFT sample per vendor, got %d and %d", slowStats.TTFTSamples, quickStats.TTFTSamples)
+	}
+	if slowStats.AverageTTFT < slow.firstChunkDelay {
+		t.Errorf("Expected anthropic TTFT of at least %v, got %v", slow.firstChunkDelay, slowStats.AverageTTFT)
+	}
+	if quickStats.AverageTTFT >= slowStats.AverageTTFT {
+		t.Errorf("Expected openai TTFT %v to be below anthropic TTFT %v", quickStats.AverageTTFT, slowStats.AverageTTFT)
+	}
+
+	// With samples for both, fast-mode streaming picks the lowest TTFT
+	resp, err = dispatcher.SendStreaming(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Vendor != "openai" {
+		t.Errorf("Expected vendor openai with lowest TTFT, got %s", resp.Vendor)
+	}
+	drainStream(t, resp)
+
+	// Unary fast-mode requests keep the static priority
+	response, err := dispatcher.Send(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Vendor != "anthropic" {
+		t.Errorf("Expected vendor anthropic for unary request, got %s", response.Vendor)
+	}
+}
+
+func TestDispatcher_Send_DoesNotMutateRequest(t *testing.T) {
+	vendor := &capturingVendor{MockVendor: MockVendor{
+		name:      "openai",
+		available: true,
+		response:  &models.Response{Content: "ok", Vendor: "openai"},
+	}}
+
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode})
+	dispatcher.RegisterVendor(vendor)
+
+	request := &models.Request{
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		Mode:     string(models.FastMode),
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := dispatcher.Send(context.Background(), request); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		sent := vendor.LastRequest()
+		if sent.MaxTokens != 150 {
+			t.Errorf("Expected vendor to see optimized max tokens 150, got %d", sent.MaxTokens)
+		}
+		if sent.Model == "" {
+			t.Error("Expected vendor to see an auto-selected model")
+		}
+		if &sent.Messages[0] == &request.Messages[0] {
+			t.Error("Expected vendor request not to share the caller's messages")
+		}
+	}
+
+	if request.Model != "" {
+		t.Errorf("Expected caller model to stay empty, got %s", request.Model)
+	}
+	if request.MaxTokens != 0 {
+		t.Errorf("Expected caller max tokens to stay 0, got %d", request.MaxTokens)
+	}
+	if request.Temperature != 0 {
+		t.Errorf("Expected caller temperature to stay 0, got %f", request.Temperature)
+	}
+}
+
+// chunkStreamVendor streams a fixed number of numbered chunks
+type chunkStreamVendor struct {
+	MockVendor
+	chunks int
+}
+
+func (v *chunkStreamVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	streamingResp := models.NewStreamingResponseWithBuffer(req.Model, v.name, 1)
+
+	go func() {
+		defer streamingResp.Close()
+		for i := 0; i < v.chunks; i++ {
+			streamingResp.ContentChan <- fmt.Sprintf("chunk-%d", i)
+		}
+		streamingResp.DoneChan <- true
+	}()
+
+	return streamingResp, nil
+}
+
+func TestDispatcher_StreamBufferSize(t *testing.T) {
+	vendor := &chunkStreamVendor{
+		MockVendor: MockVendor{name: "test-vendor", available: true, supportsStreaming: true},
+		chunks:     10,
+	}
+
+	dispatcher := NewWithConfig(&models.Config{StreamBufferSize: 3})
+	dispatcher.RegisterVendor(vendor)
+
+	resp, err := dispatcher.SendStreamingToVendor(context.Background(), "test-vendor", &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cap(resp.ContentChan) != 3 {
+		t.Errorf("Expected ContentChan buffer size 3, got %d", cap(resp.ContentChan))
+	}
+
+	// Without a reader the buffer fills up and the producer waits
+	deadline := time.Now().Add(time.Second)
+	for len(resp.ContentChan) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(resp.ContentChan) != 3 {
+		t.Errorf("Expected full buffer of 3 chunks, got %d", len(resp.ContentChan))
+	}
+
+	chunks := drainStream(t, resp)
+	if len(chunks) != 10 {
+		t.Fatalf("Expected all 10 chunks after backpressure, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if expected := fmt.Sprintf("chunk-%d", i); chunk != expected {
+			t.Errorf("Expected chunk %s at %d, got %s", expected, i, chunk)
+		}
+	}
+}
+
+// fakeEmbedder returns fixed embeddings for known prompts
+type fakeEmbedder struct {
+	embeddings map[string][]float64
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	embedding, ok := f.embeddings[text]
+	if !ok {
+		return nil, errors.New("unknown prompt")
+	}
+	return embedding, nil
+}
+
+func TestDispatcher_ResponseCache(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        models.CacheConfig
+		second        models.Request
+		expectedCalls int
+		expectedHits  int64
+	}{
+		{"hit", models.CacheConfig{Enabled: true}, models.Request{Model: "test-model"}, 1, 1},
+		{"miss on a different model", models.CacheConfig{Enabled: true}, models.Request{Model: "other-model"}, 2, 0},
+		{"miss on different max tokens", models.CacheConfig{Enabled: true}, models.Request{Model: "test-model", MaxTokens: 100}, 2, 0},
+		{"miss when expired", models.CacheConfig{Enabled: true, TTL: time.Nanosecond}, models.Request{Model: "test-model"}, 2, 0},
+		{"not for non-zero temperature", models.CacheConfig{Enabled: true}, models.Request{Model: "test-model", Temperature: 0.5}, 2, 0},
+		{"non-zero temperature allowed", models.CacheConfig{Enabled: true, AllowNonZeroTemperature: true}, models.Request{Model: "test-model", Temperature: 0.5}, 1, 1},
+		{"not for NoCache", models.CacheConfig{Enabled: true}, models.Request{Model: "test-model", NoCache: true}, 2, 0},
+		{"disabled", models.CacheConfig{}, models.Request{Model: "test-model"}, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "test-vendor",
+				available: true,
+				response:  &models.Response{Content: "positive", Vendor: "test-vendor"},
+			}}
+			dispatcher := NewWithConfig(&models.Config{Cache: &tt.config})
+			dispatcher.RegisterVendor(vendor)
+
+			first := tt.second
+			first.Model = "test-model"
+			first.MaxTokens = 0
+			for _, req := range []models.Request{first, tt.second} {
+				req.Messages = []models.Message{{Role: "user", Content: "Label the sentiment: I love it"}}
+				response, err := dispatcher.Send(context.Background(), &req)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if response.Content != "positive" {
+					t.Errorf("Expected content positive, got %s", response.Content)
+				}
+			}
+
+			if vendor.Calls() != tt.expectedCalls {
+				t.Errorf("Expected %d vendor calls, got %d", tt.expectedCalls, vendor.Calls())
+			}
+			stats := dispatcher.GetStats()
+			if stats.CacheHits != tt.expectedHits {
+				t.Errorf("Expected %d cache hits, got %d", tt.expectedHits, stats.CacheHits)
+			}
+			if stats.SuccessfulRequests != 2 {
+				t.Errorf("Expected 2 successful requests, got %d", stats.SuccessfulRequests)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	base := func() *models.Request {
+		return &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+	}
+	parallel := false
+
+	tests := []struct {
+		name    string
+		change  func(req *models.Request)
+		mode    models.Mode
+		sameKey bool
+	}{
+		{"identical", func(req *models.Request) {}, "", true},
+		{"tools", func(req *models.Request) { req.Tools = []models.Tool{{Name: "get_weather"}} }, "", false},
+		{"tool choice", func(req *models.Request) { req.ToolChoice = models.ToolChoiceRequired }, "", false},
+		{"parallel tool calls", func(req *models.Request) { req.ParallelToolCalls = &parallel }, "", false},
+		{"response format", func(req *models.Request) { req.ResponseFormat = models.ResponseFormatJSON }, "", false},
+		{"stop sequences", func(req *models.Request) { req.Stop = []string{"END"} }, "", false},
+		{"top p", func(req *models.Request) { req.TopP = 0.5 }, "", false},
+		{"reasoning", func(req *models.Request) { req.IncludeReasoning = true }, "", false},
+		{"image part", func(req *models.Request) {
+			req.Messages[0].Parts = []models.ContentPart{{Type: models.ContentPartImage, ImageURL: "https://example.com/a.png"}}
+		}, "", false},
+		{"resolved mode", func(req *models.Request) {}, models.FastMode, false},
+		{"cache ttl", func(req *models.Request) { req.CacheTTL = time.Minute }, "", true},
+		{"max cost", func(req *models.Request) { req.MaxCost = 1 }, "", true},
+		{"retryable errors", func(req *models.Request) { req.RetryableErrors = []string{"overloaded"} }, "", true},
+		{"end user", func(req *models.Request) { req.User = "user-42" }, "", true},
+	}
+
+	key := responseCacheKey(base(), "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base()
+			tt.change(req)
+			if same := responseCacheKey(req, tt.mode) == key; same != tt.sameKey {
+				t.Errorf("Expected the same key %v, got %v", tt.sameKey, same)
+			}
+		})
+	}
+}
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newResponseCache(&models.CacheConfig{Enabled: true, MaxEntries: 2})
+
+	cache.store("a", &models.Response{Content: "a"}, 0)
+	cache.store("b", &models.Response{Content: "b"}, 0)
+	if _, ok := cache.lookup("a"); !ok {
+		t.Fatal("Expected a hit for a")
+	}
+	cache.store("c", &models.Response{Content: "c"}, 0)
+
+	if _, ok := cache.lookup("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if response, ok := cache.lookup(key); !ok || response.Content != key {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+
+	// Lookups return copies, so callers can't change the cached response
+	response, _ := cache.lookup("a")
+	response.Content = "changed"
+	if response, _ := cache.lookup("a"); response.Content != "a" {
+		t.Errorf("Expected the cached response unchanged, got %s", response.Content)
+	}
+}
+
+func TestDispatcher_SemanticCache(t *testing.T) {
+	original := "What is the capital of France?"
+	paraphrase := "Which city is the capital of France?"
+	embedder := &fakeEmbedder{embeddings: map[string][]float64{
+		"user: " + original + "\n":   {1, 0, 0},
+		"user: " + paraphrase + "\n": {0.96, 0.28, 0}, // cosine similarity 0.96
+	}}
+
+	tests := []struct {
+		name          string
+		threshold     float64
+		expectedCalls int
+		expectedHits  int64
+	}{
+		{"hit above threshold", 0.9, 1, 1},
+		{"miss below threshold", 0.99, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "test-vendor",
+				available: true,
+				response:  &models.Response{Content: "Paris", Vendor: "test-vendor"},
+			}}
+
+			dispatcher := NewWithConfig(&models.Config{
+				SemanticCache: &models.SemanticCacheConfig{
+					Enabled:             true,
+					Embedder:            embedder,
+					SimilarityThreshold: tt.threshold,
+				},
+			})
+			dispatcher.RegisterVendor(vendor)
+
+			for _, prompt := range []string{original, paraphrase} {
+				response, err := dispatcher.Send(context.Background(), &models.Request{
+					Model:    "test-model",
+					Messages: []models.Message{{Role: "user", Content: prompt}},
+				})
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if response.Content != "Paris" {
+					t.Errorf("Expected content Paris, got %s", response.Content)
+				}
+			}
+
+			if vendor.Calls() != tt.expectedCalls {
+				t.Errorf("Expected %d vendor calls, got %d", tt.expectedCalls, vendor.Calls())
+			}
+			stats := dispatcher.GetStats()
+			if stats.SemanticCacheHits != tt.expectedHits {
+				t.Errorf("Expected %d cache hits, got %d", tt.expectedHits, stats.SemanticCacheHits)
+			}
+			if stats.SemanticCacheMisses != 2-tt.expectedHits {
+				t.Errorf("Expected %d cache misses, got %d", 2-tt.expectedHits, stats.SemanticCacheMisses)
+			}
+		})
+	}
+}
+
+func TestSemanticCache_EvictsCheapest(t *testing.T) {
+	cache := newSemanticCache(&models.SemanticCacheConfig{
+		Enabled:    true,
+		Embedder:   &fakeEmbedder{},
+		MaxEntries: 2,
+	})
+
+	cache.store("m", []float64{1, 0}, &models.Response{Content: "expensive", EstimatedCost: 0.5}, 0)
+	cache.store("m", []float64{0, 1}, &models.Response{Content: "cheap", EstimatedCost: 0.01}, 0)
+	cache.store("m", []float64{1, 1}, &models.Response{Content: "new", EstimatedCost: 0.1}, 0)
+
+	if _, ok := cache.lookup("m", []float64{0, 1}); ok {
+		t.Error("Expected cheapest entry to be evicted")
+	}
+	if response, ok := cache.lookup("m", []float64{1, 0}); !ok || response.Content != "expensive" {
+		t.Error("Expected expensive entry to be kept")
+	}
+	if _, ok := cache.lookup("other-model", []float64{1, 0}); ok {
+		t.Error("Expected no hit for a different model")
+	}
+}
+
+func TestDispatcher_SemanticCache_NoCache(t *testing.T) {
+	prompt := "What time is it in Tokyo?"
+	vendor := &capturingVendor{MockVendor: MockVendor{
+		name:      "test-vendor",
+		available: true,
+		response:  &models.Response{Content: "10:42", Vendor: "test-vendor"},
+	}}
+	dispatcher := NewWithConfig(&models.Config{
+		SemanticCache: &models.SemanticCacheConfig{
+			Enabled:  true,
+			Embedder: &fakeEmbedder{embeddings: map[string][]float64{"user: " + prompt + "\n": {1, 0}}},
+		},
+	})
+	dispatcher.RegisterVendor(vendor)
+
+	send := func(noCache bool) {
+		t.Helper()
+		if _, err := dispatcher.Send(context.Background(), &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: prompt}},
+			NoCache:  noCache,
+		}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// A NoCache request neither reads nor fills the cache
+	send(true)
+	send(false)
+	if vendor.Calls() != 2 {
+		t.Fatalf("Expected NoCache response not to be cached, got %d vendor calls", vendor.Calls())
+	}
+
+	// The cache is warm now, but NoCache still reaches the vendor
+	send(true)
+	if vendor.Calls() != 3 {
+		t.Errorf("Expected NoCache to call the vendor on a warm cache, got %d vendor calls", vendor.Calls())
+	}
+	send(false)
+	if vendor.Calls() != 3 {
+		t.Errorf("Expected a cache hit, got %d vendor calls", vendor.Calls())
+	}
+
+	stats := dispatcher.GetStats()
+	if stats.SemanticCacheHits != 1 || stats.SemanticCacheMisses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", stats.SemanticCacheHits, stats.SemanticCacheMisses)
+	}
+}
+
+func TestDispatcher_SemanticCache_ContentParts(t *testing.T) {
+	prompt := "What is in this picture?"
+	vendor := &capturingVendor{MockVendor: MockVendor{
+		name:      "test-vendor",
+		available: true,
+		response:  &models.Response{Content: "A cat", Vendor: "test-vendor"},
+	}}
+	dispatcher := NewWithConfig(&models.Config{
+		SemanticCache: &models.SemanticCacheConfig{
+			Enabled:  true,
+			Embedder: &fakeEmbedder{embeddings: map[string][]float64{"user: " + prompt + "\n": {1, 0}}},
+		},
+	})
+	dispatcher.RegisterVendor(vendor)
+
+	send := func(parts ...models.ContentPart) {
+		t.Helper()
+		if _, err := dispatcher.Send(context.Background(), &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Parts: parts}},
+		}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	text := models.ContentPart{Type: models.ContentPartText, Text: prompt}
+
+	// Text parts are embedded like Content
+	send(text)
+	send(text)
+	if vendor.Calls() != 1 {
+		t.Fatalf("Expected a cache hit for text parts, got %d vendor calls", vendor.Calls())
+	}
+
+	// Requests with images neither read nor fill the cache
+	send(text, models.ContentPart{Type: models.ContentPartImage, ImageURL: "https://example.com/dog.png"})
+	send(text, models.ContentPart{Type: models.ContentPartImage, ImageURL: "https://example.com/bird.png"})
+	if vendor.Calls() != 3 {
+		t.Errorf("Expected requests with images to skip the cache, got %d vendor calls", vendor.Calls())
+	}
+
+	stats := dispatcher.GetStats()
+	if stats.SemanticCacheHits != 1 || stats.SemanticCacheMisses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", stats.SemanticCacheHits, stats.SemanticCacheMisses)
+	}
+}
+
+func TestDispatcher_SemanticCache_Scope(t *testing.T) {
+	prompt := "What is the weather in Paris?"
+	base := func() *models.Request {
+		return &models.Request{
+			Mode:     string(models.FastMode),
+			Messages: []models.Message{{Role: "user", Content: prompt}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(req *models.Request)
+		hit    bool
+	}{
+		{"same request", func(req *models.Request) {}, true},
+		{"different mode", func(req *models.Request) { req.Mode = string(models.SophisticatedMode) }, false},
+		{"tools", func(req *models.Request) { req.Tools = []models.Tool{{Name: "get_weather"}} }, false},
+		{"response format", func(req *models.Request) { req.ResponseFormat = models.ResponseFormatJSON }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "test-vendor",
+				available: true,
+				response:  &models.Response{Content: "Sunny", Vendor: "test-vendor"},
+			}}
+			dispatcher := NewWithConfig(&models.Config{
+				SemanticCache: &models.SemanticCacheConfig{
+					Enabled:  true,
+					Embedder: &fakeEmbedder{embeddings: map[string][]float64{"user: " + prompt + "\n": {1, 0}}},
+				},
+			})
+			dispatcher.RegisterVendor(vendor)
+
+			second := base()
+			tt.change(second)
+			for _, req := range []*models.Request{base(), second} {
+				if _, err := dispatcher.Send(context.Background(), req); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+
+			expectedCalls := 2
+			if tt.hit {
+				expectedCalls = 1
+			}
+			if vendor.Calls() != expectedCalls {
+				t.Errorf("Expected %d vendor calls, got %d", expectedCalls, vendor.Calls())
+			}
+		})
+	}
+}
+
+func TestSemanticCache_TTL(t *testing.T) {
+	cache := newSemanticCache(&models.SemanticCacheConfig{
+		Enabled:  true,
+		Embedder: &fakeEmbedder{},
+		TTL:      time.Hour,
+	})
+
+	cache.store("m", []float64{1, 0}, &models.Response{Content: "default ttl"}, 0)
+	cache.store("m", []float64{0, 1}, &models.Response{Content: "short ttl"}, 20*time.Millisecond)
+
+	for _, entry := range cache.entries {
+		ttl := time.Until(entry.expiresAt)
+		switch entry.response.Content {
+		case "default ttl":
+			if ttl < 59*time.Minute || ttl > time.Hour {
+				t.Errorf("Expected default TTL of an hour, got %v", ttl)
+			}
+		case "short ttl":
+			if ttl > 20*time.Millisecond {
+				t.Errorf("Expected overridden TTL of 20ms, got %v", ttl)
+			}
+		}
+	}
+
+	if _, ok := cache.lookup("m", []float64{0, 1}); !ok {
+		t.Error("Expected a hit before the TTL passes")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.lookup("m", []float64{0, 1}); ok {
+		t.Error("Expected no hit after the overridden TTL passed")
+	}
+	if _, ok := cache.lookup("m", []float64{1, 0}); !ok {
+		t.Error("Expected the default TTL entry to still be served")
+	}
+}
+
+func TestDispatcher_SetVendorEnabled(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode})
+	dispatcher.RegisterVendor(&MockVendor{
+		name:      "anthropic",
+		available: true,
+		response:  &models.Response{Content: "ok", Vendor: "anthropic"},
+	})
+	dispatcher.RegisterVendor(&MockVendor{
+		name:      "openai",
+		available: true,
+		response:  &models.Response{Content: "ok", Vendor: "openai"},
+	})
+
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+	}
+
+	if err := dispatcher.SetVendorEnabled("missing", false); err == nil {
+		t.Error("Expected error for unknown vendor, got nil")
+	}
+
+	// Fast mode prefers anthropic while it is enabled
+	response, err := dispatcher.Send(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Vendor != "anthropic" {
+		t.Errorf("Expected vendor anthropic, got %s", response.Vendor)
+	}
+
+	if err := dispatcher.SetVendorEnabled("anthropic", false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		response, err = dispatcher.Send(context.Background(), newRequest())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.Vendor != "openai" {
+			t.Errorf("Expected disabled anthropic to be skipped, got %s", response.Vendor)
+		}
+	}
+
+	if _, err := dispatcher.SendToVendor(context.Background(), "anthropic", newRequest()); err == nil {
+		t.Error("Expected error sending to disabled vendor, got nil")
+	}
+
+	statuses := dispatcher.GetVendorStatuses(context.Background())
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 vendor statuses, got %d", len(statuses))
+	}
+	if statuses[0].Name != "anthropic" || statuses[0].Enabled {
+		t.Errorf("Expected anthropic to be disabled, got %+v", statuses[0])
+	}
+	if !statuses[0].Available {
+		t.Error("Expected disabled anthropic to still report available")
+	}
+	if statuses[1].Name != "openai" || !statuses[1].Enabled {
+		t.Errorf("Expected openai to be enabled, got %+v", statuses[1])
+	}
+
+	if err := dispatcher.SetVendorEnabled("anthropic", true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	response, err = dispatcher.Send(context.Background(), newRequest())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Vendor != "anthropic" {
+		t.Errorf("Expected re-enabled anthropic to be selected, got %s", response.Vendor)
+	}
+}
+
+// failingStreamVendor opens a stream that fails before sending content
+type failingStreamVendor struct {
+	MockVendor
+}
+
+func (v *failingStreamVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	streamingResp := models.NewStreamingResponse(req.Model, v.name)
+	go func() {
+		defer streamingResp.Close()
+		streamingResp.ErrorChan <- errors.New("stream reset")
+	}()
+	return streamingResp, nil
+}
+
+func TestDispatcher_SendStreaming_StreamingFallbackVendor(t *testing.T) {
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+	}
+
+	t.Run("primary fails to start", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                    models.FastMode,
+			StreamingFallbackVendor: "openai",
+		})
+		dispatcher.RegisterVendor(&MockVendor{name: "anthropic", available: true, supportsStreaming: true, shouldFail: true})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+
+		resp, err := dispatcher.SendStreaming(context.Background(), newRequest())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.Vendor != "openai" {
+			t.Errorf("Expected fallback vendor openai, got %s", resp.Vendor)
+		}
+		if chunks := drainStream(t, resp); len(chunks) != 1 || chunks[0] != "Mock streaming response" {
+			t.Errorf("Expected fallback content, got %v", chunks)
+		}
+
+		stats := dispatcher.GetStats()
+		if stats.VendorStats["anthropic"].Failures != 1 {
+			t.Errorf("Expected 1 anthropic failure, got %d", stats.VendorStats["anthropic"].Failures)
+		}
+		if stats.VendorStats["openai"].Successes != 1 {
+			t.Errorf("Expected 1 openai success, got %d", stats.VendorStats["openai"].Successes)
+		}
+		if stats.TotalRequests != 1 || stats.SuccessfulRequests != 1 || stats.FailedRequests != 0 {
+			t.Errorf("Expected the request counted once as a success, got %d total, %d successful, %d failed",
+				stats.TotalRequests, stats.SuccessfulRequests, stats.FailedRequests)
+		}
+	})
+
+	t.Run("primary stream fails before content", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                    models.FastMode,
+			StreamingFallbackVendor: "openai",
+		})
+		dispatcher.RegisterVendor(&failingStreamVendor{MockVendor{name: "anthropic", available: true, supportsStreaming: true}})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+
+		resp, err := dispatcher.SendStreaming(context.Background(), newRequest())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if chunks := drainStream(t, resp); len(chunks) != 1 || chunks[0] != "Mock streaming response" {
+			t.Errorf("Expected fallback content, got %v", chunks)
+		}
+
+		stats := dispatcher.GetStats()
+		if stats.TotalRequests != 1 || stats.SuccessfulRequests != 1 || stats.FailedRequests != 0 {
+			t.Errorf("Expected the request counted once as a success, got %d total, %d successful, %d failed",
+				stats.TotalRequests, stats.SuccessfulRequests, stats.FailedRequests)
+		}
+		if stats.VendorStats["openai"].Successes != 1 {
+			t.Errorf("Expected 1 openai success, got %d", stats.VendorStats["openai"].Successes)
+		}
+		// Each vendor's stream is timed on its own
+		if anthropic := stats.VendorStats["anthropic"]; anthropic.StreamCount != 1 || anthropic.TTFTSamples != 0 {
+			t.Errorf("Expected 1 anthropic stream without a first token, got %d streams and %d TTFT samples", anthropic.StreamCount, anthropic.TTFTSamples)
+		}
+		if openai := stats.VendorStats["openai"]; openai.StreamCount != 1 || openai.TTFTSamples != 1 {
+			t.Errorf("Expected 1 openai stream with a first token, got %d streams and %d TTFT samples", openai.StreamCount, openai.TTFTSamples)
+		}
+	})
+
+	t.Run("fallback must support streaming", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                    models.FastMode,
+			StreamingFallbackVendor: "openai",
+		})
+		dispatcher.RegisterVendor(&MockVendor{name: "anthropic", available: true, supportsStreaming: true, shouldFail: true})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true})
+
+		if _, err := dispatcher.SendStreaming(context.Background(), newRequest()); err == nil {
+			t.Error("Expected error without a streaming-capable fallback, got nil")
+		}
+	})
+
+	t.Run("unary requests ignore streaming fallback", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                    models.FastMode,
+			StreamingFallbackVendor: "openai",
+		})
+		dispatcher.RegisterVendor(&MockVendor{name: "anthropic", available: true, supportsStreaming: true, shouldFail: true})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+
+		if _, err := dispatcher.Send(context.Background(), newRequest()); err == nil {
+			t.Error("Expected unary request to fail without falling back, got nil")
+		}
+	})
+}
+
+// midStreamErrorVendor opens a stream that fails after sending content
+type midStreamErrorVendor struct {
+	MockVendor
+}
+
+func (v *midStreamErrorVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	streamingResp := models.NewStreamingResponse(req.Model, v.name)
+	go func() {
+		defer streamingResp.Close()
+		streamingResp.ContentChan <- "Hello, "
+		streamingResp.ContentChan <- "wor"
+		streamingResp.ErrorChan <- errors.New("stream reset")
+	}()
+	return streamingResp, nil
+}
+
+func TestDispatcher_SendStreamingCollected_PartialContentPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       models.StreamPartialContentPolicy
+		wantResponse bool
+		wantErr      bool
+		finishReason string
+	}{
+		{name: "default", policy: "", wantErr: true},
+		{name: "error", policy: models.StreamPartialContentError, wantErr: true},
+		{name: "complete as success", policy: models.StreamPartialContentComplete, wantResponse: true, finishReason: "stop"},
+		{name: "return partial", policy: models.StreamPartialContentReturn, wantResponse: true, wantErr: true, finishReason: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{StreamPartialContentPolicy: tt.policy})
+			dispatcher.RegisterVendor(&midStreamErrorVendor{MockVendor{name: "openai", available: true, supportsStreaming: true}})
+
+			response, err := dispatcher.SendStreamingCollected(context.Background(), &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "stream reset") {
+				t.Errorf("Expected stream error, got %v", err)
+			}
+			if !tt.wantResponse {
+				if response != nil {
+					t.Errorf("Expected no response, got %+v", response)
+				}
+				return
+			}
+			if response == nil {
+				t.Fatal("Expected a response")
+			}
+			if response.Content != "Hello, wor" {
+				t.Errorf("Expected partial content %q, got %q", "Hello, wor", response.Content)
+			}
+			if response.FinishReason != tt.finishReason {
+				t.Errorf("Expected finish reason %q, got %q", tt.finishReason, response.FinishReason)
+			}
+		})
+	}
+
+	// Errors before any content are returned whatever the policy
+	dispatcher := NewWithConfig(&models.Config{StreamPartialContentPolicy: models.StreamPartialContentComplete})
+	dispatcher.RegisterVendor(&failingStreamVendor{MockVendor{name: "openai", available: true, supportsStreaming: true}})
+	response, err := dispatcher.SendStreamingCollected(context.Background(), &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err == nil || response != nil {
+		t.Errorf("Expected error without response, got %v and %+v", err, response)
+	}
+
+	// A complete stream is collected with its usage
+	dispatcher = NewWithConfig(&models.Config{})
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+	response, err = dispatcher.SendStreamingCollected(context.Background(), &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Content != "Mock streaming response" || response.FinishReason != "stop" {
+		t.Errorf("Expected complete response, got %q (%s)", response.Content, response.FinishReason)
+	}
+	if response.Usage.TotalTokens == 0 {
+		t.Error("Expected stream usage on the response")
+	}
+}
+
+func TestDispatcher_StreamingTimingStats(t *testing.T) {
+	vendor := &delayedStreamVendor{
+		MockVendor:      MockVendor{name: "test-vendor", available: true, supportsStreaming: true},
+		firstChunkDelay: 30 * time.Millisecond,
+	}
+
+	dispatcher := NewWithConfig(&models.Config{})
+	dispatcher.RegisterVendor(vendor)
+
+	for i := 0; i < 2; i++ {
+		resp, err := dispatcher.SendStreamingToVendor(context.Background(), "test-vendor", &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		drainStream(t, resp)
+	}
+
+	stats := dispatcher.GetStats().VendorStats["test-vendor"]
+	if stats.StreamCount != 2 {
+		t.Errorf("Expected 2 streams, got %d", stats.StreamCount)
+	}
+	if stats.TotalStreamChunks != 4 {
+		t.Errorf("Expected 4 total chunks, got %d", stats.TotalStreamChunks)
+	}
+	if stats.AverageStreamChunks != 2 {
+		t.Errorf("Expected 2 chunks per stream, got %f", stats.AverageStreamChunks)
+	}
+	if stats.AverageTTFT < vendor.firstChunkDelay {
+		t.Errorf("Expected TTFT of at least %v, got %v", vendor.firstChunkDelay, stats.AverageTTFT)
+	}
+	if stats.AverageStreamDuration < stats.AverageTTFT {
+		t.Errorf("Expected stream duration %v to be at least TTFT %v", stats.AverageStreamDuration, stats.AverageTTFT)
+	}
+}
+
+func TestDedupSystemMessages(t *testing.T) {
+	system := models.Message{Role: "system", Content: "You are helpful."}
+	other := models.Message{Role: "system", Content: "Answer briefly."}
+	user := models.Message{Role: "user", Content: "Hello"}
+
+	tests := []struct {
+		name     string
+		messages []models.Message
+		expected []models.Message
+	}{
+		{
+			name:     "accumulated duplicates",
+			messages: []models.Message{system, system, system, user},
+			expected: []models.Message{system, user},
+		},
+		{
+			name:     "different system messages kept",
+			messages: []models.Message{system, other, user},
+			expected: []models.Message{system, other, user},
+		},
+		{
+			name:     "non-adjacent duplicates kept",
+			messages: []models.Message{system, user, system, user},
+			expected: []models.Message{system, user, system, user},
+		},
+		{
+			name:     "duplicate user messages kept",
+			messages: []models.Message{user, user},
+			expected: []models.Message{user, user},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deduped := dedupSystemMessages(tt.messages)
+			if len(deduped) != len(tt.expected) {
+				t.Fatalf("Expected %d messages, got %d: %v", len(tt.expected), len(deduped), deduped)
+			}
+			for i := range deduped {
+				if !reflect.DeepEqual(deduped[i], tt.expected[i]) {
+					t.Errorf("Expected message %d to be %v, got %v", i, tt.expected[i], deduped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_DedupSystemMessages(t *testing.T) {
+	system := models.Message{Role: "system", Content: "You are helpful."}
+	request := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{system, system, system, {Role: "user", Content: "Hello"}},
+	}
+
+	for _, enabled := range []bool{true, false} {
+		vendor := &capturingVendor{MockVendor: MockVendor{
+			name:      "test-vendor",
+			available: true,
+			response:  &models.Response{Content: "ok"},
+		}}
+		dispatcher := NewWithConfig(&models.Config{DedupSystemMessages: enabled})
+		dispatcher.RegisterVendor(vendor)
+
+		if _, err := dispatcher.SendToVendor(context.Background(), "test-vendor", request); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := 4
+		if enabled {
+			expected = 2
+		}
+		if got := len(vendor.LastRequest().Messages); got != expected {
+			t.Errorf("Expected %d messages with dedup %v, got %d", expected, enabled, got)
+		}
+	}
+
+	if len(request.Messages) != 4 {
+		t.Errorf("Expected caller messages unchanged, got %d", len(request.Messages))
+	}
+}
+
+func TestDispatcher_SendStreaming_FallbackToUnaryStreaming(t *testing.T) {
+	newDispatcher := func(fallback bool) *Dispatcher {
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                     models.FastMode,
+			FallbackToUnaryStreaming: fallback,
+		})
+		dispatcher.RegisterVendor(&MockVendor{
+			name:      "anthropic",
+			available: true,
+			response: &models.Response{
+				Content: "Unary response",
+				Model:   "test-model",
+				Vendor:  "anthropic",
+				Usage:   models.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+			},
+		})
+		return dispatcher
+	}
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		dispatcher := newDispatcher(true)
+
+		for name, send := range map[string]func() (*models.StreamingResponse, error){
+			"SendStreaming": func() (*models.StreamingResponse, error) {
+				return dispatcher.SendStreaming(context.Background(), req)
+			},
+			"SendStreamingToVendor": func() (*models.StreamingResponse, error) {
+				return dispatcher.SendStreamingToVendor(context.Background(), "anthropic", req)
+			},
+		} {
+			resp, err := send()
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", name, err)
+			}
+			if resp.Vendor != "anthropic" {
+				t.Errorf("%s: expected vendor anthropic, got %s", name, resp.Vendor)
+			}
+			if resp.Usage.TotalTokens != 8 {
+				t.Errorf("%s: expected 8 total tokens, got %d", name, resp.Usage.TotalTokens)
+			}
+			if chunks := drainStream(t, resp); len(chunks) != 1 || chunks[0] != "Unary response" {
+				t.Errorf("%s: expected single unary chunk, got %v", name, chunks)
+			}
+		}
+
+		if successes := dispatcher.GetStats().VendorStats["anthropic"].Successes; successes != 2 {
+			t.Errorf("Expected 2 anthropic successes, got %d", successes)
+		}
+		if req.Stream {
+			t.Error("Expected caller's request to stay unchanged")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		dispatcher := newDispatcher(false)
+
+		_, err := dispatcher.SendStreaming(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "does not support streaming") {
+			t.Errorf("Expected streaming support error, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_Send_MaxContentLengthByRole(t *testing.T) {
+	// Tool results reach the dispatcher as user turns, so an oversized API
+	// response pasted into the conversation is limited by the user entry
+	toolResult := "Tool result: " + strings.Repeat(`{"id":1,"payload":"xxxxxxxx"}`, 100)
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model: "test-model",
+			Messages: []models.Message{
+				{Role: "system", Content: "You are helpful."},
+				{Role: "user", Content: toolResult},
+			},
+		}
+	}
+	limits := map[string]int{"user": 64, "tool": 64}
+
+	t.Run("truncate", func(t *testing.T) {
+		vendor := &capturingVendor{MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}}}
+		dispatcher := NewWithConfig(&models.Config{MaxContentLengthByRole: limits})
+		dispatcher.RegisterVendor(vendor)
+
+		request := newRequest()
+		if _, err := dispatcher.SendToVendor(context.Background(), "test-vendor", request); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		sent := vendor.LastRequest().Messages
+		if sent[1].Content != toolResult[:64] {
+			t.Errorf("Expected tool result truncated to 64 characters, got %d", len(sent[1].Content))
+		}
+		if sent[0].Content != "You are helpful." {
+			t.Errorf("Expected system message untouched, got %q", sent[0].Content)
+		}
+		if request.Messages[1].Content != toolResult {
+			t.Error("Expected caller's message unchanged")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		vendor := &capturingVendor{MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}}}
+		dispatcher := NewWithConfig(&models.Config{
+			MaxContentLengthByRole: limits,
+			ContentLengthPolicy:    models.ContentLengthError,
+		})
+		dispatcher.RegisterVendor(vendor)
+
+		_, err := dispatcher.SendToVendor(context.Background(), "test-vendor", newRequest())
+		if !errors.Is(err, models.ErrInvalidRequest) {
+			t.Fatalf("Expected ErrInvalidRequest, got %v", err)
+		}
+		if vendor.Calls() != 0 {
+			t.Errorf("Expected no vendor calls, got %d", vendor.Calls())
+		}
+	})
+}
+
+func TestLimitContentLength(t *testing.T) {
+	messages := []models.Message{
+		{Role: "user", Content: "héllo wörld"},
+		{Role: "assistant", Content: "unlimited"},
+	}
+
+	if err := limitContentLength(messages, map[string]int{"user": 5}, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if messages[0].Content != "héllo" {
+		t.Errorf("Expected truncation on a character boundary, got %q", messages[0].Content)
+	}
+	if messages[1].Content != "unlimited" {
+		t.Errorf("Expected role without a limit unchanged, got %q", messages[1].Content)
+	}
+}
+
+// tierVendor is a capturing vendor with per-tier default models
+type tierVendor struct {
+	capturingVendor
+	tierModels map[string]string
+}
+
+func (v *tierVendor) TierModel(tier string) string {
+	return v.tierModels[tier]
+}
+
+func TestDispatcher_Send_TierModels(t *testing.T) {
+	vendor := &tierVendor{
+		capturingVendor: capturingVendor{MockVendor: MockVendor{name: "anthropic", available: true, response: &models.Response{Content: "ok"}}},
+		tierModels: map[string]string{
+			models.TierFast:          "claude-3-5-haiku-latest",
+			models.TierSophisticated: "claude-opus-4-custom",
+		},
+	}
+	dispatcher := NewWithConfig(&models.Config{Mode: models.AutoMode})
+	dispatcher.RegisterVendor(vendor)
+
+	tests := []struct {
+		name          string
+		mode          string
+		model         string
+		expectedModel string
+	}{
+		{"sophisticated tier", "sophisticated", "", "claude-opus-4-custom"},
+		{"fast tier", "fast", "", "claude-3-5-haiku-latest"},
+		{"cost saving uses fast tier", "cost_saving", "", "claude-3-5-haiku-latest"},
+		{"unset tier falls back to built-in default", "auto", "", models.GetVendorModels("anthropic")[0]},
+		{"explicit model wins", "sophisticated", "claude-3-haiku-20240307", "claude-3-haiku-20240307"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.Request{
+				Model:    tt.model,
+				Mode:     tt.mode,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			}
+			if _, err := dispatcher.Send(context.Background(), req); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := vendor.LastRequest().Model; got != tt.expectedModel {
+				t.Errorf("Expected model %s, got %s", tt.expectedModel, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_CacheTokenPricing(t *testing.T) {
+	usages := map[string]models.Usage{
+		"uncached": {PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100},
+		"cached":   {PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100, CacheReadTokens: 800},
+		"written":  {PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100, CacheCreationTokens: 800},
+	}
+
+	costs := make(map[string]float64)
+	for name, usage := range usages {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(&MockVendor{
+			name:      "anthropic",
+			available: true,
+			response:  &models.Response{Content: "ok", Usage: usage},
+		})
+		response, err := dispatcher.SendToVendor(context.Background(), "anthropic", &models.Request{
+			Model:    "claude-3-5-sonnet-20241022",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		costs[name] = response.EstimatedCost
+	}
+
+	if costs["cached"] >= costs["uncached"] {
+		t.Errorf("Expected a cached request to cost less than an uncached one, got %v and %v", costs["cached"], costs["uncached"])
+	}
+	if costs["written"] <= costs["uncached"] {
+		t.Errorf("Expected a cache write to cost more than an uncached request, got %v and %v", costs["written"], costs["uncached"])
+	}
+
+	// 200 uncached prompt tokens and 800 cache reads at a tenth of the
+	// input rate, and 100 completion tokens
+	price := models.DefaultPricingTable().Price("anthropic", "claude-3-5-sonnet-20241022")
+	expected := price.Cost(200+80, 100)
+	if math.Abs(costs["cached"]-expected) > 1e-12 {
+		t.Errorf("Expected cached cost %v, got %v", expected, costs["cached"])
+	}
+}
+
+func TestDispatcher_Send_MissingUsageEstimatesCost(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{Mode: models.AutoMode})
+	dispatcher.RegisterVendor(&MockVendor{
+		name:      "openai",
+		available: true,
+		response:  &models.Response{Content: strings.Repeat("a", 400), Vendor: "openai"},
+	})
+	dispatcher.RegisterVendor(&MockVendor{
+		name:      "anthropic",
+		available: true,
+		response: &models.Response{
+			Content: "ok",
+			Vendor:  "anthropic",
+			Usage:   models.Usage{PromptTokens: 10, CompletionTokens: 10, TotalTokens: 20},
+		},
+	})
+
+	req := &models.Request{
+		Model:    "gpt-4",
+		Messages: []models.Message{{Role: "user", Content: strings.Repeat("b", 400)}},
+	}
+	response, err := dispatcher.SendToVendor(context.Background(), "openai", req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// 100 prompt and 50 completion tokens in gpt-4's encoding, at gpt-4's
+	// rates
+	expectedCost := dispatcher.estimateCost("openai", "gpt-4", 100, 50)
+	if response.EstimatedCost != expectedCost {
+		t.Errorf("Expected estimated cost %v, got %v", expectedCost, response.EstimatedCost)
+	}
+	if !response.CostEstimated {
+		t.Error("Expected cost to be flagged as estimated")
+	}
+
+	req.Model = "claude-3-5-sonnet-20241022"
+	response, err = dispatcher.SendToVendor(context.Background(), "anthropic", req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.CostEstimated {
+		t.Error("Expected cost from reported usage not to be flagged")
+	}
+
+	stats := dispatcher.GetStats()
+	if stats.VendorStats["openai"].MissingUsageCount != 1 {
+		t.Errorf("Expected 1 missing usage for openai, got %d", stats.VendorStats["openai"].MissingUsageCount)
+	}
+	if stats.VendorStats["anthropic"].MissingUsageCount != 0 {
+		t.Errorf("Expected no missing usage for anthropic, got %d", stats.VendorStats["anthropic"].MissingUsageCount)
+	}
+	if stats.EstimatedCostCount != 1 {
+		t.Errorf("Expected estimated cost count 1, got %d", stats.EstimatedCostCount)
+	}
+	if stats.VendorStats["openai"].TotalCost != expectedCost {
+		t.Errorf("Expected openai total cost %v, got %v", expectedCost, stats.VendorStats["openai"].TotalCost)
+	}
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		ok       bool
+	}{
+		{"valid json unchanged", `{"a": [1, 2]}`, `{"a": [1, 2]}`, true},
+		{"trailing commas", `{"a": [1, 2,], "b": 3,}`, `{"a": [1, 2], "b": 3}`, true},
+		{"unquoted keys", `{name: "Ada", born_in: 1815}`, `{"name": "Ada", "born_in": 1815}`, true},
+		{"single quotes", `{'name': 'Ada \'the\' "Countess"'}`, `{"name": "Ada 'the' \"Countess\""}`, true},
+		{"code fence", "```json\n{\"ok\": true,}\n```", `{"ok": true}`, true},
+		{"literals kept", `{flag: true, none: null,}`, `{"flag": true, "none": null}`, true},
+		{"commas and colons in strings kept", `{"text": "a, b: c,}"}`, `{"text": "a, b: c,}"}`, true},
+		{"unrepairable", `{"a": 1`, `{"a": 1`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repairJSON(tt.content)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok %v, got %v (%s)", tt.ok, ok, got)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_RepairJSONOutput(t *testing.T) {
+	const malformed = `{answer: 42, tags: ['a', 'b',],}`
+
+	tests := []struct {
+		name           string
+		repair         bool
+		responseFormat string
+		expected       string
+	}{
+		{"repaired", true, models.ResponseFormatJSON, `{"answer": 42, "tags": ["a", "b"]}`},
+		{"repair disabled", false, models.ResponseFormatJSON, malformed},
+		{"text response format", true, "", malformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{RepairJSONOutput: tt.repair})
+			dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: malformed}})
+
+			response, err := dispatcher.SendToVendor(context.Background(), "test-vendor", &models.Request{
+				Model:          "test-model",
+				Messages:       []models.Message{{Role: "user", Content: "Answer in JSON"}},
+				ResponseFormat: tt.responseFormat,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if response.Content != tt.expected {
+				t.Errorf("Expected content %s, got %s", tt.expected, response.Content)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_DeadlineAwareSelection(t *testing.T) {
+	newDispatcher := func() *Dispatcher {
+		dispatcher := NewWithConfig(&models.Config{Mode: models.SophisticatedMode})
+		dispatcher.RegisterVendor(&MockVendor{name: "slow", available: true, response: &models.Response{Content: "slow", Vendor: "slow"}})
+		dispatcher.RegisterVendor(&MockVendor{name: "fast", available: true, response: &models.Response{Content: "fast", Vendor: "fast"}})
+		dispatcher.stats.VendorStats["slow"] = models.VendorStats{AverageLatency: 5 * time.Second}
+		dispatcher.stats.VendorStats["fast"] = models.VendorStats{AverageLatency: 50 * time.Millisecond}
+		return dispatcher
+	}
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	t.Run("fast vendor chosen", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		for i := 0; i < 5; i++ {
+			response, err := newDispatcher().Send(ctx, req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if response.Vendor != "fast" {
+				t.Errorf("Expected fast vendor within the deadline, got %s", response.Vendor)
+			}
+		}
+	})
+
+	t.Run("no vendor in time", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := newDispatcher().Send(ctx, req)
+		if !errors.Is(err, models.ErrInsufficientTimeBudget) {
+			t.Errorf("Expected ErrInsufficientTimeBudget, got %v", err)
+		}
+	})
+
+	t.Run("no deadline", func(t *testing.T) {
+		dispatcher := newDispatcher()
+		candidates, err := dispatcher.vendorsWithinDeadline(context.Background(), dispatcher.enabledVendors())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(candidates) != 2 {
+			t.Errorf("Expected both vendors without a deadline, got %d", len(candidates))
+		}
+	})
+}
+
+func TestDispatcher_RequestTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    models.Config
+		maxTokens int
+		expected  time.Duration
+	}{
+		{"base only", models.Config{Timeout: 10 * time.Second}, 1000, 10 * time.Second},
+		{"no max tokens", models.Config{Timeout: 10 * time.Second, TimeoutPerToken: 10 * time.Millisecond}, 0, 10 * time.Second},
+		{"scales with max tokens", models.Config{Timeout: 10 * time.Second, TimeoutPerToken: 10 * time.Millisecond}, 1000, 20 * time.Second},
+		{"larger max tokens", models.Config{Timeout: 10 * time.Second, TimeoutPerToken: 10 * time.Millisecond}, 4000, 50 * time.Second},
+		{"capped", models.Config{Timeout: 10 * time.Second, TimeoutPerToken: 10 * time.Millisecond, MaxTimeout: 30 * time.Second}, 4000, 30 * time.Second},
+		{"no timeout", models.Config{}, 1000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&tt.config)
+			timeout := dispatcher.requestTimeout(&models.Request{MaxTokens: tt.maxTokens})
+			if timeout != tt.expected {
+				t.Errorf("Expected timeout %v, got %v", tt.expected, timeout)
+			}
+		})
+	}
+}
+
+// deadlineVendor records the deadline of the context it is called with
+type deadlineVendor struct {
+	MockVendor
+	deadline time.Time
+}
+
+func (v *deadlineVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	v.deadline, _ = ctx.Deadline()
+	return v.MockVendor.SendRequest(ctx, req)
+}
+
+func TestDispatcher_Send_PerTokenTimeout(t *testing.T) {
+	deadlineAfter := func(maxTokens int) time.Duration {
+		dispatcher := NewWithConfig(&models.Config{
+			Timeout:         time.Second,
+			TimeoutPerToken: 10 * time.Millisecond,
+			MaxTimeout:      time.Minute,
+		})
+		vendor := &deadlineVendor{MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}}}
+		dispatcher.RegisterVendor(vendor)
+
+		start := time.Now()
+		_, err := dispatcher.Send(context.Background(), &models.Request{
+			Model:     "test-model",
+			Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+			MaxTokens: maxTokens,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return vendor.deadline.Sub(start)
+	}
+
+	tests := []struct {
+		maxTokens int
+		expected  time.Duration
+	}{
+		{100, 2 * time.Second},
+		{1000, 11 * time.Second},
+		{100000, time.Minute}, // capped at MaxTimeout
+	}
+	for _, tt := range tests {
+		got := deadlineAfter(tt.maxTokens)
+		if got < tt.expected-100*time.Millisecond || got > tt.expected+100*time.Millisecond {
+			t.Errorf("Expected a deadline about %v away for %d max tokens, got %v", tt.expected, tt.maxTokens, got)
+		}
+	}
+}
+
+func TestDispatcher_Send_RoutingTrace(t *testing.T) {
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	tests := []struct {
+		name       string
+		config     *models.Config
+		vendors    []*MockVendor
+		vendor     string
+		reason     models.RoutingReason
+		candidates []models.RoutingCandidate
+	}{
+		{
+			name: "preference match",
+			config: &models.Config{
+				Mode:               models.FastMode,
+				RecordRoutingTrace: true,
+				ModeOverrides: &models.ModeOverrides{
+					VendorPreferences: map[models.Mode][]string{models.FastMode: {"missing", "preferred"}},
+				},
+			},
+			vendors: []*MockVendor{
+				{name: "other", available: true, response: &models.Response{Content: "ok"}},
+				{name: "preferred", available: true, response: &models.Response{Content: "ok"}},
+			},
+			vendor:     "preferred",
+			reason:     models.RoutingReasonPreference,
+			candidates: []models.RoutingCandidate{{Vendor: "other", Available: true}, {Vendor: "preferred", Available: true}},
+		},
+		{
+			name:   "fallback",
+			config: &models.Config{Mode: models.AutoMode, RecordRoutingTrace: true},
+			vendors: []*MockVendor{
+				{name: "custom", available: true, response: &models.Response{Content: "ok"}},
+				{name: "down", available: false},
+			},
+			vendor:     "custom",
+			reason:     models.RoutingReasonFallback,
+			candidates: []models.RoutingCandidate{{Vendor: "custom", Available: true}, {Vendor: "down", Available: false}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(tt.config)
+			for _, vendor := range tt.vendors {
+				dispatcher.RegisterVendor(vendor)
+			}
+
+			response, err := dispatcher.Send(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			trace := response.RoutingTrace
+			if trace == nil {
+				t.Fatal("Expected a routing trace, got nil")
+			}
+			if trace.Mode != tt.config.Mode {
+				t.Errorf("Expected mode %s, got %s", tt.config.Mode, trace.Mode)
+			}
+			if trace.Vendor != tt.vendor {
+				t.Errorf("Expected vendor %s, got %s", tt.vendor, trace.Vendor)
+			}
+			if trace.Reason != tt.reason {
+				t.Errorf("Expected reason %s, got %s", tt.reason, trace.Reason)
+			}
+			if !reflect.DeepEqual(trace.Candidates, tt.candidates) {
+				t.Errorf("Expected candidates %+v, got %+v", tt.candidates, trace.Candidates)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{Mode: models.AutoMode})
+		dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}})
+
+		response, err := dispatcher.Send(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.RoutingTrace != nil {
+			t.Errorf("Expected no routing trace, got %+v", response.RoutingTrace)
+		}
+	})
+}
+
+// blockingVendor holds requests until their context is done, and streams
+// that never finish
+type blockingVendor struct {
+	MockVendor
+}
+
+func (v *blockingVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (v *blockingVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	return models.NewStreamingResponse(req.Model, v.name), nil
+}
+
+func TestDispatcher_CancelAll(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{})
+	vendor := &blockingVendor{MockVendor: MockVendor{name: "slow", available: true, supportsStreaming: true}}
+	dispatcher.RegisterVendor(vendor)
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	errs := make(chan error, 5)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := dispatcher.Send(context.Background(), req)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		stream, err := dispatcher.SendStreaming(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		go func() {
+			select {
+			case err := <-stream.ErrorChan:
+				errs <- err
+			case <-stream.DoneChan:
+				errs <- nil
+			}
+		}()
+	}
+
+	// Wait until every request is in flight
+	deadline := time.Now().Add(time.Second)
+	for {
+		dispatcher.inflightMutex.Lock()
+		inflight := len(dispatcher.inflight)
+		dispatcher.inflightMutex.Unlock()
+		if inflight == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 5 in-flight requests, got %d", inflight)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	dispatcher.CancelAll()
+	dispatcher.CancelAll()
+
+	for i := 0; i < 5; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for cancelled requests to return")
+		}
+	}
+
+	// New requests are unaffected
+	dispatcher.RegisterVendor(&MockVendor{name: "slow", available: true, response: &models.Response{Content: "ok"}})
+	if _, err := dispatcher.Send(context.Background(), req); err != nil {
+		t.Errorf("Expected request after CancelAll to succeed, got %v", err)
+	}
+	dispatcher.inflightMutex.Lock()
+	defer dispatcher.inflightMutex.Unlock()
+	if len(dispatcher.inflight) != 0 {
+		t.Errorf("Expected no in-flight requests, got %d", len(dispatcher.inflight))
+	}
+}
+
+func TestDispatcher_CancelAll_EndsVendorStream(t *testing.T) {
+	ended := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		// Stream nothing more until the client goes away
+		<-r.Context().Done()
+		close(ended)
+	}))
+	defer server.Close()
+
+	dispatcher := NewWithConfig(&models.Config{})
+	dispatcher.RegisterVendor(vendors.NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL}))
+
+	stream, err := dispatcher.SendStreamingToVendor(context.Background(), "openai", &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if chunk := <-stream.ContentChan; chunk != "Hello" {
+		t.Fatalf("Expected the first chunk, got %q", chunk)
+	}
+
+	dispatcher.CancelAll()
+
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the vendor's HTTP request to end after CancelAll")
+	}
+	select {
+	case err := <-stream.ErrorChan:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the stream to fail")
+	}
+}
+
+// countingVendor counts the requests that reach it
+type countingVendor struct {
+	MockVendor
+	calls int
+}
+
+func (v *countingVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	v.calls++
+	return v.MockVendor.SendRequest(ctx, req)
+}
+
+func (v *countingVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	v.calls++
+	return v.MockVendor.SendStreamingRequest(ctx, req)
+}
+
+func TestDispatcher_HardMaxMessages(t *testing.T) {
+	messages := []models.Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "How are you?"},
+	}
+
+	tests := []struct {
+		name            string
+		hardMaxMessages int
+		expectError     bool
+	}{
+		{"over the limit", 3, true},
+		{"at the limit", 4, false},
+		{"disabled", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No context preprocessing is configured, so nothing reduces the
+			// message count before dispatch
+			dispatcher := NewWithConfig(&models.Config{HardMaxMessages: tt.hardMaxMessages})
+			vendor := &countingVendor{MockVendor: MockVendor{name: "test-vendor", available: true, supportsStreaming: true, response: &models.Response{Content: "ok"}}}
+			dispatcher.RegisterVendor(vendor)
+
+			req := &models.Request{Model: "test-model", Messages: messages}
+			_, sendErr := dispatcher.Send(context.Background(), req)
+			_, vendorErr := dispatcher.SendToVendor(context.Background(), "test-vendor", req)
+			_, streamErr := dispatcher.SendStreamingToVendor(context.Background(), "test-vendor", req)
+
+			for _, err := range []error{sendErr, vendorErr, streamErr} {
+				if tt.expectError && !errors.Is(err, models.ErrTooManyMessagesAfterPreprocessing) {
+					t.Errorf("Expected ErrTooManyMessagesAfterPreprocessing, got %v", err)
+				}
+				if !tt.expectError && errors.Is(err, models.ErrTooManyMessagesAfterPreprocessing) {
+					t.Errorf("Expected no message limit error, got %v", err)
+				}
+			}
+			if tt.expectError && vendor.calls != 0 {
+				t.Errorf("Expected no request to reach the vendor, got %d", vendor.calls)
+			}
+		})
+	}
+}
+
+// reconnectingVendor drops its first stream after partial content and
+// completes any stream it is reconnected with
+type reconnectingVendor struct {
+	MockVendor
+	prefill  bool
+	dropErr  error
+	requests []*models.Request
+}
+
+func (v *reconnectingVendor) SupportsAssistantPrefill() bool {
+	return v.prefill
+}
+
+func (v *reconnectingVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	v.requests = append(v.requests, req)
+	streamingResp := models.NewStreamingResponse(req.Model, v.name)
+	first := len(v.requests) == 1
+	go func() {
+		if first {
+			streamingResp.ContentChan <- "Hello"
+			streamingResp.ErrorChan <- v.dropErr
+			return
+		}
+		streamingResp.ContentChan <- " world"
+		streamingResp.DoneChan <- true
+	}()
+	return streamingResp, nil
+}
+
+func TestDispatcher_SendStreaming_Reconnect(t *testing.T) {
+	networkDrop := fmt.Errorf("%w: failed to read stream: %w", models.ErrStreamInterrupted, io.ErrUnexpectedEOF)
+
+	tests := []struct {
+		name          string
+		maxReconnects int
+		prefill       bool
+		dropErr       error
+		expected      string
+		expectError   bool
+	}{
+		{"resumed after network drop", 2, true, networkDrop, "Hello world", false},
+		{"application error not retried", 2, true, errors.New("overloaded"), "Hello", true},
+		{"vendor without prefill", 2, false, networkDrop, "Hello", true},
+		{"reconnects disabled", 0, true, networkDrop, "Hello", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{MaxStreamReconnects: tt.maxReconnects})
+			vendor := &reconnectingVendor{
+				MockVendor: MockVendor{name: "test-vendor", available: true, supportsStreaming: true},
+				prefill:    tt.prefill,
+				dropErr:    tt.dropErr,
+			}
+			dispatcher.RegisterVendor(vendor)
+
+			stream, err := dispatcher.SendStreamingToVendor(context.Background(), "test-vendor", &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Greet the world"}},
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var content string
+			var streamErr error
+			for done := false; !done; {
+				select {
+				case chunk := <-stream.ContentChan:
+					content += chunk
+				case _, ok := <-stream.DoneChan:
+					done = true
+					if !ok {
+						// Closed after an error was buffered
+						streamErr = <-stream.ErrorChan
+					}
+				case streamErr = <-stream.ErrorChan:
+					done = true
+				case <-time.After(time.Second):
+					t.Fatal("Timeout waiting for stream")
+				}
+			}
+			for len(stream.ContentChan) > 0 {
+				content += <-stream.ContentChan
+			}
+
+			if content != tt.expected {
+				t.Errorf("Expected content %q, got %q", tt.expected, content)
+			}
+			if (streamErr != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, streamErr)
+			}
+			if tt.expectError {
+				if len(vendor.requests) != 1 {
+					t.Errorf("Expected no reconnect, got %d requests", len(vendor.requests))
+				}
+				return
+			}
+
+			if len(vendor.requests) != 2 {
+				t.Fatalf("Expected one reconnect, got %d requests", len(vendor.requests))
+			}
+			resumed := vendor.requests[1].Messages
+			prefill := models.Message{Role: "assistant", Content: "Hello"}
+			if len(resumed) != 2 || !reflect.DeepEqual(resumed[1], prefill) {
+				t.Errorf("Expected the partial content as an assistant prefill, got %+v", resumed)
+			}
+		})
+	}
+}
+
+func TestDispatcher_AllowedAndDeniedModels(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		denied      []string
+		model       string
+		expectError bool
+	}{
+		{"no lists allow all", nil, nil, "any-model", false},
+		{"allowed by glob", []string{"gpt-4*", "claude-3-haiku"}, nil, "gpt-4o-mini", false},
+		{"allowed exactly", []string{"gpt-4*", "claude-3-haiku"}, nil, "claude-3-haiku", false},
+		{"glob does not match prefix only", []string{"gpt-4*"}, nil, "gpt-3.5-turbo", true},
+		{"not in allow list", []string{"gpt-4*"}, nil, "claude-3-opus", true},
+		{"denied", nil, []string{"*-opus*"}, "claude-3-opus-20240229", true},
+		{"denied wins over allowed", []string{"gpt-4*"}, []string{"gpt-4-32k"}, "gpt-4-32k", true},
+		{"vendor-qualified glob", []string{"anthropic/*"}, nil, "anthropic/claude-3.5-sonnet", false},
+		{"denied under a vendor prefix", nil, []string{"gpt-4*"}, "openai/gpt-4o", true},
+		{"glob spanning a vendor prefix", []string{"*llama*"}, nil, "meta-llama/Llama-3.1-8B-Instruct-Turbo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{AllowedModels: tt.allowed, DeniedModels: tt.denied})
+			dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}})
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    tt.model,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.expectError && !errors.Is(err, models.ErrModelNotAllowed) {
+				t.Errorf("Expected ErrModelNotAllowed, got %v", err)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_DeniedModels_ModeRouted(t *testing.T) {
+	tests := []struct {
+		name           string
+		denied         []string
+		expectedVendor string
+		expectedModel  string
+	}{
+		{"preferred vendor's model allowed", []string{"gpt-4*"}, "anthropic", "claude-3-5-sonnet-20241022"},
+		{"preferred vendor's model denied", []string{"claude-3-5-sonnet*"}, "openai", "gpt-4o"},
+		{"every model denied", []string{"*"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				DeniedModels: tt.denied,
+				ModeOverrides: &models.ModeOverrides{
+					VendorPreferences: map[models.Mode][]string{models.SophisticatedMode: {"anthropic", "openai"}},
+				},
+			})
+			vendors := map[string]*capturingVendor{
+				"anthropic": {MockVendor: MockVendor{name: "anthropic", available: true, response: &models.Response{Content: "ok"}}},
+				"openai":    {MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}}},
+			}
+			for _, vendor := range vendors {
+				dispatcher.RegisterVendor(vendor)
+			}
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Mode:     string(models.SophisticatedMode),
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.expectedVendor == "" {
+				if !errors.Is(err, models.ErrModelNotAllowed) {
+					t.Errorf("Expected ErrModelNotAllowed, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for name, vendor := range vendors {
+				if name != tt.expectedVendor {
+					if vendor.Calls() != 0 {
+						t.Errorf("Expected %s not to be called, got %d calls", name, vendor.Calls())
+					}
+					continue
+				}
+				if sent := vendor.LastRequest(); sent == nil || sent.Model != tt.expectedModel {
+					t.Errorf("Expected %s sent to %s, got %+v", tt.expectedModel, name, sent)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_RecordsRateLimits(t *testing.T) {
+	tests := []struct {
+		name             string
+		headers          map[string]string
+		expectedRequests int64
+		expectedTokens   int64
+		expectObserved   bool
+	}{
+		{
+			name: "openai headers",
+			headers: map[string]string{
+				"x-ratelimit-remaining-requests": "59",
+				"x-ratelimit-remaining-tokens":   "149000",
+			},
+			expectedRequests: 59,
+			expectedTokens:   149000,
+			expectObserved:   true,
+		},
+		{
+			name: "anthropic headers",
+			headers: map[string]string{
+				"anthropic-ratelimit-requests-remaining": "49",
+				"anthropic-ratelimit-tokens-remaining":   "39000",
+			},
+			expectedRequests: 49,
+			expectedTokens:   39000,
+			expectObserved:   true,
+		},
+		{
+			name:           "unparsable headers",
+			headers:        map[string]string{"x-ratelimit-remaining-requests": "unknown"},
+			expectObserved: false,
+		},
+		{
+			name:           "no headers",
+			expectObserved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			dispatcher.RegisterVendor(&MockVendor{
+				name:      "test-vendor",
+				available: true,
+				response:  &models.Response{Content: "ok", VendorHeaders: tt.headers},
+			})
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			stats := dispatcher.GetStats().VendorStats["test-vendor"]
+			if stats.RateLimitRemainingRequests != tt.expectedRequests {
+				t.Errorf("Expected %d remaining requests, got %d", tt.expectedRequests, stats.RateLimitRemainingRequests)
+			}
+			if stats.RateLimitRemainingTokens != tt.expectedTokens {
+				t.Errorf("Expected %d remaining tokens, got %d", tt.expectedTokens, stats.RateLimitRemainingTokens)
+			}
+			if stats.RateLimitObservedAt.IsZero() == tt.expectObserved {
+				t.Errorf("Expected observed time set to be %v, got %v", tt.expectObserved, stats.RateLimitObservedAt)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_ModeStopSequences(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     models.Mode
+		stop     []string
+		maxStops int
+		expected []string
+	}{
+		{"cost saving adds default", models.CostSavingMode, nil, 0, []string{"\n\n", "###"}},
+		{"sophisticated adds nothing", models.SophisticatedMode, nil, 0, nil},
+		{"request stops kept first", models.CostSavingMode, []string{"END", "###"}, 0, []string{"END", "###", "\n\n"}},
+		{"vendor stop limit", models.CostSavingMode, []string{"END"}, 2, []string{"END", "\n\n"}},
+		{"limit already reached", models.CostSavingMode, []string{"A", "B"}, 2, []string{"A", "B"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				Mode: tt.mode,
+				ModeOverrides: &models.ModeOverrides{
+					StopSequences: map[models.Mode][]string{
+						models.CostSavingMode: {"\n\n", "###"},
+					},
+				},
+			})
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:         "openai",
+				available:    true,
+				capabilities: models.Capabilities{MaxStopSequences: tt.maxStops},
+				response:     &models.Response{Content: "ok", Vendor: "openai"},
+			}}
+			if err := dispatcher.RegisterVendor(vendor); err != nil {
+				t.Fatalf("Failed to register vendor: %v", err)
+			}
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+				Stop:     tt.stop,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if got := vendor.LastRequest().Stop; !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected stop %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// modelRewritingStrategy is a mode strategy that rewrites the request's
+// model while optimizing it
+type modelRewritingStrategy struct {
+	models.ModeStrategy
+	model string
+}
+
+func (s *modelRewritingStrategy) OptimizeRequest(ctx *models.ModeContext) error {
+	ctx.Request.Model = s.model
+	return nil
+}
+
+func TestDispatcher_Send_ModeResolvedOnce(t *testing.T) {
+	// The rule matches the model the strategy switches to, not the one
+	// requested, so it must not move the request to sophisticated mode
+	dispatcher := NewWithConfig(&models.Config{
+		Mode:           models.CostSavingMode,
+		ModelModeRules: []models.ModelModeRule{{Pattern: "gpt-4o", Mode: models.SophisticatedMode}},
+		ModeOverrides: &models.ModeOverrides{
+			StopSequences: map[models.Mode][]string{
+				models.CostSavingMode:    {"###"},
+				models.SophisticatedMode: {"END"},
+			},
+		},
+	})
+	dispatcher.RegisterModeStrategy(models.CostSavingMode, &modelRewritingStrategy{ModeStrategy: models.NewCostSavingModeStrategy(), model: "gpt-4o"})
+	vendor := &capturingVendor{MockVendor: MockVendor{
+		name:      "openai",
+		available: true,
+		response:  &models.Response{Content: "ok", Vendor: "openai"},
+	}}
+	dispatcher.RegisterVendor(vendor)
+
+	if _, err := dispatcher.Send(context.Background(), &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	last := vendor.LastRequest()
+	if last.Model != "gpt-4o" {
+		t.Fatalf("Expected the strategy's model gpt-4o, got %s", last.Model)
+	}
+	if expected := []string{"###"}; !reflect.DeepEqual(last.Stop, expected) {
+		t.Errorf("Expected the stop sequences of the resolved mode %q, got %q", expected, last.Stop)
+	}
+}
+
+type mockCapabilityProvider struct {
+	mu     sync.Mutex
+	models []string
+	err    error
+	calls  int
+}
+
+func (p *mockCapabilityProvider) FetchCapabilities(ctx context.Context) (models.Capabilities, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.err != nil {
+		return models.Capabilities{}, p.err
+	}
+	return models.Capabilities{Models: p.models, SupportsStreaming: true}, nil
+}
+
+func (p *mockCapabilityProvider) set(models []string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.models = models
+	p.err = err
+}
+
+func TestDispatcher_CapabilityProvider(t *testing.T) {
+	dispatcher := New()
+	vendor := &MockVendor{
+		name:         "test-vendor",
+		available:    true,
+		capabilities: models.Capabilities{Models: []string{"static-model"}},
+	}
+	if err := dispatcher.RegisterVendor(vendor); err != nil {
+		t.Fatalf("Failed to register vendor: %v", err)
+	}
+	ctx := context.Background()
+
+	caps, err := dispatcher.GetCapabilities(ctx, "test-vendor")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(caps.Models, []string{"static-model"}) {
+		t.Errorf("Expected static models without a provider, got %v", caps.Models)
+	}
+
+	provider := &mockCapabilityProvider{err: errors.New("models endpoint down")}
+	ttl := 50 * time.Millisecond
+	if err := dispatcher.SetCapabilityProvider("test-vendor", provider, ttl); err != nil {
+		t.Fatalf("Failed to set capability provider: %v", err)
+	}
+
+	// A failing provider without a previous fetch falls back to the vendor
+	caps, _ = dispatcher.GetCapabilities(ctx, "test-vendor")
+	if !reflect.DeepEqual(caps.Models, []string{"static-model"}) {
+		t.Errorf("Expected static models after a failed fetch, got %v", caps.Models)
+	}
+
+	provider.set([]string{"model-a"}, nil)
+	caps, _ = dispatcher.GetCapabilities(ctx, "test-vendor")
+	if !reflect.DeepEqual(caps.Models, []string{"model-a"}) {
+		t.Errorf("Expected live models [model-a], got %v", caps.Models)
+	}
+
+	// Within the TTL the cached capabilities are served
+	provider.set([]string{"model-a", "model-b"}, nil)
+	caps, _ = dispatcher.GetCapabilities(ctx, "test-vendor")
+	if !reflect.DeepEqual(caps.Models, []string{"model-a"}) {
+		t.Errorf("Expected cached models [model-a], got %v", caps.Models)
+	}
+	if provider.calls != 2 {
+		t.Errorf("Expected 2 provider calls, got %d", provider.calls)
+	}
+
+	time.Sleep(ttl + 10*time.Millisecond)
+	caps, _ = dispatcher.GetCapabilities(ctx, "test-vendor")
+	if !reflect.DeepEqual(caps.Models, []string{"model-a", "model-b"}) {
+		t.Errorf("Expected refreshed models [model-a model-b], got %v", caps.Models)
+	}
+
+	// Once expired, a failed refresh keeps the last fetched capabilities
+	provider.set(nil, errors.New("models endpoint down"))
+	time.Sleep(ttl + 10*time.Millisecond)
+	caps, _ = dispatcher.GetCapabilities(ctx, "test-vendor")
+	if !reflect.DeepEqual(caps.Models, []string{"model-a", "model-b"}) {
+		t.Errorf("Expected last fetched models after a failed refresh, got %v", caps.Models)
+	}
+
+	if err := dispatcher.SetCapabilityProvider("missing", provider, ttl); err == nil {
+		t.Error("Expected error for unknown vendor, got nil")
+	}
+	if _, err := dispatcher.GetCapabilities(ctx, "missing"); err == nil {
+		t.Error("Expected error for unknown vendor, got nil")
+	}
+}
+
+func TestDispatcher_AllModels(t *testing.T) {
+	dispatcher := New()
+	dispatcher.RegisterVendor(&MockVendor{
+		name:         "openai",
+		available:    true,
+		capabilities: models.Capabilities{Models: []string{"gpt-4o", "shared-model"}},
+	})
+	dispatcher.RegisterVendor(&MockVendor{
+		name:         "anthropic",
+		available:    true,
+		capabilities: models.Capabilities{Models: []string{"claude-3-opus", "shared-model"}},
+	})
+
+	expected := map[string][]string{
+		"openai":    {"gpt-4o", "shared-model"},
+		"anthropic": {"claude-3-opus", "shared-model"},
+	}
+	if all := dispatcher.AllModels(); !reflect.DeepEqual(all, expected) {
+		t.Errorf("Expected %v, got %v", expected, all)
+	}
+
+	names := dispatcher.AllModelNames()
+	if expected := []string{"claude-3-opus", "gpt-4o", "shared-model"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	// Live capabilities replace a vendor's hardcoded models
+	dispatcher.SetCapabilityProvider("openai", &mockCapabilityProvider{models: []string{"gpt-4.1"}}, 0)
+	if all := dispatcher.AllModels(); !reflect.DeepEqual(all["openai"], []string{"gpt-4.1"}) {
+		t.Errorf("Expected live openai models, got %v", all["openai"])
+	}
+}
+
+func TestDispatcher_StatsStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stats.json")
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+	usage := models.Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}
+
+	first := NewWithConfig(&models.Config{StatsStore: NewFileStatsStore(path)})
+	first.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok", Usage: usage}})
+	for i := 0; i < 3; i++ {
+		if _, err := first.Send(context.Background(), req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Failed to close dispatcher: %v", err)
+	}
+	saved := first.GetStats()
+
+	second := NewWithConfig(&models.Config{StatsStore: NewFileStatsStore(path)})
+	defer second.Close()
+	restored := second.GetStats()
+	if restored.TotalRequests != 3 || restored.SuccessfulRequests != 3 {
+		t.Errorf("Expected 3 restored requests, got %d total and %d successful", restored.TotalRequests, restored.SuccessfulRequests)
+	}
+	if restored.TotalCost != saved.TotalCost || restored.TotalCost == 0 {
+		t.Errorf("Expected restored total cost %v, got %v", saved.TotalCost, restored.TotalCost)
+	}
+	if restored.VendorStats["openai"].Requests != 3 {
+		t.Errorf("Expected 3 restored openai requests, got %d", restored.VendorStats["openai"].Requests)
+	}
+
+	// Counters keep accumulating on top of the restored ones
+	second.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok", Usage: usage}})
+	if _, err := second.Send(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats := second.GetStats(); stats.TotalRequests != 4 || stats.VendorStats["openai"].Requests != 4 {
+		t.Errorf("Expected 4 cumulative requests, got %d total and %d for openai", stats.TotalRequests, stats.VendorStats["openai"].Requests)
+	}
+
+	// Saves replace the file through a rename, leaving no temp files behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "stats.json" {
+		t.Errorf("Expected only stats.json in store dir, got %v", entries)
+	}
+}
+
+func TestDispatcher_StatsStore_PeriodicFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	store := NewFileStatsStore(path)
+
+	dispatcher := NewWithConfig(&models.Config{StatsStore: store, StatsFlushInterval: 10 * time.Millisecond})
+	defer dispatcher.Close()
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}})
+	if _, err := dispatcher.Send(context.Background(), &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stored, err := store.Load()
+		if err != nil {
+			t.Fatalf("Failed to load stats: %v", err)
+		}
+		if stored != nil && stored.TotalRequests == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected stats to be flushed without Close")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcher_StatsSnapshot_UnderLoad(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode, StatsSnapshotInterval: time.Millisecond})
+	defer dispatcher.Close()
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}})
+
+	// A /stats endpoint encoding the snapshot, as the server does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(dispatcher.StatsSnapshot())
+	}))
+	defer server.Close()
+
+	const senders, requestsPerSender = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requestsPerSender; j++ {
+				dispatcher.Send(context.Background(), &models.Request{
+					Model:    "test-model",
+					Messages: []models.Message{{Role: "user", Content: "Hello"}},
+				})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				resp, err := http.Get(server.URL)
+				if err != nil {
+					t.Errorf("Failed to get stats: %v", err)
+					return
+				}
+				var stats models.DispatcherStats
+				if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+					t.Errorf("Failed to decode stats: %v", err)
+				}
+				resp.Body.Close()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	// The snapshot catches up with the live stats within a refresh
+	deadline := time.Now().Add(time.Second)
+	for dispatcher.StatsSnapshot().TotalRequests != senders*requestsPerSender {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected snapshot to reach %d requests, got %d", senders*requestsPerSender, dispatcher.StatsSnapshot().TotalRequests)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Without an interval the snapshot is the live stats
+	live := NewWithConfig(&models.Config{})
+	live.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}})
+	live.Send(context.Background(), &models.Request{Model: "test-model", Messages: []models.Message{{Role: "user", Content: "Hello"}}})
+	if stats := live.StatsSnapshot(); stats.TotalRequests != 1 {
+		t.Errorf("Expected 1 request, got %d", stats.TotalRequests)
+	}
+}
+
+func TestDispatcher_Events(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode, EventBufferSize: 3})
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{
+		Content: "ok",
+		Model:   "gpt-3.5-turbo",
+		Usage:   models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}})
+	dispatcher.RegisterVendor(&MockVendor{name: "anthropic", available: true, shouldFail: true})
+
+	// Requests completed before subscribing produce no events
+	req := &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+	if _, err := dispatcher.SendToVendor(context.Background(), "openai", req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	events := dispatcher.Events()
+	if dispatcher.Events() != events {
+		t.Error("Expected every call to return the same channel")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := dispatcher.SendToVendor(context.Background(), "openai", req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if _, err := dispatcher.SendToVendor(context.Background(), "anthropic", req); err == nil {
+		t.Fatal("Expected an error from the failing vendor")
+	}
+
+	for i := 0; i < 2; i++ {
+		event := <-events
+		if event.Vendor != "openai" || event.Model != "gpt-3.5-turbo" || !event.Success || event.Error != nil {
+			t.Errorf("Unexpected event for a successful request: %+v", event)
+		}
+		if event.Tokens != 15 || event.Cost <= 0 || event.Timestamp.IsZero() {
+			t.Errorf("Expected tokens, cost and a timestamp, got %+v", event)
+		}
+	}
+	event := <-events
+	if event.Vendor != "anthropic" || event.Success || event.Error == nil || event.Tokens != 0 {
+		t.Errorf("Unexpected event for a failed request: %+v", event)
+	}
+
+	// Events beyond the buffer are dropped and counted rather than blocking
+	for i := 0; i < 5; i++ {
+		if _, err := dispatcher.SendToVendor(context.Background(), "openai", req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if dropped := dispatcher.GetStats().DroppedEvents; dropped != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", dropped)
+	}
+
+	// Close closes the channel once the buffered events are read
+	dispatcher.Close()
+	received := 0
+	for range events {
+		received++
+	}
+	if received != 3 {
+		t.Errorf("Expected 3 buffered events before the channel closed, got %d", received)
+	}
+}
+
+func TestDispatcher_Send_SystemMessagePolicy(t *testing.T) {
+	messages := []models.Message{
+		{Role: "system", Content: "Base instructions."},
+		{Role: "system", Content: "Tool descriptions."},
+		{Role: "user", Content: "Hello"},
+		{Role: "system", Content: "Policies."},
+	}
+
+	tests := []struct {
+		name      string
+		policy    models.SystemMessagePolicy
+		separator string
+		expected  []models.Message
+	}{
+		{
+			name:     "keep by default",
+			expected: messages,
+		},
+		{
+			name:   "merge with default separator",
+			policy: models.SystemMessagesMerge,
+			expected: []models.Message{
+				{Role: "system", Content: "Base instructions.\n\nTool descriptions.\n\nPolicies."},
+				{Role: "user", Content: "Hello"},
+			},
+		},
+		{
+			name:      "merge with custom separator",
+			policy:    models.SystemMessagesMerge,
+			separator: "\n---\n",
+			expected: []models.Message{
+				{Role: "system", Content: "Base instructions.\n---\nTool descriptions.\n---\nPolicies."},
+				{Role: "user", Content: "Hello"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				SystemMessagePolicy:    tt.policy,
+				SystemMessageSeparator: tt.separator,
+			})
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "openai",
+				available: true,
+				response:  &models.Response{Content: "ok", Vendor: "openai"},
+			}}
+			dispatcher.RegisterVendor(vendor)
+
+			if _, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "gpt-4o",
+				Messages: messages,
+			}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if got := vendor.LastRequest().Messages; !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected messages %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMergeSystemMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []models.Message
+		expected []models.Message
+	}{
+		{
+			name:     "single system message unchanged",
+			messages: []models.Message{{Role: "system", Content: "A"}, {Role: "user", Content: "Hi"}},
+			expected: []models.Message{{Role: "system", Content: "A"}, {Role: "user", Content: "Hi"}},
+		},
+		{
+			name:     "merged in place of the first",
+			messages: []models.Message{{Role: "user", Content: "Hi"}, {Role: "system", Content: "A"}, {Role: "assistant", Content: "Yo"}, {Role: "system", Content: "B"}},
+			expected: []models.Message{{Role: "user", Content: "Hi"}, {Role: "system", Content: "A|B"}, {Role: "assistant", Content: "Yo"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeSystemMessages(tt.messages, "|"); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send_ModelRewrite(t *testing.T) {
+	newDispatcher := func(config *models.Config) (*Dispatcher, *capturingVendor, *capturingVendor) {
+		config.Mode = models.SophisticatedMode
+		config.ModelModeRules = []models.ModelModeRule{{Pattern: "gpt-4o", Mode: models.FastMode}}
+		config.ModeOverrides = &models.ModeOverrides{
+			VendorPreferences: map[models.Mode][]string{
+				models.SophisticatedMode: {"legacy"},
+				models.FastMode:          {"openai"},
+			},
+		}
+		dispatcher := NewWithConfig(config)
+		legacy := &capturingVendor{MockVendor: MockVendor{name: "legacy", available: true, response: &models.Response{Content: "legacy"}}}
+		openai := &capturingVendor{MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "openai"}}}
+		dispatcher.RegisterVendor(legacy)
+		dispatcher.RegisterVendor(openai)
+		return dispatcher, legacy, openai
+	}
+	req := &models.Request{
+		Model:    "gpt-4",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	tests := []struct {
+		name   string
+		config *models.Config
+	}{
+		{"rules map", &models.Config{ModelRewrites: map[string]string{"gpt-4": "gpt-4o"}}},
+		{"rewriter func", &models.Config{ModelRewriter: func(model string) string {
+			if model == "gpt-4" {
+				return "gpt-4o"
+			}
+			return model
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, legacy, openai := newDispatcher(tt.config)
+
+			response, err := dispatcher.Send(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if legacy.Calls() != 0 || openai.Calls() != 1 {
+				t.Fatalf("Expected the rewritten model to route to openai, got %d legacy and %d openai calls", legacy.Calls(), openai.Calls())
+			}
+			if sent := openai.LastRequest().Model; sent != "gpt-4o" {
+				t.Errorf("Expected vendor to receive gpt-4o, got %s", sent)
+			}
+			if response.Model != "gpt-4o" || response.RequestedModel != "gpt-4" {
+				t.Errorf("Expected response model gpt-4o requested as gpt-4, got %s requested as %s", response.Model, response.RequestedModel)
+			}
+			if req.Model != "gpt-4" {
+				t.Errorf("Expected caller's request to be untouched, got model %s", req.Model)
+			}
+			if count := dispatcher.GetStats().RequestsByModel["gpt-4o"]; count != 1 {
+				t.Errorf("Expected 1 request for gpt-4o in stats, got %d", count)
+			}
+		})
+	}
+
+	// Without a rewrite the request keeps its model and routing
+	dispatcher, legacy, _ := newDispatcher(&models.Config{})
+	response, err := dispatcher.Send(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if legacy.Calls() != 1 || response.RequestedModel != "" {
+		t.Errorf("Expected unrewritten request to route to legacy, got %d calls and requested model %q", legacy.Calls(), response.RequestedModel)
+	}
+}
+
+func TestDispatcher_SendStreaming_EstimatesMissingUsage(t *testing.T) {
+	// The stream sends two chunks and done without ever reporting usage
+	newStream := func(usage models.Usage) *models.StreamingResponse {
+		stream := models.NewStreamingResponse("test-model", "test-vendor")
+		go func() {
+			stream.ContentChan <- "Streamed "
+			stream.ContentChan <- "completion text"
+			stream.Usage = usage
+			stream.DoneChan <- true
+		}()
+		return stream
+	}
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Tell me something"}},
+	}
+
+	tests := []struct {
+		name              string
+		reported          models.Usage
+		expectedUsage     models.Usage
+		expectedEstimated bool
+	}{
+		{
+			name: "usage omitted",
+			// Prompt: "Be brief." and "Tell me something" are 3 tokens
+			// each; completion: "Streamed completion text" is 4
+			expectedUsage:     models.Usage{PromptTokens: 6, CompletionTokens: 4, TotalTokens: 10},
+			expectedEstimated: true,
+		},
+		{
+			name:          "usage reported",
+			reported:      models.Usage{PromptTokens: 20, CompletionTokens: 30, TotalTokens: 50},
+			expectedUsage: models.Usage{PromptTokens: 20, CompletionTokens: 30, TotalTokens: 50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			dispatcher.RegisterVendor(&MockVendor{
+				name:              "test-vendor",
+				available:         true,
+				supportsStreaming: true,
+				streamingResponse: newStream(tt.reported),
+			})
+
+			stream, err := dispatcher.SendStreaming(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var content string
+			for done := false; !done; {
+				select {
+				case chunk := <-stream.ContentChan:
+					content += chunk
+				case _, ok := <-stream.DoneChan:
+					if !ok {
+						t.Fatalf("Expected stream to complete, got %v", <-stream.ErrorChan)
+					}
+					done = true
+				case err := <-stream.ErrorChan:
+					// A nil error means the stream was closed after done
+					if err != nil {
+						t.Fatalf("Expected no stream error, got %v", err)
+					}
+					done = true
+				case <-time.After(time.Second):
+					t.Fatal("Timeout waiting for stream")
+				}
+			}
+			for len(stream.ContentChan) > 0 {
+				content += <-stream.ContentChan
+			}
+
+			if content != "Streamed completion text" {
+				t.Errorf("Expected streamed content, got %q", content)
+			}
+			if stream.Usage != tt.expectedUsage {
+				t.Errorf("Expected usage %+v, got %+v", tt.expectedUsage, stream.Usage)
+			}
+			if stream.UsageEstimated != tt.expectedEstimated {
+				t.Errorf("Expected UsageEstimated %v, got %v", tt.expectedEstimated, stream.UsageEstimated)
+			}
+
+			stats := dispatcher.GetStats()
+			expectedCost := dispatcher.estimateCost("test-vendor", "", tt.expectedUsage.PromptTokens, tt.expectedUsage.CompletionTokens)
+			if stats.TotalCost != expectedCost {
+				t.Errorf("Expected total cost %v, got %v", expectedCost, stats.TotalCost)
+			}
+			if cost := stats.VendorStats["test-vendor"].TotalCost; cost != expectedCost {
+				t.Errorf("Expected vendor cost %v, got %v", expectedCost, cost)
+			}
+			expectedMissing := int64(0)
+			if tt.expectedEstimated {
+				expectedMissing = 1
+			}
+			if missing := stats.VendorStats["test-vendor"].MissingUsageCount; missing != expectedMissing {
+				t.Errorf("Expected missing usage count %d, got %d", expectedMissing, missing)
+			}
+			if stats.EstimatedCostCount != expectedMissing {
+				t.Errorf("Expected estimated cost count %d, got %d", expectedMissing, stats.EstimatedCostCount)
+			}
+		})
+	}
+}
+
+func TestDispatcher_RoutingSeed(t *testing.T) {
+	route := func(seed int64) []string {
+		dispatcher := NewWithConfig(&models.Config{Mode: models.AutoMode, RoutingSeed: seed})
+		// None of the vendors is known to the mode heuristics, so each
+		// request is routed to a random fallback vendor
+		for _, name := range []string{"alpha", "beta", "gamma"} {
+			dispatcher.RegisterVendor(&MockVendor{name: name, available: true, response: &models.Response{Content: name}})
+		}
+
+		vendors := make([]string, 0, 8)
+		for i := 0; i < 8; i++ {
+			response, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			vendors = append(vendors, response.Content)
+		}
+		return vendors
+	}
+
+	expected := []string{"gamma", "gamma", "gamma", "alpha", "beta", "beta", "alpha", "gamma"}
+	for run := 0; run < 2; run++ {
+		if vendors := route(42); !reflect.DeepEqual(vendors, expected) {
+			t.Errorf("Expected seed 42 to route %v, got %v", expected, vendors)
+		}
+	}
+}
+
+func TestSpendMonitor_Anomaly(t *testing.T) {
+	type alert struct{ rate, baseline float64 }
+	alerts := make(chan alert, 10)
+	dispatcher := NewWithConfig(&models.Config{SpendRateAlert: &models.SpendRateAlertConfig{
+		OnSpendAnomaly: func(rate, baseline float64) { alerts <- alert{rate, baseline} },
+	}})
+
+	monitor := dispatcher.spendMonitor
+	if monitor == nil {
+		t.Fatal("Expected a spend monitor")
+	}
+	start := time.Now()
+	clock := start
+	monitor.now = func() time.Time { return clock }
+	monitor.started = start
+
+	// A steady 0.01 per minute sets the baseline without alerting
+	for minute := 1; minute <= 10; minute++ {
+		clock = start.Add(time.Duration(minute) * time.Minute)
+		monitor.record(0.01)
+	}
+	select {
+	case got := <-alerts:
+		t.Fatalf("Expected no alert for steady spending, got %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 20x the baseline within the next minute
+	clock = start.Add(11 * time.Minute)
+	dispatcher.updateStats(true, "test-vendor", time.Millisecond, 0.2)
+
+	select {
+	case got := <-alerts:
+		if math.Abs(got.rate-0.2) > 1e-9 || math.Abs(got.baseline-0.01) > 1e-9 {
+			t.Errorf("Expected rate 0.2 against baseline 0.01, got %v against %v", got.rate, got.baseline)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an alert for the spike")
+	}
+
+	// Further spending within the same window doesn't alert again
+	clock = start.Add(11*time.Minute + 30*time.Second)
+	monitor.record(0.5)
+	select {
+	case got := <-alerts:
+		t.Errorf("Expected one alert per window, got another %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// quarterTokenCounter counts a token per four bytes, like EstimateTokens
+type quarterTokenCounter struct{}
+
+func (quarterTokenCounter) CountTokens(model, text string) int {
+	return models.EstimateTokens(text)
+}
+
+// fakeSummarizer summarizes to a fixed text and records what it was given
+type fakeSummarizer struct {
+	summary string
+	got     []models.Message
+}
+
+func (f *fakeSummarizer) Summarize(ctx context.Context, messages []models.Message) (string, error) {
+	f.got = messages
+	return f.summary, nil
+}
+
+func TestSession_TokenBudget(t *testing.T) {
+	// "Be brief." is 2 tokens and each other message 20
+	system := models.Message{Role: "system", Content: "Be brief."}
+	user1 := models.Message{Role: "user", Content: strings.Repeat("a", 80)}
+	reply1 := models.Message{Role: "assistant", Content: strings.Repeat("b", 80)}
+	user2 := models.Message{Role: "user", Content: strings.Repeat("c", 80)}
+	summary := models.Message{Role: "system", Content: sessionSummaryPrefix + "Asked about a."}
+
+	tests := []struct {
+		name          string
+		eviction      models.SessionEviction
+		expected      []models.Message
+		expectedError error
+	}{
+		{"drop oldest", models.SessionEvictDropOldest, []models.Message{system, reply1, user2}, nil},
+		{"summarize oldest", models.SessionEvictSummarizeOldest, []models.Message{system, summary, reply1, user2}, nil},
+		{"error", models.SessionEvictError, []models.Message{system, user1, reply1}, models.ErrSessionBudgetExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summarizer := &fakeSummarizer{summary: "Asked about a."}
+			dispatcher := NewWithConfig(&models.Config{TokenCounter: quarterTokenCounter{}})
+			session, err := dispatcher.NewSession(&models.SessionConfig{MaxTokens: 60, Eviction: tt.eviction, Summarizer: summarizer})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if err := session.Append(context.Background(), system, user1, reply1); err != nil {
+				t.Fatalf("Expected 42 tokens to fit, got %v", err)
+			}
+			// 62 tokens exceed the budget of 60
+			err = session.Append(context.Background(), user2)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedError, err)
+			}
+
+			messages := session.Messages()
+			if !reflect.DeepEqual(messages, tt.expected) {
+				t.Errorf("Expected messages %+v, got %+v", tt.expected, messages)
+			}
+			if tokens := session.messageTokens(messages); tokens > 60 {
+				t.Errorf("Expected at most 60 tokens, got %d", tokens)
+			}
+			if tt.eviction == models.SessionEvictSummarizeOldest && !reflect.DeepEqual(summarizer.got, []models.Message{user1}) {
+				t.Errorf("Expected the oldest message to be summarized, got %+v", summarizer.got)
+			}
+		})
+	}
+
+	// Pinned messages alone over the budget can't be evicted
+	session, _ := NewWithConfig(&models.Config{TokenCounter: quarterTokenCounter{}}).NewSession(&models.SessionConfig{MaxTokens: 10})
+	if err := session.Append(context.Background(), system, user1); !errors.Is(err, models.ErrSessionBudgetExceeded) {
+		t.Errorf("Expected ErrSessionBudgetExceeded, got %v", err)
+	}
+
+	// Summarizing requires a summarizer
+	if _, err := New().NewSession(&models.SessionConfig{Eviction: models.SessionEvictSummarizeOldest}); !errors.Is(err, models.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestSession_FitSummary(t *testing.T) {
+	session, _ := NewWithConfig(&models.Config{TokenCounter: quarterTokenCounter{}}).NewSession(nil)
+	summary := strings.Repeat("a", 100)
+	// The 37-byte prefix takes 9 tokens
+	prefixTokens := models.EstimateTokens(sessionSummaryPrefix)
+
+	tests := []struct {
+		name     string
+		room     int
+		expected string
+	}{
+		{"fits", prefixTokens + 30, summary},
+		// 79 bytes of prefix and summary take 19 tokens
+		{"cut", prefixTokens + 10, summary[:42]},
+		{"no room", prefixTokens - 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := session.fitSummary(summary, tt.room)
+			if got != tt.expected {
+				t.Errorf("Expected %d bytes of summary, got %d", len(tt.expected), len(got))
+			}
+			if tokens := session.countTokens(sessionSummaryPrefix + got); got != "" && tokens > tt.room {
+				t.Errorf("Expected at most %d tokens, got %d", tt.room, tokens)
+			}
+		})
+	}
+}
+
+func TestSession_Send(t *testing.T) {
+	dispatcher := New()
+	vendor := &capturingVendor{MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "Hi!"}}}
+	dispatcher.RegisterVendor(vendor)
+
+	session, err := dispatcher.NewSession(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, content := range []string{"Hello", "How are you?"} {
+		if _, err := session.Send(context.Background(), &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: content}},
+		}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	expected := []models.Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi!"},
+		{Role: "user", Content: "How are you?"},
+	}
+	if sent := vendor.LastRequest().Messages; !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expected the vendor to receive the conversation %+v, got %+v", expected, sent)
+	}
+	if messages := session.Messages(); len(messages) != 4 || messages[3].Content != "Hi!" {
+		t.Errorf("Expected the second response appended, got %+v", messages)
+	}
+}
+
+func TestDispatcher_Send_IncludeRawResponse(t *testing.T) {
+	for _, include := range []bool{false, true} {
+		dispatcher := NewWithConfig(&models.Config{IncludeRawResponse: include})
+		vendor := &capturingVendor{MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "Hi"}}}
+		dispatcher.RegisterVendor(vendor)
+
+		if _, err := dispatcher.Send(context.Background(), &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := vendor.LastRequest().IncludeRawResponse; got != include {
+			t.Errorf("Expected the vendor to be asked for the raw response %v, got %v", include, got)
+		}
+	}
+}
+
+// latencyVendor answers after delay, or gives up when the context ends, and
+// records how many of its calls overlap
+type latencyVendor struct {
+	MockVendor
+	delay    time.Duration
+	inFlight *atomic.Int32
+	peak     *atomic.Int32
+}
+
+func (v *latencyVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if v.inFlight != nil {
+		n := v.inFlight.Add(1)
+		defer v.inFlight.Add(-1)
+		for peak := v.peak.Load(); n > peak && !v.peak.CompareAndSwap(peak, n); peak = v.peak.Load() {
+		}
+	}
+
+	select {
+	case <-time.After(v.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return v.MockVendor.SendRequest(ctx, req)
+}
+
+func TestDispatcher_SendToAll(t *testing.T) {
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+	}
+	newDispatcher := func() *Dispatcher {
+		dispatcher := NewWithConfig(&models.Config{})
+		dispatcher.RegisterVendor(&latencyVendor{MockVendor: MockVendor{name: "anthropic", available: true, response: &models.Response{Content: "anthropic"}}, delay: 10 * time.Millisecond})
+		dispatcher.RegisterVendor(&latencyVendor{MockVendor: MockVendor{name: "google", available: true, shouldFail: true}, delay: 5 * time.Millisecond})
+		dispatcher.RegisterVendor(&latencyVendor{MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "openai"}}, delay: 30 * time.Millisecond})
+		dispatcher.RegisterVendor(&latencyVendor{MockVendor: MockVendor{name: "together", available: true, response: &models.Response{Content: "together"}}, delay: 5 * time.Second})
+		return dispatcher
+	}
+
+	t.Run("all", func(t *testing.T) {
+		dispatcher := newDispatcher()
+		results, err := dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{
+			Vendors: []string{"openai", "google", "anthropic"},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 3 {
+			t.Fatalf("Expected 3 results, got %d", len(results))
+		}
+		for i, vendor := range []string{"anthropic", "google", "openai"} {
+			if results[i].Vendor != vendor {
+				t.Errorf("Expected result %d for %s, got %s", i, vendor, results[i].Vendor)
+			}
+		}
+		if results[0].Err != nil || results[0].Response.Content != "anthropic" {
+			t.Errorf("Expected anthropic to succeed, got %v", results[0].Err)
+		}
+		if results[1].Err == nil {
+			t.Error("Expected google to fail")
+		}
+		if results[2].Err != nil || results[2].Response.Content != "openai" {
+			t.Errorf("Expected openai to succeed, got %v", results[2].Err)
+		}
+	})
+
+	t.Run("first success", func(t *testing.T) {
+		dispatcher := newDispatcher()
+		start := time.Now()
+		results, err := dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{Mode: models.FanOutFirstSuccess})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected to return after the first success, took %v", elapsed)
+		}
+		if results[0].Vendor != "anthropic" || results[0].Err != nil {
+			t.Errorf("Expected anthropic to succeed first, got %s: %v", results[0].Vendor, results[0].Err)
+		}
+		if !errors.Is(results[3].Err, models.ErrFanOutCancelled) {
+			t.Errorf("Expected together to be cancelled, got %v", results[3].Err)
+		}
+
+		// Cancelled calls are counted apart from failures
+		deadline := time.Now().Add(time.Second)
+		for dispatcher.GetStats().VendorStats["together"].Cancellations != 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("Expected the cancelled call to be recorded")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		stats := dispatcher.GetStats()
+		if stats.VendorStats["together"].Failures != 0 {
+			t.Errorf("Expected no together failures, got %d", stats.VendorStats["together"].Failures)
+		}
+		if stats.VendorStats["google"].Failures != 1 {
+			t.Errorf("Expected 1 google failure, got %d", stats.VendorStats["google"].Failures)
+		}
+	})
+
+	t.Run("first n", func(t *testing.T) {
+		dispatcher := newDispatcher()
+		results, err := dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{Mode: models.FanOutFirstN, N: 2})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var succeeded []string
+		for _, result := range results {
+			if result.Err == nil {
+				succeeded = append(succeeded, result.Vendor)
+			}
+		}
+		if !reflect.DeepEqual(succeeded, []string{"anthropic", "openai"}) {
+			t.Errorf("Expected anthropic and openai to succeed, got %v", succeeded)
+		}
+		if !errors.Is(results[3].Err, models.ErrFanOutCancelled) {
+			t.Errorf("Expected together to be cancelled, got %v", results[3].Err)
+		}
+
+		// Too few vendors can succeed
+		_, err = dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{
+			Vendors: []string{"anthropic", "google"},
+			Mode:    models.FanOutFirstN,
+			N:       2,
+		})
+		if !errors.Is(err, models.ErrFanOutIncomplete) {
+			t.Errorf("Expected ErrFanOutIncomplete, got %v", err)
+		}
+	})
+
+	t.Run("max parallel", func(t *testing.T) {
+		var inFlight, peak atomic.Int32
+		dispatcher := NewWithConfig(&models.Config{})
+		for _, name := range []string{"anthropic", "google", "openai"} {
+			dispatcher.RegisterVendor(&latencyVendor{
+				MockVendor: MockVendor{name: name, available: true, response: &models.Response{Content: name}},
+				delay:      10 * time.Millisecond,
+				inFlight:   &inFlight,
+				peak:       &peak,
+			})
+		}
+
+		results, err := dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{MaxParallel: 1})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				t.Errorf("Expected %s to succeed, got %v", result.Vendor, result.Err)
+			}
+		}
+		if peak.Load() != 1 {
+			t.Errorf("Expected at most 1 call in flight, got %d", peak.Load())
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		dispatcher := newDispatcher()
+		if _, err := dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{Mode: "fastest"}); !errors.Is(err, models.ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest, got %v", err)
+		}
+		if _, err := dispatcher.SendToAll(context.Background(), newRequest(), models.FanOutOptions{Mode: models.FanOutFirstN}); !errors.Is(err, models.ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest without N, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_ContextAlreadyDone(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{"cancelled", cancelled, context.Canceled},
+		{"deadline exceeded", expired, context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{})
+			vendor := &countingVendor{MockVendor: MockVendor{name: "openai", available: true, supportsStreaming: true, response: &models.Response{Content: "ok"}}}
+			dispatcher.RegisterVendor(vendor)
+			req := &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			}
+
+			if _, err := dispatcher.Send(tt.ctx, req); err != tt.wantErr {
+				t.Errorf("Send: expected %v, got %v", tt.wantErr, err)
+			}
+			if _, err := dispatcher.SendStreaming(tt.ctx, req); err != tt.wantErr {
+				t.Errorf("SendStreaming: expected %v, got %v", tt.wantErr, err)
+			}
+			if _, err := dispatcher.SendToVendor(tt.ctx, "openai", req); err != tt.wantErr {
+				t.Errorf("SendToVendor: expected %v, got %v", tt.wantErr, err)
+			}
+			if _, err := dispatcher.SendStreamingToVendor(tt.ctx, "openai", req); err != tt.wantErr {
+				t.Errorf("SendStreamingToVendor: expected %v, got %v", tt.wantErr, err)
+			}
+
+			if vendor.calls != 0 {
+				t.Errorf("Expected no vendor calls, got %d", vendor.calls)
+			}
+			stats := dispatcher.GetStats()
+			if stats.TotalRequests != 0 || stats.FailedRequests != 0 || len(stats.ModeStats) != 0 {
+				t.Errorf("Expected no stats, got %d total, %d failed and %d modes", stats.TotalRequests, stats.FailedRequests, len(stats.ModeStats))
+			}
+		})
+	}
+}
+
+// staleHealthVendor reports cached health from IsAvailable and its real
+// health from ProbeHealth
+type staleHealthVendor struct {
+	MockVendor
+	healthy bool
+	probes  atomic.Int32
+}
+
+func (v *staleHealthVendor) ProbeHealth(ctx context.Context) bool {
+	v.probes.Add(1)
+	return v.healthy
+}
+
+func TestDispatcher_HealthRecheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		healthy    bool
+		wantErr    error
+		wantProbes int32
+	}{
+		{name: "recovered vendor is used", timeout: 100 * time.Millisecond, healthy: true, wantProbes: 1},
+		{name: "vendor still down", timeout: 100 * time.Millisecond, healthy: false, wantErr: models.ErrNoEligibleVendor, wantProbes: 1},
+		{name: "recheck disabled", healthy: true, wantErr: models.ErrNoEligibleVendor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{HealthRecheckTimeout: tt.timeout})
+			vendor := &staleHealthVendor{
+				MockVendor: MockVendor{
+					name:     "openai",
+					response: &models.Response{Content: "ok", Vendor: "openai"},
+				},
+				healthy: tt.healthy,
+			}
+			dispatcher.RegisterVendor(vendor)
+
+			resp, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if resp.Content != "ok" {
+					t.Errorf("Expected response from the recovered vendor, got %q", resp.Content)
+				}
+			}
+			if probes := vendor.probes.Load(); probes != tt.wantProbes {
+				t.Errorf("Expected %d probes, got %d", tt.wantProbes, probes)
+			}
+		})
+	}
+}
+
+// embeddingVendor is a MockVendor that also computes embeddings
+type embeddingVendor struct {
+	MockVendor
+}
+
+func (v *embeddingVendor) EmbedRequest(ctx context.Context, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	if v.shouldFail {
+		return nil, errors.New("embedding failed")
+	}
+	embeddings := make([][]float64, len(req.Input))
+	for i, input := range req.Input {
+		embeddings[i] = []float64{float64(len(input))}
+	}
+	return &models.EmbeddingResponse{
+		Embeddings: embeddings,
+		Model:      "embed-1",
+		Vendor:     v.name,
+		Usage:      models.Usage{PromptTokens: 3, TotalTokens: 3},
+	}, nil
+}
+
+func TestDispatcher_Embed(t *testing.T) {
+	dispatcher := New()
+	dispatcher.RegisterVendor(&MockVendor{name: "chat-only", available: true})
+	dispatcher.RegisterVendor(&embeddingVendor{MockVendor: MockVendor{name: "embedder", available: true}})
+
+	resp, err := dispatcher.Embed(context.Background(), &models.EmbeddingRequest{Input: []string{"a", "bcd"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Vendor != "embedder" {
+		t.Errorf("Expected the embedding vendor to be chosen, got %s", resp.Vendor)
+	}
+	if len(resp.Embeddings) != 2 || resp.Embeddings[1][0] != 3 {
+		t.Errorf("Expected one embedding per input, got %v", resp.Embeddings)
+	}
+
+	stats := dispatcher.GetStats()
+	if stats.TotalRequests != 1 || stats.SuccessfulRequests != 1 || stats.VendorStats["embedder"].Requests != 1 {
+		t.Errorf("Expected one successful request to embedder, got %+v", stats)
+	}
+
+	if _, err := dispatcher.Embed(context.Background(), &models.EmbeddingRequest{}); !errors.Is(err, models.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest without input, got %v", err)
+	}
+	if _, err := dispatcher.Embed(context.Background(), &models.EmbeddingRequest{Input: []string{"a"}, Mode: "warp_speed"}); !errors.Is(err, models.ErrInvalidMode) {
+		t.Errorf("Expected ErrInvalidMode, got %v", err)
+	}
+}
+
+func TestDispatcher_Embed_NotSupported(t *testing.T) {
+	dispatcher := New()
+	dispatcher.RegisterVendor(&MockVendor{name: "chat-only", available: true})
+
+	_, err := dispatcher.Embed(context.Background(), &models.EmbeddingRequest{Input: []string{"a"}})
+	if !errors.Is(err, models.ErrFeatureNotSupported) {
+		t.Errorf("Expected ErrFeatureNotSupported, got %v", err)
+	}
+}
+
+// batchingEmbeddingVendor is an embeddingVendor taking at most batchSize
+// inputs per call
+type batchingEmbeddingVendor struct {
+	embeddingVendor
+	batchSize int
+	batches   [][]string
+}
+
+func (v *batchingEmbeddingVendor) EmbeddingBatchSize() int {
+	return v.batchSize
+}
+
+func (v *batchingEmbeddingVendor) EmbedRequest(ctx context.Context, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	if len(req.Input) > v.batchSize {
+		return nil, fmt.Errorf("%d inputs over the limit of %d", len(req.Input), v.batchSize)
+	}
+	v.batches = append(v.batches, req.Input)
+	return v.embeddingVendor.EmbedRequest(ctx, req)
+}
+
+func TestDispatcher_Embed_Batches(t *testing.T) {
+	dispatcher := New()
+	vendor := &batchingEmbeddingVendor{embeddingVendor: embeddingVendor{MockVendor{name: "embedder", available: true}}, batchSize: 3}
+	dispatcher.RegisterVendor(vendor)
+
+	// Each input's embedding is its length, so the order is checkable
+	input := make([]string, 8)
+	for i := range input {
+		input[i] = strings.Repeat("x", i+1)
+	}
+	resp, err := dispatcher.Embed(context.Background(), &models.EmbeddingRequest{Input: input})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(vendor.batches) != 3 || len(vendor.batches[0]) != 3 || len(vendor.batches[2]) != 2 {
+		t.Errorf("Expected batches of 3, 3 and 2 inputs, got %v", vendor.batches)
+	}
+	if len(resp.Embeddings) != len(input) {
+		t.Fatalf("Expected %d embeddings, got %d", len(input), len(resp.Embeddings))
+	}
+	for i, embedding := range resp.Embeddings {
+		if embedding[0] != float64(i+1) {
+			t.Errorf("Expected embedding %d to be for input %d, got %v", i, i, embedding)
+		}
+	}
+	if resp.Usage.PromptTokens != 9 || resp.Usage.TotalTokens != 9 {
+		t.Errorf("Expected the usage of the three calls summed, got %+v", resp.Usage)
+	}
+	if resp.Vendor != "embedder" || resp.Model != "embed-1" {
+		t.Errorf("Expected the batches' vendor and model, got %s %s", resp.Vendor, resp.Model)
+	}
+}
+
+// reasonerVendor answers like a reasoning model, with its reasoning either
+// in <think> tags in the content or in ReasoningContent
+type reasonerVendor struct {
+	MockVendor
+	thinkTags bool
+}
+
+func (v *reasonerVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	response := &models.Response{
+		Vendor: v.name,
+		Usage:  models.Usage{PromptTokens: 10, CompletionTokens: 30, TotalTokens: 40, ReasoningTokens: 20},
+	}
+	if v.thinkTags {
+		response.Content = "<think>\nThe user greets me.\n</think>\n\nHello!"
+	} else {
+		response.Content = "Hello!"
+		response.ReasoningContent = "The user greets me."
+	}
+	return response, nil
+}
+
+func TestDispatcher_IncludeReasoning(t *testing.T) {
+	tests := []struct {
+		name             string
+		thinkTags        bool
+		includeReasoning bool
+	}{
+		{name: "think tags excluded", thinkTags: true},
+		{name: "think tags included", thinkTags: true, includeReasoning: true},
+		{name: "reasoning field excluded"},
+		{name: "reasoning field included", includeReasoning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			dispatcher.RegisterVendor(&reasonerVendor{
+				MockVendor: MockVendor{name: "openai", available: true},
+				thinkTags:  tt.thinkTags,
+			})
+
+			resp, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:            "gpt-3.5-turbo",
+				Messages:         []models.Message{{Role: "user", Content: "Hi"}},
+				IncludeReasoning: tt.includeReasoning,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if resp.Content != "Hello!" {
+				t.Errorf("Expected reasoning kept out of content, got %q", resp.Content)
+			}
+			if resp.Usage.CompletionTokens != 30 {
+				t.Errorf("Expected completion tokens to still count reasoning, got %d", resp.Usage.CompletionTokens)
+			}
+
+			wantReasoning, wantTokens := "", 0
+			if tt.includeReasoning {
+				wantReasoning, wantTokens = "The user greets me.", 20
+			}
+			if resp.ReasoningContent != wantReasoning {
+				t.Errorf("Expected reasoning %q, got %q", wantReasoning, resp.ReasoningContent)
+			}
+			if resp.Usage.ReasoningTokens != wantTokens {
+				t.Errorf("Expected %d reasoning tokens, got %d", wantTokens, resp.Usage.ReasoningTokens)
+			}
+		})
+	}
+}
+
+func TestDispatcher_TrackPayloadSizes(t *testing.T) {
+	bodies := []string{
+		`{"choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`,
+		`{"choices":[{"message":{"role":"assistant","content":"Hello there, how can I help?"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":7,"total_tokens":8}}`,
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":1,\"completion_tokens\":1,\"total_tokens\":2}}\n\ndata: [DONE]\n\n",
+	}
+
+	var mu sync.Mutex
+	var calls int
+	var sent int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := bodies[calls]
+		calls++
+		sent += r.ContentLength
+		mu.Unlock()
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	for _, track := range []bool{false, true} {
+		mu.Lock()
+		calls, sent = 0, 0
+		mu.Unlock()
+
+		dispatcher := NewWithConfig(&models.Config{TrackPayloadSizes: track})
+		dispatcher.RegisterVendor(vendors.NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL}))
+
+		req := &models.Request{
+			Model:    "gpt-3.5-turbo",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := dispatcher.Send(context.Background(), req); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if _, err := dispatcher.SendStreamingCollected(context.Background(), req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		stats := dispatcher.GetStats().VendorStats["openai"]
+		if !track {
+			if stats.PayloadSamples != 0 || stats.AvgRequestBytes != 0 || stats.AvgResponseBytes != 0 {
+				t.Errorf("Expected no payload sizes without TrackPayloadSizes, got %+v", stats)
+			}
+			continue
+		}
+
+		mu.Lock()
+		wantRequest := float64(sent) / 3
+		mu.Unlock()
+		wantResponse := float64(len(bodies[0])+len(bodies[1])+len(bodies[2])) / 3
+		if stats.PayloadSamples != 3 {
+			t.Errorf("Expected 3 payload samples, got %d", stats.PayloadSamples)
+		}
+		if math.Abs(stats.AvgRequestBytes-wantRequest) > 1e-9 {
+			t.Errorf("Expected average request size %.2f, got %.2f", wantRequest, stats.AvgRequestBytes)
+		}
+		if math.Abs(stats.AvgResponseBytes-wantResponse) > 1e-9 {
+			t.Errorf("Expected average response size %.2f, got %.2f", wantResponse, stats.AvgResponseBytes)
+		}
+	}
+}
+
+// failingRecorder fails every record with err, counting the attempts
+type failingRecorder struct {
+	err   error
+	calls atomic.Int32
+}
+
+func (r *failingRecorder) Record(ctx context.Context, req *models.Request, resp *models.Response) error {
+	r.calls.Add(1)
+	return r.err
+}
+
+func TestDispatcher_FailClosedOnRecordError(t *testing.T) {
+	for _, failClosed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fail closed %v", failClosed), func(t *testing.T) {
+			recorder := &failingRecorder{err: errors.New("audit store unreachable")}
+			dispatcher := NewWithConfig(&models.Config{
+				Recorder:                recorder,
+				FailClosedOnRecordError: failClosed,
+			})
+			dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "Hello!", Vendor: "openai"}})
+
+			req := &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Messages: []models.Message{{Role: "user", Content: "Hi"}},
+			}
+			resp, err := dispatcher.Send(context.Background(), req)
+			if failClosed {
+				if !errors.Is(err, models.ErrAuditFailed) || resp != nil {
+					t.Errorf("Expected ErrAuditFailed and no response, got %v and %v", resp, err)
+				}
+			} else if err != nil || resp.Content != "Hello!" {
+				t.Errorf("Expected the response despite the failed record, got %v and %v", resp, err)
+			}
+
+			resp, err = dispatcher.SendToVendor(context.Background(), "openai", req)
+			if failClosed != errors.Is(err, models.ErrAuditFailed) {
+				t.Errorf("Expected SendToVendor to fail closed %v, got %v and %v", failClosed, resp, err)
+			}
+
+			if calls := recorder.calls.Load(); calls != 2 {
+				t.Errorf("Expected 2 records, got %d", calls)
+			}
+			stats := dispatcher.GetStats()
+			if failClosed && stats.FailedRequests != 2 {
+				t.Errorf("Expected the unrecorded requests to count as failures, got %+v", stats)
+			}
+		})
+	}
+}
+
+// switchableRecorder records the responses it is given, failing while
+// fail is set
+type switchableRecorder struct {
+	fail      atomic.Bool
+	mu        sync.Mutex
+	responses []*models.Response
+}
+
+func (r *switchableRecorder) Record(ctx context.Context, req *models.Request, resp *models.Response) error {
+	if r.fail.Load() {
+		return errors.New("audit store unreachable")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, resp)
+	return nil
+}
+
+func (r *switchableRecorder) Recorded() []*models.Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*models.Response(nil), r.responses...)
+}
+
+func TestDispatcher_FailClosedOnRecordError_CacheHit(t *testing.T) {
+	recorder := &switchableRecorder{}
+	dispatcher := NewWithConfig(&models.Config{
+		Recorder:                recorder,
+		FailClosedOnRecordError: true,
+		Cache:                   &models.CacheConfig{Enabled: true},
+	})
+	vendor := &capturingVendor{MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "Hello!", Vendor: "openai"}}}
+	dispatcher.RegisterVendor(vendor)
+
+	req := &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hi"}},
+	}
+	if _, err := dispatcher.Send(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp, err := dispatcher.Send(context.Background(), req); err != nil || resp.Content != "Hello!" {
+		t.Fatalf("Expected the cached response, got %v and %v", resp, err)
+	}
+	if recorded := len(recorder.Recorded()); recorded != 2 {
+		t.Errorf("Expected the cache hit recorded, got %d records", recorded)
+	}
+
+	recorder.fail.Store(true)
+	resp, err := dispatcher.Send(context.Background(), req)
+	if !errors.Is(err, models.ErrAuditFailed) || resp != nil {
+		t.Errorf("Expected ErrAuditFailed and no response for an unrecorded cache hit, got %v and %v", resp, err)
+	}
+	if vendor.Calls() != 1 {
+		t.Errorf("Expected the vendor called once, got %d calls", vendor.Calls())
+	}
+	if stats := dispatcher.GetStats(); stats.FailedRequests != 1 {
+		t.Errorf("Expected the unrecorded cache hit to count as a failure, got %+v", stats)
+	}
+}
+
+func TestDispatcher_FailClosedOnRecordError_Streaming(t *testing.T) {
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:    "gpt-3.5-turbo",
+			Messages: []models.Message{{Role: "user", Content: "Hi"}},
+		}
+	}
+
+	t.Run("recorded", func(t *testing.T) {
+		recorder := &switchableRecorder{}
+		dispatcher := NewWithConfig(&models.Config{Recorder: recorder, FailClosedOnRecordError: true})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+
+		resp, err := dispatcher.SendStreamingToVendor(context.Background(), "openai", newRequest())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if chunks := drainStream(t, resp); strings.Join(chunks, "") != "Mock streaming response" {
+			t.Errorf("Expected the streamed content, got %q", chunks)
+		}
+		recorded := recorder.Recorded()
+		if len(recorded) != 1 || recorded[0].Content != "Mock streaming response" || recorded[0].Vendor != "openai" {
+			t.Errorf("Expected the stream recorded, got %+v", recorded)
+		}
+	})
+
+	t.Run("record failed", func(t *testing.T) {
+		recorder := &switchableRecorder{}
+		recorder.fail.Store(true)
+		dispatcher := NewWithConfig(&models.Config{Recorder: recorder, FailClosedOnRecordError: true})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, supportsStreaming: true})
+
+		resp, err := dispatcher.SendStreaming(context.Background(), newRequest())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var content string
+		for done := false; !done; {
+			select {
+			case chunk, ok := <-resp.ContentChan:
+				if !ok {
+					t.Fatal("Expected the stream to fail, got it closed")
+				}
+				content += chunk
+			case err := <-resp.ErrorChan:
+				if !errors.Is(err, models.ErrAuditFailed) {
+					t.Errorf("Expected ErrAuditFailed, got %v", err)
+				}
+				done = true
+			case <-resp.DoneChan:
+				t.Fatal("Expected the unrecorded stream to fail, got done")
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for stream")
+			}
+		}
+		if content != "" {
+			t.Errorf("Expected no content before the stream was recorded, got %q", content)
+		}
+	})
+
+	t.Run("unary fallback", func(t *testing.T) {
+		recorder := &switchableRecorder{}
+		recorder.fail.Store(true)
+		dispatcher := NewWithConfig(&models.Config{
+			Recorder:                 recorder,
+			FailClosedOnRecordError:  true,
+			FallbackToUnaryStreaming: true,
+		})
+		dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "Hello!"}})
+
+		if _, err := dispatcher.SendStreamingToVendor(context.Background(), "openai", newRequest()); !errors.Is(err, models.ErrAuditFailed) {
+			t.Errorf("Expected ErrAuditFailed, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_ConcurrentRegisterVendor(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{})
+	dispatcher.logger = &stdLogger{logger: log.New(io.Discard, "", 0)}
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}})
+
+	req := &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := dispatcher.Send(context.Background(), req); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				dispatcher.GetVendors()
+				dispatcher.GetVendorStatuses(context.Background())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				name := fmt.Sprintf("vendor-%d-%d", i, j)
+				if err := dispatcher.RegisterVendor(&MockVendor{name: name, available: true, response: &models.Response{Content: "ok"}}); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				if _, exists := dispatcher.GetVendor(name); !exists {
+					t.Errorf("Expected %s to be registered", name)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(dispatcher.GetVendors()); got != 101 {
+		t.Errorf("Expected 101 vendors, got %d", got)
+	}
+}
+
+func TestDispatcher_DeregisterVendor(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{})
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{Content: "from openai", Vendor: "openai"}})
+	dispatcher.RegisterVendor(&MockVendor{name: "anthropic", available: true, response: &models.Response{Content: "from anthropic", Vendor: "anthropic"}})
+
+	if err := dispatcher.DeregisterVendor("openai"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, exists := dispatcher.GetVendor("openai"); exists {
+		t.Error("Expected the deregistered vendor to be gone")
+	}
+	if vendors := dispatcher.GetVendors(); len(vendors) != 1 || vendors[0] != "anthropic" {
+		t.Errorf("Expected only anthropic to remain, got %v", vendors)
+	}
+
+	req := &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+	for i := 0; i < 10; i++ {
+		resp, err := dispatcher.Send(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.Vendor != "anthropic" {
+			t.Fatalf("Expected the remaining vendor to be selected, got %s", resp.Vendor)
+		}
+	}
+	if _, err := dispatcher.SendToVendor(context.Background(), "openai", req); err == nil {
+		t.Error("Expected sending to the deregistered vendor to fail")
+	}
+
+	if err := dispatcher.DeregisterVendor("openai"); !errors.Is(err, models.ErrVendorNotFound) {
+		t.Errorf("Expected ErrVendorNotFound deregistering twice, got %v", err)
+	}
+}
+
+func TestDispatcher_ExplicitMaxTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxTokens     int
+		wantMaxTokens int
+	}{
+		{name: "unset takes the mode default", maxTokens: 0, wantMaxTokens: 150},
+		{name: "explicit limit survives", maxTokens: 4096, wantMaxTokens: 4096},
+		{name: "large explicit limit survives", maxTokens: 128000, wantMaxTokens: 128000},
+		{name: "vendor default sends no limit", maxTokens: models.MaxTokensVendorDefault, wantMaxTokens: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode})
+			vendor := &capturingVendor{MockVendor: MockVendor{
+				name:      "openai",
+				available: true,
+				response:  &models.Response{Content: "ok"},
+			}}
+			dispatcher.RegisterVendor(vendor)
+
+			req := &models.Request{
+				Model:     "gpt-3.5-turbo",
+				Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+				MaxTokens: tt.maxTokens,
+			}
+			if _, err := dispatcher.Send(context.Background(), req); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := vendor.LastRequest().MaxTokens; got != tt.wantMaxTokens {
+				t.Errorf("Expected the vendor to receive max tokens %d, got %d", tt.wantMaxTokens, got)
+			}
+			if req.MaxTokens != tt.maxTokens {
+				t.Errorf("Expected the caller's request to keep max tokens %d, got %d", tt.maxTokens, req.MaxTokens)
+			}
+		})
+	}
+}
+
+func TestDispatcher_FallbackVendor(t *testing.T) {
+	tests := []struct {
+		name           string
+		fallbackVendor string
+		primaryFails   bool
+		wantVendor     string
+		wantErr        bool
+	}{
+		{name: "primary fails", fallbackVendor: "backup", primaryFails: true, wantVendor: "backup"},
+		{name: "primary succeeds", fallbackVendor: "backup", wantVendor: "primary"},
+		{name: "fallback is the primary", fallbackVendor: "primary", primaryFails: true, wantErr: true},
+		{name: "no fallback", primaryFails: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				Mode:           models.FastMode,
+				FallbackVendor: tt.fallbackVendor,
+				ModeOverrides: &models.ModeOverrides{
+					VendorPreferences: map[models.Mode][]string{models.FastMode: {"primary"}},
+				},
+			})
+			primary := &capturingVendor{MockVendor: MockVendor{name: "primary", available: true, shouldFail: tt.primaryFails, response: &models.Response{Content: "primary", Vendor: "primary"}}}
+			backup := &capturingVendor{MockVendor: MockVendor{name: "backup", available: true, response: &models.Response{Content: "backup", Vendor: "backup"}}}
+			dispatcher.RegisterVendor(primary)
+			dispatcher.RegisterVendor(backup)
+
+			resp, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected the primary's error, got %+v", resp)
+				}
+				if backup.Calls() != 0 {
+					t.Errorf("Expected no fallback attempt, got %d", backup.Calls())
+				}
+				if primary.Calls() != 1 {
+					t.Errorf("Expected the primary to be tried once, got %d calls", primary.Calls())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if resp.Vendor != tt.wantVendor {
+				t.Errorf("Expected a response from %s, got %s", tt.wantVendor, resp.Vendor)
+			}
+
+			stats := dispatcher.GetStats().VendorStats
+			if tt.primaryFails {
+				if stats["primary"].Failures != 1 || stats["backup"].Successes != 1 {
+					t.Errorf("Expected the failure under primary and the success under backup, got %+v and %+v", stats["primary"], stats["backup"])
+				}
+			} else if backup.Calls() != 0 {
+				t.Errorf("Expected no fallback when the primary succeeds, got %d calls", backup.Calls())
+			}
+		})
+	}
+}
+
+// rateLimitedVendor is a MockVendor reporting a configured RateLimit
+type rateLimitedVendor struct {
+	MockVendor
+	limit models.RateLimit
+}
+
+func (v *rateLimitedVendor) RateLimit() models.RateLimit {
+	return v.limit
+}
+
+func TestDispatcher_RateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     models.RateLimit
+		maxTokens int
+		allowed   int
+	}{
+		{name: "requests per minute", limit: models.RateLimit{RequestsPerMinute: 2}, maxTokens: 10, allowed: 2},
+		{name: "tokens per minute", limit: models.RateLimit{TokensPerMinute: 100}, maxTokens: 40, allowed: 2},
+		{name: "both limits", limit: models.RateLimit{RequestsPerMinute: 3, TokensPerMinute: 1000}, maxTokens: 10, allowed: 3},
+		{name: "no limit", maxTokens: 1000, allowed: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			dispatcher.RegisterVendor(&rateLimitedVendor{MockVendor: MockVendor{name: "limited", available: true}, limit: tt.limit})
+
+			req := &models.Request{
+				Model:     "test-model",
+				Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+				MaxTokens: tt.maxTokens,
+			}
+			for i := 0; i < 5; i++ {
+				_, err := dispatcher.Send(context.Background(), req)
+				if i < tt.allowed && err != nil {
+					t.Fatalf("Expected request %d to be allowed, got %v", i+1, err)
+				}
+				if i >= tt.allowed && !errors.Is(err, models.ErrRateLimitExceeded) {
+					t.Fatalf("Expected request %d to be rate limited, got %v", i+1, err)
+				}
+			}
+
+			if got := dispatcher.GetStats().SuccessfulRequests; got != int64(tt.allowed) {
+				t.Errorf("Expected %d successful requests, got %d", tt.allowed, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_RateLimit_CountsTokensOnlyForTokenLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  models.RateLimit
+		counts int
+	}{
+		{name: "no limit", counts: 0},
+		{name: "requests per minute", limit: models.RateLimit{RequestsPerMinute: 10}, counts: 0},
+		{name: "tokens per minute", limit: models.RateLimit{TokensPerMinute: 1000}, counts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			vendor := &rateLimitedVendor{MockVendor: MockVendor{name: "limited", available: true}, limit: tt.limit}
+
+			counts := 0
+			tokens := func() int {
+				counts++
+				return 10
+			}
+			if err := dispatcher.waitForRateLimit(context.Background(), vendor, tokens); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if counts != tt.counts {
+				t.Errorf("Expected the tokens to be counted %d times, got %d", tt.counts, counts)
+			}
+		})
+	}
+}
+
+func TestDispatcher_RateLimit_Wait(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{WaitForRateLimit: true})
+	// 100 tokens a second, so a request draining the bucket makes the
+	// next one wait about a tenth of a second for its tokens
+	dispatcher.RegisterVendor(&rateLimitedVendor{MockVendor: MockVendor{name: "limited", available: true}, limit: models.RateLimit{TokensPerMinute: 6000}})
+
+	drain := &models.Request{Model: "test-model", Messages: []models.Message{{Role: "user", Content: "Hello"}}, MaxTokens: 6000}
+	if _, err := dispatcher.Send(context.Background(), drain); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	small := &models.Request{Model: "test-model", Messages: []models.Message{{Role: "user", Content: "Hello"}}, MaxTokens: 10}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := dispatcher.Send(ctx, small); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait to end with the context, got %v", err)
+	}
+
+	start := time.Now()
+	if _, err := dispatcher.Send(context.Background(), small); err != nil {
+		t.Fatalf("Expected the request to go through after waiting, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the request to wait for tokens, it took %v", elapsed)
+	}
+}
+
+func TestDispatcher_RateLimit_Streaming(t *testing.T) {
+	dispatcher := New()
+	dispatcher.RegisterVendor(&rateLimitedVendor{MockVendor: MockVendor{name: "limited", available: true, supportsStreaming: true}, limit: models.RateLimit{RequestsPerMinute: 1}})
+
+	req := &models.Request{Model: "test-model", Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+	stream, err := dispatcher.SendStreaming(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stream.Close()
+
+	if _, err := dispatcher.SendStreaming(context.Background(), req); !errors.Is(err, models.ErrRateLimitExceeded) {
+		t.Errorf("Expected the second stream to be rate limited, got %v", err)
+	}
+}
+
+func TestDispatcher_CircuitBreaker(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{
+		Mode:           models.FastMode,
+		FallbackVendor: "backup",
+		CircuitBreaker: &models.CircuitBreakerConfig{FailureThreshold: 2, Cooldown: time.Minute},
+		ModeOverrides: &models.ModeOverrides{
+			VendorPreferences: map[models.Mode][]string{models.FastMode: {"primary", "backup"}},
+		},
+	})
+	primary := &flakyVendor{MockVendor: MockVendor{name: "primary", available: true}, err: &models.VendorError{Vendor: "primary", StatusCode: http.StatusServiceUnavailable}, failures: 2}
+	backup := &capturingVendor{MockVendor: MockVendor{name: "backup", available: true, response: &models.Response{Content: "backup", Vendor: "backup"}}}
+	dispatcher.RegisterVendor(primary)
+	dispatcher.RegisterVendor(backup)
+
+	req := &models.Request{Model: "gpt-3.5-turbo", Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+	send := func() {
+		t.Helper()
+		if _, err := dispatcher.Send(context.Background(), req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	state := func() models.CircuitState {
+		return dispatcher.GetStats().CircuitBreakers["primary"].State
+	}
+
+	send()
+	if state() != models.CircuitClosed {
+		t.Errorf("Expected the circuit to stay closed after one failure, got %s", state())
+	}
+	send()
+	if state() != models.CircuitOpen {
+		t.Fatalf("Expected the circuit to open after two failures, got %s", state())
+	}
+
+	send()
+	if primary.calls != 2 {
+		t.Errorf("Expected the primary to be skipped while its circuit is open, got %d calls", primary.calls)
+	}
+	if backup.Calls() != 3 {
+		t.Errorf("Expected the backup to answer every request, got %d calls", backup.Calls())
+	}
+
+	// Past the cooldown the primary gets a probe, which succeeds
+	dispatcher.circuitBreakers.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if state() != models.CircuitHalfOpen {
+		t.Errorf("Expected the circuit to half-open after the cooldown, got %s", state())
+	}
+	send()
+	if primary.calls != 3 {
+		t.Errorf("Expected the primary to be probed, got %d calls", primary.calls)
+	}
+	if state() != models.CircuitClosed {
+		t.Errorf("Expected a successful probe to close the circuit, got %s", state())
+	}
+}
+
+func TestDispatcher_Send_FallbackCountsRequestOnce(t *testing.T) {
+	newDispatcher := func(backupFails bool) *Dispatcher {
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:           models.FastMode,
+			FallbackVendor: "backup",
+			ModeOverrides: &models.ModeOverrides{
+				VendorPreferences: map[models.Mode][]string{models.FastMode: {"primary", "backup"}},
+			},
+		})
+		dispatcher.RegisterVendor(&latencyVendor{MockVendor: MockVendor{name: "primary", available: true, shouldFail: true}, delay: 50 * time.Millisecond})
+		dispatcher.RegisterVendor(&MockVendor{name: "backup", available: true, shouldFail: backupFails, response: &models.Response{Content: "backup", Vendor: "backup"}})
+		return dispatcher
+	}
+	req := func() *models.Request {
+		return &models.Request{Model: "test-model", Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+	}
+
+	tests := []struct {
+		name        string
+		backupFails bool
+		successful  int64
+		failed      int64
+	}{
+		{"fallback succeeds", false, 1, 0},
+		{"every vendor fails", true, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := newDispatcher(tt.backupFails)
+			if _, err := dispatcher.Send(context.Background(), req()); (err != nil) != tt.backupFails {
+				t.Fatalf("Expected error %v, got %v", tt.backupFails, err)
+			}
+
+			stats := dispatcher.GetStats()
+			if stats.TotalRequests != 1 || stats.SuccessfulRequests != tt.successful || stats.FailedRequests != tt.failed {
+				t.Errorf("Expected 1 total, %d successful and %d failed, got %d, %d and %d",
+					tt.successful, tt.failed, stats.TotalRequests, stats.SuccessfulRequests, stats.FailedRequests)
+			}
+			if stats.VendorStats["primary"].Failures != 1 {
+				t.Errorf("Expected 1 primary failure, got %d", stats.VendorStats["primary"].Failures)
+			}
+			if backup := stats.VendorStats["backup"]; backup.Requests != 1 || (backup.Failures == 1) != tt.backupFails {
+				t.Errorf("Expected 1 backup request, failed %v, got %+v", tt.backupFails, backup)
+			}
+
+			// The request's latency includes the primary's, the backup's
+			// only its own call
+			if stats.AverageLatency < 50*time.Millisecond {
+				t.Errorf("Expected a request latency of at least 50ms, got %v", stats.AverageLatency)
+			}
+			if latency := stats.VendorStats["backup"].AverageLatency; latency >= 50*time.Millisecond {
+				t.Errorf("Expected a backup latency under 50ms, got %v", latency)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	failure := &models.VendorError{Vendor: "vendor", StatusCode: http.StatusInternalServerError}
+	tests := []struct {
+		name     string
+		config   models.CircuitBreakerConfig
+		outcomes []error
+		gaps     time.Duration
+		want     models.CircuitState
+	}{
+		{name: "below threshold", config: models.CircuitBreakerConfig{FailureThreshold: 3}, outcomes: []error{failure, failure}, want: models.CircuitClosed},
+		{name: "at threshold", config: models.CircuitBreakerConfig{FailureThreshold: 3}, outcomes: []error{failure, failure, failure}, want: models.CircuitOpen},
+		{name: "success resets the count", config: models.CircuitBreakerConfig{FailureThreshold: 2}, outcomes: []error{failure, nil, failure}, want: models.CircuitClosed},
+		{name: "cancelled calls are ignored", config: models.CircuitBreakerConfig{FailureThreshold: 2}, outcomes: []error{failure, context.Canceled, failure}, want: models.CircuitOpen},
+		{name: "failures outside the window", config: models.CircuitBreakerConfig{FailureThreshold: 2, Window: time.Second}, outcomes: []error{failure, failure}, gaps: 2 * time.Second, want: models.CircuitClosed},
+		{name: "failures within the window", config: models.CircuitBreakerConfig{FailureThreshold: 2, Window: time.Second}, outcomes: []error{failure, failure}, gaps: 100 * time.Millisecond, want: models.CircuitOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakers := newCircuitBreakers(&tt.config)
+			now := time.Now()
+			breakers.now = func() time.Time { return now }
+			for _, err := range tt.outcomes {
+				breakers.record(context.Background(), "vendor", err)
+				now = now.Add(tt.gaps)
+			}
+			if got := breakers.stats()["vendor"].State; got != tt.want {
+				t.Errorf("Expected the circuit to be %s, got %s", tt.want, got)
+			}
+			if got := breakers.allows("vendor"); got != (tt.want != models.CircuitOpen) {
+				t.Errorf("Expected allows to be %v, got %v", tt.want != models.CircuitOpen, got)
+			}
+		})
+	}
+
+	t.Run("failed probe reopens", func(t *testing.T) {
+		breakers := newCircuitBreakers(&models.CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Minute})
+		now := time.Now()
+		breakers.now = func() time.Time { return now }
+		breakers.record(context.Background(), "vendor", failure)
+
+		now = now.Add(time.Minute)
+		if !breakers.allows("vendor") {
+			t.Fatal("Expected the vendor to be allowed a probe after the cooldown")
+		}
+		breakers.record(context.Background(), "vendor", failure)
+		if breakers.allows("vendor") {
+			t.Error("Expected a failed probe to reopen the circuit")
+		}
+	})
+
+	t.Run("one probe at a time", func(t *testing.T) {
+		breakers := newCircuitBreakers(&models.CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Minute})
+		now := time.Now()
+		breakers.now = func() time.Time { return now }
+		breakers.record(context.Background(), "vendor", failure)
+
+		now = now.Add(time.Minute)
+		if err := breakers.acquire("vendor"); err != nil {
+			t.Fatalf("Expected the first probe to be allowed, got %v", err)
+		}
+		if breakers.allows("vendor") {
+			t.Error("Expected the vendor not to be selected while its probe is in flight")
+		}
+		if err := breakers.acquire("vendor"); !errors.Is(err, models.ErrVendorUnavailable) {
+			t.Errorf("Expected a second probe to be refused, got %v", err)
+		}
+
+		breakers.record(context.Background(), "vendor", nil)
+		if err := breakers.acquire("vendor"); err != nil {
+			t.Errorf("Expected a successful probe to close the circuit, got %v", err)
+		}
+	})
+}
+
+func TestIsVendorFailure(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"server error", context.Background(), &models.VendorError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", context.Background(), &models.VendorError{StatusCode: http.StatusTooManyRequests}, true},
+		{"vendor timeout", context.Background(), &models.VendorError{StatusCode: http.StatusRequestTimeout}, true},
+		{"network error", context.Background(), fmt.Errorf("failed to send request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"client timeout", context.Background(), fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), true},
+		{"interrupted stream", context.Background(), fmt.Errorf("%w: unexpected EOF", models.ErrStreamInterrupted), true},
+		{"bad request", context.Background(), &models.VendorError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", context.Background(), &models.VendorError{StatusCode: http.StatusUnauthorized}, false},
+		{"invalid request", context.Background(), fmt.Errorf("%w: no messages", models.ErrInvalidRequest), false},
+		{"payload too large", context.Background(), &models.PayloadTooLargeError{Vendor: "vendor"}, false},
+		{"cancelled", context.Background(), context.Canceled, false},
+		{"caller deadline", expired, context.DeadlineExceeded, false},
+		{"unclassified", context.Background(), errors.New("unexpected response"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isVendorFailure(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_CircuitBreaker_AllOpen(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{CircuitBreaker: &models.CircuitBreakerConfig{FailureThreshold: 1}})
+	dispatcher.RegisterVendor(&flakyVendor{
+		MockVendor: MockVendor{name: "broken", available: true},
+		err:        &models.VendorError{Vendor: "broken", StatusCode: http.StatusInternalServerError},
+		failures:   1,
+	})
+
+	req := &models.Request{Model: "test-model", Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+	if _, err := dispatcher.Send(context.Background(), req); err == nil {
+		t.Fatal("Expected the vendor's error")
+	}
+	if _, err := dispatcher.Send(context.Background(), req); !errors.Is(err, models.ErrVendorUnavailable) {
+		t.Errorf("Expected ErrVendorUnavailable with every circuit open, got %v", err)
+	}
+}
+
+func TestDispatcher_LRUTieBreak(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode, LRUTieBreak: true})
+	// Neither vendor is in fast mode's priority list, so they tie
+	dispatcher.RegisterVendor(&MockVendor{name: "alpha", available: true, response: &models.Response{Content: "alpha", Vendor: "alpha"}})
+	dispatcher.RegisterVendor(&MockVendor{name: "beta", available: true, response: &models.Response{Content: "beta", Vendor: "beta"}})
+
+	var vendors []string
+	for i := 0; i < 4; i++ {
+		resp, err := dispatcher.Send(context.Background(), &models.Request{
+			Model:    "test-model",
+			Messages: []models.Message{{Role: "user", Content: "Hello"}},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		vendors = append(vendors, resp.Vendor)
+	}
+
+	if expected := []string{"alpha", "beta", "alpha", "beta"}; !reflect.DeepEqual(vendors, expected) {
+		t.Errorf("Expected requests to alternate as %v, got %v", expected, vendors)
+	}
+}
+
+func TestDispatcher_NormalizeStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		stop     []string
+		expected []string
+	}{
+		{name: "duplicates", stop: []string{"END", "\n\n", "END"}, expected: []string{"END", "\n\n"}},
+		{name: "empty entries", stop: []string{"", "END", ""}, expected: []string{"END"}},
+		{name: "only empty entries", stop: []string{"", ""}, expected: nil},
+		{name: "whitespace is kept", stop: []string{" ", "\n"}, expected: []string{" ", "\n"}},
+		{name: "none", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := New()
+			vendor := &capturingVendor{MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}}}
+			dispatcher.RegisterVendor(vendor)
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+				Stop:     tt.stop,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := vendor.LastRequest().Stop; !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected stop %q to be sent, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDispatcher_RetryAfter(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{
+		RetryPolicy: &models.RetryPolicy{MaxRetries: 1, BackoffStrategy: models.ExponentialBackoff},
+	})
+	// The policy would wait a second; the vendor asks for much less
+	vendor := &flakyVendor{
+		MockVendor: MockVendor{name: "test-vendor", available: true, response: &models.Response{Content: "ok"}},
+		err:        &models.VendorError{Vendor: "test-vendor", StatusCode: http.StatusTooManyRequests, Message: "rate limit exceeded", RetryAfter: 50 * time.Millisecond},
+		failures:   1,
+	}
+	dispatcher.RegisterVendor(vendor)
+
+	start := time.Now()
+	_, err := dispatcher.Send(context.Background(), &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if vendor.calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", vendor.calls)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the retry to wait for Retry-After, took %v", elapsed)
+	}
+}
+
+func TestDispatcher_UnknownVendorModelPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     models.UnknownModelPolicy
+		model      string
+		wantVendor string
+		wantErr    bool
+	}{
+		{name: "default forwards", model: "new-model", wantVendor: "primary"},
+		{name: "forward", policy: models.UnknownModelForward, model: "new-model", wantVendor: "primary"},
+		{name: "error", policy: models.UnknownModelError, model: "new-model", wantErr: true},
+		{name: "fallback", policy: models.UnknownModelFallback, model: "new-model", wantVendor: "backup"},
+		{name: "fallback without a vendor listing the model", policy: models.UnknownModelFallback, model: "unlisted-model", wantErr: true},
+		{name: "listed model", policy: models.UnknownModelError, model: "old-model", wantVendor: "primary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				Mode:                     models.FastMode,
+				UnknownVendorModelPolicy: tt.policy,
+				ModeOverrides: &models.ModeOverrides{
+					VendorPreferences: map[models.Mode][]string{models.FastMode: {"primary"}},
+				},
+			})
+			primary := &capturingVendor{MockVendor: MockVendor{name: "primary", available: true, capabilities: models.Capabilities{Models: []string{"old-model"}}, response: &models.Response{Vendor: "primary"}}}
+			backup := &capturingVendor{MockVendor: MockVendor{name: "backup", available: true, capabilities: models.Capabilities{Models: []string{"old-model", "new-model"}}, response: &models.Response{Vendor: "backup"}}}
+			dispatcher.RegisterVendor(primary)
+			dispatcher.RegisterVendor(backup)
+
+			resp, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:    tt.model,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if tt.wantErr {
+				if !errors.Is(err, models.ErrModelNotOffered) {
+					t.Fatalf("Expected ErrModelNotOffered, got %v", err)
+				}
+				if primary.Calls()+backup.Calls() != 0 {
+					t.Errorf("Expected no vendor to be called, got %d calls", primary.Calls()+backup.Calls())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if resp.Vendor != tt.wantVendor {
+				t.Errorf("Expected the request to go to %s, got %s", tt.wantVendor, resp.Vendor)
+			}
+		})
+	}
+}
+
+func TestCalculateBackoff_Jitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		jitter   models.JitterStrategy
+		min      func(backoff time.Duration) time.Duration
+		wantMean float64 // as a fraction of the backoff
+	}{
+		{name: "full", jitter: models.FullJitter, min: func(time.Duration) time.Duration { return 0 }, wantMean: 0.5},
+		{name: "equal", jitter: models.EqualJitter, min: func(backoff time.Duration) time.Duration { return backoff / 2 }, wantMean: 0.75},
+	}
+
+	const samples = 2000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &Dispatcher{
+				config: &models.Config{
+					RetryPolicy: &models.RetryPolicy{BackoffStrategy: models.ExponentialBackoff, Jitter: tt.jitter},
+				},
+				routingRand: newRoutingRand(42),
+			}
+
+			for attempt, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+				var total time.Duration
+				distinct := make(map[time.Duration]bool)
+				for i := 0; i < samples; i++ {
+					delay := dispatcher.calculateBackoff(attempt + 1)
+					if delay < tt.min(backoff) || delay > backoff {
+						t.Fatalf("Attempt %d: delay %v outside [%v, %v]", attempt+1, delay, tt.min(backoff), backoff)
+					}
+					total += delay
+					distinct[delay] = true
+				}
+
+				mean := float64(total) / samples / float64(backoff)
+				if math.Abs(mean-tt.wantMean) > 0.05 {
+					t.Errorf("Attempt %d: expected a mean of %.2f of the backoff, got %.3f", attempt+1, tt.wantMean, mean)
+				}
+				if len(distinct) < samples/2 {
+					t.Errorf("Attempt %d: expected varied delays, got %d distinct of %d", attempt+1, len(distinct), samples)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_UpdateStats_CumulativeAverages(t *testing.T) {
+	dispatcher := &Dispatcher{
+		stats: &models.DispatcherStats{
+			VendorStats: make(map[string]models.VendorStats),
+		},
+	}
+
+	// A running (avg + latency) / 2 would give 375ms and weigh the last
+	// request most
+	latencies := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 600 * time.Millisecond}
+	costs := []float64{0.01, 0.02, 0.06}
+	for i, latency := range latencies {
+		dispatcher.updateStats(true, "test-vendor", latency, costs[i])
+	}
+	dispatcher.updateStats(false, "other-vendor", 500*time.Millisecond, 0)
+	// Failed calls incur no cost and don't lower the mean
+	dispatcher.updateVendorStats(false, "test-vendor", 0)
+
+	vendorStats := dispatcher.stats.VendorStats["test-vendor"]
+	if vendorStats.AverageLatency != 225*time.Millisecond {
+		t.Errorf("Expected a vendor mean latency of 225ms, got %v", vendorStats.AverageLatency)
+	}
+	if math.Abs(vendorStats.AverageCost-0.03) > 1e-9 {
+		t.Errorf("Expected a vendor mean cost of 0.03, got %v", vendorStats.AverageCost)
+	}
+	if math.Abs(dispatcher.stats.AverageCost-0.03) > 1e-9 || dispatcher.stats.CostSamples != 3 {
+		t.Errorf("Expected a global mean cost of 0.03 over 3 responses, got %v over %d", dispatcher.stats.AverageCost, dispatcher.stats.CostSamples)
+	}
+	if dispatcher.stats.AverageLatency != 350*time.Millisecond {
+		t.Errorf("Expected a global mean latency of 350ms, got %v", dispatcher.stats.AverageLatency)
+	}
+	if dispatcher.stats.LatencySamples != 4 {
+		t.Errorf("Expected 4 latency samples, got %d", dispatcher.stats.LatencySamples)
+	}
+}
+
+// scriptedVendor answers with its responses in turn, repeating the last,
+// and records the requests it gets
+type scriptedVendor struct {
+	MockVendor
+	responses []*models.Response
+	mu        sync.Mutex
+	requests  []*models.Request
+}
+
+func (v *scriptedVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.requests = append(v.requests, req.Clone())
+	response := *v.responses[min(len(v.requests), len(v.responses))-1]
+	return &response, nil
+}
+
+// toolExecutorFunc runs tool calls with a function
+type toolExecutorFunc func(ctx context.Context, call models.ToolCall) (string, error)
+
+func (f toolExecutorFunc) Execute(ctx context.Context, call models.ToolCall) (string, error) {
+	return f(ctx, call)
+}
+
+func TestDispatcher_RunToolLoop(t *testing.T) {
+	weatherCall := func(id string) *models.Response {
+		return &models.Response{
+			Content:      "Checking.",
+			FinishReason: "tool_calls",
+			ToolCalls:    []models.ToolCall{{ID: id, Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			Usage:        models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		}
+	}
+	answer := &models.Response{
+		Content:      "It is 18C and sunny in Paris.",
+		FinishReason: "stop",
+		Usage:        models.Usage{PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40},
+	}
+	newRequest := func() *models.Request {
+		return &models.Request{
+			Model:      "gpt-4o",
+			Messages:   []models.Message{{Role: "user", Content: "What's the weather in Paris?"}},
+			Tools:      []models.Tool{{Name: "get_weather"}},
+			ToolChoice: "get_weather",
+		}
+	}
+
+	t.Run("answers after tool calls", func(t *testing.T) {
+		dispatcher := New()
+		vendor := &scriptedVendor{MockVendor: MockVendor{name: "test-vendor", available: true}, responses: []*models.Response{weatherCall("call_1"), weatherCall("call_2"), answer}}
+		dispatcher.RegisterVendor(vendor)
+
+		var executed []string
+		executor := toolExecutorFunc(func(ctx context.Context, call models.ToolCall) (string, error) {
+			executed = append(executed, call.ID)
+			return "18C and sunny", nil
+		})
+
+		req := newRequest()
+		resp, err := dispatcher.RunToolLoop(context.Background(), req, executor, 3)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.Content != answer.Content {
+			t.Errorf("Expected the final answer, got %q", resp.Content)
+		}
+		if expected := (models.Usage{PromptTokens: 50, CompletionTokens: 20, TotalTokens: 70}); resp.Usage != expected {
+			t.Errorf("Expected usage summed over the rounds %+v, got %+v", expected, resp.Usage)
+		}
+		if !reflect.DeepEqual(executed, []string{"call_1", "call_2"}) {
+			t.Errorf("Expected both calls to be executed, got %v", executed)
+		}
+
+		last := vendor.requests[len(vendor.requests)-1]
+		if len(last.Messages) != 5 {
+			t.Fatalf("Expected the history to carry both rounds, got %+v", last.Messages)
+		}
+		if call := last.Messages[1]; call.Role != "assistant" || call.Content != "Checking." || len(call.ToolCalls) != 1 {
+			t.Errorf("Expected the assistant's turn with its tool call, got %+v", call)
+		}
+		if result := last.Messages[4]; result.Role != "tool" || result.ToolCallID != "call_2" || result.Content != "18C and sunny" {
+			t.Errorf("Expected the second tool result, got %+v", result)
+		}
+		if vendor.requests[0].ToolChoice != "get_weather" || last.ToolChoice != "" {
+			t.Errorf("Expected the forced tool choice on the first round only, got %q then %q", vendor.requests[0].ToolChoice, last.ToolChoice)
+		}
+		if len(req.Messages) != 1 {
+			t.Errorf("Expected the caller's request to be left alone, got %d messages", len(req.Messages))
+		}
+	})
+
+	t.Run("stops at the limit", func(t *testing.T) {
+		dispatcher := New()
+		vendor := &scriptedVendor{MockVendor: MockVendor{name: "test-vendor", available: true}, responses: []*models.Response{weatherCall("call_1")}}
+		dispatcher.RegisterVendor(vendor)
+
+		executor := toolExecutorFunc(func(ctx context.Context, call models.ToolCall) (string, error) {
+			return "18C and sunny", nil
+		})
+		resp, err := dispatcher.RunToolLoop(context.Background(), newRequest(), executor, 2)
+		if !errors.Is(err, models.ErrToolRoundsExceeded) {
+			t.Fatalf("Expected ErrToolRoundsExceeded, got %v", err)
+		}
+		if resp == nil || len(resp.ToolCalls) != 1 {
+			t.Fatalf("Expected the last response with its pending tool calls, got %+v", resp)
+		}
+		if len(vendor.requests) != 3 {
+			t.Errorf("Expected the model to be called 3 times, got %d", len(vendor.requests))
+		}
+		if resp.Usage.TotalTokens != 45 {
+			t.Errorf("Expected the usage of all 3 calls, got %d", resp.Usage.TotalTokens)
+		}
+	})
+
+	t.Run("tool failure", func(t *testing.T) {
+		dispatcher := New()
+		dispatcher.RegisterVendor(&scriptedVendor{MockVendor: MockVendor{name: "test-vendor", available: true}, responses: []*models.Response{weatherCall("call_1"), answer}})
+
+		failure := errors.New("weather service down")
+		executor := toolExecutorFunc(func(ctx context.Context, call models.ToolCall) (string, error) {
+			return "", failure
+		})
+		if _, err := dispatcher.RunToolLoop(context.Background(), newRequest(), executor, 3); !errors.Is(err, failure) {
+			t.Errorf("Expected the tool's error, got %v", err)
+		}
+	})
+
+	t.Run("invalid rounds", func(t *testing.T) {
+		executor := toolExecutorFunc(func(ctx context.Context, call models.ToolCall) (string, error) { return "", nil })
+		if _, err := New().RunToolLoop(context.Background(), newRequest(), executor, 0); !errors.Is(err, models.ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_Send_NoStdout(t *testing.T) {
+	dispatcher := New()
+	dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", available: true})
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	_, sendErr := dispatcher.Send(context.Background(), &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	w.Close()
+	os.Stdout = stdout
+	written, _ := io.ReadAll(r)
+
+	if sendErr != nil {
+		t.Fatalf("Expected no error, got %v", sendErr)
+	}
+	if len(written) > 0 {
+		t.Errorf("Expected nothing written to stdout, got %q", written)
+	}
+}
+
+func TestDispatcher_LogLevel(t *testing.T) {
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	tests := []struct {
+		name          string
+		config        *models.Config
+		expectDebug   bool
+		expectAnyLogs bool
+	}{
+		{"default", &models.Config{EnableLogging: true}, false, true},
+		{"debug", &models.Config{EnableLogging: true, LogLevel: models.LogLevelDebug}, true, true},
+		{"debug without logging", &models.Config{LogLevel: models.LogLevelDebug}, false, true},
+		{"none", &models.Config{EnableLogging: true, LogLevel: models.LogLevelNone}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			output := log.Writer()
+			log.SetOutput(&logs)
+			defer log.SetOutput(output)
+
+			dispatcher := NewWithConfig(tt.config)
+			dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", available: true})
+			if _, err := dispatcher.Send(context.Background(), req); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if debug := strings.Contains(logs.String(), "DEBUG: Validating request"); debug != tt.expectDebug {
+				t.Errorf("Expected debug logged %v, got logs %q", tt.expectDebug, logs.String())
+			}
+			if (logs.Len() > 0) != tt.expectAnyLogs {
+				t.Errorf("Expected logs %v, got %q", tt.expectAnyLogs, logs.String())
+			}
+		})
+	}
+}
+
+// hangingVendor's availability check blocks, ignoring its context, until
+// release is closed
+type hangingVendor struct {
+	MockVendor
+	release chan struct{}
+}
+
+func (v *hangingVendor) IsAvailable(ctx context.Context) bool {
+	<-v.release
+	return true
+}
+
+func TestDispatcher_AvailabilityCheckTimeout(t *testing.T) {
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	t.Run("selects another vendor", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                     models.FastMode,
+			AvailabilityCheckTimeout: 50 * time.Millisecond,
+			ModeOverrides: &models.ModeOverrides{
+				VendorPreferences: map[models.Mode][]string{models.FastMode: {"hanging", "healthy"}},
+			},
+		})
+		dispatcher.RegisterVendor(&hangingVendor{MockVendor: MockVendor{name: "hanging", available: true}, release: release})
+		dispatcher.RegisterVendor(&MockVendor{name: "healthy", available: true, response: &models.Response{Content: "Hi", Vendor: "healthy"}})
+
+		start := time.Now()
+		resp, err := dispatcher.Send(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.Vendor != "healthy" {
+			t.Errorf("Expected the healthy vendor, got %s", resp.Vendor)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected selection bounded by the timeout, took %v", elapsed)
+		}
+	})
+
+	t.Run("fallback vendors", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		dispatcher := NewWithConfig(&models.Config{
+			Mode:                     models.FastMode,
+			AvailabilityCheckTimeout: 50 * time.Millisecond,
+			FallbackVendor:           "hanging",
+			StreamingFallbackVendor:  "hanging",
+			ModeOverrides: &models.ModeOverrides{
+				VendorPreferences: map[models.Mode][]string{models.FastMode: {"failing"}},
+			},
+		})
+		hanging := &hangingVendor{MockVendor: MockVendor{name: "hanging", available: true}, release: release}
+		dispatcher.RegisterVendor(hanging)
+		dispatcher.RegisterVendor(&MockVendor{name: "failing", available: true, shouldFail: true})
+
+		start := time.Now()
+		if _, err := dispatcher.Send(context.Background(), req); err == nil {
+			t.Error("Expected the failing vendor's error, got nil")
+		}
+		if _, err := dispatcher.SendStreaming(context.Background(), req); err == nil {
+			t.Error("Expected the failing vendor's streaming error, got nil")
+		}
+		if _, err := dispatcher.SendToVendor(context.Background(), "hanging", req); err == nil {
+			t.Error("Expected the hanging vendor to be unavailable, got nil")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the fallbacks' checks bounded by the timeout, took %v", elapsed)
+		}
+	})
+
+	t.Run("no vendor answers", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		dispatcher := NewWithConfig(&models.Config{AvailabilityCheckTimeout: 50 * time.Millisecond})
+		dispatcher.RegisterVendor(&hangingVendor{MockVendor: MockVendor{name: "hanging", available: true}, release: release})
+
+		if _, err := dispatcher.Send(context.Background(), req); !errors.Is(err, models.ErrVendorUnavailable) {
+			t.Errorf("Expected ErrVendorUnavailable, got %v", err)
+		}
+	})
+}
+
+// recordingLogger records the messages logged to it with their level
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) log(level, msg string, keysAndValues []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, fmt.Sprint(level, " ", msg, " ", keysAndValues))
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log("debug", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.log("info", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log("warn", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.log("error", msg, keysAndValues)
+}
+
+func (l *recordingLogger) contains(entry string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDispatcher_Logger(t *testing.T) {
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	t.Run("config", func(t *testing.T) {
+		logger := &recordingLogger{}
+		dispatcher := NewWithConfig(&models.Config{Logger: logger})
+		dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", available: true})
+		if _, err := dispatcher.Send(context.Background(), req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for _, entry := range []string{
+			"info Registered vendor [vendor test-vendor]",
+			"debug Validating request [model gpt-4o mode ]",
+		} {
+			if !logger.contains(entry) {
+				t.Errorf("Expected %q to be logged, got %q", entry, logger.entries)
+			}
+		}
+	})
+
+	t.Run("SetLogger", func(t *testing.T) {
+		dispatcher := NewWithConfig(&models.Config{})
+		logger := &recordingLogger{}
+		dispatcher.SetLogger(logger)
+		dispatcher.RegisterVendor(&MockVendor{name: "test-vendor", shouldFail: true, available: true})
+		dispatcher.Send(context.Background(), req)
+
+		if !logger.contains("warn Attempt failed [vendor test-vendor attempt 1 error mock error]") {
+			t.Errorf("Expected the failed attempt to be logged, got %q", logger.entries)
+		}
+
+		dispatcher.SetLogger(nil)
+		if _, ok := dispatcher.logger.(*stdLogger); !ok {
+			t.Errorf("Expected a nil logger to restore the default, got %T", dispatcher.logger)
+		}
+	})
+
+	t.Run("default format", func(t *testing.T) {
+		var out strings.Builder
+		logger := &stdLogger{logger: log.New(&out, "", 0)}
+		logger.Warn("Vendor failed, falling back", "vendor", "openai", "fallback", "anthropic", "dangling")
+		logger.Debug("Validating request")
+
+		if expected := "WARN: Vendor failed, falling back vendor=openai fallback=anthropic dangling\n"; out.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, out.String())
+		}
+	})
+}
+
+func TestDispatcher_MetricsHandler(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{EnableMetrics: true, LogLevel: models.LogLevelNone})
+	dispatcher.RegisterVendor(&MockVendor{name: "openai", available: true, response: &models.Response{
+		Content: "Hi",
+		Usage:   models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}})
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		dispatcher.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := dispatcher.Send(context.Background(), req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	body := scrape()
+	for _, metric := range []string{
+		`llmdispatcher_requests_total{vendor="openai"} 2`,
+		`llmdispatcher_request_successes_total{vendor="openai"} 2`,
+		`llmdispatcher_tokens_total{vendor="openai"} 30`,
+		`llmdispatcher_request_duration_seconds_count{vendor="openai"} 2`,
+		`llmdispatcher_cost_total{vendor="openai"}`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("Expected %s in the metrics, got:\n%s", metric, body)
+		}
+	}
+
+	if _, err := dispatcher.Send(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if body := scrape(); !strings.Contains(body, `llmdispatcher_requests_total{vendor="openai"} 3`) {
+		t.Errorf("Expected the request count to increment, got:\n%s", body)
+	}
+
+	recorder := httptest.NewRecorder()
+	NewWithConfig(&models.Config{}).MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with metrics disabled, got %d", recorder.Code)
+	}
+}
+
+// statusCodeVendor is a flakyVendor declaring its retryable statuses
+type statusCodeVendor struct {
+	flakyVendor
+	codes []int
+}
+
+func (v *statusCodeVendor) RetryableStatusCodes() []int {
+	return v.codes
+}
+
+func TestDispatcher_RetryableStatusCodes(t *testing.T) {
+	overloaded := &models.VendorError{Vendor: "test", StatusCode: http.StatusInternalServerError, Message: "overloaded"}
+
+	tests := []struct {
+		name          string
+		codes         []int
+		err           error
+		expectedCalls int
+	}{
+		{"default retries 500", nil, overloaded, 2},
+		{"vendor retries 500", []int{http.StatusInternalServerError}, overloaded, 2},
+		{"vendor doesn't retry 500", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, overloaded, 1},
+		{"vendor retries nothing", []int{}, overloaded, 1},
+		{"default doesn't retry 400", nil, &models.VendorError{Vendor: "test", StatusCode: http.StatusBadRequest}, 1},
+		{"wrapped error", []int{http.StatusInternalServerError}, fmt.Errorf("openai: %w", overloaded), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &Dispatcher{
+				config: &models.Config{
+					RetryPolicy: &models.RetryPolicy{MaxRetries: 1, BackoffStrategy: models.FixedBackoff},
+				},
+				logger: &stdLogger{logger: log.New(io.Discard, "", 0)},
+			}
+			vendor := &statusCodeVendor{
+				flakyVendor: flakyVendor{MockVendor: MockVendor{name: "test", available: true, response: &models.Response{Content: "ok"}}, err: tt.err, failures: 1},
+				codes:       tt.codes,
+			}
+
+			_, err := dispatcher.sendWithRetry(context.Background(), vendor, &models.Request{
+				Model:    "test-model",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if vendor.calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, vendor.calls)
+			}
+			if retried := tt.expectedCalls > 1; retried != (err == nil) {
+				t.Errorf("Expected success %v, got error %v", retried, err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_ResolveRequest(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{
+		Mode:                models.SophisticatedMode,
+		ModelRewrites:       map[string]string{"smart": "gpt-4o"},
+		DedupSystemMessages: true,
+		ModeOverrides: &models.ModeOverrides{
+			VendorPreferences: map[models.Mode][]string{models.SophisticatedMode: {"openai"}},
+			StopSequences:     map[models.Mode][]string{models.SophisticatedMode: {"\n\nUser:"}},
+		},
+	})
+	vendor := &capturingVendor{MockVendor: MockVendor{name: "openai", available: true}}
+	dispatcher.RegisterVendor(vendor)
+	dispatcher.RegisterVendor(&MockVendor{name: "anthropic", available: true})
+
+	req := &models.Request{
+		Model: "smart",
+		Messages: []models.Message{
+			{Role: "system", Content: "Be concise."},
+			{Role: "system", Content: "Be concise."},
+			{Role: "user", Content: "Hello"},
+		},
+		Stop:      []string{"END", "", "END"},
+		MaxTokens: models.MaxTokensVendorDefault,
+	}
+
+	resolved, vendorName, err := dispatcher.ResolveRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if vendorName != "openai" {
+		t.Errorf("Expected the preferred vendor, got %s", vendorName)
+	}
+	if resolved.Model != "gpt-4o" {
+		t.Errorf("Expected the rewritten model, got %s", resolved.Model)
+	}
+	if len(resolved.Messages) != 2 {
+		t.Errorf("Expected the duplicate system message dropped, got %+v", resolved.Messages)
+	}
+	if !reflect.DeepEqual(resolved.Stop, []string{"END", "\n\nUser:"}) {
+		t.Errorf("Expected the cleaned stop sequences then the mode's, got %q", resolved.Stop)
+	}
+	// The vendor default survives mode optimization and is then sent as 0
+	if resolved.MaxTokens != 0 {
+		t.Errorf("Expected the vendor default max tokens, got %d", resolved.MaxTokens)
+	}
+	if resolved.Temperature != 0.7 || resolved.TopP != 0.9 {
+		t.Errorf("Expected the sophisticated mode's optimizations, got temperature %v and top_p %v", resolved.Temperature, resolved.TopP)
+	}
+
+	if req.Model != "smart" || len(req.Messages) != 3 || req.Temperature != 0 {
+		t.Errorf("Expected the caller's request to be left alone, got %+v", req)
+	}
+	if vendor.Calls() != 0 {
+		t.Errorf("Expected nothing sent, got %d calls", vendor.Calls())
+	}
+	if stats := dispatcher.GetStats(); stats.TotalRequests != 0 {
+		t.Errorf("Expected nothing counted, got %d requests", stats.TotalRequests)
+	}
+
+	// Send hands the vendor the resolved request
+	if _, err := dispatcher.Send(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sent := vendor.LastRequest(); !reflect.DeepEqual(sent, resolved) {
+		t.Errorf("Expected Send to send the resolved request\n got %+v\nwant %+v", sent, resolved)
+	}
+
+	if _, _, err := dispatcher.ResolveRequest(context.Background(), &models.Request{Model: "gpt-4o"}); !errors.Is(err, models.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for a request without messages, got %v", err)
+	}
+}
+
+func TestDispatcher_MaxCost(t *testing.T) {
+	// Estimates for the request, with the models the mode picks: anthropic
+	// about $0.015 on claude-3-5-sonnet, openai about $0.01 on gpt-4o
+	tests := []struct {
+		name           string
+		policy         models.MaxCostPolicy
+		maxCost        float64
+		expectedVendor string
+	}{
+		{"no cap", models.MaxCostReject, 0, "anthropic"},
+		{"within the cap", models.MaxCostReject, 1, "anthropic"},
+		{"rejected", models.MaxCostReject, 0.012, ""},
+		{"default policy rejects", "", 0.012, ""},
+		{"downgraded", models.MaxCostDowngrade, 0.012, "openai"},
+		{"no vendor within the cap", models.MaxCostDowngrade, 0.005, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				Mode:          models.SophisticatedMode,
+				MaxCostPolicy: tt.policy,
+				ModeOverrides: &models.ModeOverrides{
+					VendorPreferences: map[models.Mode][]string{models.SophisticatedMode: {"anthropic", "openai"}},
+				},
+			})
+			vendors := map[string]*capturingVendor{
+				"anthropic": {MockVendor: MockVendor{name: "anthropic", available: true, response: &models.Response{Content: "ok"}}},
+				"openai":    {MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}}},
+			}
+			for _, vendor := range vendors {
+				dispatcher.RegisterVendor(vendor)
+			}
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Mode:      string(models.SophisticatedMode),
+				Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+				MaxTokens: 1000,
+				MaxCost:   tt.maxCost,
+			})
+			if tt.expectedVendor == "" {
+				if !errors.Is(err, models.ErrRequestCostExceeded) {
+					t.Errorf("Expected ErrRequestCostExceeded, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for name, vendor := range vendors {
+				// The model picked for the mode is the one of the vendor sent to
+				if sent := vendor.LastRequest(); sent != nil && sent.Model != modelForVendorAndMode(vendor, models.SophisticatedMode) {
+					t.Errorf("Expected %s's model for the mode, got %s", name, sent.Model)
+				}
+				if expected := name == tt.expectedVendor; expected != (vendor.Calls() == 1) {
+					t.Errorf("Expected %s called %v, got %d calls", name, expected, vendor.Calls())
+				}
+			}
+		})
+	}
+
+	if err := (&models.Request{Messages: []models.Message{{Role: "user", Content: "Hello"}}, MaxCost: -1}).Validate(); !errors.Is(err, models.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for a negative max cost, got %v", err)
+	}
+}
+
+type cancellableStreamVendor struct {
+	MockVendor
+	delay     time.Duration
+	cancelled chan struct{}
+}
+
+func (v *cancellableStreamVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	streamingResp := models.NewStreamingResponse(req.Model, v.name)
+	go func() {
+		defer streamingResp.Close()
+		select {
+		case <-time.After(v.delay):
+		case <-ctx.Done():
+			close(v.cancelled)
+			streamingResp.SendError(ctx.Err())
+			return
+		}
+		streamingResp.Send("from " + v.name)
+		streamingResp.Send(", done")
+		streamingResp.SendDone()
+	}()
+	return streamingResp, nil
+}
+
+func TestDispatcher_StreamFromFirst(t *testing.T) {
+	newVendor := func(name string, delay time.Duration) *cancellableStreamVendor {
+		return &cancellableStreamVendor{
+			MockVendor: MockVendor{name: name, available: true, supportsStreaming: true},
+			delay:      delay,
+			cancelled:  make(chan struct{}),
+		}
+	}
+	req := &models.Request{
+		Model:    "test-model",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	t.Run("fast vendor wins", func(t *testing.T) {
+		fast, slow := newVendor("fast", 0), newVendor("slow", 5*time.Second)
+		dispatcher := New()
+		dispatcher.RegisterVendor(fast)
+		dispatcher.RegisterVendor(slow)
+
+		stream, err := dispatcher.StreamFromFirst(context.Background(), req, []string{"slow", "fast"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if content := strings.Join(drainStream(t, stream), ""); content != "from fast, done" {
+			t.Errorf("Expected the fast vendor's content, got %q", content)
+		}
+		if stream.Vendor != "fast" {
+			t.Errorf("Expected vendor fast, got %s", stream.Vendor)
+		}
+		select {
+		case <-slow.cancelled:
+		case <-time.After(time.Second):
+			t.Error("Expected the slow vendor's stream to be cancelled")
+		}
+	})
+
+	t.Run("first vendor fails before content", func(t *testing.T) {
+		slow := newVendor("slow", 50*time.Millisecond)
+		dispatcher := New()
+		dispatcher.RegisterVendor(&failingStreamVendor{MockVendor: MockVendor{name: "failing", available: true, supportsStreaming: true}})
+		dispatcher.RegisterVendor(slow)
+
+		stream, err := dispatcher.StreamFromFirst(context.Background(), req, []string{"failing", "slow"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if content := strings.Join(drainStream(t, stream), ""); content != "from slow, done" {
+			t.Errorf("Expected the slow vendor's content, got %q", content)
+		}
+	})
+
+	t.Run("every vendor fails", func(t *testing.T) {
+		dispatcher := New()
+		dispatcher.RegisterVendor(&failingStreamVendor{MockVendor: MockVendor{name: "failing", available: true, supportsStreaming: true}})
+		dispatcher.RegisterVendor(&MockVendor{name: "unavailable"})
+
+		_, err := dispatcher.StreamFromFirst(context.Background(), req, []string{"failing", "unavailable"})
+		if err == nil || err.Error() != "stream reset" {
+			t.Errorf("Expected the first vendor's error, got %v", err)
+		}
+	})
+
+	t.Run("no vendors", func(t *testing.T) {
+		if _, err := New().StreamFromFirst(context.Background(), req, nil); !errors.Is(err, models.ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest, got %v", err)
+		}
+	})
+}
+
+func TestDispatcher_DefaultMaxTokensByModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		mode      string
+		maxTokens int
+		expected  int
+	}{
+		{"model-specific default", "gpt-4o", "", 0, 16384},
+		{"exact name over pattern", "gpt-4o-mini", "", 0, 8192},
+		{"unlisted model gets the global default", "gpt-4", "", 0, 1024},
+		{"explicit max tokens kept", "gpt-4o", "", 200, 200},
+		{"vendor default", "gpt-4o", "", models.MaxTokensVendorDefault, 0},
+		// The mode picks gpt-3.5-turbo, whose default replaces the mode's
+		{"model selected by mode", "", string(models.FastMode), 0, 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{
+				DefaultMaxTokens: 1024,
+				DefaultMaxTokensByModel: map[string]int{
+					"gpt-4o*":     16384,
+					"gpt-4o-mini": 8192,
+				},
+			})
+			vendor := &capturingVendor{MockVendor: MockVendor{name: "openai", available: true, response: &models.Response{Content: "ok"}}}
+			dispatcher.RegisterVendor(vendor)
+
+			_, err := dispatcher.Send(context.Background(), &models.Request{
+				Model:     tt.model,
+				Mode:      tt.mode,
+				Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+				MaxTokens: tt.maxTokens,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if sent := vendor.LastRequest(); sent.MaxTokens != tt.expected {
+				t.Errorf("Expected max tokens %d for %s, got %d", tt.expected, sent.Model, sent.MaxTokens)
+			}
+		})
+	}
+}
+
+func TestDispatcher_PricingByModel(t *testing.T) {
+	usage := models.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500}
+	tests := []struct {
+		name     string
+		pricing  models.PricingTable
+		model    string
+		expected float64
+	}{
+		{"gpt-4", nil, "gpt-4", 0.06},
+		{"gpt-4o-mini", nil, "gpt-4o-mini", 0.00045},
+		{"overridden price", models.PricingTable{"openai": {"gpt-4o-mini": {InputPer1K: 0.001, OutputPer1K: 0.002}}}, "gpt-4o-mini", 0.002},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := NewWithConfig(&models.Config{Pricing: tt.pricing})
+			dispatcher.RegisterVendor(&MockVendor{
+				name:      "openai",
+				available: true,
+				response:  &models.Response{Content: "ok", Usage: usage},
+			})
+
+			response, err := dispatcher.SendToVendor(context.Background(), "openai", &models.Request{
+				Model:    tt.model,
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if math.Abs(response.EstimatedCost-tt.expected) > 1e-12 {
+				t.Errorf("Expected cost %v, got %v", tt.expected, response.EstimatedCost)
+			}
+			if cost := dispatcher.GetStats().VendorStats["openai"].TotalCost; math.Abs(cost-tt.expected) > 1e-12 {
+				t.Errorf("Expected vendor cost %v, got %v", tt.expected, cost)
+			}
+		})
+	}
+}
+
+// endlessStreamVendor streams chunks until its stream is closed, ignoring
+// the request context, and closes exited once its producer stops
+type endlessStreamVendor struct {
+	MockVendor
+	exited chan struct{}
+}
+
+func (v *endlessStreamVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	streamingResp := models.NewStreamingResponse(req.Model, v.name)
+	go func() {
+		defer close(v.exited)
+		for streamingResp.Send("tick") {
+		}
+	}()
+	return streamingResp, nil
+}
+
+func TestDispatcher_SendStreaming_ConsumerCloseStopsProducer(t *testing.T) {
+	dispatcher := NewWithConfig(&models.Config{Mode: models.FastMode})
+	vendor := &endlessStreamVendor{
+		MockVendor: MockVendor{name: "openai", available: true, supportsStreaming: true},
+		exited:     make(chan struct{}),
+	}
+	dispatcher.RegisterVendor(vendor)
+
+	resp, err := dispatcher.SendStreaming(context.Background(), &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if chunk := <-resp.ContentChan; chunk != "tick" {
+		t.Fatalf("Expected a chunk, got %q", chunk)
+	}
+	resp.Close()
+
+	select {
+	case <-vendor.exited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the vendor's producer to stop once the consumer closed the stream")
+	}
+}
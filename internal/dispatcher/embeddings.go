@@ -0,0 +1,171 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// Embed computes the embeddings of the request's inputs. The vendor is
+// chosen among those implementing models.EmbeddingVendor by the mode
+// strategy, as Send chooses one for chat requests, and the request counts
+// towards the dispatcher's stats and events like any other.
+func (d *Dispatcher) Embed(ctx context.Context, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	if ctx == nil {
+		return nil, models.ErrInvalidRequest
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, models.ErrInvalidRequest
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Mode != "" {
+		if _, err := d.modeRegistry.GetStrategy(models.Mode(req.Mode)); err != nil {
+			return nil, fmt.Errorf("%w: %q", models.ErrInvalidMode, req.Mode)
+		}
+	}
+
+	ctx, release := d.trackRequest(ctx)
+	defer release()
+
+	start := time.Now()
+
+	d.countRequest(req.Model)
+
+	if d.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		defer cancel()
+	}
+
+	vendor, err := d.selectEmbeddingVendor(ctx, req)
+	if err != nil {
+		err = fmt.Errorf("failed to select vendor: %w", err)
+		d.updateStats(false, "", time.Since(start), 0.0)
+		d.emitEvent("", req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	response, err := d.embedInBatches(ctx, vendor, req)
+	if err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	model := response.Model
+	if model == "" {
+		model = req.Model
+	}
+	d.updateStats(true, vendor.Name(), time.Since(start), 0.0)
+	d.emitEvent(vendor.Name(), model, time.Since(start), 0.0, response.Usage.TotalTokens, nil)
+	return response, nil
+}
+
+// embedInBatches sends an embedding request to vendor, split into calls of
+// at most the vendor's EmbeddingBatchSize inputs when it has a limit. The
+// calls are made in turn, each within the vendor's RateLimit, and their
+// embeddings merged in input order, with their usage summed.
+func (d *Dispatcher) embedInBatches(ctx context.Context, vendor models.LLMVendor, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	embedder := vendor.(models.EmbeddingVendor)
+	size := 0
+	if batcher, ok := vendor.(models.EmbeddingBatcher); ok {
+		size = batcher.EmbeddingBatchSize()
+	}
+	if size <= 0 || len(req.Input) <= size {
+		if err := d.waitForRateLimit(ctx, vendor, func() int { return d.inputTokens(req) }); err != nil {
+			return nil, err
+		}
+		return embedder.EmbedRequest(ctx, req)
+	}
+
+	merged := &models.EmbeddingResponse{Embeddings: make([][]float64, 0, len(req.Input))}
+	for start := 0; start < len(req.Input); start += size {
+		end := min(start+size, len(req.Input))
+		batch := *req
+		batch.Input = req.Input[start:end]
+		if err := d.waitForRateLimit(ctx, vendor, func() int { return d.inputTokens(&batch) }); err != nil {
+			return nil, fmt.Errorf("embedding inputs %d to %d: %w", start, end-1, err)
+		}
+
+		response, err := embedder.EmbedRequest(ctx, &batch)
+		if err != nil {
+			return nil, fmt.Errorf("embedding inputs %d to %d: %w", start, end-1, err)
+		}
+		if len(response.Embeddings) != len(batch.Input) {
+			return nil, fmt.Errorf("vendor %s returned %d embeddings for %d inputs", vendor.Name(), len(response.Embeddings), len(batch.Input))
+		}
+
+		if start == 0 {
+			merged.Model, merged.Vendor, merged.CreatedAt = response.Model, response.Vendor, response.CreatedAt
+		}
+		merged.Embeddings = append(merged.Embeddings, response.Embeddings...)
+		merged.Usage.PromptTokens += response.Usage.PromptTokens
+		merged.Usage.TotalTokens += response.Usage.TotalTokens
+	}
+	return merged, nil
+}
+
+// inputTokens counts the tokens of an embedding request's inputs with the
+// dispatcher's TokenCounter
+func (d *Dispatcher) inputTokens(req *models.EmbeddingRequest) int {
+	tokens := 0
+	for _, text := range req.Input {
+		tokens += d.countTokens(req.Model, text)
+	}
+	return tokens
+}
+
+// selectEmbeddingVendor picks the vendor for an embedding request among the
+// enabled vendors that support embeddings
+func (d *Dispatcher) selectEmbeddingVendor(ctx context.Context, req *models.EmbeddingRequest) (models.LLMVendor, error) {
+	candidates := make(map[string]models.LLMVendor)
+	for name, vendor := range d.enabledVendors() {
+		if _, ok := vendor.(models.EmbeddingVendor); ok {
+			candidates[name] = vendor
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no enabled vendor supports embeddings", models.ErrFeatureNotSupported)
+	}
+
+	// Strategies route chat requests, so they see the inputs as messages
+	chatReq := &models.Request{
+		Model:    req.Model,
+		Mode:     req.Mode,
+		User:     req.User,
+		Messages: make([]models.Message, len(req.Input)),
+	}
+	for i, input := range req.Input {
+		chatReq.Messages[i] = models.Message{Role: "user", Content: input}
+	}
+	mode := d.resolveMode(chatReq)
+
+	strategy, err := d.modeRegistry.GetStrategy(mode)
+	if err == nil {
+		var vendor models.LLMVendor
+		vendor, err = strategy.SelectVendor(&models.ModeContext{
+			Mode:             mode,
+			Request:          chatReq,
+			AvailableVendors: candidates,
+			Config:           d.config,
+			Stats:            d.getModeStats(mode),
+			Context:          ctx,
+			VendorStats:      d.vendorStatsSnapshot(),
+			Rand:             d.routingRand,
+		})
+		if err == nil {
+			return vendor, nil
+		}
+	}
+	d.logger.Warn("Mode-based embedding vendor selection failed", "error", err)
+
+	vendor, _, err := d.fallbackVendor(ctx, mode, candidates)
+	return vendor, err
+}
@@ -0,0 +1,89 @@
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// Events returns a channel receiving an event for each request completed
+// after the first call, as a push alternative to polling GetStats. Every
+// call returns the same channel. It buffers Config.EventBufferSize events;
+// events that arrive while it is full are dropped rather than holding up
+// requests, and counted in DispatcherStats.DroppedEvents. The channel is
+// closed by Close.
+func (d *Dispatcher) Events() <-chan models.RequestEvent {
+	d.eventsMutex.Lock()
+	defer d.eventsMutex.Unlock()
+
+	if d.events == nil {
+		size := d.config.EventBufferSize
+		if size <= 0 {
+			size = models.DefaultEventBufferSize
+		}
+		d.events = make(chan models.RequestEvent, size)
+		if d.eventsClosed {
+			close(d.events)
+		}
+	}
+	return d.events
+}
+
+// emitEvent records a completed request in the metrics and delivers an
+// event for it to the Events channel, if anyone has asked for it. model is
+// the model the request was sent for, and tokens its total token usage.
+func (d *Dispatcher) emitEvent(vendorName, model string, latency time.Duration, cost float64, tokens int, err error) {
+	event := models.RequestEvent{
+		Vendor:    vendorName,
+		Model:     model,
+		Success:   err == nil,
+		Latency:   latency,
+		Cost:      cost,
+		Tokens:    tokens,
+		Timestamp: time.Now(),
+		Error:     err,
+	}
+	d.metrics.Observe(event)
+
+	d.eventsMutex.RLock()
+	defer d.eventsMutex.RUnlock()
+
+	if d.events == nil || d.eventsClosed {
+		return
+	}
+	select {
+	case d.events <- event:
+	default:
+		d.statsMutex.Lock()
+		d.stats.DroppedEvents++
+		d.statsMutex.Unlock()
+	}
+}
+
+// closeEvents closes the Events channel; later events are discarded
+func (d *Dispatcher) closeEvents() {
+	d.eventsMutex.Lock()
+	defer d.eventsMutex.Unlock()
+
+	d.eventsClosed = true
+	if d.events != nil {
+		close(d.events)
+	}
+}
+
+// responseModel returns the model a response reports, or the requested one
+// when it reports none
+func responseModel(req *models.Request, response *models.Response) string {
+	if response != nil && response.Model != "" {
+		return response.Model
+	}
+	return req.Model
+}
+
+// responseTokens returns a response's total token usage
+func responseTokens(response *models.Response) int {
+	if response == nil {
+		return 0
+	}
+	return response.Usage.TotalTokens
+}
@@ -0,0 +1,127 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// SendToAll sends the request to several vendors at once, as SendToVendor
+// does, and returns one result per vendor in vendor name order. With
+// FanOutFirstSuccess or FanOutFirstN it returns once enough vendors have
+// succeeded, cancelling the remaining calls; their results fail with
+// models.ErrFanOutCancelled. Individual failures are reported in the
+// results; the error is only set for invalid options, or with
+// models.ErrFanOutIncomplete when too few vendors succeeded.
+func (d *Dispatcher) SendToAll(ctx context.Context, req *models.Request, opts models.FanOutOptions) ([]models.FanOutResult, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context cannot be nil", models.ErrInvalidRequest)
+	}
+	if req == nil {
+		return nil, fmt.Errorf("%w: request cannot be nil", models.ErrInvalidRequest)
+	}
+
+	// Successes to wait for; zero waits for every vendor
+	required := 0
+	switch opts.Mode {
+	case "", models.FanOutAll:
+	case models.FanOutFirstSuccess:
+		required = 1
+	case models.FanOutFirstN:
+		if opts.N <= 0 {
+			return nil, fmt.Errorf("%w: fan-out mode %s needs a positive N", models.ErrInvalidRequest, opts.Mode)
+		}
+		required = opts.N
+	default:
+		return nil, fmt.Errorf("%w: unknown fan-out mode %q", models.ErrInvalidRequest, opts.Mode)
+	}
+
+	names := append([]string(nil), opts.Vendors...)
+	if len(names) == 0 {
+		names = d.GetVendors()
+	}
+	if len(names) == 0 {
+		return nil, models.ErrNoVendorsRegistered
+	}
+	sort.Strings(names)
+
+	fanCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var slots chan struct{}
+	if opts.MaxParallel > 0 {
+		slots = make(chan struct{}, opts.MaxParallel)
+	}
+
+	type outcome struct {
+		index  int
+		result models.FanOutResult
+	}
+	// Buffered for every vendor, so calls finishing after SendToAll has
+	// returned never block
+	outcomes := make(chan outcome, len(names))
+	for i, name := range names {
+		go func() {
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-fanCtx.Done():
+				}
+			}
+			if fanCtx.Err() != nil {
+				outcomes <- outcome{i, models.FanOutResult{Vendor: name, Err: context.Cause(fanCtx)}}
+				return
+			}
+
+			start := time.Now()
+			response, err := d.SendToVendor(fanCtx, name, req)
+			outcomes <- outcome{i, models.FanOutResult{Vendor: name, Response: response, Err: err, Latency: time.Since(start)}}
+		}()
+	}
+
+	results := make([]models.FanOutResult, len(names))
+	received := make([]bool, len(names))
+	successes := 0
+	for range names {
+		o := <-outcomes
+		results[o.index] = o.result
+		received[o.index] = true
+		if o.result.Err != nil {
+			continue
+		}
+
+		successes++
+		if required > 0 && successes >= required {
+			cancel(models.ErrFanOutCancelled)
+			for i, done := range received {
+				if !done {
+					results[i] = models.FanOutResult{Vendor: names[i], Err: models.ErrFanOutCancelled}
+				}
+			}
+			return results, nil
+		}
+	}
+
+	if successes < required {
+		return results, fmt.Errorf("%w: %d of %d", models.ErrFanOutIncomplete, successes, required)
+	}
+	return results, nil
+}
+
+// recordCancellation counts a vendor call SendToAll cancelled once it had
+// enough successes
+func (d *Dispatcher) recordCancellation(vendorName string) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	d.stats.CancelledRequests++
+	stats := d.stats.VendorStats[vendorName]
+	stats.Requests++
+	stats.Cancellations++
+	stats.LastUsed = time.Now()
+	d.stats.VendorStats[vendorName] = stats
+}
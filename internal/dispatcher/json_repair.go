@@ -0,0 +1,127 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// repairJSONOutput repairs malformed JSON content in a response to a request
+// that asked for JSON output. Content that is valid or can't be repaired is
+// left as it is.
+func (d *Dispatcher) repairJSONOutput(vendorName string, req *models.Request, response *models.Response) {
+	if !d.config.RepairJSONOutput || req.ResponseFormat != models.ResponseFormatJSON || response == nil {
+		return
+	}
+
+	repaired, ok := repairJSON(response.Content)
+	if !ok || repaired == response.Content {
+		return
+	}
+	d.logger.Info("Repaired malformed JSON output", "vendor", vendorName)
+	response.Content = repaired
+}
+
+// repairJSON fixes the malformations models commonly produce in JSON
+// output: a surrounding markdown code fence, trailing commas, unquoted
+// object keys and single-quoted strings. It reports false when the result
+// still isn't valid JSON.
+func repairJSON(content string) (string, bool) {
+	if json.Valid([]byte(content)) {
+		return content, true
+	}
+
+	text := stripCodeFence(strings.TrimSpace(content))
+
+	var out strings.Builder
+	out.Grow(len(text))
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"' || r == '\'':
+			i = copyString(runes, i, &out)
+		case r == ',':
+			// Drop commas directly before a closing bracket
+			next := i + 1
+			for next < len(runes) && unicode.IsSpace(runes[next]) {
+				next++
+			}
+			if next < len(runes) && (runes[next] == '}' || runes[next] == ']') {
+				continue
+			}
+			out.WriteRune(r)
+		case r == '_' || r == '$' || unicode.IsLetter(r):
+			end := i
+			for end < len(runes) && (runes[end] == '_' || runes[end] == '$' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			word := string(runes[i:end])
+			// Quote bare identifiers used as object keys
+			next := end
+			for next < len(runes) && unicode.IsSpace(runes[next]) {
+				next++
+			}
+			if next < len(runes) && runes[next] == ':' {
+				out.WriteString(`"` + word + `"`)
+			} else {
+				out.WriteString(word)
+			}
+			i = end - 1
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	repaired := out.String()
+	if !json.Valid([]byte(repaired)) {
+		return content, false
+	}
+	return repaired, true
+}
+
+// copyString writes the string literal starting at runes[start] as a
+// double-quoted JSON string and returns the index of its closing quote
+func copyString(runes []rune, start int, out *strings.Builder) int {
+	quote := runes[start]
+	out.WriteRune('"')
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			// A single-quoted string may escape a quote JSON doesn't escape
+			if runes[i+1] == '\'' {
+				out.WriteRune('\'')
+			} else {
+				out.WriteRune(r)
+				out.WriteRune(runes[i+1])
+			}
+			i++
+		case r == quote:
+			out.WriteRune('"')
+			return i
+		case r == '"':
+			// Only reachable inside a single-quoted string
+			out.WriteString(`\"`)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return len(runes) - 1
+}
+
+// stripCodeFence removes a markdown code fence around the text, such as
+// ```json ... ```
+func stripCodeFence(text string) string {
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```")
+	// Drop the language tag on the opening line
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 && !strings.ContainsAny(text[:newline], "{[") {
+		text = text[newline+1:]
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,82 @@
+package dispatcher
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// stdLogger is the default Logger, writing "msg key=value ..." lines to a
+// standard library logger
+type stdLogger struct {
+	logger *log.Logger
+	debug  bool
+}
+
+// newLogger returns Config.Logger, or else the default logger
+func newLogger(config *models.Config) models.Logger {
+	if config.Logger != nil {
+		return config.Logger
+	}
+	return newStdLogger(config)
+}
+
+// newStdLogger returns the default logger for the config's LogLevel. It
+// discards everything at LogLevelNone, and logs debug messages only when
+// EnableLogging is set at LogLevelDebug.
+func newStdLogger(config *models.Config) *stdLogger {
+	out := log.Writer()
+	if config.LogLevel == models.LogLevelNone {
+		out = io.Discard
+	}
+	return &stdLogger{
+		logger: log.New(out, "[LLMDispatcher] ", log.LstdFlags),
+		debug:  config.EnableLogging && config.LogLevel == models.LogLevelDebug,
+	}
+}
+
+func (l *stdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	if l.debug {
+		l.print("DEBUG: ", msg, keysAndValues)
+	}
+}
+
+func (l *stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.print("", msg, keysAndValues)
+}
+
+func (l *stdLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.print("WARN: ", msg, keysAndValues)
+}
+
+func (l *stdLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.print("ERROR: ", msg, keysAndValues)
+}
+
+// print writes one line, with a value missing its pair printed on its own
+func (l *stdLogger) print(level, msg string, keysAndValues []interface{}) {
+	var line strings.Builder
+	line.WriteString(level)
+	line.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 < len(keysAndValues) {
+			fmt.Fprintf(&line, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+		} else {
+			fmt.Fprintf(&line, " %v", keysAndValues[i])
+		}
+	}
+	l.logger.Print(line.String())
+}
+
+// SetLogger replaces the dispatcher's logger, as Config.Logger does, or
+// restores the default logger when logger is nil. It must not be called
+// while requests are in flight.
+func (d *Dispatcher) SetLogger(logger models.Logger) {
+	if logger == nil {
+		logger = newStdLogger(d.config)
+	}
+	d.logger = logger
+}
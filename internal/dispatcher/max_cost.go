@@ -0,0 +1,74 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// requestCost estimates what a request will cost on a vendor before it is
+// sent, from its prompt and the most it may generate
+func (d *Dispatcher) requestCost(req *models.Request, vendorName string) float64 {
+	promptTokens := d.estimateUsage(req, "").PromptTokens
+	return d.estimateCost(vendorName, req.Model, promptTokens, max(req.MaxTokens, 0))
+}
+
+// checkMaxCost fails with ErrRequestCostExceeded when the request's
+// estimated cost on the vendor exceeds its MaxCost
+func (d *Dispatcher) checkMaxCost(req *models.Request, vendorName string) error {
+	if req.MaxCost <= 0 {
+		return nil
+	}
+	if cost := d.requestCost(req, vendorName); cost > req.MaxCost {
+		return fmt.Errorf("%w: estimated $%.4f on %s, cap $%.4f", models.ErrRequestCostExceeded, cost, vendorName, req.MaxCost)
+	}
+	return nil
+}
+
+// vendorWithinMaxCost returns the vendor to send a request to under its
+// MaxCost: the selected vendor when its estimate is within the cap, or,
+// under MaxCostDowngrade, the cheapest other candidate within it that is
+// available and offers requestedModel. Ties go to the first by name. When
+// no model was requested, candidates are priced with the model the mode
+// picks on them.
+func (d *Dispatcher) vendorWithinMaxCost(ctx context.Context, vendor models.LLMVendor, req *models.Request, requestedModel string, mode models.Mode, candidates map[string]models.LLMVendor) (models.LLMVendor, error) {
+	err := d.checkMaxCost(req, vendor.Name())
+	if err == nil || d.config.MaxCostPolicy != models.MaxCostDowngrade {
+		return vendor, err
+	}
+
+	costs := make(map[string]float64, len(candidates))
+	names := make([]string, 0, len(candidates))
+	for name, candidate := range candidates {
+		if name == vendor.Name() {
+			continue
+		}
+		priced := req
+		if requestedModel == "" {
+			withModel := *req
+			withModel.Model = modelForVendorAndMode(candidate, mode)
+			priced = &withModel
+		}
+		costs[name] = d.requestCost(priced, name)
+		if costs[name] <= req.MaxCost {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		return costs[names[i]] < costs[names[j]]
+	})
+	for _, name := range names {
+		candidate := candidates[name]
+		if requestedModel != "" && !d.offersModel(ctx, candidate, requestedModel) {
+			continue
+		}
+		if d.vendorAvailable(ctx, candidate) {
+			d.logger.Info("Request over its cost cap, downgrading", "vendor", vendor.Name(), "fallback", name, "max_cost", req.MaxCost)
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w, as would every other vendor", err)
+}
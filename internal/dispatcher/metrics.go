@@ -0,0 +1,22 @@
+package dispatcher
+
+import (
+	"net/http"
+
+	"github.com/llmefficiency/llmdispatcher/internal/metrics"
+)
+
+// newMetrics returns nil unless Config.EnableMetrics is set
+func newMetrics(enabled bool) *metrics.Metrics {
+	if !enabled {
+		return nil
+	}
+	return metrics.New()
+}
+
+// MetricsHandler serves the dispatcher's request metrics for Prometheus to
+// scrape: request, success and failure counts, latency histograms, cost and
+// tokens, all by vendor. It answers 404 unless Config.EnableMetrics is set.
+func (d *Dispatcher) MetricsHandler() http.Handler {
+	return d.metrics.Handler()
+}
@@ -0,0 +1,248 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// normalizeRequest applies the configured message clean-ups to a request
+// before it is routed. The request must already be a private copy.
+func (d *Dispatcher) normalizeRequest(req *models.Request) error {
+	d.rewriteModel(req)
+	if d.config.IncludeRawResponse {
+		req.IncludeRawResponse = true
+	}
+	if err := d.checkModelAllowed(req.Model); err != nil {
+		return err
+	}
+	// Requests leaving the model to mode selection get their default once
+	// it is selected
+	if req.MaxTokens == 0 && req.Model != "" {
+		req.MaxTokens = d.defaultMaxTokens(req.Model)
+	}
+	if _, ok := d.config.TierRouting[req.Tier]; req.Tier != "" && !ok {
+		return fmt.Errorf("%w: unknown tier %q", models.ErrInvalidRequest, req.Tier)
+	}
+	// An empty mode leaves the choice to the config
+	if req.Mode != "" {
+		if _, err := d.modeRegistry.GetStrategy(models.Mode(req.Mode)); err != nil {
+			return fmt.Errorf("%w: %q", models.ErrInvalidMode, req.Mode)
+		}
+	}
+	req.Stop = normalizeStop(req.Stop)
+	if d.config.DedupSystemMessages {
+		req.Messages = dedupSystemMessages(req.Messages)
+	}
+	if d.config.SystemMessagePolicy == models.SystemMessagesMerge {
+		separator := d.config.SystemMessageSeparator
+		if separator == "" {
+			separator = models.DefaultSystemMessageSeparator
+		}
+		req.Messages = mergeSystemMessages(req.Messages, separator)
+	}
+	if len(d.config.MaxContentLengthByRole) > 0 {
+		return limitContentLength(req.Messages, d.config.MaxContentLengthByRole, d.config.ContentLengthPolicy)
+	}
+	return nil
+}
+
+// rewriteModel applies the configured model rewrites to the request's model
+func (d *Dispatcher) rewriteModel(req *models.Request) {
+	if req.Model == "" {
+		return
+	}
+	model := req.Model
+	if rewritten, ok := d.config.ModelRewrites[model]; ok && rewritten != "" {
+		model = rewritten
+	}
+	if d.config.ModelRewriter != nil {
+		if rewritten := d.config.ModelRewriter(model); rewritten != "" {
+			model = rewritten
+		}
+	}
+	if model != req.Model {
+		d.logger.Info("Rewrote model", "from", req.Model, "to", model)
+		req.Model = model
+	}
+}
+
+// reportRewrittenModel records on a response that its request was rewritten
+// from requestedModel to model
+func reportRewrittenModel(response *models.Response, requestedModel, model string) {
+	if response == nil || requestedModel == "" || requestedModel == model {
+		return
+	}
+	response.RequestedModel = requestedModel
+	if response.Model == "" {
+		response.Model = model
+	}
+}
+
+// checkModelAllowed rejects a requested model that is denied or, when an
+// allow list is configured, not on it
+func (d *Dispatcher) checkModelAllowed(model string) error {
+	if model == "" {
+		return nil
+	}
+	for _, pattern := range d.config.DeniedModels {
+		if models.MatchModelPattern(pattern, model) {
+			return fmt.Errorf("%w: %s is denied", models.ErrModelNotAllowed, model)
+		}
+	}
+	if len(d.config.AllowedModels) == 0 {
+		return nil
+	}
+	for _, pattern := range d.config.AllowedModels {
+		if models.MatchModelPattern(pattern, model) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not in the allowed models", models.ErrModelNotAllowed, model)
+}
+
+// modeModelAllowed reports whether the model the mode picks on a vendor,
+// for requests that leave the model to it, is allowed. Vendors without a
+// known model for the mode are allowed.
+func (d *Dispatcher) modeModelAllowed(vendor models.LLMVendor, mode models.Mode) bool {
+	if len(d.config.AllowedModels) == 0 && len(d.config.DeniedModels) == 0 {
+		return true
+	}
+	model := modelForVendorAndMode(vendor, mode)
+	return model == "" || d.checkModelAllowed(model) == nil
+}
+
+// vendorsWithAllowedModel drops the vendors whose model for the mode is not
+// allowed. It returns ErrModelNotAllowed when none is left.
+func (d *Dispatcher) vendorsWithAllowedModel(vendors map[string]models.LLMVendor, mode models.Mode) (map[string]models.LLMVendor, error) {
+	if len(vendors) == 0 {
+		return vendors, nil
+	}
+
+	allowed := make(map[string]models.LLMVendor, len(vendors))
+	for name, vendor := range vendors {
+		if d.modeModelAllowed(vendor, mode) {
+			allowed[name] = vendor
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("%w: every vendor's model for %s mode is excluded", models.ErrModelNotAllowed, mode)
+	}
+	return allowed, nil
+}
+
+// defaultMaxTokens returns the MaxTokens default for a model: its entry in
+// Config.DefaultMaxTokensByModel, exact or else by the longest matching
+// pattern, or otherwise Config.DefaultMaxTokens
+func (d *Dispatcher) defaultMaxTokens(model string) int {
+	if model != "" {
+		if tokens, ok := models.LookupModelPattern(d.config.DefaultMaxTokensByModel, model); ok {
+			return tokens
+		}
+	}
+	return d.config.DefaultMaxTokens
+}
+
+// normalizeStop drops empty and repeated stop sequences, keeping the first
+// occurrence of each in order, so vendors that reject such lists accept it
+// and duplicates don't count against stop-count limits. Whitespace is kept,
+// since sequences such as "\n\n" are meaningful. A list left empty becomes
+// nil, which vendors omit from the request body.
+func normalizeStop(stop []string) []string {
+	var normalized []string
+	for _, s := range stop {
+		if s != "" && !slices.Contains(normalized, s) {
+			normalized = append(normalized, s)
+		}
+	}
+	return normalized
+}
+
+// applyModeStopSequences adds the default stop sequences of the request's
+// mode that the request doesn't already carry. The request's own stop
+// sequences take precedence, and defaults beyond the vendor's stop-count
+// limit are dropped.
+func (d *Dispatcher) applyModeStopSequences(ctx context.Context, req *models.Request, vendor models.LLMVendor, mode models.Mode) {
+	if d.config.ModeOverrides == nil {
+		return
+	}
+	defaults := d.config.ModeOverrides.StopSequences[mode]
+	if len(defaults) == 0 {
+		return
+	}
+
+	limit := d.capabilities(ctx, vendor).MaxStopSequences
+	for _, stop := range defaults {
+		if stop == "" || slices.Contains(req.Stop, stop) {
+			continue
+		}
+		if limit > 0 && len(req.Stop) >= limit {
+			d.logger.Info("Dropping mode default stop sequences beyond the vendor's limit", "vendor", vendor.Name(), "limit", limit)
+			return
+		}
+		req.Stop = append(req.Stop, stop)
+	}
+}
+
+// dedupSystemMessages drops system messages identical to the system message
+// directly before them. Non-adjacent repeats are kept, since a system
+// message later in a conversation is a deliberate instruction.
+func dedupSystemMessages(messages []models.Message) []models.Message {
+	deduped := make([]models.Message, 0, len(messages))
+	for i, msg := range messages {
+		if i > 0 && msg.Role == "system" && messages[i-1].Role == "system" && messages[i-1].Content == msg.Content {
+			continue
+		}
+		deduped = append(deduped, msg)
+	}
+	return deduped
+}
+
+// mergeSystemMessages replaces the system messages with a single one, in
+// the position of the first, holding their contents joined with separator
+func mergeSystemMessages(messages []models.Message, separator string) []models.Message {
+	first, count := -1, 0
+	for i, msg := range messages {
+		if msg.Role == "system" {
+			if first < 0 {
+				first = i
+			}
+			count++
+		}
+	}
+	if count < 2 {
+		return messages
+	}
+
+	system, rest := models.JoinSystemMessages(messages, separator)
+	merged := make([]models.Message, 0, len(rest)+1)
+	merged = append(merged, rest[:first]...)
+	merged = append(merged, models.Message{Role: "system", Content: system})
+	return append(merged, rest[first:]...)
+}
+
+// limitContentLength enforces the per-role maximum content lengths, counted
+// in characters. Oversized messages are truncated in place, or rejected
+// under ContentLengthError.
+func limitContentLength(messages []models.Message, limits map[string]int, policy models.ContentLengthPolicy) error {
+	for i := range messages {
+		limit, ok := limits[messages[i].Role]
+		if !ok || limit <= 0 {
+			continue
+		}
+
+		content := []rune(messages[i].Content)
+		if len(content) <= limit {
+			continue
+		}
+
+		if policy == models.ContentLengthError {
+			return fmt.Errorf("%w: message %d: %s content is %d characters, limit is %d",
+				models.ErrInvalidRequest, i, messages[i].Role, len(content), limit)
+		}
+		messages[i].Content = string(content[:limit])
+	}
+	return nil
+}
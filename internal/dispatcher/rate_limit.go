@@ -0,0 +1,157 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// tokenBucket allows up to capacity units at once, refilled at perSecond
+type tokenBucket struct {
+	capacity  float64
+	available float64
+	perSecond float64
+	last      time.Time
+}
+
+// newTokenBucket returns a full bucket refilling perMinute units a minute,
+// or nil when perMinute is not a limit
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity:  float64(perMinute),
+		available: float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+		last:      now,
+	}
+}
+
+// delay refills the bucket up to now and returns how long it will take to
+// hold n units. n is capped at the capacity so that a request larger than
+// the whole limit waits for a full bucket instead of forever.
+func (b *tokenBucket) delay(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.available = min(b.capacity, b.available+elapsed*b.perSecond)
+		b.last = now
+	}
+	n = min(n, b.capacity)
+	if b.available >= n {
+		return 0
+	}
+	return time.Duration((n - b.available) / b.perSecond * float64(time.Second))
+}
+
+// take removes n units, capped as in delay
+func (b *tokenBucket) take(n float64) {
+	if b != nil {
+		b.available -= min(n, b.capacity)
+	}
+}
+
+// rateLimiter enforces a vendor's RateLimit with a bucket for requests and
+// one for tokens
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// reserve takes one request and the given tokens if both buckets hold
+// enough, and otherwise takes nothing and returns how long to wait
+func (l *rateLimiter) reserve(tokens int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	wait := max(l.requests.delay(1, now), l.tokens.delay(float64(tokens), now))
+	if wait > 0 {
+		return wait
+	}
+	l.requests.take(1)
+	l.tokens.take(float64(tokens))
+	return 0
+}
+
+// rateLimiter returns the limiter for a vendor's RateLimit, or nil when the
+// vendor has no limits
+func (d *Dispatcher) rateLimiter(vendor models.LLMVendor) *rateLimiter {
+	provider, ok := vendor.(models.RateLimitProvider)
+	if !ok {
+		return nil
+	}
+	limit := provider.RateLimit()
+	if limit.RequestsPerMinute <= 0 && limit.TokensPerMinute <= 0 {
+		return nil
+	}
+
+	d.rateLimitersMutex.Lock()
+	defer d.rateLimitersMutex.Unlock()
+
+	if limiter, exists := d.rateLimiters[vendor.Name()]; exists {
+		return limiter
+	}
+	if d.rateLimiters == nil {
+		d.rateLimiters = make(map[string]*rateLimiter)
+	}
+	now := time.Now()
+	limiter := &rateLimiter{
+		requests: newTokenBucket(limit.RequestsPerMinute, now),
+		tokens:   newTokenBucket(limit.TokensPerMinute, now),
+	}
+	d.rateLimiters[vendor.Name()] = limiter
+	return limiter
+}
+
+// forgetRateLimiter drops a vendor's limiter, so a vendor registered under
+// the same name starts afresh with its own limits
+func (d *Dispatcher) forgetRateLimiter(name string) {
+	d.rateLimitersMutex.Lock()
+	delete(d.rateLimiters, name)
+	d.rateLimitersMutex.Unlock()
+}
+
+// waitForRateLimit admits one request to vendor under its RateLimit.
+// tokens estimates the request's tokens; it may run the tokenizer, so it
+// is only called for vendors with a TokensPerMinute limit. Over the limit,
+// waitForRateLimit fails with ErrRateLimitExceeded, or waits for capacity
+// when Config.WaitForRateLimit is set.
+func (d *Dispatcher) waitForRateLimit(ctx context.Context, vendor models.LLMVendor, tokens func() int) error {
+	limiter := d.rateLimiter(vendor)
+	if limiter == nil {
+		return nil
+	}
+	n := 0
+	if limiter.tokens != nil {
+		n = tokens()
+	}
+
+	for {
+		wait := limiter.reserve(n, time.Now())
+		if wait <= 0 {
+			return nil
+		}
+		if !d.config.WaitForRateLimit {
+			return fmt.Errorf("%w: vendor %s is rate limited for another %v", models.ErrRateLimitExceeded, vendor.Name(), wait.Round(time.Millisecond))
+		}
+
+		d.logger.Info("Vendor is rate limited, waiting", "vendor", vendor.Name(), "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// requestTokens estimates the tokens a request will use against a vendor's
+// TokensPerMinute: its prompt plus the most it may generate
+func (d *Dispatcher) requestTokens(req *models.Request) int {
+	return d.estimateUsage(req, "").PromptTokens + max(req.MaxTokens, 0)
+}
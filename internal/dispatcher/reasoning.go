@@ -0,0 +1,49 @@
+package dispatcher
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// separateReasoning keeps a reasoning model's reasoning out of a response's
+// content. Reasoning the model wrote into its content in <think> tags, as
+// DeepSeek-R1 and similar open models do, is moved to ReasoningContent.
+// Unless the request has IncludeReasoning, the reasoning and its token
+// count are then dropped from the response.
+func separateReasoning(req *models.Request, response *models.Response) {
+	if response == nil {
+		return
+	}
+
+	if reasoning, content, ok := splitThinkTags(response.Content); ok {
+		if response.ReasoningContent != "" {
+			reasoning = response.ReasoningContent + "\n" + reasoning
+		}
+		response.ReasoningContent = reasoning
+		response.Content = content
+	}
+
+	if !req.IncludeReasoning {
+		response.ReasoningContent = ""
+		response.Usage.ReasoningTokens = 0
+	}
+}
+
+// splitThinkTags splits content that opens with a <think> block into the
+// block's text and the content after it. It reports false when the content
+// has no complete leading block.
+func splitThinkTags(content string) (reasoning, rest string, ok bool) {
+	const open, close = "<think>", "</think>"
+
+	trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+	if !strings.HasPrefix(trimmed, open) {
+		return "", content, false
+	}
+	reasoning, rest, ok = strings.Cut(trimmed[len(open):], close)
+	if !ok {
+		return "", content, false
+	}
+	return strings.TrimSpace(reasoning), strings.TrimLeftFunc(rest, unicode.IsSpace), true
+}
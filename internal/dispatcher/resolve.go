@@ -0,0 +1,55 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// ResolveRequest returns the request as Send would hand it to a vendor and
+// the name of that vendor, without sending it, counting it in the stats or
+// consulting the caches. The transformations run in the order Send applies
+// them:
+//
+//  1. validation, then normalization: model rewrites, the model allow and
+//     deny lists, stop sequence clean-up, system message dedup and merging,
+//     and content length limits
+//  2. vendor selection by the request's mode, whose strategy preprocesses
+//     the context, optimizes the request and picks a model when none was
+//     requested
+//  3. the mode's default stop sequences, within the vendor's limit
+//  4. the feature check against the vendor's model, MaxTokens defaulting,
+//     Config.HardMaxMessages and the request's MaxCost
+//
+// The selection is the one Send would make now; vendors the strategy ranks
+// as fallbacks, and the caller's request, are left alone.
+func (d *Dispatcher) ResolveRequest(ctx context.Context, req *models.Request) (*models.Request, string, error) {
+	if ctx == nil || req == nil {
+		return nil, "", models.ErrInvalidRequest
+	}
+
+	req, err := d.prepareRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mode := d.resolveMode(req)
+	vendor, _, _, err := d.selectVendorWithMode(ctx, req, mode)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to select vendor: %w", err)
+	}
+	d.applyModeStopSequences(ctx, req, vendor, mode)
+
+	if err := d.checkFeatures(ctx, vendor, req.Model, req.RequiredFeatures()); err != nil {
+		return nil, "", err
+	}
+	resolveVendorDefaultMaxTokens(req)
+	if err := d.checkHardMaxMessages(req); err != nil {
+		return nil, "", err
+	}
+	if err := d.checkMaxCost(req, vendor.Name()); err != nil {
+		return nil, "", err
+	}
+	return req, vendor.Name(), nil
+}
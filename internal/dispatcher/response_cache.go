@@ -0,0 +1,137 @@
+package dispatcher
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+const defaultResponseCacheSize = 1000
+
+// responseCache stores responses by a hash of the request they answered and
+// serves them for identical requests, evicting the least recently used
+type responseCache struct {
+	maxEntries       int
+	ttl              time.Duration
+	allowTemperature bool
+
+	mu      sync.Mutex
+	order   *list.List // of *responseCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type responseCacheEntry struct {
+	key      string
+	response *models.Response
+	// expiresAt is zero for entries that never expire
+	expiresAt time.Time
+}
+
+// newResponseCache returns nil unless the config enables the cache
+func newResponseCache(config *models.CacheConfig) *responseCache {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	cache := &responseCache{
+		maxEntries:       config.MaxEntries,
+		ttl:              config.TTL,
+		allowTemperature: config.AllowNonZeroTemperature,
+		order:            list.New(),
+		entries:          make(map[string]*list.Element),
+	}
+	if cache.maxEntries <= 0 {
+		cache.maxEntries = defaultResponseCacheSize
+	}
+	return cache
+}
+
+// cacheable reports whether a request's response may be served from and
+// stored in the cache
+func (c *responseCache) cacheable(req *models.Request) bool {
+	if c == nil || req.NoCache || req.Stream {
+		return false
+	}
+	return req.Temperature <= 0 || c.allowTemperature
+}
+
+// lookup returns a copy of the unexpired response cached under key, marking
+// it as the most recently used
+func (c *responseCache) lookup(key string) (*models.Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+
+	response := *entry.response
+	return &response, true
+}
+
+// store caches a response under key that expires after ttl, or the cache's
+// default TTL when ttl is zero, evicting the least recently used response
+// when the cache is full
+func (c *responseCache) store(key string, response *models.Response, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	stored := *response
+	entry := &responseCacheEntry{key: key, response: &stored, expiresAt: expiresAt}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+}
+
+// responseCacheKey hashes the normalized request along with its resolved
+// mode, which picks the model when none is requested. Only fields that
+// leave the response unchanged are left out.
+func responseCacheKey(req *models.Request, mode models.Mode) string {
+	keyed := *req
+	keyed.Stream = false
+	keyed.NoCache = false
+	keyed.CacheTTL = 0
+	keyed.RetryableErrors = nil
+	keyed.MaxCost = 0
+	keyed.User = ""
+	// The resolved mode stands in for the ones requested
+	keyed.Mode = ""
+	keyed.Tier = ""
+
+	data, _ := json.Marshal(struct {
+		Request *models.Request `json:"request"`
+		Mode    models.Mode     `json:"mode"`
+	}{&keyed, mode})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package dispatcher
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+const (
+	defaultSimilarityThreshold = 0.95
+	defaultSemanticCacheSize   = 1000
+)
+
+// semanticCache stores responses by prompt embedding and serves them for
+// prompts that are similar enough, not just identical
+type semanticCache struct {
+	embedder   models.Embedder
+	threshold  float64
+	maxEntries int
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	entries []semanticCacheEntry
+}
+
+type semanticCacheEntry struct {
+	scope     string
+	embedding []float64
+	response  *models.Response
+	// expiresAt is zero for entries that never expire
+	expiresAt time.Time
+}
+
+// expired reports whether the entry's TTL has passed
+func (e semanticCacheEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// newSemanticCache returns nil unless the config enables the cache and
+// provides an embedder
+func newSemanticCache(config *models.SemanticCacheConfig) *semanticCache {
+	if config == nil || !config.Enabled || config.Embedder == nil {
+		return nil
+	}
+
+	cache := &semanticCache{
+		embedder:   config.Embedder,
+		threshold:  config.SimilarityThreshold,
+		maxEntries: config.MaxEntries,
+		ttl:        config.TTL,
+	}
+	if cache.threshold <= 0 {
+		cache.threshold = defaultSimilarityThreshold
+	}
+	if cache.maxEntries <= 0 {
+		cache.maxEntries = defaultSemanticCacheSize
+	}
+	return cache
+}
+
+// lookup returns a copy of the most similar unexpired cached response in
+// the scope when its similarity reaches the threshold
+func (c *semanticCache) lookup(scope string, embedding []float64) (*models.Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var best *models.Response
+	bestScore := c.threshold
+	for _, entry := range c.entries {
+		if entry.scope != scope || entry.expired(now) {
+			continue
+		}
+		if score := cosineSimilarity(entry.embedding, embedding); score >= bestScore {
+			best = entry.response
+			bestScore = score
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+
+	response := *best
+	return &response, true
+}
+
+// store adds a response that expires after ttl, or the cache's default TTL
+// when ttl is zero. When the cache is full expired entries are dropped
+// first, and then the cheapest entry is evicted.
+func (c *semanticCache) store(scope string, embedding []float64, response *models.Response, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.maxEntries {
+		live := c.entries[:0]
+		for _, entry := range c.entries {
+			if !entry.expired(now) {
+				live = append(live, entry)
+			}
+		}
+		c.entries = live
+	}
+	if len(c.entries) >= c.maxEntries {
+		cheapest := 0
+		for i, entry := range c.entries {
+			if entry.response.EstimatedCost < c.entries[cheapest].response.EstimatedCost {
+				cheapest = i
+			}
+		}
+		c.entries = append(c.entries[:cheapest], c.entries[cheapest+1:]...)
+	}
+
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	stored := *response
+	c.entries = append(c.entries, semanticCacheEntry{
+		scope:     scope,
+		embedding: embedding,
+		response:  &stored,
+		expiresAt: expiresAt,
+	})
+}
+
+// semanticCacheScope identifies the requests whose prompts may share cached
+// responses: those alike in everything but their messages, including the
+// mode they resolve to, their tools and their response format
+func semanticCacheScope(req *models.Request, mode models.Mode) string {
+	scoped := *req
+	scoped.Messages = nil
+	return responseCacheKey(&scoped, mode)
+}
+
+// semanticCacheable reports whether a request's prompt is fully captured by
+// its text. Images aren't embedded, so prompts that differ only in their
+// images would share a cached response.
+func semanticCacheable(req *models.Request) bool {
+	for i := range req.Messages {
+		if req.Messages[i].HasImage() {
+			return false
+		}
+	}
+	return true
+}
+
+// promptText flattens a request's messages into the text that is embedded
+func promptText(req *models.Request) string {
+	var b strings.Builder
+	for i := range req.Messages {
+		msg := &req.Messages[i]
+		b.WriteString(msg.Role)
+		b.WriteString(": ")
+		b.WriteString(msg.Text())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or
+// 0 when their lengths differ or either is zero
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,198 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// sessionSummaryPrefix introduces the summary of evicted messages
+const sessionSummaryPrefix = "Summary of the earlier conversation: "
+
+// Session holds a conversation and sends it through the dispatcher as a
+// whole, keeping it within a token budget as messages are appended
+type Session struct {
+	dispatcher *Dispatcher
+	config     models.SessionConfig
+
+	mu       sync.Mutex
+	messages []models.Message
+	// summary condenses messages evicted by SessionEvictSummarizeOldest
+	summary string
+}
+
+// NewSession creates an empty session that sends through the dispatcher.
+// A nil config leaves the session unbounded.
+func (d *Dispatcher) NewSession(config *models.SessionConfig) (*Session, error) {
+	session := &Session{dispatcher: d}
+	if config != nil {
+		session.config = *config
+	}
+
+	switch session.config.Eviction {
+	case "":
+		session.config.Eviction = models.SessionEvictDropOldest
+	case models.SessionEvictDropOldest, models.SessionEvictError:
+	case models.SessionEvictSummarizeOldest:
+		if session.config.Summarizer == nil {
+			return nil, fmt.Errorf("%w: session eviction %s requires a summarizer", models.ErrInvalidConfig, session.config.Eviction)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown session eviction %q", models.ErrInvalidConfig, session.config.Eviction)
+	}
+	return session, nil
+}
+
+// Messages returns the conversation as it is sent, with the summary of
+// evicted messages after the leading system messages
+func (s *Session) Messages() []models.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conversation()
+}
+
+// Append adds messages to the session and evicts older ones to stay within
+// the token budget. When the budget can't be met the session is left
+// unchanged and ErrSessionBudgetExceeded is returned.
+func (s *Session) Append(ctx context.Context, messages ...models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.messages
+	s.messages = append(s.messages[:len(s.messages):len(s.messages)], messages...)
+	if err := s.enforceBudget(ctx); err != nil {
+		s.messages = previous
+		return err
+	}
+	return nil
+}
+
+// Send appends req's messages to the session and sends the whole
+// conversation with req's other settings. The response is appended to the
+// session as an assistant message.
+func (s *Session) Send(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if req == nil {
+		return nil, fmt.Errorf("%w: request cannot be nil", models.ErrInvalidRequest)
+	}
+	if err := s.Append(ctx, req.Messages...); err != nil {
+		return nil, err
+	}
+
+	sessionReq := req.Clone()
+	sessionReq.Messages = s.Messages()
+	response, err := s.dispatcher.Send(ctx, sessionReq)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, models.Message{Role: "assistant", Content: response.Content})
+	s.mu.Unlock()
+	return response, nil
+}
+
+// conversation returns the messages with the summary inserted after the
+// leading system messages
+func (s *Session) conversation() []models.Message {
+	if s.summary == "" {
+		return append([]models.Message(nil), s.messages...)
+	}
+
+	conversation := make([]models.Message, 0, len(s.messages)+1)
+	leading := 0
+	for leading < len(s.messages) && s.messages[leading].Role == "system" {
+		leading++
+	}
+	conversation = append(conversation, s.messages[:leading]...)
+	conversation = append(conversation, models.Message{Role: "system", Content: sessionSummaryPrefix + s.summary})
+	return append(conversation, s.messages[leading:]...)
+}
+
+// enforceBudget evicts the oldest messages other than system messages and
+// the latest message until the conversation fits the budget
+func (s *Session) enforceBudget(ctx context.Context) error {
+	if s.config.MaxTokens <= 0 {
+		return nil
+	}
+	over := s.messageTokens(s.conversation()) - s.config.MaxTokens
+	if over <= 0 {
+		return nil
+	}
+	if s.config.Eviction == models.SessionEvictError {
+		return fmt.Errorf("%w: %d tokens over the budget of %d", models.ErrSessionBudgetExceeded, over, s.config.MaxTokens)
+	}
+
+	// A new summary replaces the current one, freeing its tokens
+	freed := 0
+	if s.summary != "" {
+		freed = s.countTokens(sessionSummaryPrefix + s.summary)
+	}
+	var kept, evicted []models.Message
+	last := len(s.messages) - 1
+	for i, msg := range s.messages {
+		if freed >= over || msg.Role == "system" || i == last {
+			kept = append(kept, msg)
+			continue
+		}
+		evicted = append(evicted, msg)
+		freed += s.countTokens(msg.Text())
+	}
+	if freed < over {
+		return fmt.Errorf("%w: pinned messages need %d tokens more than the budget of %d", models.ErrSessionBudgetExceeded, over-freed, s.config.MaxTokens)
+	}
+
+	if s.config.Eviction == models.SessionEvictSummarizeOldest {
+		if s.summary != "" {
+			evicted = append([]models.Message{{Role: "system", Content: sessionSummaryPrefix + s.summary}}, evicted...)
+		}
+		summary, err := s.config.Summarizer.Summarize(ctx, evicted)
+		if err != nil {
+			return fmt.Errorf("failed to summarize session: %w", err)
+		}
+		s.summary = s.fitSummary(summary, s.config.MaxTokens-s.messageTokens(kept))
+	} else {
+		s.summary = ""
+	}
+	s.messages = kept
+	return nil
+}
+
+// fitSummary cuts a summary to the longest start that takes at most room
+// tokens with its prefix, dropping it when there is no room for any of it
+func (s *Session) fitSummary(summary string, room int) string {
+	summary = strings.TrimSpace(summary)
+	if s.countTokens(sessionSummaryPrefix+summary) <= room {
+		return summary
+	}
+
+	// Token counts grow with the text's length, so the longest fitting
+	// start can be found by bisection
+	fits, over := 0, len(summary)
+	for over-fits > 1 {
+		mid := (fits + over) / 2
+		if s.countTokens(sessionSummaryPrefix+strings.ToValidUTF8(summary[:mid], "")) <= room {
+			fits = mid
+		} else {
+			over = mid
+		}
+	}
+	return strings.ToValidUTF8(summary[:fits], "")
+}
+
+// messageTokens counts the tokens of the messages' texts
+func (s *Session) messageTokens(messages []models.Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += s.countTokens(msg.Text())
+	}
+	return tokens
+}
+
+// countTokens counts the tokens of text with the dispatcher's TokenCounter.
+// A session's messages may be sent to any model, so no model is named.
+func (s *Session) countTokens(text string) int {
+	return s.dispatcher.countTokens("", text)
+}
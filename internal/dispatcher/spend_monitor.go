@@ -0,0 +1,112 @@
+package dispatcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+const (
+	defaultSpendRateWindow     = time.Minute
+	defaultSpendBaselineWindow = time.Hour
+	defaultSpendRateMultiplier = 10.0
+)
+
+// spendMonitor watches the spend rate and reports spikes against its
+// rolling baseline
+type spendMonitor struct {
+	window         time.Duration
+	baselineWindow time.Duration
+	multiplier     float64
+	onAnomaly      func(rate, baseline float64)
+	// now is replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	started   time.Time
+	samples   []spendSample
+	lastAlert time.Time
+}
+
+type spendSample struct {
+	at   time.Time
+	cost float64
+}
+
+// newSpendMonitor returns nil unless the config sets an OnSpendAnomaly
+// callback
+func newSpendMonitor(config *models.SpendRateAlertConfig) *spendMonitor {
+	if config == nil || config.OnSpendAnomaly == nil {
+		return nil
+	}
+
+	monitor := &spendMonitor{
+		window:         config.Window,
+		baselineWindow: config.BaselineWindow,
+		multiplier:     config.Multiplier,
+		onAnomaly:      config.OnSpendAnomaly,
+		now:            time.Now,
+	}
+	if monitor.window <= 0 {
+		monitor.window = defaultSpendRateWindow
+	}
+	if monitor.baselineWindow <= 0 {
+		monitor.baselineWindow = defaultSpendBaselineWindow
+	}
+	if monitor.multiplier <= 0 {
+		monitor.multiplier = defaultSpendRateMultiplier
+	}
+	monitor.started = monitor.now()
+	return monitor
+}
+
+// record adds a request's cost and raises an alert when the spend rate
+// over the last window exceeds the multiple of the baseline. It is a no-op
+// on a nil monitor.
+func (m *spendMonitor) record(cost float64) {
+	if m == nil || cost <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.samples = append(m.samples, spendSample{at: now, cost: cost})
+
+	windowStart := now.Add(-m.window)
+	baselineStart := windowStart.Add(-m.baselineWindow)
+	if baselineStart.Before(m.started) {
+		baselineStart = m.started
+	}
+
+	// Drop samples older than the baseline window
+	keep := 0
+	for keep < len(m.samples) && m.samples[keep].at.Before(baselineStart) {
+		keep++
+	}
+	m.samples = m.samples[keep:]
+
+	var windowCost, baselineCost float64
+	for _, sample := range m.samples {
+		if sample.at.After(windowStart) {
+			windowCost += sample.cost
+		} else {
+			baselineCost += sample.cost
+		}
+	}
+
+	baselineSpan := windowStart.Sub(baselineStart)
+	if baselineSpan < m.window || baselineCost <= 0 {
+		return
+	}
+	rate := windowCost / m.window.Minutes()
+	baseline := baselineCost / baselineSpan.Minutes()
+	if rate <= baseline*m.multiplier || now.Sub(m.lastAlert) < m.window {
+		return
+	}
+
+	m.lastAlert = now
+	go m.onAnomaly(rate, baseline)
+}
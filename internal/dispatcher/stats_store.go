@@ -0,0 +1,152 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// defaultStatsFlushInterval is how often stats are saved to the configured
+// StatsStore when no interval is set
+const defaultStatsFlushInterval = 30 * time.Second
+
+// FileStatsStore is a StatsStore that keeps stats as JSON in a file.
+// Saves write a temporary file in the same directory and rename it over
+// the old one, so a crash mid-write never leaves a truncated file behind.
+type FileStatsStore struct {
+	path string
+}
+
+// NewFileStatsStore creates a store backed by the file at path
+func NewFileStatsStore(path string) *FileStatsStore {
+	return &FileStatsStore{path: path}
+}
+
+// Save atomically replaces the stored stats
+func (s *FileStatsStore) Save(stats *models.DispatcherStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace stats file: %w", err)
+	}
+	return nil
+}
+
+// Load returns the stored stats, or nil when the file doesn't exist yet
+func (s *FileStatsStore) Load() (*models.DispatcherStats, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats: %w", err)
+	}
+
+	var stats models.DispatcherStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// loadStats restores the stats saved in the configured store. A store that
+// fails to load is logged and the dispatcher starts from empty stats.
+func (d *Dispatcher) loadStats() {
+	stored, err := d.config.StatsStore.Load()
+	if err != nil {
+		d.logger.Error("Failed to load stats", "error", err)
+		return
+	}
+	if stored == nil {
+		return
+	}
+
+	if stored.VendorStats == nil {
+		stored.VendorStats = make(map[string]models.VendorStats)
+	}
+	if stored.ModeStats == nil {
+		stored.ModeStats = make(map[models.Mode]*models.ModeStats)
+	}
+	d.statsMutex.Lock()
+	d.stats = stored
+	d.statsMutex.Unlock()
+}
+
+// flushStatsLoop saves stats to the configured store every interval until
+// Close is called
+func (d *Dispatcher) flushStatsLoop(interval time.Duration) {
+	defer close(d.statsFlushDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.FlushStats(); err != nil {
+				d.logger.Error("Failed to flush stats", "error", err)
+			}
+		case <-d.statsFlushStop:
+			return
+		}
+	}
+}
+
+// FlushStats saves the current stats to the configured StatsStore. The
+// stats lock is only held to take a snapshot, never while writing, so a
+// slow store doesn't hold up requests. It is a no-op without a store.
+func (d *Dispatcher) FlushStats() error {
+	if d.config.StatsStore == nil {
+		return nil
+	}
+
+	return d.config.StatsStore.Save(d.GetStats())
+}
+
+// Close stops the periodic stats flush and snapshot refresh, closes the
+// Events channel and saves the stats a final time. It is safe to call more
+// than once.
+func (d *Dispatcher) Close() error {
+	flush := false
+	d.closeOnce.Do(func() {
+		d.closeEvents()
+		if d.statsSnapshotStop != nil {
+			close(d.statsSnapshotStop)
+			<-d.statsSnapshotDone
+		}
+		if d.config.StatsStore != nil && d.statsFlushStop != nil {
+			close(d.statsFlushStop)
+			<-d.statsFlushDone
+			flush = true
+		}
+	})
+	if !flush {
+		return nil
+	}
+	return d.FlushStats()
+}
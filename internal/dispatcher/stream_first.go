@@ -0,0 +1,200 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// StreamFromFirst streams the request from several vendors at once, as
+// SendStreamingToVendor does, and returns the stream of the first vendor to
+// produce content, cancelling the others with models.ErrFanOutCancelled. A
+// vendor whose stream fails before its first chunk is passed over for the
+// remaining ones. It returns once the winning stream has produced content,
+// or else with the error of the first vendor in order that failed. When
+// every stream ends without content but one completed, its empty stream is
+// returned.
+func (d *Dispatcher) StreamFromFirst(ctx context.Context, req *models.Request, vendors []string) (*models.StreamingResponse, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context cannot be nil", models.ErrInvalidRequest)
+	}
+	if req == nil {
+		return nil, fmt.Errorf("%w: request cannot be nil", models.ErrInvalidRequest)
+	}
+	if len(vendors) == 0 {
+		return nil, fmt.Errorf("%w: no vendors to stream from", models.ErrInvalidRequest)
+	}
+
+	dst := models.NewStreamingResponseWithBuffer("", "", d.config.StreamBufferSize)
+
+	var mu sync.Mutex
+	winner := -1
+	// claim makes vendor i the winner unless another vendor already is
+	claim := func(i int, src *models.StreamingResponse) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if winner != -1 {
+			return winner == i
+		}
+		winner = i
+		dst.Model, dst.Vendor, dst.CreatedAt = src.Model, src.Vendor, src.CreatedAt
+		return true
+	}
+
+	type outcome struct {
+		index int
+		// src is set for streams that ended, and err for streams that
+		// failed, without content
+		src *models.StreamingResponse
+		err error
+	}
+	// Buffered for every vendor, so streams ending after StreamFromFirst
+	// has returned never block
+	outcomes := make(chan outcome, len(vendors))
+	won := make(chan int, 1)
+
+	cancels := make([]context.CancelCauseFunc, len(vendors))
+	for i, name := range vendors {
+		streamCtx, cancel := context.WithCancelCause(ctx)
+		cancels[i] = cancel
+		go func() {
+			defer cancel(nil)
+
+			src, err := d.SendStreamingToVendor(streamCtx, name, req)
+			if err != nil {
+				outcomes <- outcome{index: i, err: err}
+				return
+			}
+
+			first := true
+			completed, err := readStream(src, func(content string) bool {
+				if first {
+					if !claim(i, src) {
+						return false
+					}
+					first = false
+					won <- i
+				}
+				return dst.Send(content)
+			})
+			if !completed {
+				// Lost the race, or the consumer closed the stream
+				cancel(models.ErrFanOutCancelled)
+				src.Close()
+				return
+			}
+			if first {
+				outcomes <- outcome{index: i, src: src, err: err}
+				return
+			}
+			finishStream(dst, src, err)
+		}()
+	}
+
+	errs := make([]error, len(vendors))
+	var empty *models.StreamingResponse
+	for range vendors {
+		select {
+		case i := <-won:
+			for j, cancel := range cancels {
+				if j != i {
+					cancel(models.ErrFanOutCancelled)
+				}
+			}
+			return dst, nil
+		case o := <-outcomes:
+			errs[o.index] = o.err
+			if o.err == nil && empty == nil {
+				empty = o.src
+			}
+			if o.err != nil {
+				d.logger.Warn("Stream failed before content, waiting for the other vendors", "vendor", vendors[o.index], "error", o.err)
+			}
+		}
+	}
+
+	// Every stream ended without content
+	if empty != nil {
+		dst.Model, dst.Vendor, dst.CreatedAt = empty.Model, empty.Vendor, empty.CreatedAt
+		finishStream(dst, empty, nil)
+		return dst, nil
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, models.ErrVendorUnavailable
+}
+
+// readStream reads a stream to its end, passing each content chunk to
+// forward in order, and returns the stream's error. It returns false when
+// forward does, leaving the rest of the stream unread.
+func readStream(src *models.StreamingResponse, forward func(string) bool) (completed bool, err error) {
+	// drain forwards content already buffered when the stream ends, since
+	// select gives no ordering between the source channels
+	drain := func() bool {
+		for {
+			select {
+			case content, ok := <-src.ContentChan:
+				if !ok {
+					return true
+				}
+				if !forward(content) {
+					return false
+				}
+			default:
+				return true
+			}
+		}
+	}
+
+	for {
+		select {
+		case content, ok := <-src.ContentChan:
+			if ok {
+				if !forward(content) {
+					return false, nil
+				}
+				continue
+			}
+			// A stream closed after failing still holds its error
+			select {
+			case err = <-src.ErrorChan:
+			default:
+			}
+			return true, err
+		case err = <-src.ErrorChan:
+			return drain(), err
+		case _, ok := <-src.DoneChan:
+			if !drain() {
+				return false, nil
+			}
+			if !ok {
+				select {
+				case err = <-src.ErrorChan:
+				default:
+				}
+			}
+			return true, err
+		}
+	}
+}
+
+// finishStream ends dst as src ended: failing with err, or done with src's
+// usage and sizes
+func finishStream(dst, src *models.StreamingResponse, err error) {
+	defer dst.Close()
+	if err != nil {
+		dst.SendError(err)
+		return
+	}
+	dst.Usage = src.Usage
+	dst.UsageEstimated = src.UsageEstimated
+	dst.RawEvents = src.RawEvents
+	dst.RequestBytes = src.RequestBytes
+	dst.ResponseBytes = src.ResponseBytes
+	dst.SendDone()
+}
@@ -0,0 +1,436 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// relayStream forwards a vendor stream through a new streaming response so
+// the dispatcher can observe it. The time from start to the first content
+// chunk is recorded as the vendor's time-to-first-token, and the total
+// duration and chunk count are recorded when the stream ends. The relayed
+// stream buffers Config.StreamBufferSize chunks; when it is full the relay
+// stops reading from the vendor, passing backpressure upstream.
+//
+// When resume is set and the vendor stream fails before its first chunk,
+// resume is called to continue from a replacement stream. The failed
+// stream's duration is recorded against the original vendor and the rest
+// against the replacement's, but the relayed stream keeps reporting the
+// original vendor.
+//
+// When reconnect is set and the vendor stream's connection drops, reconnect
+// is called with the content received so far to continue from a new
+// stream, up to Config.MaxStreamReconnects times.
+//
+// When the stream completes without the vendor reporting usage, the usage
+// is estimated from req's messages and the streamed content and flagged
+// with UsageEstimated. The stream's cost is added to the stats either way.
+//
+// Completed streams are recorded with Config.Recorder. Under
+// Config.FailClosedOnRecordError the content is held back until the stream
+// has been recorded, and a failed record fails the stream instead.
+//
+// When ctx is cancelled the relayed stream fails with the context's error
+// and the vendor stream is closed, stopping its producer, as it is when the
+// consumer closes the relayed stream. release is called once the relay
+// ends.
+func (d *Dispatcher) relayStream(ctx context.Context, release context.CancelFunc, vendorName string, req *models.Request, start time.Time, src *models.StreamingResponse, resume func() (string, *models.StreamingResponse, time.Time, bool), reconnect func(partial string) (*models.StreamingResponse, bool)) *models.StreamingResponse {
+	dst := models.NewStreamingResponseWithBuffer(src.Model, src.Vendor, d.config.StreamBufferSize)
+	dst.CreatedAt = src.CreatedAt
+
+	go func() {
+		defer release()
+		defer dst.Close()
+
+		firstChunk := true
+		chunks := 0
+		reconnects := 0
+		var received strings.Builder
+		// Raw events of vendor streams replaced by resume or reconnect
+		var rawEvents []json.RawMessage
+		// Content held back until the stream is recorded
+		hold := d.holdStreamsForAudit()
+		var held []string
+		// forward reports false when the consumer has closed the stream
+		forward := func(content string) bool {
+			if firstChunk {
+				firstChunk = false
+				d.recordTTFT(vendorName, time.Since(start))
+			}
+			chunks++
+			received.WriteString(content)
+			if hold {
+				held = append(held, content)
+				return true
+			}
+			return dst.Send(content)
+		}
+
+		// finish records the stream's stats before signalling the consumer
+		finish := func(err error) {
+			d.recordStreamCompletion(vendorName, time.Since(start), chunks)
+			model := dst.Model
+			if model == "" {
+				model = req.Model
+			}
+			if err != nil {
+				d.emitEvent(vendorName, model, time.Since(start), 0.0, 0, err)
+				dst.SendError(err)
+				return
+			}
+			d.recordPayloadSizes(vendorName, src.RequestBytes, src.ResponseBytes)
+			dst.Usage = src.Usage
+			dst.RequestBytes = src.RequestBytes
+			dst.ResponseBytes = src.ResponseBytes
+			dst.RawEvents = append(rawEvents, src.RawEvents...)
+			if dst.Usage.TotalTokens == 0 {
+				dst.Usage = d.estimateUsage(req, received.String())
+				dst.UsageEstimated = true
+			}
+			cost := d.recordStreamCost(vendorName, model, dst.Usage, dst.UsageEstimated)
+			recorded := &models.Response{
+				Content:       received.String(),
+				Usage:         dst.Usage,
+				Model:         model,
+				Vendor:        vendorName,
+				CreatedAt:     dst.CreatedAt,
+				EstimatedCost: cost,
+				CostEstimated: dst.UsageEstimated,
+			}
+			if err := d.recordAudit(ctx, req, recorded); err != nil {
+				d.emitEvent(vendorName, model, time.Since(start), cost, dst.Usage.TotalTokens, err)
+				dst.SendError(err)
+				return
+			}
+			d.emitEvent(vendorName, model, time.Since(start), cost, dst.Usage.TotalTokens, nil)
+			for _, content := range held {
+				if !dst.Send(content) {
+					return
+				}
+			}
+			dst.SendDone()
+		}
+
+		// drain forwards content already buffered when the stream finishes,
+		// since select gives no ordering between the source channels
+		drain := func() bool {
+			for {
+				select {
+				case content, ok := <-src.ContentChan:
+					if !ok {
+						return true
+					}
+					if !forward(content) {
+						return false
+					}
+				default:
+					return true
+				}
+			}
+		}
+
+		for {
+			var err error
+			select {
+			case content, ok := <-src.ContentChan:
+				if ok {
+					if !forward(content) {
+						src.Close()
+						return
+					}
+					continue
+				}
+				// A stream closed after failing still holds its error
+				select {
+				case err = <-src.ErrorChan:
+				default:
+				}
+			case err = <-src.ErrorChan:
+				if !drain() {
+					src.Close()
+					return
+				}
+			case _, ok := <-src.DoneChan:
+				if !drain() {
+					src.Close()
+					return
+				}
+				if !ok {
+					select {
+					case err = <-src.ErrorChan:
+					default:
+					}
+				}
+			case <-ctx.Done():
+				src.Close()
+				finish(ctx.Err())
+				return
+			}
+
+			if err != nil && firstChunk && resume != nil {
+				failedAfter := time.Since(start)
+				if name, next, nextStart, resumed := resume(); resumed {
+					// The failed attempt is the original vendor's stream;
+					// the replacement's TTFT and duration are its own
+					d.recordStreamCompletion(vendorName, failedAfter, 0)
+					rawEvents = append(rawEvents, src.RawEvents...)
+					vendorName, src, start = name, next, nextStart
+					// Reconnecting would re-send to the failed vendor
+					resume, reconnect = nil, nil
+					continue
+				}
+			}
+			if reconnect != nil && reconnects < d.config.MaxStreamReconnects && errors.Is(err, models.ErrStreamInterrupted) {
+				reconnects++
+				if next, reconnected := reconnect(received.String()); reconnected {
+					rawEvents = append(rawEvents, src.RawEvents...)
+					src = next
+					continue
+				}
+			}
+			finish(err)
+			return
+		}
+	}()
+
+	return dst
+}
+
+// SendStreamingCollected sends a streaming request and collects the stream
+// into a single response with CollectStream
+func (d *Dispatcher) SendStreamingCollected(ctx context.Context, req *models.Request) (*models.Response, error) {
+	stream, err := d.SendStreaming(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return d.CollectStream(ctx, stream)
+}
+
+// CollectStream reads stream until it is done and returns its content as a
+// response, closing the stream when it returns. An error after some
+// content, including ctx ending, is handled according to
+// Config.StreamPartialContentPolicy.
+func (d *Dispatcher) CollectStream(ctx context.Context, stream *models.StreamingResponse) (*models.Response, error) {
+	defer stream.Close()
+
+	var content strings.Builder
+	drain := func() {
+		for len(stream.ContentChan) > 0 {
+			content.WriteString(<-stream.ContentChan)
+		}
+	}
+
+	var streamErr error
+	// pendingErr picks up an error sent just before the stream was closed
+	pendingErr := func() error {
+		select {
+		case err := <-stream.ErrorChan:
+			return err
+		default:
+			return nil
+		}
+	}
+collect:
+	for {
+		select {
+		case chunk, ok := <-stream.ContentChan:
+			if !ok {
+				streamErr = pendingErr()
+				break collect
+			}
+			content.WriteString(chunk)
+		case _, ok := <-stream.DoneChan:
+			drain()
+			if !ok {
+				streamErr = pendingErr()
+			}
+			break collect
+		case err := <-stream.ErrorChan:
+			// A nil error means the stream was closed after it was done
+			drain()
+			streamErr = err
+			break collect
+		case <-ctx.Done():
+			drain()
+			streamErr = ctx.Err()
+			break collect
+		}
+	}
+
+	response := &models.Response{
+		Content:      content.String(),
+		Model:        stream.Model,
+		Vendor:       stream.Vendor,
+		FinishReason: "stop",
+		CreatedAt:    stream.CreatedAt,
+	}
+	if streamErr == nil {
+		response.Usage = stream.Usage
+		return response, nil
+	}
+	if content.Len() == 0 {
+		return nil, streamErr
+	}
+
+	switch d.config.StreamPartialContentPolicy {
+	case models.StreamPartialContentComplete:
+		return response, nil
+	case models.StreamPartialContentReturn:
+		response.FinishReason = "error"
+		return response, streamErr
+	default:
+		return nil, streamErr
+	}
+}
+
+// streamReconnector returns the reconnect func for relayStream, which re-sends
+// req to vendor with the partial content as an assistant prefill. It returns
+// nil when reconnects are disabled or the vendor can't continue a prefill.
+func (d *Dispatcher) streamReconnector(ctx context.Context, vendor models.LLMVendor, req *models.Request) func(partial string) (*models.StreamingResponse, bool) {
+	if d.config.MaxStreamReconnects <= 0 {
+		return nil
+	}
+	prefiller, ok := vendor.(models.AssistantPrefiller)
+	if !ok || !prefiller.SupportsAssistantPrefill() {
+		return nil
+	}
+
+	return func(partial string) (*models.StreamingResponse, bool) {
+		d.logger.Warn("Stream was interrupted, reconnecting", "vendor", vendor.Name(), "characters", len(partial))
+
+		resumeReq := req.Clone()
+		// Vendors reject prefills ending in whitespace; the model
+		// restores it when continuing
+		if prefill := strings.TrimRight(partial, " \t\r\n"); prefill != "" {
+			last := len(resumeReq.Messages) - 1
+			if last >= 0 && resumeReq.Messages[last].Role == "assistant" {
+				// Continue the caller's own prefill
+				resumeReq.Messages[last].Content += prefill
+			} else {
+				resumeReq.Messages = append(resumeReq.Messages, models.Message{Role: "assistant", Content: prefill})
+			}
+		}
+
+		next, err := vendor.SendStreamingRequest(ctx, resumeReq)
+		if err != nil {
+			d.logger.Warn("Reconnecting stream failed", "vendor", vendor.Name(), "error", err)
+			return nil, false
+		}
+		return next, true
+	}
+}
+
+// unaryStream serves a streaming request from a vendor that cannot stream.
+// The request is sent as a unary request and the complete response is
+// returned as a stream holding a single content chunk followed by done.
+func (d *Dispatcher) unaryStream(ctx context.Context, vendor models.LLMVendor, req *models.Request, start time.Time) (*models.StreamingResponse, error) {
+	req.Stream = false
+
+	response, err := d.sendWithRetry(ctx, vendor, req)
+	if err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), 0.0)
+		d.emitEvent(vendor.Name(), req.Model, time.Since(start), 0.0, 0, err)
+		return nil, err
+	}
+
+	separateReasoning(req, response)
+	d.repairJSONOutput(vendor.Name(), req, response)
+	d.recordRateLimits(vendor.Name(), response)
+	d.recordResponseSizes(vendor.Name(), response)
+	estimatedCost := d.responseCost(vendor.Name(), req, response)
+	if err := d.recordAudit(ctx, req, response); err != nil {
+		d.updateStats(false, vendor.Name(), time.Since(start), estimatedCost)
+		d.emitEvent(vendor.Name(), responseModel(req, response), time.Since(start), estimatedCost, responseTokens(response), err)
+		return nil, err
+	}
+	d.updateStats(true, vendor.Name(), time.Since(start), estimatedCost)
+	d.emitEvent(vendor.Name(), responseModel(req, response), time.Since(start), estimatedCost, responseTokens(response), nil)
+
+	model := response.Model
+	if model == "" {
+		model = req.Model
+	}
+	streamingResp := models.NewStreamingResponseWithBuffer(model, vendor.Name(), d.config.StreamBufferSize)
+	streamingResp.Usage = response.Usage
+	if response.Raw != nil {
+		streamingResp.RawEvents = []json.RawMessage{response.Raw}
+	}
+	if response.Content != "" {
+		streamingResp.ContentChan <- response.Content
+	}
+	streamingResp.DoneChan <- true
+	streamingResp.Close()
+
+	return streamingResp, nil
+}
+
+// recordTTFT folds a time-to-first-token sample into the vendor's stats
+func (d *Dispatcher) recordTTFT(vendorName string, ttft time.Duration) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	stats := d.stats.VendorStats[vendorName]
+	stats.TTFTSamples++
+	stats.AverageTTFT += (ttft - stats.AverageTTFT) / time.Duration(stats.TTFTSamples)
+	d.stats.VendorStats[vendorName] = stats
+}
+
+// recordStreamCompletion folds a finished stream's duration and chunk
+// count into the vendor's stats
+func (d *Dispatcher) recordStreamCompletion(vendorName string, duration time.Duration, chunks int) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	stats := d.stats.VendorStats[vendorName]
+	stats.StreamCount++
+	stats.AverageStreamDuration += (duration - stats.AverageStreamDuration) / time.Duration(stats.StreamCount)
+	stats.TotalStreamChunks += int64(chunks)
+	stats.AverageStreamChunks = float64(stats.TotalStreamChunks) / float64(stats.StreamCount)
+	d.stats.VendorStats[vendorName] = stats
+}
+
+// recordStreamCost adds the cost of a completed stream's usage to the
+// stats. Streams are counted when they start, before their usage is known.
+// Estimated usage is counted in the vendor's MissingUsageCount. It returns
+// the cost.
+func (d *Dispatcher) recordStreamCost(vendorName, model string, usage models.Usage, estimated bool) float64 {
+	cost := d.usageCost(usage, vendorName, model)
+	d.spendMonitor.record(cost)
+
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	d.stats.TotalCost += cost
+	if d.stats.CostSamples > 0 {
+		d.stats.AverageCost = d.stats.TotalCost / float64(d.stats.CostSamples)
+	}
+
+	stats := d.stats.VendorStats[vendorName]
+	stats.TotalCost += cost
+	if stats.Successes > 0 {
+		stats.AverageCost = stats.TotalCost / float64(stats.Successes)
+	}
+	if estimated {
+		stats.MissingUsageCount++
+		d.stats.EstimatedCostCount++
+	}
+	d.stats.VendorStats[vendorName] = stats
+	return cost
+}
+
+// vendorStatsSnapshot returns a copy of the per-vendor stats
+func (d *Dispatcher) vendorStatsSnapshot() map[string]models.VendorStats {
+	d.statsMutex.RLock()
+	defer d.statsMutex.RUnlock()
+
+	snapshot := make(map[string]models.VendorStats, len(d.stats.VendorStats))
+	for name, stats := range d.stats.VendorStats {
+		snapshot[name] = stats
+	}
+	return snapshot
+}
@@ -0,0 +1,67 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// RunToolLoop sends req and, while the model answers with tool calls, runs
+// them with executor and sends their results back, for at most maxRounds
+// round-trips. It returns the model's final answer with the usage and cost
+// of every round added up.
+//
+// When the model is still calling tools after maxRounds, the last response
+// is returned, its tool calls unexecuted, together with an error wrapping
+// ErrToolRoundsExceeded. A failed tool call ends the loop with its error.
+// A ToolChoice that forces a tool call applies to the first round only, so
+// the model can answer once it has the results.
+func (d *Dispatcher) RunToolLoop(ctx context.Context, req *models.Request, executor models.ToolExecutor, maxRounds int) (*models.Response, error) {
+	if req == nil || executor == nil {
+		return nil, models.ErrInvalidRequest
+	}
+	if maxRounds <= 0 {
+		return nil, fmt.Errorf("%w: maxRounds must be positive", models.ErrInvalidRequest)
+	}
+
+	req = req.Clone()
+	response, err := d.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	usage, cost := response.Usage, response.EstimatedCost
+
+	for round := 1; len(response.ToolCalls) > 0; round++ {
+		if round > maxRounds {
+			response.Usage, response.EstimatedCost = usage, cost
+			return response, fmt.Errorf("%w: model still calling tools after %d rounds", models.ErrToolRoundsExceeded, maxRounds)
+		}
+
+		req.Messages = append(req.Messages, models.Message{
+			Role:      "assistant",
+			Content:   response.Content,
+			ToolCalls: response.ToolCalls,
+		})
+		for _, call := range response.ToolCalls {
+			result, err := executor.Execute(ctx, call)
+			if err != nil {
+				return nil, fmt.Errorf("tool %s (call %s) failed: %w", call.Name, call.ID, err)
+			}
+			req.Messages = append(req.Messages, models.Message{Role: "tool", ToolCallID: call.ID, Content: result})
+		}
+		if req.ToolChoice != models.ToolChoiceAuto && req.ToolChoice != models.ToolChoiceNone {
+			req.ToolChoice = ""
+		}
+
+		response, err = d.Send(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("tool round %d: %w", round, err)
+		}
+		usage = usage.Add(response.Usage)
+		cost += response.EstimatedCost
+	}
+
+	response.Usage, response.EstimatedCost = usage, cost
+	return response, nil
+}
@@ -0,0 +1,88 @@
+// Package metrics exposes the dispatcher's request statistics as Prometheus
+// metrics, for scraping instead of polling GetStats.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics records completed requests in a registry of its own, so several
+// dispatchers in one process don't collide. A nil *Metrics records nothing.
+type Metrics struct {
+	registry  *prometheus.Registry
+	requests  *prometheus.CounterVec
+	successes *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	cost      *prometheus.CounterVec
+	tokens    *prometheus.CounterVec
+}
+
+// New creates the metrics, all labeled by vendor
+func New() *Metrics {
+	labels := []string{"vendor"}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llmdispatcher_requests_total",
+			Help: "Requests completed, successfully or not.",
+		}, labels),
+		successes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llmdispatcher_request_successes_total",
+			Help: "Requests that succeeded.",
+		}, labels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llmdispatcher_request_failures_total",
+			Help: "Requests that failed.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "llmdispatcher_request_duration_seconds",
+			Help:    "Time taken by requests, including retries.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, labels),
+		cost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llmdispatcher_cost_total",
+			Help: "Estimated cost of requests, in dollars.",
+		}, labels),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llmdispatcher_tokens_total",
+			Help: "Tokens used by requests.",
+		}, labels),
+	}
+	m.registry.MustRegister(m.requests, m.successes, m.failures, m.latency, m.cost, m.tokens)
+	return m
+}
+
+// Observe records a completed request
+func (m *Metrics) Observe(event models.RequestEvent) {
+	if m == nil {
+		return
+	}
+
+	m.requests.WithLabelValues(event.Vendor).Inc()
+	if event.Success {
+		m.successes.WithLabelValues(event.Vendor).Inc()
+	} else {
+		m.failures.WithLabelValues(event.Vendor).Inc()
+	}
+	m.latency.WithLabelValues(event.Vendor).Observe(event.Latency.Seconds())
+	if event.Cost > 0 {
+		m.cost.WithLabelValues(event.Vendor).Add(event.Cost)
+	}
+	if event.Tokens > 0 {
+		m.tokens.WithLabelValues(event.Vendor).Add(float64(event.Tokens))
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format, or
+// answers 404 when m is nil
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_Observe(t *testing.T) {
+	m := New()
+	m.Observe(models.RequestEvent{Vendor: "openai", Success: true, Latency: 300 * time.Millisecond, Cost: 0.02, Tokens: 150})
+	m.Observe(models.RequestEvent{Vendor: "openai", Success: true, Latency: 2 * time.Second, Cost: 0.01, Tokens: 50})
+	m.Observe(models.RequestEvent{Vendor: "anthropic", Latency: time.Second, Error: errors.New("timeout")})
+
+	tests := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"openai requests", testutil.ToFloat64(m.requests.WithLabelValues("openai")), 2},
+		{"openai successes", testutil.ToFloat64(m.successes.WithLabelValues("openai")), 2},
+		{"openai cost", testutil.ToFloat64(m.cost.WithLabelValues("openai")), 0.03},
+		{"openai tokens", testutil.ToFloat64(m.tokens.WithLabelValues("openai")), 200},
+		{"anthropic requests", testutil.ToFloat64(m.requests.WithLabelValues("anthropic")), 1},
+		{"anthropic failures", testutil.ToFloat64(m.failures.WithLabelValues("anthropic")), 1},
+	}
+	for _, tt := range tests {
+		if diff := tt.value - tt.expected; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Expected %s to be %v, got %v", tt.name, tt.expected, tt.value)
+		}
+	}
+
+	if count := testutil.CollectAndCount(m.latency); count != 2 {
+		t.Errorf("Expected a latency histogram for each vendor, got %d", count)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	m.Observe(models.RequestEvent{Vendor: "openai", Success: true})
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without metrics, got %d", recorder.Code)
+	}
+}
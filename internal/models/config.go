@@ -3,6 +3,9 @@ package models
 import (
 	"context"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -23,6 +26,19 @@ const (
 	AutoMode Mode = "auto"
 )
 
+// Tier returns the capability tier whose model the mode prefers. Cost
+// saving uses the fast tier, which is also the cheapest.
+func (m Mode) Tier() string {
+	switch m {
+	case FastMode, CostSavingMode:
+		return TierFast
+	case SophisticatedMode:
+		return TierSophisticated
+	default:
+		return TierBalanced
+	}
+}
+
 // ModeContext represents the context and state for a specific mode
 type ModeContext struct {
 	Mode             Mode
@@ -31,6 +47,19 @@ type ModeContext struct {
 	Config           *Config
 	Stats            *ModeStats
 	Context          context.Context
+	// VendorStats is a snapshot of observed per-vendor metrics for
+	// latency-aware selection; it may be nil
+	VendorStats map[string]VendorStats
+	// SelectionReason is set by SelectVendor to explain its choice for
+	// routing traces. Strategies that leave it empty are reported as
+	// RoutingReasonHeuristic.
+	SelectionReason RoutingReason
+	// FallbackVendors may be set by SelectVendor to the vendors Send tries,
+	// in order, when the selected vendor fails
+	FallbackVendors []LLMVendor
+	// Rand drives the random choice among fallback vendors; it may be
+	// nil, in which case they are tried in name order
+	Rand *rand.Rand
 }
 
 // ModeStats tracks mode-specific performance metrics
@@ -117,14 +146,548 @@ type Config struct {
 	EnableLogging bool          `json:"enable_logging"`
 	EnableMetrics bool          `json:"enable_metrics"`
 
+	// Least severe messages the dispatcher logs, defaulting to LogLevelInfo.
+	// Debug messages are only logged when EnableLogging is also set.
+	LogLevel LogLevel `json:"log_level,omitempty"`
+
+	// Destination of the dispatcher's log messages, replacing the default
+	// standard library logger. It receives messages of every level, leaving
+	// LogLevel and EnableLogging for it to apply.
+	Logger Logger `json:"-"`
+
+	// Extra time allowed per requested output token, so requests with a
+	// larger MaxTokens get proportionally longer than Timeout. The
+	// effective timeout is Timeout + TimeoutPerToken*MaxTokens, capped at
+	// MaxTimeout when it is set.
+	TimeoutPerToken time.Duration `json:"timeout_per_token,omitempty"`
+	MaxTimeout      time.Duration `json:"max_timeout,omitempty"`
+
 	// Retry configuration
 	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty"`
 
+	// Retry responses with blank content, which vendors occasionally return
+	// on transient faults. Responses blank because a content filter blocked
+	// them are not retried. Retries count against RetryPolicy.MaxRetries,
+	// and once they are used up the blank response is returned as it is.
+	RetryOnEmptyResponse bool `json:"retry_on_empty_response,omitempty"`
+
 	// Mode-specific overrides (optional)
 	ModeOverrides *ModeOverrides `json:"mode_overrides,omitempty"`
 
+	// Implementations of the preprocessing rule types used in
+	// ModeOverrides.ContextPreprocessing (optional). Nil uses
+	// NewPreprocessorRegistry, which has the built-in types only.
+	Preprocessors *PreprocessorRegistry `json:"-"`
+
+	// Seed for the random choice among fallback vendors, so routing can be
+	// reproduced in tests and experiments. Zero seeds from the current time.
+	RoutingSeed int64 `json:"routing_seed,omitempty"`
+
+	// Break ties between equally ranked vendors by choosing the one least
+	// recently used, per VendorStats.LastUsed, instead of at random or by
+	// name, so load spreads evenly across them
+	LRUTieBreak bool `json:"lru_tie_break,omitempty"`
+
 	// Context preprocessing configuration
 	ContextPreprocessing *ContextPreprocessingConfig `json:"context_preprocessing,omitempty"`
+
+	// Automatically trim the conversation history and retry once when a
+	// vendor rejects a request as too large
+	AutoTrimOnPayloadTooLarge bool `json:"auto_trim_on_payload_too_large,omitempty"`
+
+	// Number of content chunks buffered between a stream and its consumer,
+	// defaulting to DefaultStreamBufferSize. A full buffer blocks the vendor
+	// stream until the consumer catches up, so a small buffer keeps memory
+	// bounded for slow consumers while a large one lets fast producers (such
+	// as local models) run ahead without stalling.
+	StreamBufferSize int `json:"stream_buffer_size,omitempty"`
+
+	// Remove exact-duplicate system messages that directly follow one
+	// another, e.g. when stored history and the caller both add the same
+	// system prompt. Runs before any other message normalization and before
+	// mode preprocessing.
+	DedupSystemMessages bool `json:"dedup_system_messages,omitempty"`
+
+	// How requests with several system messages are sent, defaulting to
+	// SystemMessagesKeep. Vendors that accept a single system prompt, such
+	// as Anthropic, always get the system messages joined with
+	// DefaultSystemMessageSeparator unless they were merged here first.
+	// SystemMessageSeparator defaults to DefaultSystemMessageSeparator.
+	SystemMessagePolicy    SystemMessagePolicy `json:"system_message_policy,omitempty"`
+	SystemMessageSeparator string              `json:"system_message_separator,omitempty"`
+
+	// What to do when the selected vendor's capabilities don't list the
+	// requested model, defaulting to UnknownModelForward. Vendors that list
+	// no models at all are always forwarded to.
+	UnknownVendorModelPolicy UnknownModelPolicy `json:"unknown_vendor_model_policy,omitempty"`
+
+	// What to do when the selected vendor's estimate for a request exceeds
+	// its MaxCost, defaulting to MaxCostReject
+	MaxCostPolicy MaxCostPolicy `json:"max_cost_policy,omitempty"`
+
+	// Prices used to estimate costs, by vendor and model, taking precedence
+	// over DefaultPricingTable for the models they list
+	Pricing PricingTable `json:"pricing,omitempty"`
+
+	// Vendor that Send falls back to, once, when the selected vendor's
+	// request still fails after its retries and the mode strategy's own
+	// fallbacks. It is skipped when unavailable or already tried.
+	FallbackVendor string `json:"fallback_vendor,omitempty"`
+
+	// Vendor that takes over a streaming request when the selected vendor
+	// fails before sending any content. It must support streaming and is
+	// only used by SendStreaming.
+	StreamingFallbackVendor string `json:"streaming_fallback_vendor,omitempty"`
+
+	// Serve streaming requests routed to a vendor without streaming support
+	// with a unary request, returning its response as a single-chunk stream
+	// instead of failing
+	FallbackToUnaryStreaming bool `json:"fallback_to_unary_streaming,omitempty"`
+
+	// How long to spend probing the candidate vendors afresh when all of
+	// them report themselves unavailable, before failing with
+	// ErrNoEligibleVendor. Vendors implementing HealthProber are probed
+	// with ProbeHealth, others with IsAvailable. Zero disables the recheck.
+	HealthRecheckTimeout time.Duration `json:"health_recheck_timeout,omitempty"`
+
+	// How long selection waits for the vendors' IsAvailable checks, run
+	// concurrently, defaulting to DefaultAvailabilityCheckTimeout. Vendors
+	// that haven't answered by then are treated as unavailable for the
+	// request. A negative timeout disables the bound.
+	AvailabilityCheckTimeout time.Duration `json:"availability_check_timeout,omitempty"`
+
+	// What CollectStream and SendStreamingCollected return when a stream
+	// fails after some content has arrived, defaulting to
+	// StreamPartialContentError. A stream that fails before any content
+	// always returns its error.
+	StreamPartialContentPolicy StreamPartialContentPolicy `json:"stream_partial_content_policy,omitempty"`
+
+	// Number of times a stream whose connection drops mid-stream is
+	// transparently reconnected. The request is re-sent with the content
+	// received so far as an assistant prefill, so only vendors implementing
+	// AssistantPrefiller are reconnected. Errors reported by the vendor are
+	// never retried this way.
+	MaxStreamReconnects int `json:"max_stream_reconnects,omitempty"`
+
+	// Maximum content length in characters for messages of a role, e.g. to
+	// keep a huge tool result from filling the context. Roles without an
+	// entry are unlimited. ContentLengthPolicy decides what happens to a
+	// message over its limit.
+	MaxContentLengthByRole map[string]int      `json:"max_content_length_by_role,omitempty"`
+	ContentLengthPolicy    ContentLengthPolicy `json:"content_length_policy,omitempty"`
+
+	// Hard ceiling on the number of messages forwarded to a vendor. It is
+	// checked after summarization, windowing and every other preprocessing
+	// step, right before the request is sent; requests still over it fail
+	// with ErrTooManyMessagesAfterPreprocessing. Zero disables the check.
+	HardMaxMessages int `json:"hard_max_messages,omitempty"`
+
+	// MaxTokens for requests that leave it unset. DefaultMaxTokensByModel
+	// maps model names or glob patterns (e.g. "gpt-4o*") to a default for
+	// the model the request resolves to; an exact name wins over patterns,
+	// and a longer pattern over a shorter one. Other models get
+	// DefaultMaxTokens. Both take precedence over the mode strategies' own
+	// defaults; zero leaves the default to the mode.
+	DefaultMaxTokens        int            `json:"default_max_tokens,omitempty"`
+	DefaultMaxTokensByModel map[string]int `json:"default_max_tokens_by_model,omitempty"`
+
+	// Record on each response how its vendor was selected, in
+	// Response.RoutingTrace
+	RecordRoutingTrace bool `json:"record_routing_trace,omitempty"`
+
+	// Repair common JSON malformations, such as trailing commas or unquoted
+	// keys, in responses to requests with ResponseFormatJSON. Content that
+	// can't be repaired is returned as the vendor sent it.
+	RepairJSONOutput bool `json:"repair_json_output,omitempty"`
+
+	// Attach the vendor's untouched response body to Response.Raw, and its
+	// stream events to StreamingResponse.RawEvents, for debugging. Off by
+	// default since it keeps every response body in memory.
+	IncludeRawResponse bool `json:"include_raw_response,omitempty"`
+
+	// Record the average sizes of the request and response bodies
+	// exchanged with each vendor in VendorStats.AvgRequestBytes and
+	// AvgResponseBytes. Streams count all the bytes received.
+	TrackPayloadSizes bool `json:"track_payload_sizes,omitempty"`
+
+	// Make requests wait for capacity when they would exceed the RateLimit
+	// of the vendor they are sent to, instead of failing at once with
+	// ErrRateLimitExceeded. Vendors report their limits through
+	// RateLimitProvider; the wait is bounded by the request's context.
+	WaitForRateLimit bool `json:"wait_for_rate_limit,omitempty"`
+
+	// Keeps an audit record of every response returned (optional),
+	// including responses served from a cache and completed streams. A
+	// failed record is logged and the response returned anyway, unless
+	// FailClosedOnRecordError is set, in which case the request fails with
+	// ErrAuditFailed. Streams then hold back their content until they have
+	// been recorded.
+	Recorder                Recorder `json:"-"`
+	FailClosedOnRecordError bool     `json:"fail_closed_on_record_error,omitempty"`
+
+	// Counts tokens for cost estimates, rate limits and the mode
+	// strategies' cost checks, defaulting to a BPETokenCounter (optional)
+	TokenCounter TokenCounter `json:"-"`
+
+	// Exact-match response caching (optional)
+	Cache *CacheConfig `json:"cache,omitempty"`
+
+	// Semantic response caching (optional)
+	SemanticCache *SemanticCacheConfig `json:"semantic_cache,omitempty"`
+
+	// Per-model default modes, consulted in order when a request doesn't
+	// specify a mode. The first matching rule wins; Mode is the fallback.
+	ModelModeRules []ModelModeRule `json:"model_mode_rules,omitempty"`
+
+	// Mode for each service tier named in Request.Tier, e.g. routing
+	// "free" requests in CostSavingMode and "premium" ones in
+	// SophisticatedMode. A tier's mode overrides ModelModeRules and Mode,
+	// but not an explicit Request.Mode. Requests for a tier not listed
+	// here are rejected.
+	TierRouting map[string]Mode `json:"tier_routing,omitempty"`
+
+	// Glob patterns (e.g. "gpt-4*") restricting the models a request may
+	// ask for. An empty AllowedModels allows every model; a model matching
+	// DeniedModels is rejected even if it is allowed. For requests that
+	// leave the model to mode selection, vendors whose model for the mode is
+	// excluded are passed over. Patterns match vendor-prefixed IDs as
+	// described by MatchModelPattern.
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	DeniedModels  []string `json:"denied_models,omitempty"`
+
+	// Central model rewrites, e.g. sending all "gpt-4" traffic to
+	// "gpt-4o". ModelRewrites maps exact model names; ModelRewriter, if
+	// set, then receives the result and returns the model to use. Rewrites
+	// apply before the allowed and denied models are checked and before
+	// vendor selection, and the response reports the original model in
+	// RequestedModel.
+	ModelRewrites map[string]string   `json:"model_rewrites,omitempty"`
+	ModelRewriter func(string) string `json:"-"`
+
+	// Persists stats across restarts (optional). Stored stats are loaded
+	// when the dispatcher is created and flushed every StatsFlushInterval,
+	// defaulting to 30 seconds, and on Close.
+	StatsStore         StatsStore    `json:"-"`
+	StatsFlushInterval time.Duration `json:"stats_flush_interval,omitempty"`
+
+	// How often the lock-free copy of stats returned by StatsSnapshot is
+	// refreshed (optional). Zero disables the snapshot, and StatsSnapshot
+	// then reads the live stats.
+	StatsSnapshotInterval time.Duration `json:"stats_snapshot_interval,omitempty"`
+
+	// Alerting on spikes in the spend rate, such as a runaway loop
+	// (optional)
+	SpendRateAlert *SpendRateAlertConfig `json:"spend_rate_alert,omitempty"`
+
+	// Stop routing to a vendor that keeps failing until it has had time to
+	// recover (optional)
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+
+	// Number of request events buffered for the consumer of
+	// Dispatcher.Events, defaulting to DefaultEventBufferSize. Events that
+	// arrive while the buffer is full are dropped and counted in
+	// DispatcherStats.DroppedEvents.
+	EventBufferSize int `json:"event_buffer_size,omitempty"`
+}
+
+// Recorder persists an audit record of a request and the response its
+// vendor returned
+type Recorder interface {
+	Record(ctx context.Context, req *Request, resp *Response) error
+}
+
+// Logger receives the dispatcher's log messages. keysAndValues alternate
+// between a string key and its value, e.g. "vendor", "openai", "attempt", 2.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// StatsStore saves and loads dispatcher stats, so cumulative counters such
+// as TotalCost survive process restarts
+type StatsStore interface {
+	Save(stats *DispatcherStats) error
+	// Load returns the saved stats, or nil when none have been saved yet
+	Load() (*DispatcherStats, error)
+}
+
+// SystemMessagePolicy decides how a request's system messages are sent
+type SystemMessagePolicy string
+
+const (
+	// SystemMessagesKeep sends system messages as they are. It is the
+	// default policy.
+	SystemMessagesKeep SystemMessagePolicy = "keep"
+
+	// SystemMessagesMerge joins all system messages, in order, into one
+	// system message in place of the first
+	SystemMessagesMerge SystemMessagePolicy = "merge"
+)
+
+// UnknownModelPolicy decides how a request is routed when the selected
+// vendor doesn't list its model
+type UnknownModelPolicy string
+
+const (
+	// UnknownModelForward sends the request to the vendor anyway, e.g. for
+	// a model released after the vendor's list was written. It is the
+	// default policy.
+	UnknownModelForward UnknownModelPolicy = "forward"
+
+	// UnknownModelError fails the request with ErrModelNotOffered
+	UnknownModelError UnknownModelPolicy = "error"
+
+	// UnknownModelFallback sends the request to another candidate vendor
+	// that lists the model, failing with ErrModelNotOffered if none does
+	UnknownModelFallback UnknownModelPolicy = "fallback"
+)
+
+// LogLevel decides which messages the dispatcher logs
+type LogLevel string
+
+const (
+	// LogLevelDebug also logs per-request detail, such as each request's
+	// model and mode as it is validated
+	LogLevelDebug LogLevel = "debug"
+
+	// LogLevelInfo logs routing decisions, retries and fallbacks. It is the
+	// default level.
+	LogLevelInfo LogLevel = "info"
+
+	// LogLevelNone logs nothing
+	LogLevelNone LogLevel = "none"
+)
+
+// MaxCostPolicy decides what happens to a request whose estimated cost on
+// the selected vendor exceeds its MaxCost
+type MaxCostPolicy string
+
+const (
+	// MaxCostReject fails the request with ErrRequestCostExceeded. It is the
+	// default policy.
+	MaxCostReject MaxCostPolicy = "reject"
+
+	// MaxCostDowngrade sends the request to the cheapest other candidate
+	// vendor whose estimate is within the cap, failing with
+	// ErrRequestCostExceeded if there is none
+	MaxCostDowngrade MaxCostPolicy = "downgrade"
+)
+
+// DefaultSystemMessageSeparator separates merged system messages
+const DefaultSystemMessageSeparator = "\n\n"
+
+// DefaultAvailabilityCheckTimeout bounds the vendors' availability checks
+// during selection when Config.AvailabilityCheckTimeout is not set
+const DefaultAvailabilityCheckTimeout = 2 * time.Second
+
+// StreamPartialContentPolicy decides how a stream that fails after sending
+// some content is collected into a response
+type StreamPartialContentPolicy string
+
+const (
+	// StreamPartialContentError discards the partial content and returns
+	// the stream's error with no response. It is the default policy.
+	StreamPartialContentError StreamPartialContentPolicy = "error"
+
+	// StreamPartialContentComplete treats the stream as finished: the
+	// content received so far is returned as a successful response with
+	// finish reason "stop" and no error. It suits consumers that cancel
+	// the stream once they have what they need.
+	StreamPartialContentComplete StreamPartialContentPolicy = "complete-as-success"
+
+	// StreamPartialContentReturn returns the content received so far in a
+	// response with finish reason "error", together with the stream's
+	// error
+	StreamPartialContentReturn StreamPartialContentPolicy = "return-partial"
+)
+
+// ContentLengthPolicy decides how messages over their role's maximum
+// content length are handled
+type ContentLengthPolicy string
+
+const (
+	// ContentLengthTruncate cuts oversized content down to the limit. It is
+	// the default policy.
+	ContentLengthTruncate ContentLengthPolicy = "truncate"
+
+	// ContentLengthError rejects requests with oversized content
+	ContentLengthError ContentLengthPolicy = "error"
+)
+
+// CacheConfig configures the exact-match response cache. A cached response
+// is returned for a request that matches the one it answered in its
+// resolved mode and every field that shapes the response, such as its
+// model, messages, tools and sampling parameters. Streaming requests are
+// never cached.
+type CacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// Maximum number of stored responses, defaulting to 1000. When full the
+	// least recently used response is evicted.
+	MaxEntries int `json:"max_entries,omitempty"`
+	// How long a response is served from the cache; zero keeps responses
+	// until they are evicted. Request.CacheTTL overrides it per request.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Also cache requests with a Temperature above zero, whose responses
+	// would otherwise vary from call to call
+	AllowNonZeroTemperature bool `json:"allow_non_zero_temperature,omitempty"`
+}
+
+// SemanticCacheConfig configures the embedding-based response cache. A
+// cached response is returned when a new prompt's embedding is at least
+// SimilarityThreshold cosine-similar to a stored prompt of a request that
+// matches the new one in every other field that shapes the response.
+type SemanticCacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// Embedder computes prompt embeddings; the cache is disabled without one
+	Embedder Embedder `json:"-"`
+	// Minimum cosine similarity for a hit, defaulting to 0.95
+	SimilarityThreshold float64 `json:"similarity_threshold,omitempty"`
+	// Maximum number of stored responses, defaulting to 1000. When full the
+	// cheapest response to regenerate is evicted first.
+	MaxEntries int `json:"max_entries,omitempty"`
+	// How long a response is served from the cache; zero keeps responses
+	// until they are evicted. Request.CacheTTL overrides it per request.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// SessionEviction decides how a session over its token budget makes room
+type SessionEviction string
+
+const (
+	// SessionEvictDropOldest drops the oldest messages. It is the default.
+	SessionEvictDropOldest SessionEviction = "drop_oldest"
+
+	// SessionEvictSummarizeOldest replaces the oldest messages with a
+	// summary from SessionConfig.Summarizer
+	SessionEvictSummarizeOldest SessionEviction = "summarize_oldest"
+
+	// SessionEvictError rejects messages that would exceed the budget
+	SessionEvictError SessionEviction = "error"
+)
+
+// SessionConfig configures a conversation session. System messages are
+// never evicted, and neither is the latest message.
+type SessionConfig struct {
+	// Token budget for the whole conversation; zero is unbounded
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// How messages are evicted to stay within MaxTokens, defaulting to
+	// SessionEvictDropOldest
+	Eviction SessionEviction `json:"eviction,omitempty"`
+	// Summarizer is required by SessionEvictSummarizeOldest
+	Summarizer Summarizer `json:"-"`
+}
+
+// FanOutMode decides when SendToAll returns
+type FanOutMode string
+
+const (
+	// FanOutAll waits for every vendor. It is the default mode.
+	FanOutAll FanOutMode = "all"
+
+	// FanOutFirstSuccess returns as soon as one vendor succeeds and
+	// cancels the calls still running
+	FanOutFirstSuccess FanOutMode = "first-success"
+
+	// FanOutFirstN returns as soon as FanOutOptions.N vendors succeed and
+	// cancels the calls still running
+	FanOutFirstN FanOutMode = "first-n"
+)
+
+// FanOutOptions configures SendToAll
+type FanOutOptions struct {
+	// Vendors to send to, defaulting to all registered vendors
+	Vendors []string `json:"vendors,omitempty"`
+	// Maximum number of vendor calls in flight at once; zero is unbounded
+	MaxParallel int `json:"max_parallel,omitempty"`
+	// When to return, defaulting to FanOutAll
+	Mode FanOutMode `json:"mode,omitempty"`
+	// Number of successes FanOutFirstN waits for
+	N int `json:"n,omitempty"`
+}
+
+// FanOutResult is one vendor's outcome in SendToAll. Calls cancelled, or
+// never started, because the fan-out already had enough successes fail
+// with ErrFanOutCancelled.
+type FanOutResult struct {
+	Vendor   string        `json:"vendor"`
+	Response *Response     `json:"response,omitempty"`
+	Err      error         `json:"-"`
+	Latency  time.Duration `json:"latency"`
+}
+
+// CircuitBreakerConfig configures the per-vendor circuit breakers. A
+// vendor's circuit opens after FailureThreshold consecutive failed calls
+// within Window, and while it is open the vendor is left out of selection.
+// After Cooldown the circuit half-opens: the vendor gets a single probe
+// call, which closes the circuit if it succeeds or reopens it if it fails.
+// Only 5xx, 408 and 429 responses, network errors and the vendor's own
+// timeouts count as failures; rejected requests and calls the caller
+// cancelled or let time out don't.
+type CircuitBreakerConfig struct {
+	// Consecutive failures that open the circuit, defaulting to 5
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// Time the failures must fall within; zero counts them however far
+	// apart they are
+	Window time.Duration `json:"window,omitempty"`
+	// How long the circuit stays open, defaulting to 30 seconds
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+}
+
+// CircuitState is the state of a vendor's circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerStats describes a vendor's circuit breaker
+type CircuitBreakerStats struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	// When the circuit last opened, zero if it never has
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+// SpendRateAlertConfig configures the spend-rate monitor. The spend rate is
+// the cost per minute over the last Window; the baseline is the cost per
+// minute over the BaselineWindow before it. OnSpendAnomaly is called when
+// the rate exceeds Multiplier times the baseline.
+type SpendRateAlertConfig struct {
+	// Window over which the current rate is measured, defaulting to one
+	// minute. Alerts are also at least one Window apart.
+	Window time.Duration `json:"window,omitempty"`
+	// Window over which the baseline rate is averaged, defaulting to one
+	// hour. No alert is raised before one Window of history is recorded.
+	BaselineWindow time.Duration `json:"baseline_window,omitempty"`
+	// How many times the baseline the rate must exceed, defaulting to 10
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// OnSpendAnomaly receives the rate and baseline in cost per minute. It
+	// runs on its own goroutine so it never delays a request; the monitor
+	// is disabled without it.
+	OnSpendAnomaly func(rate, baseline float64) `json:"-"`
+}
+
+// ModelModeRule maps a model name pattern to the mode used by default for it.
+// Pattern is a glob (e.g. "gpt-4*") or, when it contains no glob characters,
+// a plain prefix (e.g. "gpt-3.5").
+type ModelModeRule struct {
+	Pattern string `json:"pattern"`
+	Mode    Mode   `json:"mode"`
+}
+
+// Matches reports whether the rule applies to the given model
+func (r ModelModeRule) Matches(model string) bool {
+	if model == "" || r.Pattern == "" {
+		return false
+	}
+	if !strings.ContainsAny(r.Pattern, "*?[") {
+		return strings.HasPrefix(model, r.Pattern)
+	}
+	return MatchModelPattern(r.Pattern, model)
 }
 
 // ContextPreprocessingConfig defines how context should be preprocessed for each mode
@@ -141,9 +704,11 @@ type ContextPreprocessingConfig struct {
 	EnableCompression   bool `json:"enable_compression,omitempty"`
 }
 
-// PreprocessingRule defines a single preprocessing rule
+// PreprocessingRule defines a single preprocessing rule. Type names the
+// Preprocessor in Config.Preprocessors that applies it, and Parameters are
+// passed to it.
 type PreprocessingRule struct {
-	Type       string                 `json:"type"`       // "summarize", "compress", "filter", "enhance"
+	Type       string                 `json:"type"`       // e.g. "truncate", "filter" or a registered type
 	Condition  string                 `json:"condition"`  // When to apply this rule
 	Parameters map[string]interface{} `json:"parameters"` // Rule-specific parameters
 	Priority   int                    `json:"priority"`   // Execution priority (1-10)
@@ -165,6 +730,10 @@ type ModeOverrides struct {
 
 	// Context preprocessing overrides
 	ContextPreprocessing map[Mode]*ContextPreprocessingConfig `json:"context_preprocessing,omitempty"`
+
+	// Default stop sequences added to requests in each mode, e.g. "\n\n" to
+	// curb verbosity in cost-saving mode
+	StopSequences map[Mode][]string `json:"stop_sequences,omitempty"`
 }
 
 // RetryPolicy defines how retries should be handled
@@ -172,6 +741,9 @@ type RetryPolicy struct {
 	MaxRetries      int             `json:"max_retries"`
 	BackoffStrategy BackoffStrategy `json:"backoff_strategy"`
 	RetryableErrors []string        `json:"retryable_errors,omitempty"`
+	// Jitter randomizes each backoff so requests that fail together don't
+	// retry in lockstep. Empty leaves backoffs as the strategy computes them.
+	Jitter JitterStrategy `json:"jitter,omitempty"`
 }
 
 // BackoffStrategy defines the retry backoff strategy
@@ -183,6 +755,17 @@ const (
 	FixedBackoff       BackoffStrategy = "fixed"
 )
 
+// JitterStrategy defines how retry backoffs are randomized
+type JitterStrategy string
+
+const (
+	// FullJitter waits a random time between zero and the backoff
+	FullJitter JitterStrategy = "full"
+	// EqualJitter waits half the backoff plus a random time up to the
+	// other half
+	EqualJitter JitterStrategy = "equal"
+)
+
 // DispatcherStats holds statistics about the dispatcher
 type DispatcherStats struct {
 	TotalRequests      int64                  `json:"total_requests"`
@@ -191,12 +774,54 @@ type DispatcherStats struct {
 	VendorStats        map[string]VendorStats `json:"vendor_stats"`
 	AverageLatency     time.Duration          `json:"average_latency"`
 	LastRequestTime    time.Time              `json:"last_request_time"`
+	// Number of completed requests AverageLatency is the mean of
+	LatencySamples int64 `json:"latency_samples,omitempty"`
 	// Advanced metrics
 	TotalCost    float64            `json:"total_cost"`
 	AverageCost  float64            `json:"average_cost"`
 	CostByVendor map[string]float64 `json:"cost_by_vendor"`
+	// Number of successful vendor responses AverageCost is the mean of.
+	// Failed requests and cached responses incur no cost and aren't counted.
+	CostSamples int64 `json:"cost_samples,omitempty"`
 	// Mode-specific stats
 	ModeStats map[Mode]*ModeStats `json:"mode_stats"`
+	// Response cache stats
+	CacheHits   int64 `json:"cache_hits"`
+	CacheMisses int64 `json:"cache_misses"`
+	// Semantic cache stats
+	SemanticCacheHits   int64 `json:"semantic_cache_hits"`
+	SemanticCacheMisses int64 `json:"semantic_cache_misses"`
+	// Number of responses whose cost was estimated because the vendor
+	// reported no usage
+	EstimatedCostCount int64 `json:"estimated_cost_count"`
+	// Requests by the model they were sent for, after model rewrites
+	RequestsByModel map[string]int64 `json:"requests_by_model,omitempty"`
+	// Vendor calls SendToAll cancelled once it had enough successes. They
+	// are counted as neither successful nor failed.
+	CancelledRequests int64 `json:"cancelled_requests,omitempty"`
+	// Request events dropped because the consumer of Dispatcher.Events
+	// fell behind
+	DroppedEvents int64 `json:"dropped_events,omitempty"`
+	// Circuit breaker of each vendor that has been called, when
+	// Config.CircuitBreaker is set
+	CircuitBreakers map[string]CircuitBreakerStats `json:"circuit_breakers,omitempty"`
+}
+
+// DefaultEventBufferSize is the default number of request events buffered
+// for the consumer of Dispatcher.Events
+const DefaultEventBufferSize = 100
+
+// RequestEvent describes a completed request, as delivered by
+// Dispatcher.Events. Vendor is empty when no vendor could be selected.
+type RequestEvent struct {
+	Vendor    string        `json:"vendor"`
+	Model     string        `json:"model"`
+	Success   bool          `json:"success"`
+	Latency   time.Duration `json:"latency"`
+	Cost      float64       `json:"cost"`
+	Tokens    int           `json:"tokens"`
+	Timestamp time.Time     `json:"timestamp"`
+	Error     error         `json:"-"`
 }
 
 // VendorStats holds statistics for a specific vendor
@@ -207,9 +832,34 @@ type VendorStats struct {
 	AverageLatency time.Duration `json:"average_latency"`
 	LastUsed       time.Time     `json:"last_used"`
 	// Advanced metrics
-	TotalCost   float64 `json:"total_cost"`
+	TotalCost float64 `json:"total_cost"`
+	// Mean cost of the vendor's successful calls
 	AverageCost float64 `json:"average_cost"`
 	TokenUsage  int64   `json:"token_usage"`
+	// Responses that came back without usage
+	MissingUsageCount int64 `json:"missing_usage_count"`
+	// Calls SendToAll cancelled once it had enough successes, which are
+	// not counted as failures
+	Cancellations int64 `json:"cancellations,omitempty"`
+	// Remaining rate limits from the last response that reported them,
+	// parsed from its VendorHeaders
+	RateLimitRemainingRequests int64     `json:"rate_limit_remaining_requests,omitempty"`
+	RateLimitRemainingTokens   int64     `json:"rate_limit_remaining_tokens,omitempty"`
+	RateLimitObservedAt        time.Time `json:"rate_limit_observed_at,omitempty"`
+	// Streaming metrics
+	AverageTTFT           time.Duration `json:"average_ttft"`
+	TTFTSamples           int64         `json:"ttft_samples"`
+	StreamCount           int64         `json:"stream_count"`
+	AverageStreamDuration time.Duration `json:"average_stream_duration"`
+	TotalStreamChunks     int64         `json:"total_stream_chunks"`
+	AverageStreamChunks   float64       `json:"average_stream_chunks"`
+	// Payload size metrics, recorded when Config.TrackPayloadSizes is
+	// enabled. PayloadSamples counts the exchanges measured.
+	PayloadSamples     int64   `json:"payload_samples,omitempty"`
+	TotalRequestBytes  int64   `json:"total_request_bytes,omitempty"`
+	TotalResponseBytes int64   `json:"total_response_bytes,omitempty"`
+	AvgRequestBytes    float64 `json:"avg_request_bytes,omitempty"`
+	AvgResponseBytes   float64 `json:"avg_response_bytes,omitempty"`
 }
 
 // BaseModeStrategy provides common functionality for all mode strategies
@@ -267,28 +917,16 @@ func (b *BaseModeStrategy) OptimizeRequest(ctx *ModeContext) error {
 	return nil
 }
 
-// estimateRequestCost estimates the cost of a request based on token count and vendor cost
-func (b *BaseModeStrategy) estimateRequestCost(req *Request, costPer1KTokens float64) float64 {
-	// Rough estimation based on input length and max tokens
-	inputTokens := b.estimateInputTokens(req)
+// estimateRequestCost estimates the cost of a request based on token count and the model's price
+func (b *BaseModeStrategy) estimateRequestCost(req *Request, counter TokenCounter, price ModelPrice) float64 {
+	// Estimation based on input tokens and max tokens
+	inputTokens := countMessageTokens(counter, req)
 	outputTokens := req.MaxTokens
-	if outputTokens == 0 {
+	if outputTokens <= 0 {
 		outputTokens = 500 // Default estimate
 	}
 
-	totalTokens := inputTokens + outputTokens
-	return (float64(totalTokens) / 1000.0) * costPer1KTokens
-}
-
-// estimateInputTokens roughly estimates the number of tokens in the input
-func (b *BaseModeStrategy) estimateInputTokens(req *Request) int {
-	totalChars := 0
-	for _, msg := range req.Messages {
-		totalChars += len(msg.Content)
-	}
-
-	// Rough estimation: 1 token ≈ 4 characters
-	return totalChars / 4
+	return price.Cost(inputTokens, outputTokens)
 }
 
 // FastModeStrategy implements fast mode behavior
@@ -310,12 +948,22 @@ func (f *FastModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, error) {
 		if preferences, exists := ctx.Config.ModeOverrides.VendorPreferences[FastMode]; exists {
 			for _, vendorName := range preferences {
 				if vendor, exists := ctx.AvailableVendors[vendorName]; exists && vendor.IsAvailable(ctx.Context) {
+					ctx.SelectionReason = RoutingReasonPreference
 					return vendor, nil
 				}
 			}
 		}
 	}
 
+	// Streaming requests go to the vendor with the lowest observed
+	// time-to-first-token, when there is data to compare
+	if ctx.Request.Stream {
+		if vendor := lowestTTFTVendor(ctx); vendor != nil {
+			ctx.SelectionReason = RoutingReasonHeuristic
+			return vendor, nil
+		}
+	}
+
 	// Fast mode intelligence: prioritize vendors known for speed
 	fastVendors := []struct {
 		name     string
@@ -330,15 +978,15 @@ func (f *FastModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, error) {
 
 	for _, fastVendor := range fastVendors {
 		if vendor, exists := ctx.AvailableVendors[fastVendor.name]; exists && vendor.IsAvailable(ctx.Context) {
+			ctx.SelectionReason = RoutingReasonHeuristic
 			return vendor, nil
 		}
 	}
 
 	// Fallback to any available vendor
-	for _, vendor := range ctx.AvailableVendors {
-		if vendor.IsAvailable(ctx.Context) {
-			return vendor, nil
-		}
+	if vendor := anyAvailableVendor(ctx); vendor != nil {
+		ctx.SelectionReason = RoutingReasonFallback
+		return vendor, nil
 	}
 
 	return nil, fmt.Errorf("no available vendors for fast mode")
@@ -350,7 +998,7 @@ func (f *FastModeStrategy) PreprocessContext(ctx *ModeContext) error {
 	// - Truncate long contexts
 	// - Remove unnecessary messages
 	// - Optimize for speed
-	return nil
+	return ExecutePreprocessingRules(ctx)
 }
 
 // OptimizeRequest applies fast mode request optimizations
@@ -371,6 +1019,70 @@ func (f *FastModeStrategy) OptimizeRequest(ctx *ModeContext) error {
 	return nil
 }
 
+// lowestTTFTVendor returns the available vendor with the lowest average
+// time-to-first-token, ignoring vendors without streaming samples
+func lowestTTFTVendor(ctx *ModeContext) LLMVendor {
+	var best LLMVendor
+	var bestTTFT time.Duration
+	for name, stats := range ctx.VendorStats {
+		if stats.TTFTSamples == 0 {
+			continue
+		}
+		vendor, exists := ctx.AvailableVendors[name]
+		if !exists || !vendor.GetCapabilities().SupportsStreaming {
+			continue
+		}
+		if best != nil && stats.AverageTTFT >= bestTTFT {
+			continue
+		}
+		if vendor.IsAvailable(ctx.Context) {
+			best = vendor
+			bestTTFT = stats.AverageTTFT
+		}
+	}
+	return best
+}
+
+// anyAvailableVendor returns a random available vendor, starting from a
+// name drawn from ctx.Rand and trying the others in name order. With
+// Config.LRUTieBreak it returns the least recently used one instead.
+func anyAvailableVendor(ctx *ModeContext) LLMVendor {
+	names := make([]string, 0, len(ctx.AvailableVendors))
+	for name := range ctx.AvailableVendors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if ctx.Config != nil && ctx.Config.LRUTieBreak {
+		var best LLMVendor
+		var bestUsed time.Time
+		for _, name := range names {
+			vendor := ctx.AvailableVendors[name]
+			lastUsed := ctx.VendorStats[name].LastUsed
+			if best != nil && !lastUsed.Before(bestUsed) {
+				continue
+			}
+			if vendor.IsAvailable(ctx.Context) {
+				best = vendor
+				bestUsed = lastUsed
+			}
+		}
+		return best
+	}
+
+	offset := 0
+	if ctx.Rand != nil && len(names) > 0 {
+		offset = ctx.Rand.Intn(len(names))
+	}
+	for i := range names {
+		vendor := ctx.AvailableVendors[names[(offset+i)%len(names)]]
+		if vendor.IsAvailable(ctx.Context) {
+			return vendor
+		}
+	}
+	return nil
+}
+
 // SophisticatedModeStrategy implements sophisticated mode behavior
 type SophisticatedModeStrategy struct {
 	*BaseModeStrategy
@@ -390,6 +1102,7 @@ func (s *SophisticatedModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, e
 		if preferences, exists := ctx.Config.ModeOverrides.VendorPreferences[SophisticatedMode]; exists {
 			for _, vendorName := range preferences {
 				if vendor, exists := ctx.AvailableVendors[vendorName]; exists && vendor.IsAvailable(ctx.Context) {
+					ctx.SelectionReason = RoutingReasonPreference
 					return vendor, nil
 				}
 			}
@@ -410,15 +1123,15 @@ func (s *SophisticatedModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, e
 
 	for _, sophisticatedVendor := range sophisticatedVendors {
 		if vendor, exists := ctx.AvailableVendors[sophisticatedVendor.name]; exists && vendor.IsAvailable(ctx.Context) {
+			ctx.SelectionReason = RoutingReasonHeuristic
 			return vendor, nil
 		}
 	}
 
 	// Fallback to any available vendor
-	for _, vendor := range ctx.AvailableVendors {
-		if vendor.IsAvailable(ctx.Context) {
-			return vendor, nil
-		}
+	if vendor := anyAvailableVendor(ctx); vendor != nil {
+		ctx.SelectionReason = RoutingReasonFallback
+		return vendor, nil
 	}
 
 	return nil, fmt.Errorf("no available vendors for sophisticated mode")
@@ -430,7 +1143,7 @@ func (s *SophisticatedModeStrategy) PreprocessContext(ctx *ModeContext) error {
 	// - Enhance context with additional information
 	// - Add relevant system prompts
 	// - Optimize for quality
-	return nil
+	return ExecutePreprocessingRules(ctx)
 }
 
 // OptimizeRequest applies sophisticated mode request optimizations
@@ -470,6 +1183,7 @@ func (c *CostSavingModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, erro
 		if preferences, exists := ctx.Config.ModeOverrides.VendorPreferences[CostSavingMode]; exists {
 			for _, vendorName := range preferences {
 				if vendor, exists := ctx.AvailableVendors[vendorName]; exists && vendor.IsAvailable(ctx.Context) {
+					ctx.SelectionReason = RoutingReasonPreference
 					return vendor, nil
 				}
 			}
@@ -480,33 +1194,34 @@ func (c *CostSavingModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, erro
 	costSavingVendors := []struct {
 		name     string
 		priority int
-		cost     float64 // Cost per 1K tokens (approximate)
 	}{
-		{"local", 1, 0.0001},    // Local is cheapest (if available)
-		{"google", 2, 0.0005},   // Google is cheap
-		{"openai", 3, 0.002},    // OpenAI is moderate
-		{"anthropic", 4, 0.003}, // Anthropic is pricier
-		{"azure", 5, 0.002},     // Azure is reasonable
+		{"local", 1},     // Local is cheapest (if available)
+		{"google", 2},    // Google is cheap
+		{"together", 3},  // Open models on Together are cheap
+		{"openai", 4},    // OpenAI is moderate
+		{"anthropic", 5}, // Anthropic is pricier
+		{"azure", 6},     // Azure is reasonable
 	}
 
 	for _, costVendor := range costSavingVendors {
 		if vendor, exists := ctx.AvailableVendors[costVendor.name]; exists && vendor.IsAvailable(ctx.Context) {
 			// Check cost limits if specified
 			if ctx.Config.ModeOverrides != nil && ctx.Config.ModeOverrides.MaxCostPerRequest > 0 {
-				estimatedCost := c.estimateRequestCost(ctx.Request, costVendor.cost)
+				price := ctx.Config.Pricing.Price(costVendor.name, ctx.Request.Model)
+				estimatedCost := c.estimateRequestCost(ctx.Request, tokenCounter(ctx.Config), price)
 				if estimatedCost > ctx.Config.ModeOverrides.MaxCostPerRequest {
 					continue // Skip if too expensive
 				}
 			}
+			ctx.SelectionReason = RoutingReasonHeuristic
 			return vendor, nil
 		}
 	}
 
 	// Fallback to any available vendor
-	for _, vendor := range ctx.AvailableVendors {
-		if vendor.IsAvailable(ctx.Context) {
-			return vendor, nil
-		}
+	if vendor := anyAvailableVendor(ctx); vendor != nil {
+		ctx.SelectionReason = RoutingReasonFallback
+		return vendor, nil
 	}
 
 	return nil, fmt.Errorf("no available vendors for cost-saving mode")
@@ -518,7 +1233,7 @@ func (c *CostSavingModeStrategy) PreprocessContext(ctx *ModeContext) error {
 	// - Compress context
 	// - Remove redundant information
 	// - Optimize for cost
-	return nil
+	return ExecutePreprocessingRules(ctx)
 }
 
 // OptimizeRequest applies cost-saving mode request optimizations
@@ -558,6 +1273,7 @@ func (a *AutoModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, error) {
 		if preferences, exists := ctx.Config.ModeOverrides.VendorPreferences[AutoMode]; exists {
 			for _, vendorName := range preferences {
 				if vendor, exists := ctx.AvailableVendors[vendorName]; exists && vendor.IsAvailable(ctx.Context) {
+					ctx.SelectionReason = RoutingReasonPreference
 					return vendor, nil
 				}
 			}
@@ -576,20 +1292,21 @@ func (a *AutoModeStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, error) {
 		{"openai", 2, 4, 3, 4},    // Good balance
 		{"google", 3, 3, 2, 4},    // Cheap, good quality
 		{"local", 4, 5, 1, 3},     // Fast, cheap, decent quality (if available)
-		{"azure", 5, 3, 3, 4},     // Moderate across all
+		{"together", 5, 4, 2, 4},  // Fast, cheap open models
+		{"azure", 6, 3, 3, 4},     // Moderate across all
 	}
 
 	for _, balancedVendor := range balancedVendors {
 		if vendor, exists := ctx.AvailableVendors[balancedVendor.name]; exists && vendor.IsAvailable(ctx.Context) {
+			ctx.SelectionReason = RoutingReasonHeuristic
 			return vendor, nil
 		}
 	}
 
 	// Fallback to any available vendor
-	for _, vendor := range ctx.AvailableVendors {
-		if vendor.IsAvailable(ctx.Context) {
-			return vendor, nil
-		}
+	if vendor := anyAvailableVendor(ctx); vendor != nil {
+		ctx.SelectionReason = RoutingReasonFallback
+		return vendor, nil
 	}
 
 	return nil, fmt.Errorf("no available vendors for auto mode")
@@ -601,7 +1318,7 @@ func (a *AutoModeStrategy) PreprocessContext(ctx *ModeContext) error {
 	// - Analyze context complexity
 	// - Apply appropriate preprocessing based on analysis
 	// - Balance preprocessing cost vs benefit
-	return nil
+	return ExecutePreprocessingRules(ctx)
 }
 
 // OptimizeRequest applies auto mode request optimizations
@@ -2,6 +2,9 @@ package models
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 )
 
 // ContextPreprocessor defines the interface for context preprocessing
@@ -40,7 +43,8 @@ func (b *BaseContextPreprocessor) Priority() int {
 	return b.priority
 }
 
-// ContextLengthPreprocessor truncates context if it exceeds maximum length
+// ContextLengthPreprocessor truncates context if it exceeds maximum length,
+// counted in tokens
 type ContextLengthPreprocessor struct {
 	*BaseContextPreprocessor
 	maxLength int
@@ -57,7 +61,6 @@ func NewContextLengthPreprocessor(maxLength int) *ContextLengthPreprocessor {
 // Preprocess truncates context if it exceeds maximum length
 func (c *ContextLengthPreprocessor) Preprocess(ctx *ModeContext) error {
 	// TODO: Implement context length preprocessing
-	// - Count tokens in context
 	// - Truncate if exceeds maxLength
 	// - Preserve important messages (system, user)
 	// - Remove oldest messages first
@@ -68,10 +71,7 @@ func (c *ContextLengthPreprocessor) Preprocess(ctx *ModeContext) error {
 	}
 
 	// Placeholder implementation
-	totalLength := 0
-	for _, msg := range req.Messages {
-		totalLength += len(msg.Content)
-	}
+	totalLength := countMessageTokens(tokenCounter(ctx.Config), req)
 
 	if totalLength > c.maxLength {
 		// TODO: Implement smart truncation
@@ -241,12 +241,16 @@ func (p *PreprocessingPipeline) AddPreprocessor(preprocessor ContextPreprocessor
 	p.preprocessors = append(p.preprocessors, preprocessor)
 }
 
-// Execute runs all preprocessors in priority order
+// Execute runs all preprocessors in priority order, highest first.
+// Preprocessors of equal priority run in the order they were added.
 func (p *PreprocessingPipeline) Execute(ctx *ModeContext) error {
-	// Sort preprocessors by priority (highest first)
-	// TODO: Implement sorting by priority
+	preprocessors := make([]ContextPreprocessor, len(p.preprocessors))
+	copy(preprocessors, p.preprocessors)
+	sort.SliceStable(preprocessors, func(i, j int) bool {
+		return preprocessors[i].Priority() > preprocessors[j].Priority()
+	})
 
-	for _, preprocessor := range p.preprocessors {
+	for _, preprocessor := range preprocessors {
 		if err := preprocessor.Preprocess(ctx); err != nil {
 			return fmt.Errorf("preprocessor %s failed: %w", preprocessor.Name(), err)
 		}
@@ -284,5 +288,247 @@ func CreateModeSpecificPipeline(mode Mode, config *Config) *PreprocessingPipelin
 		pipeline.AddPreprocessor(NewContextCompressionPreprocessor(0.8))
 	}
 
+	addPreprocessingRules(pipeline, mode, config)
+
 	return pipeline
 }
+
+// ExecutePreprocessingRules runs the preprocessing rules configured for the
+// context's mode in ModeOverrides.ContextPreprocessing, in priority order
+func ExecutePreprocessingRules(ctx *ModeContext) error {
+	pipeline := NewPreprocessingPipeline()
+	addPreprocessingRules(pipeline, ctx.Mode, ctx.Config)
+	return pipeline.Execute(ctx)
+}
+
+// addPreprocessingRules adds the rules configured for mode to the pipeline,
+// resolving each rule's type in config.Preprocessors
+func addPreprocessingRules(pipeline *PreprocessingPipeline, mode Mode, config *Config) {
+	if config == nil || config.ModeOverrides == nil {
+		return
+	}
+	preprocessing := config.ModeOverrides.ContextPreprocessing[mode]
+	if preprocessing == nil {
+		return
+	}
+	if len(preprocessing.EnabledModes) > 0 && !preprocessing.EnabledModes[mode] {
+		return
+	}
+
+	registry := config.Preprocessors
+	if registry == nil {
+		registry = defaultPreprocessorRegistry
+	}
+	for _, rule := range preprocessing.PreprocessingRules[mode] {
+		preprocessor, err := registry.GetPreprocessor(rule.Type)
+		pipeline.AddPreprocessor(&ruleStep{rule: rule, preprocessor: preprocessor, err: err})
+	}
+}
+
+// ruleStep runs a preprocessing rule as a pipeline step
+type ruleStep struct {
+	rule         PreprocessingRule
+	preprocessor Preprocessor
+	// err is set when the rule's type couldn't be resolved
+	err error
+}
+
+func (s *ruleStep) Name() string {
+	return s.rule.Type
+}
+
+func (s *ruleStep) Priority() int {
+	return s.rule.Priority
+}
+
+func (s *ruleStep) Preprocess(ctx *ModeContext) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.preprocessor.Apply(ctx, s.rule.Parameters)
+}
+
+// Preprocessor implements a preprocessing rule type, applying a rule with
+// the given parameters to the context's request
+type Preprocessor interface {
+	Apply(ctx *ModeContext, params map[string]interface{}) error
+}
+
+// PreprocessorFunc adapts a function to the Preprocessor interface
+type PreprocessorFunc func(ctx *ModeContext, params map[string]interface{}) error
+
+// Apply calls f
+func (f PreprocessorFunc) Apply(ctx *ModeContext, params map[string]interface{}) error {
+	return f(ctx, params)
+}
+
+// Built-in preprocessing rule types
+const (
+	// PreprocessTruncate keeps the system messages and the most recent
+	// "max_messages" other messages, and cuts each message's content to
+	// "max_content_length" characters. Either parameter may be omitted.
+	PreprocessTruncate = "truncate"
+
+	// PreprocessFilter drops messages whose role is in "remove_roles", and
+	// non-system messages whose content contains "remove_containing"
+	PreprocessFilter = "filter"
+)
+
+// PreprocessorRegistry maps preprocessing rule types to their
+// implementations
+type PreprocessorRegistry struct {
+	preprocessors map[string]Preprocessor
+}
+
+// defaultPreprocessorRegistry resolves rule types when Config.Preprocessors
+// is nil
+var defaultPreprocessorRegistry = NewPreprocessorRegistry()
+
+// NewPreprocessorRegistry creates a registry with the built-in rule types
+func NewPreprocessorRegistry() *PreprocessorRegistry {
+	registry := &PreprocessorRegistry{
+		preprocessors: make(map[string]Preprocessor),
+	}
+
+	// Register built-in rule types
+	registry.RegisterPreprocessor(PreprocessTruncate, PreprocessorFunc(truncatePreprocessor))
+	registry.RegisterPreprocessor(PreprocessFilter, PreprocessorFunc(filterPreprocessor))
+
+	return registry
+}
+
+// RegisterPreprocessor registers the implementation of a rule type,
+// replacing any registered before
+func (r *PreprocessorRegistry) RegisterPreprocessor(ruleType string, preprocessor Preprocessor) {
+	r.preprocessors[ruleType] = preprocessor
+}
+
+// GetPreprocessor returns the implementation of a rule type
+func (r *PreprocessorRegistry) GetPreprocessor(ruleType string) (Preprocessor, error) {
+	preprocessor, exists := r.preprocessors[ruleType]
+	if !exists {
+		return nil, fmt.Errorf("no preprocessor registered for rule type: %s", ruleType)
+	}
+	return preprocessor, nil
+}
+
+// truncatePreprocessor implements PreprocessTruncate
+func truncatePreprocessor(ctx *ModeContext, params map[string]interface{}) error {
+	req := ctx.Request
+	if req == nil {
+		return nil
+	}
+
+	maxMessages, ok, err := intParam(params, "max_messages")
+	if err != nil {
+		return err
+	}
+	if ok {
+		var others int
+		for _, msg := range req.Messages {
+			if msg.Role != "system" {
+				others++
+			}
+		}
+		kept := make([]Message, 0, len(req.Messages))
+		for _, msg := range req.Messages {
+			if msg.Role != "system" && others > maxMessages {
+				others--
+				continue
+			}
+			kept = append(kept, msg)
+		}
+		req.Messages = kept
+	}
+
+	maxLength, ok, err := intParam(params, "max_content_length")
+	if err != nil {
+		return err
+	}
+	if ok {
+		for i, msg := range req.Messages {
+			if content := []rune(msg.Content); len(content) > maxLength {
+				req.Messages[i].Content = string(content[:maxLength])
+			}
+		}
+	}
+	return nil
+}
+
+// filterPreprocessor implements PreprocessFilter
+func filterPreprocessor(ctx *ModeContext, params map[string]interface{}) error {
+	req := ctx.Request
+	if req == nil {
+		return nil
+	}
+
+	removeRoles, err := stringsParam(params, "remove_roles")
+	if err != nil {
+		return err
+	}
+	removeContaining, _ := params["remove_containing"].(string)
+
+	kept := make([]Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if slices.Contains(removeRoles, msg.Role) {
+			continue
+		}
+		if removeContaining != "" && msg.Role != "system" && strings.Contains(msg.Content, removeContaining) {
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	req.Messages = kept
+	return nil
+}
+
+// intParam returns a non-negative integer rule parameter, which is a
+// float64 when the rule was decoded from JSON
+func intParam(params map[string]interface{}, key string) (int, bool, error) {
+	value, exists := params[key]
+	if !exists {
+		return 0, false, nil
+	}
+
+	var n int
+	switch v := value.(type) {
+	case int:
+		n = v
+	case int64:
+		n = int(v)
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false, fmt.Errorf("parameter %s must be a whole number, got %v", key, v)
+		}
+		n = int(v)
+	default:
+		return 0, false, fmt.Errorf("parameter %s must be a number, got %T", key, value)
+	}
+	if n < 0 {
+		return 0, false, fmt.Errorf("parameter %s must not be negative, got %d", key, n)
+	}
+	return n, true, nil
+}
+
+// stringsParam returns a list of strings rule parameter, which is a
+// []interface{} when the rule was decoded from JSON
+func stringsParam(params map[string]interface{}, key string) ([]string, error) {
+	switch v := params[key].(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("parameter %s must list strings, got %T", key, item)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("parameter %s must be a list of strings, got %T", key, v)
+	}
+}
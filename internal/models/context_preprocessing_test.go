@@ -0,0 +1,159 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreprocessorRegistry_CustomRuleType(t *testing.T) {
+	var order []string
+	var gotParams map[string]interface{}
+
+	registry := NewPreprocessorRegistry()
+	registry.RegisterPreprocessor("redact", PreprocessorFunc(func(ctx *ModeContext, params map[string]interface{}) error {
+		order = append(order, "redact")
+		gotParams = params
+		word, _ := params["word"].(string)
+		for i, msg := range ctx.Request.Messages {
+			ctx.Request.Messages[i].Content = strings.ReplaceAll(msg.Content, word, "[redacted]")
+		}
+		return nil
+	}))
+	registry.RegisterPreprocessor("audit", PreprocessorFunc(func(ctx *ModeContext, params map[string]interface{}) error {
+		order = append(order, "audit")
+		return nil
+	}))
+
+	config := &Config{
+		Preprocessors: registry,
+		ModeOverrides: &ModeOverrides{
+			ContextPreprocessing: map[Mode]*ContextPreprocessingConfig{
+				FastMode: {
+					PreprocessingRules: map[Mode][]PreprocessingRule{
+						FastMode: {
+							{Type: "audit", Priority: 1},
+							{Type: "redact", Priority: 9, Parameters: map[string]interface{}{"word": "secret"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := &ModeContext{
+		Mode:   FastMode,
+		Config: config,
+		Request: &Request{
+			Model:    "test-model",
+			Messages: []Message{{Role: "user", Content: "the secret is out"}},
+		},
+	}
+
+	if err := NewFastModeStrategy().PreprocessContext(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := []string{"redact", "audit"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected rules to run in priority order %v, got %v", expected, order)
+	}
+	if gotParams["word"] != "secret" {
+		t.Errorf("Expected rule parameters to be passed, got %v", gotParams)
+	}
+	if content := ctx.Request.Messages[0].Content; content != "the [redacted] is out" {
+		t.Errorf("Expected redacted content, got %q", content)
+	}
+
+	// Rules for other modes don't run
+	order = nil
+	ctx.Mode = SophisticatedMode
+	if err := NewSophisticatedModeStrategy().PreprocessContext(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(order) != 0 {
+		t.Errorf("Expected no rules to run, got %v", order)
+	}
+}
+
+func TestPreprocessorRegistry_UnknownRuleType(t *testing.T) {
+	config := &Config{
+		ModeOverrides: &ModeOverrides{
+			ContextPreprocessing: map[Mode]*ContextPreprocessingConfig{
+				AutoMode: {
+					PreprocessingRules: map[Mode][]PreprocessingRule{
+						AutoMode: {{Type: "summarize"}},
+					},
+				},
+			},
+		},
+	}
+	ctx := &ModeContext{Mode: AutoMode, Config: config, Request: &Request{Model: "test-model"}}
+
+	err := ExecutePreprocessingRules(ctx)
+	if err == nil || !strings.Contains(err.Error(), "summarize") {
+		t.Errorf("Expected an error naming the unknown rule type, got %v", err)
+	}
+}
+
+func TestPreprocessorRegistry_BuiltIns(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "First question"},
+		{Role: "assistant", Content: "First answer"},
+		{Role: "tool", Content: "Tool output"},
+		{Role: "user", Content: "Second question, ignore me"},
+		{Role: "user", Content: "Third question"},
+	}
+
+	tests := []struct {
+		name     string
+		rule     PreprocessingRule
+		expected []Message
+	}{
+		{
+			name: "truncate messages",
+			// Parameters decoded from JSON are float64
+			rule: PreprocessingRule{Type: PreprocessTruncate, Parameters: map[string]interface{}{"max_messages": float64(2)}},
+			expected: []Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Second question, ignore me"},
+				{Role: "user", Content: "Third question"},
+			},
+		},
+		{
+			name: "truncate content",
+			rule: PreprocessingRule{Type: PreprocessTruncate, Parameters: map[string]interface{}{"max_messages": 1, "max_content_length": 5}},
+			expected: []Message{
+				{Role: "system", Content: "Be br"},
+				{Role: "user", Content: "Third"},
+			},
+		},
+		{
+			name: "filter",
+			rule: PreprocessingRule{Type: PreprocessFilter, Parameters: map[string]interface{}{
+				"remove_roles":      []interface{}{"tool"},
+				"remove_containing": "ignore me",
+			}},
+			expected: []Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "First question"},
+				{Role: "assistant", Content: "First answer"},
+				{Role: "user", Content: "Third question"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preprocessor, err := NewPreprocessorRegistry().GetPreprocessor(tt.rule.Type)
+			if err != nil {
+				t.Fatalf("Expected built-in %s, got %v", tt.rule.Type, err)
+			}
+			req := &Request{Model: "test-model", Messages: append([]Message(nil), messages...)}
+			if err := preprocessor.Apply(&ModeContext{Request: req}, tt.rule.Parameters); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(req.Messages, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, req.Messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EmbeddingVendor is implemented by vendors that can compute vector
+// embeddings. Vendors that don't implement it don't support embeddings.
+type EmbeddingVendor interface {
+	EmbedRequest(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// EmbeddingBatcher is implemented by embedding vendors that cap the number
+// of inputs per call. Dispatcher.Embed splits requests with more inputs
+// than EmbeddingBatchSize into several calls and merges their results.
+type EmbeddingBatcher interface {
+	EmbeddingBatchSize() int
+}
+
+// EmbeddingRequest asks for the embeddings of one or more texts
+type EmbeddingRequest struct {
+	// Model is the embedding model; empty uses the vendor's default
+	// embedding model
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+	// Mode picks the vendor as for chat requests; empty uses the
+	// dispatcher's configured mode
+	Mode string `json:"mode,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+// EmbeddingResponse holds one embedding per input, in input order
+type EmbeddingResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+	Model      string      `json:"model"`
+	Vendor     string      `json:"vendor"`
+	// Usage counts the input tokens as PromptTokens and TotalTokens
+	Usage     Usage     `json:"usage"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks if the embedding request is valid
+func (r *EmbeddingRequest) Validate() error {
+	if len(r.Input) == 0 {
+		return fmt.Errorf("%w: at least one input is required", ErrInvalidRequest)
+	}
+	for i, input := range r.Input {
+		if input == "" {
+			return fmt.Errorf("%w: input %d is empty", ErrInvalidRequest, i)
+		}
+	}
+	return nil
+}
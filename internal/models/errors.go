@@ -1,6 +1,11 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 // Common error types for the LLM dispatcher
 var (
@@ -11,4 +16,106 @@ var (
 	ErrTimeout             = errors.New("request timeout")
 	ErrRateLimitExceeded   = errors.New("rate limit exceeded")
 	ErrInvalidConfig       = errors.New("invalid configuration")
+	ErrPayloadTooLarge     = errors.New("payload too large")
+	// ErrInsufficientTimeBudget is returned when no vendor can plausibly
+	// respond before the context deadline
+	ErrInsufficientTimeBudget = errors.New("insufficient time budget")
+	// ErrTooManyMessagesAfterPreprocessing is returned when a request still
+	// exceeds Config.HardMaxMessages once preprocessing has run
+	ErrTooManyMessagesAfterPreprocessing = errors.New("too many messages after preprocessing")
+	// ErrStreamInterrupted marks a stream that failed because its
+	// connection broke, as opposed to an error reported by the vendor
+	ErrStreamInterrupted = errors.New("stream interrupted")
+	// ErrModelNotAllowed is returned for requests for a model excluded by
+	// Config.AllowedModels or Config.DeniedModels
+	ErrModelNotAllowed = errors.New("model not allowed")
+	// ErrSessionBudgetExceeded is returned when a session can't stay within
+	// its token budget, either because its eviction is SessionEvictError or
+	// because its pinned messages alone exceed the budget
+	ErrSessionBudgetExceeded = errors.New("session token budget exceeded")
+	// ErrFanOutCancelled marks SendToAll calls that were cancelled, or never
+	// started, because enough other vendors had already succeeded, and the
+	// streams StreamFromFirst cancelled for another vendor's
+	ErrFanOutCancelled = errors.New("fan-out cancelled after enough successes")
+	// ErrFanOutIncomplete is returned by SendToAll when fewer vendors
+	// succeeded than its mode waits for
+	ErrFanOutIncomplete = errors.New("fan-out had too few successes")
+	// ErrFeatureNotSupported is returned for requests that need a feature,
+	// such as vision, that the model's entry in its vendor's feature matrix
+	// lacks
+	ErrFeatureNotSupported = errors.New("feature not supported by model")
+	// ErrInvalidMode is returned for requests whose Mode has no strategy
+	// registered with the dispatcher
+	ErrInvalidMode = errors.New("invalid mode")
+	// ErrNoEligibleVendor is returned when every vendor that could serve a
+	// request reports itself unavailable
+	ErrNoEligibleVendor = errors.New("no eligible vendor")
+	// ErrAuditFailed is returned in place of a response that Config.Recorder
+	// failed to record when Config.FailClosedOnRecordError is enabled
+	ErrAuditFailed = errors.New("audit record failed")
+	// ErrModelNotOffered is returned for requests whose model the selected
+	// vendor doesn't list, under UnknownModelError and UnknownModelFallback
+	ErrModelNotOffered = errors.New("model not offered by vendor")
+	// ErrToolRoundsExceeded is returned by Dispatcher.RunToolLoop, along
+	// with the last response, when the model still calls tools after the
+	// maximum number of rounds
+	ErrToolRoundsExceeded = errors.New("tool call rounds exceeded")
+	// ErrRequestCostExceeded is returned, before the vendor is called, for
+	// requests whose estimated cost exceeds their MaxCost
+	ErrRequestCostExceeded = errors.New("request cost exceeded")
 )
+
+// PayloadTooLargeError is returned when a vendor rejects a request because it
+// exceeds the vendor's request-size or context limit (e.g. HTTP 413)
+type PayloadTooLargeError struct {
+	Vendor  string
+	Message string
+}
+
+// Error implements the error interface
+func (e *PayloadTooLargeError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %v", e.Vendor, ErrPayloadTooLarge)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Vendor, ErrPayloadTooLarge, e.Message)
+}
+
+// Unwrap allows errors.Is(err, ErrPayloadTooLarge)
+func (e *PayloadTooLargeError) Unwrap() error {
+	return ErrPayloadTooLarge
+}
+
+// VendorError is an error response from a vendor's API, with the message
+// and code extracted from whichever error envelope the vendor uses
+type VendorError struct {
+	Vendor     string
+	StatusCode int
+	// Code is the vendor's error code or type, e.g. "rate_limit_exceeded",
+	// or "" when the vendor sent none
+	Code    string
+	Message string
+	// RetryAfter is how long the vendor asked clients to wait before
+	// retrying, from the response's Retry-After header, or zero
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *VendorError) Error() string {
+	msg := fmt.Sprintf("%s: HTTP error %d", e.Vendor, e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	return msg
+}
+
+// Unwrap allows errors.Is(err, ErrRateLimitExceeded) for HTTP 429
+// responses
+func (e *VendorError) Unwrap() error {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package models
+
+// ModelPrice is what a model charges, in dollars per 1K tokens, for the
+// prompt tokens it reads and the completion tokens it generates
+type ModelPrice struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+}
+
+// Cost returns the price of a request's prompt and completion tokens
+func (p ModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)/1000.0*p.InputPer1K + float64(completionTokens)/1000.0*p.OutputPer1K
+}
+
+// PricingTable maps vendors to the prices of their models, keyed by model
+// name or glob pattern. A "*" entry prices the vendor's models not listed.
+type PricingTable map[string]map[string]ModelPrice
+
+// defaultModelPrice prices vendors missing from every pricing table
+var defaultModelPrice = ModelPrice{InputPer1K: 0.05, OutputPer1K: 0.05}
+
+// defaultPricingTable holds the vendors' published list prices
+var defaultPricingTable = PricingTable{
+	"openai": {
+		"gpt-4o":            {InputPer1K: 0.0025, OutputPer1K: 0.01},
+		"gpt-4o-mini":       {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+		"gpt-4-turbo":       {InputPer1K: 0.01, OutputPer1K: 0.03},
+		"gpt-4":             {InputPer1K: 0.03, OutputPer1K: 0.06},
+		"gpt-3.5-turbo":     {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+		"gpt-3.5-turbo-16k": {InputPer1K: 0.003, OutputPer1K: 0.004},
+		"*":                 {InputPer1K: 0.0025, OutputPer1K: 0.01},
+	},
+	"anthropic": {
+		"claude-3-5-sonnet-20241022": {InputPer1K: 0.003, OutputPer1K: 0.015},
+		"claude-3-5-haiku-20241022":  {InputPer1K: 0.0008, OutputPer1K: 0.004},
+		"claude-3-opus-20240229":     {InputPer1K: 0.015, OutputPer1K: 0.075},
+		"claude-3-sonnet-20240229":   {InputPer1K: 0.003, OutputPer1K: 0.015},
+		"claude-3-haiku-20240307":    {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+		"*":                          {InputPer1K: 0.003, OutputPer1K: 0.015},
+	},
+	"google": {
+		"gemini-1.5-pro":    {InputPer1K: 0.00125, OutputPer1K: 0.005},
+		"gemini-1.5-flash":  {InputPer1K: 0.000075, OutputPer1K: 0.0003},
+		"gemini-pro":        {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+		"gemini-pro-vision": {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+		"*":                 {InputPer1K: 0.00125, OutputPer1K: 0.005},
+	},
+	"azure": {
+		"gpt-4o":        {InputPer1K: 0.0025, OutputPer1K: 0.01},
+		"gpt-4o-mini":   {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+		"gpt-4-turbo":   {InputPer1K: 0.01, OutputPer1K: 0.03},
+		"gpt-4":         {InputPer1K: 0.03, OutputPer1K: 0.06},
+		"gpt-3.5-turbo": {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+		"*":             {InputPer1K: 0.0025, OutputPer1K: 0.01},
+	},
+	"together": {
+		"meta-llama/Llama-3.1-70B-Instruct-Turbo":  {InputPer1K: 0.00088, OutputPer1K: 0.00088},
+		"meta-llama/Llama-3.1-8B-Instruct-Turbo":   {InputPer1K: 0.00018, OutputPer1K: 0.00018},
+		"meta-llama/Llama-3.1-405B-Instruct-Turbo": {InputPer1K: 0.0035, OutputPer1K: 0.0035},
+		"mistralai/Mixtral-8x7B-Instruct-v0.1":     {InputPer1K: 0.0006, OutputPer1K: 0.0006},
+		"Qwen/Qwen2.5-72B-Instruct-Turbo":          {InputPer1K: 0.0012, OutputPer1K: 0.0012},
+		"*":                                        {InputPer1K: 0.00088, OutputPer1K: 0.00088},
+	},
+	"openrouter": {
+		"anthropic/claude-3.5-sonnet":       {InputPer1K: 0.003, OutputPer1K: 0.015},
+		"openai/gpt-4o":                     {InputPer1K: 0.0025, OutputPer1K: 0.01},
+		"openai/gpt-4o-mini":                {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+		"google/gemini-pro-1.5":             {InputPer1K: 0.00125, OutputPer1K: 0.005},
+		"meta-llama/llama-3.1-70b-instruct": {InputPer1K: 0.00088, OutputPer1K: 0.00088},
+	},
+	"cohere": {
+		"command-r-plus": {InputPer1K: 0.0025, OutputPer1K: 0.01},
+		"command-r":      {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+		"command":        {InputPer1K: 0.001, OutputPer1K: 0.002},
+	},
+	"bedrock": {
+		"anthropic.claude-3-5-sonnet-20240620-v1:0": {InputPer1K: 0.003, OutputPer1K: 0.015},
+		"anthropic.claude-3-sonnet-20240229-v1:0":   {InputPer1K: 0.003, OutputPer1K: 0.015},
+		"anthropic.claude-3-haiku-20240307-v1:0":    {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+		"amazon.titan-text-premier-v1:0":            {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+		"amazon.titan-text-express-v1":              {InputPer1K: 0.0002, OutputPer1K: 0.0006},
+		"amazon.titan-text-lite-v1":                 {InputPer1K: 0.00015, OutputPer1K: 0.0002},
+	},
+	// Local models are free
+	"local": {
+		"*": {},
+	},
+}
+
+// DefaultPricingTable returns a copy of the prices used for models that
+// Config.Pricing leaves out
+func DefaultPricingTable() PricingTable {
+	table := make(PricingTable, len(defaultPricingTable))
+	for vendor, prices := range defaultPricingTable {
+		table[vendor] = make(map[string]ModelPrice, len(prices))
+		for model, price := range prices {
+			table[vendor][model] = price
+		}
+	}
+	return table
+}
+
+// Price returns the price of a vendor's model. The table's entries win,
+// the model's own entry over the longest pattern matching it; models the
+// table leaves out are priced from the default table, and vendors missing
+// from both at a flat $0.05 per 1K tokens.
+func (t PricingTable) Price(vendor, model string) ModelPrice {
+	if price, exists := LookupModelPattern(t[vendor], model); exists {
+		return price
+	}
+	if price, exists := LookupModelPattern(defaultPricingTable[vendor], model); exists {
+		return price
+	}
+	return defaultModelPrice
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPricingTable_Price(t *testing.T) {
+	table := PricingTable{
+		"openai": {
+			"gpt-4":    {InputPer1K: 0.01, OutputPer1K: 0.02},
+			"gpt-4o-*": {InputPer1K: 0.002, OutputPer1K: 0.008},
+		},
+		"custom": {
+			"*": {InputPer1K: 0.001, OutputPer1K: 0.001},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		vendor   string
+		model    string
+		expected ModelPrice
+	}{
+		{"overridden model", "openai", "gpt-4", ModelPrice{InputPer1K: 0.01, OutputPer1K: 0.02}},
+		{"overriding pattern", "openai", "gpt-4o-2024-08-06", ModelPrice{InputPer1K: 0.002, OutputPer1K: 0.008}},
+		{"exact default over overriding pattern", "openai", "gpt-4o", ModelPrice{InputPer1K: 0.0025, OutputPer1K: 0.01}},
+		{"default model", "openai", "gpt-3.5-turbo", ModelPrice{InputPer1K: 0.0005, OutputPer1K: 0.0015}},
+		{"default for unlisted model", "anthropic", "claude-4", ModelPrice{InputPer1K: 0.003, OutputPer1K: 0.015}},
+		{"vendor only in the table", "custom", "anything", ModelPrice{InputPer1K: 0.001, OutputPer1K: 0.001}},
+		{"local models are free", "local", "llama3:8b", ModelPrice{}},
+		{"unknown vendor", "unknown", "model", defaultModelPrice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if price := table.Price(tt.vendor, tt.model); price != tt.expected {
+				t.Errorf("Expected price %+v, got %+v", tt.expected, price)
+			}
+		})
+	}
+
+	var empty PricingTable
+	if price := empty.Price("openai", "gpt-4"); price != (ModelPrice{InputPer1K: 0.03, OutputPer1K: 0.06}) {
+		t.Errorf("Expected the default gpt-4 price from a nil table, got %+v", price)
+	}
+}
+
+func TestPricingTable_DifferentiatesModels(t *testing.T) {
+	// 1000 prompt and 500 completion tokens
+	tests := []struct {
+		vendor   string
+		model    string
+		expected float64
+	}{
+		{"openai", "gpt-4", 0.06},
+		{"openai", "gpt-4o", 0.0075},
+		{"openai", "gpt-4o-mini", 0.00045},
+		{"anthropic", "claude-3-opus-20240229", 0.0525},
+		{"anthropic", "claude-3-haiku-20240307", 0.000875},
+	}
+
+	var table PricingTable
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if cost := table.Price(tt.vendor, tt.model).Cost(1000, 500); math.Abs(cost-tt.expected) > 1e-12 {
+				t.Errorf("Expected cost %v, got %v", tt.expected, cost)
+			}
+		})
+	}
+
+	// Completion tokens cost more than prompt tokens
+	price := table.Price("openai", "gpt-4o")
+	if price.Cost(0, 1000) <= price.Cost(1000, 0) {
+		t.Errorf("Expected completion tokens to be priced above prompt tokens, got %+v", price)
+	}
+}
+
+func TestDefaultPricingTable_ReturnsCopy(t *testing.T) {
+	table := DefaultPricingTable()
+	table["openai"]["gpt-4"] = ModelPrice{}
+
+	if price := DefaultPricingTable()["openai"]["gpt-4"]; price == (ModelPrice{}) {
+		t.Error("Expected changes to the returned table to leave the defaults alone")
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ScoreWeights sets how much each observed metric counts towards a
+// vendor's score in ScoreBasedStrategy
+type ScoreWeights struct {
+	Latency      float64 `json:"latency"`
+	Cost         float64 `json:"cost"`
+	Availability float64 `json:"availability"`
+}
+
+// DefaultScoreWeights weighs latency, cost and availability equally
+var DefaultScoreWeights = ScoreWeights{Latency: 1, Cost: 1, Availability: 1}
+
+// neutralScore is a vendor's score for a metric it has no observations of
+// yet, so new vendors rank between good and bad performers
+const neutralScore = 0.5
+
+// VendorScore is a vendor's score in ScoreBasedStrategy
+type VendorScore struct {
+	Vendor string  `json:"vendor"`
+	Score  float64 `json:"score"`
+}
+
+// ScoreBasedStrategy selects vendors by a weighted score of their observed
+// latency, cost and success rate instead of a static priority list. The
+// other available vendors become the request's fallbacks, tried in
+// descending score order when the selected vendor fails.
+//
+// Latency and cost score the best observed value over the vendor's own, so
+// the fastest and cheapest vendors score 1 and a vendor twice as slow 0.5.
+// A vendor with zero observed cost scores 1 for cost. Availability is the
+// vendor's success rate.
+type ScoreBasedStrategy struct {
+	*BaseModeStrategy
+	weights ScoreWeights
+}
+
+// NewScoreBasedStrategy creates a score-based strategy for mode. Zero
+// weights use DefaultScoreWeights.
+func NewScoreBasedStrategy(mode Mode, weights ScoreWeights) *ScoreBasedStrategy {
+	if weights == (ScoreWeights{}) {
+		weights = DefaultScoreWeights
+	}
+	return &ScoreBasedStrategy{
+		BaseModeStrategy: NewBaseModeStrategy(mode, 5),
+		weights:          weights,
+	}
+}
+
+// Scores returns the score of each available vendor, highest first. Vendors
+// with equal scores are ordered by name, or least recently used first with
+// Config.LRUTieBreak.
+func (s *ScoreBasedStrategy) Scores(ctx *ModeContext) []VendorScore {
+	names := make([]string, 0, len(ctx.AvailableVendors))
+	for name, vendor := range ctx.AvailableVendors {
+		if vendor.IsAvailable(ctx.Context) {
+			names = append(names, name)
+		}
+	}
+
+	// The best observed latency and cost are the references the others
+	// are scored against
+	var bestLatency time.Duration
+	var bestCost float64
+	for _, name := range names {
+		stats := ctx.VendorStats[name]
+		if stats.Requests == 0 {
+			continue
+		}
+		if stats.AverageLatency > 0 && (bestLatency == 0 || stats.AverageLatency < bestLatency) {
+			bestLatency = stats.AverageLatency
+		}
+		if stats.AverageCost > 0 && (bestCost == 0 || stats.AverageCost < bestCost) {
+			bestCost = stats.AverageCost
+		}
+	}
+
+	scores := make([]VendorScore, 0, len(names))
+	for _, name := range names {
+		stats := ctx.VendorStats[name]
+		latency, cost, availability := neutralScore, neutralScore, neutralScore
+		if stats.Requests > 0 {
+			if stats.AverageLatency > 0 {
+				latency = float64(bestLatency) / float64(stats.AverageLatency)
+			}
+			cost = 1
+			if stats.AverageCost > 0 {
+				cost = bestCost / stats.AverageCost
+			}
+			availability = float64(stats.Successes) / float64(stats.Requests)
+		}
+
+		scores = append(scores, VendorScore{
+			Vendor: name,
+			Score:  s.weights.Latency*latency + s.weights.Cost*cost + s.weights.Availability*availability,
+		})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		if ctx.Config != nil && ctx.Config.LRUTieBreak {
+			iUsed, jUsed := ctx.VendorStats[scores[i].Vendor].LastUsed, ctx.VendorStats[scores[j].Vendor].LastUsed
+			if !iUsed.Equal(jUsed) {
+				return iUsed.Before(jUsed)
+			}
+		}
+		return scores[i].Vendor < scores[j].Vendor
+	})
+	return scores
+}
+
+// SelectVendor selects the highest-scoring vendor and sets the others as
+// the request's fallbacks
+func (s *ScoreBasedStrategy) SelectVendor(ctx *ModeContext) (LLMVendor, error) {
+	scores := s.Scores(ctx)
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no available vendors for %s mode", s.mode)
+	}
+
+	ctx.FallbackVendors = make([]LLMVendor, 0, len(scores)-1)
+	for _, score := range scores[1:] {
+		ctx.FallbackVendors = append(ctx.FallbackVendors, ctx.AvailableVendors[score.Vendor])
+	}
+	ctx.SelectionReason = RoutingReasonHeuristic
+	return ctx.AvailableVendors[scores[0].Vendor], nil
+}
+
+// PreprocessContext applies the mode's preprocessing rules
+func (s *ScoreBasedStrategy) PreprocessContext(ctx *ModeContext) error {
+	return ExecutePreprocessingRules(ctx)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// scoreTestVendor is a minimal vendor for scoring tests
+type scoreTestVendor struct {
+	name      string
+	available bool
+}
+
+func (v *scoreTestVendor) Name() string { return v.name }
+func (v *scoreTestVendor) SendRequest(ctx context.Context, req *Request) (*Response, error) {
+	return &Response{Vendor: v.name}, nil
+}
+func (v *scoreTestVendor) SendStreamingRequest(ctx context.Context, req *Request) (*StreamingResponse, error) {
+	return nil, nil
+}
+func (v *scoreTestVendor) GetCapabilities() Capabilities        { return Capabilities{} }
+func (v *scoreTestVendor) IsAvailable(ctx context.Context) bool { return v.available }
+
+func TestScoreBasedStrategy_Scores(t *testing.T) {
+	ctx := &ModeContext{
+		Mode:    "score",
+		Context: context.Background(),
+		Config:  &Config{},
+		Request: &Request{Model: "test-model"},
+		AvailableVendors: map[string]LLMVendor{
+			"cheap":   &scoreTestVendor{name: "cheap", available: true},
+			"fast":    &scoreTestVendor{name: "fast", available: true},
+			"new":     &scoreTestVendor{name: "new", available: true},
+			"offline": &scoreTestVendor{name: "offline", available: false},
+		},
+		VendorStats: map[string]VendorStats{
+			"cheap":   {Requests: 4, Successes: 4, AverageLatency: 400 * time.Millisecond, AverageCost: 0.001},
+			"fast":    {Requests: 4, Successes: 2, AverageLatency: 100 * time.Millisecond, AverageCost: 0.004},
+			"offline": {Requests: 4, Successes: 4, AverageLatency: 50 * time.Millisecond, AverageCost: 0.0001},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		weights  ScoreWeights
+		expected []string
+	}{
+		// cheap 0.25+1+1 = 2.25, fast 1+0.25+0.5 = 1.75, new 1.5
+		{name: "default weights", expected: []string{"cheap", "fast", "new"}},
+		// cheap 0.25, fast 1, new 0.5
+		{name: "latency only", weights: ScoreWeights{Latency: 1}, expected: []string{"fast", "new", "cheap"}},
+		// cheap 1, fast 0.25, new 0.5
+		{name: "cost only", weights: ScoreWeights{Cost: 1}, expected: []string{"cheap", "new", "fast"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := NewScoreBasedStrategy("score", tt.weights)
+
+			var order []string
+			for _, score := range strategy.Scores(ctx) {
+				order = append(order, score.Vendor)
+			}
+			if !reflect.DeepEqual(order, tt.expected) {
+				t.Errorf("Expected order %v, got %v", tt.expected, order)
+			}
+
+			vendor, err := strategy.SelectVendor(ctx)
+			if err != nil {
+				t.Fatalf("SelectVendor() failed: %v", err)
+			}
+			if vendor.Name() != tt.expected[0] {
+				t.Errorf("Expected %s to be selected, got %s", tt.expected[0], vendor.Name())
+			}
+			var fallbacks []string
+			for _, fallback := range ctx.FallbackVendors {
+				fallbacks = append(fallbacks, fallback.Name())
+			}
+			if !reflect.DeepEqual(fallbacks, tt.expected[1:]) {
+				t.Errorf("Expected fallbacks %v, got %v", tt.expected[1:], fallbacks)
+			}
+		})
+	}
+}
+
+func TestScoreBasedStrategy_LRUTieBreak(t *testing.T) {
+	now := time.Now()
+	stats := VendorStats{Requests: 2, Successes: 2, AverageLatency: 100 * time.Millisecond, AverageCost: 0.001}
+	alpha, beta := stats, stats
+	alpha.LastUsed = now
+	beta.LastUsed = now.Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		lruTieBreak bool
+		expected    string
+	}{
+		{name: "by name", expected: "alpha"},
+		{name: "least recently used", lruTieBreak: true, expected: "beta"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &ModeContext{
+				Mode:    "score",
+				Context: context.Background(),
+				Config:  &Config{LRUTieBreak: tt.lruTieBreak},
+				Request: &Request{Model: "test-model"},
+				AvailableVendors: map[string]LLMVendor{
+					"alpha": &scoreTestVendor{name: "alpha", available: true},
+					"beta":  &scoreTestVendor{name: "beta", available: true},
+				},
+				VendorStats: map[string]VendorStats{"alpha": alpha, "beta": beta},
+			}
+
+			vendor, err := NewScoreBasedStrategy("score", ScoreWeights{}).SelectVendor(ctx)
+			if err != nil {
+				t.Fatalf("SelectVendor() failed: %v", err)
+			}
+			if vendor.Name() != tt.expected {
+				t.Errorf("Expected %s to be selected, got %s", tt.expected, vendor.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// TokenCounter counts the tokens a text takes up in a model's context
+type TokenCounter interface {
+	CountTokens(model, text string) int
+}
+
+// BPETokenCounter counts tokens with OpenAI's BPE encodings: o200k_base for
+// the GPT-4o, GPT-4.1, GPT-5 and o-series models, and cl100k_base for every
+// other model. Other vendors' models have tokenizers of their own, which
+// cl100k_base approximates far better than counting characters does. Text
+// that fails to encode falls back to EstimateTokens.
+type BPETokenCounter struct {
+	mu     sync.Mutex
+	codecs map[tokenizer.Encoding]tokenizer.Codec
+}
+
+// NewBPETokenCounter returns a BPETokenCounter. Each encoding's vocabulary
+// is loaded the first time a model needs it.
+func NewBPETokenCounter() *BPETokenCounter {
+	return &BPETokenCounter{codecs: make(map[tokenizer.Encoding]tokenizer.Codec)}
+}
+
+// defaultTokenCounter counts tokens for configs without a TokenCounter
+var defaultTokenCounter = NewBPETokenCounter()
+
+// DefaultTokenCounter returns the TokenCounter used when Config.TokenCounter
+// is not set
+func DefaultTokenCounter() TokenCounter {
+	return defaultTokenCounter
+}
+
+// CountTokens returns the number of tokens text encodes to for model
+func (c *BPETokenCounter) CountTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	codec, err := c.codec(encodingForModel(model))
+	if err != nil {
+		return EstimateTokens(text)
+	}
+	count, err := codec.Count(text)
+	if err != nil {
+		return EstimateTokens(text)
+	}
+	return count
+}
+
+// codec returns the cached codec of an encoding
+func (c *BPETokenCounter) codec(encoding tokenizer.Encoding) (tokenizer.Codec, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if codec, exists := c.codecs[encoding]; exists {
+		return codec, nil
+	}
+	codec, err := tokenizer.Get(encoding)
+	if err != nil {
+		return nil, err
+	}
+	c.codecs[encoding] = codec
+	return codec, nil
+}
+
+// o200kModelPrefixes are the models encoded with o200k_base
+var o200kModelPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"}
+
+// encodingForModel returns the encoding model's tokens are counted in.
+// Prefixed names such as "openai/gpt-4o" are matched after the last slash.
+func encodingForModel(model string) tokenizer.Encoding {
+	model = strings.ToLower(model[strings.LastIndex(model, "/")+1:])
+	for _, prefix := range o200kModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return tokenizer.O200kBase
+		}
+	}
+	return tokenizer.Cl100kBase
+}
+
+// tokenCounter returns the config's TokenCounter, or the default counter
+// when none is set
+func tokenCounter(config *Config) TokenCounter {
+	if config == nil || config.TokenCounter == nil {
+		return defaultTokenCounter
+	}
+	return config.TokenCounter
+}
+
+// countMessageTokens counts the tokens of a request's message texts,
+// including the text parts of multimodal messages
+func countMessageTokens(counter TokenCounter, req *Request) int {
+	tokens := 0
+	for _, msg := range req.Messages {
+		tokens += counter.CountTokens(req.Model, msg.Text())
+	}
+	return tokens
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBPETokenCounter_CountTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		text     string
+		expected int
+	}{
+		{"empty", "gpt-4", "", 0},
+		{"cl100k_base", "gpt-4", "Hello, world!", 4},
+		{"cl100k_base sentence", "gpt-3.5-turbo", "The quick brown fox jumps over the lazy dog.", 10},
+		{"cl100k_base code", "gpt-4", "func main() {\n\tfmt.Println(\"hi\")\n}", 10},
+		{"cl100k_base non-English", "gpt-4", "こんにちは世界", 4},
+		{"o200k_base non-English", "gpt-4o", "こんにちは世界", 2},
+		{"o200k_base o-series", "o3-mini", "こんにちは世界", 2},
+		{"o200k_base with vendor prefix", "openai/GPT-4o-mini", "こんにちは世界", 2},
+		{"repeated characters", "gpt-4", strings.Repeat("a", 400), 50},
+		{"other vendor's model", "claude-3-5-sonnet-20241022", "Hello, world!", 4},
+		{"no model", "", "The quick brown fox jumps over the lazy dog.", 10},
+	}
+
+	counter := NewBPETokenCounter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if count := counter.CountTokens(tt.model, tt.text); count != tt.expected {
+				t.Errorf("Expected %d tokens, got %d", tt.expected, count)
+			}
+		})
+	}
+}
+
+type fixedTokenCounter int
+
+func (c fixedTokenCounter) CountTokens(model, text string) int {
+	return int(c)
+}
+
+func TestCostSavingModeStrategy_TokenCounter(t *testing.T) {
+	req := &Request{
+		Model:     "gpt-4",
+		Messages:  []Message{{Role: "user", Content: "Hello, world!"}},
+		MaxTokens: 100,
+	}
+
+	strategy := NewCostSavingModeStrategy()
+	price := ModelPrice{InputPer1K: 1, OutputPer1K: 1}
+	// 4 prompt tokens and 100 completion tokens at $1 per 1K
+	if cost := strategy.estimateRequestCost(req, tokenCounter(&Config{}), price); math.Abs(cost-0.104) > 1e-12 {
+		t.Errorf("Expected cost 0.104 with the default counter, got %v", cost)
+	}
+	config := &Config{TokenCounter: fixedTokenCounter(900)}
+	if cost := strategy.estimateRequestCost(req, tokenCounter(config), price); math.Abs(cost-1) > 1e-12 {
+		t.Errorf("Expected cost 1 with the configured counter, got %v", cost)
+	}
+}
+
+func TestCountMessageTokens_ContentParts(t *testing.T) {
+	req := &Request{
+		Model: "gpt-4",
+		Messages: []Message{
+			{Role: "system", Content: "Hello, world!"},
+			{Role: "user", Parts: []ContentPart{
+				{Type: ContentPartText, Text: "Hello, world!"},
+				{Type: ContentPartImage, ImageURL: "https://example.com/cat.png"},
+			}},
+		},
+	}
+
+	// 4 tokens each for the content and the text part; images aren't text
+	if tokens := countMessageTokens(NewBPETokenCounter(), req); tokens != 8 {
+		t.Errorf("Expected 8 tokens, got %d", tokens)
+	}
+}
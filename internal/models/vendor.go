@@ -2,8 +2,12 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -26,6 +30,34 @@ type LLMVendor interface {
 	IsAvailable(ctx context.Context) bool
 }
 
+// VendorStatus describes the runtime state of a registered vendor
+type VendorStatus struct {
+	Name string `json:"name"`
+	// Enabled is false when the vendor was taken out of rotation
+	Enabled bool `json:"enabled"`
+	// Available reports the vendor's own availability check
+	Available bool `json:"available"`
+}
+
+// Embedder turns text into an embedding vector, e.g. through a vendor's
+// embeddings endpoint
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Summarizer condenses messages into a short text, e.g. by asking a cheap
+// model for a summary
+type Summarizer interface {
+	Summarize(ctx context.Context, messages []Message) (string, error)
+}
+
+// MaxTokensVendorDefault, as a Request's MaxTokens, leaves the response
+// length to the vendor's own default. Vendors whose API requires a limit,
+// such as Anthropic, send their model's maximum output instead. A
+// MaxTokens of zero means unset instead, and lets the mode strategy pick a
+// limit; any positive value is sent as is.
+const MaxTokensVendorDefault = -1
+
 // Request represents a standardized LLM request
 type Request struct {
 	Model       string    `json:"model"`
@@ -34,16 +66,158 @@ type Request struct {
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	TopP        float64   `json:"top_p,omitempty"`
 	Stream      bool      `json:"stream,omitempty"`
-	Stop        []string  `json:"stop,omitempty"`
+	Stop        []string  `json:"stop,omitempty"` // empty and duplicate entries are dropped
 	User        string    `json:"user,omitempty"`
 	Mode        string    `json:"mode,omitempty"`
+	// Tools are the functions the model may call instead of answering.
+	// Only OpenAI and Anthropic support them; other vendors reject
+	// requests with tools.
+	Tools []Tool `json:"tools,omitempty"`
+	// ToolChoice is ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired or
+	// the name of the tool the model must call. Empty leaves the vendor
+	// default.
+	ToolChoice string `json:"tool_choice,omitempty"`
+	// ParallelToolCalls controls whether the model may call several tools
+	// at once. Nil leaves the vendor default; only OpenAI honors it.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// ResponseFormat asks for output in a format such as ResponseFormatJSON.
+	// Empty leaves the vendor default of plain text.
+	ResponseFormat string `json:"response_format,omitempty"`
+	// NoCache sends the request to the vendor even when a cached response
+	// would match, and keeps its response out of the cache
+	NoCache bool `json:"no_cache,omitempty"`
+	// CacheTTL overrides how long the response is cached; zero uses the
+	// cache's default TTL
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+	// IncludeRawResponse asks the vendor to attach its untouched response
+	// body to Response.Raw, or its stream events to
+	// StreamingResponse.RawEvents. Config.IncludeRawResponse sets it for
+	// every request.
+	IncludeRawResponse bool `json:"include_raw_response,omitempty"`
+	// RetryableErrors lists further errors to retry for this request only,
+	// on top of the retry policy's RetryableErrors and the defaults. It has
+	// no effect without a Config.RetryPolicy.
+	RetryableErrors []string `json:"retryable_errors,omitempty"`
+	// Tier is the caller's service tier, e.g. "free" or "premium", which
+	// picks the request's mode through Config.TierRouting. It must be one
+	// of the configured tiers.
+	Tier string `json:"tier,omitempty"`
+	// IncludeReasoning asks for a reasoning model's reasoning in
+	// Response.ReasoningContent and its token count in
+	// Usage.ReasoningTokens. Reasoning is kept out of Content either way.
+	IncludeReasoning bool `json:"include_reasoning,omitempty"`
+	// MinResponseTokens retries responses with fewer completion tokens,
+	// which often mean a refusal or a failed answer, counting against the
+	// retry policy's MaxRetries. Once the retries are used up the short
+	// response is returned as it is. Responses with tool calls are exempt.
+	MinResponseTokens int `json:"min_response_tokens,omitempty"`
+	// MinResponseRetryPrompt, if set, is added as a user message after the
+	// short response when retrying it, e.g. "Please answer in full."
+	MinResponseRetryPrompt string `json:"min_response_retry_prompt,omitempty"`
+	// MaxCost caps the request's estimated cost, in dollars: its prompt
+	// plus MaxTokens of completion at the vendor's rate, so a request
+	// without MaxTokens is capped on its prompt alone. Over the cap the
+	// request fails with ErrRequestCostExceeded without reaching the
+	// vendor, or moves to a cheaper vendor under Config.MaxCostPolicy.
+	// Zero is no cap.
+	MaxCost float64 `json:"max_cost,omitempty"`
+}
+
+// Response formats for Request.ResponseFormat
+const (
+	ResponseFormatText = "text"
+	ResponseFormatJSON = "json_object"
+)
+
+// Tool is a function the model may call
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the function's arguments object
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is the model's call of one of the request's tools. A follow-up
+// request returns its result in a "tool" message with the call's ID.
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is the JSON object of arguments the model passed
+	Arguments string `json:"arguments"`
+}
+
+// ToolExecutor runs the tools a model calls, for Dispatcher.RunToolLoop
+type ToolExecutor interface {
+	// Execute runs the call and returns its result, sent back to the model
+	// as the content of a "tool" message
+	Execute(ctx context.Context, call ToolCall) (string, error)
+}
+
+// Tool choices for Request.ToolChoice, besides the name of a tool
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// Clone returns a deep copy of the request, so changes to the copy's
+// fields, messages or stop sequences never reach the original
+func (r *Request) Clone() *Request {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	if r.Messages != nil {
+		clone.Messages = make([]Message, len(r.Messages))
+		copy(clone.Messages, r.Messages)
+		for i, msg := range r.Messages {
+			if msg.Parts != nil {
+				clone.Messages[i].Parts = make([]ContentPart, len(msg.Parts))
+				copy(clone.Messages[i].Parts, msg.Parts)
+			}
+			if msg.ToolCalls != nil {
+				clone.Messages[i].ToolCalls = make([]ToolCall, len(msg.ToolCalls))
+				copy(clone.Messages[i].ToolCalls, msg.ToolCalls)
+			}
+		}
+	}
+	if r.Stop != nil {
+		clone.Stop = make([]string, len(r.Stop))
+		copy(clone.Stop, r.Stop)
+	}
+	if r.RetryableErrors != nil {
+		clone.RetryableErrors = make([]string, len(r.RetryableErrors))
+		copy(clone.RetryableErrors, r.RetryableErrors)
+	}
+	if r.Tools != nil {
+		clone.Tools = make([]Tool, len(r.Tools))
+		copy(clone.Tools, r.Tools)
+	}
+	if r.ParallelToolCalls != nil {
+		parallelToolCalls := *r.ParallelToolCalls
+		clone.ParallelToolCalls = &parallelToolCalls
+	}
+	return &clone
+}
+
+// RequiredFeatures returns the model features the request needs
+func (r *Request) RequiredFeatures() ModelFeatures {
+	required := ModelFeatures{
+		Tools:     len(r.Tools) > 0,
+		JSONMode:  r.ResponseFormat == ResponseFormatJSON,
+		Streaming: r.Stream,
+	}
+	for i := range r.Messages {
+		if r.Messages[i].HasImage() {
+			required.Vision = true
+			break
+		}
+	}
+	return required
 }
 
 // Validate checks if the request is valid
 func (r *Request) Validate() error {
-	// Debug logging
-	fmt.Printf("DEBUG: Validate called with Model='%s', Mode='%s'\n", r.Model, r.Mode)
-
 	// For mode-based requests, model is optional as it will be auto-selected
 	if r.Model == "" && r.Mode == "" {
 		return fmt.Errorf("%w: either model or mode must be specified", ErrInvalidRequest)
@@ -64,20 +238,21 @@ func (r *Request) Validate() error {
 	}
 
 	// Validate max tokens
-	if r.MaxTokens < 0 {
+	if r.MaxTokens < 0 && r.MaxTokens != MaxTokensVendorDefault {
 		return fmt.Errorf("%w: max_tokens cannot be negative", ErrInvalidRequest)
 	}
 
-	// Validate mode if specified
-	if r.Mode != "" {
-		validModes := map[string]bool{
-			"auto":          true,
-			"fast":          true,
-			"sophisticated": true,
-			"cost_saving":   true,
-		}
-		if !validModes[r.Mode] {
-			return fmt.Errorf("%w: invalid mode: %s", ErrInvalidRequest, r.Mode)
+	if r.MaxCost < 0 {
+		return fmt.Errorf("%w: max_cost cannot be negative", ErrInvalidRequest)
+	}
+
+	if r.MinResponseTokens < 0 {
+		return fmt.Errorf("%w: min_response_tokens cannot be negative", ErrInvalidRequest)
+	}
+
+	for i, tool := range r.Tools {
+		if tool.Name == "" {
+			return fmt.Errorf("%w: tool %d has no name", ErrInvalidRequest, i)
 		}
 	}
 
@@ -95,6 +270,54 @@ func (r *Request) Validate() error {
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Parts holds multimodal content, text and images, in place of Content
+	Parts []ContentPart `json:"parts,omitempty"`
+	// ToolCalls are the calls an assistant message made, when the
+	// conversation is continued after a response with tool calls. Any text
+	// the assistant wrote before calling them stays in Content or Parts.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a "tool" message holds the result of
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// ContentPart is one part of a multimodal message
+type ContentPart struct {
+	// Type is ContentPartText or ContentPartImage
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// ImageURL is the image's URL, or a base64 data URL
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// Content part types for ContentPart.Type
+const (
+	ContentPartText  = "text"
+	ContentPartImage = "image_url"
+)
+
+// Text returns the message's text: Content, or its text parts joined with
+// newlines when it has parts
+func (m *Message) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	texts := make([]string, 0, len(m.Parts))
+	for _, part := range m.Parts {
+		if part.Type == ContentPartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// HasImage reports whether the message carries an image part
+func (m *Message) HasImage() bool {
+	for _, part := range m.Parts {
+		if part.Type == ContentPartImage {
+			return true
+		}
+	}
+	return false
 }
 
 // Validate checks if the message is valid
@@ -103,7 +326,8 @@ func (m *Message) Validate() error {
 		return errors.New("role cannot be empty")
 	}
 
-	if m.Content == "" {
+	// An assistant message may consist of tool calls alone
+	if m.Content == "" && len(m.Parts) == 0 && len(m.ToolCalls) == 0 {
 		return errors.New("content cannot be empty")
 	}
 
@@ -112,15 +336,50 @@ func (m *Message) Validate() error {
 		"system":    true,
 		"user":      true,
 		"assistant": true,
+		"tool":      true,
 	}
 
 	if !validRoles[m.Role] {
 		return fmt.Errorf("invalid role: %s", m.Role)
 	}
 
+	for i, part := range m.Parts {
+		switch part.Type {
+		case ContentPartText:
+		case ContentPartImage:
+			if part.ImageURL == "" {
+				return fmt.Errorf("image part %d has no URL", i)
+			}
+		default:
+			return fmt.Errorf("part %d has invalid type: %s", i, part.Type)
+		}
+	}
+
+	if m.Role == "tool" && m.ToolCallID == "" {
+		return errors.New("tool message needs a tool call ID")
+	}
+	if len(m.ToolCalls) > 0 && m.Role != "assistant" {
+		return fmt.Errorf("%s message cannot have tool calls", m.Role)
+	}
+
 	return nil
 }
 
+// JoinSystemMessages returns the content of the system messages joined with
+// sep, in order, and the remaining messages
+func JoinSystemMessages(messages []Message, sep string) (string, []Message) {
+	var system []string
+	rest := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			system = append(system, msg.Text())
+			continue
+		}
+		rest = append(rest, msg)
+	}
+	return strings.Join(system, sep), rest
+}
+
 // Response represents a standardized LLM response
 type Response struct {
 	Content       string    `json:"content"`
@@ -130,6 +389,73 @@ type Response struct {
 	FinishReason  string    `json:"finish_reason,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 	EstimatedCost float64   `json:"estimated_cost,omitempty"`
+	// CostEstimated is set when the vendor reported no usage and
+	// EstimatedCost is based on estimated token counts
+	CostEstimated bool `json:"cost_estimated,omitempty"`
+	// SafetyRatings holds the vendor's content safety assessment of the
+	// response. It is nil for vendors that don't report one.
+	SafetyRatings []SafetyRating `json:"safety_ratings,omitempty"`
+	// RoutingTrace explains how the vendor was selected. It is only set
+	// when Config.RecordRoutingTrace is enabled.
+	RoutingTrace *RoutingTrace `json:"routing_trace,omitempty"`
+	// VendorHeaders holds the captured response headers, keyed by
+	// lower-case name; see VendorConfig.CaptureHeaders
+	VendorHeaders map[string]string `json:"vendor_headers,omitempty"`
+	// RequestedModel is the model the caller asked for when a model
+	// rewrite sent the request for a different one
+	RequestedModel string `json:"requested_model,omitempty"`
+	// Raw is the vendor's untouched response body, set when the request
+	// asked for it with IncludeRawResponse
+	Raw json.RawMessage `json:"raw,omitempty"`
+	// ToolCalls are the tools the model called, with FinishReason
+	// "tool_calls". Content may be empty when they are set.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ReasoningContent is a reasoning model's reasoning, when the request
+	// asked for it with IncludeReasoning and the vendor returns it
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// RequestBytes and ResponseBytes are the sizes of the HTTP request and
+	// response bodies exchanged with the vendor. They are zero for vendors
+	// that don't talk HTTP.
+	RequestBytes  int64 `json:"request_bytes,omitempty"`
+	ResponseBytes int64 `json:"response_bytes,omitempty"`
+}
+
+// RoutingReason explains why a vendor was selected
+type RoutingReason string
+
+const (
+	// RoutingReasonPreference means the vendor was the first available one
+	// in the mode's configured vendor preferences
+	RoutingReasonPreference RoutingReason = "preference_match"
+	// RoutingReasonHeuristic means the mode strategy's built-in ranking,
+	// such as lowest latency or cost, picked the vendor
+	RoutingReasonHeuristic RoutingReason = "heuristic"
+	// RoutingReasonFallback means no preferred or ranked vendor was
+	// available and any available vendor was used
+	RoutingReasonFallback RoutingReason = "fallback"
+)
+
+// RoutingTrace records the selection of a request's vendor
+type RoutingTrace struct {
+	Mode       Mode               `json:"mode"`
+	Candidates []RoutingCandidate `json:"candidates"`
+	Vendor     string             `json:"vendor"`
+	Reason     RoutingReason      `json:"reason"`
+}
+
+// RoutingCandidate is a vendor considered during selection
+type RoutingCandidate struct {
+	Vendor    string `json:"vendor"`
+	Available bool   `json:"available"`
+}
+
+// SafetyRating is a vendor's assessment of content for one harm category.
+// Category and Severity use the vendor's own names, e.g. Google's
+// "HARM_CATEGORY_HARASSMENT" and "NEGLIGIBLE".
+type SafetyRating struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Blocked  bool   `json:"blocked"`
 }
 
 // StreamingResponse represents a streaming LLM response
@@ -138,17 +464,53 @@ type StreamingResponse struct {
 	DoneChan    chan bool   `json:"-"`
 	ErrorChan   chan error  `json:"-"`
 	Usage       Usage       `json:"usage"`
-	Model       string      `json:"model"`
-	Vendor      string      `json:"vendor"`
-	CreatedAt   time.Time   `json:"created_at"`
-	closed      bool        `json:"-"`
-	mu          sync.Mutex  `json:"-"`
+	// UsageEstimated is set when the vendor reported no usage for the
+	// stream and Usage holds token estimates of the prompt and the
+	// streamed content instead
+	UsageEstimated bool `json:"usage_estimated,omitempty"`
+	// RawEvents holds the data of the vendor's stream events when the
+	// request asked for them with IncludeRawResponse, and is nil
+	// otherwise. It is complete once done is signalled.
+	RawEvents []json.RawMessage `json:"raw_events,omitempty"`
+	// RequestBytes is the size of the request body sent to the vendor,
+	// and ResponseBytes the number of bytes of the stream read so far; the
+	// latter is complete once done is signalled.
+	RequestBytes  int64     `json:"request_bytes,omitempty"`
+	ResponseBytes int64     `json:"response_bytes,omitempty"`
+	Model         string    `json:"model"`
+	Vendor        string    `json:"vendor"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Senders hold mu for reading while they send; Close takes it for
+	// writing once stop has released them
+	closed bool
+	mu     sync.RWMutex
+
+	// stop is closed by Close so producers blocked on a send give up
+	stopMu   sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
+// DefaultStreamBufferSize is the number of content chunks a streaming
+// response buffers when no size is configured
+const DefaultStreamBufferSize = 100
+
 // NewStreamingResponse creates a new streaming response
 func NewStreamingResponse(model, vendor string) *StreamingResponse {
+	return NewStreamingResponseWithBuffer(model, vendor, DefaultStreamBufferSize)
+}
+
+// NewStreamingResponseWithBuffer creates a new streaming response whose
+// content channel buffers bufferSize chunks. Once the buffer is full the
+// producer blocks until the consumer reads, so chunks are never dropped.
+// A bufferSize of zero or less uses DefaultStreamBufferSize.
+func NewStreamingResponseWithBuffer(model, vendor string, bufferSize int) *StreamingResponse {
+	if bufferSize <= 0 {
+		bufferSize = DefaultStreamBufferSize
+	}
 	return &StreamingResponse{
-		ContentChan: make(chan string, 100),
+		ContentChan: make(chan string, bufferSize),
 		DoneChan:    make(chan bool, 1),
 		ErrorChan:   make(chan error, 1),
 		Model:       model,
@@ -157,8 +519,13 @@ func NewStreamingResponse(model, vendor string) *StreamingResponse {
 	}
 }
 
-// Close closes all channels in the streaming response
+// Close closes all channels in the streaming response. Producers blocked
+// in Send, SendDone or SendError are released first, so a consumer that
+// stops reading can Close the stream to stop its producer.
 func (sr *StreamingResponse) Close() {
+	stop := sr.stopChan()
+	sr.stopOnce.Do(func() { close(stop) })
+
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
@@ -171,11 +538,173 @@ func (sr *StreamingResponse) Close() {
 	close(sr.ErrorChan)
 }
 
+// Send delivers a content chunk, blocking while the buffer is full. It
+// returns false once the stream is closed, and the producer should stop.
+func (sr *StreamingResponse) Send(content string) bool {
+	return sendOrStop(sr, sr.ContentChan, content)
+}
+
+// SendDone signals that the stream completed. It returns false once the
+// stream is closed.
+func (sr *StreamingResponse) SendDone() bool {
+	return sendOrStop(sr, sr.DoneChan, true)
+}
+
+// SendError signals that the stream failed. It returns false once the
+// stream is closed.
+func (sr *StreamingResponse) SendError(err error) bool {
+	return sendOrStop(sr, sr.ErrorChan, err)
+}
+
+// sendOrStop sends value on ch unless the stream is or gets closed
+func sendOrStop[T any](sr *StreamingResponse, ch chan T, value T) bool {
+	stop := sr.stopChan()
+
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	if sr.closed {
+		return false
+	}
+	select {
+	case ch <- value:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// stopChan returns the stop channel, creating it for streaming responses
+// built without NewStreamingResponse
+func (sr *StreamingResponse) stopChan() chan struct{} {
+	sr.stopMu.Lock()
+	defer sr.stopMu.Unlock()
+
+	if sr.stop == nil {
+		sr.stop = make(chan struct{})
+	}
+	return sr.stop
+}
+
+// Reader returns the stream's content as an io.ReadCloser, for consumers
+// that expect one, such as io.Copy to an HTTP response. Read blocks until
+// content arrives, and returns io.EOF once the stream is done or the
+// stream's error if it fails. Closing the reader closes the stream. The
+// reader must be the stream's only consumer.
+func (sr *StreamingResponse) Reader() io.ReadCloser {
+	return &streamReader{stream: sr}
+}
+
+// streamReader reads a streaming response's content as bytes
+type streamReader struct {
+	stream *StreamingResponse
+	// pending is the unread rest of the current chunk
+	pending []byte
+	// end is how the stream ended, once it has; err is returned by Read
+	// once the content buffered before the end has been read
+	end error
+	err error
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *streamReader) Close() error {
+	r.stream.Close()
+	return nil
+}
+
+// next waits for the next chunk or the end of the stream. Content that was
+// buffered when the stream ended is read before the end is reported.
+func (r *streamReader) next() {
+	if r.end != nil {
+		select {
+		case chunk, ok := <-r.stream.ContentChan:
+			if ok {
+				r.pending = []byte(chunk)
+				return
+			}
+		default:
+		}
+		r.err = r.end
+		return
+	}
+
+	select {
+	case chunk, ok := <-r.stream.ContentChan:
+		if !ok {
+			r.err = r.closedEnd()
+			return
+		}
+		r.pending = []byte(chunk)
+	case _, ok := <-r.stream.DoneChan:
+		r.end = io.EOF
+		if !ok {
+			r.end = r.closedEnd()
+		}
+	case err := <-r.stream.ErrorChan:
+		// A nil error means the stream was closed after it was done
+		r.end = io.EOF
+		if err != nil {
+			r.end = err
+		}
+	}
+}
+
+// closedEnd reports how a closed stream ended, picking up an error sent
+// just before it was closed
+func (r *streamReader) closedEnd() error {
+	select {
+	case err := <-r.stream.ErrorChan:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+	return io.EOF
+}
+
 // Usage represents token usage information
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Prompt tokens written to and read from the vendor's prompt cache.
+	// Both are included in PromptTokens, and are priced differently from
+	// uncached prompt tokens.
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+	CacheReadTokens     int `json:"cache_read_tokens,omitempty"`
+	// ReasoningTokens are the completion tokens a reasoning model spent
+	// thinking, included in CompletionTokens. It is only reported for
+	// requests with IncludeReasoning.
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:        u.PromptTokens + other.PromptTokens,
+		CompletionTokens:    u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:         u.TotalTokens + other.TotalTokens,
+		CacheCreationTokens: u.CacheCreationTokens + other.CacheCreationTokens,
+		CacheReadTokens:     u.CacheReadTokens + other.CacheReadTokens,
+		ReasoningTokens:     u.ReasoningTokens + other.ReasoningTokens,
+	}
+}
+
+// EstimateTokens roughly estimates the number of tokens in text, at about
+// four characters per token
+func EstimateTokens(text string) int {
+	return len(text) / 4
 }
 
 // Capabilities represents what a vendor can do
@@ -184,6 +713,38 @@ type Capabilities struct {
 	SupportsStreaming bool     `json:"supports_streaming"`
 	MaxTokens         int      `json:"max_tokens"`
 	MaxInputTokens    int      `json:"max_input_tokens"`
+	// MaxStopSequences is how many stop sequences a request may carry, or
+	// zero when the vendor sets no limit
+	MaxStopSequences int `json:"max_stop_sequences,omitempty"`
+	// Features lists what each model supports. Models without an entry are
+	// assumed to support every feature.
+	Features map[string]ModelFeatures `json:"features,omitempty"`
+}
+
+// ModelFeatures describes the optional features of a model
+type ModelFeatures struct {
+	Vision    bool `json:"vision"`
+	Tools     bool `json:"tools"`
+	JSONMode  bool `json:"json_mode"`
+	Streaming bool `json:"streaming"`
+}
+
+// Missing returns the names of the features in required that f lacks
+func (f ModelFeatures) Missing(required ModelFeatures) []string {
+	var missing []string
+	if required.Vision && !f.Vision {
+		missing = append(missing, "vision")
+	}
+	if required.Tools && !f.Tools {
+		missing = append(missing, "tools")
+	}
+	if required.JSONMode && !f.JSONMode {
+		missing = append(missing, "json mode")
+	}
+	if required.Streaming && !f.Streaming {
+		missing = append(missing, "streaming")
+	}
+	return missing
 }
 
 // VendorConfig holds configuration for a specific vendor
@@ -193,6 +754,122 @@ type VendorConfig struct {
 	Timeout   time.Duration     `json:"timeout,omitempty"`
 	Headers   map[string]string `json:"headers,omitempty"`
 	RateLimit RateLimit         `json:"rate_limit,omitempty"`
+	// Additional models the vendor serves beyond its built-in list
+	Models []string `json:"models,omitempty"`
+	// ModelNameMap translates logical model names into the IDs this vendor
+	// expects, e.g. "gpt-3.5-turbo" to "gpt-35-turbo" for Azure
+	ModelNameMap map[string]string `json:"model_name_map,omitempty"`
+	// TierModels names the vendor's default model for each capability tier
+	// ("fast", "balanced", "sophisticated"), used when a request leaves the
+	// model to its mode
+	TierModels map[string]string `json:"tier_models,omitempty"`
+	// CaptureHeaders lists the response headers copied into
+	// Response.VendorHeaders, defaulting to DefaultCaptureHeaders. An empty,
+	// non-nil list captures nothing.
+	CaptureHeaders []string `json:"capture_headers,omitempty"`
+	// EmbeddingBatchSize caps the inputs sent in one embeddings call,
+	// defaulting to the vendor's API limit. Dispatcher.Embed splits larger
+	// requests into several calls.
+	EmbeddingBatchSize int `json:"embedding_batch_size,omitempty"`
+	// RetryableStatusCodes lists the HTTP statuses of this vendor's error
+	// responses that the retry policy retries, defaulting to
+	// DefaultRetryableStatusCodes. An empty, non-nil list retries none.
+	RetryableStatusCodes []int `json:"retryable_status_codes,omitempty"`
+}
+
+// DefaultRetryableStatusCodes are the HTTP statuses retried when a vendor's
+// VendorConfig.RetryableStatusCodes is nil: rate limiting and transient
+// server errors
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultCaptureHeaders are the rate-limit headers OpenAI-compatible APIs and
+// Anthropic return, captured when VendorConfig.CaptureHeaders is nil
+var DefaultCaptureHeaders = []string{
+	"x-ratelimit-remaining-requests",
+	"x-ratelimit-remaining-tokens",
+	"x-ratelimit-reset-requests",
+	"x-ratelimit-reset-tokens",
+	"anthropic-ratelimit-requests-remaining",
+	"anthropic-ratelimit-tokens-remaining",
+	"anthropic-ratelimit-requests-reset",
+	"anthropic-ratelimit-tokens-reset",
+	"retry-after",
+}
+
+// Capability tiers used as TierModels keys
+const (
+	TierFast          = "fast"
+	TierBalanced      = "balanced"
+	TierSophisticated = "sophisticated"
+)
+
+// CapabilityProvider reports a vendor's current capabilities at runtime, for
+// example from the vendor's /models endpoint, so they don't drift from the
+// hardcoded ones as providers add models
+type CapabilityProvider interface {
+	FetchCapabilities(ctx context.Context) (Capabilities, error)
+}
+
+// TierModelProvider is implemented by vendors that can name their default
+// model for a capability tier
+type TierModelProvider interface {
+	// TierModel returns the model for the tier, or "" if none is configured
+	TierModel(tier string) string
+}
+
+// RateLimitProvider is implemented by vendors with a configured RateLimit,
+// which the dispatcher enforces before sending them requests
+type RateLimitProvider interface {
+	// RateLimit returns the vendor's limits; zero fields are unlimited
+	RateLimit() RateLimit
+}
+
+// RetryableStatusProvider is implemented by vendors that declare which HTTP
+// statuses of their error responses are worth retrying
+type RetryableStatusProvider interface {
+	// RetryableStatusCodes returns the retryable statuses, or nil for
+	// DefaultRetryableStatusCodes
+	RetryableStatusCodes() []int
+}
+
+// HealthProber is implemented by vendors whose IsAvailable reports cached
+// health, so the dispatcher can check availability afresh before giving up
+// on them
+type HealthProber interface {
+	ProbeHealth(ctx context.Context) bool
+}
+
+// AssistantPrefiller is implemented by vendors that continue a trailing
+// assistant message instead of starting a new reply, so an interrupted
+// stream can be resumed from the content already received
+type AssistantPrefiller interface {
+	SupportsAssistantPrefill() bool
+}
+
+// TierModel returns the configured model for the tier, or "" if none is set
+func (vc *VendorConfig) TierModel(tier string) string {
+	if vc == nil {
+		return ""
+	}
+	return vc.TierModels[tier]
+}
+
+// VendorModelName returns the vendor's ID for the given logical model name,
+// or the name unchanged when it has no mapping
+func (vc *VendorConfig) VendorModelName(model string) string {
+	if vc == nil {
+		return model
+	}
+	if mapped, ok := vc.ModelNameMap[model]; ok && mapped != "" {
+		return mapped
+	}
+	return model
 }
 
 // Validate checks if the vendor config is valid
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"path"
+	"strings"
+)
+
 // VendorModels contains the mapping of vendors to their available models
 var VendorModels = map[string][]string{
 	"openai": {
@@ -30,6 +35,33 @@ var VendorModels = map[string][]string{
 		"gpt-4",
 		"gpt-3.5-turbo",
 	},
+	"together": {
+		"meta-llama/Llama-3.1-70B-Instruct-Turbo",
+		"meta-llama/Llama-3.1-8B-Instruct-Turbo",
+		"meta-llama/Llama-3.1-405B-Instruct-Turbo",
+		"mistralai/Mixtral-8x7B-Instruct-v0.1",
+		"Qwen/Qwen2.5-72B-Instruct-Turbo",
+	},
+	"openrouter": {
+		"anthropic/claude-3.5-sonnet",
+		"openai/gpt-4o",
+		"openai/gpt-4o-mini",
+		"google/gemini-pro-1.5",
+		"meta-llama/llama-3.1-70b-instruct",
+	},
+	"cohere": {
+		"command-r-plus",
+		"command-r",
+		"command",
+	},
+	"bedrock": {
+		"anthropic.claude-3-5-sonnet-20240620-v1:0",
+		"anthropic.claude-3-sonnet-20240229-v1:0",
+		"anthropic.claude-3-haiku-20240307-v1:0",
+		"amazon.titan-text-premier-v1:0",
+		"amazon.titan-text-express-v1",
+		"amazon.titan-text-lite-v1",
+	},
 	"local": {
 		"llama2:7b",
 		"llama2:13b",
@@ -42,6 +74,58 @@ var VendorModels = map[string][]string{
 	},
 }
 
+// VendorModelFeatures records the features of the models in VendorModels.
+// Vendors and models left out are assumed to support every feature.
+var VendorModelFeatures = map[string]map[string]ModelFeatures{
+	"openai": {
+		"gpt-4o":            {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gpt-4o-mini":       {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gpt-4-turbo":       {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gpt-4":             {Tools: true, Streaming: true},
+		"gpt-3.5-turbo":     {Tools: true, JSONMode: true, Streaming: true},
+		"gpt-3.5-turbo-16k": {Tools: true, Streaming: true},
+	},
+	"anthropic": {
+		"claude-3-5-sonnet-20241022": {Vision: true, Tools: true, Streaming: true},
+		"claude-3-5-haiku-20241022":  {Tools: true, Streaming: true},
+		"claude-3-opus-20240229":     {Vision: true, Tools: true, Streaming: true},
+		"claude-3-sonnet-20240229":   {Vision: true, Tools: true, Streaming: true},
+		"claude-3-haiku-20240307":    {Vision: true, Tools: true, Streaming: true},
+	},
+	"google": {
+		"gemini-1.5-pro":    {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gemini-1.5-flash":  {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gemini-pro":        {Tools: true, Streaming: true},
+		"gemini-pro-vision": {Vision: true, Streaming: true},
+	},
+	"azure": {
+		"gpt-4o":        {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gpt-4o-mini":   {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gpt-4-turbo":   {Vision: true, Tools: true, JSONMode: true, Streaming: true},
+		"gpt-4":         {Tools: true, Streaming: true},
+		"gpt-3.5-turbo": {Tools: true, JSONMode: true, Streaming: true},
+	},
+	"cohere": {
+		"command-r-plus": {Tools: true, Streaming: true},
+		"command-r":      {Tools: true, Streaming: true},
+		"command":        {Streaming: true},
+	},
+	"bedrock": {
+		"anthropic.claude-3-5-sonnet-20240620-v1:0": {Vision: true, Tools: true, Streaming: true},
+		"anthropic.claude-3-sonnet-20240229-v1:0":   {Vision: true, Tools: true, Streaming: true},
+		"anthropic.claude-3-haiku-20240307-v1:0":    {Vision: true, Tools: true, Streaming: true},
+		"amazon.titan-text-premier-v1:0":            {Streaming: true},
+		"amazon.titan-text-express-v1":              {Streaming: true},
+		"amazon.titan-text-lite-v1":                 {Streaming: true},
+	},
+}
+
+// GetVendorModelFeatures returns the feature matrix for a given vendor's
+// models, or nil when none is recorded
+func GetVendorModelFeatures(vendor string) map[string]ModelFeatures {
+	return VendorModelFeatures[vendor]
+}
+
 // GetVendorModels returns the list of models for a given vendor
 func GetVendorModels(vendor string) []string {
 	if models, exists := VendorModels[vendor]; exists {
@@ -72,3 +156,47 @@ func GetVendorForModel(model string) string {
 	}
 	return ""
 }
+
+// MatchModelPattern reports whether a model name matches a glob pattern such
+// as "gpt-4*" or "claude-3-?-sonnet*". "*" matches any run of characters,
+// including the "/" of vendor-prefixed IDs, and a pattern without a "/"
+// also matches the name after the last one, so "gpt-4*" matches
+// "openai/gpt-4o" and "*llama*" matches "meta-llama/Llama-3.1-8B". A
+// malformed pattern never matches.
+func MatchModelPattern(pattern, model string) bool {
+	if globMatch(pattern, model) {
+		return true
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 && !strings.Contains(pattern, "/") {
+		return globMatch(pattern, model[i+1:])
+	}
+	return false
+}
+
+// globMatch is path.Match with "/" matched like any other character
+func globMatch(pattern, name string) bool {
+	const separator = "\x00"
+	matched, err := path.Match(strings.ReplaceAll(pattern, "/", separator), strings.ReplaceAll(name, "/", separator))
+	return err == nil && matched
+}
+
+// LookupModelPattern returns the entry for a model in a map keyed by model
+// names or glob patterns: the model's own entry, or else that of the
+// longest pattern matching it, ties going to the first pattern in order
+func LookupModelPattern[V any](entries map[string]V, model string) (V, bool) {
+	if value, exists := entries[model]; exists {
+		return value, true
+	}
+
+	best := ""
+	for pattern := range entries {
+		if !MatchModelPattern(pattern, model) {
+			continue
+		}
+		if len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best = pattern
+		}
+	}
+	value, exists := entries[best]
+	return value, exists && best != ""
+}
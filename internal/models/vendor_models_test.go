@@ -234,3 +234,32 @@ func TestModelVendorMapping(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchModelPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		model   string
+		want    bool
+	}{
+		{"gpt-4*", "gpt-4o", true},
+		{"gpt-4*", "gpt-4", true},
+		{"gpt-4*", "gpt-3.5-turbo", false},
+		{"claude-3-?-haiku*", "claude-3-5-haiku-20241022", true},
+		{"gpt-4o", "gpt-4o", true},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"[", "gpt-4o", false},
+		{"gpt-4*", "openai/gpt-4o", true},
+		{"*llama*", "meta-llama/Llama-3.1-8B-Instruct-Turbo", true},
+		{"*-8B-*", "meta-llama/Llama-3.1-8B-Instruct-Turbo", true},
+		{"meta-*", "meta-llama/Llama-3.1-8B-Instruct-Turbo", true},
+		{"openai/*", "openai/gpt-4o", true},
+		{"openai/*", "anthropic/claude-3.5-sonnet", false},
+		{"gpt-4*", "openai/gpt-3.5-turbo", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchModelPattern(tt.pattern, tt.model); got != tt.want {
+			t.Errorf("MatchModelPattern(%q, %q) = %v, want %v", tt.pattern, tt.model, got, tt.want)
+		}
+	}
+}
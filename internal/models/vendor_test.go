@@ -1,6 +1,10 @@
 package models
 
 import (
+	"errors"
+	"io"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -108,15 +112,28 @@ func TestRequest_Validate(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "invalid mode",
+			name: "max_tokens vendor default",
+			request: &Request{
+				Model: "gpt-3.5-turbo",
+				Messages: []Message{
+					{Role: "user", Content: "Hello"},
+				},
+				MaxTokens: MaxTokensVendorDefault,
+			},
+			wantErr: false,
+		},
+		{
+			// Modes are checked against the dispatcher's registered
+			// strategies, which Validate doesn't know
+			name: "unregistered mode",
 			request: &Request{
 				Model: "",
-				Mode:  "invalid_mode",
+				Mode:  "custom_mode",
 				Messages: []Message{
 					{Role: "user", Content: "Hello"},
 				},
 			},
-			wantErr: true,
+			wantErr: false,
 		},
 		{
 			name: "invalid message",
@@ -140,6 +157,40 @@ func TestRequest_Validate(t *testing.T) {
 	}
 }
 
+func TestRequest_Clone(t *testing.T) {
+	original := &Request{
+		Model:       "gpt-4",
+		Messages:    []Message{{Role: "user", Content: "Hello"}},
+		Temperature: 0.5,
+		Stop:        []string{"END"},
+	}
+
+	clone := original.Clone()
+	clone.Model = "gpt-3.5-turbo"
+	clone.Temperature = 0.1
+	clone.Messages[0].Content = "Changed"
+	clone.Messages = append(clone.Messages, Message{Role: "assistant", Content: "Hi"})
+	clone.Stop[0] = "STOP"
+
+	if original.Model != "gpt-4" {
+		t.Errorf("Expected original model gpt-4, got %s", original.Model)
+	}
+	if original.Temperature != 0.5 {
+		t.Errorf("Expected original temperature 0.5, got %f", original.Temperature)
+	}
+	if len(original.Messages) != 1 || original.Messages[0].Content != "Hello" {
+		t.Errorf("Expected original messages unchanged, got %v", original.Messages)
+	}
+	if original.Stop[0] != "END" {
+		t.Errorf("Expected original stop END, got %s", original.Stop[0])
+	}
+
+	var nilRequest *Request
+	if nilRequest.Clone() != nil {
+		t.Error("Expected nil clone of nil request")
+	}
+}
+
 func TestMessage_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -171,11 +222,31 @@ func TestMessage_Validate(t *testing.T) {
 			message: Message{Role: "user", Content: ""},
 			wantErr: true,
 		},
+		{
+			name:    "image parts",
+			message: Message{Role: "user", Parts: []ContentPart{{Type: ContentPartText, Text: "What is this?"}, {Type: ContentPartImage, ImageURL: "https://example.com/cat.png"}}},
+			wantErr: false,
+		},
+		{
+			name:    "image part without URL",
+			message: Message{Role: "user", Parts: []ContentPart{{Type: ContentPartImage}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown part type",
+			message: Message{Role: "user", Parts: []ContentPart{{Type: "audio"}}},
+			wantErr: true,
+		},
 		{
 			name:    "invalid role",
 			message: Message{Role: "invalid", Content: "Hello"},
 			wantErr: true,
 		},
+		{
+			name:    "parts without content",
+			message: Message{Role: "user", Parts: []ContentPart{{Type: ContentPartImage, ImageURL: "https://example.com/cat.png"}}},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -188,6 +259,31 @@ func TestMessage_Validate(t *testing.T) {
 	}
 }
 
+func TestRequest_RequiredFeatures(t *testing.T) {
+	req := &Request{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+	}
+	if required := req.RequiredFeatures(); required != (ModelFeatures{}) {
+		t.Errorf("Expected a plain request to need no features, got %+v", required)
+	}
+
+	req.Stream = true
+	req.ResponseFormat = ResponseFormatJSON
+	req.Messages = append(req.Messages, Message{Role: "user", Parts: []ContentPart{
+		{Type: ContentPartImage, ImageURL: "data:image/png;base64,iVBORw0KGgo="},
+	}})
+	expected := ModelFeatures{Vision: true, JSONMode: true, Streaming: true}
+	if required := req.RequiredFeatures(); required != expected {
+		t.Errorf("Expected %+v, got %+v", expected, required)
+	}
+
+	missing := ModelFeatures{Tools: true, Streaming: true}.Missing(expected)
+	if len(missing) != 2 || missing[0] != "vision" || missing[1] != "json mode" {
+		t.Errorf("Expected vision and json mode to be missing, got %v", missing)
+	}
+}
+
 func TestVendorConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -278,6 +374,27 @@ func TestNewStreamingResponse(t *testing.T) {
 	}
 }
 
+func TestNewStreamingResponseWithBuffer(t *testing.T) {
+	tests := []struct {
+		name       string
+		bufferSize int
+		expected   int
+	}{
+		{"custom size", 8, 8},
+		{"zero uses default", 0, DefaultStreamBufferSize},
+		{"negative uses default", -1, DefaultStreamBufferSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamingResp := NewStreamingResponseWithBuffer("gpt-4", "openai", tt.bufferSize)
+			if cap(streamingResp.ContentChan) != tt.expected {
+				t.Errorf("Expected ContentChan buffer size %d, got %d", tt.expected, cap(streamingResp.ContentChan))
+			}
+		})
+	}
+}
+
 func TestStreamingResponse_Close(t *testing.T) {
 	streamingResp := NewStreamingResponse("gpt-4", "openai")
 
@@ -325,6 +442,119 @@ func TestStreamingResponse_Close(t *testing.T) {
 	}
 }
 
+func TestStreamingResponse_CloseStopsProducer(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	streamingResp := NewStreamingResponseWithBuffer("gpt-4", "openai", 1)
+	exited := make(chan int)
+	go func() {
+		sent := 0
+		for streamingResp.Send("chunk") {
+			sent++
+		}
+		exited <- sent
+	}()
+
+	// Wait for the producer to fill the buffer and block on the next send
+	deadline := time.Now().Add(time.Second)
+	for len(streamingResp.ContentChan) < cap(streamingResp.ContentChan) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the producer to fill the buffer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The consumer stops reading and closes the stream
+	streamingResp.Close()
+
+	select {
+	case sent := <-exited:
+		if sent != 1 {
+			t.Errorf("Expected 1 chunk sent before the close, got %d", sent)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the blocked producer to exit after Close")
+	}
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline.Add(time.Second)) {
+			t.Fatalf("Expected %d goroutines after Close, got %d", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if streamingResp.Send("late") || streamingResp.SendDone() || streamingResp.SendError(nil) {
+		t.Error("Expected sends on a closed stream to report false")
+	}
+}
+
+func TestStreamingResponse_Reader(t *testing.T) {
+	chunks := []string{"Hello", ", ", "world", "!"}
+	streamErr := errors.New("connection reset")
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "done", wantErr: nil},
+		{name: "error", err: streamErr, wantErr: streamErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A small buffer keeps the producer ahead of the reader
+			streamingResp := NewStreamingResponseWithBuffer("gpt-4", "openai", 2)
+			go func() {
+				defer streamingResp.Close()
+				for _, chunk := range chunks {
+					if !streamingResp.Send(chunk) {
+						return
+					}
+				}
+				if tt.err != nil {
+					streamingResp.SendError(tt.err)
+				} else {
+					streamingResp.SendDone()
+				}
+			}()
+
+			reader := streamingResp.Reader()
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if want := strings.Join(chunks, ""); string(content) != want {
+				t.Errorf("Expected content %q, got %q", want, content)
+			}
+
+			// The end keeps being reported
+			if n, err := reader.Read(make([]byte, 8)); n != 0 || (tt.wantErr == nil && err != io.EOF) || (tt.wantErr != nil && err != tt.wantErr) {
+				t.Errorf("Expected the end to be reported again, got %d bytes and %v", n, err)
+			}
+		})
+	}
+}
+
+func TestStreamingResponse_ReaderClose(t *testing.T) {
+	streamingResp := NewStreamingResponseWithBuffer("gpt-4", "openai", 1)
+	reader := streamingResp.Reader()
+
+	streamingResp.Send("Hel")
+	buf := make([]byte, 2)
+	if n, err := reader.Read(buf); n != 2 || err != nil || string(buf) != "He" {
+		t.Fatalf("Expected to read part of the chunk, got %q and %v", buf[:n], err)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Expected no error closing the reader, got %v", err)
+	}
+	if streamingResp.Send("lo") {
+		t.Error("Expected closing the reader to close the stream")
+	}
+}
+
 func TestStreamingResponse_Usage(t *testing.T) {
 	streamingResp := NewStreamingResponse("gpt-4", "openai")
 
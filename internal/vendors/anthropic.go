@@ -1,7 +1,6 @@
 package vendors
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -14,6 +13,11 @@ import (
 	"github.com/llmefficiency/llmdispatcher/internal/models"
 )
 
+// anthropicDefaultMaxTokens, the most Claude 3 models generate, is sent for
+// requests that leave the response length to the vendor. The Messages API
+// has no default and rejects requests without max_tokens.
+const anthropicDefaultMaxTokens = 4096
+
 // AnthropicVendor implements the LLMVendor interface for Anthropic's Claude models
 type AnthropicVendor struct {
 	config          *models.VendorConfig
@@ -58,6 +62,9 @@ func (a *AnthropicVendor) SendRequest(ctx context.Context, req *models.Request)
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
+	if err := imagesNotSupported(a.Name(), req); err != nil {
+		return nil, err
+	}
 
 	// Convert to Anthropic format
 	anthropicReq := a.convertRequest(req)
@@ -99,7 +106,7 @@ func (a *AnthropicVendor) SendRequest(ctx context.Context, req *models.Request)
 
 	// Check HTTP status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(a.Name(), resp.StatusCode, resp.Header, body)
 	}
 
 	// Parse response
@@ -110,6 +117,10 @@ func (a *AnthropicVendor) SendRequest(ctx context.Context, req *models.Request)
 
 	// Convert to standard response
 	response := a.convertResponse(&anthropicResp, req.Model)
+	response.VendorHeaders = captureHeaders(a.config, resp.Header)
+	response.Raw = rawBody(req, body)
+	response.RequestBytes = int64(len(jsonData))
+	response.ResponseBytes = int64(len(body))
 	return response, nil
 }
 
@@ -118,8 +129,9 @@ func (a *AnthropicVendor) GetCapabilities() models.Capabilities {
 	return models.Capabilities{
 		Models:            models.GetVendorModels("anthropic"),
 		SupportsStreaming: true,
-		MaxTokens:         4096,
+		MaxTokens:         anthropicDefaultMaxTokens,
 		MaxInputTokens:    200000,
+		Features:          models.GetVendorModelFeatures("anthropic"),
 	}
 }
 
@@ -128,10 +140,39 @@ func (a *AnthropicVendor) IsAvailable(ctx context.Context) bool {
 	return a.config.APIKey != ""
 }
 
+// TierModel returns the model configured for a capability tier
+func (a *AnthropicVendor) TierModel(tier string) string {
+	return a.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (a *AnthropicVendor) RateLimit() models.RateLimit {
+	return a.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (a *AnthropicVendor) RetryableStatusCodes() []int {
+	return a.config.RetryableStatusCodes
+}
+
+// SupportsAssistantPrefill reports that Anthropic continues a trailing
+// assistant message
+func (a *AnthropicVendor) SupportsAssistantPrefill() bool {
+	return true
+}
+
 // SendStreamingRequest sends a streaming request to Anthropic
 func (a *AnthropicVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	// Tool calls aren't parsed from streams
+	if err := toolsNotSupported(a.Name()+" streaming", req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(a.Name(), req); err != nil {
+		return nil, err
+	}
+
 	// Create streaming response
-	streamingResp := models.NewStreamingResponse(req.Model, a.Name())
+	streamingResp := newStreamingResponse(req, a.Name())
 
 	// Convert to Anthropic format
 	anthropicReq := a.convertRequest(req)
@@ -144,8 +185,8 @@ func (a *AnthropicVendor) SendStreamingRequest(ctx context.Context, req *models.
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create HTTP request without context for streaming
-	httpReq, err := http.NewRequest("POST", a.config.BaseURL+"/v1/messages", bytes.NewBuffer(reqBody))
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", a.config.BaseURL+"/v1/messages", bytes.NewBuffer(reqBody))
 	if err != nil {
 		streamingResp.Close()
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -174,58 +215,16 @@ func (a *AnthropicVendor) SendStreamingRequest(ctx context.Context, req *models.
 		// Read error response body
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(a.Name(), resp.StatusCode, resp.Header, body)
 	}
 
+	streamingResp.RequestBytes = int64(len(reqBody))
+
 	// Handle streaming response in goroutine
 	go func() {
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					streamingResp.DoneChan <- true
-					return
-				}
-				streamingResp.ErrorChan <- fmt.Errorf("failed to read stream: %w", err)
-				return
-			}
-
-			// Skip empty lines
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-
-			// Remove "data: " prefix
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				data = strings.TrimSpace(data)
-				if data == "[DONE]" {
-					streamingResp.DoneChan <- true
-					return
-				}
-
-				// Parse the JSON data
-				var streamResp struct {
-					Type  string `json:"type"`
-					Delta struct {
-						Type string `json:"type"`
-						Text string `json:"text"`
-					} `json:"delta"`
-				}
-
-				if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-					streamingResp.ErrorChan <- fmt.Errorf("failed to parse stream data: %w", err)
-					return
-				}
-
-				if streamResp.Type == "content_block_delta" && streamResp.Delta.Type == "text_delta" {
-					streamingResp.ContentChan <- streamResp.Delta.Text
-				}
-			}
-		}
+		parseAnthropicStream(resp.Body, streamingResp)
 	}()
 
 	return streamingResp, nil
@@ -233,21 +232,25 @@ func (a *AnthropicVendor) SendStreamingRequest(ctx context.Context, req *models.
 
 // convertRequest converts our standard request to Anthropic format
 func (a *AnthropicVendor) convertRequest(req *models.Request) *anthropicRequest {
-	// Convert messages to Anthropic format
-	messages := make([]anthropicMessage, len(req.Messages))
-	for i, msg := range req.Messages {
-		messages[i] = anthropicMessage{
-			Role:    msg.Role,
-			Content: []anthropicContent{{Type: "text", Text: msg.Content}},
-		}
-	}
+	// Anthropic takes a single system prompt outside the messages
+	system, rest := models.JoinSystemMessages(req.Messages, models.DefaultSystemMessageSeparator)
 
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
 	anthropicReq := &anthropicRequest{
-		Model:       req.Model,
-		Messages:    messages,
-		MaxTokens:   req.MaxTokens,
+		Model:       a.config.VendorModelName(req.Model),
+		System:      system,
+		Messages:    anthropicMessages(rest),
+		MaxTokens:   maxTokens,
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
+		Tools:       anthropicTools(req.Tools),
+		ToolChoice:  anthropicToolChoiceFor(req.ToolChoice),
+	}
+	if req.User != "" {
+		anthropicReq.Metadata = &anthropicMetadata{UserID: req.User}
 	}
 
 	return anthropicReq
@@ -255,36 +258,167 @@ func (a *AnthropicVendor) convertRequest(req *models.Request) *anthropicRequest
 
 // convertResponse converts Anthropic response to our standard format
 func (a *AnthropicVendor) convertResponse(anthropicResp *anthropicResponse, model string) *models.Response {
-	// Extract content from response
-	var content string
-	if len(anthropicResp.Content) > 0 {
-		content = anthropicResp.Content[0].Text
-	}
+	content, toolCalls := anthropicContentOf(anthropicResp.Content)
 
-	// Calculate token usage
+	// Calculate token usage; Anthropic counts cached prompt tokens
+	// separately from input_tokens
+	promptTokens := anthropicResp.Usage.InputTokens + anthropicResp.Usage.CacheCreationInputTokens + anthropicResp.Usage.CacheReadInputTokens
 	usage := models.Usage{
-		PromptTokens:     anthropicResp.Usage.InputTokens,
-		CompletionTokens: anthropicResp.Usage.OutputTokens,
-		TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
+		PromptTokens:        promptTokens,
+		CompletionTokens:    anthropicResp.Usage.OutputTokens,
+		TotalTokens:         promptTokens + anthropicResp.Usage.OutputTokens,
+		CacheCreationTokens: anthropicResp.Usage.CacheCreationInputTokens,
+		CacheReadTokens:     anthropicResp.Usage.CacheReadInputTokens,
 	}
 
 	return &models.Response{
-		Content:   content,
-		Model:     model,
-		Vendor:    a.Name(),
-		Usage:     usage,
-		CreatedAt: time.Now(),
+		Content:      content,
+		Model:        model,
+		Vendor:       a.Name(),
+		Usage:        usage,
+		FinishReason: anthropicFinishReason(anthropicResp.StopReason),
+		CreatedAt:    time.Now(),
+		ToolCalls:    toolCalls,
+		// Extended thinking arrives in thinking blocks
+		ReasoningContent: anthropicThinking(anthropicResp.Content),
+	}
+}
+
+// anthropicMessages converts messages to Anthropic's content blocks. Tool
+// calls become tool_use blocks, and the results in consecutive "tool"
+// messages are sent together as the tool_result blocks of one user
+// message, as Anthropic requires.
+func anthropicMessages(messages []models.Message) []anthropicMessage {
+	converted := make([]anthropicMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "tool" {
+			result := anthropicContent{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Text()}
+			if last := len(converted) - 1; last >= 0 && converted[last].Role == "user" && converted[last].Content[0].Type == "tool_result" {
+				converted[last].Content = append(converted[last].Content, result)
+				continue
+			}
+			converted = append(converted, anthropicMessage{Role: "user", Content: []anthropicContent{result}})
+			continue
+		}
+
+		var content []anthropicContent
+		if text := msg.Text(); text != "" || len(msg.ToolCalls) == 0 {
+			content = append(content, anthropicContent{Type: "text", Text: text})
+		}
+		for _, call := range msg.ToolCalls {
+			input := json.RawMessage(call.Arguments)
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+			content = append(content, anthropicContent{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+		}
+		converted = append(converted, anthropicMessage{Role: msg.Role, Content: content})
+	}
+	return converted
+}
+
+// anthropicTools converts tools to Anthropic's tool declarations, which
+// require an input schema
+func anthropicTools(tools []models.Tool) []anthropicTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	converted := make([]anthropicTool, len(tools))
+	for i, tool := range tools {
+		schema := tool.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		converted[i] = anthropicTool{Name: tool.Name, Description: tool.Description, InputSchema: schema}
+	}
+	return converted
+}
+
+// anthropicToolChoiceFor converts a tool choice to Anthropic's, where
+// "required" is called "any"
+func anthropicToolChoiceFor(choice string) *anthropicToolChoice {
+	switch choice {
+	case "":
+		return nil
+	case models.ToolChoiceAuto, models.ToolChoiceNone:
+		return &anthropicToolChoice{Type: choice}
+	case models.ToolChoiceRequired:
+		return &anthropicToolChoice{Type: "any"}
+	default:
+		return &anthropicToolChoice{Type: "tool", Name: choice}
+	}
+}
+
+// anthropicContentOf returns the text and the tool calls of a response's
+// content blocks
+func anthropicContentOf(blocks []anthropicContent) (string, []models.ToolCall) {
+	var text strings.Builder
+	var toolCalls []models.ToolCall
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, models.ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	return text.String(), toolCalls
+}
+
+// anthropicThinking returns the text of a response's thinking blocks
+func anthropicThinking(blocks []anthropicContent) string {
+	var thinking strings.Builder
+	for _, block := range blocks {
+		if block.Type == "thinking" {
+			thinking.WriteString(block.Thinking)
+		}
+	}
+	return thinking.String()
+}
+
+// anthropicFinishReason maps Claude's stop reasons onto the OpenAI-style
+// values the rest of the dispatcher expects
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return reason
 	}
 }
 
 // Anthropic API request/response structures
 type anthropicRequest struct {
-	Model       string             `json:"model"`
-	Messages    []anthropicMessage `json:"messages"`
-	MaxTokens   int                `json:"max_tokens,omitempty"`
-	Temperature float64            `json:"temperature,omitempty"`
-	TopP        float64            `json:"top_p,omitempty"`
-	Stream      bool               `json:"stream,omitempty"` // Added for streaming
+	Model       string               `json:"model"`
+	System      string               `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens,omitempty"`
+	Temperature float64              `json:"temperature,omitempty"`
+	TopP        float64              `json:"top_p,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"` // Added for streaming
+	Metadata    *anthropicMetadata   `json:"metadata,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// anthropicMetadata identifies the end user to Anthropic for abuse tracking
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
 }
 
 type anthropicMessage struct {
@@ -294,7 +428,16 @@ type anthropicMessage struct {
 
 type anthropicContent struct {
 	Type string `json:"type"`
-	Text string `json:"text"`
+	Text string `json:"text,omitempty"`
+	// thinking blocks
+	Thinking string `json:"thinking,omitempty"`
+	// tool_use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// tool_result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
 }
 
 type anthropicResponse struct {
@@ -302,10 +445,14 @@ type anthropicResponse struct {
 	Type    string             `json:"type"`
 	Role    string             `json:"role"`
 	Content []anthropicContent `json:"content"`
-	Usage   anthropicUsage     `json:"usage"`
+	// StopReason is e.g. "end_turn", "max_tokens" or "stop_sequence"
+	StopReason string         `json:"stop_reason,omitempty"`
+	Usage      anthropicUsage `json:"usage"`
 }
 
 type anthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
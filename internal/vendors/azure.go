@@ -7,11 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"sort"
 	"time"
 
-	"bufio"
-
 	"github.com/llmefficiency/llmdispatcher/internal/models"
 )
 
@@ -53,6 +51,13 @@ func (a *AzureOpenAIVendor) Name() string {
 
 // SendRequest sends a request to Azure OpenAI API
 func (a *AzureOpenAIVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if err := toolsNotSupported(a.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(a.Name(), req); err != nil {
+		return nil, err
+	}
+
 	// Validate request
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
@@ -69,7 +74,7 @@ func (a *AzureOpenAIVendor) SendRequest(ctx context.Context, req *models.Request
 
 	// Build URL
 	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=2024-02-15-preview",
-		a.config.BaseURL, req.Model)
+		a.config.BaseURL, a.config.VendorModelName(req.Model))
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -101,7 +106,7 @@ func (a *AzureOpenAIVendor) SendRequest(ctx context.Context, req *models.Request
 
 	// Check HTTP status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(a.Name(), resp.StatusCode, resp.Header, body)
 	}
 
 	// Parse response
@@ -112,6 +117,10 @@ func (a *AzureOpenAIVendor) SendRequest(ctx context.Context, req *models.Request
 
 	// Convert to standard response
 	response := a.convertResponse(&azureResp, req.Model)
+	response.VendorHeaders = captureHeaders(a.config, resp.Header)
+	response.Raw = rawBody(req, body)
+	response.RequestBytes = int64(len(jsonData))
+	response.ResponseBytes = int64(len(body))
 	return response, nil
 }
 
@@ -122,6 +131,8 @@ func (a *AzureOpenAIVendor) GetCapabilities() models.Capabilities {
 		SupportsStreaming: true,
 		MaxTokens:         4096,
 		MaxInputTokens:    128000,
+		MaxStopSequences:  4,
+		Features:          models.GetVendorModelFeatures("azure"),
 	}
 }
 
@@ -130,10 +141,32 @@ func (a *AzureOpenAIVendor) IsAvailable(ctx context.Context) bool {
 	return a.config.APIKey != "" && a.config.BaseURL != ""
 }
 
+// TierModel returns the model configured for a capability tier
+func (a *AzureOpenAIVendor) TierModel(tier string) string {
+	return a.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (a *AzureOpenAIVendor) RateLimit() models.RateLimit {
+	return a.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (a *AzureOpenAIVendor) RetryableStatusCodes() []int {
+	return a.config.RetryableStatusCodes
+}
+
 // SendStreamingRequest sends a streaming request to Azure OpenAI
 func (a *AzureOpenAIVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	if err := toolsNotSupported(a.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(a.Name(), req); err != nil {
+		return nil, err
+	}
+
 	// Create streaming response
-	streamingResp := models.NewStreamingResponse(req.Model, a.Name())
+	streamingResp := newStreamingResponse(req, a.Name())
 
 	// Convert to Azure OpenAI format
 	azureReq := a.convertRequest(req)
@@ -146,8 +179,8 @@ func (a *AzureOpenAIVendor) SendStreamingRequest(ctx context.Context, req *model
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create HTTP request without context for streaming
-	httpReq, err := http.NewRequest("POST", a.config.BaseURL+"/openai/deployments/"+req.Model+"/chat/completions?api-version=2024-02-15-preview", bytes.NewBuffer(reqBody))
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", a.config.BaseURL+"/openai/deployments/"+a.config.VendorModelName(req.Model)+"/chat/completions?api-version=2024-02-15-preview", bytes.NewBuffer(reqBody))
 	if err != nil {
 		streamingResp.Close()
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -175,58 +208,16 @@ func (a *AzureOpenAIVendor) SendStreamingRequest(ctx context.Context, req *model
 		// Read error response body
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(a.Name(), resp.StatusCode, resp.Header, body)
 	}
 
+	streamingResp.RequestBytes = int64(len(reqBody))
+
 	// Handle streaming response in goroutine
 	go func() {
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					streamingResp.DoneChan <- true
-					return
-				}
-				streamingResp.ErrorChan <- fmt.Errorf("failed to read stream: %w", err)
-				return
-			}
-
-			// Skip empty lines
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-
-			// Remove "data: " prefix
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				data = strings.TrimSpace(data)
-				if data == "[DONE]" {
-					streamingResp.DoneChan <- true
-					return
-				}
-
-				// Parse the JSON data
-				var streamResp struct {
-					Choices []struct {
-						Delta struct {
-							Content string `json:"content"`
-						} `json:"delta"`
-					} `json:"choices"`
-				}
-
-				if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-					streamingResp.ErrorChan <- fmt.Errorf("failed to parse stream data: %w", err)
-					return
-				}
-
-				if len(streamResp.Choices) > 0 && streamResp.Choices[0].Delta.Content != "" {
-					streamingResp.ContentChan <- streamResp.Choices[0].Delta.Content
-				}
-			}
-		}
+		parseOpenAIStream(resp.Body, streamingResp)
 	}()
 
 	return streamingResp, nil
@@ -239,7 +230,7 @@ func (a *AzureOpenAIVendor) convertRequest(req *models.Request) *azureRequest {
 	for i, msg := range req.Messages {
 		messages[i] = azureMessage{
 			Role:    msg.Role,
-			Content: msg.Content,
+			Content: msg.Text(),
 		}
 	}
 
@@ -249,6 +240,7 @@ func (a *AzureOpenAIVendor) convertRequest(req *models.Request) *azureRequest {
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
 		Stream:      req.Stream,
+		User:        req.User,
 	}
 
 	return azureReq
@@ -258,8 +250,10 @@ func (a *AzureOpenAIVendor) convertRequest(req *models.Request) *azureRequest {
 func (a *AzureOpenAIVendor) convertResponse(azureResp *azureResponse, model string) *models.Response {
 	// Extract content from response
 	var content string
+	var ratings []models.SafetyRating
 	if len(azureResp.Choices) > 0 {
 		content = azureResp.Choices[0].Message.Content
+		ratings = convertAzureContentFilterResults(azureResp.Choices[0].ContentFilterResults)
 	}
 
 	// Calculate token usage
@@ -270,14 +264,36 @@ func (a *AzureOpenAIVendor) convertResponse(azureResp *azureResponse, model stri
 	}
 
 	return &models.Response{
-		Content:   content,
-		Model:     model,
-		Vendor:    a.Name(),
-		Usage:     usage,
-		CreatedAt: time.Now(),
+		Content:       content,
+		Model:         model,
+		Vendor:        a.Name(),
+		Usage:         usage,
+		CreatedAt:     time.Now(),
+		SafetyRatings: ratings,
 	}
 }
 
+// convertAzureContentFilterResults converts Azure's content filter results
+// into safety ratings sorted by category
+func convertAzureContentFilterResults(results map[string]azureContentFilterResult) []models.SafetyRating {
+	if len(results) == 0 {
+		return nil
+	}
+
+	ratings := make([]models.SafetyRating, 0, len(results))
+	for category, result := range results {
+		ratings = append(ratings, models.SafetyRating{
+			Category: category,
+			Severity: result.Severity,
+			Blocked:  result.Filtered,
+		})
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		return ratings[i].Category < ratings[j].Category
+	})
+	return ratings
+}
+
 // Azure OpenAI API request/response structures
 type azureRequest struct {
 	Messages    []azureMessage `json:"messages"`
@@ -285,6 +301,7 @@ type azureRequest struct {
 	Temperature float64        `json:"temperature,omitempty"`
 	TopP        float64        `json:"top_p,omitempty"`
 	Stream      bool           `json:"stream,omitempty"`
+	User        string         `json:"user,omitempty"`
 }
 
 type azureMessage struct {
@@ -305,6 +322,14 @@ type azureChoice struct {
 	Index   int          `json:"index"`
 	Message azureMessage `json:"message"`
 	Delta   azureMessage `json:"delta,omitempty"`
+	// ContentFilterResults maps a harm category such as "hate" to the
+	// result of Azure's content filter
+	ContentFilterResults map[string]azureContentFilterResult `json:"content_filter_results,omitempty"`
+}
+
+type azureContentFilterResult struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity"`
 }
 
 type azureUsage struct {
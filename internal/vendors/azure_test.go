@@ -2,6 +2,7 @@ package vendors
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -234,6 +235,36 @@ func TestAzureOpenAIVendor_ConvertResponse(t *testing.T) {
 	}
 }
 
+func TestAzureOpenAIVendor_ConvertResponse_ContentFilterResults(t *testing.T) {
+	vendor := NewAzureOpenAI(nil)
+	azureResp := &azureResponse{
+		Choices: []azureChoice{
+			{
+				Message: azureMessage{Role: "assistant", Content: "Hello"},
+				ContentFilterResults: map[string]azureContentFilterResult{
+					"violence": {Filtered: true, Severity: "medium"},
+					"hate":     {Filtered: false, Severity: "safe"},
+				},
+			},
+		},
+	}
+
+	response := vendor.convertResponse(azureResp, "gpt-4")
+
+	expected := []models.SafetyRating{
+		{Category: "hate", Severity: "safe"},
+		{Category: "violence", Severity: "medium", Blocked: true},
+	}
+	if len(response.SafetyRatings) != len(expected) {
+		t.Fatalf("Expected %d safety ratings, got %v", len(expected), response.SafetyRatings)
+	}
+	for i, rating := range expected {
+		if response.SafetyRatings[i] != rating {
+			t.Errorf("Expected safety rating %d to be %+v, got %+v", i, rating, response.SafetyRatings[i])
+		}
+	}
+}
+
 func TestAzureOpenAIVendor_ConvertResponse_EmptyChoices(t *testing.T) {
 	vendor := NewAzureOpenAI(nil)
 	azureResp := &azureResponse{
@@ -848,3 +879,55 @@ func TestAzureOpenAI_SendRequest_WithCustomHeaders(t *testing.T) {
 		t.Errorf("Expected 'Hello! How can I help you today?', got: %s", resp.Content)
 	}
 }
+
+func TestAzureOpenAIVendor_ConvertRequest_IgnoresParallelToolCalls(t *testing.T) {
+	vendor := NewAzureOpenAI(nil)
+	disabled := false
+	req := &models.Request{
+		Model:             "test-model",
+		Messages:          []models.Message{{Role: "user", Content: "Hello"}},
+		ParallelToolCalls: &disabled,
+	}
+
+	body, err := json.Marshal(vendor.convertRequest(req))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Contains(string(body), "parallel_tool_calls") {
+		t.Errorf("Expected parallel_tool_calls to be dropped, got %s", body)
+	}
+}
+
+func TestAzureOpenAI_SendRequest_ModelNameMap(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}`))
+	}))
+	defer server.Close()
+
+	vendor := NewAzureOpenAI(&models.VendorConfig{
+		APIKey:       "test-key",
+		BaseURL:      server.URL,
+		Timeout:      30 * time.Second,
+		ModelNameMap: map[string]string{"gpt-3.5-turbo": "gpt-35-turbo"},
+	})
+
+	response, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if gotPath != "/openai/deployments/gpt-35-turbo/chat/completions" {
+		t.Errorf("Expected deployment gpt-35-turbo, got path %s", gotPath)
+	}
+	// The response keeps the logical model name
+	if response.Model != "gpt-3.5-turbo" {
+		t.Errorf("Expected model gpt-3.5-turbo, got %s", response.Model)
+	}
+}
@@ -0,0 +1,466 @@
+package vendors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// VendorConfig.Headers keys holding Bedrock's AWS region and credentials.
+// They are used to sign requests and are never sent as headers.
+const (
+	BedrockRegionHeader       = "aws_region"
+	BedrockAccessKeyHeader    = "aws_access_key_id"
+	BedrockSecretKeyHeader    = "aws_secret_access_key"
+	BedrockSessionTokenHeader = "aws_session_token"
+)
+
+// bedrockAnthropicVersion is the Anthropic API version Bedrock expects in
+// the body of Claude requests
+const bedrockAnthropicVersion = "bedrock-2023-05-31"
+
+// bedrockDefaultMaxTokens is sent to Claude models, which require a token
+// limit, for requests that don't set one
+const bedrockDefaultMaxTokens = 1024
+
+// BedrockVendor implements the LLMVendor interface for AWS Bedrock. It
+// serves Anthropic Claude and Amazon Titan text models, signing requests
+// with AWS Signature Version 4 instead of sending an API key.
+type BedrockVendor struct {
+	config          *models.VendorConfig
+	client          *http.Client
+	streamingClient *http.Client
+}
+
+// NewBedrock creates a new Bedrock vendor. The region and credentials are
+// read from config.Headers under BedrockRegionHeader,
+// BedrockAccessKeyHeader, BedrockSecretKeyHeader and, for temporary
+// credentials, BedrockSessionTokenHeader.
+func NewBedrock(config *models.VendorConfig) *BedrockVendor {
+	if config == nil {
+		config = &models.VendorConfig{}
+	}
+
+	// Set default timeout if not provided
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	// Set default base URL for the region if not provided
+	if region := config.Headers[BedrockRegionHeader]; config.BaseURL == "" && region != "" {
+		config.BaseURL = "https://bedrock-runtime." + region + ".amazonaws.com"
+	}
+
+	// Create client with timeout for regular requests
+	client := &http.Client{
+		Timeout: config.Timeout,
+	}
+
+	// Create client without timeout for streaming requests
+	streamingClient := &http.Client{
+		// No timeout for streaming
+	}
+
+	return &BedrockVendor{
+		config:          config,
+		client:          client,
+		streamingClient: streamingClient,
+	}
+}
+
+// Name returns the vendor name
+func (b *BedrockVendor) Name() string {
+	return "bedrock"
+}
+
+// SendRequest sends a request to Bedrock's InvokeModel API
+func (b *BedrockVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if err := imagesNotSupported(b.Name(), req); err != nil {
+		return nil, err
+	}
+
+	reqBody, err := b.convertRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := b.newRequest(ctx, req.Model, "invoke", reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, newVendorError(b.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	response, err := b.convertResponse(req.Model, body)
+	if err != nil {
+		return nil, err
+	}
+	response.VendorHeaders = captureHeaders(b.config, resp.Header)
+	response.Raw = rawBody(req, body)
+	response.RequestBytes = int64(len(reqBody))
+	response.ResponseBytes = int64(len(body))
+	return response, nil
+}
+
+// SendStreamingRequest sends a request to Bedrock's
+// InvokeModelWithResponseStream API
+func (b *BedrockVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	// Tool calls aren't parsed from streams
+	if err := toolsNotSupported(b.Name()+" streaming", req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(b.Name(), req); err != nil {
+		return nil, err
+	}
+
+	// Create streaming response
+	streamingResp := newStreamingResponse(req, b.Name())
+
+	reqBody, err := b.convertRequest(req)
+	if err != nil {
+		streamingResp.Close()
+		return nil, err
+	}
+
+	// Create HTTP request without context for streaming
+	httpReq, err := b.newRequest(context.Background(), req.Model, "invoke-with-response-stream", reqBody)
+	if err != nil {
+		streamingResp.Close()
+		return nil, err
+	}
+
+	// Send request using streaming client (no timeout)
+	resp, err := b.streamingClient.Do(httpReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Check HTTP status code
+	if resp.StatusCode != http.StatusOK {
+		streamingResp.Close()
+		// Read error response body
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, newVendorError(b.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	extract := extractAnthropicDelta
+	if bedrockFamily(req.Model) == "titan" {
+		extract = extractTitanDelta
+	}
+
+	streamingResp.RequestBytes = int64(len(reqBody))
+
+	// Handle streaming response in goroutine
+	go func() {
+		defer resp.Body.Close()
+
+		parseEventStream(resp.Body, streamingResp, withBedrockMetrics(extract))
+	}()
+
+	return streamingResp, nil
+}
+
+// GetCapabilities returns Bedrock's capabilities
+func (b *BedrockVendor) GetCapabilities() models.Capabilities {
+	return models.Capabilities{
+		Models:            models.GetVendorModels("bedrock"),
+		SupportsStreaming: true,
+		MaxTokens:         4096,
+		MaxInputTokens:    200000,
+		Features:          models.GetVendorModelFeatures("bedrock"),
+	}
+}
+
+// IsAvailable checks that a region and credentials are configured
+func (b *BedrockVendor) IsAvailable(ctx context.Context) bool {
+	return b.config.Headers[BedrockRegionHeader] != "" &&
+		b.config.Headers[BedrockAccessKeyHeader] != "" &&
+		b.config.Headers[BedrockSecretKeyHeader] != ""
+}
+
+// TierModel returns the model configured for a capability tier
+func (b *BedrockVendor) TierModel(tier string) string {
+	return b.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (b *BedrockVendor) RateLimit() models.RateLimit {
+	return b.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (b *BedrockVendor) RetryableStatusCodes() []int {
+	return b.config.RetryableStatusCodes
+}
+
+// newRequest creates the signed request for the model's action
+func (b *BedrockVendor) newRequest(ctx context.Context, model, action string, body []byte) (*http.Request, error) {
+	// Model IDs such as "anthropic.claude-3-haiku-20240307-v1:0" must be
+	// escaped in the path
+	path := "/model/" + awsURIEncode(b.config.VendorModelName(model)) + "/" + action
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", b.config.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if action == "invoke-with-response-stream" {
+		httpReq.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	} else {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+
+	// Add custom headers, keeping the credentials out of the request
+	for key, value := range b.config.Headers {
+		switch key {
+		case BedrockRegionHeader, BedrockAccessKeyHeader, BedrockSecretKeyHeader, BedrockSessionTokenHeader:
+			continue
+		}
+		httpReq.Header.Set(key, value)
+	}
+
+	signV4(httpReq, body, awsCredentials{
+		accessKeyID:     b.config.Headers[BedrockAccessKeyHeader],
+		secretAccessKey: b.config.Headers[BedrockSecretKeyHeader],
+		sessionToken:    b.config.Headers[BedrockSessionTokenHeader],
+	}, b.config.Headers[BedrockRegionHeader], "bedrock", time.Now())
+	return httpReq, nil
+}
+
+// bedrockFamily returns the model family whose request format a Bedrock
+// model uses, "anthropic" or "titan", or "" for unsupported models.
+// Cross-region inference profiles such as "us.anthropic.claude-..." are
+// recognised too.
+func bedrockFamily(model string) string {
+	switch {
+	case strings.HasPrefix(model, "anthropic.") || strings.Contains(model, ".anthropic."):
+		return "anthropic"
+	case strings.HasPrefix(model, "amazon.titan-text") || strings.Contains(model, ".amazon.titan-text"):
+		return "titan"
+	default:
+		return ""
+	}
+}
+
+// convertRequest converts our standard request to the body format of the
+// requested model's family
+func (b *BedrockVendor) convertRequest(req *models.Request) ([]byte, error) {
+	var bedrockReq interface{}
+	switch bedrockFamily(req.Model) {
+	case "anthropic":
+		// Claude takes a single system prompt outside the messages
+		system, rest := models.JoinSystemMessages(req.Messages, models.DefaultSystemMessageSeparator)
+
+		maxTokens := req.MaxTokens
+		if maxTokens == 0 {
+			maxTokens = bedrockDefaultMaxTokens
+		}
+		bedrockReq = bedrockAnthropicRequest{
+			AnthropicVersion: bedrockAnthropicVersion,
+			System:           system,
+			Messages:         anthropicMessages(rest),
+			MaxTokens:        maxTokens,
+			Temperature:      req.Temperature,
+			TopP:             req.TopP,
+			StopSequences:    req.Stop,
+			Tools:            anthropicTools(req.Tools),
+			ToolChoice:       anthropicToolChoiceFor(req.ToolChoice),
+		}
+	case "titan":
+		if err := toolsNotSupported(req.Model, req); err != nil {
+			return nil, err
+		}
+		bedrockReq = titanRequest{
+			InputText: titanPrompt(req.Messages),
+			TextGenerationConfig: titanGenerationConfig{
+				MaxTokenCount: req.MaxTokens,
+				Temperature:   req.Temperature,
+				TopP:          req.TopP,
+				StopSequences: req.Stop,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported Bedrock model %s", models.ErrInvalidRequest, req.Model)
+	}
+
+	reqBody, err := json.Marshal(bedrockReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return reqBody, nil
+}
+
+// titanPrompt renders a conversation as the single prompt Titan takes, in
+// its "User:"/"Bot:" turn format, ending with the bot's turn
+func titanPrompt(messages []models.Message) string {
+	var prompt strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			prompt.WriteString(msg.Text())
+		case "assistant":
+			prompt.WriteString("Bot: " + msg.Text())
+		default:
+			prompt.WriteString("User: " + msg.Text())
+		}
+		prompt.WriteString("\n")
+	}
+	prompt.WriteString("Bot:")
+	return prompt.String()
+}
+
+// convertResponse converts the response body of the requested model's
+// family to our standard format
+func (b *BedrockVendor) convertResponse(model string, body []byte) (*models.Response, error) {
+	response := &models.Response{
+		Model:     model,
+		Vendor:    b.Name(),
+		CreatedAt: time.Now(),
+	}
+
+	if bedrockFamily(model) == "titan" {
+		var titanResp titanResponse
+		if err := json.Unmarshal(body, &titanResp); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		if len(titanResp.Results) == 0 {
+			return nil, fmt.Errorf("no results in response")
+		}
+
+		result := titanResp.Results[0]
+		response.Content = result.OutputText
+		response.FinishReason = titanFinishReason(result.CompletionReason)
+		response.Usage = models.Usage{
+			PromptTokens:     titanResp.InputTextTokenCount,
+			CompletionTokens: result.TokenCount,
+			TotalTokens:      titanResp.InputTextTokenCount + result.TokenCount,
+		}
+		return response, nil
+	}
+
+	var anthropicResp anthropicResponse
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	response.Content, response.ToolCalls = anthropicContentOf(anthropicResp.Content)
+	response.ReasoningContent = anthropicThinking(anthropicResp.Content)
+	response.FinishReason = anthropicFinishReason(anthropicResp.StopReason)
+	response.Usage = models.Usage{
+		PromptTokens:     anthropicResp.Usage.InputTokens,
+		CompletionTokens: anthropicResp.Usage.OutputTokens,
+		TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
+	}
+	return response, nil
+}
+
+// titanFinishReason maps Titan's completion reasons onto the OpenAI-style
+// values the rest of the dispatcher expects
+func titanFinishReason(reason string) string {
+	switch reason {
+	case "FINISH":
+		return "stop"
+	case "LENGTH":
+		return "length"
+	case "CONTENT_FILTERED":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// extractTitanDelta returns the text of a Titan stream chunk
+func extractTitanDelta(data []byte) (streamEvent, error) {
+	var chunk struct {
+		OutputText string `json:"outputText"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return streamEvent{}, err
+	}
+	return streamEvent{content: chunk.OutputText}, nil
+}
+
+// withBedrockMetrics wraps a chunk extractor to also take the stream's
+// usage from the invocation metrics Bedrock adds to the final chunk
+func withBedrockMetrics(extract func(data []byte) (streamEvent, error)) func(data []byte) (streamEvent, error) {
+	return func(data []byte) (streamEvent, error) {
+		event, err := extract(data)
+		if err != nil {
+			return streamEvent{}, err
+		}
+
+		var chunk struct {
+			Metrics *struct {
+				InputTokenCount  int `json:"inputTokenCount"`
+				OutputTokenCount int `json:"outputTokenCount"`
+			} `json:"amazon-bedrock-invocationMetrics"`
+		}
+		if err := json.Unmarshal(data, &chunk); err == nil && chunk.Metrics != nil {
+			event.usage = &models.Usage{
+				PromptTokens:     chunk.Metrics.InputTokenCount,
+				CompletionTokens: chunk.Metrics.OutputTokenCount,
+				TotalTokens:      chunk.Metrics.InputTokenCount + chunk.Metrics.OutputTokenCount,
+			}
+		}
+		return event, nil
+	}
+}
+
+// Bedrock request/response structures. Claude responses share Anthropic's
+// format.
+type bedrockAnthropicRequest struct {
+	AnthropicVersion string               `json:"anthropic_version"`
+	System           string               `json:"system,omitempty"`
+	Messages         []anthropicMessage   `json:"messages"`
+	MaxTokens        int                  `json:"max_tokens"`
+	Temperature      float64              `json:"temperature,omitempty"`
+	TopP             float64              `json:"top_p,omitempty"`
+	StopSequences    []string             `json:"stop_sequences,omitempty"`
+	Tools            []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice       *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type titanRequest struct {
+	InputText            string                `json:"inputText"`
+	TextGenerationConfig titanGenerationConfig `json:"textGenerationConfig"`
+}
+
+type titanGenerationConfig struct {
+	MaxTokenCount int      `json:"maxTokenCount,omitempty"`
+	Temperature   float64  `json:"temperature,omitempty"`
+	TopP          float64  `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type titanResponse struct {
+	InputTextTokenCount int `json:"inputTextTokenCount"`
+	Results             []struct {
+		TokenCount       int    `json:"tokenCount"`
+		OutputText       string `json:"outputText"`
+		CompletionReason string `json:"completionReason"`
+	} `json:"results"`
+}
@@ -0,0 +1,305 @@
+package vendors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// eventStreamFrame encodes an AWS event stream message with string headers
+func eventStreamFrame(headers map[string]string, payload []byte) []byte {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var encodedHeaders bytes.Buffer
+	for _, name := range names {
+		encodedHeaders.WriteByte(byte(len(name)))
+		encodedHeaders.WriteString(name)
+		encodedHeaders.WriteByte(7)
+		binary.Write(&encodedHeaders, binary.BigEndian, uint16(len(headers[name])))
+		encodedHeaders.WriteString(headers[name])
+	}
+
+	var frame bytes.Buffer
+	binary.Write(&frame, binary.BigEndian, uint32(16+encodedHeaders.Len()+len(payload)))
+	binary.Write(&frame, binary.BigEndian, uint32(encodedHeaders.Len()))
+	binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	frame.Write(encodedHeaders.Bytes())
+	frame.Write(payload)
+	binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	return frame.Bytes()
+}
+
+// bedrockChunk encodes a model event as a Bedrock chunk message
+func bedrockChunk(event string) []byte {
+	payload, _ := json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString([]byte(event))})
+	return eventStreamFrame(map[string]string{
+		":message-type": "event",
+		":event-type":   "chunk",
+		":content-type": "application/json",
+	}, payload)
+}
+
+func newTestBedrock(baseURL string) *BedrockVendor {
+	return NewBedrock(&models.VendorConfig{
+		BaseURL: baseURL,
+		Headers: map[string]string{
+			BedrockRegionHeader:    "us-east-1",
+			BedrockAccessKeyHeader: "AKIDEXAMPLE",
+			BedrockSecretKeyHeader: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			"X-Custom":             "custom",
+		},
+	})
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signV4(req, nil, awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("Expected Authorization %q, got %q", expected, got)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("Expected X-Amz-Date 20150830T123600Z, got %s", got)
+	}
+}
+
+func TestBedrock_IsAvailable(t *testing.T) {
+	vendor := newTestBedrock("")
+	if vendor.Name() != "bedrock" {
+		t.Errorf("Expected name bedrock, got %s", vendor.Name())
+	}
+	if vendor.config.BaseURL != "https://bedrock-runtime.us-east-1.amazonaws.com" {
+		t.Errorf("Expected the regional base URL, got %s", vendor.config.BaseURL)
+	}
+	if !vendor.IsAvailable(context.Background()) {
+		t.Error("Expected vendor with region and credentials to be available")
+	}
+	if NewBedrock(&models.VendorConfig{Headers: map[string]string{BedrockRegionHeader: "us-east-1"}}).IsAvailable(context.Background()) {
+		t.Error("Expected vendor without credentials to be unavailable")
+	}
+}
+
+func TestBedrock_SendRequest_Claude(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke" {
+			t.Errorf("Expected the escaped invoke path, got %s", r.URL.EscapedPath())
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/us-east-1/bedrock/aws4_request") {
+			t.Errorf("Expected a SigV4 Authorization header, got %s", auth)
+		}
+		if r.Header.Get("X-Amz-Date") == "" {
+			t.Error("Expected an X-Amz-Date header")
+		}
+		if r.Header.Get("X-Custom") != "custom" {
+			t.Error("Expected custom headers to be sent")
+		}
+		if r.Header.Get(BedrockSecretKeyHeader) != "" || r.Header.Get(BedrockAccessKeyHeader) != "" {
+			t.Error("Expected credentials not to be sent as headers")
+		}
+
+		var req bedrockAnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.AnthropicVersion != bedrockAnthropicVersion || req.System != "Be brief." || len(req.Messages) != 1 {
+			t.Errorf("Expected a Claude request with a separate system prompt, got %+v", req)
+		}
+		if req.MaxTokens != bedrockDefaultMaxTokens {
+			t.Errorf("Expected default max tokens %d, got %d", bedrockDefaultMaxTokens, req.MaxTokens)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"type": "message",
+			"role": "assistant",
+			"content": [{"type": "text", "text": "Hi there"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 3}
+		}`))
+	}))
+	defer server.Close()
+
+	response, err := newTestBedrock(server.URL).SendRequest(context.Background(), &models.Request{
+		Model: "anthropic.claude-3-haiku-20240307-v1:0",
+		Messages: []models.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Hello"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+
+	if response.Content != "Hi there" || response.Vendor != "bedrock" || response.FinishReason != "stop" {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+	if response.Usage.TotalTokens != 15 {
+		t.Errorf("Expected 15 total tokens, got %d", response.Usage.TotalTokens)
+	}
+}
+
+func TestBedrock_SendRequest_Titan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req titanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.InputText != "User: Hello\nBot:" {
+			t.Errorf("Expected a Titan prompt, got %q", req.InputText)
+		}
+		if req.TextGenerationConfig.MaxTokenCount != 50 {
+			t.Errorf("Expected maxTokenCount 50, got %d", req.TextGenerationConfig.MaxTokenCount)
+		}
+
+		w.Write([]byte(`{"inputTextTokenCount": 4, "results": [{"tokenCount": 2, "outputText": "Hi!", "completionReason": "LENGTH"}]}`))
+	}))
+	defer server.Close()
+
+	response, err := newTestBedrock(server.URL).SendRequest(context.Background(), &models.Request{
+		Model:     "amazon.titan-text-express-v1",
+		Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+		MaxTokens: 50,
+	})
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+
+	if response.Content != "Hi!" || response.FinishReason != "length" || response.Usage.TotalTokens != 6 {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+}
+
+func TestBedrock_SendRequest_UnsupportedModel(t *testing.T) {
+	_, err := newTestBedrock("http://127.0.0.1:0").SendRequest(context.Background(), &models.Request{
+		Model:    "meta.llama3-70b-instruct-v1:0",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if !errors.Is(err, models.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestBedrock_SendStreamingRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/invoke-with-response-stream") {
+			t.Errorf("Expected the streaming action, got %s", r.URL.Path)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		events := []string{
+			`{"type":"message_start","message":{"usage":{"input_tokens":10}}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+			`{"type":"message_stop","amazon-bedrock-invocationMetrics":{"inputTokenCount":10,"outputTokenCount":2}}`,
+		}
+		for _, event := range events {
+			w.Write(bedrockChunk(event))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	streamingResp, err := newTestBedrock(server.URL).SendStreamingRequest(context.Background(), &models.Request{
+		Model:    "anthropic.claude-3-haiku-20240307-v1:0",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("SendStreamingRequest failed: %v", err)
+	}
+	defer streamingResp.Close()
+
+	var content string
+	done := false
+	for !done {
+		select {
+		case chunk := <-streamingResp.ContentChan:
+			content += chunk
+		case done = <-streamingResp.DoneChan:
+		case err := <-streamingResp.ErrorChan:
+			t.Fatalf("Streaming error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for streaming response")
+		}
+	}
+	// Content sent before done may still be buffered
+	for len(streamingResp.ContentChan) > 0 {
+		content += <-streamingResp.ContentChan
+	}
+
+	if content != "Hello world" {
+		t.Errorf("Expected content 'Hello world', got '%s'", content)
+	}
+	if streamingResp.Usage.TotalTokens != 12 {
+		t.Errorf("Expected 12 total tokens from the invocation metrics, got %d", streamingResp.Usage.TotalTokens)
+	}
+}
+
+func TestParseEventStream_Errors(t *testing.T) {
+	corrupted := bedrockChunk(`{"outputText":"Hi"}`)
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	exception := eventStreamFrame(map[string]string{
+		":message-type":   "exception",
+		":exception-type": "throttlingException",
+	}, []byte(`{"message":"Too many requests"}`))
+
+	truncated := bedrockChunk(`{"outputText":"Hi"}`)
+	truncated = truncated[:len(truncated)-5]
+
+	tests := []struct {
+		name            string
+		body            []byte
+		wantMessage     string
+		wantInterrupted bool
+	}{
+		{name: "checksum mismatch", body: corrupted, wantMessage: "checksum mismatch"},
+		{name: "exception", body: exception, wantMessage: "throttlingException: Too many requests"},
+		{name: "truncated message", body: truncated, wantInterrupted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamingResp := models.NewStreamingResponse("amazon.titan-text-express-v1", "bedrock")
+			go parseEventStream(bytes.NewReader(tt.body), streamingResp, extractTitanDelta)
+
+			select {
+			case err := <-streamingResp.ErrorChan:
+				if tt.wantMessage != "" && !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantMessage, err)
+				}
+				if errors.Is(err, models.ErrStreamInterrupted) != tt.wantInterrupted {
+					t.Errorf("Expected interrupted %v, got %v", tt.wantInterrupted, err)
+				}
+			case <-streamingResp.DoneChan:
+				t.Fatal("Expected an error, got done")
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout waiting for the stream to end")
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package vendors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// CohereVendor implements the LLMVendor interface for Cohere's v2 chat API
+type CohereVendor struct {
+	config          *models.VendorConfig
+	client          *http.Client
+	streamingClient *http.Client
+}
+
+// NewCohere creates a new Cohere vendor
+func NewCohere(config *models.VendorConfig) *CohereVendor {
+	if config == nil {
+		config = &models.VendorConfig{}
+	}
+
+	// Set default timeout if not provided
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	// Set default base URL if not provided
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.cohere.com"
+	}
+
+	// Create client with timeout for regular requests
+	client := &http.Client{
+		Timeout: config.Timeout,
+	}
+
+	// Create client without timeout for streaming requests
+	streamingClient := &http.Client{
+		// No timeout for streaming
+	}
+
+	return &CohereVendor{
+		config:          config,
+		client:          client,
+		streamingClient: streamingClient,
+	}
+}
+
+// Name returns the vendor name
+func (c *CohereVendor) Name() string {
+	return "cohere"
+}
+
+// SendRequest sends a request to Cohere
+func (c *CohereVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if err := toolsNotSupported(c.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(c.Name(), req); err != nil {
+		return nil, err
+	}
+
+	// Marshal request
+	reqBody, err := json.Marshal(c.convertRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v2/chat", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(httpReq)
+
+	// Send request
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, newVendorError(c.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	// Parse response
+	var cohereResp cohereResponse
+	if err := json.Unmarshal(body, &cohereResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	response := c.convertResponse(&cohereResp, req.Model)
+	response.VendorHeaders = captureHeaders(c.config, resp.Header)
+	response.Raw = rawBody(req, body)
+	response.RequestBytes = int64(len(reqBody))
+	response.ResponseBytes = int64(len(body))
+	return response, nil
+}
+
+// GetCapabilities returns Cohere's capabilities
+func (c *CohereVendor) GetCapabilities() models.Capabilities {
+	return models.Capabilities{
+		Models:            models.GetVendorModels("cohere"),
+		SupportsStreaming: true,
+		MaxTokens:         4000,
+		MaxInputTokens:    128000,
+		MaxStopSequences:  5,
+		Features:          models.GetVendorModelFeatures("cohere"),
+	}
+}
+
+// IsAvailable checks if Cohere is available
+func (c *CohereVendor) IsAvailable(ctx context.Context) bool {
+	return c.config.APIKey != ""
+}
+
+// TierModel returns the model configured for a capability tier
+func (c *CohereVendor) TierModel(tier string) string {
+	return c.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (c *CohereVendor) RateLimit() models.RateLimit {
+	return c.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (c *CohereVendor) RetryableStatusCodes() []int {
+	return c.config.RetryableStatusCodes
+}
+
+// SendStreamingRequest sends a streaming request to Cohere
+func (c *CohereVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	if err := toolsNotSupported(c.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(c.Name(), req); err != nil {
+		return nil, err
+	}
+
+	// Create streaming response
+	streamingResp := newStreamingResponse(req, c.Name())
+
+	// Convert to Cohere format with streaming enabled
+	cohereReq := c.convertRequest(req)
+	cohereReq.Stream = true
+
+	// Marshal request
+	reqBody, err := json.Marshal(cohereReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v2/chat", bytes.NewBuffer(reqBody))
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(httpReq)
+
+	// Send request using streaming client (no timeout)
+	resp, err := c.streamingClient.Do(httpReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Check HTTP status code
+	if resp.StatusCode != http.StatusOK {
+		streamingResp.Close()
+		// Read error response body
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, newVendorError(c.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	streamingResp.RequestBytes = int64(len(reqBody))
+
+	// Handle streaming response in goroutine
+	go func() {
+		defer resp.Body.Close()
+
+		parseCohereStream(resp.Body, streamingResp)
+	}()
+
+	return streamingResp, nil
+}
+
+// convertRequest converts our standard request to Cohere format
+func (c *CohereVendor) convertRequest(req *models.Request) cohereRequest {
+	messages := make([]cohereMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = cohereMessage{Role: msg.Role, Content: msg.Text()}
+	}
+
+	return cohereRequest{
+		Model:         c.config.VendorModelName(req.Model),
+		Messages:      messages,
+		Temperature:   req.Temperature,
+		MaxTokens:     req.MaxTokens,
+		P:             req.TopP,
+		StopSequences: req.Stop,
+		Stream:        req.Stream,
+	}
+}
+
+// convertResponse converts a Cohere response to our standard format
+func (c *CohereVendor) convertResponse(cohereResp *cohereResponse, model string) *models.Response {
+	var content strings.Builder
+	for _, part := range cohereResp.Message.Content {
+		if part.Type == "text" {
+			content.WriteString(part.Text)
+		}
+	}
+
+	return &models.Response{
+		Content:      content.String(),
+		Model:        model,
+		Vendor:       c.Name(),
+		FinishReason: cohereFinishReason(cohereResp.FinishReason),
+		Usage:        cohereResp.Usage.toUsage(),
+		CreatedAt:    time.Now(),
+	}
+}
+
+// setHeaders sets the authentication and custom headers
+func (c *CohereVendor) setHeaders(httpReq *http.Request) {
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+
+	// Add custom headers
+	for key, value := range c.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
+
+// cohereFinishReason maps Cohere's finish reasons onto the OpenAI-style
+// values the rest of the dispatcher expects
+func cohereFinishReason(reason string) string {
+	switch reason {
+	case "COMPLETE", "STOP_SEQUENCE":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "TOOL_CALL":
+		return "tool_calls"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// Cohere API request/response structures
+type cohereRequest struct {
+	Model         string          `json:"model"`
+	Messages      []cohereMessage `json:"messages"`
+	Temperature   float64         `json:"temperature,omitempty"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	P             float64         `json:"p,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+}
+
+type cohereMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type cohereResponse struct {
+	ID           string `json:"id"`
+	FinishReason string `json:"finish_reason"`
+	Message      struct {
+		Role    string `json:"role"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"message"`
+	Usage cohereUsage `json:"usage"`
+}
+
+// cohereUsage reports both the tokens the model processed and the units
+// billed for them, which differ when Cohere adds its own prompt tokens
+type cohereUsage struct {
+	BilledUnits cohereTokens `json:"billed_units"`
+	Tokens      cohereTokens `json:"tokens"`
+}
+
+type cohereTokens struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// toUsage converts to models.Usage, preferring the processed token counts
+// and falling back to the billed units when those are absent
+func (u cohereUsage) toUsage() models.Usage {
+	tokens := u.Tokens
+	if tokens.InputTokens == 0 && tokens.OutputTokens == 0 {
+		tokens = u.BilledUnits
+	}
+	return models.Usage{
+		PromptTokens:     tokens.InputTokens,
+		CompletionTokens: tokens.OutputTokens,
+		TotalTokens:      tokens.InputTokens + tokens.OutputTokens,
+	}
+}
@@ -0,0 +1,194 @@
+package vendors
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+func TestNewCohere(t *testing.T) {
+	vendor := NewCohere(nil)
+	if vendor == nil {
+		t.Fatal("NewCohere() returned nil")
+	}
+	if vendor.config.BaseURL != "https://api.cohere.com" {
+		t.Errorf("Expected default base URL, got %s", vendor.config.BaseURL)
+	}
+	if vendor.config.Timeout != 30*time.Second {
+		t.Errorf("Expected default timeout 30s, got %v", vendor.config.Timeout)
+	}
+	if vendor.Name() != "cohere" {
+		t.Errorf("Expected name cohere, got %s", vendor.Name())
+	}
+}
+
+func TestCohere_GetCapabilities(t *testing.T) {
+	capabilities := NewCohere(&models.VendorConfig{APIKey: "test-key"}).GetCapabilities()
+
+	if !capabilities.SupportsStreaming {
+		t.Error("Expected Cohere to support streaming")
+	}
+	expected := []string{"command-r-plus", "command-r", "command"}
+	if !reflect.DeepEqual(capabilities.Models, expected) {
+		t.Errorf("Expected models %v, got %v", expected, capabilities.Models)
+	}
+}
+
+func TestCohere_IsAvailable(t *testing.T) {
+	if NewCohere(&models.VendorConfig{}).IsAvailable(context.Background()) {
+		t.Error("Expected vendor without API key to be unavailable")
+	}
+	if !NewCohere(&models.VendorConfig{APIKey: "test-key"}).IsAvailable(context.Background()) {
+		t.Error("Expected vendor with API key to be available")
+	}
+}
+
+func TestCohere_SendRequest_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/chat" {
+			t.Errorf("Expected path /v2/chat, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Expected Authorization Bearer test-key, got %s", r.Header.Get("Authorization"))
+		}
+
+		var req cohereRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		expected := []cohereMessage{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Hello"},
+		}
+		if !reflect.DeepEqual(req.Messages, expected) {
+			t.Errorf("Expected messages %v, got %v", expected, req.Messages)
+		}
+		if req.P != 0.9 || !reflect.DeepEqual(req.StopSequences, []string{"END"}) {
+			t.Errorf("Expected p 0.9 and stop sequences [END], got %v and %v", req.P, req.StopSequences)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "test-id",
+			"finish_reason": "COMPLETE",
+			"message": {"role": "assistant", "content": [{"type": "text", "text": "Hi there"}]},
+			"usage": {"billed_units": {"input_tokens": 5, "output_tokens": 3}, "tokens": {"input_tokens": 71, "output_tokens": 3}}
+		}`))
+	}))
+	defer server.Close()
+
+	vendor := NewCohere(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	response, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model: "command-r",
+		Messages: []models.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Hello"},
+		},
+		TopP: 0.9,
+		Stop: []string{"END"},
+	})
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+
+	if response.Content != "Hi there" {
+		t.Errorf("Expected content 'Hi there', got '%s'", response.Content)
+	}
+	if response.Vendor != "cohere" {
+		t.Errorf("Expected vendor cohere, got %s", response.Vendor)
+	}
+	if response.FinishReason != "stop" {
+		t.Errorf("Expected finish reason stop, got %s", response.FinishReason)
+	}
+	expectedUsage := models.Usage{PromptTokens: 71, CompletionTokens: 3, TotalTokens: 74}
+	if response.Usage != expectedUsage {
+		t.Errorf("Expected usage %+v, got %+v", expectedUsage, response.Usage)
+	}
+}
+
+func TestCohere_SendRequest_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "invalid api token"}`))
+	}))
+	defer server.Close()
+
+	vendor := NewCohere(&models.VendorConfig{APIKey: "bad-key", BaseURL: server.URL})
+	_, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "command-r",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "HTTP error 401") {
+		t.Errorf("Expected HTTP error 401, got %v", err)
+	}
+}
+
+func TestCohere_SendStreamingRequest_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req cohereRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if !req.Stream {
+			t.Error("Expected stream to be enabled")
+		}
+
+		w.WriteHeader(http.StatusOK)
+		streamData := []string{
+			"event: message-start\ndata: {\"type\":\"message-start\",\"delta\":{\"message\":{\"role\":\"assistant\"}}}\n\n",
+			"event: content-delta\ndata: {\"type\":\"content-delta\",\"index\":0,\"delta\":{\"message\":{\"content\":{\"text\":\"Hello\"}}}}\n\n",
+			"event: content-delta\ndata: {\"type\":\"content-delta\",\"index\":0,\"delta\":{\"message\":{\"content\":{\"text\":\" world\"}}}}\n\n",
+			"event: message-end\ndata: {\"type\":\"message-end\",\"delta\":{\"finish_reason\":\"COMPLETE\",\"usage\":{\"tokens\":{\"input_tokens\":4,\"output_tokens\":2}}}}\n\n",
+		}
+		for _, data := range streamData {
+			w.Write([]byte(data))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	vendor := NewCohere(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	streamingResp, err := vendor.SendStreamingRequest(context.Background(), &models.Request{
+		Model:    "command-r",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("SendStreamingRequest failed: %v", err)
+	}
+	defer streamingResp.Close()
+
+	var content string
+	done := false
+	for !done {
+		select {
+		case chunk := <-streamingResp.ContentChan:
+			content += chunk
+		case done = <-streamingResp.DoneChan:
+		case err := <-streamingResp.ErrorChan:
+			t.Fatalf("Streaming error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for streaming response")
+		}
+	}
+	// Content sent before done may still be buffered
+	for len(streamingResp.ContentChan) > 0 {
+		content += <-streamingResp.ContentChan
+	}
+
+	if content != "Hello world" {
+		t.Errorf("Expected content 'Hello world', got '%s'", content)
+	}
+	if streamingResp.Usage.TotalTokens != 6 {
+		t.Errorf("Expected 6 total tokens from message-end, got %d", streamingResp.Usage.TotalTokens)
+	}
+}
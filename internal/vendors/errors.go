@@ -0,0 +1,169 @@
+package vendors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// newVendorError builds the typed error for a non-OK vendor response.
+// Oversized requests, whether rejected with HTTP 413 or a
+// context_length_exceeded code, become a PayloadTooLargeError. The
+// response's Retry-After header, if any, is kept in the error.
+func newVendorError(vendor string, statusCode int, header http.Header, body []byte) error {
+	message, code := parseErrorEnvelope(body)
+	if statusCode == http.StatusRequestEntityTooLarge || code == "context_length_exceeded" {
+		return &models.PayloadTooLargeError{Vendor: vendor, Message: message}
+	}
+	return &models.VendorError{
+		Vendor:     vendor,
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    message,
+		RetryAfter: parseRetryAfter(header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter returns the wait a Retry-After header value asks for,
+// given either as a number of seconds or as an HTTP date. It returns zero
+// for a missing or malformed value, or a date that has passed.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// errorEnvelope covers the shapes vendors wrap error responses in:
+//
+//	{"error": {"message": "...", "type": "...", "code": "..."}}  OpenAI, Anthropic, Azure
+//	{"error": {"message": "...", "code": 400, "status": "..."}}   Google
+//	{"error": "..."}                                              Together, Ollama
+//	{"message": "...", "code": "..."}                             proxies and gateways
+type errorEnvelope struct {
+	Error   json.RawMessage `json:"error"`
+	Message string          `json:"message"`
+	Code    json.RawMessage `json:"code"`
+	Type    string          `json:"type"`
+	Status  string          `json:"status"`
+}
+
+// parseErrorEnvelope extracts a human-readable message and an error code
+// from a vendor error body. Google may send the envelope inside a list.
+// A body in no known shape, such as plain text or an HTML error page, is
+// returned trimmed as the message.
+func parseErrorEnvelope(body []byte) (message, code string) {
+	text := strings.TrimSpace(string(body))
+	raw := []byte(text)
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil && len(list) > 0 {
+		raw = list[0]
+	}
+
+	var envelope errorEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return text, ""
+	}
+
+	var nested string
+	var inner errorEnvelope
+	if err := json.Unmarshal(envelope.Error, &nested); err == nil && nested != "" {
+		envelope.Message = nested
+	} else if err := json.Unmarshal(envelope.Error, &inner); err == nil && inner.Message != "" {
+		envelope = inner
+	}
+
+	message = strings.TrimSpace(envelope.Message)
+	if message == "" {
+		return text, ""
+	}
+	return message, envelope.code()
+}
+
+// code returns the most specific code the envelope carries, preferring a
+// string code over a status or type, and those over a numeric code
+func (e errorEnvelope) code() string {
+	var code string
+	if err := json.Unmarshal(e.Code, &code); err == nil && code != "" {
+		return code
+	}
+	if e.Status != "" {
+		return e.Status
+	}
+	if e.Type != "" {
+		return e.Type
+	}
+	var number json.Number
+	if err := json.Unmarshal(e.Code, &number); err == nil {
+		return number.String()
+	}
+	return ""
+}
+
+// captureHeaders returns the configured response headers that are present,
+// keyed by lower-case name, or nil when there are none
+func captureHeaders(config *models.VendorConfig, header http.Header) map[string]string {
+	names := config.CaptureHeaders
+	if names == nil {
+		names = models.DefaultCaptureHeaders
+	}
+
+	var captured map[string]string
+	for _, name := range names {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if captured == nil {
+			captured = make(map[string]string)
+		}
+		captured[strings.ToLower(name)] = value
+	}
+	return captured
+}
+
+// rawBody returns a response body for Response.Raw when the request asked
+// for it and the body is valid JSON
+func rawBody(req *models.Request, body []byte) json.RawMessage {
+	if !req.IncludeRawResponse || !json.Valid(body) {
+		return nil
+	}
+	return json.RawMessage(body)
+}
+
+// toolsNotSupported returns an error for a request that declares tools, or
+// continues a conversation with tool calls, when it is sent to a vendor
+// that can't call tools. vendor names the vendor in the error.
+func toolsNotSupported(vendor string, req *models.Request) error {
+	if len(req.Tools) > 0 {
+		return fmt.Errorf("%w: %s does not support tools", models.ErrFeatureNotSupported, vendor)
+	}
+	for _, msg := range req.Messages {
+		if msg.Role == "tool" || len(msg.ToolCalls) > 0 {
+			return fmt.Errorf("%w: %s does not support tool messages", models.ErrFeatureNotSupported, vendor)
+		}
+	}
+	return nil
+}
+
+// imagesNotSupported returns an error for a request with image parts sent
+// to a vendor that can't take images. vendor names the vendor in the error.
+func imagesNotSupported(vendor string, req *models.Request) error {
+	if req.RequiredFeatures().Vision {
+		return fmt.Errorf("%w: %s does not support image inputs", models.ErrFeatureNotSupported, vendor)
+	}
+	return nil
+}
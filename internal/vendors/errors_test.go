@@ -0,0 +1,245 @@
+package vendors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+func TestParseErrorEnvelope(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedMessage string
+		expectedCode    string
+	}{
+		{
+			name:            "openai nested error",
+			body:            `{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			expectedMessage: "Rate limit reached",
+			expectedCode:    "rate_limit_exceeded",
+		},
+		{
+			name:            "anthropic typed error",
+			body:            `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+			expectedMessage: "Overloaded",
+			expectedCode:    "overloaded_error",
+		},
+		{
+			name:            "google status",
+			body:            `{"error": {"code": 400, "message": "API key not valid.", "status": "INVALID_ARGUMENT"}}`,
+			expectedMessage: "API key not valid.",
+			expectedCode:    "INVALID_ARGUMENT",
+		},
+		{
+			name:            "google list",
+			body:            `[{"error": {"code": 429, "message": "Quota exceeded", "status": "RESOURCE_EXHAUSTED"}}]`,
+			expectedMessage: "Quota exceeded",
+			expectedCode:    "RESOURCE_EXHAUSTED",
+		},
+		{
+			name:            "numeric code only",
+			body:            `{"error": {"message": "Insufficient credits", "code": 402}}`,
+			expectedMessage: "Insufficient credits",
+			expectedCode:    "402",
+		},
+		{
+			name:            "string error",
+			body:            `{"error": "model 'llama3' not found"}`,
+			expectedMessage: "model 'llama3' not found",
+		},
+		{
+			name:            "top-level message",
+			body:            `{"message": "Invalid API key", "code": "invalid_api_key"}`,
+			expectedMessage: "Invalid API key",
+			expectedCode:    "invalid_api_key",
+		},
+		{
+			name:            "null error with message",
+			body:            `{"error": null, "message": "Upstream timeout"}`,
+			expectedMessage: "Upstream timeout",
+		},
+		{
+			name:            "plain text",
+			body:            "  Bad Gateway\n",
+			expectedMessage: "Bad Gateway",
+		},
+		{
+			name:            "json without message",
+			body:            `{"detail": "unexpected"}`,
+			expectedMessage: `{"detail": "unexpected"}`,
+		},
+		{
+			name: "empty body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, code := parseErrorEnvelope([]byte(tt.body))
+			if message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, message)
+			}
+			if code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestNewVendorError(t *testing.T) {
+	err := newVendorError("openai", http.StatusTooManyRequests, nil, []byte(`{"error": {"message": "Slow down", "code": "rate_limit_exceeded"}}`))
+	var vendorErr *models.VendorError
+	if !errors.As(err, &vendorErr) {
+		t.Fatalf("Expected VendorError, got %T", err)
+	}
+	if err.Error() != "openai: HTTP error 429: Slow down (rate_limit_exceeded)" {
+		t.Errorf("Expected clean error message, got %q", err.Error())
+	}
+	if !errors.Is(err, models.ErrRateLimitExceeded) {
+		t.Error("Expected HTTP 429 to match ErrRateLimitExceeded")
+	}
+
+	err = newVendorError("openai", http.StatusBadRequest, nil, []byte(`{"error": {"message": "Too long", "code": "context_length_exceeded"}}`))
+	if !errors.Is(err, models.ErrPayloadTooLarge) {
+		t.Errorf("Expected ErrPayloadTooLarge for context_length_exceeded, got %v", err)
+	}
+
+	err = newVendorError("anthropic", http.StatusRequestEntityTooLarge, nil, []byte("request entity too large"))
+	if !errors.Is(err, models.ErrPayloadTooLarge) {
+		t.Errorf("Expected ErrPayloadTooLarge for HTTP 413, got %v", err)
+	}
+}
+
+func TestToolsNotSupported(t *testing.T) {
+	tools := []models.Tool{{Name: "get_weather"}}
+	tests := []struct {
+		name    string
+		req     *models.Request
+		wantErr bool
+	}{
+		{"no tools", &models.Request{Messages: []models.Message{{Role: "user", Content: "Hi"}}}, false},
+		{"tools", &models.Request{Tools: tools, Messages: []models.Message{{Role: "user", Content: "Hi"}}}, true},
+		{"tool result", &models.Request{Messages: []models.Message{{Role: "tool", ToolCallID: "call_1", Content: "18C"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := toolsNotSupported("google", tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, models.ErrFeatureNotSupported) {
+				t.Errorf("Expected ErrFeatureNotSupported, got %v", err)
+			}
+		})
+	}
+
+	// Vendors without tool support fail before sending anything
+	vendor := NewGoogle(&models.VendorConfig{APIKey: "test-key", BaseURL: "http://127.0.0.1:0"})
+	_, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "gemini-1.5-pro",
+		Messages: []models.Message{{Role: "user", Content: "Hi"}},
+		Tools:    tools,
+	})
+	if !errors.Is(err, models.ErrFeatureNotSupported) {
+		t.Errorf("Expected ErrFeatureNotSupported from Google, got %v", err)
+	}
+}
+
+func TestImagesNotSupported(t *testing.T) {
+	image := models.Message{Role: "user", Parts: []models.ContentPart{
+		{Type: models.ContentPartText, Text: "What is this?"},
+		{Type: models.ContentPartImage, ImageURL: "https://example.com/cat.png"},
+	}}
+	if err := imagesNotSupported("cohere", &models.Request{Messages: []models.Message{{Role: "user", Content: "Hi"}}}); err != nil {
+		t.Errorf("Expected no error without images, got %v", err)
+	}
+
+	// Vendors without vision support fail before sending anything
+	vendor := NewCohere(&models.VendorConfig{APIKey: "test-key", BaseURL: "http://127.0.0.1:0"})
+	_, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "command-r",
+		Messages: []models.Message{image},
+	})
+	if !errors.Is(err, models.ErrFeatureNotSupported) {
+		t.Errorf("Expected ErrFeatureNotSupported from Cohere, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{"seconds", "30", 30 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"HTTP date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"past HTTP date", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"missing", "", 0},
+		{"malformed", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.expected {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSendRequest_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"seconds", "7", 7 * time.Second, 7 * time.Second},
+		// HTTP dates have whole-second precision
+		{"HTTP date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+	}
+	vendors := []struct {
+		name  string
+		model string
+		new   func(config *models.VendorConfig) models.LLMVendor
+	}{
+		{"openai", "gpt-3.5-turbo", func(config *models.VendorConfig) models.LLMVendor { return NewOpenAI(config) }},
+		{"anthropic", "claude-3-sonnet-20240229", func(config *models.VendorConfig) models.LLMVendor { return NewAnthropic(config) }},
+	}
+
+	for _, vendor := range vendors {
+		for _, tt := range tests {
+			t.Run(vendor.name+" "+tt.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Retry-After", tt.header)
+					w.WriteHeader(http.StatusTooManyRequests)
+					w.Write([]byte(`{"error": {"message": "Rate limit reached", "type": "rate_limit_error"}}`))
+				}))
+				defer server.Close()
+
+				_, err := vendor.new(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL}).SendRequest(context.Background(), &models.Request{
+					Model:    vendor.model,
+					Messages: []models.Message{{Role: "user", Content: "Hello"}},
+				})
+
+				var vendorErr *models.VendorError
+				if !errors.As(err, &vendorErr) {
+					t.Fatalf("Expected VendorError, got %v", err)
+				}
+				if vendorErr.RetryAfter < tt.min || vendorErr.RetryAfter > tt.max {
+					t.Errorf("Expected RetryAfter between %v and %v, got %v", tt.min, tt.max, vendorErr.RetryAfter)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package vendors
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// maxEventStreamMessageSize bounds a single message of an AWS event stream
+// so a misbehaving server cannot make the parser allocate without limit
+const maxEventStreamMessageSize = 16 << 20
+
+// errMalformedEventStream marks event stream messages that arrived whole
+// but can't be decoded, as opposed to a broken connection
+var errMalformedEventStream = errors.New("malformed event stream message")
+
+// eventStreamMessage is one message of the AWS event stream encoding used
+// by Bedrock's streaming responses. Only string headers are kept.
+type eventStreamMessage struct {
+	headers map[string]string
+	payload []byte
+}
+
+// readEventStreamMessage reads the next message from r. It returns io.EOF
+// when r ends between messages.
+//
+// Each message is a 12-byte prelude (total length, headers length and the
+// prelude's CRC32), the headers, the payload and a CRC32 of everything
+// before it, all big-endian.
+func readEventStreamMessage(r io.Reader) (*eventStreamMessage, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r, prelude[:]); err != nil {
+		return nil, err
+	}
+
+	totalLength := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, fmt.Errorf("%w: prelude checksum mismatch", errMalformedEventStream)
+	}
+	if totalLength < 16 || totalLength > maxEventStreamMessageSize || headersLength > totalLength-16 {
+		return nil, fmt.Errorf("%w: invalid length %d", errMalformedEventStream, totalLength)
+	}
+
+	rest := make([]byte, totalLength-12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	checksum := crc32.NewIEEE()
+	checksum.Write(prelude[:])
+	checksum.Write(rest[:len(rest)-4])
+	if checksum.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+		return nil, fmt.Errorf("%w: message checksum mismatch", errMalformedEventStream)
+	}
+
+	headers, err := parseEventStreamHeaders(rest[:headersLength])
+	if err != nil {
+		return nil, err
+	}
+	return &eventStreamMessage{
+		headers: headers,
+		payload: rest[headersLength : len(rest)-4],
+	}, nil
+}
+
+// parseEventStreamHeaders decodes the headers of an event stream message,
+// skipping the values of non-string headers
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLength := int(b[0])
+		if len(b) < 1+nameLength+1 {
+			return nil, fmt.Errorf("%w: truncated header", errMalformedEventStream)
+		}
+		name := string(b[1 : 1+nameLength])
+		valueType := b[1+nameLength]
+		b = b[1+nameLength+1:]
+
+		var size int
+		switch valueType {
+		case 0, 1: // bool true, bool false
+			size = 0
+		case 2: // byte
+			size = 1
+		case 3: // short
+			size = 2
+		case 4: // int
+			size = 4
+		case 5, 8: // long, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // byte array, string
+			if len(b) < 2 {
+				return nil, fmt.Errorf("%w: truncated header %s", errMalformedEventStream, name)
+			}
+			length := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+length {
+				return nil, fmt.Errorf("%w: truncated header %s", errMalformedEventStream, name)
+			}
+			if valueType == 7 {
+				headers[name] = string(b[2 : 2+length])
+			}
+			b = b[2+length:]
+			continue
+		default:
+			return nil, fmt.Errorf("%w: unknown type %d for header %s", errMalformedEventStream, valueType, name)
+		}
+		if len(b) < size {
+			return nil, fmt.Errorf("%w: truncated header %s", errMalformedEventStream, name)
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
+
+// parseEventStream reads a Bedrock event stream from body and forwards the
+// text that extract finds in each chunk's decoded bytes to streamingResp.
+// It gives the same guarantees as parseSSEStream; an exception message
+// from the service ends the stream with its error.
+func parseEventStream(body io.Reader, streamingResp *models.StreamingResponse, extract func(data []byte) (streamEvent, error)) {
+	body = countBytes(body, streamingResp)
+	for {
+		message, err := readEventStreamMessage(body)
+		if errors.Is(err, io.EOF) {
+			streamingResp.SendDone()
+			return
+		}
+		if errors.Is(err, errMalformedEventStream) {
+			streamingResp.SendError(fmt.Errorf("failed to parse stream data: %w", err))
+			return
+		}
+		if err != nil {
+			streamingResp.SendError(fmt.Errorf("%w: failed to read stream: %w", models.ErrStreamInterrupted, err))
+			return
+		}
+
+		if messageType := message.headers[":message-type"]; messageType != "event" {
+			var exception struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(message.payload, &exception)
+			exceptionType := message.headers[":exception-type"]
+			if exceptionType == "" {
+				exceptionType = message.headers[":error-code"]
+			}
+			streamingResp.SendError(fmt.Errorf("bedrock %s: %s", exceptionType, exception.Message))
+			return
+		}
+		if message.headers[":event-type"] != "chunk" {
+			continue
+		}
+
+		// The model's own event arrives base64-encoded in the chunk
+		var chunk struct {
+			Bytes []byte `json:"bytes"`
+		}
+		if err := json.Unmarshal(message.payload, &chunk); err != nil {
+			streamingResp.SendError(fmt.Errorf("failed to parse stream data: %w", err))
+			return
+		}
+
+		if streamingResp.RawEvents != nil && json.Valid(chunk.Bytes) {
+			streamingResp.RawEvents = append(streamingResp.RawEvents, json.RawMessage(chunk.Bytes))
+		}
+
+		event, err := extract(chunk.Bytes)
+		if err != nil {
+			streamingResp.SendError(fmt.Errorf("failed to parse stream data: %w", err))
+			return
+		}
+
+		if event.usage != nil {
+			streamingResp.Usage = *event.usage
+		}
+		if event.content != "" && !streamingResp.Send(event.content) {
+			// The consumer closed the stream
+			return
+		}
+	}
+}
@@ -1,13 +1,14 @@
 package vendors
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -53,6 +54,10 @@ func (g *GoogleVendor) Name() string {
 
 // SendRequest sends a request to Google's Gemini API
 func (g *GoogleVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if err := toolsNotSupported(g.Name(), req); err != nil {
+		return nil, err
+	}
+
 	// Validate request
 	if err := req.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
@@ -69,7 +74,7 @@ func (g *GoogleVendor) SendRequest(ctx context.Context, req *models.Request) (*m
 
 	// Build URL with API key
 	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent?key=%s",
-		g.config.BaseURL, req.Model, g.config.APIKey)
+		g.config.BaseURL, g.config.VendorModelName(req.Model), g.config.APIKey)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -100,7 +105,7 @@ func (g *GoogleVendor) SendRequest(ctx context.Context, req *models.Request) (*m
 
 	// Check HTTP status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(g.Name(), resp.StatusCode, resp.Header, body)
 	}
 
 	// Parse response
@@ -111,6 +116,10 @@ func (g *GoogleVendor) SendRequest(ctx context.Context, req *models.Request) (*m
 
 	// Convert to standard response
 	response := g.convertResponse(&googleResp, req.Model)
+	response.VendorHeaders = captureHeaders(g.config, resp.Header)
+	response.Raw = rawBody(req, body)
+	response.RequestBytes = int64(len(jsonData))
+	response.ResponseBytes = int64(len(body))
 	return response, nil
 }
 
@@ -121,6 +130,7 @@ func (g *GoogleVendor) GetCapabilities() models.Capabilities {
 		SupportsStreaming: true,
 		MaxTokens:         8192,
 		MaxInputTokens:    1000000,
+		Features:          models.GetVendorModelFeatures("google"),
 	}
 }
 
@@ -129,10 +139,133 @@ func (g *GoogleVendor) IsAvailable(ctx context.Context) bool {
 	return g.config.APIKey != ""
 }
 
+// TierModel returns the model configured for a capability tier
+func (g *GoogleVendor) TierModel(tier string) string {
+	return g.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (g *GoogleVendor) RateLimit() models.RateLimit {
+	return g.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (g *GoogleVendor) RetryableStatusCodes() []int {
+	return g.config.RetryableStatusCodes
+}
+
+// defaultGoogleEmbeddingModel is used for embedding requests without a model
+const defaultGoogleEmbeddingModel = "text-embedding-004"
+
+// defaultGoogleEmbeddingBatchSize is the most requests Gemini's
+// batchEmbedContents method accepts in one call
+const defaultGoogleEmbeddingBatchSize = 100
+
+// EmbeddingBatchSize returns the most inputs sent in one embeddings call
+func (g *GoogleVendor) EmbeddingBatchSize() int {
+	if g.config.EmbeddingBatchSize > 0 {
+		return g.config.EmbeddingBatchSize
+	}
+	return defaultGoogleEmbeddingBatchSize
+}
+
+// googleEmbeddingRequest is the body of Gemini's batchEmbedContents method
+type googleEmbeddingRequest struct {
+	Requests []googleEmbedContentRequest `json:"requests"`
+}
+
+type googleEmbedContentRequest struct {
+	Model   string        `json:"model"`
+	Content googleContent `json:"content"`
+}
+
+// googleEmbeddingResponse is the response of batchEmbedContents
+type googleEmbeddingResponse struct {
+	Embeddings []struct {
+		Values []float64 `json:"values"`
+	} `json:"embeddings"`
+}
+
+// EmbedRequest computes embeddings with Gemini's batchEmbedContents
+// method. Gemini doesn't report token usage, so it is estimated from the
+// inputs.
+func (g *GoogleVendor) EmbedRequest(ctx context.Context, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = defaultGoogleEmbeddingModel
+	}
+	model = g.config.VendorModelName(model)
+
+	googleReq := googleEmbeddingRequest{Requests: make([]googleEmbedContentRequest, len(req.Input))}
+	for i, input := range req.Input {
+		googleReq.Requests[i] = googleEmbedContentRequest{
+			Model:   "models/" + model,
+			Content: googleContent{Parts: []googlePart{{Text: input}}},
+		}
+	}
+	jsonData, err := json.Marshal(googleReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1beta/models/%s:batchEmbedContents?key=%s",
+		g.config.BaseURL, model, g.config.APIKey)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "llmdispatcher/1.0")
+	for key, value := range g.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newVendorError(g.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	var googleResp googleEmbeddingResponse
+	if err := json.Unmarshal(body, &googleResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(googleResp.Embeddings) != len(req.Input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(googleResp.Embeddings))
+	}
+
+	embeddings := make([][]float64, len(googleResp.Embeddings))
+	tokens := 0
+	for i, embedding := range googleResp.Embeddings {
+		embeddings[i] = embedding.Values
+		tokens += models.EstimateTokens(req.Input[i])
+	}
+
+	return &models.EmbeddingResponse{
+		Embeddings: embeddings,
+		Model:      model,
+		Vendor:     g.Name(),
+		Usage:      models.Usage{PromptTokens: tokens, TotalTokens: tokens},
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
 // SendStreamingRequest sends a streaming request to Google
 func (g *GoogleVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	if err := toolsNotSupported(g.Name(), req); err != nil {
+		return nil, err
+	}
+
 	// Create streaming response
-	streamingResp := models.NewStreamingResponse(req.Model, g.Name())
+	streamingResp := newStreamingResponse(req, g.Name())
 
 	// Convert to Google format
 	googleReq := g.convertRequest(req)
@@ -145,8 +278,8 @@ func (g *GoogleVendor) SendStreamingRequest(ctx context.Context, req *models.Req
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create HTTP request without context for streaming
-	httpReq, err := http.NewRequest("POST", g.config.BaseURL+"/v1beta/models/"+req.Model+":generateContent", bytes.NewBuffer(reqBody))
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", g.config.BaseURL+"/v1beta/models/"+g.config.VendorModelName(req.Model)+":generateContent", bytes.NewBuffer(reqBody))
 	if err != nil {
 		streamingResp.Close()
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -174,60 +307,16 @@ func (g *GoogleVendor) SendStreamingRequest(ctx context.Context, req *models.Req
 		// Read error response body
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(g.Name(), resp.StatusCode, resp.Header, body)
 	}
 
+	streamingResp.RequestBytes = int64(len(reqBody))
+
 	// Handle streaming response in goroutine
 	go func() {
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					streamingResp.DoneChan <- true
-					return
-				}
-				streamingResp.ErrorChan <- fmt.Errorf("failed to read stream: %w", err)
-				return
-			}
-
-			// Skip empty lines
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-
-			// Remove "data: " prefix
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				data = strings.TrimSpace(data)
-				if data == "[DONE]" {
-					streamingResp.DoneChan <- true
-					return
-				}
-
-				// Parse the JSON data
-				var streamResp struct {
-					Candidates []struct {
-						Content struct {
-							Parts []struct {
-								Text string `json:"text"`
-							} `json:"parts"`
-						} `json:"content"`
-					} `json:"candidates"`
-				}
-
-				if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-					streamingResp.ErrorChan <- fmt.Errorf("failed to parse stream data: %w", err)
-					return
-				}
-
-				if len(streamResp.Candidates) > 0 && len(streamResp.Candidates[0].Content.Parts) > 0 {
-					streamingResp.ContentChan <- streamResp.Candidates[0].Content.Parts[0].Text
-				}
-			}
-		}
+		parseSSEStream(resp.Body, streamingResp, extractGoogleDelta)
 	}()
 
 	return streamingResp, nil
@@ -239,7 +328,7 @@ func (g *GoogleVendor) convertRequest(req *models.Request) *googleRequest {
 	contents := make([]googleContent, 0, len(req.Messages))
 	for _, msg := range req.Messages {
 		contents = append(contents, googleContent{
-			Parts: []googlePart{{Text: msg.Content}},
+			Parts: googleParts(msg),
 		})
 	}
 
@@ -260,6 +349,47 @@ func (g *GoogleVendor) convertRequest(req *models.Request) *googleRequest {
 	return googleReq
 }
 
+// googleParts converts a message's content to Gemini parts. Images in data
+// URLs are sent inline; other image URLs are passed by reference, with the
+// MIME type guessed from their extension.
+func googleParts(msg models.Message) []googlePart {
+	if len(msg.Parts) == 0 {
+		return []googlePart{{Text: msg.Content}}
+	}
+
+	parts := make([]googlePart, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		if part.Type != models.ContentPartImage {
+			parts = append(parts, googlePart{Text: part.Text})
+			continue
+		}
+		if mimeType, data, ok := parseDataURL(part.ImageURL); ok {
+			parts = append(parts, googlePart{InlineData: &googleBlob{MimeType: mimeType, Data: data}})
+			continue
+		}
+		mimeType := mime.TypeByExtension(path.Ext(strings.SplitN(part.ImageURL, "?", 2)[0]))
+		if mimeType == "" {
+			mimeType = "image/jpeg"
+		}
+		parts = append(parts, googlePart{FileData: &googleFileData{MimeType: mimeType, FileURI: part.ImageURL}})
+	}
+	return parts
+}
+
+// parseDataURL splits a base64 data URL into its MIME type and data
+func parseDataURL(url string) (mimeType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok = strings.CutSuffix(header, ";base64")
+	return mimeType, data, ok
+}
+
 // convertResponse converts Google response to our standard format
 func (g *GoogleVendor) convertResponse(googleResp *googleResponse, model string) *models.Response {
 	// Extract content from response
@@ -275,15 +405,45 @@ func (g *GoogleVendor) convertResponse(googleResp *googleResponse, model string)
 		TotalTokens:      googleResp.UsageMetadata.PromptTokenCount + googleResp.UsageMetadata.CandidatesTokenCount,
 	}
 
+	// Ratings for the candidate, or for the prompt when it was blocked and
+	// no candidate was generated
+	ratings := googleResp.PromptFeedback.SafetyRatings
+	if len(googleResp.Candidates) > 0 {
+		ratings = googleResp.Candidates[0].SafetyRatings
+	}
+
 	return &models.Response{
-		Content:   content,
-		Model:     model,
-		Vendor:    g.Name(),
-		Usage:     usage,
-		CreatedAt: time.Now(),
+		Content:       content,
+		Model:         model,
+		Vendor:        g.Name(),
+		Usage:         usage,
+		CreatedAt:     time.Now(),
+		SafetyRatings: convertGoogleSafetyRatings(ratings),
 	}
 }
 
+// convertGoogleSafetyRatings converts Google safety ratings, preferring the
+// severity over the probability when both are reported
+func convertGoogleSafetyRatings(ratings []googleSafetyRating) []models.SafetyRating {
+	if len(ratings) == 0 {
+		return nil
+	}
+
+	converted := make([]models.SafetyRating, 0, len(ratings))
+	for _, rating := range ratings {
+		severity := rating.Severity
+		if severity == "" {
+			severity = rating.Probability
+		}
+		converted = append(converted, models.SafetyRating{
+			Category: rating.Category,
+			Severity: severity,
+			Blocked:  rating.Blocked,
+		})
+	}
+	return converted
+}
+
 // Google API request/response structures
 type googleRequest struct {
 	Contents         []googleContent        `json:"contents"`
@@ -296,7 +456,19 @@ type googleContent struct {
 }
 
 type googlePart struct {
-	Text string `json:"text"`
+	Text       string          `json:"text,omitempty"`
+	InlineData *googleBlob     `json:"inlineData,omitempty"`
+	FileData   *googleFileData `json:"fileData,omitempty"`
+}
+
+type googleBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type googleFileData struct {
+	MimeType string `json:"mimeType"`
+	FileURI  string `json:"fileUri"`
 }
 
 type googleGenerationConfig struct {
@@ -306,12 +478,25 @@ type googleGenerationConfig struct {
 }
 
 type googleResponse struct {
-	Candidates    []googleCandidate   `json:"candidates"`
-	UsageMetadata googleUsageMetadata `json:"usageMetadata"`
+	Candidates     []googleCandidate    `json:"candidates"`
+	PromptFeedback googlePromptFeedback `json:"promptFeedback"`
+	UsageMetadata  googleUsageMetadata  `json:"usageMetadata"`
 }
 
 type googleCandidate struct {
-	Content googleContent `json:"content"`
+	Content       googleContent        `json:"content"`
+	SafetyRatings []googleSafetyRating `json:"safetyRatings"`
+}
+
+type googlePromptFeedback struct {
+	SafetyRatings []googleSafetyRating `json:"safetyRatings"`
+}
+
+type googleSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Severity    string `json:"severity"`
+	Blocked     bool   `json:"blocked"`
 }
 
 type googleUsageMetadata struct {
@@ -2,6 +2,7 @@ package vendors
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -151,6 +152,42 @@ func TestGoogleVendor_ConvertRequest(t *testing.T) {
 	}
 }
 
+func TestGoogleVendor_ConvertRequest_ImageParts(t *testing.T) {
+	vendor := NewGoogle(nil)
+	req := &models.Request{
+		Model: "gemini-1.5-pro",
+		Messages: []models.Message{
+			{Role: "user", Parts: []models.ContentPart{
+				{Type: models.ContentPartText, Text: "Compare these"},
+				{Type: models.ContentPartImage, ImageURL: "data:image/png;base64,iVBORw0KGgo="},
+				{Type: models.ContentPartImage, ImageURL: "https://example.com/dog.webp?size=large"},
+			}},
+		},
+	}
+
+	parts := vendor.convertRequest(req).Contents[0].Parts
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(parts))
+	}
+	if parts[0].Text != "Compare these" {
+		t.Errorf("Expected text part, got %+v", parts[0])
+	}
+	if inline := parts[1].InlineData; inline == nil || inline.MimeType != "image/png" || inline.Data != "iVBORw0KGgo=" {
+		t.Errorf("Expected inline PNG data, got %+v", inline)
+	}
+	if file := parts[2].FileData; file == nil || file.MimeType != "image/webp" || file.FileURI != "https://example.com/dog.webp?size=large" {
+		t.Errorf("Expected WebP file reference, got %+v", file)
+	}
+
+	body, err := json.Marshal(parts[1])
+	if err != nil {
+		t.Fatalf("Failed to marshal part: %v", err)
+	}
+	if want := `{"inlineData":{"mimeType":"image/png","data":"iVBORw0KGgo="}}`; string(body) != want {
+		t.Errorf("Expected %s, got %s", want, body)
+	}
+}
+
 func TestGoogleVendor_ConvertResponse(t *testing.T) {
 	vendor := NewGoogle(nil)
 	googleResp := &googleResponse{
@@ -456,6 +493,65 @@ func TestGoogle_SendRequest_Success(t *testing.T) {
 	}
 }
 
+func TestGoogle_SendRequest_SafetyRatings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"candidates": [{
+				"content": {"parts": [{"text": "Here you go"}]},
+				"finishReason": "STOP",
+				"safetyRatings": [
+					{"category": "HARM_CATEGORY_HARASSMENT", "probability": "NEGLIGIBLE"},
+					{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "MEDIUM", "severity": "HARM_SEVERITY_LOW", "blocked": true}
+				]
+			}],
+			"usageMetadata": {"promptTokenCount": 4, "candidatesTokenCount": 3}
+		}`))
+	}))
+	defer server.Close()
+
+	vendor := NewGoogle(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	response, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "gemini-1.5-pro",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.SafetyRating{
+		{Category: "HARM_CATEGORY_HARASSMENT", Severity: "NEGLIGIBLE"},
+		{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Severity: "HARM_SEVERITY_LOW", Blocked: true},
+	}
+	if len(response.SafetyRatings) != len(expected) {
+		t.Fatalf("Expected %d safety ratings, got %v", len(expected), response.SafetyRatings)
+	}
+	for i, rating := range expected {
+		if response.SafetyRatings[i] != rating {
+			t.Errorf("Expected safety rating %d to be %+v, got %+v", i, rating, response.SafetyRatings[i])
+		}
+	}
+}
+
+func TestGoogle_ConvertResponse_PromptFeedbackSafetyRatings(t *testing.T) {
+	vendor := NewGoogle(nil)
+	var googleResp googleResponse
+	body := `{"promptFeedback": {"blockReason": "SAFETY", "safetyRatings": [{"category": "HARM_CATEGORY_HATE_SPEECH", "probability": "HIGH", "blocked": true}]}}`
+	if err := json.Unmarshal([]byte(body), &googleResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	response := vendor.convertResponse(&googleResp, "gemini-1.5-pro")
+	if len(response.SafetyRatings) != 1 || !response.SafetyRatings[0].Blocked || response.SafetyRatings[0].Severity != "HIGH" {
+		t.Errorf("Expected blocked prompt rating, got %+v", response.SafetyRatings)
+	}
+
+	response = vendor.convertResponse(&googleResponse{Candidates: []googleCandidate{{}}}, "gemini-1.5-pro")
+	if response.SafetyRatings != nil {
+		t.Errorf("Expected nil safety ratings, got %+v", response.SafetyRatings)
+	}
+}
+
 func TestGoogle_SendRequest_HTTPError(t *testing.T) {
 	// Create a test server that returns an error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -745,3 +841,52 @@ func TestGoogle_SendRequest_WithCustomHeaders(t *testing.T) {
 		t.Errorf("Expected 'Hello! How can I help you today?', got: %s", resp.Content)
 	}
 }
+
+func TestGoogleVendor_ConvertRequest_IgnoresParallelToolCalls(t *testing.T) {
+	vendor := NewGoogle(nil)
+	disabled := false
+	req := &models.Request{
+		Model:             "test-model",
+		Messages:          []models.Message{{Role: "user", Content: "Hello"}},
+		ParallelToolCalls: &disabled,
+	}
+
+	body, err := json.Marshal(vendor.convertRequest(req))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Contains(string(body), "parallel_tool_calls") {
+		t.Errorf("Expected parallel_tool_calls to be dropped, got %s", body)
+	}
+}
+
+func TestGoogle_EmbedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/text-embedding-004:batchEmbedContents" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req googleEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if len(req.Requests) != 2 || req.Requests[1].Model != "models/text-embedding-004" || req.Requests[1].Content.Parts[0].Text != "second" {
+			t.Errorf("Unexpected request %+v", req)
+		}
+
+		w.Write([]byte(`{"embeddings": [{"values": [0.1, 0.2]}, {"values": [0.3, 0.4]}]}`))
+	}))
+	defer server.Close()
+
+	vendor := NewGoogle(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	resp, err := vendor.EmbedRequest(context.Background(), &models.EmbeddingRequest{Input: []string{"first", "second"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(resp.Embeddings) != 2 || resp.Embeddings[1][1] != 0.4 {
+		t.Errorf("Expected two embeddings, got %v", resp.Embeddings)
+	}
+	if resp.Usage.TotalTokens == 0 || resp.Usage.PromptTokens != resp.Usage.TotalTokens {
+		t.Errorf("Expected estimated prompt tokens, got %+v", resp.Usage)
+	}
+}
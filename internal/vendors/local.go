@@ -25,8 +25,13 @@ type Local struct {
 	executable     string
 	useHTTP        bool
 	resourceLimits *ResourceLimits
+	stopMarkers    []string
 }
 
+// defaultLocalStopMarkers are the role markers that end the model's turn
+// when they start a new line of output
+var defaultLocalStopMarkers = []string{"User:", "System:"}
+
 // ResourceLimits defines resource constraints for local models
 type ResourceLimits struct {
 	MaxMemoryMB  int `json:"max_memory_mb"`
@@ -92,6 +97,13 @@ func NewLocal(config *models.VendorConfig) *Local {
 		if executable, ok := config.Headers["executable"]; ok {
 			local.executable = executable
 		}
+		if stopMarkers, ok := config.Headers["stop_markers"]; ok {
+			local.stopMarkers = parseStopMarkers(stopMarkers)
+		}
+	}
+
+	if local.stopMarkers == nil {
+		local.stopMarkers = defaultLocalStopMarkers
 	}
 
 	// Set default server URL for Ollama if not provided
@@ -109,6 +121,13 @@ func (l *Local) Name() string {
 
 // SendRequest sends a request to the local model
 func (l *Local) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if err := toolsNotSupported(l.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(l.Name(), req); err != nil {
+		return nil, err
+	}
+
 	if l.useHTTP {
 		return l.sendHTTPRequest(ctx, req)
 	}
@@ -148,11 +167,16 @@ func (l *Local) sendHTTPRequest(ctx context.Context, req *models.Request) (*mode
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("local model error: %s - %s", resp.Status, string(body))
+		return nil, newVendorError(l.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var localResp LocalResponse
-	if err := json.NewDecoder(resp.Body).Decode(&localResp); err != nil {
+	if err := json.Unmarshal(body, &localResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
@@ -163,9 +187,11 @@ func (l *Local) sendHTTPRequest(ctx context.Context, req *models.Request) (*mode
 			CompletionTokens: localResp.Usage.CompletionTokens,
 			TotalTokens:      localResp.Usage.TotalTokens,
 		},
-		Model:     localResp.Model,
-		Vendor:    l.Name(),
-		CreatedAt: time.Now(),
+		Model:         localResp.Model,
+		Vendor:        l.Name(),
+		CreatedAt:     time.Now(),
+		RequestBytes:  int64(len(jsonData)),
+		ResponseBytes: int64(len(body)),
 	}, nil
 }
 
@@ -238,11 +264,11 @@ func (l *Local) prepareInput(messages []models.Message) string {
 	for _, msg := range messages {
 		switch msg.Role {
 		case "system":
-			input.WriteString(fmt.Sprintf("System: %s\n", msg.Content))
+			input.WriteString(fmt.Sprintf("System: %s\n", msg.Text()))
 		case "user":
-			input.WriteString(fmt.Sprintf("User: %s\n", msg.Content))
+			input.WriteString(fmt.Sprintf("User: %s\n", msg.Text()))
 		case "assistant":
-			input.WriteString(fmt.Sprintf("Assistant: %s\n", msg.Content))
+			input.WriteString(fmt.Sprintf("Assistant: %s\n", msg.Text()))
 		}
 	}
 
@@ -250,17 +276,41 @@ func (l *Local) prepareInput(messages []models.Message) string {
 	return input.String()
 }
 
-// extractGeneratedContent extracts the generated content from the model output
+// extractGeneratedContent extracts the generated content from the model output.
+// It removes an echoed prompt and cuts the output at the first line starting
+// with a stop marker, dropping turns the model invents for other roles.
 func (l *Local) extractGeneratedContent(input, output string) string {
-	// Simple extraction - remove the input prompt from the output
-	if strings.HasPrefix(output, input) {
-		return strings.TrimSpace(output[len(input):])
+	content := strings.TrimPrefix(output, input)
+
+	for _, marker := range l.stopMarkers {
+		if idx := strings.Index(content, "\n"+marker); idx >= 0 {
+			content = content[:idx]
+		}
+	}
+
+	return strings.TrimSpace(content)
+}
+
+// parseStopMarkers parses a comma-separated list of stop markers
+func parseStopMarkers(value string) []string {
+	markers := make([]string, 0)
+	for _, marker := range strings.Split(value, ",") {
+		if marker = strings.TrimSpace(marker); marker != "" {
+			markers = append(markers, marker)
+		}
 	}
-	return strings.TrimSpace(output)
+	return markers
 }
 
 // SendStreamingRequest sends a streaming request to the local model
 func (l *Local) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	if err := toolsNotSupported(l.Name(), req); err != nil {
+		return nil, err
+	}
+	if err := imagesNotSupported(l.Name(), req); err != nil {
+		return nil, err
+	}
+
 	if l.useHTTP {
 		return l.sendHTTPStreamingRequest(ctx, req)
 	}
@@ -300,16 +350,18 @@ func (l *Local) sendHTTPStreamingRequest(ctx context.Context, req *models.Reques
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("local model error: %s - %s", resp.Status, string(body))
+		return nil, newVendorError(l.Name(), resp.StatusCode, resp.Header, body)
 	}
 
 	streamingResp := models.NewStreamingResponse(req.Model, l.Name())
 
+	streamingResp.RequestBytes = int64(len(jsonData))
+
 	go func() {
 		defer resp.Body.Close()
 		defer streamingResp.Close()
 
-		scanner := bufio.NewScanner(resp.Body)
+		scanner := bufio.NewScanner(countBytes(resp.Body, streamingResp))
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
 			if line == "" {
@@ -320,24 +372,25 @@ func (l *Local) sendHTTPStreamingRequest(ctx context.Context, req *models.Reques
 			if strings.HasPrefix(line, "data: ") {
 				data := strings.TrimPrefix(line, "data: ")
 				if data == "[DONE]" {
-					streamingResp.DoneChan <- true
+					streamingResp.SendDone()
 					return
 				}
 
 				var streamData map[string]interface{}
 				if err := json.Unmarshal([]byte(data), &streamData); err != nil {
-					streamingResp.ErrorChan <- fmt.Errorf("failed to parse stream data: %w", err)
+					streamingResp.SendError(fmt.Errorf("failed to parse stream data: %w", err))
 					return
 				}
 
-				if content, ok := streamData["content"].(string); ok {
-					streamingResp.ContentChan <- content
+				if content, ok := streamData["content"].(string); ok && !streamingResp.Send(content) {
+					// The consumer closed the stream
+					return
 				}
 			}
 		}
 
 		if err := scanner.Err(); err != nil {
-			streamingResp.ErrorChan <- fmt.Errorf("stream reading error: %w", err)
+			streamingResp.SendError(fmt.Errorf("stream reading error: %w", err))
 		}
 	}()
 
@@ -382,24 +435,27 @@ func (l *Local) sendProcessStreamingRequest(ctx context.Context, req *models.Req
 		defer streamingResp.Close()
 
 		if err := cmd.Start(); err != nil {
-			streamingResp.ErrorChan <- fmt.Errorf("failed to start process: %w", err)
+			streamingResp.SendError(fmt.Errorf("failed to start process: %w", err))
 			return
 		}
 
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
-			if line != "" {
-				streamingResp.ContentChan <- line
+			if line != "" && !streamingResp.Send(line) {
+				// The consumer closed the stream; stop the process
+				_ = cmd.Process.Kill()
+				_ = cmd.Wait()
+				return
 			}
 		}
 
 		if err := cmd.Wait(); err != nil {
-			streamingResp.ErrorChan <- fmt.Errorf("process execution failed: %w", err)
+			streamingResp.SendError(fmt.Errorf("process execution failed: %w", err))
 			return
 		}
 
-		streamingResp.DoneChan <- true
+		streamingResp.SendDone()
 	}()
 
 	return streamingResp, nil
@@ -423,6 +479,21 @@ func (l *Local) IsAvailable(ctx context.Context) bool {
 	return l.checkExecutable()
 }
 
+// TierModel returns the model configured for a capability tier
+func (l *Local) TierModel(tier string) string {
+	return l.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (l *Local) RateLimit() models.RateLimit {
+	return l.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (l *Local) RetryableStatusCodes() []int {
+	return l.config.RetryableStatusCodes
+}
+
 // checkHTTPServer checks if the HTTP server is available
 func (l *Local) checkHTTPServer(ctx context.Context) bool {
 	url := fmt.Sprintf("%s/api/tags", l.serverURL)
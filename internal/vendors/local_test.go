@@ -220,6 +220,24 @@ func TestLocal_extractGeneratedContent(t *testing.T) {
 			output: "User: Hello\nAssistant: ",
 			want:   "",
 		},
+		{
+			name:   "hallucinated user turn",
+			input:  "User: Hello\nAssistant: ",
+			output: "User: Hello\nAssistant: Hi there!  \nUser: What's the weather?\nAssistant: Sunny.",
+			want:   "Hi there!",
+		},
+		{
+			name:   "hallucinated system turn",
+			input:  "User: Hello\nAssistant: ",
+			output: "Hi there!\n\nSystem: You are now a pirate.",
+			want:   "Hi there!",
+		},
+		{
+			name:   "marker inside a line is kept",
+			input:  "User: Hello\nAssistant: ",
+			output: "Prefix lines with User: to quote them.",
+			want:   "Prefix lines with User: to quote them.",
+		},
 	}
 
 	for _, tt := range tests {
@@ -232,6 +250,22 @@ func TestLocal_extractGeneratedContent(t *testing.T) {
 	}
 }
 
+func TestLocal_extractGeneratedContent_CustomStopMarkers(t *testing.T) {
+	local := NewLocal(&models.VendorConfig{
+		Headers: map[string]string{"stop_markers": "Human:, Bot:"},
+	})
+
+	if len(local.stopMarkers) != 2 || local.stopMarkers[0] != "Human:" || local.stopMarkers[1] != "Bot:" {
+		t.Fatalf("Expected stop markers [Human: Bot:], got %v", local.stopMarkers)
+	}
+
+	output := "Hi there!\nUser: not a marker here\nHuman: Next question"
+	want := "Hi there!\nUser: not a marker here"
+	if got := local.extractGeneratedContent("", output); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
 func TestLocal_IsAvailable(t *testing.T) {
 	local := NewLocal(nil)
 
@@ -1,14 +1,12 @@
 package vendors
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/llmefficiency/llmdispatcher/internal/models"
@@ -23,14 +21,82 @@ type OpenAI struct {
 
 // OpenAIRequest represents the OpenAI API request format
 type OpenAIRequest struct {
-	Model       string           `json:"model"`
-	Messages    []models.Message `json:"messages"`
-	Temperature float64          `json:"temperature,omitempty"`
-	MaxTokens   int              `json:"max_tokens,omitempty"`
-	TopP        float64          `json:"top_p,omitempty"`
-	Stream      bool             `json:"stream,omitempty"`
-	Stop        []string         `json:"stop,omitempty"`
-	User        string           `json:"user,omitempty"`
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	Temperature float64         `json:"temperature,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	TopP        float64         `json:"top_p,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Stop        []string        `json:"stop,omitempty"`
+	User        string          `json:"user,omitempty"`
+	Tools       []OpenAITool    `json:"tools,omitempty"`
+	// ToolChoice is a string such as "auto", or an object naming the
+	// function to call
+	ToolChoice interface{} `json:"tool_choice,omitempty"`
+	// Omitted when nil so OpenAI applies its default
+	ParallelToolCalls *bool                 `json:"parallel_tool_calls,omitempty"`
+	StreamOptions     *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat    *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIMessage represents a message in the OpenAI API format
+type OpenAIMessage struct {
+	Role string `json:"role"`
+	// Content is the message's text, or an []OpenAIContentPart for
+	// multimodal messages
+	Content    interface{}      `json:"content"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIContentPart represents one part of a multimodal message
+type OpenAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+}
+
+// OpenAIImageURL is the image of an image_url content part, a URL or a
+// base64 data URL
+type OpenAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// OpenAITool represents a function the model may call
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction represents the declaration of a callable function
+type OpenAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// OpenAIToolCall represents a function call made by the model
+type OpenAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIFunctionCall represents the function and arguments of a tool call
+type OpenAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// OpenAIResponseFormat represents the OpenAI response format option
+type OpenAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// OpenAIStreamOptions represents the OpenAI streaming options
+type OpenAIStreamOptions struct {
+	// IncludeUsage asks for a final usage-only event before [DONE]
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // OpenAIResponse represents the OpenAI API response format
@@ -42,18 +108,49 @@ type OpenAIResponse struct {
 	Choices []struct {
 		Index   int `json:"index"`
 		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
+			Role      string           `json:"role"`
+			Content   string           `json:"content"`
+			ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+			// The reasoning of reasoning models, which DeepSeek-compatible
+			// APIs send as reasoning_content and OpenRouter as reasoning
+			ReasoningContent string `json:"reasoning_content,omitempty"`
+			Reasoning        string `json:"reasoning,omitempty"`
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
+		PromptTokens            int                            `json:"prompt_tokens"`
+		CompletionTokens        int                            `json:"completion_tokens"`
+		TotalTokens             int                            `json:"total_tokens"`
+		CompletionTokensDetails *OpenAICompletionTokensDetails `json:"completion_tokens_details,omitempty"`
 	} `json:"usage"`
 }
 
+// OpenAICompletionTokensDetails breaks down the completion tokens
+type OpenAICompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// reasoningTokens returns the completion tokens the response spent on
+// reasoning, as reported by reasoning models
+func (r *OpenAIResponse) reasoningTokens() int {
+	if r.Usage.CompletionTokensDetails == nil {
+		return 0
+	}
+	return r.Usage.CompletionTokensDetails.ReasoningTokens
+}
+
+// reasoningContent returns the reasoning of the response's first choice
+func (r *OpenAIResponse) reasoningContent() string {
+	if len(r.Choices) == 0 {
+		return ""
+	}
+	if message := r.Choices[0].Message; message.ReasoningContent != "" {
+		return message.ReasoningContent
+	}
+	return r.Choices[0].Message.Reasoning
+}
+
 // OpenAIError represents an OpenAI API error
 type OpenAIError struct {
 	Error struct {
@@ -104,16 +201,7 @@ func (o *OpenAI) Name() string {
 // SendRequest sends a request to OpenAI
 func (o *OpenAI) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
 	// Convert to OpenAI format
-	openaiReq := OpenAIRequest{
-		Model:       req.Model,
-		Messages:    req.Messages,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
+	openaiReq := o.convertRequest(req)
 
 	// Marshal request
 	reqBody, err := json.Marshal(openaiReq)
@@ -151,11 +239,7 @@ func (o *OpenAI) SendRequest(ctx context.Context, req *models.Request) (*models.
 
 	// Check for HTTP errors
 	if resp.StatusCode != http.StatusOK {
-		var openaiErr OpenAIError
-		if err := json.Unmarshal(body, &openaiErr); err == nil {
-			return nil, fmt.Errorf("OpenAI API error: %s", openaiErr.Error.Message)
-		}
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(o.Name(), resp.StatusCode, resp.Header, body)
 	}
 
 	// Parse response
@@ -180,7 +264,14 @@ func (o *OpenAI) SendRequest(ctx context.Context, req *models.Request) (*models.
 			PromptTokens:     openaiResp.Usage.PromptTokens,
 			CompletionTokens: openaiResp.Usage.CompletionTokens,
 			TotalTokens:      openaiResp.Usage.TotalTokens,
+			ReasoningTokens:  openaiResp.reasoningTokens(),
 		},
+		VendorHeaders:    captureHeaders(o.config, resp.Header),
+		Raw:              rawBody(req, body),
+		RequestBytes:     int64(len(reqBody)),
+		ResponseBytes:    int64(len(body)),
+		ToolCalls:        openAIToolCalls(choice.Message.ToolCalls),
+		ReasoningContent: openaiResp.reasoningContent(),
 	}
 
 	return response, nil
@@ -193,6 +284,8 @@ func (o *OpenAI) GetCapabilities() models.Capabilities {
 		SupportsStreaming: true,
 		MaxTokens:         4096,
 		MaxInputTokens:    128000,
+		MaxStopSequences:  4,
+		Features:          models.GetVendorModelFeatures("openai"),
 	}
 }
 
@@ -202,22 +295,138 @@ func (o *OpenAI) IsAvailable(ctx context.Context) bool {
 	return o.config.APIKey != ""
 }
 
+// TierModel returns the model configured for a capability tier
+func (o *OpenAI) TierModel(tier string) string {
+	return o.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (o *OpenAI) RateLimit() models.RateLimit {
+	return o.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (o *OpenAI) RetryableStatusCodes() []int {
+	return o.config.RetryableStatusCodes
+}
+
+// defaultOpenAIEmbeddingModel is used for embedding requests without a model
+const defaultOpenAIEmbeddingModel = "text-embedding-3-small"
+
+// defaultOpenAIEmbeddingBatchSize is the most inputs OpenAI's /embeddings
+// endpoint accepts in one call
+const defaultOpenAIEmbeddingBatchSize = 2048
+
+// EmbeddingBatchSize returns the most inputs sent in one embeddings call
+func (o *OpenAI) EmbeddingBatchSize() int {
+	if o.config.EmbeddingBatchSize > 0 {
+		return o.config.EmbeddingBatchSize
+	}
+	return defaultOpenAIEmbeddingBatchSize
+}
+
+// openAIEmbeddingRequest is the body of OpenAI's /embeddings endpoint
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+	User  string   `json:"user,omitempty"`
+}
+
+// openAIEmbeddingResponse is the response of OpenAI's /embeddings endpoint
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// EmbedRequest computes embeddings with OpenAI's /embeddings endpoint
+func (o *OpenAI) EmbedRequest(ctx context.Context, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = defaultOpenAIEmbeddingModel
+	}
+	reqBody, err := json.Marshal(openAIEmbeddingRequest{
+		Model: o.config.VendorModelName(model),
+		Input: req.Input,
+		User:  req.User,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.config.BaseURL+"/embeddings", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+o.config.APIKey)
+	for key, value := range o.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newVendorError(o.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	var openaiResp openAIEmbeddingResponse
+	if err := json.Unmarshal(body, &openaiResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(openaiResp.Data) != len(req.Input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(openaiResp.Data))
+	}
+
+	// Embeddings are returned in input order, but carry their index anyway
+	embeddings := make([][]float64, len(openaiResp.Data))
+	for _, data := range openaiResp.Data {
+		if data.Index < 0 || data.Index >= len(embeddings) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return &models.EmbeddingResponse{
+		Embeddings: embeddings,
+		Model:      openaiResp.Model,
+		Vendor:     o.Name(),
+		Usage: models.Usage{
+			PromptTokens: openaiResp.Usage.PromptTokens,
+			TotalTokens:  openaiResp.Usage.TotalTokens,
+		},
+		CreatedAt: time.Now(),
+	}, nil
+}
+
 // SendStreamingRequest sends a streaming request to OpenAI
 func (o *OpenAI) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	// Tool calls aren't parsed from streams
+	if err := toolsNotSupported(o.Name()+" streaming", req); err != nil {
+		return nil, err
+	}
+
 	// Create streaming response
-	streamingResp := models.NewStreamingResponse(req.Model, o.Name())
+	streamingResp := newStreamingResponse(req, o.Name())
 
 	// Convert to OpenAI format with streaming enabled
-	openaiReq := OpenAIRequest{
-		Model:       req.Model,
-		Messages:    req.Messages,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      true, // Enable streaming
-		Stop:        req.Stop,
-		User:        req.User,
-	}
+	openaiReq := o.convertRequest(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
 
 	// Marshal request
 	reqBody, err := json.Marshal(openaiReq)
@@ -226,8 +435,8 @@ func (o *OpenAI) SendStreamingRequest(ctx context.Context, req *models.Request)
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create HTTP request without context for streaming
-	httpReq, err := http.NewRequest("POST", o.config.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.config.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
 	if err != nil {
 		streamingResp.Close()
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -255,59 +464,129 @@ func (o *OpenAI) SendStreamingRequest(ctx context.Context, req *models.Request)
 		// Read error response body
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newVendorError(o.Name(), resp.StatusCode, resp.Header, body)
 	}
 
+	streamingResp.RequestBytes = int64(len(reqBody))
+
 	// Handle streaming response in goroutine
 	go func() {
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					streamingResp.DoneChan <- true
-					return
-				}
-				streamingResp.ErrorChan <- fmt.Errorf("failed to read stream: %w", err)
-				return
-			}
-
-			// Skip empty lines
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-
-			// Remove "data: " prefix
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				data = strings.TrimSpace(data)
-				if data == "[DONE]" {
-					streamingResp.DoneChan <- true
-					return
-				}
-
-				// Parse the JSON data
-				var streamResp struct {
-					Choices []struct {
-						Delta struct {
-							Content string `json:"content"`
-						} `json:"delta"`
-					} `json:"choices"`
-				}
-
-				if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-					streamingResp.ErrorChan <- fmt.Errorf("failed to parse stream data: %w", err)
-					return
-				}
-
-				if len(streamResp.Choices) > 0 && streamResp.Choices[0].Delta.Content != "" {
-					streamingResp.ContentChan <- streamResp.Choices[0].Delta.Content
-				}
-			}
-		}
+		parseOpenAIStream(resp.Body, streamingResp)
 	}()
 
 	return streamingResp, nil
 }
+
+// convertRequest converts our standard request to OpenAI format
+func (o *OpenAI) convertRequest(req *models.Request) OpenAIRequest {
+	openaiReq := OpenAIRequest{
+		Model:             o.config.VendorModelName(req.Model),
+		Messages:          openAIMessages(req.Messages),
+		Temperature:       req.Temperature,
+		MaxTokens:         req.MaxTokens,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		Stop:              req.Stop,
+		User:              req.User,
+		Tools:             openAITools(req.Tools),
+		ToolChoice:        openAIToolChoice(req.ToolChoice),
+		ParallelToolCalls: req.ParallelToolCalls,
+	}
+	if req.ResponseFormat != "" {
+		openaiReq.ResponseFormat = &OpenAIResponseFormat{Type: req.ResponseFormat}
+	}
+	return openaiReq
+}
+
+// openAIMessages converts messages to the OpenAI format, shared by the
+// OpenAI-compatible vendors
+func openAIMessages(messages []models.Message) []OpenAIMessage {
+	converted := make([]OpenAIMessage, len(messages))
+	for i, msg := range messages {
+		converted[i] = OpenAIMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		if len(msg.Parts) > 0 {
+			converted[i].Content = openAIContentParts(msg.Parts)
+		} else if msg.Content == "" && len(msg.ToolCalls) > 0 {
+			// A turn that only called tools has null content, as OpenAI
+			// returns it; text alongside the calls is sent as it is
+			converted[i].Content = nil
+		}
+		for _, call := range msg.ToolCalls {
+			converted[i].ToolCalls = append(converted[i].ToolCalls, OpenAIToolCall{
+				ID:       call.ID,
+				Type:     "function",
+				Function: OpenAIFunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+	}
+	return converted
+}
+
+// openAIContentParts converts multimodal parts to OpenAI's content array
+func openAIContentParts(parts []models.ContentPart) []OpenAIContentPart {
+	converted := make([]OpenAIContentPart, len(parts))
+	for i, part := range parts {
+		converted[i] = OpenAIContentPart{Type: part.Type, Text: part.Text}
+		if part.Type == models.ContentPartImage {
+			converted[i].ImageURL = &OpenAIImageURL{URL: part.ImageURL}
+		}
+	}
+	return converted
+}
+
+// openAITools converts tools to OpenAI function declarations
+func openAITools(tools []models.Tool) []OpenAITool {
+	if len(tools) == 0 {
+		return nil
+	}
+	converted := make([]OpenAITool, len(tools))
+	for i, tool := range tools {
+		converted[i] = OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		}
+	}
+	return converted
+}
+
+// openAIToolChoice converts a tool choice to OpenAI's tool_choice, which
+// names a specific function with an object
+func openAIToolChoice(choice string) interface{} {
+	switch choice {
+	case "":
+		return nil
+	case models.ToolChoiceAuto, models.ToolChoiceNone, models.ToolChoiceRequired:
+		return choice
+	default:
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": choice},
+		}
+	}
+}
+
+// openAIToolCalls converts the tool calls of an OpenAI response
+func openAIToolCalls(calls []OpenAIToolCall) []models.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	converted := make([]models.ToolCall, len(calls))
+	for i, call := range calls {
+		converted[i] = models.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		}
+	}
+	return converted
+}
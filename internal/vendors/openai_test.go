@@ -3,8 +3,10 @@ package vendors
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -168,16 +170,22 @@ func TestOpenAI_SendRequest_Success(t *testing.T) {
 			Choices: []struct {
 				Index   int `json:"index"`
 				Message struct {
-					Role    string `json:"role"`
-					Content string `json:"content"`
+					Role             string           `json:"role"`
+					Content          string           `json:"content"`
+					ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+					ReasoningContent string           `json:"reasoning_content,omitempty"`
+					Reasoning        string           `json:"reasoning,omitempty"`
 				} `json:"message"`
 				FinishReason string `json:"finish_reason"`
 			}{
 				{
 					Index: 0,
 					Message: struct {
-						Role    string `json:"role"`
-						Content string `json:"content"`
+						Role             string           `json:"role"`
+						Content          string           `json:"content"`
+						ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+						ReasoningContent string           `json:"reasoning_content,omitempty"`
+						Reasoning        string           `json:"reasoning,omitempty"`
 					}{
 						Role:    "assistant",
 						Content: "Hello! How can I help you today?",
@@ -186,9 +194,10 @@ func TestOpenAI_SendRequest_Success(t *testing.T) {
 				},
 			},
 			Usage: struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
+				PromptTokens            int                            `json:"prompt_tokens"`
+				CompletionTokens        int                            `json:"completion_tokens"`
+				TotalTokens             int                            `json:"total_tokens"`
+				CompletionTokensDetails *OpenAICompletionTokensDetails `json:"completion_tokens_details,omitempty"`
 			}{
 				PromptTokens:     10,
 				CompletionTokens: 5,
@@ -292,9 +301,13 @@ func TestOpenAI_SendRequest_HTTPError(t *testing.T) {
 		t.Fatal("Expected error, got nil")
 	}
 
-	// Check that the error message contains the API error
-	if err.Error() != "OpenAI API error: Invalid request" {
-		t.Errorf("Expected error message to contain 'Invalid request', got '%s'", err.Error())
+	// Check that the API error is extracted from the envelope
+	var vendorErr *models.VendorError
+	if !errors.As(err, &vendorErr) {
+		t.Fatalf("Expected VendorError, got %T: %v", err, err)
+	}
+	if vendorErr.StatusCode != http.StatusBadRequest || vendorErr.Message != "Invalid request" || vendorErr.Code != "invalid_request_error" {
+		t.Errorf("Expected HTTP 400 'Invalid request' (invalid_request_error), got %+v", vendorErr)
 	}
 }
 
@@ -358,8 +371,11 @@ func TestOpenAI_SendRequest_NoChoices(t *testing.T) {
 			Choices: []struct {
 				Index   int `json:"index"`
 				Message struct {
-					Role    string `json:"role"`
-					Content string `json:"content"`
+					Role             string           `json:"role"`
+					Content          string           `json:"content"`
+					ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+					ReasoningContent string           `json:"reasoning_content,omitempty"`
+					Reasoning        string           `json:"reasoning,omitempty"`
 				} `json:"message"`
 				FinishReason string `json:"finish_reason"`
 			}{}, // Empty choices
@@ -411,16 +427,22 @@ func TestOpenAI_SendRequest_WithHeaders(t *testing.T) {
 			Choices: []struct {
 				Index   int `json:"index"`
 				Message struct {
-					Role    string `json:"role"`
-					Content string `json:"content"`
+					Role             string           `json:"role"`
+					Content          string           `json:"content"`
+					ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+					ReasoningContent string           `json:"reasoning_content,omitempty"`
+					Reasoning        string           `json:"reasoning,omitempty"`
 				} `json:"message"`
 				FinishReason string `json:"finish_reason"`
 			}{
 				{
 					Index: 0,
 					Message: struct {
-						Role    string `json:"role"`
-						Content string `json:"content"`
+						Role             string           `json:"role"`
+						Content          string           `json:"content"`
+						ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+						ReasoningContent string           `json:"reasoning_content,omitempty"`
+						Reasoning        string           `json:"reasoning,omitempty"`
 					}{
 						Role:    "assistant",
 						Content: "Response with custom headers",
@@ -462,6 +484,68 @@ func TestOpenAI_SendRequest_WithHeaders(t *testing.T) {
 	}
 }
 
+func TestOpenAI_SendRequest_CaptureHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "59")
+		w.Header().Set("X-Ratelimit-Remaining-Tokens", "149000")
+		w.Header().Set("X-Ratelimit-Reset-Requests", "1s")
+		w.Header().Set("X-Request-Id", "req-123")
+		w.Write([]byte(`{"model": "gpt-3.5-turbo", "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		captureHeaders []string
+		expected       map[string]string
+	}{
+		{
+			name: "default rate-limit headers",
+			expected: map[string]string{
+				"x-ratelimit-remaining-requests": "59",
+				"x-ratelimit-remaining-tokens":   "149000",
+				"x-ratelimit-reset-requests":     "1s",
+			},
+		},
+		{
+			name:           "configured headers",
+			captureHeaders: []string{"X-Request-Id", "x-ratelimit-remaining-tokens", "x-missing"},
+			expected: map[string]string{
+				"x-request-id":                 "req-123",
+				"x-ratelimit-remaining-tokens": "149000",
+			},
+		},
+		{
+			name:           "capture disabled",
+			captureHeaders: []string{},
+			expected:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vendor := NewOpenAI(&models.VendorConfig{
+				APIKey:         "test-key",
+				BaseURL:        server.URL,
+				CaptureHeaders: tt.captureHeaders,
+			})
+
+			response, err := vendor.SendRequest(context.Background(), &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			})
+			if err != nil {
+				t.Fatalf("SendRequest() failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(response.VendorHeaders, tt.expected) {
+				t.Errorf("Expected vendor headers %v, got %v", tt.expected, response.VendorHeaders)
+			}
+		})
+	}
+}
+
 func TestOpenAI_SendStreamingRequest_Success(t *testing.T) {
 	// Create a test server that returns streaming data
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -644,3 +728,565 @@ func TestOpenAI_SendStreamingRequest_InvalidJSON(t *testing.T) {
 func TestOpenAI_SendStreamingRequest_WithHeaders(t *testing.T) {
 	t.Skip("Skipping streaming test due to race conditions")
 }
+
+func TestOpenAI_SendRequest_PayloadTooLarge(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{
+			name:   "HTTP 413",
+			status: http.StatusRequestEntityTooLarge,
+			body:   "request entity too large",
+		},
+		{
+			name:   "context length exceeded",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"message":"maximum context length exceeded","type":"invalid_request_error","code":"context_length_exceeded"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+			req := &models.Request{
+				Model:    "gpt-3.5-turbo",
+				Messages: []models.Message{{Role: "user", Content: "Hello"}},
+			}
+
+			_, err := vendor.SendRequest(context.Background(), req)
+			var payloadErr *models.PayloadTooLargeError
+			if !errors.As(err, &payloadErr) {
+				t.Fatalf("Expected PayloadTooLargeError, got: %v", err)
+			}
+			if payloadErr.Vendor != "openai" {
+				t.Errorf("Expected vendor 'openai', got '%s'", payloadErr.Vendor)
+			}
+			if !errors.Is(err, models.ErrPayloadTooLarge) {
+				t.Error("Expected error to match ErrPayloadTooLarge")
+			}
+		})
+	}
+}
+
+func TestOpenAI_ConvertRequest_ParallelToolCalls(t *testing.T) {
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key"})
+	disabled := false
+
+	tests := []struct {
+		name              string
+		parallelToolCalls *bool
+		expectField       bool
+	}{
+		{"omitted when nil", nil, false},
+		{"emitted when set", &disabled, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.Request{
+				Model:             "gpt-4",
+				Messages:          []models.Message{{Role: "user", Content: "Hello"}},
+				ParallelToolCalls: tt.parallelToolCalls,
+			}
+
+			body, err := json.Marshal(vendor.convertRequest(req))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var fields map[string]interface{}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			value, exists := fields["parallel_tool_calls"]
+			if exists != tt.expectField {
+				t.Fatalf("Expected parallel_tool_calls present=%v, got %s", tt.expectField, body)
+			}
+			if exists && value != false {
+				t.Errorf("Expected parallel_tool_calls false, got %v", value)
+			}
+		})
+	}
+}
+
+func TestOpenAI_ConvertRequest_ModelNameMap(t *testing.T) {
+	req := &models.Request{
+		Model:    "gpt-3.5-turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	tests := []struct {
+		name          string
+		modelNameMap  map[string]string
+		expectedModel string
+	}{
+		{
+			name:          "no map keeps dotted name",
+			modelNameMap:  nil,
+			expectedModel: "gpt-3.5-turbo",
+		},
+		{
+			name:          "unrelated mapping keeps dotted name",
+			modelNameMap:  map[string]string{"gpt-4": "gpt-4-0613"},
+			expectedModel: "gpt-3.5-turbo",
+		},
+		{
+			name:          "mapped name",
+			modelNameMap:  map[string]string{"gpt-3.5-turbo": "gpt-3.5-turbo-0125"},
+			expectedModel: "gpt-3.5-turbo-0125",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", ModelNameMap: tt.modelNameMap})
+
+			got := vendor.convertRequest(req)
+			if got.Model != tt.expectedModel {
+				t.Errorf("Expected model %s, got %s", tt.expectedModel, got.Model)
+			}
+		})
+	}
+
+	if req.Model != "gpt-3.5-turbo" {
+		t.Errorf("Expected request model to stay gpt-3.5-turbo, got %s", req.Model)
+	}
+}
+
+func TestOpenAI_TierModel(t *testing.T) {
+	vendor := NewOpenAI(&models.VendorConfig{
+		APIKey:     "test-key",
+		TierModels: map[string]string{models.TierSophisticated: "gpt-4o"},
+	})
+
+	if got := vendor.TierModel(models.TierSophisticated); got != "gpt-4o" {
+		t.Errorf("Expected sophisticated tier model gpt-4o, got %s", got)
+	}
+	if got := vendor.TierModel(models.TierFast); got != "" {
+		t.Errorf("Expected no fast tier model, got %s", got)
+	}
+}
+
+func TestOpenAI_ConvertRequest_ResponseFormat(t *testing.T) {
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key"})
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	if got := vendor.convertRequest(req).ResponseFormat; got != nil {
+		t.Errorf("Expected response_format omitted, got %+v", got)
+	}
+
+	req.ResponseFormat = models.ResponseFormatJSON
+	got := vendor.convertRequest(req).ResponseFormat
+	if got == nil || got.Type != "json_object" {
+		t.Errorf("Expected response_format json_object, got %+v", got)
+	}
+}
+
+func TestOpenAI_ConvertRequest_ImageParts(t *testing.T) {
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key"})
+	req := &models.Request{
+		Model: "gpt-4o",
+		Messages: []models.Message{
+			{Role: "system", Content: "Describe images."},
+			{Role: "user", Parts: []models.ContentPart{
+				{Type: models.ContentPartText, Text: "What is this?"},
+				{Type: models.ContentPartImage, ImageURL: "https://example.com/cat.png"},
+			}},
+		},
+	}
+
+	body, err := json.Marshal(vendor.convertRequest(req))
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	var decoded struct {
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Failed to decode request: %v", err)
+	}
+
+	if got := string(decoded.Messages[0].Content); got != `"Describe images."` {
+		t.Errorf("Expected plain string content, got %s", got)
+	}
+	want := `[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]`
+	if got := string(decoded.Messages[1].Content); got != want {
+		t.Errorf("Expected content %s, got %s", want, got)
+	}
+}
+
+func TestOpenAI_ConvertRequest_User(t *testing.T) {
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key"})
+	azure := NewAzureOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: "https://test.openai.azure.com"})
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	for _, tt := range []struct {
+		user     string
+		expected string
+	}{
+		{"", ""},
+		{"user-123", `"user":"user-123"`},
+	} {
+		req.User = tt.user
+		for name, converted := range map[string]any{"openai": vendor.convertRequest(req), "azure": azure.convertRequest(req)} {
+			body, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.expected == "" && strings.Contains(string(body), `"user":`) {
+				t.Errorf("Expected %s to omit user, got %s", name, body)
+			}
+			if tt.expected != "" && !strings.Contains(string(body), tt.expected) {
+				t.Errorf("Expected %s to send %s, got %s", name, tt.expected, body)
+			}
+		}
+	}
+}
+
+func TestOpenAI_IncludeRawResponse(t *testing.T) {
+	const body = `{"model": "gpt-3.5-turbo", "choices": [{"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}], "system_fingerprint": "fp_123"}`
+	events := []string{
+		`{"choices":[{"delta":{"content":"Hi"}}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			w.Write([]byte("data: " + event + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+
+	for _, include := range []bool{false, true} {
+		req := &models.Request{
+			Model:              "gpt-3.5-turbo",
+			Messages:           []models.Message{{Role: "user", Content: "Hello"}},
+			IncludeRawResponse: include,
+		}
+
+		response, err := vendor.SendRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if include && string(response.Raw) != body {
+			t.Errorf("Expected raw body %s, got %s", body, response.Raw)
+		}
+		if !include && response.Raw != nil {
+			t.Errorf("Expected no raw body when not requested, got %s", response.Raw)
+		}
+
+		stream, err := vendor.SendStreamingRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		select {
+		case <-stream.DoneChan:
+		case err := <-stream.ErrorChan:
+			t.Fatalf("Expected no stream error, got %v", err)
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for stream")
+		}
+		if include {
+			if len(stream.RawEvents) != len(events) {
+				t.Fatalf("Expected %d raw events, got %d", len(events), len(stream.RawEvents))
+			}
+			for i, event := range events {
+				if string(stream.RawEvents[i]) != event {
+					t.Errorf("Expected raw event %d to be %s, got %s", i, event, stream.RawEvents[i])
+				}
+			}
+		} else if stream.RawEvents != nil {
+			t.Errorf("Expected no raw events when not requested, got %d", len(stream.RawEvents))
+		}
+	}
+}
+
+func TestOpenAI_SendRequest_ToolCalls(t *testing.T) {
+	weatherTool := models.Tool{
+		Name:        "get_weather",
+		Description: "Get the weather for a city",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+	}
+
+	round := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		round++
+		var req OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Type != "function" || req.Tools[0].Function.Name != "get_weather" {
+			t.Errorf("Expected the get_weather function, got %+v", req.Tools)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch round {
+		case 1:
+			if choice, _ := json.Marshal(req.ToolChoice); string(choice) != `{"function":{"name":"get_weather"},"type":"function"}` {
+				t.Errorf("Expected tool_choice naming get_weather, got %s", choice)
+			}
+			w.Write([]byte(`{
+				"model": "gpt-4o",
+				"choices": [{
+					"message": {"role": "assistant", "content": null, "tool_calls": [
+						{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+					]},
+					"finish_reason": "tool_calls"
+				}]
+			}`))
+		case 2:
+			if len(req.Messages) != 3 {
+				t.Fatalf("Expected 3 messages, got %d", len(req.Messages))
+			}
+			call := req.Messages[1]
+			if call.Role != "assistant" || len(call.ToolCalls) != 1 || call.ToolCalls[0].ID != "call_1" || call.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+				t.Errorf("Expected the assistant's tool call, got %+v", call)
+			}
+			result := req.Messages[2]
+			if result.Role != "tool" || result.ToolCallID != "call_1" || result.Content != "18C and sunny" {
+				t.Errorf("Expected the tool result, got %+v", result)
+			}
+			w.Write([]byte(`{
+				"model": "gpt-4o",
+				"choices": [{"message": {"role": "assistant", "content": "It is 18C and sunny in Paris."}, "finish_reason": "stop"}]
+			}`))
+		}
+	}))
+	defer server.Close()
+
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	req := &models.Request{
+		Model:      "gpt-4o",
+		Messages:   []models.Message{{Role: "user", Content: "What's the weather in Paris?"}},
+		Tools:      []models.Tool{weatherTool},
+		ToolChoice: "get_weather",
+	}
+
+	response, err := vendor.SendRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+	expected := []models.ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`}}
+	if !reflect.DeepEqual(response.ToolCalls, expected) || response.FinishReason != "tool_calls" {
+		t.Fatalf("Expected tool calls %+v, got %+v (finish reason %s)", expected, response.ToolCalls, response.FinishReason)
+	}
+
+	req.ToolChoice = ""
+	req.Messages = append(req.Messages,
+		models.Message{Role: "assistant", ToolCalls: response.ToolCalls},
+		models.Message{Role: "tool", ToolCallID: "call_1", Content: "18C and sunny"},
+	)
+	response, err = vendor.SendRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+	if response.Content != "It is 18C and sunny in Paris." || response.ToolCalls != nil {
+		t.Errorf("Expected the final answer, got %+v", response)
+	}
+}
+
+func TestOpenAI_EmbedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("Expected path /embeddings, got %s", r.URL.Path)
+		}
+		var req openAIEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Model != defaultOpenAIEmbeddingModel {
+			t.Errorf("Expected default model %s, got %s", defaultOpenAIEmbeddingModel, req.Model)
+		}
+		if len(req.Input) != 2 {
+			t.Errorf("Expected 2 inputs, got %v", req.Input)
+		}
+
+		// Out of order, to check the index is honored
+		w.Write([]byte(`{
+			"data": [{"index": 1, "embedding": [0.3, 0.4]}, {"index": 0, "embedding": [0.1, 0.2]}],
+			"model": "text-embedding-3-small",
+			"usage": {"prompt_tokens": 6, "total_tokens": 6}
+		}`))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	resp, err := vendor.EmbedRequest(context.Background(), &models.EmbeddingRequest{Input: []string{"first", "second"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(resp.Embeddings) != 2 || resp.Embeddings[0][0] != 0.1 || resp.Embeddings[1][0] != 0.3 {
+		t.Errorf("Expected embeddings in input order, got %v", resp.Embeddings)
+	}
+	if resp.Usage.PromptTokens != 6 || resp.Usage.TotalTokens != 6 {
+		t.Errorf("Expected 6 tokens of usage, got %+v", resp.Usage)
+	}
+	if resp.Vendor != "openai" || resp.Model != "text-embedding-3-small" {
+		t.Errorf("Expected openai text-embedding-3-small, got %s %s", resp.Vendor, resp.Model)
+	}
+}
+
+func TestOpenAI_SendRequest_Reasoning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"model": "deepseek-reasoner",
+			"choices": [{"message": {"role": "assistant", "content": "42", "reasoning_content": "Six times seven."}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 8, "completion_tokens": 30, "total_tokens": 38, "completion_tokens_details": {"reasoning_tokens": 25}}
+		}`))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	resp, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "deepseek-reasoner",
+		Messages: []models.Message{{Role: "user", Content: "What is six times seven?"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if resp.Content != "42" || resp.ReasoningContent != "Six times seven." {
+		t.Errorf("Expected content and reasoning apart, got %q and %q", resp.Content, resp.ReasoningContent)
+	}
+	if resp.Usage.ReasoningTokens != 25 || resp.Usage.CompletionTokens != 30 {
+		t.Errorf("Expected 25 of 30 completion tokens spent reasoning, got %+v", resp.Usage)
+	}
+}
+
+func TestOpenAI_PayloadSizes(t *testing.T) {
+	const body = `{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+	const stream = "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n"
+
+	var requestBytes int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBytes = r.ContentLength
+		var req OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			w.Write([]byte(stream))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	req := &models.Request{
+		Model:    "gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+
+	resp, err := vendor.SendRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.RequestBytes != requestBytes || resp.ResponseBytes != int64(len(body)) {
+		t.Errorf("Expected %d bytes sent and %d received, got %d and %d",
+			requestBytes, len(body), resp.RequestBytes, resp.ResponseBytes)
+	}
+
+	streamingResp, err := vendor.SendStreamingRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer streamingResp.Close()
+	for done := false; !done; {
+		select {
+		case <-streamingResp.ContentChan:
+		case done = <-streamingResp.DoneChan:
+		case err := <-streamingResp.ErrorChan:
+			t.Fatalf("Streaming error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for streaming response")
+		}
+	}
+	if streamingResp.RequestBytes != requestBytes || streamingResp.ResponseBytes != int64(len(stream)) {
+		t.Errorf("Expected %d bytes sent and %d received, got %d and %d",
+			requestBytes, len(stream), streamingResp.RequestBytes, streamingResp.ResponseBytes)
+	}
+}
+
+func TestOpenAI_EmbeddingBatchSize(t *testing.T) {
+	if size := NewOpenAI(&models.VendorConfig{APIKey: "test-key"}).EmbeddingBatchSize(); size != defaultOpenAIEmbeddingBatchSize {
+		t.Errorf("Expected the default batch size %d, got %d", defaultOpenAIEmbeddingBatchSize, size)
+	}
+	if size := NewOpenAI(&models.VendorConfig{APIKey: "test-key", EmbeddingBatchSize: 500}).EmbeddingBatchSize(); size != 500 {
+		t.Errorf("Expected the configured batch size 500, got %d", size)
+	}
+}
+
+func TestOpenAI_ConvertRequest_AssistantContentAndToolCalls(t *testing.T) {
+	vendor := NewOpenAI(&models.VendorConfig{APIKey: "test-key"})
+	calls := []models.ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`}}
+
+	tests := []struct {
+		name     string
+		message  models.Message
+		expected string
+	}{
+		{
+			name:     "content and tool calls",
+			message:  models.Message{Role: "assistant", Content: "Let me check.", ToolCalls: calls},
+			expected: `{"role":"assistant","content":"Let me check.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`,
+		},
+		{
+			name:     "tool calls only",
+			message:  models.Message{Role: "assistant", ToolCalls: calls},
+			expected: `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`,
+		},
+		{
+			name:     "content only",
+			message:  models.Message{Role: "assistant", Content: ""},
+			expected: `{"role":"assistant","content":""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.Request{
+				Model: "gpt-4o",
+				Messages: []models.Message{
+					{Role: "user", Content: "What's the weather in Paris?"},
+					tt.message,
+					{Role: "tool", ToolCallID: "call_1", Content: "18C and sunny"},
+				},
+			}
+
+			body, err := json.Marshal(vendor.convertRequest(req).Messages[1])
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if string(body) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package vendors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// openRouterModelsTTL is how long a discovered model catalog is reused
+// before /models is queried again
+const openRouterModelsTTL = 10 * time.Minute
+
+// OpenRouterVendor implements the LLMVendor interface for OpenRouter, which
+// proxies many vendors' models behind one OpenAI-compatible API. Models are
+// addressed by their fully-qualified IDs, e.g. "anthropic/claude-3.5-sonnet".
+type OpenRouterVendor struct {
+	config          *models.VendorConfig
+	client          *http.Client
+	streamingClient *http.Client
+
+	// Model discovery through the /models endpoint
+	discoverModels bool
+	modelsMu       sync.Mutex
+	modelIDs       []string
+	modelsFetched  time.Time
+}
+
+// openRouterModelsResponse represents OpenRouter's /models response
+type openRouterModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// NewOpenRouter creates a new OpenRouter vendor. The attribution headers
+// identify the application to OpenRouter and can be overridden through
+// VendorConfig.Headers.
+func NewOpenRouter(config *models.VendorConfig) *OpenRouterVendor {
+	if config == nil {
+		config = &models.VendorConfig{}
+	}
+
+	// Set default timeout if not provided
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	// Set default base URL if not provided
+	if config.BaseURL == "" {
+		config.BaseURL = "https://openrouter.ai/api/v1"
+	}
+
+	// Create client with timeout for regular requests
+	client := &http.Client{
+		Timeout: config.Timeout,
+	}
+
+	// Create client without timeout for streaming requests
+	streamingClient := &http.Client{
+		// No timeout for streaming
+	}
+
+	return &OpenRouterVendor{
+		config:          config,
+		client:          client,
+		streamingClient: streamingClient,
+	}
+}
+
+// EnableModelDiscovery makes the vendor query OpenRouter's /models endpoint.
+// IsAvailable then also requires the endpoint to answer, and GetCapabilities
+// reports the discovered catalog instead of the built-in list. The catalog
+// is cached for openRouterModelsTTL.
+func (o *OpenRouterVendor) EnableModelDiscovery() {
+	o.modelsMu.Lock()
+	defer o.modelsMu.Unlock()
+	o.discoverModels = true
+}
+
+// Name returns the vendor name
+func (o *OpenRouterVendor) Name() string {
+	return "openrouter"
+}
+
+// SendRequest sends a request to OpenRouter
+func (o *OpenRouterVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	// Marshal request
+	reqBody, err := json.Marshal(o.convertRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.config.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	o.setHeaders(httpReq)
+
+	// Send request
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, newVendorError(o.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	// Parse response
+	var openRouterResp OpenAIResponse
+	if err := json.Unmarshal(body, &openRouterResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	// Convert to standard format
+	if len(openRouterResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	choice := openRouterResp.Choices[0]
+	return &models.Response{
+		Content:      choice.Message.Content,
+		Model:        openRouterResp.Model,
+		Vendor:       o.Name(),
+		FinishReason: choice.FinishReason,
+		CreatedAt:    time.Unix(openRouterResp.Created, 0),
+		Usage: models.Usage{
+			PromptTokens:     openRouterResp.Usage.PromptTokens,
+			CompletionTokens: openRouterResp.Usage.CompletionTokens,
+			TotalTokens:      openRouterResp.Usage.TotalTokens,
+			ReasoningTokens:  openRouterResp.reasoningTokens(),
+		},
+		VendorHeaders:    captureHeaders(o.config, resp.Header),
+		Raw:              rawBody(req, body),
+		RequestBytes:     int64(len(reqBody)),
+		ResponseBytes:    int64(len(body)),
+		ToolCalls:        openAIToolCalls(choice.Message.ToolCalls),
+		ReasoningContent: openRouterResp.reasoningContent(),
+	}, nil
+}
+
+// GetCapabilities returns OpenRouter's capabilities. The model list is the
+// discovered catalog when discovery is enabled and succeeds, and otherwise
+// the built-in list of popular models; VendorConfig.Models is added to both.
+func (o *OpenRouterVendor) GetCapabilities() models.Capabilities {
+	catalog := models.GetVendorModels("openrouter")
+	if discovered, err := o.fetchModels(context.Background()); err == nil && len(discovered) > 0 {
+		catalog = discovered
+	}
+
+	allModels := make([]string, 0, len(catalog)+len(o.config.Models))
+	allModels = append(allModels, catalog...)
+	allModels = append(allModels, o.config.Models...)
+
+	return models.Capabilities{
+		Models:            allModels,
+		SupportsStreaming: true,
+		MaxTokens:         4096,
+		MaxInputTokens:    128000,
+		MaxStopSequences:  4,
+	}
+}
+
+// IsAvailable checks if OpenRouter is available. With model discovery the
+// /models endpoint must also answer.
+func (o *OpenRouterVendor) IsAvailable(ctx context.Context) bool {
+	if o.config.APIKey == "" {
+		return false
+	}
+	_, err := o.fetchModels(ctx)
+	return err == nil
+}
+
+// TierModel returns the model configured for a capability tier
+func (o *OpenRouterVendor) TierModel(tier string) string {
+	return o.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (o *OpenRouterVendor) RateLimit() models.RateLimit {
+	return o.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (o *OpenRouterVendor) RetryableStatusCodes() []int {
+	return o.config.RetryableStatusCodes
+}
+
+// SendStreamingRequest sends a streaming request to OpenRouter
+func (o *OpenRouterVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	// Tool calls aren't parsed from streams
+	if err := toolsNotSupported(o.Name()+" streaming", req); err != nil {
+		return nil, err
+	}
+
+	// Create streaming response
+	streamingResp := newStreamingResponse(req, o.Name())
+
+	// Convert to OpenRouter format with streaming and usage reporting enabled
+	openRouterReq := o.convertRequest(req)
+	openRouterReq.Stream = true
+	openRouterReq.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+
+	// Marshal request
+	reqBody, err := json.Marshal(openRouterReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.config.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	o.setHeaders(httpReq)
+
+	// Send request using streaming client (no timeout)
+	resp, err := o.streamingClient.Do(httpReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Check HTTP status code
+	if resp.StatusCode != http.StatusOK {
+		streamingResp.Close()
+		// Read error response body
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, newVendorError(o.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	// Handle streaming response in goroutine. OpenRouter interleaves
+	streamingResp.RequestBytes = int64(len(reqBody))
+
+	// ": OPENROUTER PROCESSING" comments, which the parser skips.
+	go func() {
+		defer resp.Body.Close()
+
+		parseOpenAIStream(resp.Body, streamingResp)
+	}()
+
+	return streamingResp, nil
+}
+
+// fetchModels returns the model IDs from the /models endpoint, reusing a
+// catalog fetched within openRouterModelsTTL. It returns nil without a
+// request when discovery is disabled.
+func (o *OpenRouterVendor) fetchModels(ctx context.Context) ([]string, error) {
+	o.modelsMu.Lock()
+	defer o.modelsMu.Unlock()
+
+	if !o.discoverModels {
+		return nil, nil
+	}
+	if o.modelIDs != nil && time.Since(o.modelsFetched) < openRouterModelsTTL {
+		return o.modelIDs, nil
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", o.config.BaseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	o.setHeaders(httpReq)
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from models endpoint", resp.StatusCode)
+	}
+
+	var modelsResp openRouterModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	ids := make([]string, 0, len(modelsResp.Data))
+	for _, model := range modelsResp.Data {
+		if model.ID != "" {
+			ids = append(ids, model.ID)
+		}
+	}
+	o.modelIDs = ids
+	o.modelsFetched = time.Now()
+	return ids, nil
+}
+
+// convertRequest converts our standard request to OpenRouter format. Model
+// IDs are passed through unchanged apart from VendorConfig.ModelNameMap.
+func (o *OpenRouterVendor) convertRequest(req *models.Request) OpenAIRequest {
+	openRouterReq := OpenAIRequest{
+		Model:             o.config.VendorModelName(req.Model),
+		Messages:          openAIMessages(req.Messages),
+		Temperature:       req.Temperature,
+		MaxTokens:         req.MaxTokens,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		Stop:              req.Stop,
+		User:              req.User,
+		Tools:             openAITools(req.Tools),
+		ToolChoice:        openAIToolChoice(req.ToolChoice),
+		ParallelToolCalls: req.ParallelToolCalls,
+	}
+	if req.ResponseFormat != "" {
+		openRouterReq.ResponseFormat = &OpenAIResponseFormat{Type: req.ResponseFormat}
+	}
+	return openRouterReq
+}
+
+// setHeaders sets the authentication, attribution and custom headers
+func (o *OpenRouterVendor) setHeaders(httpReq *http.Request) {
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+o.config.APIKey)
+	httpReq.Header.Set("HTTP-Referer", "https://github.com/llmefficiency/llmdispatcher")
+	httpReq.Header.Set("X-Title", "llmdispatcher")
+
+	// Add custom headers
+	for key, value := range o.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
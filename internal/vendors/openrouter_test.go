@@ -0,0 +1,222 @@
+package vendors
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+func TestNewOpenRouter(t *testing.T) {
+	vendor := NewOpenRouter(nil)
+	if vendor == nil {
+		t.Fatal("NewOpenRouter() returned nil")
+	}
+	if vendor.config.BaseURL != "https://openrouter.ai/api/v1" {
+		t.Errorf("Expected default base URL, got %s", vendor.config.BaseURL)
+	}
+	if vendor.config.Timeout != 30*time.Second {
+		t.Errorf("Expected default timeout 30s, got %v", vendor.config.Timeout)
+	}
+	if vendor.Name() != "openrouter" {
+		t.Errorf("Expected name openrouter, got %s", vendor.Name())
+	}
+}
+
+func TestOpenRouter_GetCapabilities(t *testing.T) {
+	vendor := NewOpenRouter(&models.VendorConfig{Models: []string{"mistralai/mistral-large"}})
+	capabilities := vendor.GetCapabilities()
+
+	if !capabilities.SupportsStreaming {
+		t.Error("Expected streaming support")
+	}
+	for _, expected := range []string{"anthropic/claude-3.5-sonnet", "mistralai/mistral-large"} {
+		found := false
+		for _, model := range capabilities.Models {
+			if model == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected model %s in capabilities", expected)
+		}
+	}
+}
+
+func TestOpenRouter_SendRequest_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("Expected path /chat/completions, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Expected Authorization Bearer test-key, got %s", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("HTTP-Referer") == "" || r.Header.Get("X-Title") != "my-app" {
+			t.Errorf("Expected attribution headers, got referer %q and title %q", r.Header.Get("HTTP-Referer"), r.Header.Get("X-Title"))
+		}
+
+		var req OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Model != "anthropic/claude-3.5-sonnet" {
+			t.Errorf("Expected fully-qualified model, got %s", req.Model)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "gen-123",
+			"created": 1700000000,
+			"model": "anthropic/claude-3.5-sonnet",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hi there"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 8, "completion_tokens": 3, "total_tokens": 11}
+		}`))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenRouter(&models.VendorConfig{
+		APIKey:  "test-key",
+		BaseURL: server.URL,
+		Headers: map[string]string{"X-Title": "my-app"},
+	})
+	response, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "anthropic/claude-3.5-sonnet",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+
+	if response.Content != "Hi there" {
+		t.Errorf("Expected content 'Hi there', got '%s'", response.Content)
+	}
+	if response.Vendor != "openrouter" {
+		t.Errorf("Expected vendor openrouter, got %s", response.Vendor)
+	}
+	if response.Usage.PromptTokens != 8 || response.Usage.CompletionTokens != 3 || response.Usage.TotalTokens != 11 {
+		t.Errorf("Expected usage 8/3/11, got %+v", response.Usage)
+	}
+}
+
+func TestOpenRouter_SendRequest_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		w.Write([]byte(`{"error": {"message": "Insufficient credits", "code": 402}}`))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenRouter(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	_, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "openai/gpt-4o",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Insufficient credits") {
+		t.Errorf("Expected API error message, got %v", err)
+	}
+}
+
+func TestOpenRouter_SendStreamingRequest_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Error("Expected stream with usage reporting")
+		}
+
+		w.WriteHeader(http.StatusOK)
+		streamData := []string{
+			": OPENROUTER PROCESSING\n\n",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n",
+			"data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n",
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}\n\n",
+			"data: [DONE]\n\n",
+		}
+		for _, data := range streamData {
+			w.Write([]byte(data))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	vendor := NewOpenRouter(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	streamingResp, err := vendor.SendStreamingRequest(context.Background(), &models.Request{
+		Model:    "openai/gpt-4o-mini",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("SendStreamingRequest failed: %v", err)
+	}
+	defer streamingResp.Close()
+
+	var content string
+	done := false
+	for !done {
+		select {
+		case chunk := <-streamingResp.ContentChan:
+			content += chunk
+		case done = <-streamingResp.DoneChan:
+		case err := <-streamingResp.ErrorChan:
+			t.Fatalf("Streaming error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for streaming response")
+		}
+	}
+	// Content sent before DONE may still be buffered
+	for len(streamingResp.ContentChan) > 0 {
+		content += <-streamingResp.ContentChan
+	}
+
+	if content != "Hello world" {
+		t.Errorf("Expected content 'Hello world', got '%s'", content)
+	}
+	if streamingResp.Usage.TotalTokens != 7 {
+		t.Errorf("Expected 7 total tokens, got %d", streamingResp.Usage.TotalTokens)
+	}
+}
+
+func TestOpenRouter_ModelDiscovery(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("Expected path /models, got %s", r.URL.Path)
+		}
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"data": [{"id": "x-ai/grok-2"}, {"id": "qwen/qwen-2.5-72b-instruct"}]}`))
+	}))
+	defer server.Close()
+
+	vendor := NewOpenRouter(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	vendor.EnableModelDiscovery()
+
+	if !vendor.IsAvailable(context.Background()) {
+		t.Fatal("Expected vendor to be available")
+	}
+	capabilities := vendor.GetCapabilities()
+	if len(capabilities.Models) != 2 || capabilities.Models[0] != "x-ai/grok-2" {
+		t.Errorf("Expected discovered models, got %v", capabilities.Models)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected the catalog to be fetched once, got %d requests", got)
+	}
+
+	server.Close()
+	unavailable := NewOpenRouter(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	unavailable.EnableModelDiscovery()
+	if unavailable.IsAvailable(context.Background()) {
+		t.Error("Expected vendor to be unavailable when /models fails")
+	}
+	if len(unavailable.GetCapabilities().Models) == 0 {
+		t.Error("Expected built-in models when discovery fails")
+	}
+}
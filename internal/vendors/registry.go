@@ -0,0 +1,200 @@
+package vendors
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// EnvTimeout is the request timeout given to vendors created from the
+// environment
+const EnvTimeout = 120 * time.Second
+
+// Registrar accepts vendors, such as *dispatcher.Dispatcher
+type Registrar interface {
+	RegisterVendor(vendor models.LLMVendor) error
+}
+
+// EnvFactory creates a vendor from environment variables read through
+// getenv. It returns nil when the vendor is not configured.
+type EnvFactory func(getenv func(string) string) models.LLMVendor
+
+// Registry maps vendor names to environment-driven constructors
+type Registry struct {
+	mu        sync.RWMutex
+	names     []string
+	factories map[string]EnvFactory
+}
+
+// NewRegistry creates an empty vendor registry
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]EnvFactory),
+	}
+}
+
+// Register adds or replaces the factory for a vendor name. Vendors are
+// created in the order they were first registered.
+func (r *Registry) Register(name string, factory EnvFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.factories[name]; !exists {
+		r.names = append(r.names, name)
+	}
+	r.factories[name] = factory
+}
+
+// Names returns the registered vendor names in registration order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.names))
+	copy(names, r.names)
+	return names
+}
+
+// RegisterAll creates every vendor configured in the environment and
+// registers it with disp. It returns the names of the registered vendors
+// along with any registration errors.
+func (r *Registry) RegisterAll(disp Registrar, getenv func(string) string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var registered []string
+	var errs []error
+	for _, name := range r.names {
+		vendor := r.factories[name](getenv)
+		if vendor == nil {
+			continue
+		}
+		if err := disp.RegisterVendor(vendor); err != nil {
+			errs = append(errs, fmt.Errorf("failed to register %s vendor: %w", name, err))
+			continue
+		}
+		registered = append(registered, vendor.Name())
+	}
+	return registered, errors.Join(errs...)
+}
+
+// DefaultRegistry holds the built-in vendors. New vendors register
+// themselves here to take part in RegisterAllFromEnv.
+var DefaultRegistry = NewRegistry()
+
+// RegisterAllFromEnv registers every vendor in DefaultRegistry whose
+// environment variables are set
+func RegisterAllFromEnv(disp Registrar) ([]string, error) {
+	return DefaultRegistry.RegisterAll(disp, os.Getenv)
+}
+
+// envVendorConfig builds a vendor config from an API key and base URL
+func envVendorConfig(apiKey, baseURL string) *models.VendorConfig {
+	return &models.VendorConfig{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		Timeout: EnvTimeout,
+		Headers: map[string]string{
+			"User-Agent": "llmdispatcher/1.0",
+		},
+	}
+}
+
+// envOrDefault returns the named variable, or def when it is unset
+func envOrDefault(getenv func(string) string, key, def string) string {
+	if value := getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+func init() {
+	DefaultRegistry.Register("openai", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewOpenAI(envVendorConfig(apiKey, "https://api.openai.com/v1"))
+	})
+
+	DefaultRegistry.Register("anthropic", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewAnthropic(envVendorConfig(apiKey, "https://api.anthropic.com"))
+	})
+
+	DefaultRegistry.Register("google", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("GOOGLE_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewGoogle(envVendorConfig(apiKey, "https://generativelanguage.googleapis.com"))
+	})
+
+	DefaultRegistry.Register("azure-openai", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("AZURE_OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewAzureOpenAI(envVendorConfig(apiKey, getenv("AZURE_OPENAI_ENDPOINT")))
+	})
+
+	DefaultRegistry.Register("together", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("TOGETHER_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewTogether(envVendorConfig(apiKey, "https://api.together.xyz/v1"))
+	})
+
+	DefaultRegistry.Register("openrouter", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("OPENROUTER_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewOpenRouter(envVendorConfig(apiKey, "https://openrouter.ai/api/v1"))
+	})
+
+	DefaultRegistry.Register("cohere", func(getenv func(string) string) models.LLMVendor {
+		apiKey := getenv("COHERE_API_KEY")
+		if apiKey == "" {
+			return nil
+		}
+		return NewCohere(envVendorConfig(apiKey, "https://api.cohere.com"))
+	})
+
+	// AWS credentials in the environment are often meant for other
+	// services, so Bedrock opts in through its region
+	DefaultRegistry.Register("bedrock", func(getenv func(string) string) models.LLMVendor {
+		region := getenv("BEDROCK_REGION")
+		if region == "" {
+			return nil
+		}
+		config := envVendorConfig("", "")
+		config.Headers[BedrockRegionHeader] = region
+		config.Headers[BedrockAccessKeyHeader] = getenv("AWS_ACCESS_KEY_ID")
+		config.Headers[BedrockSecretKeyHeader] = getenv("AWS_SECRET_ACCESS_KEY")
+		if token := getenv("AWS_SESSION_TOKEN"); token != "" {
+			config.Headers[BedrockSessionTokenHeader] = token
+		}
+		return NewBedrock(config)
+	})
+
+	// Local models need no API key, so they opt in through the server URL
+	DefaultRegistry.Register("local", func(getenv func(string) string) models.LLMVendor {
+		serverURL := getenv("LOCAL_SERVER_URL")
+		if serverURL == "" {
+			return nil
+		}
+		config := envVendorConfig("dummy", "")
+		config.Headers["server_url"] = serverURL
+		config.Headers["model_path"] = envOrDefault(getenv, "LOCAL_MODEL", "llama2:7b")
+		return NewLocal(config)
+	})
+}
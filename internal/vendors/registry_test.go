@@ -0,0 +1,138 @@
+package vendors
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// fakeRegistrar collects registered vendors and can reject some by name
+type fakeRegistrar struct {
+	vendors []models.LLMVendor
+	reject  map[string]bool
+}
+
+func (f *fakeRegistrar) RegisterVendor(vendor models.LLMVendor) error {
+	if f.reject[vendor.Name()] {
+		return errors.New("rejected")
+	}
+	f.vendors = append(f.vendors, vendor)
+	return nil
+}
+
+func fakeEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestDefaultRegistry_RegisterAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "empty environment",
+			env:      map[string]string{},
+			expected: nil,
+		},
+		{
+			name: "openai and google",
+			env: map[string]string{
+				"OPENAI_API_KEY": "sk-openai",
+				"GOOGLE_API_KEY": "google-key",
+			},
+			expected: []string{"openai", "google"},
+		},
+		{
+			name: "all vendors",
+			env: map[string]string{
+				"OPENAI_API_KEY":        "sk-openai",
+				"ANTHROPIC_API_KEY":     "sk-ant",
+				"GOOGLE_API_KEY":        "google-key",
+				"AZURE_OPENAI_API_KEY":  "azure-key",
+				"AZURE_OPENAI_ENDPOINT": "https://example.openai.azure.com",
+				"TOGETHER_API_KEY":      "together-key",
+				"OPENROUTER_API_KEY":    "openrouter-key",
+				"COHERE_API_KEY":        "cohere-key",
+				"BEDROCK_REGION":        "us-east-1",
+				"LOCAL_SERVER_URL":      "http://localhost:11434",
+			},
+			expected: []string{"openai", "anthropic", "google", "azure-openai", "together", "openrouter", "cohere", "bedrock", "local"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registrar := &fakeRegistrar{}
+			registered, err := DefaultRegistry.RegisterAll(registrar, fakeEnv(tt.env))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(registered, tt.expected) {
+				t.Errorf("Expected vendors %v, got %v", tt.expected, registered)
+			}
+			if len(registrar.vendors) != len(tt.expected) {
+				t.Errorf("Expected %d vendors registered, got %d", len(tt.expected), len(registrar.vendors))
+			}
+		})
+	}
+}
+
+func TestRegistry_RegisterAll_Errors(t *testing.T) {
+	registrar := &fakeRegistrar{reject: map[string]bool{"anthropic": true}}
+	env := fakeEnv(map[string]string{
+		"OPENAI_API_KEY":    "sk-openai",
+		"ANTHROPIC_API_KEY": "sk-ant",
+	})
+
+	registered, err := DefaultRegistry.RegisterAll(registrar, env)
+	if err == nil {
+		t.Error("Expected error for rejected vendor, got nil")
+	}
+	if !reflect.DeepEqual(registered, []string{"openai"}) {
+		t.Errorf("Expected vendors [openai], got %v", registered)
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("custom", func(getenv func(string) string) models.LLMVendor {
+		if getenv("CUSTOM_API_KEY") == "" {
+			return nil
+		}
+		return NewOpenAI(envVendorConfig(getenv("CUSTOM_API_KEY"), "https://custom.example.com"))
+	})
+	registry.Register("openai", DefaultRegistry.factories["openai"])
+
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"custom", "openai"}) {
+		t.Errorf("Expected names [custom openai], got %v", names)
+	}
+
+	registrar := &fakeRegistrar{}
+	registered, err := registry.RegisterAll(registrar, fakeEnv(map[string]string{"CUSTOM_API_KEY": "key"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(registered) != 1 || len(registrar.vendors) != 1 {
+		t.Errorf("Expected 1 vendor registered, got %v", registered)
+	}
+}
+
+func TestRegisterAllFromEnv(t *testing.T) {
+	for _, key := range []string{"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "GOOGLE_API_KEY", "AZURE_OPENAI_API_KEY", "TOGETHER_API_KEY", "LOCAL_SERVER_URL"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant")
+
+	registered, err := RegisterAllFromEnv(&fakeRegistrar{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(registered, []string{"anthropic"}) {
+		t.Errorf("Expected vendors [anthropic], got %v", registered)
+	}
+}
@@ -0,0 +1,240 @@
+package vendors
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// maxStreamLineSize bounds a single line of a streamed response so a
+// misbehaving server cannot make the parser buffer without limit
+const maxStreamLineSize = 1 << 20
+
+// streamEvent is the payload of a single stream event
+type streamEvent struct {
+	content string
+	// usage is set by events that report token usage, such as OpenAI's
+	// usage-only final event
+	usage *models.Usage
+}
+
+// newStreamingResponse creates the streaming response for req, collecting
+// the raw stream events when the request asked for them
+func newStreamingResponse(req *models.Request, vendor string) *models.StreamingResponse {
+	streamingResp := models.NewStreamingResponse(req.Model, vendor)
+	if req.IncludeRawResponse {
+		streamingResp.RawEvents = []json.RawMessage{}
+	}
+	return streamingResp
+}
+
+// byteCounter adds the bytes read through it to a streaming response's
+// ResponseBytes
+type byteCounter struct {
+	r    io.Reader
+	resp *models.StreamingResponse
+}
+
+// countBytes returns a reader counting the bytes read from r into
+// streamingResp. Only the goroutine parsing the stream may read from it.
+func countBytes(r io.Reader, streamingResp *models.StreamingResponse) io.Reader {
+	return &byteCounter{r: r, resp: streamingResp}
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.resp.ResponseBytes += int64(n)
+	return n, err
+}
+
+// parseSSEStream reads server-sent events from body and forwards the text
+// that extract finds in each data line to streamingResp. Usage reported by
+// an event is stored on streamingResp before done is signalled, as is the
+// data of each event when streamingResp collects RawEvents, and the number
+// of bytes read from body in ResponseBytes.
+//
+// For any input the parser guarantees that it:
+//   - never panics
+//   - returns once body is exhausted, a "[DONE]" marker is read, or an
+//     error occurs, provided the consumer keeps draining ContentChan or
+//     closes streamingResp
+//   - signals exactly one of DoneChan or ErrorChan before returning,
+//     unless streamingResp was closed
+//   - fails with an error instead of buffering a line longer than
+//     maxStreamLineSize
+//   - wraps errors reading body, other than an overlong line, in
+//     models.ErrStreamInterrupted
+//   - only forwards non-empty content chunks
+//
+// A final line without a trailing newline is still parsed.
+func parseSSEStream(body io.Reader, streamingResp *models.StreamingResponse, extract func(data []byte) (streamEvent, error)) {
+	scanner := bufio.NewScanner(countBytes(body, streamingResp))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and non-data fields such as "event:"
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			streamingResp.SendDone()
+			return
+		}
+
+		if streamingResp.RawEvents != nil && json.Valid([]byte(data)) {
+			streamingResp.RawEvents = append(streamingResp.RawEvents, json.RawMessage(data))
+		}
+
+		event, err := extract([]byte(data))
+		if err != nil {
+			streamingResp.SendError(fmt.Errorf("failed to parse stream data: %w", err))
+			return
+		}
+
+		if event.usage != nil {
+			streamingResp.Usage = *event.usage
+		}
+		if event.content != "" && !streamingResp.Send(event.content) {
+			// The consumer closed the stream
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			streamingResp.SendError(fmt.Errorf("failed to read stream: %w", err))
+			return
+		}
+		streamingResp.SendError(fmt.Errorf("%w: failed to read stream: %w", models.ErrStreamInterrupted, err))
+		return
+	}
+
+	streamingResp.SendDone()
+}
+
+// parseOpenAIStream parses an OpenAI-compatible chat completion stream,
+// as also served by Azure OpenAI and Together
+func parseOpenAIStream(body io.Reader, streamingResp *models.StreamingResponse) {
+	parseSSEStream(body, streamingResp, extractOpenAIDelta)
+}
+
+// parseAnthropicStream parses an Anthropic messages stream
+func parseAnthropicStream(body io.Reader, streamingResp *models.StreamingResponse) {
+	parseSSEStream(body, streamingResp, extractAnthropicDelta)
+}
+
+// parseCohereStream parses a Cohere v2 chat stream, which ends when the
+// body closes rather than with a "[DONE]" marker
+func parseCohereStream(body io.Reader, streamingResp *models.StreamingResponse) {
+	parseSSEStream(body, streamingResp, extractCohereDelta)
+}
+
+// extractOpenAIDelta returns the content delta of an OpenAI stream event.
+// With stream_options.include_usage the final event has no choices and
+// carries the usage for the whole stream.
+func extractOpenAIDelta(data []byte) (streamEvent, error) {
+	var streamResp struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *models.Usage `json:"usage"`
+	}
+
+	if err := json.Unmarshal(data, &streamResp); err != nil {
+		return streamEvent{}, err
+	}
+
+	event := streamEvent{usage: streamResp.Usage}
+	if len(streamResp.Choices) > 0 {
+		event.content = streamResp.Choices[0].Delta.Content
+	}
+	return event, nil
+}
+
+// extractAnthropicDelta returns the text of an Anthropic content_block_delta
+// event; all other event types carry no content
+func extractAnthropicDelta(data []byte) (streamEvent, error) {
+	var streamResp struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+	}
+
+	if err := json.Unmarshal(data, &streamResp); err != nil {
+		return streamEvent{}, err
+	}
+
+	if streamResp.Type != "content_block_delta" || streamResp.Delta.Type != "text_delta" {
+		return streamEvent{}, nil
+	}
+	return streamEvent{content: streamResp.Delta.Text}, nil
+}
+
+// extractGoogleDelta returns the text of the first candidate part of a
+// Google stream event
+func extractGoogleDelta(data []byte) (streamEvent, error) {
+	var streamResp struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+
+	if err := json.Unmarshal(data, &streamResp); err != nil {
+		return streamEvent{}, err
+	}
+
+	if len(streamResp.Candidates) == 0 || len(streamResp.Candidates[0].Content.Parts) == 0 {
+		return streamEvent{}, nil
+	}
+	return streamEvent{content: streamResp.Candidates[0].Content.Parts[0].Text}, nil
+}
+
+// extractCohereDelta returns the text of a Cohere content-delta event and
+// the usage reported by the closing message-end event
+func extractCohereDelta(data []byte) (streamEvent, error) {
+	var streamResp struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Message struct {
+				Content struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"message"`
+			Usage *cohereUsage `json:"usage"`
+		} `json:"delta"`
+	}
+
+	if err := json.Unmarshal(data, &streamResp); err != nil {
+		return streamEvent{}, err
+	}
+
+	switch streamResp.Type {
+	case "content-delta":
+		return streamEvent{content: streamResp.Delta.Message.Content.Text}, nil
+	case "message-end":
+		if streamResp.Delta.Usage == nil {
+			return streamEvent{}, nil
+		}
+		usage := streamResp.Delta.Usage.toUsage()
+		return streamEvent{usage: &usage}, nil
+	default:
+		return streamEvent{}, nil
+	}
+}
@@ -0,0 +1,233 @@
+package vendors
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// runStreamParser runs parse over input and checks the parser invariants:
+// it terminates, forwards only non-empty chunks and signals exactly one of
+// done or error. It returns the concatenated content.
+func runStreamParser(t *testing.T, parse func(io.Reader, *models.StreamingResponse), input []byte) (string, bool) {
+	t.Helper()
+
+	streamingResp := models.NewStreamingResponse("test-model", "test")
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		parse(bytes.NewReader(input), streamingResp)
+	}()
+
+	var content strings.Builder
+	timeout := time.After(5 * time.Second)
+	for running := true; running; {
+		select {
+		case chunk := <-streamingResp.ContentChan:
+			if chunk == "" {
+				t.Fatal("Expected only non-empty chunks")
+			}
+			content.WriteString(chunk)
+		case <-finished:
+			running = false
+		case <-timeout:
+			t.Fatalf("Parser did not terminate for input %q", input)
+		}
+	}
+	for len(streamingResp.ContentChan) > 0 {
+		content.WriteString(<-streamingResp.ContentChan)
+	}
+
+	done, failed := len(streamingResp.DoneChan), len(streamingResp.ErrorChan)
+	if done+failed != 1 {
+		t.Fatalf("Expected exactly one of done or error, got done=%d error=%d", done, failed)
+	}
+	return content.String(), done == 1
+}
+
+func TestParseOpenAIStream(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedContent string
+		expectDone      bool
+	}{
+		{
+			name:            "content then done",
+			input:           "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\ndata: [DONE]\n\n",
+			expectedContent: "Hello world",
+			expectDone:      true,
+		},
+		{
+			name:            "final line without newline",
+			input:           "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}",
+			expectedContent: "Hello",
+			expectDone:      true,
+		},
+		{
+			name:            "data field without space",
+			input:           "data:{\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\r\n",
+			expectedContent: "Hello",
+			expectDone:      true,
+		},
+		{
+			name:            "null choices",
+			input:           "data: {\"choices\":null}\n",
+			expectedContent: "",
+			expectDone:      true,
+		},
+		{
+			name:            "invalid json",
+			input:           "data: {\"choices\":[\n",
+			expectedContent: "",
+			expectDone:      false,
+		},
+		{
+			name:            "line longer than limit",
+			input:           "data: " + strings.Repeat("x", maxStreamLineSize+1) + "\n",
+			expectedContent: "",
+			expectDone:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, done := runStreamParser(t, parseOpenAIStream, []byte(tt.input))
+			if content != tt.expectedContent {
+				t.Errorf("Expected content %q, got %q", tt.expectedContent, content)
+			}
+			if done != tt.expectDone {
+				t.Errorf("Expected done %v, got %v", tt.expectDone, done)
+			}
+		})
+	}
+}
+
+func TestParseAnthropicStream(t *testing.T) {
+	input := "event: message_start\n" +
+		"data: {\"type\":\"message_start\",\"message\":{}}\n\n" +
+		"event: content_block_delta\n" +
+		"data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n" +
+		"data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"message_stop\"}\n\n"
+
+	content, done := runStreamParser(t, parseAnthropicStream, []byte(input))
+	if content != "Hi" {
+		t.Errorf("Expected content 'Hi', got %q", content)
+	}
+	if !done {
+		t.Error("Expected stream to finish without error")
+	}
+}
+
+func FuzzOpenAIStreamParse(f *testing.F) {
+	f.Add([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: [DONE]\n\n"))
+	f.Add([]byte("data: {\"choices\":[]}\n"))
+	f.Add([]byte("data: {\"choices\":[{\"delta\":null}]}"))
+	f.Add([]byte("data: not json\n"))
+	f.Add([]byte(": keep-alive\n\n"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		runStreamParser(t, parseOpenAIStream, input)
+	})
+}
+
+func FuzzAnthropicStreamParse(f *testing.F) {
+	f.Add([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n"))
+	f.Add([]byte("data: {\"type\":\"message_stop\"}\n"))
+	f.Add([]byte("data: {\"type\":\"content_block_delta\",\"delta\":null}\n"))
+	f.Add([]byte("data: {\"type\":\"error\",\"error\":{\"message\":\"overloaded\"}}\n"))
+	f.Add([]byte("data: [DONE]"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		runStreamParser(t, parseAnthropicStream, input)
+	})
+}
+
+func TestParseOpenAIStream_UsageOnlyFinalEvent(t *testing.T) {
+	input := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}],\"usage\":null}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}],\"usage\":null}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":null}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":1,\"total_tokens\":10}}\n\n" +
+		"data: [DONE]\n\n"
+
+	streamingResp := models.NewStreamingResponse("gpt-4o", "openai")
+	parseOpenAIStream(strings.NewReader(input), streamingResp)
+
+	if len(streamingResp.DoneChan) != 1 {
+		t.Fatal("Expected stream to finish without error")
+	}
+	if got := len(streamingResp.ContentChan); got != 1 {
+		t.Fatalf("Expected exactly 1 content chunk, got %d", got)
+	}
+	if chunk := <-streamingResp.ContentChan; chunk != "Hello" {
+		t.Errorf("Expected chunk 'Hello', got %q", chunk)
+	}
+
+	expected := models.Usage{PromptTokens: 9, CompletionTokens: 1, TotalTokens: 10}
+	if streamingResp.Usage != expected {
+		t.Errorf("Expected usage %+v, got %+v", expected, streamingResp.Usage)
+	}
+}
+
+func TestParseSSEStream_ConnectionDrop(t *testing.T) {
+	body := io.MultiReader(
+		strings.NewReader("data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n"),
+		iotest.ErrReader(io.ErrUnexpectedEOF),
+	)
+	streamingResp := models.NewStreamingResponse("test-model", "test")
+	parseOpenAIStream(body, streamingResp)
+
+	if content := <-streamingResp.ContentChan; content != "Hello" {
+		t.Errorf("Expected content Hello before the drop, got %q", content)
+	}
+	err := <-streamingResp.ErrorChan
+	if !errors.Is(err, models.ErrStreamInterrupted) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrStreamInterrupted wrapping the read error, got %v", err)
+	}
+
+	// Vendor payloads that fail to parse are not connection drops
+	streamingResp = models.NewStreamingResponse("test-model", "test")
+	parseOpenAIStream(strings.NewReader("data: {not json}\n\n"), streamingResp)
+	if err := <-streamingResp.ErrorChan; errors.Is(err, models.ErrStreamInterrupted) {
+		t.Errorf("Expected a parse error not to be an interruption, got %v", err)
+	}
+}
+
+// endlessStream yields the same server-sent event forever
+type endlessStream struct{}
+
+func (endlessStream) Read(p []byte) (int, error) {
+	return copy(p, "data: {\"choices\":[{\"delta\":{\"content\":\"x\"}}]}\n\n"), nil
+}
+
+func TestParseSSEStream_ConsumerClose(t *testing.T) {
+	streamingResp := models.NewStreamingResponseWithBuffer("test-model", "test", 1)
+	returned := make(chan struct{})
+	go func() {
+		parseOpenAIStream(endlessStream{}, streamingResp)
+		close(returned)
+	}()
+
+	// Read one chunk, then stop reading and close the stream
+	select {
+	case <-streamingResp.ContentChan:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for content")
+	}
+	streamingResp.Close()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the parser to return after the consumer closed the stream")
+	}
+}
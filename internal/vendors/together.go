@@ -0,0 +1,248 @@
+package vendors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+// TogetherVendor implements the LLMVendor interface for Together AI. Its
+// chat API is OpenAI-compatible, so it shares the OpenAI wire types.
+type TogetherVendor struct {
+	config          *models.VendorConfig
+	client          *http.Client
+	streamingClient *http.Client
+}
+
+// NewTogether creates a new Together AI vendor
+func NewTogether(config *models.VendorConfig) *TogetherVendor {
+	if config == nil {
+		config = &models.VendorConfig{}
+	}
+
+	// Set default timeout if not provided
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	// Set default base URL if not provided
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.together.xyz/v1"
+	}
+
+	// Create client with timeout for regular requests
+	client := &http.Client{
+		Timeout: config.Timeout,
+	}
+
+	// Create client without timeout for streaming requests
+	streamingClient := &http.Client{
+		// No timeout for streaming
+	}
+
+	return &TogetherVendor{
+		config:          config,
+		client:          client,
+		streamingClient: streamingClient,
+	}
+}
+
+// Name returns the vendor name
+func (t *TogetherVendor) Name() string {
+	return "together"
+}
+
+// SendRequest sends a request to Together AI
+func (t *TogetherVendor) SendRequest(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if err := toolsNotSupported(t.Name(), req); err != nil {
+		return nil, err
+	}
+
+	// Marshal request
+	reqBody, err := json.Marshal(t.convertRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", t.config.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	t.setHeaders(httpReq)
+
+	// Send request
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, newVendorError(t.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	// Parse response
+	var togetherResp OpenAIResponse
+	if err := json.Unmarshal(body, &togetherResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	// Convert to standard format
+	if len(togetherResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	choice := togetherResp.Choices[0]
+	return &models.Response{
+		Content:      choice.Message.Content,
+		Model:        togetherResp.Model,
+		Vendor:       t.Name(),
+		FinishReason: choice.FinishReason,
+		CreatedAt:    time.Unix(togetherResp.Created, 0),
+		Usage: models.Usage{
+			PromptTokens:     togetherResp.Usage.PromptTokens,
+			CompletionTokens: togetherResp.Usage.CompletionTokens,
+			TotalTokens:      togetherResp.Usage.TotalTokens,
+		},
+		VendorHeaders: captureHeaders(t.config, resp.Header),
+		Raw:           rawBody(req, body),
+		RequestBytes:  int64(len(reqBody)),
+		ResponseBytes: int64(len(body)),
+	}, nil
+}
+
+// GetCapabilities returns Together AI's capabilities. The built-in model
+// list covers popular models and is extended by VendorConfig.Models, since
+// Together's catalog is large.
+func (t *TogetherVendor) GetCapabilities() models.Capabilities {
+	catalog := models.GetVendorModels("together")
+	allModels := make([]string, 0, len(catalog)+len(t.config.Models))
+	allModels = append(allModels, catalog...)
+	allModels = append(allModels, t.config.Models...)
+
+	return models.Capabilities{
+		Models:            allModels,
+		SupportsStreaming: true,
+		MaxTokens:         4096,
+		MaxInputTokens:    131072,
+	}
+}
+
+// IsAvailable checks if Together AI is available
+func (t *TogetherVendor) IsAvailable(ctx context.Context) bool {
+	return t.config.APIKey != ""
+}
+
+// TierModel returns the model configured for a capability tier
+func (t *TogetherVendor) TierModel(tier string) string {
+	return t.config.TierModel(tier)
+}
+
+// RateLimit returns the vendor's configured rate limit
+func (t *TogetherVendor) RateLimit() models.RateLimit {
+	return t.config.RateLimit
+}
+
+// RetryableStatusCodes returns the vendor's configured retryable statuses
+func (t *TogetherVendor) RetryableStatusCodes() []int {
+	return t.config.RetryableStatusCodes
+}
+
+// SendStreamingRequest sends a streaming request to Together AI
+func (t *TogetherVendor) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
+	if err := toolsNotSupported(t.Name(), req); err != nil {
+		return nil, err
+	}
+
+	// Create streaming response
+	streamingResp := newStreamingResponse(req, t.Name())
+
+	// Convert to Together format with streaming enabled
+	togetherReq := t.convertRequest(req)
+	togetherReq.Stream = true
+
+	// Marshal request
+	reqBody, err := json.Marshal(togetherReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// The request, and with it the stream, ends when ctx does
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", t.config.BaseURL+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	t.setHeaders(httpReq)
+
+	// Send request using streaming client (no timeout)
+	resp, err := t.streamingClient.Do(httpReq)
+	if err != nil {
+		streamingResp.Close()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Check HTTP status code
+	if resp.StatusCode != http.StatusOK {
+		streamingResp.Close()
+		// Read error response body
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, newVendorError(t.Name(), resp.StatusCode, resp.Header, body)
+	}
+
+	streamingResp.RequestBytes = int64(len(reqBody))
+
+	// Handle streaming response in goroutine
+	go func() {
+		defer resp.Body.Close()
+
+		parseOpenAIStream(resp.Body, streamingResp)
+	}()
+
+	return streamingResp, nil
+}
+
+// convertRequest converts our standard request to Together format
+func (t *TogetherVendor) convertRequest(req *models.Request) OpenAIRequest {
+	togetherReq := OpenAIRequest{
+		Model:       t.config.VendorModelName(req.Model),
+		Messages:    openAIMessages(req.Messages),
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+		Stop:        req.Stop,
+		User:        req.User,
+	}
+	if req.ResponseFormat != "" {
+		togetherReq.ResponseFormat = &OpenAIResponseFormat{Type: req.ResponseFormat}
+	}
+	return togetherReq
+}
+
+// setHeaders sets the authentication and custom headers
+func (t *TogetherVendor) setHeaders(httpReq *http.Request) {
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+t.config.APIKey)
+
+	// Add custom headers
+	for key, value := range t.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
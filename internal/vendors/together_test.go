@@ -0,0 +1,227 @@
+package vendors
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
+)
+
+func TestNewTogether(t *testing.T) {
+	vendor := NewTogether(nil)
+	if vendor == nil {
+		t.Fatal("NewTogether() returned nil")
+	}
+	if vendor.config.BaseURL != "https://api.together.xyz/v1" {
+		t.Errorf("Expected default base URL, got %s", vendor.config.BaseURL)
+	}
+	if vendor.config.Timeout != 30*time.Second {
+		t.Errorf("Expected default timeout 30s, got %v", vendor.config.Timeout)
+	}
+
+	custom := NewTogether(&models.VendorConfig{APIKey: "test-key", BaseURL: "https://custom.example.com", Timeout: time.Minute})
+	if custom.config.BaseURL != "https://custom.example.com" {
+		t.Errorf("Expected custom base URL, got %s", custom.config.BaseURL)
+	}
+	if custom.config.Timeout != time.Minute {
+		t.Errorf("Expected timeout 1m, got %v", custom.config.Timeout)
+	}
+}
+
+func TestTogether_Name(t *testing.T) {
+	vendor := NewTogether(nil)
+	if vendor.Name() != "together" {
+		t.Errorf("Expected name together, got %s", vendor.Name())
+	}
+}
+
+func TestTogether_GetCapabilities(t *testing.T) {
+	vendor := NewTogether(&models.VendorConfig{
+		APIKey: "test-key",
+		Models: []string{"deepseek-ai/DeepSeek-V3"},
+	})
+	capabilities := vendor.GetCapabilities()
+
+	if !capabilities.SupportsStreaming {
+		t.Error("Expected Together to support streaming")
+	}
+
+	hasModel := func(name string) bool {
+		for _, model := range capabilities.Models {
+			if model == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasModel("meta-llama/Llama-3.1-70B-Instruct-Turbo") {
+		t.Error("Expected built-in Llama 3.1 70B model")
+	}
+	if !hasModel("deepseek-ai/DeepSeek-V3") {
+		t.Error("Expected configured model to extend the catalog")
+	}
+	if len(models.GetVendorModels("together")) == len(capabilities.Models) {
+		t.Error("Expected configured models not to be added to the shared catalog")
+	}
+}
+
+func TestTogether_IsAvailable(t *testing.T) {
+	if NewTogether(&models.VendorConfig{}).IsAvailable(context.Background()) {
+		t.Error("Expected vendor without API key to be unavailable")
+	}
+	if !NewTogether(&models.VendorConfig{APIKey: "test-key"}).IsAvailable(context.Background()) {
+		t.Error("Expected vendor with API key to be available")
+	}
+}
+
+func TestTogether_SendRequest_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("Expected path /chat/completions, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Expected Authorization Bearer test-key, got %s", r.Header.Get("Authorization"))
+		}
+
+		var req OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Model != "meta-llama/Llama-3.1-70B-Instruct-Turbo" {
+			t.Errorf("Expected Llama model, got %s", req.Model)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "test-id",
+			"created": 1700000000,
+			"model": "meta-llama/Llama-3.1-70B-Instruct-Turbo",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hi there"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 8, "completion_tokens": 3, "total_tokens": 11}
+		}`))
+	}))
+	defer server.Close()
+
+	vendor := NewTogether(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	response, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "meta-llama/Llama-3.1-70B-Instruct-Turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("SendRequest() failed: %v", err)
+	}
+
+	if response.Content != "Hi there" {
+		t.Errorf("Expected content 'Hi there', got '%s'", response.Content)
+	}
+	if response.Vendor != "together" {
+		t.Errorf("Expected vendor together, got %s", response.Vendor)
+	}
+	if response.FinishReason != "stop" {
+		t.Errorf("Expected finish reason stop, got %s", response.FinishReason)
+	}
+	if response.Usage.TotalTokens != 11 {
+		t.Errorf("Expected 11 total tokens, got %d", response.Usage.TotalTokens)
+	}
+}
+
+func TestTogether_SendRequest_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"message": "Invalid API key", "type": "invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	vendor := NewTogether(&models.VendorConfig{APIKey: "bad-key", BaseURL: server.URL})
+	_, err := vendor.SendRequest(context.Background(), &models.Request{
+		Model:    "meta-llama/Llama-3.1-70B-Instruct-Turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Invalid API key") {
+		t.Errorf("Expected API error message, got %v", err)
+	}
+}
+
+func TestTogether_SendStreamingRequest_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if !req.Stream {
+			t.Error("Expected stream to be enabled")
+		}
+
+		w.WriteHeader(http.StatusOK)
+		streamData := []string{
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n",
+			"data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n",
+			"data: [DONE]\n\n",
+		}
+		for _, data := range streamData {
+			w.Write([]byte(data))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	vendor := NewTogether(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	streamingResp, err := vendor.SendStreamingRequest(context.Background(), &models.Request{
+		Model:    "meta-llama/Llama-3.1-8B-Instruct-Turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("SendStreamingRequest failed: %v", err)
+	}
+	defer streamingResp.Close()
+
+	var content string
+	done := false
+	for !done {
+		select {
+		case chunk := <-streamingResp.ContentChan:
+			content += chunk
+		case done = <-streamingResp.DoneChan:
+		case err := <-streamingResp.ErrorChan:
+			t.Fatalf("Streaming error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for streaming response")
+		}
+	}
+	// Content sent before DONE may still be buffered
+	for len(streamingResp.ContentChan) > 0 {
+		content += <-streamingResp.ContentChan
+	}
+
+	if content != "Hello world" {
+		t.Errorf("Expected content 'Hello world', got '%s'", content)
+	}
+}
+
+func TestTogether_SendStreamingRequest_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("internal error"))
+	}))
+	defer server.Close()
+
+	vendor := NewTogether(&models.VendorConfig{APIKey: "test-key", BaseURL: server.URL})
+	_, err := vendor.SendStreamingRequest(context.Background(), &models.Request{
+		Model:    "meta-llama/Llama-3.1-8B-Instruct-Turbo",
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "HTTP error 500") {
+		t.Errorf("Expected HTTP error 500, got %v", err)
+	}
+}
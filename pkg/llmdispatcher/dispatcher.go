@@ -3,6 +3,8 @@ package llmdispatcher
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/llmefficiency/llmdispatcher/internal/dispatcher"
 	"github.com/llmefficiency/llmdispatcher/internal/models"
@@ -27,9 +29,65 @@ func NewWithConfig(config *Config) *Dispatcher {
 	if config != nil {
 		internalConfig.Mode = models.Mode(config.Mode)
 		internalConfig.Timeout = config.Timeout
+		internalConfig.TimeoutPerToken = config.TimeoutPerToken
+		internalConfig.MaxTimeout = config.MaxTimeout
+		internalConfig.AvailabilityCheckTimeout = config.AvailabilityCheckTimeout
+		internalConfig.ModelRewrites = config.ModelRewrites
+		internalConfig.ModelRewriter = config.ModelRewriter
+		internalConfig.AllowedModels = config.AllowedModels
+		internalConfig.DeniedModels = config.DeniedModels
+		if config.TierRouting != nil {
+			internalConfig.TierRouting = make(map[string]models.Mode, len(config.TierRouting))
+			for tier, mode := range config.TierRouting {
+				internalConfig.TierRouting[tier] = models.Mode(mode)
+			}
+		}
+		internalConfig.RoutingSeed = config.RoutingSeed
+		internalConfig.LRUTieBreak = config.LRUTieBreak
+		internalConfig.FallbackVendor = config.FallbackVendor
+		internalConfig.StreamingFallbackVendor = config.StreamingFallbackVendor
+		internalConfig.UnknownVendorModelPolicy = models.UnknownModelPolicy(config.UnknownVendorModelPolicy)
+		internalConfig.MaxCostPolicy = models.MaxCostPolicy(config.MaxCostPolicy)
+		internalConfig.Pricing = toInternalPricing(config.Pricing)
+		internalConfig.DefaultMaxTokens = config.DefaultMaxTokens
+		internalConfig.DefaultMaxTokensByModel = config.DefaultMaxTokensByModel
+		internalConfig.IncludeRawResponse = config.IncludeRawResponse
+		internalConfig.RecordRoutingTrace = config.RecordRoutingTrace
+		internalConfig.TrackPayloadSizes = config.TrackPayloadSizes
+		internalConfig.WaitForRateLimit = config.WaitForRateLimit
 		internalConfig.EnableLogging = config.EnableLogging
+		internalConfig.LogLevel = models.LogLevel(config.LogLevel)
+		internalConfig.Logger = config.Logger
+		internalConfig.TokenCounter = config.TokenCounter
 		internalConfig.EnableMetrics = config.EnableMetrics
 
+		if config.CircuitBreaker != nil {
+			internalConfig.CircuitBreaker = &models.CircuitBreakerConfig{
+				FailureThreshold: config.CircuitBreaker.FailureThreshold,
+				Window:           config.CircuitBreaker.Window,
+				Cooldown:         config.CircuitBreaker.Cooldown,
+			}
+		}
+
+		if config.Cache != nil {
+			internalConfig.Cache = &models.CacheConfig{
+				Enabled:                 config.Cache.Enabled,
+				MaxEntries:              config.Cache.MaxEntries,
+				TTL:                     config.Cache.TTL,
+				AllowNonZeroTemperature: config.Cache.AllowNonZeroTemperature,
+			}
+		}
+
+		if config.SemanticCache != nil {
+			internalConfig.SemanticCache = &models.SemanticCacheConfig{
+				Enabled:             config.SemanticCache.Enabled,
+				Embedder:            config.SemanticCache.Embedder,
+				SimilarityThreshold: config.SemanticCache.SimilarityThreshold,
+				MaxEntries:          config.SemanticCache.MaxEntries,
+				TTL:                 config.SemanticCache.TTL,
+			}
+		}
+
 		// Copy mode overrides if provided
 		if config.ModeOverrides != nil {
 			internalConfig.ModeOverrides = &models.ModeOverrides{
@@ -43,6 +101,14 @@ func NewWithConfig(config *Config) *Dispatcher {
 			for mode, preferences := range config.ModeOverrides.VendorPreferences {
 				internalConfig.ModeOverrides.VendorPreferences[models.Mode(mode)] = preferences
 			}
+
+			// Copy default stop sequences
+			if config.ModeOverrides.StopSequences != nil {
+				internalConfig.ModeOverrides.StopSequences = make(map[models.Mode][]string)
+				for mode, stops := range config.ModeOverrides.StopSequences {
+					internalConfig.ModeOverrides.StopSequences[models.Mode(mode)] = stops
+				}
+			}
 		}
 	}
 
@@ -51,6 +117,7 @@ func NewWithConfig(config *Config) *Dispatcher {
 			MaxRetries:      config.RetryPolicy.MaxRetries,
 			BackoffStrategy: models.BackoffStrategy(config.RetryPolicy.BackoffStrategy),
 			RetryableErrors: config.RetryPolicy.RetryableErrors,
+			Jitter:          models.JitterStrategy(config.RetryPolicy.Jitter),
 		}
 	}
 
@@ -65,41 +132,14 @@ func (d *Dispatcher) Send(ctx context.Context, req *Request) (*Response, error)
 		return nil, fmt.Errorf("request cannot be nil")
 	}
 
-	internalReq := &models.Request{
-		Model:       req.Model,
-		Messages:    make([]models.Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
-
-	for i, msg := range req.Messages {
-		internalReq.Messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	internalReq := toInternalRequest(req)
 
 	internalResp, err := d.dispatcher.Send(ctx, internalReq)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Response{
-		Content:      internalResp.Content,
-		Model:        internalResp.Model,
-		Vendor:       internalResp.Vendor,
-		FinishReason: internalResp.FinishReason,
-		CreatedAt:    internalResp.CreatedAt,
-		Usage: Usage{
-			PromptTokens:     internalResp.Usage.PromptTokens,
-			CompletionTokens: internalResp.Usage.CompletionTokens,
-			TotalTokens:      internalResp.Usage.TotalTokens,
-		},
-	}, nil
+	return toPublicResponse(internalResp), nil
 }
 
 // SendStreaming sends a streaming request to the appropriate vendor
@@ -108,23 +148,7 @@ func (d *Dispatcher) SendStreaming(ctx context.Context, req *Request) (*Streamin
 		return nil, fmt.Errorf("request cannot be nil")
 	}
 
-	internalReq := &models.Request{
-		Model:       req.Model,
-		Messages:    make([]models.Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
-
-	for i, msg := range req.Messages {
-		internalReq.Messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	internalReq := toInternalRequest(req)
 
 	internalStreamingResp, err := d.dispatcher.SendStreaming(ctx, internalReq)
 	if err != nil {
@@ -134,46 +158,44 @@ func (d *Dispatcher) SendStreaming(ctx context.Context, req *Request) (*Streamin
 	// Create public streaming response
 	publicStreamingResp := NewStreamingResponse(internalStreamingResp.Model, internalStreamingResp.Vendor)
 
-	// Copy the channels and data
-	go func() {
-		defer publicStreamingResp.Close()
+	go forwardStream(internalStreamingResp, publicStreamingResp)
 
-		for {
-			select {
-			case content, ok := <-internalStreamingResp.ContentChan:
-				if !ok {
-					return
-				}
-				select {
-				case publicStreamingResp.ContentChan <- content:
-				case <-publicStreamingResp.DoneChan:
-					return
-				}
-			case done, ok := <-internalStreamingResp.DoneChan:
-				if !ok {
-					return
-				}
-				select {
-				case publicStreamingResp.DoneChan <- done:
-				default:
-				}
-				return
-			case err, ok := <-internalStreamingResp.ErrorChan:
-				if !ok {
-					return
-				}
-				select {
-				case publicStreamingResp.ErrorChan <- err:
-				default:
-				}
-				return
-			}
-		}
-	}()
+	return publicStreamingResp, nil
+}
 
+// StreamFromFirst streams the request from several vendors at once and
+// returns the stream of the first to produce content, cancelling the
+// others. Vendors whose streams fail before any content are passed over.
+func (d *Dispatcher) StreamFromFirst(ctx context.Context, req *Request, vendors []string) (*StreamingResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	internalStreamingResp, err := d.dispatcher.StreamFromFirst(ctx, toInternalRequest(req), vendors)
+	if err != nil {
+		return nil, err
+	}
+
+	publicStreamingResp := NewStreamingResponse(internalStreamingResp.Model, internalStreamingResp.Vendor)
+	go forwardStream(internalStreamingResp, publicStreamingResp)
 	return publicStreamingResp, nil
 }
 
+// ResolveRequest returns the request as Send would hand it to a vendor,
+// after model rewrites, normalization and mode optimizations, and the name
+// of that vendor, without sending it
+func (d *Dispatcher) ResolveRequest(ctx context.Context, req *Request) (*Request, string, error) {
+	if req == nil {
+		return nil, "", fmt.Errorf("request cannot be nil")
+	}
+
+	resolved, vendor, err := d.dispatcher.ResolveRequest(ctx, toInternalRequest(req))
+	if err != nil {
+		return nil, "", err
+	}
+	return toPublicRequest(resolved), vendor, nil
+}
+
 // RegisterVendor registers a vendor with the dispatcher
 func (d *Dispatcher) RegisterVendor(vendor Vendor) error {
 	// Create an adapter to convert between public and internal interfaces
@@ -181,6 +203,12 @@ func (d *Dispatcher) RegisterVendor(vendor Vendor) error {
 	return d.dispatcher.RegisterVendor(adapter)
 }
 
+// DeregisterVendor removes a registered vendor so it is no longer
+// selected. It fails if no vendor of that name is registered.
+func (d *Dispatcher) DeregisterVendor(name string) error {
+	return d.dispatcher.DeregisterVendor(name)
+}
+
 // GetStats returns the current dispatcher statistics
 func (d *Dispatcher) GetStats() *Stats {
 	internalStats := d.dispatcher.GetStats()
@@ -192,21 +220,74 @@ func (d *Dispatcher) GetStats() *Stats {
 		AverageLatency:     internalStats.AverageLatency,
 		LastRequestTime:    internalStats.LastRequestTime,
 		VendorStats:        make(map[string]VendorStats),
+		TotalCost:          internalStats.TotalCost,
+		AverageCost:        internalStats.AverageCost,
+		EstimatedCostCount: internalStats.EstimatedCostCount,
+		RequestsByModel:    internalStats.RequestsByModel,
+		CacheHits:          internalStats.CacheHits,
+		CacheMisses:        internalStats.CacheMisses,
+
+		SemanticCacheHits:   internalStats.SemanticCacheHits,
+		SemanticCacheMisses: internalStats.SemanticCacheMisses,
 	}
 
 	for name, vendorStats := range internalStats.VendorStats {
 		stats.VendorStats[name] = VendorStats{
-			Requests:       vendorStats.Requests,
-			Successes:      vendorStats.Successes,
-			Failures:       vendorStats.Failures,
-			AverageLatency: vendorStats.AverageLatency,
-			LastUsed:       vendorStats.LastUsed,
+			Requests:                   vendorStats.Requests,
+			Successes:                  vendorStats.Successes,
+			Failures:                   vendorStats.Failures,
+			AverageLatency:             vendorStats.AverageLatency,
+			LastUsed:                   vendorStats.LastUsed,
+			TotalCost:                  vendorStats.TotalCost,
+			AverageCost:                vendorStats.AverageCost,
+			MissingUsageCount:          vendorStats.MissingUsageCount,
+			RateLimitRemainingRequests: vendorStats.RateLimitRemainingRequests,
+			RateLimitRemainingTokens:   vendorStats.RateLimitRemainingTokens,
+			RateLimitObservedAt:        vendorStats.RateLimitObservedAt,
+			AverageTTFT:                vendorStats.AverageTTFT,
+			TTFTSamples:                vendorStats.TTFTSamples,
+			StreamCount:                vendorStats.StreamCount,
+			AverageStreamDuration:      vendorStats.AverageStreamDuration,
+			TotalStreamChunks:          vendorStats.TotalStreamChunks,
+			AverageStreamChunks:        vendorStats.AverageStreamChunks,
+			PayloadSamples:             vendorStats.PayloadSamples,
+			AvgRequestBytes:            vendorStats.AvgRequestBytes,
+			AvgResponseBytes:           vendorStats.AvgResponseBytes,
+		}
+	}
+
+	if internalStats.CircuitBreakers != nil {
+		stats.CircuitBreakers = make(map[string]CircuitBreakerStats, len(internalStats.CircuitBreakers))
+		for name, breaker := range internalStats.CircuitBreakers {
+			stats.CircuitBreakers[name] = CircuitBreakerStats{
+				State:               CircuitState(breaker.State),
+				ConsecutiveFailures: breaker.ConsecutiveFailures,
+				OpenedAt:            breaker.OpenedAt,
+			}
 		}
 	}
 
 	return stats
 }
 
+// CancelAll cancels every in-flight request and stream, which then fail
+// with context.Canceled. Requests started afterwards proceed normally.
+func (d *Dispatcher) CancelAll() {
+	d.dispatcher.CancelAll()
+}
+
+// SetLogger replaces the dispatcher's logger, or restores the default one
+// when logger is nil. It must not be called while requests are in flight.
+func (d *Dispatcher) SetLogger(logger Logger) {
+	d.dispatcher.SetLogger(logger)
+}
+
+// MetricsHandler serves request metrics for Prometheus to scrape. It
+// answers 404 unless Config.EnableMetrics is set.
+func (d *Dispatcher) MetricsHandler() http.Handler {
+	return d.dispatcher.MetricsHandler()
+}
+
 // GetVendors returns a list of registered vendor names
 func (d *Dispatcher) GetVendors() []string {
 	return d.dispatcher.GetVendors()
@@ -221,6 +302,88 @@ func (d *Dispatcher) GetVendor(name string) (Vendor, bool) {
 	return &vendorWrapper{vendor: vendor}, true
 }
 
+// SetCapabilityProvider makes the dispatcher take a vendor's capabilities
+// from provider, refreshing them once they are older than ttl (ten minutes
+// when zero). A nil provider restores the vendor's own capabilities.
+func (d *Dispatcher) SetCapabilityProvider(vendorName string, provider CapabilityProvider, ttl time.Duration) error {
+	if provider == nil {
+		return d.dispatcher.SetCapabilityProvider(vendorName, nil, ttl)
+	}
+	return d.dispatcher.SetCapabilityProvider(vendorName, &capabilityProviderAdapter{provider: provider}, ttl)
+}
+
+// GetCapabilities returns a registered vendor's capabilities, refreshed
+// from its capability provider when one is set
+func (d *Dispatcher) GetCapabilities(ctx context.Context, vendorName string) (Capabilities, error) {
+	capabilities, err := d.dispatcher.GetCapabilities(ctx, vendorName)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return publicCapabilities(capabilities), nil
+}
+
+// AllModels returns the models of each registered vendor, keyed by vendor
+// name, from the vendors' live capabilities
+func (d *Dispatcher) AllModels() map[string][]string {
+	return d.dispatcher.AllModels()
+}
+
+// AllModelNames returns the models of all registered vendors as one sorted
+// list, with models offered by several vendors listed once
+func (d *Dispatcher) AllModelNames() []string {
+	return d.dispatcher.AllModelNames()
+}
+
+// capabilityProviderAdapter adapts a public capability provider to the
+// internal interface
+type capabilityProviderAdapter struct {
+	provider CapabilityProvider
+}
+
+func (a *capabilityProviderAdapter) FetchCapabilities(ctx context.Context) (models.Capabilities, error) {
+	capabilities, err := a.provider.FetchCapabilities(ctx)
+	if err != nil {
+		return models.Capabilities{}, err
+	}
+	return internalCapabilities(capabilities), nil
+}
+
+// publicCapabilities converts internal capabilities to the public type
+func publicCapabilities(capabilities models.Capabilities) Capabilities {
+	public := Capabilities{
+		Models:            capabilities.Models,
+		SupportsStreaming: capabilities.SupportsStreaming,
+		MaxTokens:         capabilities.MaxTokens,
+		MaxInputTokens:    capabilities.MaxInputTokens,
+		MaxStopSequences:  capabilities.MaxStopSequences,
+	}
+	if capabilities.Features != nil {
+		public.Features = make(map[string]ModelFeatures, len(capabilities.Features))
+		for model, features := range capabilities.Features {
+			public.Features[model] = ModelFeatures(features)
+		}
+	}
+	return public
+}
+
+// internalCapabilities converts public capabilities to the internal type
+func internalCapabilities(capabilities Capabilities) models.Capabilities {
+	internal := models.Capabilities{
+		Models:            capabilities.Models,
+		SupportsStreaming: capabilities.SupportsStreaming,
+		MaxTokens:         capabilities.MaxTokens,
+		MaxInputTokens:    capabilities.MaxInputTokens,
+		MaxStopSequences:  capabilities.MaxStopSequences,
+	}
+	if capabilities.Features != nil {
+		internal.Features = make(map[string]models.ModelFeatures, len(capabilities.Features))
+		for model, features := range capabilities.Features {
+			internal.Features[model] = models.ModelFeatures(features)
+		}
+	}
+	return internal
+}
+
 // internalVendorAdapter adapts the public vendor interface to the internal interface
 type internalVendorAdapter struct {
 	vendor Vendor
@@ -238,23 +401,7 @@ func (a *internalVendorAdapter) SendRequest(ctx context.Context, req *models.Req
 		return nil, fmt.Errorf("vendor is nil")
 	}
 	// Convert internal request to public request
-	publicReq := &Request{
-		Model:       req.Model,
-		Messages:    make([]Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
-
-	for i, msg := range req.Messages {
-		publicReq.Messages[i] = Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	publicReq := toPublicRequest(req)
 
 	// Call the public vendor
 	publicResp, err := a.vendor.SendRequest(ctx, publicReq)
@@ -263,31 +410,14 @@ func (a *internalVendorAdapter) SendRequest(ctx context.Context, req *models.Req
 	}
 
 	// Convert public response to internal response
-	return &models.Response{
-		Content:      publicResp.Content,
-		Model:        publicResp.Model,
-		Vendor:       publicResp.Vendor,
-		FinishReason: publicResp.FinishReason,
-		CreatedAt:    publicResp.CreatedAt,
-		Usage: models.Usage{
-			PromptTokens:     publicResp.Usage.PromptTokens,
-			CompletionTokens: publicResp.Usage.CompletionTokens,
-			TotalTokens:      publicResp.Usage.TotalTokens,
-		},
-	}, nil
+	return toInternalResponse(publicResp), nil
 }
 
 func (a *internalVendorAdapter) GetCapabilities() models.Capabilities {
 	if a.vendor == nil {
 		return models.Capabilities{}
 	}
-	publicCaps := a.vendor.GetCapabilities()
-	return models.Capabilities{
-		Models:            publicCaps.Models,
-		SupportsStreaming: publicCaps.SupportsStreaming,
-		MaxTokens:         publicCaps.MaxTokens,
-		MaxInputTokens:    publicCaps.MaxInputTokens,
-	}
+	return internalCapabilities(a.vendor.GetCapabilities())
 }
 
 func (a *internalVendorAdapter) IsAvailable(ctx context.Context) bool {
@@ -297,28 +427,26 @@ func (a *internalVendorAdapter) IsAvailable(ctx context.Context) bool {
 	return a.vendor.IsAvailable(ctx)
 }
 
+func (a *internalVendorAdapter) TierModel(tier string) string {
+	if provider, ok := a.vendor.(TierModelProvider); ok {
+		return provider.TierModel(tier)
+	}
+	return ""
+}
+
+func (a *internalVendorAdapter) RetryableStatusCodes() []int {
+	if provider, ok := a.vendor.(RetryableStatusProvider); ok {
+		return provider.RetryableStatusCodes()
+	}
+	return nil
+}
+
 func (a *internalVendorAdapter) SendStreamingRequest(ctx context.Context, req *models.Request) (*models.StreamingResponse, error) {
 	if a.vendor == nil {
 		return nil, fmt.Errorf("vendor is nil")
 	}
 	// Convert internal request to public request
-	publicReq := &Request{
-		Model:       req.Model,
-		Messages:    make([]Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
-
-	for i, msg := range req.Messages {
-		publicReq.Messages[i] = Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	publicReq := toPublicRequest(req)
 
 	// Call the public vendor's streaming method
 	publicStreamingResp, err := a.vendor.SendStreamingRequest(ctx, publicReq)
@@ -334,12 +462,12 @@ func (a *internalVendorAdapter) SendStreamingRequest(ctx context.Context, req *m
 	for {
 		select {
 		case content := <-publicStreamingResp.ContentChan:
-			internalStreamingResp.ContentChan <- content
-		case done := <-publicStreamingResp.DoneChan:
-			internalStreamingResp.DoneChan <- done
+			internalStreamingResp.Send(content)
+		case <-publicStreamingResp.DoneChan:
+			internalStreamingResp.SendDone()
 			return internalStreamingResp, nil
 		case err := <-publicStreamingResp.ErrorChan:
-			internalStreamingResp.ErrorChan <- err
+			internalStreamingResp.SendError(err)
 			return internalStreamingResp, nil
 		default:
 			// If no immediate data, start the goroutine for async streaming
@@ -350,12 +478,14 @@ func (a *internalVendorAdapter) SendStreamingRequest(ctx context.Context, req *m
 				for {
 					select {
 					case content := <-publicStreamingResp.ContentChan:
-						internalStreamingResp.ContentChan <- content
-					case done := <-publicStreamingResp.DoneChan:
-						internalStreamingResp.DoneChan <- done
+						if !internalStreamingResp.Send(content) {
+							return
+						}
+					case <-publicStreamingResp.DoneChan:
+						internalStreamingResp.SendDone()
 						return
 					case err := <-publicStreamingResp.ErrorChan:
-						internalStreamingResp.ErrorChan <- err
+						internalStreamingResp.SendError(err)
 						return
 					}
 				}
@@ -375,102 +505,372 @@ func (w *vendorWrapper) Name() string {
 }
 
 func (w *vendorWrapper) SendRequest(ctx context.Context, req *Request) (*Response, error) {
+	internalReq := toInternalRequest(req)
+
+	internalResp, err := w.vendor.SendRequest(ctx, internalReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPublicResponse(internalResp), nil
+}
+
+func (w *vendorWrapper) GetCapabilities() Capabilities {
+	return publicCapabilities(w.vendor.GetCapabilities())
+}
+
+func (w *vendorWrapper) IsAvailable(ctx context.Context) bool {
+	return w.vendor.IsAvailable(ctx)
+}
+
+func (w *vendorWrapper) SendStreamingRequest(ctx context.Context, req *Request) (*StreamingResponse, error) {
+	internalReq := toInternalRequest(req)
+
+	internalStreamingResp, err := w.vendor.SendStreamingRequest(ctx, internalReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create public streaming response
+	publicStreamingResp := NewStreamingResponse(internalStreamingResp.Model, internalStreamingResp.Vendor)
+
+	go forwardStream(internalStreamingResp, publicStreamingResp)
+
+	return publicStreamingResp, nil
+}
+
+// toInternalRequest converts a public request to the internal format
+func toInternalRequest(req *Request) *models.Request {
 	internalReq := &models.Request{
-		Model:       req.Model,
-		Messages:    make([]models.Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
+		Model:             req.Model,
+		Messages:          make([]models.Message, len(req.Messages)),
+		Temperature:       req.Temperature,
+		MaxTokens:         req.MaxTokens,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		Stop:              req.Stop,
+		User:              req.User,
+		ToolChoice:        req.ToolChoice,
+		ParallelToolCalls: req.ParallelToolCalls,
+		ResponseFormat:    req.ResponseFormat,
+		NoCache:           req.NoCache,
+		CacheTTL:          req.CacheTTL,
+		IncludeReasoning:  req.IncludeReasoning,
+
+		MinResponseTokens:      req.MinResponseTokens,
+		MinResponseRetryPrompt: req.MinResponseRetryPrompt,
+		MaxCost:                req.MaxCost,
+		Tier:                   req.Tier,
 	}
 
 	for i, msg := range req.Messages {
 		internalReq.Messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Parts:      toInternalContentParts(msg.Parts),
+			ToolCalls:  toInternalToolCalls(msg.ToolCalls),
+			ToolCallID: msg.ToolCallID,
+		}
+	}
+	if req.Tools != nil {
+		internalReq.Tools = make([]models.Tool, len(req.Tools))
+		for i, tool := range req.Tools {
+			internalReq.Tools[i] = models.Tool(tool)
 		}
 	}
 
-	internalResp, err := w.vendor.SendRequest(ctx, internalReq)
-	if err != nil {
-		return nil, err
+	return internalReq
+}
+
+// toPublicRequest converts an internal request to the public format
+func toPublicRequest(req *models.Request) *Request {
+	publicReq := &Request{
+		Model:             req.Model,
+		Messages:          make([]Message, len(req.Messages)),
+		Temperature:       req.Temperature,
+		MaxTokens:         req.MaxTokens,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		Stop:              req.Stop,
+		User:              req.User,
+		ToolChoice:        req.ToolChoice,
+		ParallelToolCalls: req.ParallelToolCalls,
+		ResponseFormat:    req.ResponseFormat,
+		NoCache:           req.NoCache,
+		CacheTTL:          req.CacheTTL,
+		IncludeReasoning:  req.IncludeReasoning,
+		Tier:              req.Tier,
+	}
+
+	for i, msg := range req.Messages {
+		publicReq.Messages[i] = Message{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Parts:      toPublicContentParts(msg.Parts),
+			ToolCalls:  toPublicToolCalls(msg.ToolCalls),
+			ToolCallID: msg.ToolCallID,
+		}
+	}
+	if req.Tools != nil {
+		publicReq.Tools = make([]Tool, len(req.Tools))
+		for i, tool := range req.Tools {
+			publicReq.Tools[i] = Tool(tool)
+		}
 	}
 
+	return publicReq
+}
+
+// toPublicResponse converts an internal response to the public format
+func toPublicResponse(resp *models.Response) *Response {
 	return &Response{
-		Content:      internalResp.Content,
-		Model:        internalResp.Model,
-		Vendor:       internalResp.Vendor,
-		FinishReason: internalResp.FinishReason,
-		CreatedAt:    internalResp.CreatedAt,
+		Content:          resp.Content,
+		Model:            resp.Model,
+		Vendor:           resp.Vendor,
+		FinishReason:     resp.FinishReason,
+		CreatedAt:        resp.CreatedAt,
+		SafetyRatings:    toPublicSafetyRatings(resp.SafetyRatings),
+		VendorHeaders:    resp.VendorHeaders,
+		RequestedModel:   resp.RequestedModel,
+		Raw:              resp.Raw,
+		ToolCalls:        toPublicToolCalls(resp.ToolCalls),
+		ReasoningContent: resp.ReasoningContent,
+		EstimatedCost:    resp.EstimatedCost,
+		CostEstimated:    resp.CostEstimated,
+		RoutingTrace:     toPublicRoutingTrace(resp.RoutingTrace),
+		RequestBytes:     resp.RequestBytes,
+		ResponseBytes:    resp.ResponseBytes,
 		Usage: Usage{
-			PromptTokens:     internalResp.Usage.PromptTokens,
-			CompletionTokens: internalResp.Usage.CompletionTokens,
-			TotalTokens:      internalResp.Usage.TotalTokens,
+			PromptTokens:        resp.Usage.PromptTokens,
+			CompletionTokens:    resp.Usage.CompletionTokens,
+			TotalTokens:         resp.Usage.TotalTokens,
+			CacheCreationTokens: resp.Usage.CacheCreationTokens,
+			CacheReadTokens:     resp.Usage.CacheReadTokens,
+			ReasoningTokens:     resp.Usage.ReasoningTokens,
 		},
-	}, nil
+	}
 }
 
-func (w *vendorWrapper) GetCapabilities() Capabilities {
-	internalCaps := w.vendor.GetCapabilities()
-	return Capabilities{
-		Models:            internalCaps.Models,
-		SupportsStreaming: internalCaps.SupportsStreaming,
-		MaxTokens:         internalCaps.MaxTokens,
-		MaxInputTokens:    internalCaps.MaxInputTokens,
+// toInternalResponse converts a public response to the internal format
+func toInternalResponse(resp *Response) *models.Response {
+	return &models.Response{
+		Content:          resp.Content,
+		Model:            resp.Model,
+		Vendor:           resp.Vendor,
+		FinishReason:     resp.FinishReason,
+		CreatedAt:        resp.CreatedAt,
+		SafetyRatings:    toInternalSafetyRatings(resp.SafetyRatings),
+		VendorHeaders:    resp.VendorHeaders,
+		RequestedModel:   resp.RequestedModel,
+		Raw:              resp.Raw,
+		ToolCalls:        toInternalToolCalls(resp.ToolCalls),
+		ReasoningContent: resp.ReasoningContent,
+		EstimatedCost:    resp.EstimatedCost,
+		CostEstimated:    resp.CostEstimated,
+		RoutingTrace:     toInternalRoutingTrace(resp.RoutingTrace),
+		RequestBytes:     resp.RequestBytes,
+		ResponseBytes:    resp.ResponseBytes,
+		Usage: models.Usage{
+			PromptTokens:        resp.Usage.PromptTokens,
+			CompletionTokens:    resp.Usage.CompletionTokens,
+			TotalTokens:         resp.Usage.TotalTokens,
+			CacheCreationTokens: resp.Usage.CacheCreationTokens,
+			CacheReadTokens:     resp.Usage.CacheReadTokens,
+			ReasoningTokens:     resp.Usage.ReasoningTokens,
+		},
 	}
 }
 
-func (w *vendorWrapper) IsAvailable(ctx context.Context) bool {
-	return w.vendor.IsAvailable(ctx)
+// toPublicRoutingTrace converts an internal routing trace, keeping nil as nil
+func toPublicRoutingTrace(trace *models.RoutingTrace) *RoutingTrace {
+	if trace == nil {
+		return nil
+	}
+	candidates := make([]RoutingCandidate, len(trace.Candidates))
+	for i, candidate := range trace.Candidates {
+		candidates[i] = RoutingCandidate(candidate)
+	}
+	return &RoutingTrace{
+		Mode:       Mode(trace.Mode),
+		Candidates: candidates,
+		Vendor:     trace.Vendor,
+		Reason:     RoutingReason(trace.Reason),
+	}
 }
 
-func (w *vendorWrapper) SendStreamingRequest(ctx context.Context, req *Request) (*StreamingResponse, error) {
-	internalReq := &models.Request{
-		Model:       req.Model,
-		Messages:    make([]models.Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
+// toInternalRoutingTrace converts a public routing trace, keeping nil as nil
+func toInternalRoutingTrace(trace *RoutingTrace) *models.RoutingTrace {
+	if trace == nil {
+		return nil
+	}
+	candidates := make([]models.RoutingCandidate, len(trace.Candidates))
+	for i, candidate := range trace.Candidates {
+		candidates[i] = models.RoutingCandidate(candidate)
 	}
+	return &models.RoutingTrace{
+		Mode:       models.Mode(trace.Mode),
+		Candidates: candidates,
+		Vendor:     trace.Vendor,
+		Reason:     models.RoutingReason(trace.Reason),
+	}
+}
 
-	for i, msg := range req.Messages {
-		internalReq.Messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+// toPublicContentParts converts internal content parts, keeping nil as nil
+func toPublicContentParts(parts []models.ContentPart) []ContentPart {
+	if parts == nil {
+		return nil
+	}
+	converted := make([]ContentPart, len(parts))
+	for i, part := range parts {
+		converted[i] = ContentPart(part)
+	}
+	return converted
+}
+
+// toInternalContentParts converts public content parts, keeping nil as nil
+func toInternalContentParts(parts []ContentPart) []models.ContentPart {
+	if parts == nil {
+		return nil
+	}
+	converted := make([]models.ContentPart, len(parts))
+	for i, part := range parts {
+		converted[i] = models.ContentPart(part)
+	}
+	return converted
+}
+
+// toPublicToolCalls converts internal tool calls, keeping nil as nil
+func toPublicToolCalls(calls []models.ToolCall) []ToolCall {
+	if calls == nil {
+		return nil
+	}
+	converted := make([]ToolCall, len(calls))
+	for i, call := range calls {
+		converted[i] = ToolCall(call)
+	}
+	return converted
+}
+
+// toInternalToolCalls converts public tool calls, keeping nil as nil
+func toInternalToolCalls(calls []ToolCall) []models.ToolCall {
+	if calls == nil {
+		return nil
+	}
+	converted := make([]models.ToolCall, len(calls))
+	for i, call := range calls {
+		converted[i] = models.ToolCall(call)
+	}
+	return converted
+}
+
+// toInternalPricing converts a public pricing table, keeping nil as nil
+func toInternalPricing(table PricingTable) models.PricingTable {
+	if table == nil {
+		return nil
+	}
+	converted := make(models.PricingTable, len(table))
+	for vendor, prices := range table {
+		converted[vendor] = make(map[string]models.ModelPrice, len(prices))
+		for model, price := range prices {
+			converted[vendor][model] = models.ModelPrice(price)
+		}
+	}
+	return converted
+}
+
+// toPublicPricing converts an internal pricing table, keeping nil as nil
+func toPublicPricing(table models.PricingTable) PricingTable {
+	if table == nil {
+		return nil
+	}
+	converted := make(PricingTable, len(table))
+	for vendor, prices := range table {
+		converted[vendor] = make(map[string]ModelPrice, len(prices))
+		for model, price := range prices {
+			converted[vendor][model] = ModelPrice(price)
 		}
 	}
+	return converted
+}
 
-	internalStreamingResp, err := w.vendor.SendStreamingRequest(ctx, internalReq)
-	if err != nil {
-		return nil, err
+// toPublicSafetyRatings converts internal safety ratings, keeping nil as nil
+func toPublicSafetyRatings(ratings []models.SafetyRating) []SafetyRating {
+	if ratings == nil {
+		return nil
 	}
+	converted := make([]SafetyRating, len(ratings))
+	for i, rating := range ratings {
+		converted[i] = SafetyRating(rating)
+	}
+	return converted
+}
 
-	// Create public streaming response
-	publicStreamingResp := NewStreamingResponse(internalStreamingResp.Model, internalStreamingResp.Vendor)
+// toInternalSafetyRatings converts public safety ratings, keeping nil as nil
+func toInternalSafetyRatings(ratings []SafetyRating) []models.SafetyRating {
+	if ratings == nil {
+		return nil
+	}
+	converted := make([]models.SafetyRating, len(ratings))
+	for i, rating := range ratings {
+		converted[i] = models.SafetyRating(rating)
+	}
+	return converted
+}
 
-	// Copy the channels and data
-	go func() {
-		defer publicStreamingResp.Close()
-		defer internalStreamingResp.Close()
+// forwardStream copies an internal stream to a public one, including the
+// final usage. Closing the public stream closes the internal one in turn,
+// which stops its producer.
+func forwardStream(src *models.StreamingResponse, dst *StreamingResponse) {
+	defer dst.Close()
+	defer src.Close()
 
-		for {
+	for {
+		var err error
+		select {
+		case content, ok := <-src.ContentChan:
+			if ok {
+				if !dst.Send(content) {
+					return
+				}
+				continue
+			}
+			// A stream closed after failing still holds its error
 			select {
-			case content := <-internalStreamingResp.ContentChan:
-				publicStreamingResp.ContentChan <- content
-			case done := <-internalStreamingResp.DoneChan:
-				publicStreamingResp.DoneChan <- done
-				return
-			case err := <-internalStreamingResp.ErrorChan:
-				publicStreamingResp.ErrorChan <- err
-				return
+			case err = <-src.ErrorChan:
+			default:
+			}
+		case err = <-src.ErrorChan:
+		case _, ok := <-src.DoneChan:
+			if !ok {
+				select {
+				case err = <-src.ErrorChan:
+				default:
+				}
 			}
 		}
-	}()
 
-	return publicStreamingResp, nil
+		// Forward content buffered before the stream ended
+		for len(src.ContentChan) > 0 {
+			if content, ok := <-src.ContentChan; !ok || !dst.Send(content) {
+				break
+			}
+		}
+		if err != nil {
+			dst.SendError(err)
+			return
+		}
+		// Usage is final once the internal stream signals done
+		dst.Usage = Usage{
+			PromptTokens:        src.Usage.PromptTokens,
+			CompletionTokens:    src.Usage.CompletionTokens,
+			TotalTokens:         src.Usage.TotalTokens,
+			CacheCreationTokens: src.Usage.CacheCreationTokens,
+			CacheReadTokens:     src.Usage.CacheReadTokens,
+			ReasoningTokens:     src.Usage.ReasoningTokens,
+		}
+		dst.UsageEstimated = src.UsageEstimated
+		dst.RawEvents = src.RawEvents
+		dst.SendDone()
+		return
+	}
 }
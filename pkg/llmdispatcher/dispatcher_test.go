@@ -362,6 +362,24 @@ func TestGetVendor(t *testing.T) {
 	}
 }
 
+func TestDeregisterVendor(t *testing.T) {
+	dispatcher := New()
+
+	if err := dispatcher.RegisterVendor(&MockVendor{name: "test-vendor"}); err != nil {
+		t.Fatalf("Failed to register vendor: %v", err)
+	}
+	if err := dispatcher.DeregisterVendor("test-vendor"); err != nil {
+		t.Fatalf("Failed to deregister vendor: %v", err)
+	}
+
+	if _, exists := dispatcher.GetVendor("test-vendor"); exists {
+		t.Error("Expected vendor to be gone")
+	}
+	if err := dispatcher.DeregisterVendor("test-vendor"); err == nil {
+		t.Error("Expected an error deregistering an unknown vendor")
+	}
+}
+
 func TestVendorCapabilities(t *testing.T) {
 	// Test vendor capabilities through the public API
 	mockVendor := &MockVendor{
@@ -970,3 +988,166 @@ func (m *MockInternalVendor) SendStreamingRequest(ctx context.Context, req *mode
 
 	return streamingResp, nil
 }
+
+func TestRequestConversion_RoundTrip(t *testing.T) {
+	req := &Request{
+		Model:    "test-model",
+		Messages: []Message{{Role: "user", Content: "Hello"}},
+		NoCache:  true,
+		CacheTTL: time.Minute,
+		Tier:     "premium",
+	}
+
+	internalReq := toInternalRequest(req)
+	if !internalReq.NoCache || internalReq.CacheTTL != time.Minute {
+		t.Errorf("Expected NoCache and CacheTTL to reach the internal request, got %v and %v", internalReq.NoCache, internalReq.CacheTTL)
+	}
+
+	publicReq := toPublicRequest(internalReq)
+	if !publicReq.NoCache || publicReq.CacheTTL != time.Minute {
+		t.Errorf("Expected NoCache and CacheTTL to survive the round trip, got %v and %v", publicReq.NoCache, publicReq.CacheTTL)
+	}
+	if internalReq.Tier != "premium" || publicReq.Tier != "premium" {
+		t.Errorf("Expected tier 'premium' both ways, got '%s' and '%s'", internalReq.Tier, publicReq.Tier)
+	}
+}
+
+func TestResponseConversion_RoundTrip(t *testing.T) {
+	resp := &Response{
+		Content:       "Hello",
+		EstimatedCost: 0.25,
+		CostEstimated: true,
+		RoutingTrace: &RoutingTrace{
+			Mode:       FastMode,
+			Candidates: []RoutingCandidate{{Vendor: "openai", Available: true}},
+			Vendor:     "openai",
+			Reason:     RoutingReasonPreference,
+		},
+		RequestBytes:  100,
+		ResponseBytes: 200,
+	}
+
+	got := toPublicResponse(toInternalResponse(resp))
+	if got.EstimatedCost != 0.25 || !got.CostEstimated {
+		t.Errorf("Expected cost 0.25 estimated, got %v estimated %v", got.EstimatedCost, got.CostEstimated)
+	}
+	if got.RequestBytes != 100 || got.ResponseBytes != 200 {
+		t.Errorf("Expected 100 and 200 bytes, got %d and %d", got.RequestBytes, got.ResponseBytes)
+	}
+	if got.RoutingTrace == nil {
+		t.Fatal("Expected routing trace, got nil")
+	}
+	if got.RoutingTrace.Mode != FastMode || got.RoutingTrace.Vendor != "openai" ||
+		got.RoutingTrace.Reason != RoutingReasonPreference || len(got.RoutingTrace.Candidates) != 1 {
+		t.Errorf("Expected routing trace to survive the round trip, got %+v", got.RoutingTrace)
+	}
+}
+
+// constantEmbedder embeds every text as the same vector
+type constantEmbedder struct{}
+
+func (constantEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	return []float64{1, 0}, nil
+}
+
+func TestNewWithConfig_SemanticCache(t *testing.T) {
+	dispatcher := NewWithConfig(&Config{
+		SemanticCache: &SemanticCacheConfig{
+			Enabled:  true,
+			Embedder: constantEmbedder{},
+		},
+	})
+
+	mockVendor := &MockVendor{
+		name:      "test-vendor",
+		response:  &Response{Content: "cached", Model: "test-model", Vendor: "test-vendor"},
+		available: true,
+	}
+	if err := dispatcher.RegisterVendor(mockVendor); err != nil {
+		t.Fatalf("Failed to register vendor: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, prompt := range []string{"Hello", "Hi"} {
+		req := &Request{Model: "test-model", Messages: []Message{{Role: "user", Content: prompt}}}
+		if _, err := dispatcher.Send(ctx, req); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+
+	stats := dispatcher.GetStats()
+	if stats.SemanticCacheHits != 1 || stats.SemanticCacheMisses != 1 {
+		t.Errorf("Expected 1 semantic cache hit and 1 miss, got %d and %d", stats.SemanticCacheHits, stats.SemanticCacheMisses)
+	}
+}
+
+func TestNewWithConfig_DeniedModels(t *testing.T) {
+	dispatcher := NewWithConfig(&Config{DeniedModels: []string{"test-*"}})
+
+	mockVendor := &MockVendor{
+		name:      "test-vendor",
+		response:  &Response{Content: "Hello", Model: "test-model", Vendor: "test-vendor"},
+		available: true,
+	}
+	if err := dispatcher.RegisterVendor(mockVendor); err != nil {
+		t.Fatalf("Failed to register vendor: %v", err)
+	}
+
+	req := &Request{Model: "test-model", Messages: []Message{{Role: "user", Content: "Hello"}}}
+	_, err := dispatcher.Send(context.Background(), req)
+	if !errors.Is(err, models.ErrModelNotAllowed) {
+		t.Errorf("Expected ErrModelNotAllowed, got %v", err)
+	}
+}
+
+func TestNewWithConfig_TierRouting(t *testing.T) {
+	dispatcher := NewWithConfig(&Config{TierRouting: map[string]Mode{"free": CostSavingMode}})
+
+	mockVendor := &MockVendor{
+		name:      "test-vendor",
+		response:  &Response{Content: "Hello", Model: "test-model", Vendor: "test-vendor"},
+		available: true,
+	}
+	if err := dispatcher.RegisterVendor(mockVendor); err != nil {
+		t.Fatalf("Failed to register vendor: %v", err)
+	}
+
+	ctx := context.Background()
+	req := &Request{Model: "test-model", Messages: []Message{{Role: "user", Content: "Hello"}}, Tier: "free"}
+	if _, err := dispatcher.Send(ctx, req); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	req.Tier = "premium"
+	if _, err := dispatcher.Send(ctx, req); err == nil {
+		t.Error("Expected an error for an unconfigured tier")
+	}
+}
+
+func TestNewWithConfig_StreamingFallbackVendor(t *testing.T) {
+	dispatcher := NewWithConfig(&Config{
+		Mode:                    FastMode,
+		StreamingFallbackVendor: "backup",
+		ModeOverrides: &ModeOverrides{
+			VendorPreferences: map[Mode][]string{FastMode: {"primary"}},
+		},
+	})
+
+	capabilities := Capabilities{Models: []string{"test-model"}, SupportsStreaming: true}
+	primary := &MockVendor{name: "primary", available: true, supportsStreaming: true, shouldFail: true, capabilities: capabilities}
+	backup := &MockVendor{name: "backup", available: true, supportsStreaming: true, capabilities: capabilities}
+	for _, vendor := range []*MockVendor{primary, backup} {
+		if err := dispatcher.RegisterVendor(vendor); err != nil {
+			t.Fatalf("Failed to register vendor: %v", err)
+		}
+	}
+
+	req := &Request{Model: "test-model", Messages: []Message{{Role: "user", Content: "Hello"}}}
+	response, err := dispatcher.SendStreaming(context.Background(), req)
+	if err != nil {
+		t.Fatalf("SendStreaming() failed: %v", err)
+	}
+	if response.Vendor != "backup" {
+		t.Errorf("Expected vendor 'backup', got '%s'", response.Vendor)
+	}
+}
@@ -0,0 +1,233 @@
+package llmdispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// openAIChatRequest is the subset of an OpenAI chat completions body that
+// ParseOpenAIRequest understands. Fields that can take several shapes are
+// decoded lazily.
+type openAIChatRequest struct {
+	Model               string              `json:"model"`
+	Messages            []openAIChatMessage `json:"messages"`
+	Temperature         float64             `json:"temperature"`
+	MaxTokens           int                 `json:"max_tokens"`
+	MaxCompletionTokens int                 `json:"max_completion_tokens"`
+	TopP                float64             `json:"top_p"`
+	Stream              bool                `json:"stream"`
+	Stop                json.RawMessage     `json:"stop"`
+	User                string              `json:"user"`
+	ParallelToolCalls   *bool               `json:"parallel_tool_calls"`
+	Tools               []openAIChatTool    `json:"tools"`
+	ToolChoice          json.RawMessage     `json:"tool_choice"`
+	ResponseFormat      *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+// openAIChatMessage is an OpenAI message whose content is either a string
+// or a list of content parts
+type openAIChatMessage struct {
+	Role       string               `json:"role"`
+	Content    json.RawMessage      `json:"content"`
+	ToolCalls  []openAIChatToolCall `json:"tool_calls"`
+	ToolCallID string               `json:"tool_call_id"`
+}
+
+// openAIChatTool is an OpenAI tool definition
+type openAIChatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+// openAIChatToolCall is a tool call made by an earlier assistant message
+type openAIChatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ParseOpenAIRequest decodes an OpenAI chat completions request body into a
+// Request, so payloads built for the OpenAI API can be sent through the
+// dispatcher unchanged. max_completion_tokens is used when max_tokens is
+// not set, and stop may be a string or a list. Function tools, tool_choice
+// and the tool calls and results of earlier turns are kept. Content lists
+// holding images become the message's Parts.
+//
+// Requests that rely on features the dispatcher cannot forward yet, such as
+// a json_schema response_format or audio content parts, are rejected rather
+// than silently sent without them.
+func ParseOpenAIRequest(r io.Reader) (*Request, error) {
+	var body openAIChatRequest
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAI request: %w", err)
+	}
+
+	toolChoice, err := parseOpenAIToolChoice(body.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+	var responseFormat string
+	if body.ResponseFormat != nil {
+		responseFormat = body.ResponseFormat.Type
+		if responseFormat != "" && responseFormat != ResponseFormatText && responseFormat != ResponseFormatJSON {
+			return nil, fmt.Errorf("OpenAI request uses response_format %q, which is not supported", responseFormat)
+		}
+	}
+
+	req := &Request{
+		Model:             body.Model,
+		Messages:          make([]Message, 0, len(body.Messages)),
+		Temperature:       body.Temperature,
+		MaxTokens:         body.MaxTokens,
+		TopP:              body.TopP,
+		Stream:            body.Stream,
+		User:              body.User,
+		ToolChoice:        toolChoice,
+		ParallelToolCalls: body.ParallelToolCalls,
+		ResponseFormat:    responseFormat,
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = body.MaxCompletionTokens
+	}
+
+	for i, tool := range body.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tool %d: type %q is not supported", i, tool.Type)
+		}
+		req.Tools = append(req.Tools, Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+
+	for i, msg := range body.Messages {
+		content, parts, err := parseOpenAIContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		// OpenAI's "developer" role replaces "system" for newer models
+		role := msg.Role
+		if role == "developer" {
+			role = "system"
+		}
+		message := Message{Role: role, Content: content, Parts: parts, ToolCallID: msg.ToolCallID}
+		for _, call := range msg.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			})
+		}
+		req.Messages = append(req.Messages, message)
+	}
+
+	stop, err := parseOpenAIStop(body.Stop)
+	if err != nil {
+		return nil, err
+	}
+	req.Stop = stop
+
+	return req, nil
+}
+
+// parseOpenAIContent returns the text of a message content, joining text
+// parts with newlines. Content with images is returned as parts instead.
+func parseOpenAIContent(raw json.RawMessage) (string, []ContentPart, error) {
+	if isNullJSON(raw) {
+		return "", nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, nil
+	}
+
+	var rawParts []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if err := json.Unmarshal(raw, &rawParts); err != nil {
+		return "", nil, fmt.Errorf("invalid content: %w", err)
+	}
+
+	texts := make([]string, 0, len(rawParts))
+	parts := make([]ContentPart, 0, len(rawParts))
+	hasImage := false
+	for _, part := range rawParts {
+		switch part.Type {
+		case ContentPartText:
+			texts = append(texts, part.Text)
+			parts = append(parts, ContentPart{Type: ContentPartText, Text: part.Text})
+		case ContentPartImage:
+			hasImage = true
+			parts = append(parts, ContentPart{Type: ContentPartImage, ImageURL: part.ImageURL.URL})
+		default:
+			return "", nil, fmt.Errorf("content part type %q is not supported", part.Type)
+		}
+	}
+	if hasImage {
+		return "", parts, nil
+	}
+	return strings.Join(texts, "\n"), nil, nil
+}
+
+// parseOpenAIToolChoice accepts tool_choice as "auto", "none" or
+// "required", or as an object naming the function to call
+func parseOpenAIToolChoice(raw json.RawMessage) (string, error) {
+	if isNullJSON(raw) {
+		return "", nil
+	}
+
+	var choice string
+	if err := json.Unmarshal(raw, &choice); err == nil {
+		return choice, nil
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return "", fmt.Errorf("invalid tool_choice: %s", raw)
+	}
+	return named.Function.Name, nil
+}
+
+// parseOpenAIStop accepts stop as a single string or a list of strings
+func parseOpenAIStop(raw json.RawMessage) ([]string, error) {
+	if isNullJSON(raw) {
+		return nil, nil
+	}
+
+	var stop string
+	if err := json.Unmarshal(raw, &stop); err == nil {
+		return []string{stop}, nil
+	}
+
+	var stops []string
+	if err := json.Unmarshal(raw, &stops); err != nil {
+		return nil, fmt.Errorf("invalid stop: %w", err)
+	}
+	return stops, nil
+}
+
+// isNullJSON reports whether a raw JSON value is absent or null
+func isNullJSON(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
@@ -0,0 +1,185 @@
+package llmdispatcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOpenAIRequest(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "developer", "content": "You are terse."},
+			{"role": "user", "content": [{"type": "text", "text": "Hello"}, {"type": "text", "text": "there"}]},
+			{"role": "assistant", "content": "Hi!"},
+			{"role": "user", "content": "Weather?"}
+		],
+		"temperature": 0.2,
+		"top_p": 0.9,
+		"max_completion_tokens": 256,
+		"stream": true,
+		"stop": "END",
+		"user": "user-123",
+		"parallel_tool_calls": false,
+		"response_format": {"type": "json_object"}
+	}`
+
+	req, err := ParseOpenAIRequest(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if req.Model != "gpt-4o" {
+		t.Errorf("Expected model gpt-4o, got %s", req.Model)
+	}
+	if req.Temperature != 0.2 || req.TopP != 0.9 {
+		t.Errorf("Expected temperature 0.2 and top_p 0.9, got %v and %v", req.Temperature, req.TopP)
+	}
+	if req.MaxTokens != 256 {
+		t.Errorf("Expected max tokens from max_completion_tokens, got %d", req.MaxTokens)
+	}
+	if !req.Stream {
+		t.Error("Expected stream to be set")
+	}
+	if len(req.Stop) != 1 || req.Stop[0] != "END" {
+		t.Errorf("Expected stop [END], got %v", req.Stop)
+	}
+	if req.User != "user-123" {
+		t.Errorf("Expected user user-123, got %s", req.User)
+	}
+	if req.ParallelToolCalls == nil || *req.ParallelToolCalls {
+		t.Errorf("Expected parallel tool calls false, got %v", req.ParallelToolCalls)
+	}
+	if req.ResponseFormat != ResponseFormatJSON {
+		t.Errorf("Expected response format %s, got %s", ResponseFormatJSON, req.ResponseFormat)
+	}
+
+	expected := []Message{
+		{Role: "system", Content: "You are terse."},
+		{Role: "user", Content: "Hello\nthere"},
+		{Role: "assistant", Content: "Hi!"},
+		{Role: "user", Content: "Weather?"},
+	}
+	if len(req.Messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d", len(expected), len(req.Messages))
+	}
+	for i, msg := range expected {
+		if req.Messages[i].Role != msg.Role || req.Messages[i].Content != msg.Content {
+			t.Errorf("Expected message %d to be %+v, got %+v", i, msg, req.Messages[i])
+		}
+	}
+}
+
+func TestParseOpenAIRequest_Tools(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "18C"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "description": "Current weather", "parameters": {"type": "object"}}}],
+		"tool_choice": {"type": "function", "function": {"name": "get_weather"}}
+	}`
+
+	req, err := ParseOpenAIRequest(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(req.Tools) != 1 || req.Tools[0].Name != "get_weather" || req.Tools[0].Description != "Current weather" {
+		t.Fatalf("Expected get_weather tool, got %+v", req.Tools)
+	}
+	if string(req.Tools[0].Parameters) != `{"type": "object"}` {
+		t.Errorf("Expected parameters to be kept, got %s", req.Tools[0].Parameters)
+	}
+	if req.ToolChoice != "get_weather" {
+		t.Errorf("Expected tool choice get_weather, got %q", req.ToolChoice)
+	}
+
+	if len(req.Messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(req.Messages))
+	}
+	calls := req.Messages[1].ToolCalls
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Name != "get_weather" || calls[0].Arguments != `{"city":"Paris"}` {
+		t.Errorf("Expected assistant tool call, got %+v", calls)
+	}
+	if req.Messages[2].Role != "tool" || req.Messages[2].ToolCallID != "call_1" || req.Messages[2].Content != "18C" {
+		t.Errorf("Expected tool result message, got %+v", req.Messages[2])
+	}
+}
+
+func TestParseOpenAIRequest_ImageContent(t *testing.T) {
+	body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": [
+		{"type": "text", "text": "What is this?"},
+		{"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}
+	]}]}`
+
+	req, err := ParseOpenAIRequest(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []ContentPart{
+		{Type: ContentPartText, Text: "What is this?"},
+		{Type: ContentPartImage, ImageURL: "https://example.com/a.png"},
+	}
+	parts := req.Messages[0].Parts
+	if len(parts) != len(expected) {
+		t.Fatalf("Expected %d parts, got %+v", len(expected), parts)
+	}
+	for i, part := range expected {
+		if parts[i] != part {
+			t.Errorf("Expected part %d to be %+v, got %+v", i, part, parts[i])
+		}
+	}
+}
+
+func TestParseOpenAIRequest_Unsupported(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		expectedError string
+	}{
+		{
+			name: "non-function tool",
+			body: `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Weather in Paris?"}],
+				"tools": [{"type": "code_interpreter"}]}`,
+			expectedError: "code_interpreter",
+		},
+		{
+			name:          "invalid tool choice",
+			body:          `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}], "tool_choice": {"type": "function"}}`,
+			expectedError: "tool_choice",
+		},
+		{
+			name:          "json schema response format",
+			body:          `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}], "response_format": {"type": "json_schema", "json_schema": {"name": "reply"}}}`,
+			expectedError: "json_schema",
+		},
+		{
+			name:          "audio content",
+			body:          `{"model": "gpt-4o", "messages": [{"role": "user", "content": [{"type": "input_audio", "input_audio": {"data": "", "format": "wav"}}]}]}`,
+			expectedError: "input_audio",
+		},
+		{
+			name:          "invalid json",
+			body:          `{"model": `,
+			expectedError: "failed to decode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOpenAIRequest(strings.NewReader(tt.body))
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected error to contain %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
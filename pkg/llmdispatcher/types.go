@@ -2,9 +2,13 @@ package llmdispatcher
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"sync"
 	"time"
+
+	"github.com/llmefficiency/llmdispatcher/internal/models"
 )
 
 // Mode represents the predefined optimization modes
@@ -42,6 +46,51 @@ type Vendor interface {
 	IsAvailable(ctx context.Context) bool
 }
 
+// CapabilityProvider reports a vendor's current capabilities at runtime, for
+// example from the vendor's /models endpoint
+type CapabilityProvider interface {
+	FetchCapabilities(ctx context.Context) (Capabilities, error)
+}
+
+// Logger receives the dispatcher's log messages. keysAndValues alternate
+// between a string key and its value, e.g. "vendor", "openai".
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// TokenCounter counts the tokens a text takes up in a model's context
+type TokenCounter interface {
+	CountTokens(model, text string) int
+}
+
+// Embedder turns text into an embedding vector, e.g. through a vendor's
+// embeddings endpoint
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// RetryableStatusProvider is implemented by vendors that declare which HTTP
+// statuses of their error responses are worth retrying; nil keeps the
+// defaults
+type RetryableStatusProvider interface {
+	RetryableStatusCodes() []int
+}
+
+// TierModelProvider is implemented by vendors that can name their default
+// model for a capability tier ("fast", "balanced", "sophisticated")
+type TierModelProvider interface {
+	// TierModel returns the model for the tier, or "" if none is configured
+	TierModel(tier string) string
+}
+
+// MaxTokensVendorDefault, as a Request's MaxTokens, leaves the response
+// length to the vendor's default rather than the mode's; vendors that
+// require a limit send their model's maximum output. Zero means unset.
+const MaxTokensVendorDefault = -1
+
 // Request represents a standardized LLM request
 type Request struct {
 	Model       string    `json:"model"`
@@ -50,14 +99,104 @@ type Request struct {
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	TopP        float64   `json:"top_p,omitempty"`
 	Stream      bool      `json:"stream,omitempty"`
-	Stop        []string  `json:"stop,omitempty"`
+	Stop        []string  `json:"stop,omitempty"` // empty and duplicate entries are dropped
 	User        string    `json:"user,omitempty"`
+	// Tools are the functions the model may call instead of answering.
+	// Vendors without tool support reject requests with tools.
+	Tools []Tool `json:"tools,omitempty"`
+	// ToolChoice is ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired or
+	// the name of the tool the model must call. Empty leaves the vendor
+	// default.
+	ToolChoice string `json:"tool_choice,omitempty"`
+	// ParallelToolCalls controls whether the model may call several tools
+	// at once. Nil leaves the vendor default; only OpenAI honors it.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// ResponseFormat asks for output in a format such as ResponseFormatJSON.
+	// Empty leaves the vendor default of plain text.
+	ResponseFormat string `json:"response_format,omitempty"`
+	// NoCache sends the request to the vendor even when a cached response
+	// would match, and keeps its response out of the cache
+	NoCache bool `json:"no_cache,omitempty"`
+	// CacheTTL overrides how long the response is cached; zero uses the
+	// cache's default TTL
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+	// IncludeReasoning asks for a reasoning model's reasoning in
+	// Response.ReasoningContent and its token count in
+	// Usage.ReasoningTokens. Reasoning is kept out of Content either way.
+	IncludeReasoning bool `json:"include_reasoning,omitempty"`
+	// MinResponseTokens retries responses with fewer completion tokens,
+	// counting against the retry policy's MaxRetries; the last response is
+	// returned as it is. MinResponseRetryPrompt, if set, is added as a user
+	// message when retrying.
+	MinResponseTokens      int    `json:"min_response_tokens,omitempty"`
+	MinResponseRetryPrompt string `json:"min_response_retry_prompt,omitempty"`
+	// MaxCost caps the request's estimated cost, in dollars, of its prompt
+	// plus MaxTokens of completion. Over the cap the request fails without
+	// reaching the vendor, or moves to a cheaper vendor under
+	// Config.MaxCostPolicy. Zero is no cap.
+	MaxCost float64 `json:"max_cost,omitempty"`
+	// Tier is the caller's service tier, e.g. "free" or "premium", which
+	// picks the request's mode through Config.TierRouting. It must be one
+	// of the configured tiers.
+	Tier string `json:"tier,omitempty"`
+}
+
+// Response formats for Request.ResponseFormat
+const (
+	ResponseFormatText = "text"
+	ResponseFormatJSON = "json_object"
+)
+
+// Tool is a function the model may call
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the function's arguments object
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is the model's call of one of the request's tools. A follow-up
+// request returns its result in a "tool" message with the call's ID.
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is the JSON object of arguments the model passed
+	Arguments string `json:"arguments"`
 }
 
+// Tool choices for Request.ToolChoice, besides the name of a tool
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// ContentPart is one part of a multimodal message
+type ContentPart struct {
+	// Type is ContentPartText or ContentPartImage
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// ImageURL is the image's URL, or a base64 data URL
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// Content part types for ContentPart.Type
+const (
+	ContentPartText  = "text"
+	ContentPartImage = "image_url"
+)
+
 // Message represents a single message in a conversation
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Parts holds multimodal content, text and images, in place of Content
+	Parts []ContentPart `json:"parts,omitempty"`
+	// ToolCalls are the calls an assistant message made, when the
+	// conversation is continued after a response with tool calls
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a "tool" message holds the result of
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 // Response represents a standardized LLM response
@@ -68,6 +207,73 @@ type Response struct {
 	Vendor       string    `json:"vendor"`
 	FinishReason string    `json:"finish_reason,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+	// EstimatedCost is the response's cost in dollars. CostEstimated is
+	// set when the vendor reported no usage and the cost is based on
+	// estimated token counts.
+	EstimatedCost float64 `json:"estimated_cost,omitempty"`
+	CostEstimated bool    `json:"cost_estimated,omitempty"`
+	// SafetyRatings holds the vendor's content safety assessment of the
+	// response. It is nil for vendors that don't report one.
+	SafetyRatings []SafetyRating `json:"safety_ratings,omitempty"`
+	// RoutingTrace explains how the vendor was selected, set when
+	// Config.RecordRoutingTrace is enabled
+	RoutingTrace *RoutingTrace `json:"routing_trace,omitempty"`
+	// VendorHeaders holds the captured response headers, keyed by
+	// lower-case name; see VendorConfig.CaptureHeaders
+	VendorHeaders map[string]string `json:"vendor_headers,omitempty"`
+	// RequestedModel is the model the caller asked for when a model
+	// rewrite sent the request for a different one
+	RequestedModel string `json:"requested_model,omitempty"`
+	// Raw is the vendor's untouched response body, set when
+	// Config.IncludeRawResponse is enabled
+	Raw json.RawMessage `json:"raw,omitempty"`
+	// ToolCalls are the tools the model called, with FinishReason
+	// "tool_calls". Content may be empty when they are set.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ReasoningContent is a reasoning model's reasoning, when the request
+	// asked for it with IncludeReasoning and the vendor returns it
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// RequestBytes and ResponseBytes are the sizes of the HTTP request and
+	// response bodies exchanged with the vendor
+	RequestBytes  int64 `json:"request_bytes,omitempty"`
+	ResponseBytes int64 `json:"response_bytes,omitempty"`
+}
+
+// RoutingReason explains why a vendor was selected
+type RoutingReason string
+
+const (
+	// RoutingReasonPreference means the vendor was the first available one
+	// in the mode's vendor preferences
+	RoutingReasonPreference RoutingReason = "preference_match"
+	// RoutingReasonHeuristic means the mode strategy's own ranking picked
+	// the vendor
+	RoutingReasonHeuristic RoutingReason = "heuristic"
+	// RoutingReasonFallback means no preferred or ranked vendor was
+	// available and any available vendor was used
+	RoutingReasonFallback RoutingReason = "fallback"
+)
+
+// RoutingTrace records the selection of a request's vendor
+type RoutingTrace struct {
+	Mode       Mode               `json:"mode"`
+	Candidates []RoutingCandidate `json:"candidates"`
+	Vendor     string             `json:"vendor"`
+	Reason     RoutingReason      `json:"reason"`
+}
+
+// RoutingCandidate is a vendor considered during selection
+type RoutingCandidate struct {
+	Vendor    string `json:"vendor"`
+	Available bool   `json:"available"`
+}
+
+// SafetyRating is a vendor's assessment of content for one harm category,
+// using the vendor's own category and severity names
+type SafetyRating struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Blocked  bool   `json:"blocked"`
 }
 
 // StreamingResponse represents a streaming LLM response
@@ -76,11 +282,27 @@ type StreamingResponse struct {
 	DoneChan    chan bool   `json:"-"`
 	ErrorChan   chan error  `json:"-"`
 	Usage       Usage       `json:"usage"`
-	Model       string      `json:"model"`
-	Vendor      string      `json:"vendor"`
-	CreatedAt   time.Time   `json:"created_at"`
-	closed      bool        `json:"-"`
-	mu          sync.Mutex  `json:"-"`
+	// UsageEstimated is set when the vendor reported no usage for the
+	// stream and Usage holds token estimates of the prompt and the
+	// streamed content instead
+	UsageEstimated bool `json:"usage_estimated,omitempty"`
+	// RawEvents holds the data of the vendor's stream events when
+	// Config.IncludeRawResponse is enabled. It is complete once done is
+	// signalled.
+	RawEvents []json.RawMessage `json:"raw_events,omitempty"`
+	Model     string            `json:"model"`
+	Vendor    string            `json:"vendor"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	// Senders hold mu for reading while they send; Close takes it for
+	// writing once stop has released them
+	closed bool
+	mu     sync.RWMutex
+
+	// stop is closed by Close so producers blocked on a send give up
+	stopMu   sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewStreamingResponse creates a new streaming response
@@ -95,8 +317,13 @@ func NewStreamingResponse(model, vendor string) *StreamingResponse {
 	}
 }
 
-// Close closes all channels in the streaming response
+// Close closes all channels in the streaming response. Producers blocked
+// in Send, SendDone or SendError are released first, so a consumer that
+// stops reading can Close the stream to stop its producer.
 func (s *StreamingResponse) Close() {
+	stop := s.stopChan()
+	s.stopOnce.Do(func() { close(stop) })
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -109,11 +336,153 @@ func (s *StreamingResponse) Close() {
 	close(s.ErrorChan)
 }
 
+// Send delivers a content chunk, blocking while the buffer is full. It
+// returns false once the stream is closed, and the producer should stop.
+func (s *StreamingResponse) Send(content string) bool {
+	return sendOrStop(s, s.ContentChan, content)
+}
+
+// SendDone signals that the stream completed. It returns false once the
+// stream is closed.
+func (s *StreamingResponse) SendDone() bool {
+	return sendOrStop(s, s.DoneChan, true)
+}
+
+// SendError signals that the stream failed. It returns false once the
+// stream is closed.
+func (s *StreamingResponse) SendError(err error) bool {
+	return sendOrStop(s, s.ErrorChan, err)
+}
+
+// sendOrStop sends value on ch unless the stream is or gets closed
+func sendOrStop[T any](s *StreamingResponse, ch chan T, value T) bool {
+	stop := s.stopChan()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return false
+	}
+	select {
+	case ch <- value:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// stopChan returns the stop channel, creating it for streaming responses
+// built without NewStreamingResponse
+func (s *StreamingResponse) stopChan() chan struct{} {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s.stop
+}
+
+// Reader returns the stream's content as an io.ReadCloser, for consumers
+// that expect one, such as io.Copy to an HTTP response. Read blocks until
+// content arrives, and returns io.EOF once the stream is done or the
+// stream's error if it fails. Closing the reader closes the stream. The
+// reader must be the stream's only consumer.
+func (s *StreamingResponse) Reader() io.ReadCloser {
+	return &streamReader{stream: s}
+}
+
+// streamReader reads a streaming response's content as bytes
+type streamReader struct {
+	stream *StreamingResponse
+	// pending is the unread rest of the current chunk
+	pending []byte
+	// end is how the stream ended, once it has; err is returned by Read
+	// once the content buffered before the end has been read
+	end error
+	err error
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *streamReader) Close() error {
+	r.stream.Close()
+	return nil
+}
+
+// next waits for the next chunk or the end of the stream. Content that was
+// buffered when the stream ended is read before the end is reported.
+func (r *streamReader) next() {
+	if r.end != nil {
+		select {
+		case chunk, ok := <-r.stream.ContentChan:
+			if ok {
+				r.pending = []byte(chunk)
+				return
+			}
+		default:
+		}
+		r.err = r.end
+		return
+	}
+
+	select {
+	case chunk, ok := <-r.stream.ContentChan:
+		if !ok {
+			r.err = r.closedEnd()
+			return
+		}
+		r.pending = []byte(chunk)
+	case _, ok := <-r.stream.DoneChan:
+		r.end = io.EOF
+		if !ok {
+			r.end = r.closedEnd()
+		}
+	case err := <-r.stream.ErrorChan:
+		// A nil error means the stream was closed after it was done
+		r.end = io.EOF
+		if err != nil {
+			r.end = err
+		}
+	}
+}
+
+// closedEnd reports how a closed stream ended, picking up an error sent
+// just before it was closed
+func (r *streamReader) closedEnd() error {
+	select {
+	case err := <-r.stream.ErrorChan:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+	return io.EOF
+}
+
 // Usage represents token usage information
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Prompt tokens written to and read from the vendor's prompt cache,
+	// included in PromptTokens
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+	CacheReadTokens     int `json:"cache_read_tokens,omitempty"`
+	// ReasoningTokens are the completion tokens a reasoning model spent
+	// thinking, included in CompletionTokens
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
 }
 
 // Capabilities represents what a vendor can do
@@ -122,6 +491,20 @@ type Capabilities struct {
 	SupportsStreaming bool     `json:"supports_streaming"`
 	MaxTokens         int      `json:"max_tokens"`
 	MaxInputTokens    int      `json:"max_input_tokens"`
+	// MaxStopSequences is how many stop sequences a request may carry, or
+	// zero when the vendor sets no limit
+	MaxStopSequences int `json:"max_stop_sequences,omitempty"`
+	// Features lists what each model supports. Models without an entry are
+	// assumed to support every feature.
+	Features map[string]ModelFeatures `json:"features,omitempty"`
+}
+
+// ModelFeatures describes the optional features of a model
+type ModelFeatures struct {
+	Vision    bool `json:"vision"`
+	Tools     bool `json:"tools"`
+	JSONMode  bool `json:"json_mode"`
+	Streaming bool `json:"streaming"`
 }
 
 // Config holds the simplified dispatcher configuration
@@ -134,13 +517,234 @@ type Config struct {
 	EnableLogging bool          `json:"enable_logging"`
 	EnableMetrics bool          `json:"enable_metrics"`
 
+	// Least severe messages logged, defaulting to LogLevelInfo. Debug
+	// messages also need EnableLogging.
+	LogLevel LogLevel `json:"log_level,omitempty"`
+
+	// Destination of log messages, replacing the default standard library
+	// logger. It receives every level and does its own filtering.
+	Logger Logger `json:"-"`
+
+	// Counts tokens for cost estimates, rate limits and the mode
+	// strategies' cost checks, replacing the default counter that uses
+	// OpenAI's BPE encodings
+	TokenCounter TokenCounter `json:"-"`
+
+	// Extra time allowed per requested output token. The effective timeout
+	// is Timeout + TimeoutPerToken*MaxTokens, capped at MaxTimeout when set.
+	TimeoutPerToken time.Duration `json:"timeout_per_token,omitempty"`
+	MaxTimeout      time.Duration `json:"max_timeout,omitempty"`
+
+	// How long selection waits for the vendors' availability checks before
+	// treating the vendors yet to answer as unavailable. Zero uses the
+	// default of 2s; a negative timeout disables the bound.
+	AvailabilityCheckTimeout time.Duration `json:"availability_check_timeout,omitempty"`
+
+	// Central model rewrites, e.g. sending all "gpt-4" traffic to
+	// "gpt-4o". ModelRewrites maps exact model names; ModelRewriter, if
+	// set, then receives the result and returns the model to use.
+	ModelRewrites map[string]string   `json:"model_rewrites,omitempty"`
+	ModelRewriter func(string) string `json:"-"`
+
+	// Glob patterns (e.g. "gpt-4*") restricting the models a request may
+	// ask for. An empty AllowedModels allows every model; a model matching
+	// DeniedModels is rejected even if it is allowed.
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	DeniedModels  []string `json:"denied_models,omitempty"`
+
+	// Mode for each service tier named in Request.Tier, e.g. routing
+	// "free" requests in CostSavingMode. Requests for a tier not listed
+	// here are rejected.
+	TierRouting map[string]Mode `json:"tier_routing,omitempty"`
+
 	// Retry configuration
 	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty"`
 
+	// What to do when the selected vendor doesn't list the requested model,
+	// defaulting to UnknownModelForward
+	UnknownVendorModelPolicy UnknownModelPolicy `json:"unknown_vendor_model_policy,omitempty"`
+
+	// What to do when the selected vendor's estimate for a request exceeds
+	// its MaxCost, defaulting to MaxCostReject
+	MaxCostPolicy MaxCostPolicy `json:"max_cost_policy,omitempty"`
+
+	// Prices used to estimate costs, by vendor and model, taking precedence
+	// over DefaultPricingTable for the models they list
+	Pricing PricingTable `json:"pricing,omitempty"`
+
+	// Vendor that Send falls back to, once, when the selected vendor's
+	// request fails
+	FallbackVendor string `json:"fallback_vendor,omitempty"`
+
+	// Vendor that takes over a streaming request when the selected vendor
+	// fails before sending any content. It must support streaming.
+	StreamingFallbackVendor string `json:"streaming_fallback_vendor,omitempty"`
+
+	// Seed for the random choice among fallback vendors, for reproducible
+	// routing. Zero seeds from the current time.
+	RoutingSeed int64 `json:"routing_seed,omitempty"`
+
+	// Choose the least recently used of equally ranked vendors, to spread
+	// load across them
+	LRUTieBreak bool `json:"lru_tie_break,omitempty"`
+
+	// Attach the vendor's untouched response body to Response.Raw, and its
+	// stream events to StreamingResponse.RawEvents, for debugging
+	IncludeRawResponse bool `json:"include_raw_response,omitempty"`
+
+	// Record on each response how its vendor was selected, in
+	// Response.RoutingTrace
+	RecordRoutingTrace bool `json:"record_routing_trace,omitempty"`
+
+	// Record the average request and response body sizes of each vendor
+	// in VendorStats
+	TrackPayloadSizes bool `json:"track_payload_sizes,omitempty"`
+
+	// Wait for capacity when a request would exceed its vendor's
+	// RateLimit, instead of failing with a rate limit error
+	WaitForRateLimit bool `json:"wait_for_rate_limit,omitempty"`
+
+	// Stop routing to a vendor that keeps failing until it has had time to
+	// recover (optional)
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+
+	// MaxTokens for requests that leave it unset: by model name or glob
+	// pattern (e.g. "gpt-4o*"), with the most specific entry winning, and
+	// otherwise DefaultMaxTokens. Zero leaves the default to the mode.
+	DefaultMaxTokens        int            `json:"default_max_tokens,omitempty"`
+	DefaultMaxTokensByModel map[string]int `json:"default_max_tokens_by_model,omitempty"`
+
+	// Serve identical requests from an in-memory response cache (optional)
+	Cache *CacheConfig `json:"cache,omitempty"`
+
+	// Serve requests whose prompts are similar to a cached one's from an
+	// embedding-based response cache (optional)
+	SemanticCache *SemanticCacheConfig `json:"semantic_cache,omitempty"`
+
 	// Mode-specific overrides (optional)
 	ModeOverrides *ModeOverrides `json:"mode_overrides,omitempty"`
 }
 
+// LogLevel decides which messages the dispatcher logs
+type LogLevel string
+
+const (
+	// LogLevelDebug also logs per-request detail
+	LogLevelDebug LogLevel = "debug"
+	// LogLevelInfo logs routing decisions, retries and fallbacks
+	LogLevelInfo LogLevel = "info"
+	// LogLevelNone logs nothing
+	LogLevelNone LogLevel = "none"
+)
+
+// UnknownModelPolicy decides how a request is routed when the selected
+// vendor doesn't list its model
+type UnknownModelPolicy string
+
+const (
+	// UnknownModelForward sends the request to the vendor anyway
+	UnknownModelForward UnknownModelPolicy = "forward"
+	// UnknownModelError fails the request
+	UnknownModelError UnknownModelPolicy = "error"
+	// UnknownModelFallback sends the request to another vendor that lists
+	// the model
+	UnknownModelFallback UnknownModelPolicy = "fallback"
+)
+
+// MaxCostPolicy decides what happens to a request whose estimated cost on
+// the selected vendor exceeds its MaxCost
+type MaxCostPolicy string
+
+const (
+	// MaxCostReject fails the request
+	MaxCostReject MaxCostPolicy = "reject"
+	// MaxCostDowngrade sends the request to the cheapest other vendor
+	// within the cap
+	MaxCostDowngrade MaxCostPolicy = "downgrade"
+)
+
+// ModelPrice is what a model charges, in dollars per 1K tokens, for the
+// prompt tokens it reads and the completion tokens it generates
+type ModelPrice struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+}
+
+// PricingTable maps vendors to the prices of their models, keyed by model
+// name or glob pattern. A "*" entry prices the vendor's models not listed.
+type PricingTable map[string]map[string]ModelPrice
+
+// DefaultPricingTable returns the vendors' published list prices, used for
+// models that Config.Pricing leaves out
+func DefaultPricingTable() PricingTable {
+	return toPublicPricing(models.DefaultPricingTable())
+}
+
+// CircuitBreakerConfig configures the per-vendor circuit breakers. A
+// vendor is left out of selection for Cooldown after FailureThreshold
+// consecutive failures within Window, then gets one call to prove it has
+// recovered. Only 5xx, 408 and 429 responses, network errors and the
+// vendor's own timeouts count as failures.
+type CircuitBreakerConfig struct {
+	// Consecutive failures that open the circuit, defaulting to 5
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// Time the failures must fall within; zero counts them however far
+	// apart they are
+	Window time.Duration `json:"window,omitempty"`
+	// How long the circuit stays open, defaulting to 30 seconds
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+}
+
+// CacheConfig configures the response cache. A cached response is returned
+// for a request that matches the one it answered in every field that
+// shapes the response, such as its model, mode, messages, tools and
+// sampling parameters. Streaming requests are never cached.
+type CacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// Maximum number of stored responses, defaulting to 1000. When full the
+	// least recently used response is evicted.
+	MaxEntries int `json:"max_entries,omitempty"`
+	// How long a response is served from the cache; zero keeps responses
+	// until they are evicted
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Also cache requests with a Temperature above zero
+	AllowNonZeroTemperature bool `json:"allow_non_zero_temperature,omitempty"`
+}
+
+// SemanticCacheConfig configures the embedding-based response cache. A
+// cached response is returned when a new prompt's embedding is at least
+// SimilarityThreshold cosine-similar to a stored prompt of an otherwise
+// matching request. Streaming requests and prompts with images are never
+// cached.
+type SemanticCacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// Embedder computes prompt embeddings; the cache is disabled without one
+	Embedder Embedder `json:"-"`
+	// Minimum cosine similarity for a hit, defaulting to 0.95
+	SimilarityThreshold float64 `json:"similarity_threshold,omitempty"`
+	// Maximum number of stored responses, defaulting to 1000
+	MaxEntries int `json:"max_entries,omitempty"`
+	// How long a response is served from the cache; zero keeps responses
+	// until they are evicted
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// CircuitState is the state of a vendor's circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerStats describes a vendor's circuit breaker
+type CircuitBreakerStats struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            time.Time    `json:"opened_at,omitempty"`
+}
+
 // ModeOverrides allows fine-tuning of mode behavior
 type ModeOverrides struct {
 	// Vendor preferences for each mode (ordered by preference)
@@ -154,6 +758,10 @@ type ModeOverrides struct {
 
 	// Model preferences for sophisticated mode
 	SophisticatedModels []string `json:"sophisticated_models,omitempty"`
+
+	// Default stop sequences added to requests in each mode, e.g. "\n\n" to
+	// curb verbosity in cost-saving mode
+	StopSequences map[Mode][]string `json:"stop_sequences,omitempty"`
 }
 
 // RoutingStrategy defines how requests should be routed to vendors
@@ -316,20 +924,23 @@ func (m *ModeStrategy) selectCostSavingVendor(ctx context.Context, req *Request,
 		name     string
 		priority int
 		models   []string
-		cost     float64 // Cost per 1K tokens (approximate)
 	}{
-		{"local", 1, []string{"llama2:7b", "mistral:7b", "gemma:2b"}, 0.0001},  // Local is cheapest
-		{"google", 2, []string{"gemini-1.5-flash", "gemini-1.5-pro"}, 0.0005},  // Google is cheap
-		{"azure", 3, []string{"gpt-35-turbo", "gpt-4"}, 0.002},                 // Azure is reasonable
-		{"openai", 4, []string{"gpt-3.5-turbo", "gpt-4o-mini"}, 0.002},         // OpenAI is moderate
-		{"anthropic", 5, []string{"claude-3-haiku", "claude-3-sonnet"}, 0.003}, // Anthropic is pricier
+		{"local", 1, []string{"llama2:7b", "mistral:7b", "gemma:2b"}},   // Local is cheapest
+		{"google", 2, []string{"gemini-1.5-flash", "gemini-1.5-pro"}},   // Google is cheap
+		{"azure", 3, []string{"gpt-35-turbo", "gpt-4"}},                 // Azure is reasonable
+		{"openai", 4, []string{"gpt-3.5-turbo", "gpt-4o-mini"}},         // OpenAI is moderate
+		{"anthropic", 5, []string{"claude-3-haiku", "claude-3-sonnet"}}, // Anthropic is pricier
 	}
 
 	for _, costVendor := range costSavingVendors {
 		if vendor, exists := vendors[costVendor.name]; exists && vendor.IsAvailable(ctx) {
 			// Check cost limits if specified
 			if m.config.ModeOverrides != nil && m.config.ModeOverrides.MaxCostPerRequest > 0 {
-				estimatedCost := m.estimateRequestCost(req, costVendor.cost)
+				model := req.Model
+				if model == "" {
+					model = costVendor.models[0]
+				}
+				estimatedCost := m.estimateRequestCost(req, m.price(costVendor.name, model))
 				if estimatedCost > m.config.ModeOverrides.MaxCostPerRequest {
 					continue // Skip if too expensive
 				}
@@ -470,8 +1081,8 @@ func (m *ModeStrategy) optimizeRequestForBalance(req *Request) {
 	// Let vendor choose a balanced available model
 }
 
-// estimateRequestCost estimates the cost of a request based on token count and vendor cost
-func (m *ModeStrategy) estimateRequestCost(req *Request, costPer1KTokens float64) float64 {
+// estimateRequestCost estimates the cost of a request based on token count and the model's price
+func (m *ModeStrategy) estimateRequestCost(req *Request, price ModelPrice) float64 {
 	// Rough estimation based on input length and max tokens
 	inputTokens := m.estimateInputTokens(req)
 	outputTokens := req.MaxTokens
@@ -479,19 +1090,32 @@ func (m *ModeStrategy) estimateRequestCost(req *Request, costPer1KTokens float64
 		outputTokens = 500 // Default estimate
 	}
 
-	totalTokens := inputTokens + outputTokens
-	return (float64(totalTokens) / 1000.0) * costPer1KTokens
+	return models.ModelPrice(price).Cost(inputTokens, outputTokens)
 }
 
-// estimateInputTokens roughly estimates the number of tokens in the input
+// price returns the price of a vendor's model from the config's Pricing,
+// or the default pricing table
+func (m *ModeStrategy) price(vendor, model string) ModelPrice {
+	var pricing models.PricingTable
+	if m.config != nil {
+		pricing = toInternalPricing(m.config.Pricing)
+	}
+	return ModelPrice(pricing.Price(vendor, model))
+}
+
+// estimateInputTokens counts the tokens in the input with the config's
+// TokenCounter
 func (m *ModeStrategy) estimateInputTokens(req *Request) int {
-	totalChars := 0
-	for _, msg := range req.Messages {
-		totalChars += len(msg.Content)
+	var counter TokenCounter = models.DefaultTokenCounter()
+	if m.config != nil && m.config.TokenCounter != nil {
+		counter = m.config.TokenCounter
 	}
 
-	// Rough estimation: 1 token ≈ 4 characters
-	return totalChars / 4
+	tokens := 0
+	for _, msg := range req.Messages {
+		tokens += counter.CountTokens(req.Model, msg.Content)
+	}
+	return tokens
 }
 
 // RetryPolicy defines how retries should be handled
@@ -499,6 +1123,9 @@ type RetryPolicy struct {
 	MaxRetries      int             `json:"max_retries"`
 	BackoffStrategy BackoffStrategy `json:"backoff_strategy"`
 	RetryableErrors []string        `json:"retryable_errors,omitempty"`
+	// Jitter randomizes each backoff so requests that fail together don't
+	// retry in lockstep. Empty leaves backoffs as the strategy computes them.
+	Jitter JitterStrategy `json:"jitter,omitempty"`
 }
 
 // BackoffStrategy defines the retry backoff strategy
@@ -510,6 +1137,17 @@ const (
 	FixedBackoff       BackoffStrategy = "fixed"
 )
 
+// JitterStrategy defines how retry backoffs are randomized
+type JitterStrategy string
+
+const (
+	// FullJitter waits a random time between zero and the backoff
+	FullJitter JitterStrategy = "full"
+	// EqualJitter waits half the backoff plus a random time up to the
+	// other half
+	EqualJitter JitterStrategy = "equal"
+)
+
 // Stats holds statistics about the dispatcher
 type Stats struct {
 	TotalRequests      int64                  `json:"total_requests"`
@@ -519,9 +1157,25 @@ type Stats struct {
 	AverageLatency     time.Duration          `json:"average_latency"`
 	LastRequestTime    time.Time              `json:"last_request_time"`
 	// Advanced metrics
-	TotalCost    float64            `json:"total_cost"`
+	TotalCost float64 `json:"total_cost"`
+	// Mean cost of the successful vendor responses; failed requests and
+	// cached responses incur no cost
 	AverageCost  float64            `json:"average_cost"`
 	CostByVendor map[string]float64 `json:"cost_by_vendor"`
+	// Number of responses whose cost was estimated because the vendor
+	// reported no usage
+	EstimatedCostCount int64 `json:"estimated_cost_count"`
+	// Requests by the model they were sent for, after model rewrites
+	RequestsByModel map[string]int64 `json:"requests_by_model,omitempty"`
+	// Requests served from, and missing, the response cache
+	CacheHits   int64 `json:"cache_hits"`
+	CacheMisses int64 `json:"cache_misses"`
+	// Requests served from, and missing, the semantic cache
+	SemanticCacheHits   int64 `json:"semantic_cache_hits"`
+	SemanticCacheMisses int64 `json:"semantic_cache_misses"`
+	// Circuit breaker of each vendor that has been called, when
+	// Config.CircuitBreaker is set
+	CircuitBreakers map[string]CircuitBreakerStats `json:"circuit_breakers,omitempty"`
 }
 
 // VendorStats holds statistics for a specific vendor
@@ -532,9 +1186,29 @@ type VendorStats struct {
 	AverageLatency time.Duration `json:"average_latency"`
 	LastUsed       time.Time     `json:"last_used"`
 	// Advanced metrics
-	TotalCost   float64 `json:"total_cost"`
+	TotalCost float64 `json:"total_cost"`
+	// Mean cost of the vendor's successful calls
 	AverageCost float64 `json:"average_cost"`
 	TokenUsage  int64   `json:"token_usage"`
+	// Responses that came back without usage
+	MissingUsageCount int64 `json:"missing_usage_count"`
+	// Remaining rate limits from the last response that reported them,
+	// parsed from its VendorHeaders
+	RateLimitRemainingRequests int64     `json:"rate_limit_remaining_requests,omitempty"`
+	RateLimitRemainingTokens   int64     `json:"rate_limit_remaining_tokens,omitempty"`
+	RateLimitObservedAt        time.Time `json:"rate_limit_observed_at,omitempty"`
+	// Streaming metrics
+	AverageTTFT           time.Duration `json:"average_ttft"`
+	TTFTSamples           int64         `json:"ttft_samples"`
+	StreamCount           int64         `json:"stream_count"`
+	AverageStreamDuration time.Duration `json:"average_stream_duration"`
+	TotalStreamChunks     int64         `json:"total_stream_chunks"`
+	AverageStreamChunks   float64       `json:"average_stream_chunks"`
+	// Payload size metrics, recorded when Config.TrackPayloadSizes is
+	// enabled
+	PayloadSamples   int64   `json:"payload_samples,omitempty"`
+	AvgRequestBytes  float64 `json:"avg_request_bytes,omitempty"`
+	AvgResponseBytes float64 `json:"avg_response_bytes,omitempty"`
 }
 
 // VendorConfig holds configuration for a specific vendor
@@ -544,6 +1218,23 @@ type VendorConfig struct {
 	Timeout   time.Duration     `json:"timeout,omitempty"`
 	Headers   map[string]string `json:"headers,omitempty"`
 	RateLimit RateLimit         `json:"rate_limit,omitempty"`
+	// Additional models the vendor serves beyond its built-in list
+	Models []string `json:"models,omitempty"`
+	// ModelNameMap translates logical model names into the IDs this vendor
+	// expects, e.g. "gpt-3.5-turbo" to "gpt-35-turbo" for Azure
+	ModelNameMap map[string]string `json:"model_name_map,omitempty"`
+	// TierModels names the vendor's default model for each capability tier
+	// ("fast", "balanced", "sophisticated"), used when a request leaves the
+	// model to its mode
+	TierModels map[string]string `json:"tier_models,omitempty"`
+	// CaptureHeaders lists the response headers copied into
+	// Response.VendorHeaders, defaulting to the vendors' rate-limit
+	// headers. An empty, non-nil list captures nothing.
+	CaptureHeaders []string `json:"capture_headers,omitempty"`
+	// RetryableStatusCodes lists the HTTP statuses of the vendor's error
+	// responses that the retry policy retries, defaulting to 429, 500, 502,
+	// 503 and 504. An empty, non-nil list retries none.
+	RetryableStatusCodes []int `json:"retryable_status_codes,omitempty"`
 }
 
 // RateLimit represents rate limiting configuration
@@ -1,6 +1,8 @@
 package llmdispatcher
 
 import (
+	"errors"
+	"io"
 	"testing"
 	"time"
 )
@@ -85,6 +87,27 @@ func TestStreamingResponse_CloseChannels(t *testing.T) {
 	}
 }
 
+func TestStreamingResponse_Reader(t *testing.T) {
+	streamErr := errors.New("stream failed")
+	streamingResp := NewStreamingResponse("test-model", "test-vendor")
+	go func() {
+		defer streamingResp.Close()
+		streamingResp.Send("Hello")
+		streamingResp.Send(" world")
+		streamingResp.SendError(streamErr)
+	}()
+
+	reader := streamingResp.Reader()
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if !errors.Is(err, streamErr) {
+		t.Errorf("Expected the stream's error, got %v", err)
+	}
+	if string(content) != "Hello world" {
+		t.Errorf("Expected the content before the error, got %q", content)
+	}
+}
+
 func TestRequest_Validation(t *testing.T) {
 	tests := []struct {
 		name    string
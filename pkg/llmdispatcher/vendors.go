@@ -20,6 +20,10 @@ func NewOpenAIVendor(config *VendorConfig) Vendor {
 			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
 			TokensPerMinute:   config.RateLimit.TokensPerMinute,
 		}
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
 	}
 
 	return &vendorAdapter{
@@ -40,6 +44,10 @@ func NewAnthropicVendor(config *VendorConfig) Vendor {
 			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
 			TokensPerMinute:   config.RateLimit.TokensPerMinute,
 		}
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
 	}
 
 	return &vendorAdapter{
@@ -60,6 +68,10 @@ func NewGoogleVendor(config *VendorConfig) Vendor {
 			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
 			TokensPerMinute:   config.RateLimit.TokensPerMinute,
 		}
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
 	}
 
 	return &vendorAdapter{
@@ -80,6 +92,10 @@ func NewAzureOpenAIVendor(config *VendorConfig) Vendor {
 			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
 			TokensPerMinute:   config.RateLimit.TokensPerMinute,
 		}
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
 	}
 
 	return &vendorAdapter{
@@ -87,6 +103,118 @@ func NewAzureOpenAIVendor(config *VendorConfig) Vendor {
 	}
 }
 
+// NewTogetherVendor creates a new Together AI vendor
+func NewTogetherVendor(config *VendorConfig) Vendor {
+	internalConfig := &models.VendorConfig{}
+
+	if config != nil {
+		internalConfig.APIKey = config.APIKey
+		internalConfig.BaseURL = config.BaseURL
+		internalConfig.Timeout = config.Timeout
+		internalConfig.Headers = config.Headers
+		internalConfig.RateLimit = models.RateLimit{
+			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
+			TokensPerMinute:   config.RateLimit.TokensPerMinute,
+		}
+		internalConfig.Models = config.Models
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
+	}
+
+	return &vendorAdapter{
+		vendor: vendors.NewTogether(internalConfig),
+	}
+}
+
+// NewOpenRouterVendor creates a new OpenRouter vendor. Models are addressed
+// by their fully-qualified OpenRouter IDs, e.g. "anthropic/claude-3.5-sonnet".
+func NewOpenRouterVendor(config *VendorConfig) Vendor {
+	internalConfig := &models.VendorConfig{}
+
+	if config != nil {
+		internalConfig.APIKey = config.APIKey
+		internalConfig.BaseURL = config.BaseURL
+		internalConfig.Timeout = config.Timeout
+		internalConfig.Headers = config.Headers
+		internalConfig.RateLimit = models.RateLimit{
+			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
+			TokensPerMinute:   config.RateLimit.TokensPerMinute,
+		}
+		internalConfig.Models = config.Models
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
+	}
+
+	return &vendorAdapter{
+		vendor: vendors.NewOpenRouter(internalConfig),
+	}
+}
+
+// NewCohereVendor creates a new Cohere vendor
+func NewCohereVendor(config *VendorConfig) Vendor {
+	internalConfig := &models.VendorConfig{}
+
+	if config != nil {
+		internalConfig.APIKey = config.APIKey
+		internalConfig.BaseURL = config.BaseURL
+		internalConfig.Timeout = config.Timeout
+		internalConfig.Headers = config.Headers
+		internalConfig.RateLimit = models.RateLimit{
+			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
+			TokensPerMinute:   config.RateLimit.TokensPerMinute,
+		}
+		internalConfig.Models = config.Models
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
+	}
+
+	return &vendorAdapter{
+		vendor: vendors.NewCohere(internalConfig),
+	}
+}
+
+// VendorConfig.Headers keys holding Bedrock's AWS region and credentials
+const (
+	BedrockRegionHeader       = vendors.BedrockRegionHeader
+	BedrockAccessKeyHeader    = vendors.BedrockAccessKeyHeader
+	BedrockSecretKeyHeader    = vendors.BedrockSecretKeyHeader
+	BedrockSessionTokenHeader = vendors.BedrockSessionTokenHeader
+)
+
+// NewBedrockVendor creates a new AWS Bedrock vendor. Requests are signed
+// with the region and credentials given in config.Headers under
+// BedrockRegionHeader, BedrockAccessKeyHeader, BedrockSecretKeyHeader and,
+// optionally, BedrockSessionTokenHeader.
+func NewBedrockVendor(config *VendorConfig) Vendor {
+	internalConfig := &models.VendorConfig{}
+
+	if config != nil {
+		internalConfig.APIKey = config.APIKey
+		internalConfig.BaseURL = config.BaseURL
+		internalConfig.Timeout = config.Timeout
+		internalConfig.Headers = config.Headers
+		internalConfig.RateLimit = models.RateLimit{
+			RequestsPerMinute: config.RateLimit.RequestsPerMinute,
+			TokensPerMinute:   config.RateLimit.TokensPerMinute,
+		}
+		internalConfig.Models = config.Models
+		internalConfig.ModelNameMap = config.ModelNameMap
+		internalConfig.TierModels = config.TierModels
+		internalConfig.CaptureHeaders = config.CaptureHeaders
+		internalConfig.RetryableStatusCodes = config.RetryableStatusCodes
+	}
+
+	return &vendorAdapter{
+		vendor: vendors.NewBedrock(internalConfig),
+	}
+}
+
 // vendorAdapter adapts the internal vendor interface to the public interface
 type vendorAdapter struct {
 	vendor models.LLMVendor
@@ -97,75 +225,40 @@ func (a *vendorAdapter) Name() string {
 }
 
 func (a *vendorAdapter) SendRequest(ctx context.Context, req *Request) (*Response, error) {
-	internalReq := &models.Request{
-		Model:       req.Model,
-		Messages:    make([]models.Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
-
-	for i, msg := range req.Messages {
-		internalReq.Messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	internalReq := toInternalRequest(req)
 
 	internalResp, err := a.vendor.SendRequest(ctx, internalReq)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Response{
-		Content:      internalResp.Content,
-		Model:        internalResp.Model,
-		Vendor:       internalResp.Vendor,
-		FinishReason: internalResp.FinishReason,
-		CreatedAt:    internalResp.CreatedAt,
-		Usage: Usage{
-			PromptTokens:     internalResp.Usage.PromptTokens,
-			CompletionTokens: internalResp.Usage.CompletionTokens,
-			TotalTokens:      internalResp.Usage.TotalTokens,
-		},
-	}, nil
+	return toPublicResponse(internalResp), nil
 }
 
 func (a *vendorAdapter) GetCapabilities() Capabilities {
-	internalCaps := a.vendor.GetCapabilities()
-	return Capabilities{
-		Models:            internalCaps.Models,
-		SupportsStreaming: internalCaps.SupportsStreaming,
-		MaxTokens:         internalCaps.MaxTokens,
-		MaxInputTokens:    internalCaps.MaxInputTokens,
-	}
+	return publicCapabilities(a.vendor.GetCapabilities())
 }
 
 func (a *vendorAdapter) IsAvailable(ctx context.Context) bool {
 	return a.vendor.IsAvailable(ctx)
 }
 
-func (a *vendorAdapter) SendStreamingRequest(ctx context.Context, req *Request) (*StreamingResponse, error) {
-	internalReq := &models.Request{
-		Model:       req.Model,
-		Messages:    make([]models.Message, len(req.Messages)),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.Stop,
-		User:        req.User,
-	}
-
-	for i, msg := range req.Messages {
-		internalReq.Messages[i] = models.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
+func (a *vendorAdapter) TierModel(tier string) string {
+	if provider, ok := a.vendor.(models.TierModelProvider); ok {
+		return provider.TierModel(tier)
+	}
+	return ""
+}
+
+func (a *vendorAdapter) RetryableStatusCodes() []int {
+	if provider, ok := a.vendor.(models.RetryableStatusProvider); ok {
+		return provider.RetryableStatusCodes()
 	}
+	return nil
+}
+
+func (a *vendorAdapter) SendStreamingRequest(ctx context.Context, req *Request) (*StreamingResponse, error) {
+	internalReq := toInternalRequest(req)
 
 	internalStreamingResp, err := a.vendor.SendStreamingRequest(ctx, internalReq)
 	if err != nil {
@@ -175,24 +268,7 @@ func (a *vendorAdapter) SendStreamingRequest(ctx context.Context, req *Request)
 	// Create public streaming response
 	publicStreamingResp := NewStreamingResponse(internalStreamingResp.Model, internalStreamingResp.Vendor)
 
-	// Copy the channels and data
-	go func() {
-		defer publicStreamingResp.Close()
-		defer internalStreamingResp.Close()
-
-		for {
-			select {
-			case content := <-internalStreamingResp.ContentChan:
-				publicStreamingResp.ContentChan <- content
-			case done := <-internalStreamingResp.DoneChan:
-				publicStreamingResp.DoneChan <- done
-				return
-			case err := <-internalStreamingResp.ErrorChan:
-				publicStreamingResp.ErrorChan <- err
-				return
-			}
-		}
-	}()
+	go forwardStream(internalStreamingResp, publicStreamingResp)
 
 	return publicStreamingResp, nil
 }
@@ -279,3 +279,79 @@ func TestNewAzureOpenAIVendor(t *testing.T) {
 		t.Errorf("Expected name 'azure-openai', got %s", name)
 	}
 }
+
+func TestNewTogetherVendor(t *testing.T) {
+	config := &VendorConfig{
+		APIKey: "test-key",
+		Models: []string{"deepseek-ai/DeepSeek-V3"},
+	}
+
+	vendor := NewTogetherVendor(config)
+	if vendor == nil {
+		t.Fatal("Expected vendor, got nil")
+	}
+
+	name := vendor.Name()
+	if name != "together" {
+		t.Errorf("Expected name 'together', got %s", name)
+	}
+
+	found := false
+	for _, model := range vendor.GetCapabilities().Models {
+		if model == "deepseek-ai/DeepSeek-V3" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected configured model in capabilities")
+	}
+}
+
+func TestNewOpenRouterVendor(t *testing.T) {
+	vendor := NewOpenRouterVendor(&VendorConfig{APIKey: "test-key"})
+	if vendor == nil {
+		t.Fatal("Expected vendor, got nil")
+	}
+
+	name := vendor.Name()
+	if name != "openrouter" {
+		t.Errorf("Expected name 'openrouter', got %s", name)
+	}
+	if !vendor.GetCapabilities().SupportsStreaming {
+		t.Error("Expected streaming support")
+	}
+}
+
+func TestNewCohereVendor(t *testing.T) {
+	vendor := NewCohereVendor(&VendorConfig{APIKey: "test-key"})
+	if vendor == nil {
+		t.Fatal("Expected vendor, got nil")
+	}
+
+	name := vendor.Name()
+	if name != "cohere" {
+		t.Errorf("Expected name 'cohere', got %s", name)
+	}
+	if !vendor.GetCapabilities().SupportsStreaming {
+		t.Error("Expected streaming support")
+	}
+}
+
+func TestNewBedrockVendor(t *testing.T) {
+	vendor := NewBedrockVendor(&VendorConfig{Headers: map[string]string{
+		BedrockRegionHeader:    "us-east-1",
+		BedrockAccessKeyHeader: "AKIDEXAMPLE",
+		BedrockSecretKeyHeader: "secret",
+	}})
+	if vendor == nil {
+		t.Fatal("Expected vendor, got nil")
+	}
+
+	name := vendor.Name()
+	if name != "bedrock" {
+		t.Errorf("Expected name 'bedrock', got %s", name)
+	}
+	if !vendor.IsAvailable(context.Background()) {
+		t.Error("Expected vendor with credentials to be available")
+	}
+}